@@ -0,0 +1,184 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"log"
+	"net/netip"
+	"slices"
+	"strings"
+	"time"
+
+	"Secure-Document-Exchange-Portal/internal/middleware"
+	"Secure-Document-Exchange-Portal/internal/models"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+const (
+	// APIKeyPrefix starts every API key, so leaked keys are easy to spot and
+	// the middleware can tell them from JWTs
+	APIKeyPrefix = "sdx_"
+	// apiKeyDisplayLength is how much of a key is stored in the clear to
+	// tell keys apart
+	apiKeyDisplayLength = len(APIKeyPrefix) + 8
+	// apiKeyTouchInterval limits how often a key's last-used time is written
+	apiKeyTouchInterval = time.Minute
+
+	APIKeyIDKey     = "api_key_id"
+	APIKeyScopesKey = "api_key_scopes"
+)
+
+// API key scopes. A key can only reach the routes its scopes allow; account
+// settings and administration are never available to API keys.
+const (
+	ScopeDocumentsRead     = "documents:read"
+	ScopeDocumentsWrite    = "documents:write"
+	ScopeSharesRead        = "shares:read"
+	ScopeSharesCreate      = "shares:create"
+	ScopeSharesRevoke      = "shares:revoke"
+	ScopeFileRequestsRead  = "file_requests:read"
+	ScopeFileRequestsWrite = "file_requests:write"
+)
+
+// APIKeyScopes lists every scope a key can be given
+var APIKeyScopes = []string{
+	ScopeDocumentsRead,
+	ScopeDocumentsWrite,
+	ScopeSharesRead,
+	ScopeSharesCreate,
+	ScopeSharesRevoke,
+	ScopeFileRequestsRead,
+	ScopeFileRequestsWrite,
+}
+
+// APIKeyStore looks up API keys by the hash of their secret
+type APIKeyStore interface {
+	GetAPIKeyByHash(ctx context.Context, keyHash string) (*models.APIKeyCache, error)
+	TouchAPIKey(ctx context.Context, keyID uuid.UUID, keyHash string, ip *netip.Addr) error
+	InvalidateAPIKey(ctx context.Context, keyHash string)
+}
+
+// GenerateAPIKey returns a new API key and the part of it that may be shown
+// again later
+func GenerateAPIKey() (key, displayPrefix string, err error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", "", err
+	}
+	key = APIKeyPrefix + base64.RawURLEncoding.EncodeToString(raw)
+	return key, key[:apiKeyDisplayLength], nil
+}
+
+// IsAPIKey reports whether a bearer token is an API key rather than a JWT
+func IsAPIKey(token string) bool {
+	return strings.HasPrefix(token, APIKeyPrefix)
+}
+
+// ValidAPIKeyScope reports whether scope is one a key can be given
+func ValidAPIKeyScope(scope string) bool {
+	return slices.Contains(APIKeyScopes, scope)
+}
+
+// authenticatedAPIKey is an accepted API key
+type authenticatedAPIKey struct {
+	ID     uuid.UUID
+	UserID uuid.UUID
+	Scopes []string
+}
+
+// authenticateAPIKey resolves an API key to its owner. It returns the
+// message to answer with when the key is not accepted. A cached key with
+// malformed IDs is dropped from the cache and not accepted.
+func authenticateAPIKey(c *fiber.Ctx, apiKeys APIKeyStore, token string) (*authenticatedAPIKey, string) {
+	keyHash := HashToken(token)
+	key, err := apiKeys.GetAPIKeyByHash(c.Context(), keyHash)
+	if err != nil {
+		return nil, "Invalid API key"
+	}
+	keyID, err := uuid.Parse(key.ID)
+	if err != nil {
+		apiKeys.InvalidateAPIKey(c.Context(), keyHash)
+		return nil, "Invalid API key"
+	}
+	userID, err := uuid.Parse(key.UserID)
+	if err != nil {
+		apiKeys.InvalidateAPIKey(c.Context(), keyHash)
+		return nil, "Invalid API key"
+	}
+	if !key.ExpiresAt.IsZero() && !key.ExpiresAt.After(time.Now()) {
+		return nil, "API key has expired"
+	}
+
+	touchAPIKey(apiKeys, key, keyID, keyHash, middleware.ClientIP(c))
+	return &authenticatedAPIKey{ID: keyID, UserID: userID, Scopes: key.Scopes}, ""
+}
+
+// touchAPIKey records the key's use in the background, at most once per
+// apiKeyTouchInterval
+func touchAPIKey(apiKeys APIKeyStore, key *models.APIKeyCache, keyID uuid.UUID, keyHash, clientIP string) {
+	if time.Since(key.LastUsedAt) < apiKeyTouchInterval {
+		return
+	}
+
+	var ip *netip.Addr
+	if addr, err := netip.ParseAddr(clientIP); err == nil {
+		ip = &addr
+	}
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := apiKeys.TouchAPIKey(ctx, keyID, keyHash, ip); err != nil {
+			log.Printf("Failed to update last used time of API key %s: %v", keyID, err)
+		}
+	}()
+}
+
+// MethodScopes maps HTTP methods to the scope an API key needs for them.
+// HEAD requests need the scope of GET.
+type MethodScopes map[string]string
+
+// RequireScope guards a route group. Requests authenticated with an API key
+// need the scope listed for their method; methods without a scope are
+// refused for API keys. Requests with a login session are not restricted.
+// It must run after AuthMiddleware.
+func RequireScope(scopes MethodScopes) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		method := c.Method()
+		if method == fiber.MethodHead {
+			method = fiber.MethodGet
+		}
+		scope := scopes[method]
+		if HasScope(c, scope) {
+			return c.Next()
+		}
+		if scope == "" {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "API keys cannot be used for this endpoint",
+			})
+		}
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error":          "API key is missing the required scope",
+			"required_scope": scope,
+		})
+	}
+}
+
+// RequireSession refuses API keys. Used for account settings and
+// administration, which need a signed-in user.
+func RequireSession() fiber.Handler {
+	return RequireScope(nil)
+}
+
+// HasScope reports whether the request may use scope. Requests made with a
+// login session have every scope.
+func HasScope(c *fiber.Ctx, scope string) bool {
+	scopes, ok := c.Locals(APIKeyScopesKey).([]string)
+	if !ok {
+		return true
+	}
+	return scope != "" && slices.Contains(scopes, scope)
+}
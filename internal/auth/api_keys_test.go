@@ -0,0 +1,153 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"net/netip"
+	"slices"
+	"testing"
+	"time"
+
+	"Secure-Document-Exchange-Portal/internal/models"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// fakeAPIKeys is an API key store as the cache would return it
+type fakeAPIKeys struct {
+	keys        map[string]*models.APIKeyCache
+	invalidated []string
+}
+
+func (s *fakeAPIKeys) GetAPIKeyByHash(ctx context.Context, keyHash string) (*models.APIKeyCache, error) {
+	key, ok := s.keys[keyHash]
+	if !ok {
+		return nil, errors.New("not found")
+	}
+	copied := *key
+	return &copied, nil
+}
+
+func (s *fakeAPIKeys) TouchAPIKey(ctx context.Context, keyID uuid.UUID, keyHash string, ip *netip.Addr) error {
+	return nil
+}
+
+func (s *fakeAPIKeys) InvalidateAPIKey(ctx context.Context, keyHash string) {
+	s.invalidated = append(s.invalidated, keyHash)
+}
+
+type fakeUsers map[uuid.UUID]*models.UserCache
+
+func (u fakeUsers) GetUserByID(ctx context.Context, userID uuid.UUID) (*models.UserCache, error) {
+	user, ok := u[userID]
+	if !ok {
+		return nil, errors.New("not found")
+	}
+	return user, nil
+}
+
+// A cache entry with malformed IDs is refused and dropped, not trusted or
+// panicked on
+func TestAuthMiddlewareAPIKeyIDs(t *testing.T) {
+	userID := uuid.New()
+	users := fakeUsers{userID: {ID: userID.String(), IsActive: true}}
+
+	cases := []struct {
+		name       string
+		key        models.APIKeyCache
+		wantStatus int
+	}{
+		{"valid", models.APIKeyCache{ID: uuid.NewString(), UserID: userID.String()}, fiber.StatusOK},
+		{"malformed user ID", models.APIKeyCache{ID: uuid.NewString(), UserID: "not-a-uuid"}, fiber.StatusUnauthorized},
+		{"malformed key ID", models.APIKeyCache{ID: "", UserID: userID.String()}, fiber.StatusUnauthorized},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			token, _, err := GenerateAPIKey()
+			if err != nil {
+				t.Fatal(err)
+			}
+			tc.key.LastUsedAt = time.Now()
+			apiKeys := &fakeAPIKeys{keys: map[string]*models.APIKeyCache{HashToken(token): &tc.key}}
+
+			app := fiber.New()
+			app.Use(AuthMiddleware(nil, nil, users, apiKeys))
+			app.Get("/", func(c *fiber.Ctx) error {
+				if id, err := GetUserID(c); err != nil || id != userID {
+					t.Errorf("GetUserID = %s, %v, want %s", id, err, userID)
+				}
+				return c.SendStatus(fiber.StatusOK)
+			})
+
+			req := httptest.NewRequest("GET", "/", nil)
+			req.Header.Set("Authorization", "Bearer "+token)
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != tc.wantStatus {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tc.wantStatus)
+			}
+			invalidated := slices.Contains(apiKeys.invalidated, HashToken(token))
+			if invalidated != (tc.wantStatus != fiber.StatusOK) {
+				t.Errorf("cache entry invalidated = %v", invalidated)
+			}
+		})
+	}
+}
+
+func TestRequireScope(t *testing.T) {
+	scopes := MethodScopes{
+		fiber.MethodGet:    ScopeDocumentsRead,
+		fiber.MethodPost:   ScopeDocumentsWrite,
+		fiber.MethodDelete: ScopeDocumentsWrite,
+	}
+	readOnly := []string{ScopeDocumentsRead}
+	readWrite := []string{ScopeDocumentsRead, ScopeDocumentsWrite}
+
+	cases := []struct {
+		name       string
+		method     string
+		keyScopes  []string // nil for a login session
+		required   MethodScopes
+		wantStatus int
+	}{
+		{"session GET", fiber.MethodGet, nil, scopes, fiber.StatusOK},
+		{"session PUT without a scope", fiber.MethodPut, nil, scopes, fiber.StatusOK},
+		{"session on a session-only route", fiber.MethodPost, nil, nil, fiber.StatusOK},
+		{"GET with read", fiber.MethodGet, readOnly, scopes, fiber.StatusOK},
+		{"HEAD with read", fiber.MethodHead, readOnly, scopes, fiber.StatusOK},
+		{"HEAD without read", fiber.MethodHead, []string{ScopeDocumentsWrite}, scopes, fiber.StatusForbidden},
+		{"POST with read", fiber.MethodPost, readOnly, scopes, fiber.StatusForbidden},
+		{"POST with write", fiber.MethodPost, readWrite, scopes, fiber.StatusOK},
+		{"DELETE with write", fiber.MethodDelete, readWrite, scopes, fiber.StatusOK},
+		{"DELETE with another resource's scope", fiber.MethodDelete, []string{ScopeSharesRevoke}, scopes, fiber.StatusForbidden},
+		{"PUT without a scope", fiber.MethodPut, readWrite, scopes, fiber.StatusForbidden},
+		{"key on a session-only route", fiber.MethodGet, APIKeyScopes, nil, fiber.StatusForbidden},
+		{"key without scopes", fiber.MethodGet, []string{}, scopes, fiber.StatusForbidden},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			app := fiber.New()
+			app.Use(func(c *fiber.Ctx) error {
+				if tc.keyScopes != nil {
+					c.Locals(APIKeyScopesKey, tc.keyScopes)
+				}
+				return c.Next()
+			})
+			app.All("/", RequireScope(tc.required), func(c *fiber.Ctx) error {
+				return c.SendStatus(fiber.StatusOK)
+			})
+
+			resp, err := app.Test(httptest.NewRequest(tc.method, "/", nil))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != tc.wantStatus {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tc.wantStatus)
+			}
+		})
+	}
+}
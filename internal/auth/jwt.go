@@ -2,55 +2,216 @@ package auth
 
 import (
 	"errors"
+	"fmt"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 )
 
+// Audiences of the tokens that only the portal itself accepts. Access
+// tokens carry the configured audience instead, so other services can
+// verify them.
+const (
+	shareAccessAudience  = "share-access"
+	mfaChallengeAudience = "mfa-challenge"
+)
+
 type JWTService struct {
 	secretKey []byte
+	// signingKey signs new tokens; without it tokens use HS256 and secretKey
+	signingKey *jwtKey
+	// verificationKeys holds the signing key and the keys still accepted
+	// during a rotation, by key ID. keyOrder lists them for the JWKS.
+	verificationKeys map[string]*jwtKey
+	keyOrder         []*jwtKey
+	issuer           string
+	audience         string
 }
 
+func NewJWTService(config JWTConfig) (*JWTService, error) {
+	if config.Issuer == "" || config.Audience == "" {
+		return nil, errors.New("the JWT issuer and audience must be set")
+	}
+	if config.Audience == shareAccessAudience || config.Audience == mfaChallengeAudience {
+		return nil, fmt.Errorf("the JWT audience %q is reserved", config.Audience)
+	}
+
+	s := &JWTService{
+		secretKey:        []byte(config.Secret),
+		verificationKeys: make(map[string]*jwtKey),
+		issuer:           config.Issuer,
+		audience:         config.Audience,
+	}
+
+	if config.SigningKeyFile == "" {
+		if len(config.VerificationKeyFiles) > 0 {
+			return nil, errors.New("JWT verification keys need a signing key")
+		}
+		if config.Secret == "" {
+			return nil, errors.New("either a JWT secret or a signing key must be set")
+		}
+		return s, nil
+	}
+
+	signingKey, err := loadJWTKey(config.SigningKeyFile, true)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load JWT signing key: %w", err)
+	}
+	s.signingKey = signingKey
+	s.addVerificationKey(signingKey)
+
+	for _, path := range config.VerificationKeyFiles {
+		key, err := loadJWTKey(path, false)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load JWT verification key: %w", err)
+		}
+		s.addVerificationKey(key)
+	}
+	return s, nil
+}
+
+func (s *JWTService) addVerificationKey(key *jwtKey) {
+	if _, ok := s.verificationKeys[key.id]; ok {
+		return
+	}
+	s.verificationKeys[key.id] = key
+	s.keyOrder = append(s.keyOrder, key)
+}
+
+// registeredClaims returns the standard claims of a token for audience
+func (s *JWTService) registeredClaims(audience string, expiration time.Duration) jwt.RegisteredClaims {
+	now := time.Now()
+	return jwt.RegisteredClaims{
+		Issuer:    s.issuer,
+		Audience:  jwt.ClaimStrings{audience},
+		ExpiresAt: jwt.NewNumericDate(now.Add(expiration)),
+		IssuedAt:  jwt.NewNumericDate(now),
+	}
+}
+
+// sign signs claims with the signing key and names it in the kid header
+func (s *JWTService) sign(claims jwt.Claims) (string, error) {
+	if s.signingKey == nil {
+		return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(s.secretKey)
+	}
+
+	token := jwt.NewWithClaims(s.signingKey.method, claims)
+	token.Header["kid"] = s.signingKey.id
+	return token.SignedString(s.signingKey.private)
+}
+
+// parse verifies a token's signature, issuer, audience and expiry
+func (s *JWTService) parse(tokenString string, claims jwt.Claims, audience string) (*jwt.Token, error) {
+	return jwt.ParseWithClaims(tokenString, claims, s.keyFunc,
+		jwt.WithIssuer(s.issuer),
+		jwt.WithAudience(audience),
+		jwt.WithExpirationRequired(),
+	)
+}
+
+// Claims identify the user and the server-side session a token belongs to.
+// A token is only accepted while its session exists.
 type Claims struct {
-	UserID uuid.UUID `json:"user_id"`
+	UserID    uuid.UUID `json:"user_id"`
+	SessionID uuid.UUID `json:"sid"`
 	jwt.RegisteredClaims
 }
 
-func NewJWTService(secret string) *JWTService {
-	return &JWTService{
-		secretKey: []byte(secret),
-	}
+// ShareAccessClaims grant a browser access to the files of a share bundle
+// after it has passed the share's landing page checks. Email is the address
+// a view-only recipient identified with and is stamped on previews.
+type ShareAccessClaims struct {
+	ShareID uuid.UUID `json:"share_id"`
+	Email   string    `json:"email,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// MFA challenge purposes
+const (
+	MFAPurposeLogin = "login" // The user has to enter a code from their authenticator
+	MFAPurposeSetup = "setup" // MFA is required and the user has to enroll first
+)
+
+// MFAChallengeClaims prove that a user has passed the password check of a
+// login that still needs a second factor. They cannot be used as an access
+// token.
+type MFAChallengeClaims struct {
+	UserID  uuid.UUID `json:"user_id"`
+	Purpose string    `json:"mfa"`
+	jwt.RegisteredClaims
 }
 
-func (s *JWTService) GenerateToken(userID uuid.UUID, expiration time.Duration) (string, error) {
+func (s *JWTService) GenerateToken(userID, sessionID uuid.UUID, expiration time.Duration) (string, error) {
 	claims := Claims{
-		UserID: userID,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(expiration)),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-		},
+		UserID:           userID,
+		SessionID:        sessionID,
+		RegisteredClaims: s.registeredClaims(s.audience, expiration),
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(s.secretKey)
+	return s.sign(claims)
 }
 
 func (s *JWTService) ValidateToken(tokenString string) (*Claims, error) {
-	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, errors.New("unexpected signing method")
-		}
-		return s.secretKey, nil
-	})
+	token, err := s.parse(tokenString, &Claims{}, s.audience)
 
 	if err != nil {
 		return nil, err
 	}
 
-	if claims, ok := token.Claims.(*Claims); ok && token.Valid {
+	if claims, ok := token.Claims.(*Claims); ok && token.Valid && claims.UserID != uuid.Nil && claims.SessionID != uuid.Nil {
 		return claims, nil
 	}
 
 	return nil, errors.New("invalid token")
 }
+
+func (s *JWTService) GenerateShareAccessToken(shareID uuid.UUID, email string, expiration time.Duration) (string, error) {
+	claims := ShareAccessClaims{
+		ShareID:          shareID,
+		Email:            email,
+		RegisteredClaims: s.registeredClaims(shareAccessAudience, expiration),
+	}
+
+	return s.sign(claims)
+}
+
+// ValidateShareAccessToken checks that tokenString was issued for shareID
+func (s *JWTService) ValidateShareAccessToken(tokenString string, shareID uuid.UUID) (*ShareAccessClaims, error) {
+	token, err := s.parse(tokenString, &ShareAccessClaims{}, shareAccessAudience)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if claims, ok := token.Claims.(*ShareAccessClaims); ok && token.Valid && claims.ShareID == shareID {
+		return claims, nil
+	}
+
+	return nil, errors.New("invalid share access token")
+}
+
+func (s *JWTService) GenerateMFAChallengeToken(userID uuid.UUID, purpose string, expiration time.Duration) (string, error) {
+	claims := MFAChallengeClaims{
+		UserID:           userID,
+		Purpose:          purpose,
+		RegisteredClaims: s.registeredClaims(mfaChallengeAudience, expiration),
+	}
+
+	return s.sign(claims)
+}
+
+func (s *JWTService) ValidateMFAChallengeToken(tokenString string) (*MFAChallengeClaims, error) {
+	token, err := s.parse(tokenString, &MFAChallengeClaims{}, mfaChallengeAudience)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if claims, ok := token.Claims.(*MFAChallengeClaims); ok && token.Valid && claims.UserID != uuid.Nil &&
+		(claims.Purpose == MFAPurposeLogin || claims.Purpose == MFAPurposeSetup) {
+		return claims, nil
+	}
+
+	return nil, errors.New("invalid MFA challenge token")
+}
@@ -0,0 +1,179 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/go-jose/go-jose/v4"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// defaultJWTAudience is the audience of access tokens unless JWT_AUDIENCE
+// says otherwise
+const defaultJWTAudience = "sdx-api"
+
+// minRSAKeyBits is the smallest RSA key accepted for signing tokens
+const minRSAKeyBits = 2048
+
+// JWTConfig configures how tokens are signed and verified. With a signing
+// key, tokens are signed with it and carry its key ID; Secret is then not
+// used. Without one, tokens are signed with HS256 and Secret.
+type JWTConfig struct {
+	Secret string
+	// SigningKeyFile is a PEM private key (Ed25519, P-256 or RSA)
+	SigningKeyFile string
+	// VerificationKeyFiles are PEM public or private keys that are still
+	// accepted, such as the previous signing key during a rotation
+	VerificationKeyFiles []string
+	Issuer               string
+	Audience             string
+}
+
+// JWTConfigFromEnv reads JWT_SECRET, JWT_SIGNING_KEY_FILE,
+// JWT_VERIFICATION_KEY_FILES (comma-separated), JWT_ISSUER and
+// JWT_AUDIENCE. The issuer defaults to baseURL.
+func JWTConfigFromEnv(baseURL string) JWTConfig {
+	config := JWTConfig{
+		Secret:               os.Getenv("JWT_SECRET"),
+		SigningKeyFile:       os.Getenv("JWT_SIGNING_KEY_FILE"),
+		VerificationKeyFiles: splitList(os.Getenv("JWT_VERIFICATION_KEY_FILES")),
+		Issuer:               os.Getenv("JWT_ISSUER"),
+		Audience:             os.Getenv("JWT_AUDIENCE"),
+	}
+	if config.Issuer == "" {
+		config.Issuer = baseURL
+	}
+	if config.Audience == "" {
+		config.Audience = defaultJWTAudience
+	}
+	return config
+}
+
+// jwtKey is an asymmetric key tokens are signed or verified with
+type jwtKey struct {
+	id     string
+	method jwt.SigningMethod
+	// private is only set for the signing key
+	private crypto.PrivateKey
+	public  crypto.PublicKey
+}
+
+// loadJWTKey reads a PEM key file. Private keys are kept only if
+// withPrivate is set; verification keys may be given either way.
+func loadJWTKey(path string, withPrivate bool) (*jwtKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s: no PEM data found", path)
+	}
+
+	var private crypto.PrivateKey
+	var public crypto.PublicKey
+	switch block.Type {
+	case "PRIVATE KEY":
+		private, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		private, err = x509.ParseECPrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		private, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		public, err = x509.ParsePKIXPublicKey(block.Bytes)
+	case "RSA PUBLIC KEY":
+		public, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("%s: unsupported PEM block %q", path, block.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	if private != nil {
+		signer, ok := private.(crypto.Signer)
+		if !ok {
+			return nil, fmt.Errorf("%s: unsupported private key", path)
+		}
+		public = signer.Public()
+	} else if withPrivate {
+		return nil, fmt.Errorf("%s: the signing key must be a private key", path)
+	}
+
+	key := &jwtKey{public: public}
+	if withPrivate {
+		key.private = private
+	}
+
+	switch pub := public.(type) {
+	case ed25519.PublicKey:
+		key.method = jwt.SigningMethodEdDSA
+	case *ecdsa.PublicKey:
+		if pub.Curve != elliptic.P256() {
+			return nil, fmt.Errorf("%s: only P-256 EC keys are supported", path)
+		}
+		key.method = jwt.SigningMethodES256
+	case *rsa.PublicKey:
+		if pub.N.BitLen() < minRSAKeyBits {
+			return nil, fmt.Errorf("%s: RSA keys must have at least %d bits", path, minRSAKeyBits)
+		}
+		key.method = jwt.SigningMethodRS256
+	default:
+		return nil, fmt.Errorf("%s: unsupported key type %T", path, public)
+	}
+
+	// The key ID is the RFC 7638 thumbprint, so it stays the same however
+	// the key is stored and every service derives the same ID
+	thumbprint, err := (&jose.JSONWebKey{Key: public}).Thumbprint(crypto.SHA256)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	key.id = base64.RawURLEncoding.EncodeToString(thumbprint)
+	return key, nil
+}
+
+// keyFunc picks the key a token is verified with: the HS256 secret without
+// signing key, otherwise the key named by the token's kid header
+func (s *JWTService) keyFunc(token *jwt.Token) (interface{}, error) {
+	if s.signingKey == nil {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, errors.New("unexpected signing method")
+		}
+		return s.secretKey, nil
+	}
+
+	kid, _ := token.Header["kid"].(string)
+	key, ok := s.verificationKeys[kid]
+	if !ok {
+		return nil, errors.New("unknown signing key")
+	}
+	if token.Method.Alg() != key.method.Alg() {
+		return nil, errors.New("unexpected signing method")
+	}
+	return key.public, nil
+}
+
+// JWKS returns the public keys tokens are verified with, for services that
+// verify access tokens themselves. It is empty when tokens are signed with
+// the HS256 secret.
+func (s *JWTService) JWKS() jose.JSONWebKeySet {
+	set := jose.JSONWebKeySet{Keys: []jose.JSONWebKey{}}
+	for _, key := range s.keyOrder {
+		set.Keys = append(set.Keys, jose.JSONWebKey{
+			Key:       key.public,
+			KeyID:     key.id,
+			Algorithm: key.method.Alg(),
+			Use:       "sig",
+		})
+	}
+	return set
+}
@@ -0,0 +1,137 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+const (
+	testIssuer   = "https://portal.example.com"
+	testAudience = "sdx-api"
+)
+
+// writeJWTKey stores key as a PKCS #8 PEM file and returns its path
+func writeJWTKey(t *testing.T, key crypto.PrivateKey) string {
+	t.Helper()
+
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "key.pem")
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func newTestJWTService(t *testing.T, signingKey string, verificationKeys ...string) *JWTService {
+	t.Helper()
+
+	s, err := NewJWTService(JWTConfig{
+		SigningKeyFile:       signingKey,
+		VerificationKeyFiles: verificationKeys,
+		Issuer:               testIssuer,
+		Audience:             testAudience,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// After a rotation, tokens signed with the previous key verify as long as
+// it is still published; tokens naming any other key are refused
+func TestJWTKeyRotation(t *testing.T) {
+	_, oldKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, strayKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldPath, newPath, strayPath := writeJWTKey(t, oldKey), writeJWTKey(t, newKey), writeJWTKey(t, strayKey)
+
+	beforeRotation := newTestJWTService(t, oldPath)
+	rotating := newTestJWTService(t, newPath, oldPath)
+	afterRotation := newTestJWTService(t, newPath)
+	stray := newTestJWTService(t, strayPath)
+
+	if keys := rotating.JWKS().Keys; len(keys) != 2 || keys[0].KeyID != rotating.signingKey.id || keys[1].KeyID != beforeRotation.signingKey.id {
+		t.Errorf("JWKS during the rotation = %v, want the new and the old key", keys)
+	}
+
+	userID, sessionID := uuid.New(), uuid.New()
+	// sign signs an access token with the key of s under the given kid
+	// header, or none if kid is nil
+	sign :=func(s *JWTService, kid any) string {
+		t.Helper()
+
+		claims := Claims{UserID: userID, SessionID: sessionID, RegisteredClaims: s.registeredClaims(testAudience, time.Minute)}
+		token := jwt.NewWithClaims(s.signingKey.method, claims)
+		if kid != nil {
+			token.Header["kid"] = kid
+		}
+		signed, err := token.SignedString(s.signingKey.private)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return signed
+	}
+	hs256 := func(kid string) string {
+		t.Helper()
+
+		claims := Claims{UserID: userID, SessionID: sessionID, RegisteredClaims: rotating.registeredClaims(testAudience, time.Minute)}
+		token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+		token.Header["kid"] = kid
+		signed, err := token.SignedString([]byte("secret"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return signed
+	}
+
+	cases := []struct {
+		name     string
+		verifier *JWTService
+		token    string
+		wantOK   bool
+	}{
+		{"new key", rotating, sign(rotating, rotating.signingKey.id), true},
+		{"previous key still published", rotating, sign(beforeRotation, beforeRotation.signingKey.id), true},
+		{"previous key retired", afterRotation, sign(beforeRotation, beforeRotation.signingKey.id), false},
+		{"unknown key", rotating, sign(stray, stray.signingKey.id), false},
+		{"unknown key under a known kid", rotating, sign(stray, beforeRotation.signingKey.id), false},
+		{"no kid", rotating, sign(rotating, nil), false},
+		{"kid that is not a string", rotating, sign(rotating, 1), false},
+		{"HS256 under a known kid", rotating, hs256(rotating.signingKey.id), false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			claims, err := tc.verifier.ValidateToken(tc.token)
+			if (err == nil) != tc.wantOK {
+				t.Fatalf("ValidateToken error = %v, want ok = %v", err, tc.wantOK)
+			}
+			if err == nil && (claims.UserID != userID || claims.SessionID != sessionID) {
+				t.Errorf("claims = %s/%s, want %s/%s", claims.UserID, claims.SessionID, userID, sessionID)
+			}
+		})
+	}
+}
@@ -1,18 +1,26 @@
 package auth
 
 import (
+	"context"
 	"strings"
 
 	"Secure-Document-Exchange-Portal/internal/database"
+	"Secure-Document-Exchange-Portal/internal/models"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5/pgtype"
 )
 
-const UserIDKey = "user_id"
+const (
+	UserIDKey    = "user_id"
+	SessionIDKey = "session_id"
+)
 
-func AuthMiddleware(jwtService *JWTService) fiber.Handler {
+// AuthMiddleware lets requests through that carry a valid access token of
+// an active session or a valid API key, belonging to a user who has not
+// been deactivated
+func AuthMiddleware(jwtService *JWTService, sessions SessionStore, users UserStore, apiKeys APIKeyStore) fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		token := GetToken(c)
 		if token == "" {
@@ -21,6 +29,25 @@ func AuthMiddleware(jwtService *JWTService) fiber.Handler {
 			})
 		}
 
+		if IsAPIKey(token) {
+			key, message := authenticateAPIKey(c, apiKeys, token)
+			if key == nil {
+				return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+					"error": message,
+				})
+			}
+
+			if ok, err := activeUser(c, users, key.UserID); !ok {
+				return err
+			}
+
+			// Set user, key and scopes in context
+			c.Locals(UserIDKey, key.UserID)
+			c.Locals(APIKeyIDKey, key.ID)
+			c.Locals(APIKeyScopesKey, key.Scopes)
+			return c.Next()
+		}
+
 		claims, err := jwtService.ValidateToken(token)
 		if err != nil {
 			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
@@ -28,12 +55,47 @@ func AuthMiddleware(jwtService *JWTService) fiber.Handler {
 			})
 		}
 
-		// Set user ID in context
+		session, ok := activeSession(c.Context(), sessions, claims)
+		if !ok {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error": "Session has ended. Please log in again.",
+			})
+		}
+
+		if ok, err := activeUser(c, users, claims.UserID); !ok {
+			return err
+		}
+		touchSession(sessions, session, claims.SessionID)
+
+		// Set user and session ID in context
 		c.Locals(UserIDKey, claims.UserID)
+		c.Locals(SessionIDKey, claims.SessionID)
 		return c.Next()
 	}
 }
 
+// activeUser reports whether the user exists and has not been deactivated,
+// answering the request with 401 if not
+func activeUser(c *fiber.Ctx, users UserStore, userID uuid.UUID) (bool, error) {
+	user, err := users.GetUserByID(c.Context(), userID)
+	if err != nil {
+		return false, c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Session has ended. Please log in again.",
+		})
+	}
+	if !user.IsActive {
+		return false, c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "This account has been deactivated",
+		})
+	}
+	return true, nil
+}
+
+// UserStore looks up users for authorization checks
+type UserStore interface {
+	GetUserByID(ctx context.Context, userID uuid.UUID) (*models.UserCache, error)
+}
+
 func GetUserID(c *fiber.Ctx) (uuid.UUID, error) {
 	userID := c.Locals(UserIDKey)
 	if userID == nil {
@@ -48,6 +110,16 @@ func GetUserID(c *fiber.Ctx) (uuid.UUID, error) {
 	return id, nil
 }
 
+// GetSessionID returns the session of the authenticated request
+func GetSessionID(c *fiber.Ctx) (uuid.UUID, error) {
+	sessionID, ok := c.Locals(SessionIDKey).(uuid.UUID)
+	if !ok {
+		return uuid.Nil, fiber.NewError(fiber.StatusUnauthorized, "User not authenticated")
+	}
+
+	return sessionID, nil
+}
+
 func GetToken(c *fiber.Ctx) string {
 	authHeader := c.Get("Authorization")
 	if authHeader == "" {
@@ -66,18 +138,18 @@ func GetToken(c *fiber.Ctx) string {
 	return tokenParts[1]
 }
 
-func IsAuthenticated(c *fiber.Ctx, jwtService *JWTService) bool {
+func IsAuthenticated(c *fiber.Ctx, jwtService *JWTService, sessions SessionStore) bool {
 	token := GetToken(c)
 	if token == "" {
 		return false
 	}
 
-	_, err := jwtService.ValidateToken(token)
-	return err == nil
+	claims, err := jwtService.ValidateToken(token)
+	return err == nil && SessionActive(c.Context(), sessions, claims)
 }
 
-func GetUserName(c *fiber.Ctx, jwtService *JWTService, db *database.Queries) string {
-	if !IsAuthenticated(c, jwtService) {
+func GetUserName(c *fiber.Ctx, jwtService *JWTService, sessions SessionStore, db *database.Queries) string {
+	if !IsAuthenticated(c, jwtService, sessions) {
 		return ""
 	}
 
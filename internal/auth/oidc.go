@@ -0,0 +1,294 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+)
+
+// oidcDiscoveryTimeout bounds fetching a provider's discovery document
+const oidcDiscoveryTimeout = 10 * time.Second
+
+var ErrOIDCProviderNotFound = errors.New("unknown SSO provider")
+
+// OIDCProviderConfig configures one OpenID Connect identity provider
+type OIDCProviderConfig struct {
+	// Name identifies the provider in URLs and in stored identities
+	Name         string
+	DisplayName  string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	Scopes       []string
+	// EnforcedDomains lists email domains whose users must sign in with
+	// this provider; password login is disabled for them
+	EnforcedDomains []string
+}
+
+// OIDCProviderConfigsFromEnv reads providers from OIDC_PROVIDERS, a
+// comma-separated list of names, and OIDC_<NAME>_* variables for each
+func OIDCProviderConfigsFromEnv() ([]OIDCProviderConfig, error) {
+	var configs []OIDCProviderConfig
+	for _, name := range splitList(os.Getenv("OIDC_PROVIDERS")) {
+		name = strings.ToLower(name)
+		prefix := "OIDC_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_")) + "_"
+
+		config := OIDCProviderConfig{
+			Name:            name,
+			DisplayName:     os.Getenv(prefix + "DISPLAY_NAME"),
+			Issuer:          os.Getenv(prefix + "ISSUER"),
+			ClientID:        os.Getenv(prefix + "CLIENT_ID"),
+			ClientSecret:    os.Getenv(prefix + "CLIENT_SECRET"),
+			Scopes:          splitList(os.Getenv(prefix + "SCOPES")),
+			EnforcedDomains: splitList(strings.ToLower(os.Getenv(prefix + "ENFORCED_DOMAINS"))),
+		}
+		if config.Issuer == "" || config.ClientID == "" {
+			return nil, fmt.Errorf("SSO provider %q needs %sISSUER and %sCLIENT_ID", name, prefix, prefix)
+		}
+		if config.DisplayName == "" {
+			config.DisplayName = name
+		}
+		configs = append(configs, config)
+	}
+	return configs, nil
+}
+
+// OIDCProviderInfo is what the login page shows for a provider
+type OIDCProviderInfo struct {
+	Name        string
+	DisplayName string
+}
+
+// OIDCIdentity is the user an identity provider vouched for
+type OIDCIdentity struct {
+	Provider      string
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+}
+
+// OIDCService runs the authorization code flow with PKCE against the
+// configured identity providers
+type OIDCService struct {
+	providers   map[string]*oidcProvider
+	order       []string
+	redirectURL string
+}
+
+type oidcProvider struct {
+	config OIDCProviderConfig
+
+	// The discovery document is fetched on first use, so the portal starts
+	// while an identity provider is unreachable
+	mu       sync.Mutex
+	oauth2   *oauth2.Config
+	verifier *oidc.IDTokenVerifier
+	provider *oidc.Provider
+}
+
+// NewOIDCService creates the service. baseURL is the portal's public URL;
+// each provider's redirect URI is <baseURL>/auth/oidc/<name>/callback.
+func NewOIDCService(configs []OIDCProviderConfig, baseURL string) (*OIDCService, error) {
+	if _, err := url.Parse(baseURL); err != nil {
+		return nil, fmt.Errorf("invalid base URL: %w", err)
+	}
+
+	s := &OIDCService{
+		providers:   make(map[string]*oidcProvider),
+		redirectURL: strings.TrimRight(baseURL, "/") + "/auth/oidc/%s/callback",
+	}
+	for _, config := range configs {
+		if _, exists := s.providers[config.Name]; exists {
+			return nil, fmt.Errorf("SSO provider %q is configured twice", config.Name)
+		}
+		s.providers[config.Name] = &oidcProvider{config: config}
+		s.order = append(s.order, config.Name)
+	}
+	return s, nil
+}
+
+// Providers returns the configured providers in configuration order
+func (s *OIDCService) Providers() []OIDCProviderInfo {
+	providers := make([]OIDCProviderInfo, 0, len(s.order))
+	for _, name := range s.order {
+		config := s.providers[name].config
+		providers = append(providers, OIDCProviderInfo{Name: config.Name, DisplayName: config.DisplayName})
+	}
+	return providers
+}
+
+// Provider returns the display information of a configured provider
+func (s *OIDCService) Provider(name string) (OIDCProviderInfo, bool) {
+	p, ok := s.providers[name]
+	if !ok {
+		return OIDCProviderInfo{}, false
+	}
+	return OIDCProviderInfo{Name: p.config.Name, DisplayName: p.config.DisplayName}, true
+}
+
+// EnforcedProvider returns the provider users with this email address must
+// sign in with, if their domain is SSO-enforced
+func (s *OIDCService) EnforcedProvider(email string) (OIDCProviderInfo, bool) {
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return OIDCProviderInfo{}, false
+	}
+	domain := strings.ToLower(email[at+1:])
+
+	for _, name := range s.order {
+		config := s.providers[name].config
+		for _, enforced := range config.EnforcedDomains {
+			if domain == enforced {
+				return OIDCProviderInfo{Name: config.Name, DisplayName: config.DisplayName}, true
+			}
+		}
+	}
+	return OIDCProviderInfo{}, false
+}
+
+// AuthCodeURL returns the provider's authorization URL. The verifier's S256
+// challenge and the nonce are sent along; both are checked again when the
+// code is exchanged.
+func (s *OIDCService) AuthCodeURL(ctx context.Context, name, state, nonce, verifier string) (string, error) {
+	p, err := s.provider(ctx, name)
+	if err != nil {
+		return "", err
+	}
+	return p.oauth2.AuthCodeURL(state, oauth2.S256ChallengeOption(verifier), oidc.Nonce(nonce)), nil
+}
+
+// Exchange redeems an authorization code and returns the verified identity
+// from the ID token. Claims missing from the ID token are read from the
+// userinfo endpoint.
+func (s *OIDCService) Exchange(ctx context.Context, name, code, nonce, verifier string) (*OIDCIdentity, error) {
+	p, err := s.provider(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := p.oauth2.Exchange(ctx, code, oauth2.VerifierOption(verifier))
+	if err != nil {
+		return nil, fmt.Errorf("failed to exchange code: %w", err)
+	}
+
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return nil, errors.New("token response has no ID token")
+	}
+	idToken, err := p.verifier.Verify(ctx, rawIDToken)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ID token: %w", err)
+	}
+	if idToken.Nonce != nonce {
+		return nil, errors.New("ID token nonce does not match")
+	}
+
+	var claims oidcClaims
+	if err := idToken.Claims(&claims); err != nil {
+		return nil, fmt.Errorf("invalid ID token claims: %w", err)
+	}
+
+	if claims.Email == "" {
+		userInfo, err := p.provider.UserInfo(ctx, oauth2.StaticTokenSource(token))
+		if err != nil {
+			return nil, fmt.Errorf("failed to load user info: %w", err)
+		}
+		var extra oidcClaims
+		if err := userInfo.Claims(&extra); err != nil {
+			return nil, fmt.Errorf("invalid user info claims: %w", err)
+		}
+		// The userinfo subject must be the ID token's (OIDC Core 5.3.2)
+		if userInfo.Subject != idToken.Subject {
+			return nil, errors.New("user info subject does not match ID token")
+		}
+		claims.Email = extra.Email
+		claims.EmailVerified = extra.EmailVerified
+		if claims.Name == "" {
+			claims.Name = extra.Name
+		}
+	}
+
+	return &OIDCIdentity{
+		Provider:      name,
+		Subject:       idToken.Subject,
+		Email:         strings.ToLower(claims.Email),
+		EmailVerified: bool(claims.EmailVerified),
+		Name:          claims.Name,
+	}, nil
+}
+
+type oidcClaims struct {
+	Email         string    `json:"email"`
+	EmailVerified claimBool `json:"email_verified"`
+	Name          string    `json:"name"`
+}
+
+// claimBool accepts booleans sent as strings, which some providers do for
+// email_verified
+type claimBool bool
+
+func (b *claimBool) UnmarshalJSON(data []byte) error {
+	value := strings.Trim(string(data), `"`)
+	*b = claimBool(value == "true")
+	return nil
+}
+
+// provider returns a provider with its discovery document loaded
+func (s *OIDCService) provider(ctx context.Context, name string) (*oidcProvider, error) {
+	p, ok := s.providers[name]
+	if !ok {
+		return nil, ErrOIDCProviderNotFound
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.oauth2 != nil {
+		return p, nil
+	}
+
+	discoveryCtx, cancel := context.WithTimeout(ctx, oidcDiscoveryTimeout)
+	defer cancel()
+	provider, err := oidc.NewProvider(discoveryCtx, p.config.Issuer)
+	if err != nil {
+		return nil, fmt.Errorf("failed to discover SSO provider %q: %w", name, err)
+	}
+
+	scopes := p.config.Scopes
+	if len(scopes) == 0 {
+		scopes = []string{"profile", "email"}
+	}
+	if !slices.Contains(scopes, oidc.ScopeOpenID) {
+		scopes = append([]string{oidc.ScopeOpenID}, scopes...)
+	}
+
+	p.provider = provider
+	p.verifier = provider.Verifier(&oidc.Config{ClientID: p.config.ClientID})
+	p.oauth2 = &oauth2.Config{
+		ClientID:     p.config.ClientID,
+		ClientSecret: p.config.ClientSecret,
+		Endpoint:     provider.Endpoint(),
+		RedirectURL:  fmt.Sprintf(s.redirectURL, url.PathEscape(name)),
+		Scopes:       scopes,
+	}
+	return p, nil
+}
+
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
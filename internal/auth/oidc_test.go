@@ -0,0 +1,304 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-jose/go-jose/v4"
+	"golang.org/x/oauth2"
+)
+
+const testClientID = "portal"
+
+// mockIssuer is an OpenID Connect provider with discovery, JWKS, token and
+// userinfo endpoints. Codes are handed out by authorize.
+type mockIssuer struct {
+	t      *testing.T
+	server *httptest.Server
+	key    *rsa.PrivateKey
+
+	mu       sync.Mutex
+	grants   map[string]mockGrant
+	userInfo map[string]map[string]any
+}
+
+// mockGrant is what the issuer remembers about an authorization code
+type mockGrant struct {
+	challenge string
+	idToken   map[string]any
+}
+
+func newMockIssuer(t *testing.T) *mockIssuer {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &mockIssuer{
+		t:        t,
+		key:      key,
+		grants:   make(map[string]mockGrant),
+		userInfo: make(map[string]map[string]any),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", m.discovery)
+	mux.HandleFunc("/jwks", m.jwks)
+	mux.HandleFunc("/token", m.token)
+	mux.HandleFunc("/userinfo", m.userinfo)
+	m.server = httptest.NewServer(mux)
+	t.Cleanup(m.server.Close)
+	return m
+}
+
+func (m *mockIssuer) discovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, map[string]any{
+		"issuer":                                m.server.URL,
+		"authorization_endpoint":                m.server.URL + "/authorize",
+		"token_endpoint":                        m.server.URL + "/token",
+		"jwks_uri":                              m.server.URL + "/jwks",
+		"userinfo_endpoint":                     m.server.URL + "/userinfo",
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+	})
+}
+
+func (m *mockIssuer) jwks(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, jose.JSONWebKeySet{Keys: []jose.JSONWebKey{
+		{Key: &m.key.PublicKey, KeyID: "test", Algorithm: string(jose.RS256), Use: "sig"},
+	}})
+}
+
+// token redeems a code once, checking the PKCE verifier against the S256
+// challenge of the authorization request
+func (m *mockIssuer) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	m.mu.Lock()
+	grant, ok := m.grants[r.PostForm.Get("code")]
+	delete(m.grants, r.PostForm.Get("code"))
+	m.mu.Unlock()
+
+	digest := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if !ok || base64.RawURLEncoding.EncodeToString(digest[:]) != grant.challenge {
+		w.WriteHeader(http.StatusBadRequest)
+		writeJSON(w, map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	idToken, err := m.sign(grant.idToken)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, map[string]any{
+		"access_token": "access-" + r.PostForm.Get("code"),
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+		"id_token":     idToken,
+	})
+}
+
+func (m *mockIssuer) userinfo(w http.ResponseWriter, r *http.Request) {
+	code, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer access-")
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	m.mu.Lock()
+	info := m.userInfo[code]
+	m.mu.Unlock()
+	writeJSON(w, info)
+}
+
+func (m *mockIssuer) sign(claims map[string]any) (string, error) {
+	signer, err := jose.NewSigner(
+		jose.SigningKey{Algorithm: jose.RS256, Key: jose.JSONWebKey{Key: m.key, KeyID: "test"}},
+		(&jose.SignerOptions{}).WithType("JWT"),
+	)
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	signed, err := signer.Sign(payload)
+	if err != nil {
+		return "", err
+	}
+	return signed.CompactSerialize()
+}
+
+// authorize plays the user signing in at the provider: it takes the
+// authorization URL the portal redirected to and returns a code for an ID
+// token with claims, bound to the URL's nonce and PKCE challenge
+func (m *mockIssuer) authorize(authURL string, claims, userInfo map[string]any) string {
+	m.t.Helper()
+
+	parsed, err := url.Parse(authURL)
+	if err != nil {
+		m.t.Fatal(err)
+	}
+	query := parsed.Query()
+	if query.Get("client_id") != testClientID || query.Get("code_challenge_method") != "S256" {
+		m.t.Fatalf("unexpected authorization request %s", authURL)
+	}
+
+	idToken := map[string]any{
+		"iss":   m.server.URL,
+		"aud":   testClientID,
+		"iat":   time.Now().Unix(),
+		"exp":   time.Now().Add(time.Hour).Unix(),
+		"nonce": query.Get("nonce"),
+	}
+	for name, value := range claims {
+		idToken[name] = value
+	}
+
+	code := oauth2.GenerateVerifier()
+	m.mu.Lock()
+	m.grants[code] = mockGrant{challenge: query.Get("code_challenge"), idToken: idToken}
+	m.userInfo[code] = userInfo
+	m.mu.Unlock()
+	return code
+}
+
+func writeJSON(w http.ResponseWriter, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(value)
+}
+
+func TestOIDCExchange(t *testing.T) {
+	issuer := newMockIssuer(t)
+	service, err := NewOIDCService([]OIDCProviderConfig{{
+		Name:     "mock",
+		Issuer:   issuer.server.URL,
+		ClientID: testClientID,
+	}}, "https://portal.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	// login runs the flow up to the code exchange. The nonce and verifier
+	// passed to Exchange can differ from the ones the flow started with.
+	login := func(t *testing.T, claims, userInfo map[string]any, nonce, verifier string) (*OIDCIdentity, error) {
+		t.Helper()
+
+		startNonce, startVerifier := "nonce-"+oauth2.GenerateVerifier(), oauth2.GenerateVerifier()
+		authURL, err := service.AuthCodeURL(ctx, "mock", "state", startNonce, startVerifier)
+		if err != nil {
+			t.Fatal(err)
+		}
+		code := issuer.authorize(authURL, claims, userInfo)
+
+		if nonce == "" {
+			nonce = startNonce
+		}
+		if verifier == "" {
+			verifier = startVerifier
+		}
+		return service.Exchange(ctx, "mock", code, nonce, verifier)
+	}
+
+	t.Run("verified email", func(t *testing.T) {
+		identity, err := login(t, map[string]any{
+			"sub":            "user-1",
+			"email":          "Jane@Example.com",
+			"email_verified": true,
+			"name":           "Jane Doe",
+		}, nil, "", "")
+		if err != nil {
+			t.Fatalf("Exchange: %v", err)
+		}
+		want := OIDCIdentity{Provider: "mock", Subject: "user-1", Email: "jane@example.com", EmailVerified: true, Name: "Jane Doe"}
+		if *identity != want {
+			t.Errorf("identity = %+v, want %+v", *identity, want)
+		}
+	})
+
+	t.Run("email_verified false", func(t *testing.T) {
+		identity, err := login(t, map[string]any{
+			"sub":            "user-2",
+			"email":          "jane@example.com",
+			"email_verified": false,
+		}, nil, "", "")
+		if err != nil {
+			t.Fatalf("Exchange: %v", err)
+		}
+		if identity.EmailVerified {
+			t.Error("EmailVerified = true, want false")
+		}
+	})
+
+	t.Run("email_verified as string", func(t *testing.T) {
+		identity, err := login(t, map[string]any{
+			"sub":            "user-3",
+			"email":          "jane@example.com",
+			"email_verified": "true",
+		}, nil, "", "")
+		if err != nil {
+			t.Fatalf("Exchange: %v", err)
+		}
+		if !identity.EmailVerified {
+			t.Error("EmailVerified = false, want true")
+		}
+	})
+
+	t.Run("nonce mismatch", func(t *testing.T) {
+		_, err := login(t, map[string]any{"sub": "user-1", "email": "jane@example.com"}, nil, "another-nonce", "")
+		if err == nil {
+			t.Error("Exchange accepted an ID token for another nonce")
+		}
+	})
+
+	t.Run("wrong PKCE verifier", func(t *testing.T) {
+		_, err := login(t, map[string]any{"sub": "user-1", "email": "jane@example.com"}, nil, "", oauth2.GenerateVerifier())
+		if err == nil {
+			t.Error("Exchange succeeded with the wrong code verifier")
+		}
+	})
+
+	t.Run("email from userinfo", func(t *testing.T) {
+		identity, err := login(t, map[string]any{"sub": "user-4"}, map[string]any{
+			"sub":            "user-4",
+			"email":          "john@example.com",
+			"email_verified": true,
+			"name":           "John Doe",
+		}, "", "")
+		if err != nil {
+			t.Fatalf("Exchange: %v", err)
+		}
+		want := OIDCIdentity{Provider: "mock", Subject: "user-4", Email: "john@example.com", EmailVerified: true, Name: "John Doe"}
+		if *identity != want {
+			t.Errorf("identity = %+v, want %+v", *identity, want)
+		}
+	})
+
+	t.Run("userinfo subject mismatch", func(t *testing.T) {
+		_, err := login(t, map[string]any{"sub": "user-4"}, map[string]any{
+			"sub":            "someone-else",
+			"email":          "victim@example.com",
+			"email_verified": true,
+		}, "", "")
+		if err == nil {
+			t.Error("Exchange accepted user info for another subject")
+		}
+	})
+}
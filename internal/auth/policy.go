@@ -0,0 +1,294 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// Role is what a user is to a resource. Users get roles from owning a
+// resource, from their workspace or organization membership, and admin and
+// legal from account flags.
+type Role string
+
+const (
+	RoleOwner   Role = "owner"
+	RoleEditor  Role = "editor"
+	RoleViewer  Role = "viewer"
+	RoleAuditor Role = "auditor"
+	RoleAdmin   Role = "admin"
+	// RoleLegal is litigation support, who freeze evidence with legal holds
+	RoleLegal Role = "legal"
+)
+
+// WorkspaceRoles are the roles a workspace member can be given, from most
+// to least privileged
+var WorkspaceRoles = []Role{RoleOwner, RoleEditor, RoleViewer, RoleAuditor}
+
+// Action is something a user does to a resource
+type Action string
+
+const (
+	// ActionDocumentList covers listing documents and folders and seeing
+	// their metadata
+	ActionDocumentList Action = "document.list"
+	// ActionDocumentRead covers downloading and previewing content
+	ActionDocumentRead Action = "document.read"
+	// ActionDocumentUpload covers adding documents and folders, directly or
+	// through file requests
+	ActionDocumentUpload Action = "document.upload"
+	// ActionDocumentUpdate covers moving documents between folders
+	ActionDocumentUpdate Action = "document.update"
+	// ActionDocumentDelete covers deleting documents and folders
+	ActionDocumentDelete Action = "document.delete"
+
+	ActionShareCreate Action = "share.create"
+	// ActionShareRead covers a share's access log
+	ActionShareRead   Action = "share.read"
+	ActionShareRevoke Action = "share.revoke"
+
+	// ActionFileRequestManage covers a file request's uploads and closing it
+	ActionFileRequestManage Action = "file_request.manage"
+
+	// ActionWorkspaceRead covers seeing who has access to a workspace
+	ActionWorkspaceRead Action = "workspace.read"
+	// ActionWorkspaceManage covers changing access and deleting a workspace
+	ActionWorkspaceManage Action = "workspace.manage"
+
+	ActionOrganizationRead Action = "organization.read"
+	// ActionOrganizationManage covers members, teams and workspaces
+	ActionOrganizationManage Action = "organization.manage"
+	// ActionOrganizationTransfer covers adding and removing owners
+	ActionOrganizationTransfer Action = "organization.transfer"
+
+	// ActionUserManage covers the administration of user accounts and the
+	// rest of the admin console
+	ActionUserManage Action = "user.manage"
+
+	// ActionLegalHoldManage covers placing and releasing legal holds on
+	// documents, folders and users anywhere in the application
+	ActionLegalHoldManage Action = "legal_hold.manage"
+)
+
+var (
+	viewerActions = []Action{
+		ActionDocumentList,
+		ActionDocumentRead,
+		ActionWorkspaceRead,
+		ActionOrganizationRead,
+	}
+	editorActions = append([]Action{
+		ActionDocumentUpload,
+		ActionDocumentUpdate,
+		ActionDocumentDelete,
+		ActionShareCreate,
+		ActionOrganizationManage,
+	}, viewerActions...)
+	ownerActions = append([]Action{
+		ActionShareRead,
+		ActionShareRevoke,
+		ActionFileRequestManage,
+		ActionWorkspaceManage,
+		ActionOrganizationTransfer,
+	}, editorActions...)
+)
+
+// rolePermissions is the policy: the actions each role allows. Auditors see
+// what a workspace holds and who can access it, but not the content.
+var rolePermissions = map[Role][]Action{
+	RoleOwner:  ownerActions,
+	RoleEditor: editorActions,
+	RoleViewer: viewerActions,
+	RoleAuditor: {
+		ActionDocumentList,
+		ActionWorkspaceRead,
+		ActionOrganizationRead,
+	},
+	// Administrators see no content, but can take down any share link
+	RoleAdmin: {
+		ActionUserManage,
+		ActionShareRevoke,
+	},
+	// Litigation support holds anything without seeing its content; they
+	// are kept apart from administrators, who can only give the role
+	RoleLegal: {
+		ActionLegalHoldManage,
+	},
+}
+
+// Organization roles map onto the policy roles: admins manage the
+// organization like editors, only owners change who owns it.
+var organizationRoles = map[string]Role{
+	"owner":  RoleOwner,
+	"admin":  RoleEditor,
+	"member": RoleViewer,
+}
+
+// Document grants give the grantee a role on that one document: read lets
+// them download it, edit also lets them move, delete and share it.
+const (
+	GrantRead = "read"
+	GrantEdit = "edit"
+)
+
+var grantRoles = map[string]Role{
+	GrantRead: RoleViewer,
+	GrantEdit: RoleEditor,
+}
+
+// ValidGrant reports whether permission can be granted on a document
+func ValidGrant(permission string) bool {
+	_, ok := grantRoles[permission]
+	return ok
+}
+
+// ErrForbidden is returned by Authorize when no role of the subject allows
+// the action
+var ErrForbidden = errors.New("access denied")
+
+// Allows reports whether a role allows an action
+func (r Role) Allows(action Action) bool {
+	for _, allowed := range rolePermissions[r] {
+		if allowed == action {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidWorkspaceRole reports whether role can be given to workspace members
+func ValidWorkspaceRole(role string) bool {
+	for _, r := range WorkspaceRoles {
+		if string(r) == role {
+			return true
+		}
+	}
+	return false
+}
+
+// Subject is the user an action is authorized for
+type Subject struct {
+	UserID uuid.UUID
+}
+
+// Resource is what an action is done to. Zero fields do not apply; a zero
+// Resource stands for the application itself, such as for user
+// administration.
+type Resource struct {
+	// OwnerID is the user who created the resource, such as a share or a
+	// file request. They are its owner.
+	OwnerID uuid.UUID
+	// WorkspaceID gives members the role they have in the workspace
+	WorkspaceID uuid.UUID
+	// OrganizationID gives members the role they have in the organization
+	OrganizationID uuid.UUID
+	// DocumentID gives users the document was shared with, directly or
+	// through a team, the role of their grant
+	DocumentID uuid.UUID
+}
+
+// RoleStore looks up the roles the policy is evaluated with
+type RoleStore interface {
+	UserStore
+	// GetWorkspaceRole returns an empty string for users without access
+	GetWorkspaceRole(ctx context.Context, workspaceID, userID uuid.UUID) (string, error)
+	// GetOrganizationRole returns an empty string for non-members
+	GetOrganizationRole(ctx context.Context, organizationID, userID uuid.UUID) (string, error)
+	// GetDocumentGrant returns the highest permission granted to the user on
+	// the document, or an empty string if it was not shared with them
+	GetDocumentGrant(ctx context.Context, documentID, userID uuid.UUID) (string, error)
+}
+
+// Policy decides what users may do. All authorization goes through
+// Authorize, so roles and their permissions are defined in one place.
+type Policy struct {
+	roles RoleStore
+}
+
+func NewPolicy(roles RoleStore) *Policy {
+	return &Policy{roles: roles}
+}
+
+// Authorize returns nil if any role the subject has for the resource allows
+// the action, ErrForbidden if none does, or the error of a failed role
+// lookup.
+func (p *Policy) Authorize(ctx context.Context, subject Subject, action Action, resource Resource) error {
+	if subject.UserID == uuid.Nil {
+		return ErrForbidden
+	}
+
+	if resource.OwnerID != uuid.Nil && resource.OwnerID == subject.UserID && RoleOwner.Allows(action) {
+		return nil
+	}
+
+	if resource.WorkspaceID != uuid.Nil {
+		role, err := p.roles.GetWorkspaceRole(ctx, resource.WorkspaceID, subject.UserID)
+		if err != nil {
+			return fmt.Errorf("workspace role: %w", err)
+		}
+		if role != "" && Role(role).Allows(action) {
+			return nil
+		}
+	}
+
+	if resource.DocumentID != uuid.Nil {
+		permission, err := p.roles.GetDocumentGrant(ctx, resource.DocumentID, subject.UserID)
+		if err != nil {
+			return fmt.Errorf("document grant: %w", err)
+		}
+		if role, ok := grantRoles[permission]; ok && role.Allows(action) {
+			return nil
+		}
+	}
+
+	if resource.OrganizationID != uuid.Nil {
+		role, err := p.roles.GetOrganizationRole(ctx, resource.OrganizationID, subject.UserID)
+		if err != nil {
+			return fmt.Errorf("organization role: %w", err)
+		}
+		if mapped, ok := organizationRoles[role]; ok && mapped.Allows(action) {
+			return nil
+		}
+	}
+
+	// The account is only loaded for actions its flags may allow
+	if RoleAdmin.Allows(action) || RoleLegal.Allows(action) {
+		user, err := p.roles.GetUserByID(ctx, subject.UserID)
+		if err != nil {
+			return fmt.Errorf("user: %w", err)
+		}
+		if user.IsActive && (user.IsAdmin && RoleAdmin.Allows(action) || user.IsLegal && RoleLegal.Allows(action)) {
+			return nil
+		}
+	}
+
+	return ErrForbidden
+}
+
+// RequirePermission only lets users through whose roles allow action on the
+// application as a whole, such as administrators for ActionUserManage. It
+// must run after AuthMiddleware.
+func RequirePermission(policy *Policy, action Action) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userID, err := GetUserID(c)
+		if err != nil {
+			return err
+		}
+
+		err = policy.Authorize(c.Context(), Subject{UserID: userID}, action, Resource{})
+		if errors.Is(err, ErrForbidden) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error":               "Permission denied",
+				"required_permission": action,
+			})
+		}
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to check permissions"})
+		}
+
+		return c.Next()
+	}
+}
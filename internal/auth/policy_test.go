@@ -0,0 +1,254 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"Secure-Document-Exchange-Portal/internal/models"
+
+	"github.com/google/uuid"
+)
+
+var allRoles = []Role{RoleOwner, RoleEditor, RoleViewer, RoleAuditor, RoleAdmin, RoleLegal}
+
+func TestRoleAllows(t *testing.T) {
+	tests := []struct {
+		action  Action
+		allowed []Role
+	}{
+		{ActionDocumentList, []Role{RoleOwner, RoleEditor, RoleViewer, RoleAuditor}},
+		{ActionDocumentRead, []Role{RoleOwner, RoleEditor, RoleViewer}},
+		{ActionDocumentUpload, []Role{RoleOwner, RoleEditor}},
+		{ActionDocumentUpdate, []Role{RoleOwner, RoleEditor}},
+		{ActionDocumentDelete, []Role{RoleOwner, RoleEditor}},
+		{ActionShareCreate, []Role{RoleOwner, RoleEditor}},
+		{ActionShareRead, []Role{RoleOwner}},
+		{ActionShareRevoke, []Role{RoleOwner, RoleAdmin}},
+		{ActionFileRequestManage, []Role{RoleOwner}},
+		{ActionWorkspaceRead, []Role{RoleOwner, RoleEditor, RoleViewer, RoleAuditor}},
+		{ActionWorkspaceManage, []Role{RoleOwner}},
+		{ActionOrganizationRead, []Role{RoleOwner, RoleEditor, RoleViewer, RoleAuditor}},
+		{ActionOrganizationManage, []Role{RoleOwner, RoleEditor}},
+		{ActionOrganizationTransfer, []Role{RoleOwner}},
+		{ActionUserManage, []Role{RoleAdmin}},
+		{ActionLegalHoldManage, []Role{RoleLegal}},
+	}
+
+	for _, tt := range tests {
+		for _, role := range allRoles {
+			want := false
+			for _, allowed := range tt.allowed {
+				if allowed == role {
+					want = true
+				}
+			}
+			if got := role.Allows(tt.action); got != want {
+				t.Errorf("%s.Allows(%s) = %v, want %v", role, tt.action, got, want)
+			}
+		}
+	}
+
+	if Role("member").Allows(ActionDocumentList) {
+		t.Error("unknown roles must not allow anything")
+	}
+}
+
+func TestValidWorkspaceRole(t *testing.T) {
+	tests := []struct {
+		role string
+		want bool
+	}{
+		{"owner", true},
+		{"editor", true},
+		{"viewer", true},
+		{"auditor", true},
+		{"admin", false},
+		{"member", false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		if got := ValidWorkspaceRole(tt.role); got != tt.want {
+			t.Errorf("ValidWorkspaceRole(%q) = %v, want %v", tt.role, got, tt.want)
+		}
+	}
+}
+
+// fakeRoles is a RoleStore backed by maps
+type fakeRoles struct {
+	users          map[uuid.UUID]*models.UserCache
+	workspaceRoles map[[2]uuid.UUID]string
+	orgRoles       map[[2]uuid.UUID]string
+	grants         map[[2]uuid.UUID]string
+	err            error
+}
+
+func (f *fakeRoles) GetUserByID(ctx context.Context, userID uuid.UUID) (*models.UserCache, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	user, ok := f.users[userID]
+	if !ok {
+		return nil, errors.New("user not found")
+	}
+	return user, nil
+}
+
+func (f *fakeRoles) GetWorkspaceRole(ctx context.Context, workspaceID, userID uuid.UUID) (string, error) {
+	if f.err != nil {
+		return "", f.err
+	}
+	return f.workspaceRoles[[2]uuid.UUID{workspaceID, userID}], nil
+}
+
+func (f *fakeRoles) GetOrganizationRole(ctx context.Context, organizationID, userID uuid.UUID) (string, error) {
+	if f.err != nil {
+		return "", f.err
+	}
+	return f.orgRoles[[2]uuid.UUID{organizationID, userID}], nil
+}
+
+func (f *fakeRoles) GetDocumentGrant(ctx context.Context, documentID, userID uuid.UUID) (string, error) {
+	if f.err != nil {
+		return "", f.err
+	}
+	return f.grants[[2]uuid.UUID{documentID, userID}], nil
+}
+
+func TestValidGrant(t *testing.T) {
+	for permission, want := range map[string]bool{"read": true, "edit": true, "owner": false, "": false} {
+		if got := ValidGrant(permission); got != want {
+			t.Errorf("ValidGrant(%q) = %v, want %v", permission, got, want)
+		}
+	}
+}
+
+func TestAuthorize(t *testing.T) {
+	var (
+		owner     = uuid.New()
+		editor    = uuid.New()
+		viewer    = uuid.New()
+		auditor   = uuid.New()
+		admin     = uuid.New()
+		exAdmin   = uuid.New()
+		legal     = uuid.New()
+		orgAdmin  = uuid.New()
+		orgMember = uuid.New()
+		stranger  = uuid.New()
+		reader    = uuid.New()
+		collab    = uuid.New()
+
+		workspace = uuid.New()
+		org       = uuid.New()
+		document  = uuid.New()
+	)
+
+	store := &fakeRoles{
+		users: map[uuid.UUID]*models.UserCache{
+			admin:    {IsAdmin: true, IsActive: true},
+			exAdmin:  {IsAdmin: true, IsActive: false},
+			legal:    {IsLegal: true, IsActive: true},
+			owner:    {IsActive: true},
+			editor:   {IsActive: true},
+			stranger: {IsActive: true},
+		},
+		workspaceRoles: map[[2]uuid.UUID]string{
+			{workspace, owner}:   "owner",
+			{workspace, editor}:  "editor",
+			{workspace, viewer}:  "viewer",
+			{workspace, auditor}: "auditor",
+		},
+		orgRoles: map[[2]uuid.UUID]string{
+			{org, owner}:     "owner",
+			{org, orgAdmin}:  "admin",
+			{org, orgMember}: "member",
+		},
+		grants: map[[2]uuid.UUID]string{
+			{document, reader}: "read",
+			{document, collab}: "edit",
+		},
+	}
+	policy := NewPolicy(store)
+
+	inWorkspace := Resource{WorkspaceID: workspace}
+	inOrg := Resource{OrganizationID: org}
+	sharedDocument := Resource{WorkspaceID: workspace, DocumentID: document}
+
+	tests := []struct {
+		name     string
+		user     uuid.UUID
+		action   Action
+		resource Resource
+		want     error
+	}{
+		{"owner deletes document", owner, ActionDocumentDelete, inWorkspace, nil},
+		{"owner manages workspace", owner, ActionWorkspaceManage, inWorkspace, nil},
+		{"editor uploads", editor, ActionDocumentUpload, inWorkspace, nil},
+		{"editor shares", editor, ActionShareCreate, inWorkspace, nil},
+		{"editor cannot manage workspace", editor, ActionWorkspaceManage, inWorkspace, ErrForbidden},
+		{"viewer downloads", viewer, ActionDocumentRead, inWorkspace, nil},
+		{"viewer cannot delete", viewer, ActionDocumentDelete, inWorkspace, ErrForbidden},
+		{"viewer cannot share", viewer, ActionShareCreate, inWorkspace, ErrForbidden},
+		{"auditor lists documents", auditor, ActionDocumentList, inWorkspace, nil},
+		{"auditor cannot download", auditor, ActionDocumentRead, inWorkspace, ErrForbidden},
+		{"stranger cannot list", stranger, ActionDocumentList, inWorkspace, ErrForbidden},
+
+		{"creator revokes own share", stranger, ActionShareRevoke, Resource{OwnerID: stranger}, nil},
+		{"others cannot revoke share", editor, ActionShareRevoke, Resource{OwnerID: stranger}, ErrForbidden},
+		{"creator manages file request", editor, ActionFileRequestManage, Resource{OwnerID: editor, WorkspaceID: workspace}, nil},
+		{"workspace owner manages file request", owner, ActionFileRequestManage, Resource{OwnerID: editor, WorkspaceID: workspace}, nil},
+		{"viewer cannot manage file request", viewer, ActionFileRequestManage, Resource{OwnerID: editor, WorkspaceID: workspace}, ErrForbidden},
+
+		{"read grant downloads", reader, ActionDocumentRead, sharedDocument, nil},
+		{"read grant cannot delete", reader, ActionDocumentDelete, sharedDocument, ErrForbidden},
+		{"read grant cannot share", reader, ActionShareCreate, sharedDocument, ErrForbidden},
+		{"edit grant shares", collab, ActionShareCreate, sharedDocument, nil},
+		{"edit grant deletes", collab, ActionDocumentDelete, sharedDocument, nil},
+		{"grant is limited to its document", collab, ActionDocumentRead, inWorkspace, ErrForbidden},
+		{"viewer keeps workspace role on shared document", viewer, ActionDocumentRead, sharedDocument, nil},
+
+		{"org owner transfers", owner, ActionOrganizationTransfer, inOrg, nil},
+		{"org admin manages", orgAdmin, ActionOrganizationManage, inOrg, nil},
+		{"org admin cannot transfer", orgAdmin, ActionOrganizationTransfer, inOrg, ErrForbidden},
+		{"org member reads", orgMember, ActionOrganizationRead, inOrg, nil},
+		{"org member cannot manage", orgMember, ActionOrganizationManage, inOrg, ErrForbidden},
+		{"stranger cannot read org", stranger, ActionOrganizationRead, inOrg, ErrForbidden},
+
+		{"admin manages users", admin, ActionUserManage, Resource{}, nil},
+		{"deactivated admin cannot manage users", exAdmin, ActionUserManage, Resource{}, ErrForbidden},
+		{"user cannot manage users", owner, ActionUserManage, Resource{}, ErrForbidden},
+		{"admin cannot read documents", admin, ActionDocumentRead, inWorkspace, ErrForbidden},
+		{"admin revokes any share", admin, ActionShareRevoke, Resource{OwnerID: stranger}, nil},
+		{"deactivated admin cannot revoke shares", exAdmin, ActionShareRevoke, Resource{OwnerID: stranger}, ErrForbidden},
+		{"legal places holds", legal, ActionLegalHoldManage, Resource{}, nil},
+		{"admin cannot place holds", admin, ActionLegalHoldManage, Resource{}, ErrForbidden},
+		{"legal cannot manage users", legal, ActionUserManage, Resource{}, ErrForbidden},
+		{"legal cannot read documents", legal, ActionDocumentRead, inWorkspace, ErrForbidden},
+
+		{"anonymous", uuid.Nil, ActionDocumentList, Resource{OwnerID: uuid.Nil}, ErrForbidden},
+		{"no resource", owner, ActionDocumentRead, Resource{}, ErrForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := policy.Authorize(context.Background(), Subject{UserID: tt.user}, tt.action, tt.resource)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("Authorize(%s) = %v, want %v", tt.action, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestAuthorizeLookupError(t *testing.T) {
+	lookupErr := errors.New("database down")
+	policy := NewPolicy(&fakeRoles{err: lookupErr})
+
+	err := policy.Authorize(context.Background(), Subject{UserID: uuid.New()}, ActionDocumentList, Resource{WorkspaceID: uuid.New()})
+	if !errors.Is(err, lookupErr) {
+		t.Fatalf("Authorize = %v, want the lookup error", err)
+	}
+	if errors.Is(err, ErrForbidden) {
+		t.Fatal("a failed lookup must not look like a denial")
+	}
+}
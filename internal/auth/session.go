@@ -0,0 +1,65 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"time"
+
+	"Secure-Document-Exchange-Portal/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// sessionTouchInterval limits how often a session's last-seen time is written
+const sessionTouchInterval = 5 * time.Minute
+
+// SessionStore looks up the server-side session referenced by a token's
+// sid claim
+type SessionStore interface {
+	GetSessionByID(ctx context.Context, sessionID uuid.UUID) (*models.SessionCache, error)
+	TouchSession(ctx context.Context, sessionID uuid.UUID) error
+}
+
+// SessionActive reports whether the session behind claims still exists,
+// belongs to the token's user and has not expired
+func SessionActive(ctx context.Context, sessions SessionStore, claims *Claims) bool {
+	_, ok := activeSession(ctx, sessions, claims)
+	return ok
+}
+
+func activeSession(ctx context.Context, sessions SessionStore, claims *Claims) (*models.SessionCache, bool) {
+	session, err := sessions.GetSessionByID(ctx, claims.SessionID)
+	if err != nil {
+		return nil, false
+	}
+
+	if session.UserID != claims.UserID.String() || !session.ExpiresAt.After(time.Now()) {
+		return nil, false
+	}
+	return session, true
+}
+
+// touchSession updates the session's last-seen time in the background, at
+// most once per sessionTouchInterval
+func touchSession(sessions SessionStore, session *models.SessionCache, sessionID uuid.UUID) {
+	if time.Since(session.LastSeenAt) < sessionTouchInterval {
+		return
+	}
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := sessions.TouchSession(ctx, sessionID); err != nil {
+			log.Printf("Failed to update last seen time of session %s: %v", sessionID, err)
+		}
+	}()
+}
+
+// HashToken returns the SHA-256 digest stored for a token, so the database
+// never holds usable bearer tokens
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,170 @@
+package auth
+
+import (
+	"errors"
+	"time"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/google/uuid"
+)
+
+// webAuthnTimeout is how long the browser and the server wait for the
+// authenticator during a ceremony
+const webAuthnTimeout = 5 * time.Minute
+
+// WebAuthnUser is an account with its registered WebAuthn credentials. The
+// user handle is the account's UUID, so no personal data is stored on
+// authenticators.
+type WebAuthnUser struct {
+	ID          uuid.UUID
+	Email       string
+	FullName    string
+	Credentials []webauthn.Credential
+}
+
+func (u *WebAuthnUser) WebAuthnID() []byte {
+	return u.ID[:]
+}
+
+func (u *WebAuthnUser) WebAuthnName() string {
+	return u.Email
+}
+
+func (u *WebAuthnUser) WebAuthnDisplayName() string {
+	if u.FullName != "" {
+		return u.FullName
+	}
+	return u.Email
+}
+
+func (u *WebAuthnUser) WebAuthnCredentials() []webauthn.Credential {
+	return u.Credentials
+}
+
+// WebAuthnService runs WebAuthn registration and authentication ceremonies.
+// Responses are passed as the raw JSON the browser produced, so ceremonies
+// can be driven by a software authenticator as well as by HTTP handlers.
+type WebAuthnService struct {
+	webauthn *webauthn.WebAuthn
+}
+
+// NewWebAuthnService creates the relying party. rpID is the domain
+// credentials are scoped to; origins are the exact origins (scheme, host
+// and port) the portal is served from.
+func NewWebAuthnService(rpID, rpName string, origins []string) (*WebAuthnService, error) {
+	timeout := webauthn.TimeoutConfig{
+		Enforce:    true,
+		Timeout:    webAuthnTimeout,
+		TimeoutUVD: webAuthnTimeout,
+	}
+
+	w, err := webauthn.New(&webauthn.Config{
+		RPID:          rpID,
+		RPDisplayName: rpName,
+		RPOrigins:     origins,
+		Timeouts: webauthn.TimeoutsConfig{
+			Login:        timeout,
+			Registration: timeout,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &WebAuthnService{webauthn: w}, nil
+}
+
+// BeginRegistration starts registering a new credential for the user.
+// Authenticators are asked for a discoverable credential (a passkey) where
+// they support one, so the credential can also be used without a password.
+func (s *WebAuthnService) BeginRegistration(user *WebAuthnUser) (*protocol.CredentialCreation, *webauthn.SessionData, error) {
+	return s.webauthn.BeginRegistration(user,
+		webauthn.WithExclusions(webauthn.Credentials(user.Credentials).CredentialDescriptors()),
+		webauthn.WithAuthenticatorSelection(protocol.AuthenticatorSelection{
+			ResidentKey:      protocol.ResidentKeyRequirementPreferred,
+			UserVerification: protocol.VerificationPreferred,
+		}),
+	)
+}
+
+// FinishRegistration verifies the browser's response to BeginRegistration
+// and returns the new credential
+func (s *WebAuthnService) FinishRegistration(user *WebAuthnUser, session webauthn.SessionData, response []byte) (*webauthn.Credential, error) {
+	parsed, err := protocol.ParseCredentialCreationResponseBytes(response)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.webauthn.CreateCredential(user, session, parsed)
+}
+
+// BeginLogin starts using one of the user's credentials as a second factor
+// after their password was checked
+func (s *WebAuthnService) BeginLogin(user *WebAuthnUser) (*protocol.CredentialAssertion, *webauthn.SessionData, error) {
+	return s.webauthn.BeginLogin(user, webauthn.WithUserVerification(protocol.VerificationPreferred))
+}
+
+// FinishLogin verifies the browser's response to BeginLogin and returns the
+// credential with its updated sign count
+func (s *WebAuthnService) FinishLogin(user *WebAuthnUser, session webauthn.SessionData, response []byte) (*webauthn.Credential, error) {
+	parsed, err := protocol.ParseCredentialRequestResponseBytes(response)
+	if err != nil {
+		return nil, err
+	}
+
+	credential, err := s.webauthn.ValidateLogin(user, session, parsed)
+	if err != nil {
+		return nil, err
+	}
+	return checkCloneWarning(credential)
+}
+
+// BeginPasswordlessLogin starts a login with a passkey alone. The
+// authenticator has to verify the user (PIN or biometrics), which makes the
+// passkey a multi-factor credential on its own.
+func (s *WebAuthnService) BeginPasswordlessLogin() (*protocol.CredentialAssertion, *webauthn.SessionData, error) {
+	return s.webauthn.BeginDiscoverableLogin(webauthn.WithUserVerification(protocol.VerificationRequired))
+}
+
+// FinishPasswordlessLogin verifies the browser's response to
+// BeginPasswordlessLogin. lookup loads the account a user handle belongs to.
+func (s *WebAuthnService) FinishPasswordlessLogin(session webauthn.SessionData, response []byte, lookup func(userID uuid.UUID) (*WebAuthnUser, error)) (*WebAuthnUser, *webauthn.Credential, error) {
+	parsed, err := protocol.ParseCredentialRequestResponseBytes(response)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var found *WebAuthnUser
+	handler := func(rawID, userHandle []byte) (webauthn.User, error) {
+		userID, err := uuid.FromBytes(userHandle)
+		if err != nil {
+			return nil, errors.New("unknown user handle")
+		}
+		found, err = lookup(userID)
+		if err != nil {
+			return nil, err
+		}
+		return found, nil
+	}
+
+	_, credential, err := s.webauthn.ValidatePasskeyLogin(handler, session, parsed)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	credential, err = checkCloneWarning(credential)
+	if err != nil {
+		return nil, nil, err
+	}
+	return found, credential, nil
+}
+
+// checkCloneWarning rejects credentials whose sign count went backwards,
+// which means the authenticator may have been cloned
+func checkCloneWarning(credential *webauthn.Credential) (*webauthn.Credential, error) {
+	if credential.Authenticator.CloneWarning {
+		return nil, errors.New("authenticator sign count went backwards, it may have been cloned")
+	}
+	return credential, nil
+}
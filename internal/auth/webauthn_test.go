@@ -0,0 +1,340 @@
+package auth
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/protocol/webauthncbor"
+	"github.com/go-webauthn/webauthn/protocol/webauthncose"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/google/uuid"
+)
+
+const (
+	testRPID   = "portal.example.com"
+	testOrigin = "https://portal.example.com"
+)
+
+// Authenticator data flags
+const (
+	flagUserPresent  = 0x01
+	flagUserVerified = 0x04
+	flagAttested     = 0x40
+)
+
+// softAuthenticator is a software authenticator holding one ES256
+// credential. It answers ceremonies the way a browser would pass them on.
+type softAuthenticator struct {
+	t            *testing.T
+	key          *ecdsa.PrivateKey
+	credentialID []byte
+	userHandle   []byte
+	signCount    uint32
+	userVerified bool
+}
+
+func newSoftAuthenticator(t *testing.T) *softAuthenticator {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	credentialID := make([]byte, 16)
+	if _, err := rand.Read(credentialID); err != nil {
+		t.Fatal(err)
+	}
+	return &softAuthenticator{t: t, key: key, credentialID: credentialID, userVerified: true}
+}
+
+// create answers navigator.credentials.create() with a "none" attestation
+func (a *softAuthenticator) create(options *protocol.CredentialCreation) []byte {
+	a.t.Helper()
+
+	a.userHandle = options.Response.User.ID.(protocol.URLEncodedBase64)
+	clientData := a.clientData("webauthn.create", options.Response.Challenge)
+
+	pub, err := a.key.PublicKey.ECDH()
+	if err != nil {
+		a.t.Fatal(err)
+	}
+	point := pub.Bytes() // 0x04 || X || Y
+	publicKey, err := webauthncbor.Marshal(webauthncose.EC2PublicKeyData{
+		PublicKeyData: webauthncose.PublicKeyData{
+			KeyType:   int64(webauthncose.EllipticKey),
+			Algorithm: int64(webauthncose.AlgES256),
+		},
+		Curve:  int64(webauthncose.P256),
+		XCoord: point[1:33],
+		YCoord: point[33:],
+	})
+	if err != nil {
+		a.t.Fatal(err)
+	}
+
+	authData := a.authData(flagAttested)
+	authData = append(authData, make([]byte, 16)...) // AAGUID
+	authData = binary.BigEndian.AppendUint16(authData, uint16(len(a.credentialID)))
+	authData = append(authData, a.credentialID...)
+	authData = append(authData, publicKey...)
+
+	attestation, err := webauthncbor.Marshal(map[string]any{
+		"fmt":      "none",
+		"attStmt":  map[string]any{},
+		"authData": authData,
+	})
+	if err != nil {
+		a.t.Fatal(err)
+	}
+
+	return a.encode(map[string]any{
+		"clientDataJSON":    b64(clientData),
+		"attestationObject": b64(attestation),
+	})
+}
+
+// get answers navigator.credentials.get() with the next sign count
+func (a *softAuthenticator) get(options *protocol.CredentialAssertion) []byte {
+	a.t.Helper()
+
+	a.signCount++
+	clientData := a.clientData("webauthn.get", options.Response.Challenge)
+	authData := a.authData(0)
+
+	clientDataHash := sha256.Sum256(clientData)
+	digest := sha256.Sum256(append(bytes.Clone(authData), clientDataHash[:]...))
+	signature, err := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+	if err != nil {
+		a.t.Fatal(err)
+	}
+
+	return a.encode(map[string]any{
+		"clientDataJSON":    b64(clientData),
+		"authenticatorData": b64(authData),
+		"signature":         b64(signature),
+		"userHandle":        b64(a.userHandle),
+	})
+}
+
+func (a *softAuthenticator) clientData(ceremony string, challenge protocol.URLEncodedBase64) []byte {
+	data, err := json.Marshal(map[string]string{
+		"type":      ceremony,
+		"challenge": challenge.String(),
+		"origin":    testOrigin,
+	})
+	if err != nil {
+		a.t.Fatal(err)
+	}
+	return data
+}
+
+func (a *softAuthenticator) authData(flags byte) []byte {
+	rpIDHash := sha256.Sum256([]byte(testRPID))
+	flags |= flagUserPresent
+	if a.userVerified {
+		flags |= flagUserVerified
+	}
+
+	data := append(rpIDHash[:], flags)
+	return binary.BigEndian.AppendUint32(data, a.signCount)
+}
+
+func (a *softAuthenticator) encode(response map[string]any) []byte {
+	data, err := json.Marshal(map[string]any{
+		"id":       b64(a.credentialID),
+		"rawId":    b64(a.credentialID),
+		"type":     "public-key",
+		"response": response,
+	})
+	if err != nil {
+		a.t.Fatal(err)
+	}
+	return data
+}
+
+func b64(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func newTestWebAuthnService(t *testing.T) *WebAuthnService {
+	t.Helper()
+
+	service, err := NewWebAuthnService(testRPID, "Test Portal", []string{testOrigin})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return service
+}
+
+// register runs a registration ceremony and adds the new credential to user
+func register(t *testing.T, service *WebAuthnService, user *WebAuthnUser, authenticator *softAuthenticator) *webauthn.Credential {
+	t.Helper()
+
+	options, session, err := service.BeginRegistration(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	credential, err := service.FinishRegistration(user, *session, authenticator.create(options))
+	if err != nil {
+		t.Fatalf("FinishRegistration: %v", err)
+	}
+	user.Credentials = append(user.Credentials, *credential)
+	return credential
+}
+
+func TestWebAuthnRegistration(t *testing.T) {
+	service := newTestWebAuthnService(t)
+	user := &WebAuthnUser{ID: uuid.New(), Email: "alice@example.com"}
+	authenticator := newSoftAuthenticator(t)
+
+	credential := register(t, service, user, authenticator)
+	if !bytes.Equal(credential.ID, authenticator.credentialID) {
+		t.Errorf("credential ID = %x, want %x", credential.ID, authenticator.credentialID)
+	}
+	if !bytes.Equal(authenticator.userHandle, user.ID[:]) {
+		t.Errorf("user handle = %x, want the user's UUID", authenticator.userHandle)
+	}
+
+	// A response to another ceremony's challenge is refused
+	options, _, err := service.BeginRegistration(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, other, err := service.BeginRegistration(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := service.FinishRegistration(user, *other, newSoftAuthenticator(t).create(options)); err == nil {
+		t.Error("FinishRegistration accepted a response to a different challenge")
+	}
+}
+
+func TestWebAuthnLogin(t *testing.T) {
+	service := newTestWebAuthnService(t)
+	user := &WebAuthnUser{ID: uuid.New(), Email: "alice@example.com"}
+	authenticator := newSoftAuthenticator(t)
+	register(t, service, user, authenticator)
+
+	options, session, err := service.BeginLogin(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	credential, err := service.FinishLogin(user, *session, authenticator.get(options))
+	if err != nil {
+		t.Fatalf("FinishLogin: %v", err)
+	}
+	if credential.Authenticator.SignCount != authenticator.signCount {
+		t.Errorf("sign count = %d, want %d", credential.Authenticator.SignCount, authenticator.signCount)
+	}
+	user.Credentials[0] = *credential
+
+	// A key signing with someone else's private key is refused
+	impostor := newSoftAuthenticator(t)
+	impostor.credentialID = authenticator.credentialID
+	impostor.userHandle = authenticator.userHandle
+	impostor.signCount = authenticator.signCount
+	options, session, err = service.BeginLogin(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := service.FinishLogin(user, *session, impostor.get(options)); err == nil {
+		t.Error("FinishLogin accepted a signature from a different key")
+	}
+}
+
+func TestWebAuthnLoginCloneWarning(t *testing.T) {
+	service := newTestWebAuthnService(t)
+	user := &WebAuthnUser{ID: uuid.New(), Email: "alice@example.com"}
+	authenticator := newSoftAuthenticator(t)
+	register(t, service, user, authenticator)
+
+	// The server last saw a higher sign count than the authenticator sends
+	user.Credentials[0].Authenticator.SignCount = 10
+	authenticator.signCount = 4
+
+	options, session, err := service.BeginLogin(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := service.FinishLogin(user, *session, authenticator.get(options)); err == nil {
+		t.Error("FinishLogin accepted a sign count that went backwards")
+	}
+}
+
+func TestWebAuthnPasswordlessLogin(t *testing.T) {
+	service := newTestWebAuthnService(t)
+	user := &WebAuthnUser{ID: uuid.New(), Email: "alice@example.com"}
+	authenticator := newSoftAuthenticator(t)
+	register(t, service, user, authenticator)
+
+	lookup := func(userID uuid.UUID) (*WebAuthnUser, error) {
+		if userID != user.ID {
+			return nil, errors.New("user not found")
+		}
+		return user, nil
+	}
+
+	options, session, err := service.BeginPasswordlessLogin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	found, credential, err := service.FinishPasswordlessLogin(*session, authenticator.get(options), lookup)
+	if err != nil {
+		t.Fatalf("FinishPasswordlessLogin: %v", err)
+	}
+	if found.ID != user.ID {
+		t.Errorf("found user %s, want %s", found.ID, user.ID)
+	}
+	if credential.Authenticator.SignCount != authenticator.signCount {
+		t.Errorf("sign count = %d, want %d", credential.Authenticator.SignCount, authenticator.signCount)
+	}
+	user.Credentials[0] = *credential
+
+	t.Run("user verification required", func(t *testing.T) {
+		authenticator.userVerified = false
+		defer func() { authenticator.userVerified = true }()
+
+		options, session, err := service.BeginPasswordlessLogin()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err := service.FinishPasswordlessLogin(*session, authenticator.get(options), lookup); err == nil {
+			t.Error("FinishPasswordlessLogin accepted a response without user verification")
+		}
+	})
+
+	t.Run("unknown user handle", func(t *testing.T) {
+		stranger := *authenticator
+		otherID := uuid.New()
+		stranger.userHandle = otherID[:]
+
+		options, session, err := service.BeginPasswordlessLogin()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err := service.FinishPasswordlessLogin(*session, stranger.get(options), lookup); err == nil {
+			t.Error("FinishPasswordlessLogin accepted an unknown user handle")
+		}
+	})
+
+	t.Run("clone warning", func(t *testing.T) {
+		user.Credentials[0].Authenticator.SignCount = authenticator.signCount + 5
+
+		options, session, err := service.BeginPasswordlessLogin()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err := service.FinishPasswordlessLogin(*session, authenticator.get(options), lookup); err == nil {
+			t.Error("FinishPasswordlessLogin accepted a sign count that went backwards")
+		}
+	})
+}
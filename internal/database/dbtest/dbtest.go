@@ -0,0 +1,70 @@
+// Package dbtest gives tests a database of their own. Tests that need one
+// are skipped unless TEST_DATABASE_URL points at a PostgreSQL server, in
+// which each test gets a fresh schema built from sql/schema.sql.
+package dbtest
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"Secure-Document-Exchange-Portal/internal/database"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// New returns a pool connected to an empty copy of the schema, which is
+// dropped when the test ends
+func New(t testing.TB) (*pgxpool.Pool, *database.Queries) {
+	t.Helper()
+
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+	ctx := context.Background()
+
+	_, file, _, _ := runtime.Caller(0)
+	schemaSQL, err := os.ReadFile(filepath.Join(filepath.Dir(file), "..", "..", "..", "sql", "schema.sql"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	admin, err := pgxpool.New(ctx, url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(admin.Close)
+
+	suffix := make([]byte, 8)
+	rand.Read(suffix)
+	schema := "test_" + hex.EncodeToString(suffix)
+	if _, err := admin.Exec(ctx, "CREATE SCHEMA "+schema); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if _, err := admin.Exec(context.Background(), "DROP SCHEMA "+schema+" CASCADE"); err != nil {
+			t.Logf("Failed to drop test schema %s: %v", schema, err)
+		}
+	})
+
+	config, err := pgxpool.ParseConfig(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.ConnConfig.RuntimeParams["search_path"] = schema + ",public"
+	pool, err := pgxpool.NewWithConfig(ctx, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(pool.Close)
+
+	if _, err := pool.Exec(ctx, string(schemaSQL)); err != nil {
+		t.Fatalf("Failed to create schema: %v", err)
+	}
+	return pool, database.New(pool)
+}
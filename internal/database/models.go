@@ -10,6 +10,56 @@ import (
 	"github.com/jackc/pgx/v5/pgtype"
 )
 
+type AccountToken struct {
+	ID        pgtype.UUID
+	UserID    pgtype.UUID
+	Purpose   string
+	TokenHash string
+	ExpiresAt pgtype.Timestamptz
+	UsedAt    pgtype.Timestamptz
+	CreatedAt pgtype.Timestamptz
+}
+
+type ApiKey struct {
+	ID         pgtype.UUID
+	UserID     pgtype.UUID
+	Name       string
+	KeyPrefix  string
+	KeyHash    string
+	Scopes     []string
+	ExpiresAt  pgtype.Timestamptz
+	LastUsedAt pgtype.Timestamptz
+	LastUsedIp *netip.Addr
+	CreatedAt  pgtype.Timestamptz
+}
+
+type AuditEvent struct {
+	Seq          int64
+	OccurredAt   pgtype.Timestamptz
+	ActorID      pgtype.UUID
+	ActorEmail   string
+	Action       string
+	ResourceType string
+	ResourceID   string
+	IpAddress    *netip.Addr
+	UserAgent    string
+	Details      []byte
+	PrevHash     string
+	Hash         string
+}
+
+type DataExport struct {
+	ID          pgtype.UUID
+	UserID      pgtype.UUID
+	Status      string
+	FilePath    pgtype.Text
+	FileSize    int64
+	Error       pgtype.Text
+	RequestedAt pgtype.Timestamptz
+	CompletedAt pgtype.Timestamptz
+	ExpiresAt   pgtype.Timestamptz
+}
+
 type Document struct {
 	ID           pgtype.UUID
 	UserID       pgtype.UUID
@@ -21,36 +71,274 @@ type Document struct {
 	Checksum     string
 	CreatedAt    pgtype.Timestamptz
 	UpdatedAt    pgtype.Timestamptz
+	FolderID     pgtype.UUID
+	WorkspaceID  pgtype.UUID
+	DeletedAt    pgtype.Timestamptz
+	DeletedBy    pgtype.UUID
 }
 
-type Session struct {
+type DocumentGrant struct {
+	ID         pgtype.UUID
+	DocumentID pgtype.UUID
+	UserID     pgtype.UUID
+	TeamID     pgtype.UUID
+	Permission string
+	GrantedBy  pgtype.UUID
+	CreatedAt  pgtype.Timestamptz
+}
+
+type DocumentTag struct {
+	DocumentID pgtype.UUID
+	Tag        string
+}
+
+type FileRequest struct {
+	ID           pgtype.UUID
+	UserID       pgtype.UUID
+	RequestToken string
+	Title        string
+	Message      pgtype.Text
+	ExpiresAt    pgtype.Timestamptz
+	MaxFiles     int32
+	MaxFileSize  int64
+	AllowedTypes pgtype.Text
+	UploadCount  int32
+	FolderID     pgtype.UUID
+	CreatedAt    pgtype.Timestamptz
+	WorkspaceID  pgtype.UUID
+}
+
+type FileRequestUpload struct {
+	ID            pgtype.UUID
+	FileRequestID pgtype.UUID
+	DocumentID    pgtype.UUID
+	UploaderName  pgtype.Text
+	UploaderEmail pgtype.Text
+	IpAddress     *netip.Addr
+	CreatedAt     pgtype.Timestamptz
+}
+
+type Folder struct {
+	ID          pgtype.UUID
+	UserID      pgtype.UUID
+	ParentID    pgtype.UUID
+	Name        string
+	CreatedAt   pgtype.Timestamptz
+	UpdatedAt   pgtype.Timestamptz
+	WorkspaceID pgtype.UUID
+}
+
+type LegalHold struct {
+	ID            pgtype.UUID
+	ResourceType  string
+	ResourceID    pgtype.UUID
+	Reason        string
+	Custodian     string
+	PlacedBy      pgtype.UUID
+	PlacedAt      pgtype.Timestamptz
+	ReleasedBy    pgtype.UUID
+	ReleasedAt    pgtype.Timestamptz
+	ReleaseReason pgtype.Text
+}
+
+type MfaRecoveryCode struct {
 	ID        pgtype.UUID
 	UserID    pgtype.UUID
-	Token     string
-	ExpiresAt pgtype.Timestamptz
+	CodeHash  string
+	UsedAt    pgtype.Timestamptz
 	CreatedAt pgtype.Timestamptz
-	IpAddress *netip.Addr
-	UserAgent pgtype.Text
 }
 
-type Share struct {
+type OidcAuthRequest struct {
 	ID           pgtype.UUID
-	DocumentID   pgtype.UUID
-	ShareToken   string
+	StateHash    string
+	Provider     string
+	CodeVerifier string
+	Nonce        string
 	ExpiresAt    pgtype.Timestamptz
-	MaxAccess    pgtype.Int4
-	AccessCount  pgtype.Int4
-	PasswordHash pgtype.Text
 	CreatedAt    pgtype.Timestamptz
+}
+
+type Organization struct {
+	ID         pgtype.UUID
+	Name       string
+	CreatedAt  pgtype.Timestamptz
+	RequireMfa bool
+}
+
+type OrganizationMember struct {
+	OrganizationID pgtype.UUID
+	UserID         pgtype.UUID
+	Role           string
+	CreatedAt      pgtype.Timestamptz
+}
+
+type RefreshToken struct {
+	ID        pgtype.UUID
+	SessionID pgtype.UUID
+	TokenHash string
+	ExpiresAt pgtype.Timestamptz
+	UsedAt    pgtype.Timestamptz
+	CreatedAt pgtype.Timestamptz
+}
+
+type RetentionNotice struct {
+	DocumentID pgtype.UUID
+	DueAt      pgtype.Timestamptz
+	DeleteAt   pgtype.Timestamptz
+	NotifiedAt pgtype.Timestamptz
+}
+
+type RetentionPolicy struct {
+	ID           pgtype.UUID
+	WorkspaceID  pgtype.UUID
+	FolderID     pgtype.UUID
+	Tag          pgtype.Text
+	RetainMonths int32
+	RetainDays   int32
+	WarnDays     int32
 	CreatedBy    pgtype.UUID
+	CreatedAt    pgtype.Timestamptz
+	UpdatedAt    pgtype.Timestamptz
+}
+
+type Session struct {
+	ID         pgtype.UUID
+	UserID     pgtype.UUID
+	Token      string
+	ExpiresAt  pgtype.Timestamptz
+	CreatedAt  pgtype.Timestamptz
+	IpAddress  *netip.Addr
+	UserAgent  pgtype.Text
+	LastSeenAt pgtype.Timestamptz
+}
+
+type Share struct {
+	ID                     pgtype.UUID
+	ShareToken             string
+	ExpiresAt              pgtype.Timestamptz
+	MaxAccess              pgtype.Int4
+	AccessCount            pgtype.Int4
+	PasswordHash           pgtype.Text
+	CreatedAt              pgtype.Timestamptz
+	CreatedBy              pgtype.UUID
+	FolderID               pgtype.UUID
+	Name                   pgtype.Text
+	ViewOnly               bool
+	AllowedCidrs           []netip.Prefix
+	NotifyOnAccess         string
+	NotifyOnLimit          bool
+	NotifyPasswordFailures pgtype.Int4
+	NotifyExpiringHours    pgtype.Int4
+	ExpiryNotifiedAt       pgtype.Timestamptz
+}
+
+type ShareAccessLog struct {
+	ID         pgtype.UUID
+	ShareID    pgtype.UUID
+	DocumentID pgtype.UUID
+	Action     string
+	IpAddress  *netip.Addr
+	UserAgent  pgtype.Text
+	CreatedAt  pgtype.Timestamptz
+}
+
+type ShareDocument struct {
+	ShareID        pgtype.UUID
+	DocumentID     pgtype.UUID
+	DownloadCount  int32
+	LastDownloadAt pgtype.Timestamptz
+}
+
+type StorageUsage struct {
+	ID             pgtype.UUID
+	UserID         pgtype.UUID
+	OrganizationID pgtype.UUID
+	Plan           string
+	QuotaBytes     pgtype.Int8
+	QuotaDocuments pgtype.Int4
+	UsedBytes      int64
+	DocumentCount  int32
+	UpdatedAt      pgtype.Timestamptz
+}
+
+type Team struct {
+	ID             pgtype.UUID
+	OrganizationID pgtype.UUID
+	Name           string
+	CreatedAt      pgtype.Timestamptz
+}
+
+type TeamMember struct {
+	TeamID    pgtype.UUID
+	UserID    pgtype.UUID
+	CreatedAt pgtype.Timestamptz
 }
 
 type User struct {
+	ID                  pgtype.UUID
+	Email               string
+	PasswordHash        string
+	FullName            string
+	CreatedAt           pgtype.Timestamptz
+	UpdatedAt           pgtype.Timestamptz
+	IsActive            pgtype.Bool
+	DefaultAllowedCidrs []netip.Prefix
+	IsAdmin             bool
+	TotpSecret          pgtype.Text
+	TotpEnabled         bool
+	TotpLastStep        int64
+	EmailVerifiedAt     pgtype.Timestamptz
+	FailedLoginCount    int32
+	LastFailedLoginAt   pgtype.Timestamptz
+	LockedUntil         pgtype.Timestamptz
+	IsLegal             bool
+	DeleteAfter         pgtype.Timestamptz
+	LastLoginAttemptAt  pgtype.Timestamptz
+}
+
+type UserIdentity struct {
+	ID          pgtype.UUID
+	UserID      pgtype.UUID
+	Provider    string
+	Subject     string
+	Email       string
+	CreatedAt   pgtype.Timestamptz
+	LastLoginAt pgtype.Timestamptz
+}
+
+type WebauthnChallenge struct {
+	ID          pgtype.UUID
+	UserID      pgtype.UUID
+	Purpose     string
+	SessionData []byte
+	ExpiresAt   pgtype.Timestamptz
+	CreatedAt   pgtype.Timestamptz
+}
+
+type WebauthnCredential struct {
 	ID           pgtype.UUID
-	Email        string
-	PasswordHash string
-	FullName     string
+	UserID       pgtype.UUID
+	CredentialID []byte
+	Credential   []byte
+	Name         string
 	CreatedAt    pgtype.Timestamptz
-	UpdatedAt    pgtype.Timestamptz
-	IsActive     pgtype.Bool
+	LastUsedAt   pgtype.Timestamptz
+}
+
+type Workspace struct {
+	ID             pgtype.UUID
+	OrganizationID pgtype.UUID
+	PersonalUserID pgtype.UUID
+	Name           string
+	CreatedAt      pgtype.Timestamptz
+}
+
+type WorkspaceMember struct {
+	ID          pgtype.UUID
+	WorkspaceID pgtype.UUID
+	UserID      pgtype.UUID
+	TeamID      pgtype.UUID
+	Role        string
+	CreatedAt   pgtype.Timestamptz
 }
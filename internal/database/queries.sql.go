@@ -12,10 +12,513 @@ import (
 	"github.com/jackc/pgx/v5/pgtype"
 )
 
+const addOrganizationMember = `-- name: AddOrganizationMember :one
+INSERT INTO organization_members (organization_id, user_id, role)
+VALUES ($1, $2, $3)
+ON CONFLICT (organization_id, user_id) DO UPDATE SET role = EXCLUDED.role
+RETURNING organization_id, user_id, role, created_at
+`
+
+type AddOrganizationMemberParams struct {
+	OrganizationID pgtype.UUID
+	UserID         pgtype.UUID
+	Role           string
+}
+
+func (q *Queries) AddOrganizationMember(ctx context.Context, arg AddOrganizationMemberParams) (OrganizationMember, error) {
+	row := q.db.QueryRow(ctx, addOrganizationMember, arg.OrganizationID, arg.UserID, arg.Role)
+	var i OrganizationMember
+	err := row.Scan(
+		&i.OrganizationID,
+		&i.UserID,
+		&i.Role,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const addOrganizationStorage = `-- name: AddOrganizationStorage :one
+INSERT INTO storage_usage (organization_id, plan, used_bytes, document_count)
+VALUES ($1, $2, $3, 1)
+ON CONFLICT (organization_id) DO UPDATE SET
+    used_bytes = storage_usage.used_bytes + EXCLUDED.used_bytes,
+    document_count = storage_usage.document_count + 1,
+    updated_at = CURRENT_TIMESTAMP
+RETURNING id, user_id, organization_id, plan, quota_bytes, quota_documents, used_bytes, document_count, updated_at
+`
+
+type AddOrganizationStorageParams struct {
+	OrganizationID pgtype.UUID
+	Plan           string
+	UsedBytes      int64
+}
+
+func (q *Queries) AddOrganizationStorage(ctx context.Context, arg AddOrganizationStorageParams) (StorageUsage, error) {
+	row := q.db.QueryRow(ctx, addOrganizationStorage, arg.OrganizationID, arg.Plan, arg.UsedBytes)
+	var i StorageUsage
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.OrganizationID,
+		&i.Plan,
+		&i.QuotaBytes,
+		&i.QuotaDocuments,
+		&i.UsedBytes,
+		&i.DocumentCount,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
+
+const addShareDocument = `-- name: AddShareDocument :exec
+INSERT INTO share_documents (share_id, document_id)
+VALUES ($1, $2)
+ON CONFLICT DO NOTHING
+`
+
+type AddShareDocumentParams struct {
+	ShareID    pgtype.UUID
+	DocumentID pgtype.UUID
+}
+
+func (q *Queries) AddShareDocument(ctx context.Context, arg AddShareDocumentParams) error {
+	_, err := q.db.Exec(ctx, addShareDocument, arg.ShareID, arg.DocumentID)
+	return err
+}
+
+const addTeamMember = `-- name: AddTeamMember :exec
+INSERT INTO team_members (team_id, user_id)
+VALUES ($1, $2)
+ON CONFLICT DO NOTHING
+`
+
+type AddTeamMemberParams struct {
+	TeamID pgtype.UUID
+	UserID pgtype.UUID
+}
+
+func (q *Queries) AddTeamMember(ctx context.Context, arg AddTeamMemberParams) error {
+	_, err := q.db.Exec(ctx, addTeamMember, arg.TeamID, arg.UserID)
+	return err
+}
+
+const addUserStorage = `-- name: AddUserStorage :one
+INSERT INTO storage_usage (user_id, plan, used_bytes, document_count)
+VALUES ($1, $2, $3, 1)
+ON CONFLICT (user_id) DO UPDATE SET
+    used_bytes = storage_usage.used_bytes + EXCLUDED.used_bytes,
+    document_count = storage_usage.document_count + 1,
+    updated_at = CURRENT_TIMESTAMP
+RETURNING id, user_id, organization_id, plan, quota_bytes, quota_documents, used_bytes, document_count, updated_at
+`
+
+type AddUserStorageParams struct {
+	UserID    pgtype.UUID
+	Plan      string
+	UsedBytes int64
+}
+
+func (q *Queries) AddUserStorage(ctx context.Context, arg AddUserStorageParams) (StorageUsage, error) {
+	row := q.db.QueryRow(ctx, addUserStorage, arg.UserID, arg.Plan, arg.UsedBytes)
+	var i StorageUsage
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.OrganizationID,
+		&i.Plan,
+		&i.QuotaBytes,
+		&i.QuotaDocuments,
+		&i.UsedBytes,
+		&i.DocumentCount,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
+
+const addWorkspaceTeam = `-- name: AddWorkspaceTeam :one
+INSERT INTO workspace_members (workspace_id, team_id, role)
+VALUES ($1, $2, $3)
+ON CONFLICT (workspace_id, team_id) DO UPDATE SET role = EXCLUDED.role
+RETURNING id, workspace_id, user_id, team_id, role, created_at
+`
+
+type AddWorkspaceTeamParams struct {
+	WorkspaceID pgtype.UUID
+	TeamID      pgtype.UUID
+	Role        string
+}
+
+func (q *Queries) AddWorkspaceTeam(ctx context.Context, arg AddWorkspaceTeamParams) (WorkspaceMember, error) {
+	row := q.db.QueryRow(ctx, addWorkspaceTeam, arg.WorkspaceID, arg.TeamID, arg.Role)
+	var i WorkspaceMember
+	err := row.Scan(
+		&i.ID,
+		&i.WorkspaceID,
+		&i.UserID,
+		&i.TeamID,
+		&i.Role,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const addWorkspaceUser = `-- name: AddWorkspaceUser :one
+INSERT INTO workspace_members (workspace_id, user_id, role)
+VALUES ($1, $2, $3)
+ON CONFLICT (workspace_id, user_id) DO UPDATE SET role = EXCLUDED.role
+RETURNING id, workspace_id, user_id, team_id, role, created_at
+`
+
+type AddWorkspaceUserParams struct {
+	WorkspaceID pgtype.UUID
+	UserID      pgtype.UUID
+	Role        string
+}
+
+func (q *Queries) AddWorkspaceUser(ctx context.Context, arg AddWorkspaceUserParams) (WorkspaceMember, error) {
+	row := q.db.QueryRow(ctx, addWorkspaceUser, arg.WorkspaceID, arg.UserID, arg.Role)
+	var i WorkspaceMember
+	err := row.Scan(
+		&i.ID,
+		&i.WorkspaceID,
+		&i.UserID,
+		&i.TeamID,
+		&i.Role,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const cancelUserDeletion = `-- name: CancelUserDeletion :one
+UPDATE users
+SET delete_after = NULL, updated_at = CURRENT_TIMESTAMP
+WHERE id = $1 AND delete_after IS NOT NULL
+RETURNING id, email, password_hash, full_name, created_at, updated_at, is_active, default_allowed_cidrs, is_admin, totp_secret, totp_enabled, totp_last_step, email_verified_at, failed_login_count, last_failed_login_at, locked_until, is_legal, delete_after, last_login_attempt_at
+`
+
+func (q *Queries) CancelUserDeletion(ctx context.Context, id pgtype.UUID) (User, error) {
+	row := q.db.QueryRow(ctx, cancelUserDeletion, id)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.Email,
+		&i.PasswordHash,
+		&i.FullName,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.IsActive,
+		&i.DefaultAllowedCidrs,
+		&i.IsAdmin,
+		&i.TotpSecret,
+		&i.TotpEnabled,
+		&i.TotpLastStep,
+		&i.EmailVerifiedAt,
+		&i.FailedLoginCount,
+		&i.LastFailedLoginAt,
+		&i.LockedUntil,
+		&i.IsLegal,
+		&i.DeleteAfter,
+		&i.LastLoginAttemptAt,
+	)
+	return i, err
+}
+
+const claimLoginAttempt = `-- name: ClaimLoginAttempt :one
+UPDATE users
+SET last_login_attempt_at = CURRENT_TIMESTAMP
+WHERE id = $1
+  AND failed_login_count = $2
+  AND (locked_until IS NULL OR locked_until < CURRENT_TIMESTAMP)
+  AND COALESCE(GREATEST(last_login_attempt_at, last_failed_login_at), '-infinity')
+      <= CURRENT_TIMESTAMP - make_interval(secs => $3::float8)
+RETURNING id
+`
+
+type ClaimLoginAttemptParams struct {
+	ID               pgtype.UUID
+	FailedLoginCount int32
+	DelaySeconds     float64
+}
+
+// ClaimLoginAttempt lets one password or MFA attempt through for an account
+// that is not locked, once delay_seconds have passed since the last attempt
+// or failure. The failure count the delay was derived from must still be
+// current, so parallel requests cannot all claim the same slot.
+func (q *Queries) ClaimLoginAttempt(ctx context.Context, arg ClaimLoginAttemptParams) (pgtype.UUID, error) {
+	row := q.db.QueryRow(ctx, claimLoginAttempt, arg.ID, arg.FailedLoginCount, arg.DelaySeconds)
+	var id pgtype.UUID
+	err := row.Scan(&id)
+	return id, err
+}
+
+const claimRetentionNotice = `-- name: ClaimRetentionNotice :execrows
+INSERT INTO retention_notices (document_id, due_at, delete_at)
+VALUES ($1, $2, $3)
+ON CONFLICT (document_id) DO UPDATE
+SET due_at = EXCLUDED.due_at, delete_at = EXCLUDED.delete_at, notified_at = CURRENT_TIMESTAMP
+WHERE retention_notices.due_at <> EXCLUDED.due_at
+`
+
+type ClaimRetentionNoticeParams struct {
+	DocumentID pgtype.UUID
+	DueAt      pgtype.Timestamptz
+	DeleteAt   pgtype.Timestamptz
+}
+
+// Records the warning for a document. Returns 0 rows if it was already
+// warned about the same due date, so overlapping runs warn once.
+func (q *Queries) ClaimRetentionNotice(ctx context.Context, arg ClaimRetentionNoticeParams) (int64, error) {
+	result, err := q.db.Exec(ctx, claimRetentionNotice, arg.DocumentID, arg.DueAt, arg.DeleteAt)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const completeDataExport = `-- name: CompleteDataExport :one
+UPDATE data_exports
+SET status = 'ready', file_path = $2, file_size = $3, completed_at = CURRENT_TIMESTAMP, expires_at = $4
+WHERE id = $1
+RETURNING id, user_id, status, file_path, file_size, error, requested_at, completed_at, expires_at
+`
+
+type CompleteDataExportParams struct {
+	ID        pgtype.UUID
+	FilePath  pgtype.Text
+	FileSize  int64
+	ExpiresAt pgtype.Timestamptz
+}
+
+func (q *Queries) CompleteDataExport(ctx context.Context, arg CompleteDataExportParams) (DataExport, error) {
+	row := q.db.QueryRow(ctx, completeDataExport,
+		arg.ID,
+		arg.FilePath,
+		arg.FileSize,
+		arg.ExpiresAt,
+	)
+	var i DataExport
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Status,
+		&i.FilePath,
+		&i.FileSize,
+		&i.Error,
+		&i.RequestedAt,
+		&i.CompletedAt,
+		&i.ExpiresAt,
+	)
+	return i, err
+}
+
+const countOrganizationOwners = `-- name: CountOrganizationOwners :one
+SELECT COUNT(*) FROM organization_members WHERE organization_id = $1 AND role = 'owner'
+`
+
+func (q *Queries) CountOrganizationOwners(ctx context.Context, organizationID pgtype.UUID) (int64, error) {
+	row := q.db.QueryRow(ctx, countOrganizationOwners, organizationID)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
+const countRecentShareAccessLogs = `-- name: CountRecentShareAccessLogs :one
+SELECT COUNT(*) FROM share_access_logs
+WHERE share_id = $1 AND action = $2 AND created_at > $3
+`
+
+type CountRecentShareAccessLogsParams struct {
+	ShareID   pgtype.UUID
+	Action    string
+	CreatedAt pgtype.Timestamptz
+}
+
+func (q *Queries) CountRecentShareAccessLogs(ctx context.Context, arg CountRecentShareAccessLogsParams) (int64, error) {
+	row := q.db.QueryRow(ctx, countRecentShareAccessLogs, arg.ShareID, arg.Action, arg.CreatedAt)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
+const countUnusedRecoveryCodes = `-- name: CountUnusedRecoveryCodes :one
+SELECT COUNT(*) FROM mfa_recovery_codes
+WHERE user_id = $1 AND used_at IS NULL
+`
+
+func (q *Queries) CountUnusedRecoveryCodes(ctx context.Context, userID pgtype.UUID) (int64, error) {
+	row := q.db.QueryRow(ctx, countUnusedRecoveryCodes, userID)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
+const countUserWebAuthnCredentials = `-- name: CountUserWebAuthnCredentials :one
+SELECT COUNT(*) FROM webauthn_credentials WHERE user_id = $1
+`
+
+func (q *Queries) CountUserWebAuthnCredentials(ctx context.Context, userID pgtype.UUID) (int64, error) {
+	row := q.db.QueryRow(ctx, countUserWebAuthnCredentials, userID)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
+const countWorkspaceDocuments = `-- name: CountWorkspaceDocuments :one
+SELECT COUNT(*) FROM documents WHERE workspace_id = $1
+`
+
+// Counts the documents in the trash as well, which still take up storage
+func (q *Queries) CountWorkspaceDocuments(ctx context.Context, workspaceID pgtype.UUID) (int64, error) {
+	row := q.db.QueryRow(ctx, countWorkspaceDocuments, workspaceID)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
+const createAPIKey = `-- name: CreateAPIKey :one
+INSERT INTO api_keys (user_id, name, key_prefix, key_hash, scopes, expires_at)
+VALUES ($1, $2, $3, $4, $5, $6)
+RETURNING id, user_id, name, key_prefix, key_hash, scopes, expires_at, last_used_at, last_used_ip, created_at
+`
+
+type CreateAPIKeyParams struct {
+	UserID    pgtype.UUID
+	Name      string
+	KeyPrefix string
+	KeyHash   string
+	Scopes    []string
+	ExpiresAt pgtype.Timestamptz
+}
+
+// API keys
+func (q *Queries) CreateAPIKey(ctx context.Context, arg CreateAPIKeyParams) (ApiKey, error) {
+	row := q.db.QueryRow(ctx, createAPIKey,
+		arg.UserID,
+		arg.Name,
+		arg.KeyPrefix,
+		arg.KeyHash,
+		arg.Scopes,
+		arg.ExpiresAt,
+	)
+	var i ApiKey
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Name,
+		&i.KeyPrefix,
+		&i.KeyHash,
+		&i.Scopes,
+		&i.ExpiresAt,
+		&i.LastUsedAt,
+		&i.LastUsedIp,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const createAccountToken = `-- name: CreateAccountToken :one
+INSERT INTO account_tokens (user_id, purpose, token_hash, expires_at)
+VALUES ($1, $2, $3, $4)
+RETURNING id, user_id, purpose, token_hash, expires_at, used_at, created_at
+`
+
+type CreateAccountTokenParams struct {
+	UserID    pgtype.UUID
+	Purpose   string
+	TokenHash string
+	ExpiresAt pgtype.Timestamptz
+}
+
+// Email verification and password reset tokens
+func (q *Queries) CreateAccountToken(ctx context.Context, arg CreateAccountTokenParams) (AccountToken, error) {
+	row := q.db.QueryRow(ctx, createAccountToken,
+		arg.UserID,
+		arg.Purpose,
+		arg.TokenHash,
+		arg.ExpiresAt,
+	)
+	var i AccountToken
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Purpose,
+		&i.TokenHash,
+		&i.ExpiresAt,
+		&i.UsedAt,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const createAuditEvent = `-- name: CreateAuditEvent :exec
+INSERT INTO audit_events (
+    seq, occurred_at, actor_id, actor_email, action, resource_type, resource_id,
+    ip_address, user_agent, details, prev_hash, hash
+)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+`
+
+type CreateAuditEventParams struct {
+	Seq          int64
+	OccurredAt   pgtype.Timestamptz
+	ActorID      pgtype.UUID
+	ActorEmail   string
+	Action       string
+	ResourceType string
+	ResourceID   string
+	IpAddress    *netip.Addr
+	UserAgent    string
+	Details      []byte
+	PrevHash     string
+	Hash         string
+}
+
+func (q *Queries) CreateAuditEvent(ctx context.Context, arg CreateAuditEventParams) error {
+	_, err := q.db.Exec(ctx, createAuditEvent,
+		arg.Seq,
+		arg.OccurredAt,
+		arg.ActorID,
+		arg.ActorEmail,
+		arg.Action,
+		arg.ResourceType,
+		arg.ResourceID,
+		arg.IpAddress,
+		arg.UserAgent,
+		arg.Details,
+		arg.PrevHash,
+		arg.Hash,
+	)
+	return err
+}
+
+const createDataExport = `-- name: CreateDataExport :one
+INSERT INTO data_exports (user_id)
+VALUES ($1)
+RETURNING id, user_id, status, file_path, file_size, error, requested_at, completed_at, expires_at
+`
+
+// Data subject requests
+func (q *Queries) CreateDataExport(ctx context.Context, userID pgtype.UUID) (DataExport, error) {
+	row := q.db.QueryRow(ctx, createDataExport, userID)
+	var i DataExport
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Status,
+		&i.FilePath,
+		&i.FileSize,
+		&i.Error,
+		&i.RequestedAt,
+		&i.CompletedAt,
+		&i.ExpiresAt,
+	)
+	return i, err
+}
+
 const createDocument = `-- name: CreateDocument :one
-INSERT INTO documents (user_id, filename, file_path, encrypted_key, file_size, mime_type, checksum)
-VALUES ($1, $2, $3, $4, $5, $6, $7)
-RETURNING id, user_id, filename, file_path, encrypted_key, file_size, mime_type, checksum, created_at, updated_at
+INSERT INTO documents (user_id, filename, file_path, encrypted_key, file_size, mime_type, checksum, folder_id, workspace_id)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+RETURNING id, user_id, filename, file_path, encrypted_key, file_size, mime_type, checksum, created_at, updated_at, folder_id, workspace_id, deleted_at, deleted_by
 `
 
 type CreateDocumentParams struct {
@@ -26,6 +529,8 @@ type CreateDocumentParams struct {
 	FileSize     int64
 	MimeType     string
 	Checksum     string
+	FolderID     pgtype.UUID
+	WorkspaceID  pgtype.UUID
 }
 
 // Documents
@@ -38,6 +543,8 @@ func (q *Queries) CreateDocument(ctx context.Context, arg CreateDocumentParams)
 		arg.FileSize,
 		arg.MimeType,
 		arg.Checksum,
+		arg.FolderID,
+		arg.WorkspaceID,
 	)
 	var i Document
 	err := row.Scan(
@@ -51,101 +558,4516 @@ func (q *Queries) CreateDocument(ctx context.Context, arg CreateDocumentParams)
 		&i.Checksum,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.FolderID,
+		&i.WorkspaceID,
+		&i.DeletedAt,
+		&i.DeletedBy,
 	)
 	return i, err
 }
 
-const createSession = `-- name: CreateSession :one
-INSERT INTO sessions (user_id, token, expires_at, ip_address, user_agent)
-VALUES ($1, $2, $3, $4, $5)
-RETURNING id, user_id, token, expires_at, created_at, ip_address, user_agent
+const createFileRequest = `-- name: CreateFileRequest :one
+INSERT INTO file_requests (user_id, request_token, title, message, expires_at, max_files, max_file_size, allowed_types, folder_id, workspace_id)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+RETURNING id, user_id, request_token, title, message, expires_at, max_files, max_file_size, allowed_types, upload_count, folder_id, created_at, workspace_id
 `
 
-type CreateSessionParams struct {
-	UserID    pgtype.UUID
-	Token     string
-	ExpiresAt pgtype.Timestamptz
-	IpAddress *netip.Addr
-	UserAgent pgtype.Text
+type CreateFileRequestParams struct {
+	UserID       pgtype.UUID
+	RequestToken string
+	Title        string
+	Message      pgtype.Text
+	ExpiresAt    pgtype.Timestamptz
+	MaxFiles     int32
+	MaxFileSize  int64
+	AllowedTypes pgtype.Text
+	FolderID     pgtype.UUID
+	WorkspaceID  pgtype.UUID
 }
 
-// Sessions
-func (q *Queries) CreateSession(ctx context.Context, arg CreateSessionParams) (Session, error) {
-	row := q.db.QueryRow(ctx, createSession,
+// File requests
+func (q *Queries) CreateFileRequest(ctx context.Context, arg CreateFileRequestParams) (FileRequest, error) {
+	row := q.db.QueryRow(ctx, createFileRequest,
 		arg.UserID,
-		arg.Token,
+		arg.RequestToken,
+		arg.Title,
+		arg.Message,
 		arg.ExpiresAt,
-		arg.IpAddress,
-		arg.UserAgent,
+		arg.MaxFiles,
+		arg.MaxFileSize,
+		arg.AllowedTypes,
+		arg.FolderID,
+		arg.WorkspaceID,
 	)
-	var i Session
+	var i FileRequest
 	err := row.Scan(
 		&i.ID,
 		&i.UserID,
-		&i.Token,
+		&i.RequestToken,
+		&i.Title,
+		&i.Message,
 		&i.ExpiresAt,
+		&i.MaxFiles,
+		&i.MaxFileSize,
+		&i.AllowedTypes,
+		&i.UploadCount,
+		&i.FolderID,
+		&i.CreatedAt,
+		&i.WorkspaceID,
+	)
+	return i, err
+}
+
+const createFileRequestUpload = `-- name: CreateFileRequestUpload :exec
+INSERT INTO file_request_uploads (file_request_id, document_id, uploader_name, uploader_email, ip_address)
+VALUES ($1, $2, $3, $4, $5)
+`
+
+type CreateFileRequestUploadParams struct {
+	FileRequestID pgtype.UUID
+	DocumentID    pgtype.UUID
+	UploaderName  pgtype.Text
+	UploaderEmail pgtype.Text
+	IpAddress     *netip.Addr
+}
+
+func (q *Queries) CreateFileRequestUpload(ctx context.Context, arg CreateFileRequestUploadParams) error {
+	_, err := q.db.Exec(ctx, createFileRequestUpload,
+		arg.FileRequestID,
+		arg.DocumentID,
+		arg.UploaderName,
+		arg.UploaderEmail,
+		arg.IpAddress,
+	)
+	return err
+}
+
+const createFolder = `-- name: CreateFolder :one
+INSERT INTO folders (user_id, parent_id, name, workspace_id)
+VALUES ($1, $2, $3, $4)
+RETURNING id, user_id, parent_id, name, created_at, updated_at, workspace_id
+`
+
+type CreateFolderParams struct {
+	UserID      pgtype.UUID
+	ParentID    pgtype.UUID
+	Name        string
+	WorkspaceID pgtype.UUID
+}
+
+// Folders
+func (q *Queries) CreateFolder(ctx context.Context, arg CreateFolderParams) (Folder, error) {
+	row := q.db.QueryRow(ctx, createFolder,
+		arg.UserID,
+		arg.ParentID,
+		arg.Name,
+		arg.WorkspaceID,
+	)
+	var i Folder
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.ParentID,
+		&i.Name,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.WorkspaceID,
+	)
+	return i, err
+}
+
+const createLegalHold = `-- name: CreateLegalHold :one
+INSERT INTO legal_holds (resource_type, resource_id, reason, custodian, placed_by)
+VALUES ($1, $2, $3, $4, $5)
+RETURNING id, resource_type, resource_id, reason, custodian, placed_by, placed_at, released_by, released_at, release_reason
+`
+
+type CreateLegalHoldParams struct {
+	ResourceType string
+	ResourceID   pgtype.UUID
+	Reason       string
+	Custodian    string
+	PlacedBy     pgtype.UUID
+}
+
+// Legal holds
+func (q *Queries) CreateLegalHold(ctx context.Context, arg CreateLegalHoldParams) (LegalHold, error) {
+	row := q.db.QueryRow(ctx, createLegalHold,
+		arg.ResourceType,
+		arg.ResourceID,
+		arg.Reason,
+		arg.Custodian,
+		arg.PlacedBy,
+	)
+	var i LegalHold
+	err := row.Scan(
+		&i.ID,
+		&i.ResourceType,
+		&i.ResourceID,
+		&i.Reason,
+		&i.Custodian,
+		&i.PlacedBy,
+		&i.PlacedAt,
+		&i.ReleasedBy,
+		&i.ReleasedAt,
+		&i.ReleaseReason,
+	)
+	return i, err
+}
+
+const createOIDCAuthRequest = `-- name: CreateOIDCAuthRequest :exec
+INSERT INTO oidc_auth_requests (state_hash, provider, code_verifier, nonce, expires_at)
+VALUES ($1, $2, $3, $4, $5)
+`
+
+type CreateOIDCAuthRequestParams struct {
+	StateHash    string
+	Provider     string
+	CodeVerifier string
+	Nonce        string
+	ExpiresAt    pgtype.Timestamptz
+}
+
+// OIDC authorization requests
+func (q *Queries) CreateOIDCAuthRequest(ctx context.Context, arg CreateOIDCAuthRequestParams) error {
+	_, err := q.db.Exec(ctx, createOIDCAuthRequest,
+		arg.StateHash,
+		arg.Provider,
+		arg.CodeVerifier,
+		arg.Nonce,
+		arg.ExpiresAt,
+	)
+	return err
+}
+
+const createOrganization = `-- name: CreateOrganization :one
+INSERT INTO organizations (name)
+VALUES ($1)
+RETURNING id, name, created_at, require_mfa
+`
+
+// Organizations
+func (q *Queries) CreateOrganization(ctx context.Context, name string) (Organization, error) {
+	row := q.db.QueryRow(ctx, createOrganization, name)
+	var i Organization
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.CreatedAt,
+		&i.RequireMfa,
+	)
+	return i, err
+}
+
+const createPersonalWorkspace = `-- name: CreatePersonalWorkspace :one
+INSERT INTO workspaces (personal_user_id, name)
+VALUES ($1, 'Personal')
+ON CONFLICT (personal_user_id) DO UPDATE SET name = workspaces.name
+RETURNING id, organization_id, personal_user_id, name, created_at
+`
+
+func (q *Queries) CreatePersonalWorkspace(ctx context.Context, personalUserID pgtype.UUID) (Workspace, error) {
+	row := q.db.QueryRow(ctx, createPersonalWorkspace, personalUserID)
+	var i Workspace
+	err := row.Scan(
+		&i.ID,
+		&i.OrganizationID,
+		&i.PersonalUserID,
+		&i.Name,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const createRecoveryCode = `-- name: CreateRecoveryCode :exec
+INSERT INTO mfa_recovery_codes (user_id, code_hash)
+VALUES ($1, $2)
+`
+
+type CreateRecoveryCodeParams struct {
+	UserID   pgtype.UUID
+	CodeHash string
+}
+
+// MFA recovery codes
+func (q *Queries) CreateRecoveryCode(ctx context.Context, arg CreateRecoveryCodeParams) error {
+	_, err := q.db.Exec(ctx, createRecoveryCode, arg.UserID, arg.CodeHash)
+	return err
+}
+
+const createRefreshToken = `-- name: CreateRefreshToken :one
+INSERT INTO refresh_tokens (session_id, token_hash, expires_at)
+VALUES ($1, $2, $3)
+RETURNING id, session_id, token_hash, expires_at, used_at, created_at
+`
+
+type CreateRefreshTokenParams struct {
+	SessionID pgtype.UUID
+	TokenHash string
+	ExpiresAt pgtype.Timestamptz
+}
+
+// Refresh tokens
+func (q *Queries) CreateRefreshToken(ctx context.Context, arg CreateRefreshTokenParams) (RefreshToken, error) {
+	row := q.db.QueryRow(ctx, createRefreshToken, arg.SessionID, arg.TokenHash, arg.ExpiresAt)
+	var i RefreshToken
+	err := row.Scan(
+		&i.ID,
+		&i.SessionID,
+		&i.TokenHash,
+		&i.ExpiresAt,
+		&i.UsedAt,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const createRetentionPolicy = `-- name: CreateRetentionPolicy :one
+INSERT INTO retention_policies (workspace_id, folder_id, tag, retain_months, retain_days, warn_days, created_by)
+VALUES ($1, $2, $3, $4, $5, $6, $7)
+RETURNING id, workspace_id, folder_id, tag, retain_months, retain_days, warn_days, created_by, created_at, updated_at
+`
+
+type CreateRetentionPolicyParams struct {
+	WorkspaceID  pgtype.UUID
+	FolderID     pgtype.UUID
+	Tag          pgtype.Text
+	RetainMonths int32
+	RetainDays   int32
+	WarnDays     int32
+	CreatedBy    pgtype.UUID
+}
+
+// Retention policies
+func (q *Queries) CreateRetentionPolicy(ctx context.Context, arg CreateRetentionPolicyParams) (RetentionPolicy, error) {
+	row := q.db.QueryRow(ctx, createRetentionPolicy,
+		arg.WorkspaceID,
+		arg.FolderID,
+		arg.Tag,
+		arg.RetainMonths,
+		arg.RetainDays,
+		arg.WarnDays,
+		arg.CreatedBy,
+	)
+	var i RetentionPolicy
+	err := row.Scan(
+		&i.ID,
+		&i.WorkspaceID,
+		&i.FolderID,
+		&i.Tag,
+		&i.RetainMonths,
+		&i.RetainDays,
+		&i.WarnDays,
+		&i.CreatedBy,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
+
+const createSession = `-- name: CreateSession :one
+INSERT INTO sessions (id, user_id, token, expires_at, ip_address, user_agent)
+VALUES ($1, $2, $3, $4, $5, $6)
+RETURNING id, user_id, token, expires_at, created_at, ip_address, user_agent, last_seen_at
+`
+
+type CreateSessionParams struct {
+	ID        pgtype.UUID
+	UserID    pgtype.UUID
+	Token     string
+	ExpiresAt pgtype.Timestamptz
+	IpAddress *netip.Addr
+	UserAgent pgtype.Text
+}
+
+// Sessions
+func (q *Queries) CreateSession(ctx context.Context, arg CreateSessionParams) (Session, error) {
+	row := q.db.QueryRow(ctx, createSession,
+		arg.ID,
+		arg.UserID,
+		arg.Token,
+		arg.ExpiresAt,
+		arg.IpAddress,
+		arg.UserAgent,
+	)
+	var i Session
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Token,
+		&i.ExpiresAt,
+		&i.CreatedAt,
+		&i.IpAddress,
+		&i.UserAgent,
+		&i.LastSeenAt,
+	)
+	return i, err
+}
+
+const createShare = `-- name: CreateShare :one
+INSERT INTO shares (
+    share_token, expires_at, max_access, password_hash, created_by, folder_id, name, view_only, allowed_cidrs,
+    notify_on_access, notify_on_limit, notify_password_failures, notify_expiring_hours
+)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+RETURNING id, share_token, expires_at, max_access, access_count, password_hash, created_at, created_by, folder_id, name, view_only, allowed_cidrs, notify_on_access, notify_on_limit, notify_password_failures, notify_expiring_hours, expiry_notified_at
+`
+
+type CreateShareParams struct {
+	ShareToken             string
+	ExpiresAt              pgtype.Timestamptz
+	MaxAccess              pgtype.Int4
+	PasswordHash           pgtype.Text
+	CreatedBy              pgtype.UUID
+	FolderID               pgtype.UUID
+	Name                   pgtype.Text
+	ViewOnly               bool
+	AllowedCidrs           []netip.Prefix
+	NotifyOnAccess         string
+	NotifyOnLimit          bool
+	NotifyPasswordFailures pgtype.Int4
+	NotifyExpiringHours    pgtype.Int4
+}
+
+// Shares
+func (q *Queries) CreateShare(ctx context.Context, arg CreateShareParams) (Share, error) {
+	row := q.db.QueryRow(ctx, createShare,
+		arg.ShareToken,
+		arg.ExpiresAt,
+		arg.MaxAccess,
+		arg.PasswordHash,
+		arg.CreatedBy,
+		arg.FolderID,
+		arg.Name,
+		arg.ViewOnly,
+		arg.AllowedCidrs,
+		arg.NotifyOnAccess,
+		arg.NotifyOnLimit,
+		arg.NotifyPasswordFailures,
+		arg.NotifyExpiringHours,
+	)
+	var i Share
+	err := row.Scan(
+		&i.ID,
+		&i.ShareToken,
+		&i.ExpiresAt,
+		&i.MaxAccess,
+		&i.AccessCount,
+		&i.PasswordHash,
+		&i.CreatedAt,
+		&i.CreatedBy,
+		&i.FolderID,
+		&i.Name,
+		&i.ViewOnly,
+		&i.AllowedCidrs,
+		&i.NotifyOnAccess,
+		&i.NotifyOnLimit,
+		&i.NotifyPasswordFailures,
+		&i.NotifyExpiringHours,
+		&i.ExpiryNotifiedAt,
+	)
+	return i, err
+}
+
+const createShareAccessLog = `-- name: CreateShareAccessLog :exec
+INSERT INTO share_access_logs (share_id, document_id, action, ip_address, user_agent)
+VALUES ($1, $2, $3, $4, $5)
+`
+
+type CreateShareAccessLogParams struct {
+	ShareID    pgtype.UUID
+	DocumentID pgtype.UUID
+	Action     string
+	IpAddress  *netip.Addr
+	UserAgent  pgtype.Text
+}
+
+func (q *Queries) CreateShareAccessLog(ctx context.Context, arg CreateShareAccessLogParams) error {
+	_, err := q.db.Exec(ctx, createShareAccessLog,
+		arg.ShareID,
+		arg.DocumentID,
+		arg.Action,
+		arg.IpAddress,
+		arg.UserAgent,
+	)
+	return err
+}
+
+const createTeam = `-- name: CreateTeam :one
+INSERT INTO teams (organization_id, name)
+VALUES ($1, $2)
+RETURNING id, organization_id, name, created_at
+`
+
+type CreateTeamParams struct {
+	OrganizationID pgtype.UUID
+	Name           string
+}
+
+// Teams
+func (q *Queries) CreateTeam(ctx context.Context, arg CreateTeamParams) (Team, error) {
+	row := q.db.QueryRow(ctx, createTeam, arg.OrganizationID, arg.Name)
+	var i Team
+	err := row.Scan(
+		&i.ID,
+		&i.OrganizationID,
+		&i.Name,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const createUser = `-- name: CreateUser :one
+INSERT INTO users (email, password_hash, full_name)
+VALUES ($1, $2, $3)
+RETURNING id, email, password_hash, full_name, created_at, updated_at, is_active, default_allowed_cidrs, is_admin, totp_secret, totp_enabled, totp_last_step, email_verified_at, failed_login_count, last_failed_login_at, locked_until, is_legal, delete_after, last_login_attempt_at
+`
+
+type CreateUserParams struct {
+	Email        string
+	PasswordHash string
+	FullName     string
+}
+
+// Users
+func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (User, error) {
+	row := q.db.QueryRow(ctx, createUser, arg.Email, arg.PasswordHash, arg.FullName)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.Email,
+		&i.PasswordHash,
+		&i.FullName,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.IsActive,
+		&i.DefaultAllowedCidrs,
+		&i.IsAdmin,
+		&i.TotpSecret,
+		&i.TotpEnabled,
+		&i.TotpLastStep,
+		&i.EmailVerifiedAt,
+		&i.FailedLoginCount,
+		&i.LastFailedLoginAt,
+		&i.LockedUntil,
+		&i.IsLegal,
+		&i.DeleteAfter,
+		&i.LastLoginAttemptAt,
+	)
+	return i, err
+}
+
+const createUserIdentity = `-- name: CreateUserIdentity :one
+INSERT INTO user_identities (user_id, provider, subject, email, last_login_at)
+VALUES ($1, $2, $3, $4, CURRENT_TIMESTAMP)
+RETURNING id, user_id, provider, subject, email, created_at, last_login_at
+`
+
+type CreateUserIdentityParams struct {
+	UserID   pgtype.UUID
+	Provider string
+	Subject  string
+	Email    string
+}
+
+func (q *Queries) CreateUserIdentity(ctx context.Context, arg CreateUserIdentityParams) (UserIdentity, error) {
+	row := q.db.QueryRow(ctx, createUserIdentity,
+		arg.UserID,
+		arg.Provider,
+		arg.Subject,
+		arg.Email,
+	)
+	var i UserIdentity
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Provider,
+		&i.Subject,
+		&i.Email,
+		&i.CreatedAt,
+		&i.LastLoginAt,
+	)
+	return i, err
+}
+
+const createWebAuthnChallenge = `-- name: CreateWebAuthnChallenge :one
+INSERT INTO webauthn_challenges (user_id, purpose, session_data, expires_at)
+VALUES ($1, $2, $3, $4)
+RETURNING id, user_id, purpose, session_data, expires_at, created_at
+`
+
+type CreateWebAuthnChallengeParams struct {
+	UserID      pgtype.UUID
+	Purpose     string
+	SessionData []byte
+	ExpiresAt   pgtype.Timestamptz
+}
+
+// WebAuthn challenges
+func (q *Queries) CreateWebAuthnChallenge(ctx context.Context, arg CreateWebAuthnChallengeParams) (WebauthnChallenge, error) {
+	row := q.db.QueryRow(ctx, createWebAuthnChallenge,
+		arg.UserID,
+		arg.Purpose,
+		arg.SessionData,
+		arg.ExpiresAt,
+	)
+	var i WebauthnChallenge
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Purpose,
+		&i.SessionData,
+		&i.ExpiresAt,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const createWebAuthnCredential = `-- name: CreateWebAuthnCredential :one
+INSERT INTO webauthn_credentials (user_id, credential_id, credential, name)
+VALUES ($1, $2, $3, $4)
+RETURNING id, user_id, credential_id, credential, name, created_at, last_used_at
+`
+
+type CreateWebAuthnCredentialParams struct {
+	UserID       pgtype.UUID
+	CredentialID []byte
+	Credential   []byte
+	Name         string
+}
+
+// WebAuthn credentials
+func (q *Queries) CreateWebAuthnCredential(ctx context.Context, arg CreateWebAuthnCredentialParams) (WebauthnCredential, error) {
+	row := q.db.QueryRow(ctx, createWebAuthnCredential,
+		arg.UserID,
+		arg.CredentialID,
+		arg.Credential,
+		arg.Name,
+	)
+	var i WebauthnCredential
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.CredentialID,
+		&i.Credential,
+		&i.Name,
+		&i.CreatedAt,
+		&i.LastUsedAt,
+	)
+	return i, err
+}
+
+const createWorkspace = `-- name: CreateWorkspace :one
+INSERT INTO workspaces (organization_id, name)
+VALUES ($1, $2)
+RETURNING id, organization_id, personal_user_id, name, created_at
+`
+
+type CreateWorkspaceParams struct {
+	OrganizationID pgtype.UUID
+	Name           string
+}
+
+// Workspaces
+func (q *Queries) CreateWorkspace(ctx context.Context, arg CreateWorkspaceParams) (Workspace, error) {
+	row := q.db.QueryRow(ctx, createWorkspace, arg.OrganizationID, arg.Name)
+	var i Workspace
+	err := row.Scan(
+		&i.ID,
+		&i.OrganizationID,
+		&i.PersonalUserID,
+		&i.Name,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const deleteAPIKey = `-- name: DeleteAPIKey :one
+DELETE FROM api_keys
+WHERE id = $1 AND user_id = $2
+RETURNING id, user_id, name, key_prefix, key_hash, scopes, expires_at, last_used_at, last_used_ip, created_at
+`
+
+type DeleteAPIKeyParams struct {
+	ID     pgtype.UUID
+	UserID pgtype.UUID
+}
+
+func (q *Queries) DeleteAPIKey(ctx context.Context, arg DeleteAPIKeyParams) (ApiKey, error) {
+	row := q.db.QueryRow(ctx, deleteAPIKey, arg.ID, arg.UserID)
+	var i ApiKey
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Name,
+		&i.KeyPrefix,
+		&i.KeyHash,
+		&i.Scopes,
+		&i.ExpiresAt,
+		&i.LastUsedAt,
+		&i.LastUsedIp,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const deleteAllUserSessions = `-- name: DeleteAllUserSessions :many
+DELETE FROM sessions
+WHERE user_id = $1
+RETURNING id
+`
+
+func (q *Queries) DeleteAllUserSessions(ctx context.Context, userID pgtype.UUID) ([]pgtype.UUID, error) {
+	rows, err := q.db.Query(ctx, deleteAllUserSessions, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []pgtype.UUID
+	for rows.Next() {
+		var id pgtype.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		items = append(items, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const deleteDataExport = `-- name: DeleteDataExport :exec
+DELETE FROM data_exports WHERE id = $1
+`
+
+func (q *Queries) DeleteDataExport(ctx context.Context, id pgtype.UUID) error {
+	_, err := q.db.Exec(ctx, deleteDataExport, id)
+	return err
+}
+
+const deleteDocument = `-- name: DeleteDocument :one
+DELETE FROM documents WHERE id = $1 AND workspace_id = $2
+RETURNING id, user_id, filename, file_path, encrypted_key, file_size, mime_type, checksum, created_at, updated_at, folder_id, workspace_id, deleted_at, deleted_by
+`
+
+type DeleteDocumentParams struct {
+	ID          pgtype.UUID
+	WorkspaceID pgtype.UUID
+}
+
+func (q *Queries) DeleteDocument(ctx context.Context, arg DeleteDocumentParams) (Document, error) {
+	row := q.db.QueryRow(ctx, deleteDocument, arg.ID, arg.WorkspaceID)
+	var i Document
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Filename,
+		&i.FilePath,
+		&i.EncryptedKey,
+		&i.FileSize,
+		&i.MimeType,
+		&i.Checksum,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.FolderID,
+		&i.WorkspaceID,
+		&i.DeletedAt,
+		&i.DeletedBy,
+	)
+	return i, err
+}
+
+const deleteExpiredAccountTokens = `-- name: DeleteExpiredAccountTokens :exec
+DELETE FROM account_tokens WHERE expires_at < CURRENT_TIMESTAMP
+`
+
+func (q *Queries) DeleteExpiredAccountTokens(ctx context.Context) error {
+	_, err := q.db.Exec(ctx, deleteExpiredAccountTokens)
+	return err
+}
+
+const deleteExpiredOIDCAuthRequests = `-- name: DeleteExpiredOIDCAuthRequests :exec
+DELETE FROM oidc_auth_requests WHERE expires_at < CURRENT_TIMESTAMP
+`
+
+func (q *Queries) DeleteExpiredOIDCAuthRequests(ctx context.Context) error {
+	_, err := q.db.Exec(ctx, deleteExpiredOIDCAuthRequests)
+	return err
+}
+
+const deleteExpiredSessions = `-- name: DeleteExpiredSessions :exec
+DELETE FROM sessions WHERE expires_at < CURRENT_TIMESTAMP
+`
+
+func (q *Queries) DeleteExpiredSessions(ctx context.Context) error {
+	_, err := q.db.Exec(ctx, deleteExpiredSessions)
+	return err
+}
+
+const deleteExpiredShares = `-- name: DeleteExpiredShares :exec
+DELETE FROM shares WHERE expires_at < CURRENT_TIMESTAMP
+`
+
+func (q *Queries) DeleteExpiredShares(ctx context.Context) error {
+	_, err := q.db.Exec(ctx, deleteExpiredShares)
+	return err
+}
+
+const deleteExpiredWebAuthnChallenges = `-- name: DeleteExpiredWebAuthnChallenges :exec
+DELETE FROM webauthn_challenges WHERE expires_at < CURRENT_TIMESTAMP
+`
+
+func (q *Queries) DeleteExpiredWebAuthnChallenges(ctx context.Context) error {
+	_, err := q.db.Exec(ctx, deleteExpiredWebAuthnChallenges)
+	return err
+}
+
+const deleteFileRequest = `-- name: DeleteFileRequest :exec
+DELETE FROM file_requests WHERE id = $1 AND user_id = $2
+`
+
+type DeleteFileRequestParams struct {
+	ID     pgtype.UUID
+	UserID pgtype.UUID
+}
+
+func (q *Queries) DeleteFileRequest(ctx context.Context, arg DeleteFileRequestParams) error {
+	_, err := q.db.Exec(ctx, deleteFileRequest, arg.ID, arg.UserID)
+	return err
+}
+
+const deleteFolder = `-- name: DeleteFolder :exec
+DELETE FROM folders WHERE id = $1 AND workspace_id = $2
+`
+
+type DeleteFolderParams struct {
+	ID          pgtype.UUID
+	WorkspaceID pgtype.UUID
+}
+
+func (q *Queries) DeleteFolder(ctx context.Context, arg DeleteFolderParams) error {
+	_, err := q.db.Exec(ctx, deleteFolder, arg.ID, arg.WorkspaceID)
+	return err
+}
+
+const deleteOtherUserSessions = `-- name: DeleteOtherUserSessions :many
+DELETE FROM sessions
+WHERE user_id = $1 AND id <> $2
+RETURNING id
+`
+
+type DeleteOtherUserSessionsParams struct {
+	UserID pgtype.UUID
+	ID     pgtype.UUID
+}
+
+func (q *Queries) DeleteOtherUserSessions(ctx context.Context, arg DeleteOtherUserSessionsParams) ([]pgtype.UUID, error) {
+	rows, err := q.db.Query(ctx, deleteOtherUserSessions, arg.UserID, arg.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []pgtype.UUID
+	for rows.Next() {
+		var id pgtype.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		items = append(items, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const deleteRetentionPolicy = `-- name: DeleteRetentionPolicy :one
+DELETE FROM retention_policies WHERE id = $1 AND workspace_id = $2
+RETURNING id, workspace_id, folder_id, tag, retain_months, retain_days, warn_days, created_by, created_at, updated_at
+`
+
+type DeleteRetentionPolicyParams struct {
+	ID          pgtype.UUID
+	WorkspaceID pgtype.UUID
+}
+
+func (q *Queries) DeleteRetentionPolicy(ctx context.Context, arg DeleteRetentionPolicyParams) (RetentionPolicy, error) {
+	row := q.db.QueryRow(ctx, deleteRetentionPolicy, arg.ID, arg.WorkspaceID)
+	var i RetentionPolicy
+	err := row.Scan(
+		&i.ID,
+		&i.WorkspaceID,
+		&i.FolderID,
+		&i.Tag,
+		&i.RetainMonths,
+		&i.RetainDays,
+		&i.WarnDays,
+		&i.CreatedBy,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
+
+const deleteSession = `-- name: DeleteSession :exec
+DELETE FROM sessions WHERE id = $1
+`
+
+func (q *Queries) DeleteSession(ctx context.Context, id pgtype.UUID) error {
+	_, err := q.db.Exec(ctx, deleteSession, id)
+	return err
+}
+
+const deleteShare = `-- name: DeleteShare :exec
+DELETE FROM shares WHERE id = $1 AND created_by = $2
+`
+
+type DeleteShareParams struct {
+	ID        pgtype.UUID
+	CreatedBy pgtype.UUID
+}
+
+func (q *Queries) DeleteShare(ctx context.Context, arg DeleteShareParams) error {
+	_, err := q.db.Exec(ctx, deleteShare, arg.ID, arg.CreatedBy)
+	return err
+}
+
+const deleteTeam = `-- name: DeleteTeam :execrows
+DELETE FROM teams WHERE id = $1 AND organization_id = $2
+`
+
+type DeleteTeamParams struct {
+	ID             pgtype.UUID
+	OrganizationID pgtype.UUID
+}
+
+func (q *Queries) DeleteTeam(ctx context.Context, arg DeleteTeamParams) (int64, error) {
+	result, err := q.db.Exec(ctx, deleteTeam, arg.ID, arg.OrganizationID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const deleteUser = `-- name: DeleteUser :exec
+DELETE FROM users WHERE id = $1
+`
+
+func (q *Queries) DeleteUser(ctx context.Context, id pgtype.UUID) error {
+	_, err := q.db.Exec(ctx, deleteUser, id)
+	return err
+}
+
+const deleteUserAccountTokens = `-- name: DeleteUserAccountTokens :exec
+DELETE FROM account_tokens
+WHERE user_id = $1 AND purpose = $2
+`
+
+type DeleteUserAccountTokensParams struct {
+	UserID  pgtype.UUID
+	Purpose string
+}
+
+func (q *Queries) DeleteUserAccountTokens(ctx context.Context, arg DeleteUserAccountTokensParams) error {
+	_, err := q.db.Exec(ctx, deleteUserAccountTokens, arg.UserID, arg.Purpose)
+	return err
+}
+
+const deleteUserRecoveryCodes = `-- name: DeleteUserRecoveryCodes :exec
+DELETE FROM mfa_recovery_codes WHERE user_id = $1
+`
+
+func (q *Queries) DeleteUserRecoveryCodes(ctx context.Context, userID pgtype.UUID) error {
+	_, err := q.db.Exec(ctx, deleteUserRecoveryCodes, userID)
+	return err
+}
+
+const deleteUserSession = `-- name: DeleteUserSession :execrows
+DELETE FROM sessions WHERE id = $1 AND user_id = $2
+`
+
+type DeleteUserSessionParams struct {
+	ID     pgtype.UUID
+	UserID pgtype.UUID
+}
+
+func (q *Queries) DeleteUserSession(ctx context.Context, arg DeleteUserSessionParams) (int64, error) {
+	result, err := q.db.Exec(ctx, deleteUserSession, arg.ID, arg.UserID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const deleteUserShares = `-- name: DeleteUserShares :many
+DELETE FROM shares
+WHERE created_by = $1
+RETURNING share_token
+`
+
+func (q *Queries) DeleteUserShares(ctx context.Context, userID pgtype.UUID) ([]string, error) {
+	rows, err := q.db.Query(ctx, deleteUserShares, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []string
+	for rows.Next() {
+		var shareToken string
+		if err := rows.Scan(&shareToken); err != nil {
+			return nil, err
+		}
+		items = append(items, shareToken)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const deleteUserWebAuthnCredentials = `-- name: DeleteUserWebAuthnCredentials :execrows
+DELETE FROM webauthn_credentials WHERE user_id = $1
+`
+
+func (q *Queries) DeleteUserWebAuthnCredentials(ctx context.Context, userID pgtype.UUID) (int64, error) {
+	result, err := q.db.Exec(ctx, deleteUserWebAuthnCredentials, userID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const deleteWebAuthnCredential = `-- name: DeleteWebAuthnCredential :execrows
+DELETE FROM webauthn_credentials WHERE id = $1 AND user_id = $2
+`
+
+type DeleteWebAuthnCredentialParams struct {
+	ID     pgtype.UUID
+	UserID pgtype.UUID
+}
+
+func (q *Queries) DeleteWebAuthnCredential(ctx context.Context, arg DeleteWebAuthnCredentialParams) (int64, error) {
+	result, err := q.db.Exec(ctx, deleteWebAuthnCredential, arg.ID, arg.UserID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const deleteWorkspace = `-- name: DeleteWorkspace :execrows
+DELETE FROM workspaces WHERE id = $1 AND organization_id IS NOT NULL
+`
+
+func (q *Queries) DeleteWorkspace(ctx context.Context, id pgtype.UUID) (int64, error) {
+	result, err := q.db.Exec(ctx, deleteWorkspace, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const disableUserTOTP = `-- name: DisableUserTOTP :one
+UPDATE users
+SET totp_secret = NULL, totp_enabled = FALSE, totp_last_step = 0, updated_at = CURRENT_TIMESTAMP
+WHERE id = $1
+RETURNING id, email, password_hash, full_name, created_at, updated_at, is_active, default_allowed_cidrs, is_admin, totp_secret, totp_enabled, totp_last_step, email_verified_at, failed_login_count, last_failed_login_at, locked_until, is_legal, delete_after, last_login_attempt_at
+`
+
+func (q *Queries) DisableUserTOTP(ctx context.Context, id pgtype.UUID) (User, error) {
+	row := q.db.QueryRow(ctx, disableUserTOTP, id)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.Email,
+		&i.PasswordHash,
+		&i.FullName,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.IsActive,
+		&i.DefaultAllowedCidrs,
+		&i.IsAdmin,
+		&i.TotpSecret,
+		&i.TotpEnabled,
+		&i.TotpLastStep,
+		&i.EmailVerifiedAt,
+		&i.FailedLoginCount,
+		&i.LastFailedLoginAt,
+		&i.LockedUntil,
+		&i.IsLegal,
+		&i.DeleteAfter,
+		&i.LastLoginAttemptAt,
+	)
+	return i, err
+}
+
+const enableUserTOTP = `-- name: EnableUserTOTP :one
+UPDATE users
+SET totp_enabled = TRUE, updated_at = CURRENT_TIMESTAMP
+WHERE id = $1 AND totp_secret IS NOT NULL
+RETURNING id, email, password_hash, full_name, created_at, updated_at, is_active, default_allowed_cidrs, is_admin, totp_secret, totp_enabled, totp_last_step, email_verified_at, failed_login_count, last_failed_login_at, locked_until, is_legal, delete_after, last_login_attempt_at
+`
+
+func (q *Queries) EnableUserTOTP(ctx context.Context, id pgtype.UUID) (User, error) {
+	row := q.db.QueryRow(ctx, enableUserTOTP, id)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.Email,
+		&i.PasswordHash,
+		&i.FullName,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.IsActive,
+		&i.DefaultAllowedCidrs,
+		&i.IsAdmin,
+		&i.TotpSecret,
+		&i.TotpEnabled,
+		&i.TotpLastStep,
+		&i.EmailVerifiedAt,
+		&i.FailedLoginCount,
+		&i.LastFailedLoginAt,
+		&i.LockedUntil,
+		&i.IsLegal,
+		&i.DeleteAfter,
+		&i.LastLoginAttemptAt,
+	)
+	return i, err
+}
+
+const exportAuditEvents = `-- name: ExportAuditEvents :many
+SELECT seq, occurred_at, actor_id, actor_email, action, resource_type, resource_id, ip_address, user_agent, details, prev_hash, hash FROM audit_events
+WHERE seq > $1
+  AND occurred_at >= $2 AND occurred_at < $3
+  AND ($4::text = '' OR action = $4::text OR action LIKE $4::text || '.%')
+  AND ($5::text = '' OR actor_email = $5::text)
+  AND ($6::text = '' OR resource_type = $6::text)
+  AND ($7::text = '' OR resource_id = $7::text)
+ORDER BY seq
+LIMIT $8
+`
+
+type ExportAuditEventsParams struct {
+	Seq          int64
+	From         pgtype.Timestamptz
+	To           pgtype.Timestamptz
+	Action       string
+	ActorEmail   string
+	ResourceType string
+	ResourceID   string
+	Limit        int32
+}
+
+func (q *Queries) ExportAuditEvents(ctx context.Context, arg ExportAuditEventsParams) ([]AuditEvent, error) {
+	rows, err := q.db.Query(ctx, exportAuditEvents,
+		arg.Seq,
+		arg.From,
+		arg.To,
+		arg.Action,
+		arg.ActorEmail,
+		arg.ResourceType,
+		arg.ResourceID,
+		arg.Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []AuditEvent
+	for rows.Next() {
+		var i AuditEvent
+		if err := rows.Scan(
+			&i.Seq,
+			&i.OccurredAt,
+			&i.ActorID,
+			&i.ActorEmail,
+			&i.Action,
+			&i.ResourceType,
+			&i.ResourceID,
+			&i.IpAddress,
+			&i.UserAgent,
+			&i.Details,
+			&i.PrevHash,
+			&i.Hash,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const failDataExport = `-- name: FailDataExport :exec
+UPDATE data_exports
+SET status = 'failed', error = $2, completed_at = CURRENT_TIMESTAMP
+WHERE id = $1
+`
+
+type FailDataExportParams struct {
+	ID    pgtype.UUID
+	Error pgtype.Text
+}
+
+func (q *Queries) FailDataExport(ctx context.Context, arg FailDataExportParams) error {
+	_, err := q.db.Exec(ctx, failDataExport, arg.ID, arg.Error)
+	return err
+}
+
+const getAPIKeyByHash = `-- name: GetAPIKeyByHash :one
+SELECT id, user_id, name, key_prefix, key_hash, scopes, expires_at, last_used_at, last_used_ip, created_at FROM api_keys WHERE key_hash = $1
+`
+
+func (q *Queries) GetAPIKeyByHash(ctx context.Context, keyHash string) (ApiKey, error) {
+	row := q.db.QueryRow(ctx, getAPIKeyByHash, keyHash)
+	var i ApiKey
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Name,
+		&i.KeyPrefix,
+		&i.KeyHash,
+		&i.Scopes,
+		&i.ExpiresAt,
+		&i.LastUsedAt,
+		&i.LastUsedIp,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const getDataExport = `-- name: GetDataExport :one
+SELECT id, user_id, status, file_path, file_size, error, requested_at, completed_at, expires_at FROM data_exports WHERE id = $1 AND user_id = $2
+`
+
+type GetDataExportParams struct {
+	ID     pgtype.UUID
+	UserID pgtype.UUID
+}
+
+func (q *Queries) GetDataExport(ctx context.Context, arg GetDataExportParams) (DataExport, error) {
+	row := q.db.QueryRow(ctx, getDataExport, arg.ID, arg.UserID)
+	var i DataExport
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Status,
+		&i.FilePath,
+		&i.FileSize,
+		&i.Error,
+		&i.RequestedAt,
+		&i.CompletedAt,
+		&i.ExpiresAt,
+	)
+	return i, err
+}
+
+const getDocumentByID = `-- name: GetDocumentByID :one
+SELECT id, user_id, filename, file_path, encrypted_key, file_size, mime_type, checksum, created_at, updated_at, folder_id, workspace_id, deleted_at, deleted_by FROM documents WHERE id = $1 AND deleted_at IS NULL
+`
+
+// Documents in the trash are left out of every query but the trash's own
+func (q *Queries) GetDocumentByID(ctx context.Context, id pgtype.UUID) (Document, error) {
+	row := q.db.QueryRow(ctx, getDocumentByID, id)
+	var i Document
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Filename,
+		&i.FilePath,
+		&i.EncryptedKey,
+		&i.FileSize,
+		&i.MimeType,
+		&i.Checksum,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.FolderID,
+		&i.WorkspaceID,
+		&i.DeletedAt,
+		&i.DeletedBy,
+	)
+	return i, err
+}
+
+const getDocumentGrant = `-- name: GetDocumentGrant :one
+SELECT g.permission FROM document_grants g
+WHERE g.document_id = $1
+  AND (g.user_id = $2 OR g.team_id IN (SELECT tm.team_id FROM team_members tm WHERE tm.user_id = $2))
+ORDER BY g.permission = 'edit' DESC
+LIMIT 1
+`
+
+type GetDocumentGrantParams struct {
+	DocumentID pgtype.UUID
+	UserID     pgtype.UUID
+}
+
+func (q *Queries) GetDocumentGrant(ctx context.Context, arg GetDocumentGrantParams) (string, error) {
+	row := q.db.QueryRow(ctx, getDocumentGrant, arg.DocumentID, arg.UserID)
+	var permission string
+	err := row.Scan(&permission)
+	return permission, err
+}
+
+const getFileRequestByID = `-- name: GetFileRequestByID :one
+SELECT id, user_id, request_token, title, message, expires_at, max_files, max_file_size, allowed_types, upload_count, folder_id, created_at, workspace_id FROM file_requests WHERE id = $1
+`
+
+func (q *Queries) GetFileRequestByID(ctx context.Context, id pgtype.UUID) (FileRequest, error) {
+	row := q.db.QueryRow(ctx, getFileRequestByID, id)
+	var i FileRequest
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.RequestToken,
+		&i.Title,
+		&i.Message,
+		&i.ExpiresAt,
+		&i.MaxFiles,
+		&i.MaxFileSize,
+		&i.AllowedTypes,
+		&i.UploadCount,
+		&i.FolderID,
+		&i.CreatedAt,
+		&i.WorkspaceID,
+	)
+	return i, err
+}
+
+const getFileRequestByToken = `-- name: GetFileRequestByToken :one
+SELECT id, user_id, request_token, title, message, expires_at, max_files, max_file_size, allowed_types, upload_count, folder_id, created_at, workspace_id FROM file_requests WHERE request_token = $1
+`
+
+func (q *Queries) GetFileRequestByToken(ctx context.Context, requestToken string) (FileRequest, error) {
+	row := q.db.QueryRow(ctx, getFileRequestByToken, requestToken)
+	var i FileRequest
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.RequestToken,
+		&i.Title,
+		&i.Message,
+		&i.ExpiresAt,
+		&i.MaxFiles,
+		&i.MaxFileSize,
+		&i.AllowedTypes,
+		&i.UploadCount,
+		&i.FolderID,
+		&i.CreatedAt,
+		&i.WorkspaceID,
+	)
+	return i, err
+}
+
+const getFolderByID = `-- name: GetFolderByID :one
+SELECT id, user_id, parent_id, name, created_at, updated_at, workspace_id FROM folders WHERE id = $1
+`
+
+func (q *Queries) GetFolderByID(ctx context.Context, id pgtype.UUID) (Folder, error) {
+	row := q.db.QueryRow(ctx, getFolderByID, id)
+	var i Folder
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.ParentID,
+		&i.Name,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.WorkspaceID,
+	)
+	return i, err
+}
+
+const getLastAuditEvent = `-- name: GetLastAuditEvent :one
+SELECT seq, hash FROM audit_events ORDER BY seq DESC LIMIT 1
+`
+
+type GetLastAuditEventRow struct {
+	Seq  int64
+	Hash string
+}
+
+func (q *Queries) GetLastAuditEvent(ctx context.Context) (GetLastAuditEventRow, error) {
+	row := q.db.QueryRow(ctx, getLastAuditEvent)
+	var i GetLastAuditEventRow
+	err := row.Scan(&i.Seq, &i.Hash)
+	return i, err
+}
+
+const getLegalHold = `-- name: GetLegalHold :one
+SELECT id, resource_type, resource_id, reason, custodian, placed_by, placed_at, released_by, released_at, release_reason FROM legal_holds WHERE id = $1
+`
+
+func (q *Queries) GetLegalHold(ctx context.Context, id pgtype.UUID) (LegalHold, error) {
+	row := q.db.QueryRow(ctx, getLegalHold, id)
+	var i LegalHold
+	err := row.Scan(
+		&i.ID,
+		&i.ResourceType,
+		&i.ResourceID,
+		&i.Reason,
+		&i.Custodian,
+		&i.PlacedBy,
+		&i.PlacedAt,
+		&i.ReleasedBy,
+		&i.ReleasedAt,
+		&i.ReleaseReason,
+	)
+	return i, err
+}
+
+const getOrganizationByID = `-- name: GetOrganizationByID :one
+SELECT id, name, created_at, require_mfa FROM organizations WHERE id = $1
+`
+
+func (q *Queries) GetOrganizationByID(ctx context.Context, id pgtype.UUID) (Organization, error) {
+	row := q.db.QueryRow(ctx, getOrganizationByID, id)
+	var i Organization
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.CreatedAt,
+		&i.RequireMfa,
+	)
+	return i, err
+}
+
+const getOrganizationRole = `-- name: GetOrganizationRole :one
+SELECT role FROM organization_members WHERE organization_id = $1 AND user_id = $2
+`
+
+type GetOrganizationRoleParams struct {
+	OrganizationID pgtype.UUID
+	UserID         pgtype.UUID
+}
+
+func (q *Queries) GetOrganizationRole(ctx context.Context, arg GetOrganizationRoleParams) (string, error) {
+	row := q.db.QueryRow(ctx, getOrganizationRole, arg.OrganizationID, arg.UserID)
+	var role string
+	err := row.Scan(&role)
+	return role, err
+}
+
+const getOrganizationStorage = `-- name: GetOrganizationStorage :one
+SELECT id, user_id, organization_id, plan, quota_bytes, quota_documents, used_bytes, document_count, updated_at FROM storage_usage WHERE organization_id = $1
+`
+
+func (q *Queries) GetOrganizationStorage(ctx context.Context, organizationID pgtype.UUID) (StorageUsage, error) {
+	row := q.db.QueryRow(ctx, getOrganizationStorage, organizationID)
+	var i StorageUsage
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.OrganizationID,
+		&i.Plan,
+		&i.QuotaBytes,
+		&i.QuotaDocuments,
+		&i.UsedBytes,
+		&i.DocumentCount,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
+
+const getPersonalWorkspace = `-- name: GetPersonalWorkspace :one
+SELECT id, organization_id, personal_user_id, name, created_at FROM workspaces WHERE personal_user_id = $1
+`
+
+func (q *Queries) GetPersonalWorkspace(ctx context.Context, personalUserID pgtype.UUID) (Workspace, error) {
+	row := q.db.QueryRow(ctx, getPersonalWorkspace, personalUserID)
+	var i Workspace
+	err := row.Scan(
+		&i.ID,
+		&i.OrganizationID,
+		&i.PersonalUserID,
+		&i.Name,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const getRefreshTokenByHash = `-- name: GetRefreshTokenByHash :one
+SELECT id, session_id, token_hash, expires_at, used_at, created_at FROM refresh_tokens WHERE token_hash = $1
+`
+
+func (q *Queries) GetRefreshTokenByHash(ctx context.Context, tokenHash string) (RefreshToken, error) {
+	row := q.db.QueryRow(ctx, getRefreshTokenByHash, tokenHash)
+	var i RefreshToken
+	err := row.Scan(
+		&i.ID,
+		&i.SessionID,
+		&i.TokenHash,
+		&i.ExpiresAt,
+		&i.UsedAt,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const getRetentionDocument = `-- name: GetRetentionDocument :one
+SELECT d.id, d.user_id, d.filename, d.folder_id, d.created_at,
+       COALESCE(array_agg(t.tag) FILTER (WHERE t.tag IS NOT NULL), '{}')::text[] AS tags,
+       n.due_at AS notice_due_at, n.delete_at AS notice_delete_at,
+       document_held(d.id) AS held
+FROM documents d
+LEFT JOIN document_tags t ON t.document_id = d.id
+LEFT JOIN retention_notices n ON n.document_id = d.id
+WHERE d.id = $1
+GROUP BY d.id, n.document_id
+`
+
+type GetRetentionDocumentRow struct {
+	ID             pgtype.UUID
+	UserID         pgtype.UUID
+	Filename       string
+	FolderID       pgtype.UUID
+	CreatedAt      pgtype.Timestamptz
+	Tags           []string
+	NoticeDueAt    pgtype.Timestamptz
+	NoticeDeleteAt pgtype.Timestamptz
+	Held           bool
+}
+
+// A document like ListRetentionDocuments returns them, also if it is in
+// the trash
+func (q *Queries) GetRetentionDocument(ctx context.Context, id pgtype.UUID) (GetRetentionDocumentRow, error) {
+	row := q.db.QueryRow(ctx, getRetentionDocument, id)
+	var i GetRetentionDocumentRow
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Filename,
+		&i.FolderID,
+		&i.CreatedAt,
+		&i.Tags,
+		&i.NoticeDueAt,
+		&i.NoticeDeleteAt,
+		&i.Held,
+	)
+	return i, err
+}
+
+const getSessionByID = `-- name: GetSessionByID :one
+SELECT id, user_id, token, expires_at, created_at, ip_address, user_agent, last_seen_at FROM sessions WHERE id = $1
+`
+
+func (q *Queries) GetSessionByID(ctx context.Context, id pgtype.UUID) (Session, error) {
+	row := q.db.QueryRow(ctx, getSessionByID, id)
+	var i Session
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Token,
+		&i.ExpiresAt,
+		&i.CreatedAt,
+		&i.IpAddress,
+		&i.UserAgent,
+		&i.LastSeenAt,
+	)
+	return i, err
+}
+
+const getSessionByToken = `-- name: GetSessionByToken :one
+SELECT id, user_id, token, expires_at, created_at, ip_address, user_agent, last_seen_at FROM sessions WHERE token = $1
+`
+
+func (q *Queries) GetSessionByToken(ctx context.Context, token string) (Session, error) {
+	row := q.db.QueryRow(ctx, getSessionByToken, token)
+	var i Session
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Token,
+		&i.ExpiresAt,
+		&i.CreatedAt,
+		&i.IpAddress,
+		&i.UserAgent,
+		&i.LastSeenAt,
+	)
+	return i, err
+}
+
+const getShareByID = `-- name: GetShareByID :one
+SELECT id, share_token, expires_at, max_access, access_count, password_hash, created_at, created_by, folder_id, name, view_only, allowed_cidrs, notify_on_access, notify_on_limit, notify_password_failures, notify_expiring_hours, expiry_notified_at FROM shares WHERE id = $1
+`
+
+func (q *Queries) GetShareByID(ctx context.Context, id pgtype.UUID) (Share, error) {
+	row := q.db.QueryRow(ctx, getShareByID, id)
+	var i Share
+	err := row.Scan(
+		&i.ID,
+		&i.ShareToken,
+		&i.ExpiresAt,
+		&i.MaxAccess,
+		&i.AccessCount,
+		&i.PasswordHash,
+		&i.CreatedAt,
+		&i.CreatedBy,
+		&i.FolderID,
+		&i.Name,
+		&i.ViewOnly,
+		&i.AllowedCidrs,
+		&i.NotifyOnAccess,
+		&i.NotifyOnLimit,
+		&i.NotifyPasswordFailures,
+		&i.NotifyExpiringHours,
+		&i.ExpiryNotifiedAt,
+	)
+	return i, err
+}
+
+const getShareByToken = `-- name: GetShareByToken :one
+SELECT id, share_token, expires_at, max_access, access_count, password_hash, created_at, created_by, folder_id, name, view_only, allowed_cidrs, notify_on_access, notify_on_limit, notify_password_failures, notify_expiring_hours, expiry_notified_at FROM shares WHERE share_token = $1
+`
+
+func (q *Queries) GetShareByToken(ctx context.Context, shareToken string) (Share, error) {
+	row := q.db.QueryRow(ctx, getShareByToken, shareToken)
+	var i Share
+	err := row.Scan(
+		&i.ID,
+		&i.ShareToken,
+		&i.ExpiresAt,
+		&i.MaxAccess,
+		&i.AccessCount,
+		&i.PasswordHash,
+		&i.CreatedAt,
+		&i.CreatedBy,
+		&i.FolderID,
+		&i.Name,
+		&i.ViewOnly,
+		&i.AllowedCidrs,
+		&i.NotifyOnAccess,
+		&i.NotifyOnLimit,
+		&i.NotifyPasswordFailures,
+		&i.NotifyExpiringHours,
+		&i.ExpiryNotifiedAt,
+	)
+	return i, err
+}
+
+const getStorageTotals = `-- name: GetStorageTotals :one
+SELECT COUNT(*) AS document_count, COALESCE(SUM(file_size), 0)::bigint AS storage_bytes
+FROM documents
+`
+
+type GetStorageTotalsRow struct {
+	DocumentCount int64
+	StorageBytes  int64
+}
+
+func (q *Queries) GetStorageTotals(ctx context.Context) (GetStorageTotalsRow, error) {
+	row := q.db.QueryRow(ctx, getStorageTotals)
+	var i GetStorageTotalsRow
+	err := row.Scan(&i.DocumentCount, &i.StorageBytes)
+	return i, err
+}
+
+const getTeamByID = `-- name: GetTeamByID :one
+SELECT id, organization_id, name, created_at FROM teams WHERE id = $1
+`
+
+func (q *Queries) GetTeamByID(ctx context.Context, id pgtype.UUID) (Team, error) {
+	row := q.db.QueryRow(ctx, getTeamByID, id)
+	var i Team
+	err := row.Scan(
+		&i.ID,
+		&i.OrganizationID,
+		&i.Name,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const getTrashedDocument = `-- name: GetTrashedDocument :one
+SELECT id, user_id, filename, file_path, encrypted_key, file_size, mime_type, checksum, created_at, updated_at, folder_id, workspace_id, deleted_at, deleted_by FROM documents WHERE id = $1 AND deleted_at IS NOT NULL
+`
+
+func (q *Queries) GetTrashedDocument(ctx context.Context, id pgtype.UUID) (Document, error) {
+	row := q.db.QueryRow(ctx, getTrashedDocument, id)
+	var i Document
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Filename,
+		&i.FilePath,
+		&i.EncryptedKey,
+		&i.FileSize,
+		&i.MimeType,
+		&i.Checksum,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.FolderID,
+		&i.WorkspaceID,
+		&i.DeletedAt,
+		&i.DeletedBy,
+	)
+	return i, err
+}
+
+const getUserByEmail = `-- name: GetUserByEmail :one
+SELECT id, email, password_hash, full_name, created_at, updated_at, is_active, default_allowed_cidrs, is_admin, totp_secret, totp_enabled, totp_last_step, email_verified_at, failed_login_count, last_failed_login_at, locked_until, is_legal, delete_after, last_login_attempt_at FROM users WHERE email = $1
+`
+
+func (q *Queries) GetUserByEmail(ctx context.Context, email string) (User, error) {
+	row := q.db.QueryRow(ctx, getUserByEmail, email)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.Email,
+		&i.PasswordHash,
+		&i.FullName,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.IsActive,
+		&i.DefaultAllowedCidrs,
+		&i.IsAdmin,
+		&i.TotpSecret,
+		&i.TotpEnabled,
+		&i.TotpLastStep,
+		&i.EmailVerifiedAt,
+		&i.FailedLoginCount,
+		&i.LastFailedLoginAt,
+		&i.LockedUntil,
+		&i.IsLegal,
+		&i.DeleteAfter,
+		&i.LastLoginAttemptAt,
+	)
+	return i, err
+}
+
+const getUserByID = `-- name: GetUserByID :one
+SELECT id, email, password_hash, full_name, created_at, updated_at, is_active, default_allowed_cidrs, is_admin, totp_secret, totp_enabled, totp_last_step, email_verified_at, failed_login_count, last_failed_login_at, locked_until, is_legal, delete_after, last_login_attempt_at FROM users WHERE id = $1
+`
+
+func (q *Queries) GetUserByID(ctx context.Context, id pgtype.UUID) (User, error) {
+	row := q.db.QueryRow(ctx, getUserByID, id)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.Email,
+		&i.PasswordHash,
+		&i.FullName,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.IsActive,
+		&i.DefaultAllowedCidrs,
+		&i.IsAdmin,
+		&i.TotpSecret,
+		&i.TotpEnabled,
+		&i.TotpLastStep,
+		&i.EmailVerifiedAt,
+		&i.FailedLoginCount,
+		&i.LastFailedLoginAt,
+		&i.LockedUntil,
+		&i.IsLegal,
+		&i.DeleteAfter,
+		&i.LastLoginAttemptAt,
+	)
+	return i, err
+}
+
+const getUserIdentity = `-- name: GetUserIdentity :one
+SELECT id, user_id, provider, subject, email, created_at, last_login_at FROM user_identities
+WHERE provider = $1 AND subject = $2
+`
+
+type GetUserIdentityParams struct {
+	Provider string
+	Subject  string
+}
+
+// SSO identities
+func (q *Queries) GetUserIdentity(ctx context.Context, arg GetUserIdentityParams) (UserIdentity, error) {
+	row := q.db.QueryRow(ctx, getUserIdentity, arg.Provider, arg.Subject)
+	var i UserIdentity
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Provider,
+		&i.Subject,
+		&i.Email,
+		&i.CreatedAt,
+		&i.LastLoginAt,
+	)
+	return i, err
+}
+
+const getUserStorage = `-- name: GetUserStorage :one
+SELECT id, user_id, organization_id, plan, quota_bytes, quota_documents, used_bytes, document_count, updated_at FROM storage_usage WHERE user_id = $1
+`
+
+// Storage quotas
+func (q *Queries) GetUserStorage(ctx context.Context, userID pgtype.UUID) (StorageUsage, error) {
+	row := q.db.QueryRow(ctx, getUserStorage, userID)
+	var i StorageUsage
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.OrganizationID,
+		&i.Plan,
+		&i.QuotaBytes,
+		&i.QuotaDocuments,
+		&i.UsedBytes,
+		&i.DocumentCount,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
+
+const getValidAccountToken = `-- name: GetValidAccountToken :one
+SELECT id, user_id, purpose, token_hash, expires_at, used_at, created_at FROM account_tokens
+WHERE token_hash = $1 AND purpose = $2 AND used_at IS NULL AND expires_at > CURRENT_TIMESTAMP
+`
+
+type GetValidAccountTokenParams struct {
+	TokenHash string
+	Purpose   string
+}
+
+func (q *Queries) GetValidAccountToken(ctx context.Context, arg GetValidAccountTokenParams) (AccountToken, error) {
+	row := q.db.QueryRow(ctx, getValidAccountToken, arg.TokenHash, arg.Purpose)
+	var i AccountToken
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Purpose,
+		&i.TokenHash,
+		&i.ExpiresAt,
+		&i.UsedAt,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const getWorkspaceByID = `-- name: GetWorkspaceByID :one
+SELECT id, organization_id, personal_user_id, name, created_at FROM workspaces WHERE id = $1
+`
+
+func (q *Queries) GetWorkspaceByID(ctx context.Context, id pgtype.UUID) (Workspace, error) {
+	row := q.db.QueryRow(ctx, getWorkspaceByID, id)
+	var i Workspace
+	err := row.Scan(
+		&i.ID,
+		&i.OrganizationID,
+		&i.PersonalUserID,
+		&i.Name,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const getWorkspaceRole = `-- name: GetWorkspaceRole :one
+SELECT roles.role AS role FROM (
+    SELECT wm.role FROM workspace_members wm
+    WHERE wm.workspace_id = $1
+      AND (wm.user_id = $2 OR wm.team_id IN (SELECT tm.team_id FROM team_members tm WHERE tm.user_id = $2))
+    UNION ALL
+    SELECT 'owner' FROM workspaces w
+    JOIN organization_members om ON om.organization_id = w.organization_id
+    WHERE w.id = $1 AND om.user_id = $2 AND om.role IN ('owner', 'admin')
+) roles
+ORDER BY CASE roles.role WHEN 'owner' THEN 0 WHEN 'editor' THEN 1 WHEN 'viewer' THEN 2 ELSE 3 END
+LIMIT 1
+`
+
+type GetWorkspaceRoleParams struct {
+	WorkspaceID pgtype.UUID
+	UserID      pgtype.UUID
+}
+
+func (q *Queries) GetWorkspaceRole(ctx context.Context, arg GetWorkspaceRoleParams) (string, error) {
+	row := q.db.QueryRow(ctx, getWorkspaceRole, arg.WorkspaceID, arg.UserID)
+	var role string
+	err := row.Scan(&role)
+	return role, err
+}
+
+const grantDocumentTeam = `-- name: GrantDocumentTeam :one
+INSERT INTO document_grants (document_id, team_id, permission, granted_by)
+VALUES ($1, $2, $3, $4)
+ON CONFLICT (document_id, team_id) DO UPDATE SET permission = EXCLUDED.permission, granted_by = EXCLUDED.granted_by
+RETURNING id, document_id, user_id, team_id, permission, granted_by, created_at
+`
+
+type GrantDocumentTeamParams struct {
+	DocumentID pgtype.UUID
+	TeamID     pgtype.UUID
+	Permission string
+	GrantedBy  pgtype.UUID
+}
+
+func (q *Queries) GrantDocumentTeam(ctx context.Context, arg GrantDocumentTeamParams) (DocumentGrant, error) {
+	row := q.db.QueryRow(ctx, grantDocumentTeam,
+		arg.DocumentID,
+		arg.TeamID,
+		arg.Permission,
+		arg.GrantedBy,
+	)
+	var i DocumentGrant
+	err := row.Scan(
+		&i.ID,
+		&i.DocumentID,
+		&i.UserID,
+		&i.TeamID,
+		&i.Permission,
+		&i.GrantedBy,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const grantDocumentUser = `-- name: GrantDocumentUser :one
+INSERT INTO document_grants (document_id, user_id, permission, granted_by)
+VALUES ($1, $2, $3, $4)
+ON CONFLICT (document_id, user_id) DO UPDATE SET permission = EXCLUDED.permission, granted_by = EXCLUDED.granted_by
+RETURNING id, document_id, user_id, team_id, permission, granted_by, created_at
+`
+
+type GrantDocumentUserParams struct {
+	DocumentID pgtype.UUID
+	UserID     pgtype.UUID
+	Permission string
+	GrantedBy  pgtype.UUID
+}
+
+// Document Grants
+func (q *Queries) GrantDocumentUser(ctx context.Context, arg GrantDocumentUserParams) (DocumentGrant, error) {
+	row := q.db.QueryRow(ctx, grantDocumentUser,
+		arg.DocumentID,
+		arg.UserID,
+		arg.Permission,
+		arg.GrantedBy,
+	)
+	var i DocumentGrant
+	err := row.Scan(
+		&i.ID,
+		&i.DocumentID,
+		&i.UserID,
+		&i.TeamID,
+		&i.Permission,
+		&i.GrantedBy,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const isAccountHeld = `-- name: IsAccountHeld :one
+SELECT EXISTS (
+    SELECT 1 FROM legal_holds
+    WHERE resource_type = 'user' AND resource_id = $1 AND released_at IS NULL
+) OR EXISTS (
+    SELECT 1 FROM documents
+    WHERE workspace_id IN (SELECT id FROM workspaces WHERE personal_user_id = $1)
+      AND document_held(id)
+) OR EXISTS (
+    SELECT 1 FROM folders
+    WHERE workspace_id IN (SELECT id FROM workspaces WHERE personal_user_id = $1)
+      AND folder_held(id)
+) AS held
+`
+
+// Whether a legal hold keeps the account or any of the documents and
+// folders that deleting it would delete
+func (q *Queries) IsAccountHeld(ctx context.Context, userID pgtype.UUID) (bool, error) {
+	row := q.db.QueryRow(ctx, isAccountHeld, userID)
+	var held bool
+	err := row.Scan(&held)
+	return held, err
+}
+
+const isDocumentHeld = `-- name: IsDocumentHeld :one
+SELECT document_held($1) AS held
+`
+
+func (q *Queries) IsDocumentHeld(ctx context.Context, documentID pgtype.UUID) (bool, error) {
+	row := q.db.QueryRow(ctx, isDocumentHeld, documentID)
+	var held bool
+	err := row.Scan(&held)
+	return held, err
+}
+
+const isFolderHeld = `-- name: IsFolderHeld :one
+SELECT folder_held($1) AS held
+`
+
+func (q *Queries) IsFolderHeld(ctx context.Context, folderID pgtype.UUID) (bool, error) {
+	row := q.db.QueryRow(ctx, isFolderHeld, folderID)
+	var held bool
+	err := row.Scan(&held)
+	return held, err
+}
+
+const isUserHeld = `-- name: IsUserHeld :one
+SELECT EXISTS (
+    SELECT 1 FROM legal_holds
+    WHERE resource_type = 'user' AND resource_id = $1 AND released_at IS NULL
+)
+`
+
+func (q *Queries) IsUserHeld(ctx context.Context, userID pgtype.UUID) (bool, error) {
+	row := q.db.QueryRow(ctx, isUserHeld, userID)
+	var exists bool
+	err := row.Scan(&exists)
+	return exists, err
+}
+
+const listAccountDocuments = `-- name: ListAccountDocuments :many
+SELECT id, user_id, filename, file_path, encrypted_key, file_size, mime_type, checksum, created_at, updated_at, folder_id, workspace_id, deleted_at, deleted_by FROM documents
+WHERE user_id = $1 OR workspace_id IN (SELECT id FROM workspaces WHERE personal_user_id = $1)
+ORDER BY created_at
+`
+
+// Every document a user uploaded or that is in their personal workspace,
+// including those in the trash
+func (q *Queries) ListAccountDocuments(ctx context.Context, userID pgtype.UUID) ([]Document, error) {
+	rows, err := q.db.Query(ctx, listAccountDocuments, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Document
+	for rows.Next() {
+		var i Document
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.Filename,
+			&i.FilePath,
+			&i.EncryptedKey,
+			&i.FileSize,
+			&i.MimeType,
+			&i.Checksum,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.FolderID,
+			&i.WorkspaceID,
+			&i.DeletedAt,
+			&i.DeletedBy,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listActiveShares = `-- name: ListActiveShares :many
+SELECT s.id, s.name, s.folder_id, s.expires_at, s.max_access, s.access_count, s.view_only, s.created_at,
+    u.email AS created_by_email,
+    (SELECT COUNT(*) FROM share_documents sd WHERE sd.share_id = s.id) AS document_count
+FROM shares s
+JOIN users u ON u.id = s.created_by
+WHERE s.expires_at > CURRENT_TIMESTAMP
+  AND (COALESCE(s.max_access, -1) < 0 OR s.access_count < s.max_access)
+  AND u.email ILIKE '%' || $1::text || '%'
+ORDER BY s.created_at DESC
+LIMIT $2 OFFSET $3
+`
+
+type ListActiveSharesParams struct {
+	CreatedByEmail string
+	Limit          int32
+	Offset         int32
+}
+
+type ListActiveSharesRow struct {
+	ID             pgtype.UUID
+	Name           pgtype.Text
+	FolderID       pgtype.UUID
+	ExpiresAt      pgtype.Timestamptz
+	MaxAccess      pgtype.Int4
+	AccessCount    pgtype.Int4
+	ViewOnly       bool
+	CreatedAt      pgtype.Timestamptz
+	CreatedByEmail string
+	DocumentCount  int64
+}
+
+func (q *Queries) ListActiveShares(ctx context.Context, arg ListActiveSharesParams) ([]ListActiveSharesRow, error) {
+	rows, err := q.db.Query(ctx, listActiveShares, arg.CreatedByEmail, arg.Limit, arg.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListActiveSharesRow
+	for rows.Next() {
+		var i ListActiveSharesRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Name,
+			&i.FolderID,
+			&i.ExpiresAt,
+			&i.MaxAccess,
+			&i.AccessCount,
+			&i.ViewOnly,
+			&i.CreatedAt,
+			&i.CreatedByEmail,
+			&i.DocumentCount,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listAuditEventsAfter = `-- name: ListAuditEventsAfter :many
+SELECT seq, occurred_at, actor_id, actor_email, action, resource_type, resource_id, ip_address, user_agent, details, prev_hash, hash FROM audit_events WHERE seq > $1 ORDER BY seq LIMIT $2
+`
+
+type ListAuditEventsAfterParams struct {
+	Seq   int64
+	Limit int32
+}
+
+func (q *Queries) ListAuditEventsAfter(ctx context.Context, arg ListAuditEventsAfterParams) ([]AuditEvent, error) {
+	rows, err := q.db.Query(ctx, listAuditEventsAfter, arg.Seq, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []AuditEvent
+	for rows.Next() {
+		var i AuditEvent
+		if err := rows.Scan(
+			&i.Seq,
+			&i.OccurredAt,
+			&i.ActorID,
+			&i.ActorEmail,
+			&i.Action,
+			&i.ResourceType,
+			&i.ResourceID,
+			&i.IpAddress,
+			&i.UserAgent,
+			&i.Details,
+			&i.PrevHash,
+			&i.Hash,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listDataExports = `-- name: ListDataExports :many
+SELECT id, user_id, status, file_path, file_size, error, requested_at, completed_at, expires_at FROM data_exports
+WHERE user_id = $1
+ORDER BY requested_at DESC
+`
+
+func (q *Queries) ListDataExports(ctx context.Context, userID pgtype.UUID) ([]DataExport, error) {
+	rows, err := q.db.Query(ctx, listDataExports, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []DataExport
+	for rows.Next() {
+		var i DataExport
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.Status,
+			&i.FilePath,
+			&i.FileSize,
+			&i.Error,
+			&i.RequestedAt,
+			&i.CompletedAt,
+			&i.ExpiresAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listDocumentGrants = `-- name: ListDocumentGrants :many
+SELECT g.id, g.user_id, g.team_id, g.permission, g.created_at, u.email, t.name AS team_name
+FROM document_grants g
+LEFT JOIN users u ON u.id = g.user_id
+LEFT JOIN teams t ON t.id = g.team_id
+WHERE g.document_id = $1
+ORDER BY g.created_at
+`
+
+type ListDocumentGrantsRow struct {
+	ID         pgtype.UUID
+	UserID     pgtype.UUID
+	TeamID     pgtype.UUID
+	Permission string
+	CreatedAt  pgtype.Timestamptz
+	Email      pgtype.Text
+	TeamName   pgtype.Text
+}
+
+func (q *Queries) ListDocumentGrants(ctx context.Context, documentID pgtype.UUID) ([]ListDocumentGrantsRow, error) {
+	rows, err := q.db.Query(ctx, listDocumentGrants, documentID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListDocumentGrantsRow
+	for rows.Next() {
+		var i ListDocumentGrantsRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.TeamID,
+			&i.Permission,
+			&i.CreatedAt,
+			&i.Email,
+			&i.TeamName,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listDocumentTags = `-- name: ListDocumentTags :many
+SELECT tag FROM document_tags WHERE document_id = $1 ORDER BY tag
+`
+
+// Document tags
+func (q *Queries) ListDocumentTags(ctx context.Context, documentID pgtype.UUID) ([]string, error) {
+	rows, err := q.db.Query(ctx, listDocumentTags, documentID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []string
+	for rows.Next() {
+		var tag string
+		if err := rows.Scan(&tag); err != nil {
+			return nil, err
+		}
+		items = append(items, tag)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listDocumentsByWorkspace = `-- name: ListDocumentsByWorkspace :many
+SELECT id, user_id, filename, file_path, encrypted_key, file_size, mime_type, checksum, created_at, updated_at, folder_id, workspace_id, deleted_at, deleted_by FROM documents WHERE workspace_id = $1 AND deleted_at IS NULL ORDER BY created_at DESC
+`
+
+func (q *Queries) ListDocumentsByWorkspace(ctx context.Context, workspaceID pgtype.UUID) ([]Document, error) {
+	rows, err := q.db.Query(ctx, listDocumentsByWorkspace, workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Document
+	for rows.Next() {
+		var i Document
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.Filename,
+			&i.FilePath,
+			&i.EncryptedKey,
+			&i.FileSize,
+			&i.MimeType,
+			&i.Checksum,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.FolderID,
+			&i.WorkspaceID,
+			&i.DeletedAt,
+			&i.DeletedBy,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listExpiredDataExports = `-- name: ListExpiredDataExports :many
+SELECT id, user_id, status, file_path, file_size, error, requested_at, completed_at, expires_at FROM data_exports
+WHERE status = 'ready' AND expires_at < $1
+`
+
+func (q *Queries) ListExpiredDataExports(ctx context.Context, now pgtype.Timestamptz) ([]DataExport, error) {
+	rows, err := q.db.Query(ctx, listExpiredDataExports, now)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []DataExport
+	for rows.Next() {
+		var i DataExport
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.Status,
+			&i.FilePath,
+			&i.FileSize,
+			&i.Error,
+			&i.RequestedAt,
+			&i.CompletedAt,
+			&i.ExpiresAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listFileRequestUploads = `-- name: ListFileRequestUploads :many
+SELECT u.id, u.file_request_id, u.document_id, u.uploader_name, u.uploader_email, u.ip_address, u.created_at, d.filename, d.file_size, d.mime_type
+FROM file_request_uploads u
+JOIN documents d ON d.id = u.document_id
+WHERE u.file_request_id = $1 AND d.deleted_at IS NULL
+ORDER BY u.created_at DESC
+`
+
+type ListFileRequestUploadsRow struct {
+	ID            pgtype.UUID
+	FileRequestID pgtype.UUID
+	DocumentID    pgtype.UUID
+	UploaderName  pgtype.Text
+	UploaderEmail pgtype.Text
+	IpAddress     *netip.Addr
+	CreatedAt     pgtype.Timestamptz
+	Filename      string
+	FileSize      int64
+	MimeType      string
+}
+
+func (q *Queries) ListFileRequestUploads(ctx context.Context, fileRequestID pgtype.UUID) ([]ListFileRequestUploadsRow, error) {
+	rows, err := q.db.Query(ctx, listFileRequestUploads, fileRequestID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListFileRequestUploadsRow
+	for rows.Next() {
+		var i ListFileRequestUploadsRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.FileRequestID,
+			&i.DocumentID,
+			&i.UploaderName,
+			&i.UploaderEmail,
+			&i.IpAddress,
+			&i.CreatedAt,
+			&i.Filename,
+			&i.FileSize,
+			&i.MimeType,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listFileRequestsByUser = `-- name: ListFileRequestsByUser :many
+SELECT id, user_id, request_token, title, message, expires_at, max_files, max_file_size, allowed_types, upload_count, folder_id, created_at, workspace_id FROM file_requests WHERE user_id = $1 ORDER BY created_at DESC
+`
+
+func (q *Queries) ListFileRequestsByUser(ctx context.Context, userID pgtype.UUID) ([]FileRequest, error) {
+	rows, err := q.db.Query(ctx, listFileRequestsByUser, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []FileRequest
+	for rows.Next() {
+		var i FileRequest
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.RequestToken,
+			&i.Title,
+			&i.Message,
+			&i.ExpiresAt,
+			&i.MaxFiles,
+			&i.MaxFileSize,
+			&i.AllowedTypes,
+			&i.UploadCount,
+			&i.FolderID,
+			&i.CreatedAt,
+			&i.WorkspaceID,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listFolderShareDocuments = `-- name: ListFolderShareDocuments :many
+WITH RECURSIVE tree AS (
+    SELECT id FROM folders WHERE id = $1
+    UNION ALL
+    SELECT f.id FROM folders f JOIN tree t ON f.parent_id = t.id
+)
+SELECT d.id, d.user_id, d.filename, d.file_path, d.encrypted_key, d.file_size, d.mime_type, d.checksum, d.created_at, d.updated_at, d.folder_id, d.workspace_id, d.deleted_at, d.deleted_by, COALESCE(sd.download_count, 0)::int AS download_count, sd.last_download_at
+FROM documents d
+LEFT JOIN share_documents sd ON sd.document_id = d.id AND sd.share_id = $2
+WHERE d.folder_id IN (SELECT id FROM tree) AND d.deleted_at IS NULL
+ORDER BY d.filename
+`
+
+type ListFolderShareDocumentsParams struct {
+	FolderID pgtype.UUID
+	ShareID  pgtype.UUID
+}
+
+type ListFolderShareDocumentsRow struct {
+	ID             pgtype.UUID
+	UserID         pgtype.UUID
+	Filename       string
+	FilePath       string
+	EncryptedKey   string
+	FileSize       int64
+	MimeType       string
+	Checksum       string
+	CreatedAt      pgtype.Timestamptz
+	UpdatedAt      pgtype.Timestamptz
+	FolderID       pgtype.UUID
+	WorkspaceID    pgtype.UUID
+	DeletedAt      pgtype.Timestamptz
+	DeletedBy      pgtype.UUID
+	DownloadCount  int32
+	LastDownloadAt pgtype.Timestamptz
+}
+
+func (q *Queries) ListFolderShareDocuments(ctx context.Context, arg ListFolderShareDocumentsParams) ([]ListFolderShareDocumentsRow, error) {
+	rows, err := q.db.Query(ctx, listFolderShareDocuments, arg.FolderID, arg.ShareID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListFolderShareDocumentsRow
+	for rows.Next() {
+		var i ListFolderShareDocumentsRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.Filename,
+			&i.FilePath,
+			&i.EncryptedKey,
+			&i.FileSize,
+			&i.MimeType,
+			&i.Checksum,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.FolderID,
+			&i.WorkspaceID,
+			&i.DeletedAt,
+			&i.DeletedBy,
+			&i.DownloadCount,
+			&i.LastDownloadAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listFoldersByWorkspace = `-- name: ListFoldersByWorkspace :many
+SELECT id, user_id, parent_id, name, created_at, updated_at, workspace_id FROM folders WHERE workspace_id = $1 ORDER BY name
+`
+
+func (q *Queries) ListFoldersByWorkspace(ctx context.Context, workspaceID pgtype.UUID) ([]Folder, error) {
+	rows, err := q.db.Query(ctx, listFoldersByWorkspace, workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Folder
+	for rows.Next() {
+		var i Folder
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.ParentID,
+			&i.Name,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.WorkspaceID,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listLegalHolds = `-- name: ListLegalHolds :many
+SELECT h.id, h.resource_type, h.resource_id, h.reason, h.custodian, h.placed_by, h.placed_at, h.released_by, h.released_at, h.release_reason, COALESCE(d.filename, f.name, u.email, '')::text AS resource_name
+FROM legal_holds h
+LEFT JOIN documents d ON h.resource_type = 'document' AND d.id = h.resource_id
+LEFT JOIN folders f ON h.resource_type = 'folder' AND f.id = h.resource_id
+LEFT JOIN users u ON h.resource_type = 'user' AND u.id = h.resource_id
+WHERE $1::bool OR h.released_at IS NULL
+ORDER BY h.placed_at DESC
+`
+
+type ListLegalHoldsRow struct {
+	ID            pgtype.UUID
+	ResourceType  string
+	ResourceID    pgtype.UUID
+	Reason        string
+	Custodian     string
+	PlacedBy      pgtype.UUID
+	PlacedAt      pgtype.Timestamptz
+	ReleasedBy    pgtype.UUID
+	ReleasedAt    pgtype.Timestamptz
+	ReleaseReason pgtype.Text
+	ResourceName  string
+}
+
+// Active holds, or all holds if $1 is true, with the name of what they hold
+func (q *Queries) ListLegalHolds(ctx context.Context, includeReleased bool) ([]ListLegalHoldsRow, error) {
+	rows, err := q.db.Query(ctx, listLegalHolds, includeReleased)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListLegalHoldsRow
+	for rows.Next() {
+		var i ListLegalHoldsRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.ResourceType,
+			&i.ResourceID,
+			&i.Reason,
+			&i.Custodian,
+			&i.PlacedBy,
+			&i.PlacedAt,
+			&i.ReleasedBy,
+			&i.ReleasedAt,
+			&i.ReleaseReason,
+			&i.ResourceName,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listOrganizationMembers = `-- name: ListOrganizationMembers :many
+SELECT om.user_id, om.role, om.created_at, u.email, u.full_name
+FROM organization_members om
+JOIN users u ON u.id = om.user_id
+WHERE om.organization_id = $1
+ORDER BY u.email
+`
+
+type ListOrganizationMembersRow struct {
+	UserID    pgtype.UUID
+	Role      string
+	CreatedAt pgtype.Timestamptz
+	Email     string
+	FullName  string
+}
+
+func (q *Queries) ListOrganizationMembers(ctx context.Context, organizationID pgtype.UUID) ([]ListOrganizationMembersRow, error) {
+	rows, err := q.db.Query(ctx, listOrganizationMembers, organizationID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListOrganizationMembersRow
+	for rows.Next() {
+		var i ListOrganizationMembersRow
+		if err := rows.Scan(
+			&i.UserID,
+			&i.Role,
+			&i.CreatedAt,
+			&i.Email,
+			&i.FullName,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listOrganizationTeams = `-- name: ListOrganizationTeams :many
+SELECT id, organization_id, name, created_at FROM teams WHERE organization_id = $1 ORDER BY name
+`
+
+func (q *Queries) ListOrganizationTeams(ctx context.Context, organizationID pgtype.UUID) ([]Team, error) {
+	rows, err := q.db.Query(ctx, listOrganizationTeams, organizationID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Team
+	for rows.Next() {
+		var i Team
+		if err := rows.Scan(
+			&i.ID,
+			&i.OrganizationID,
+			&i.Name,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listPersonalWorkspaceDocuments = `-- name: ListPersonalWorkspaceDocuments :many
+SELECT id, user_id, filename, file_path, encrypted_key, file_size, mime_type, checksum, created_at, updated_at, folder_id, workspace_id, deleted_at, deleted_by FROM documents
+WHERE workspace_id IN (SELECT id FROM workspaces WHERE personal_user_id = $1)
+ORDER BY created_at
+`
+
+func (q *Queries) ListPersonalWorkspaceDocuments(ctx context.Context, personalUserID pgtype.UUID) ([]Document, error) {
+	rows, err := q.db.Query(ctx, listPersonalWorkspaceDocuments, personalUserID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Document
+	for rows.Next() {
+		var i Document
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.Filename,
+			&i.FilePath,
+			&i.EncryptedKey,
+			&i.FileSize,
+			&i.MimeType,
+			&i.Checksum,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.FolderID,
+			&i.WorkspaceID,
+			&i.DeletedAt,
+			&i.DeletedBy,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listPurgeableDocuments = `-- name: ListPurgeableDocuments :many
+SELECT id, user_id, filename, file_path, encrypted_key, file_size, mime_type, checksum, created_at, updated_at, folder_id, workspace_id, deleted_at, deleted_by FROM documents
+WHERE deleted_at < $1 AND NOT document_held(id)
+ORDER BY deleted_at
+LIMIT $2
+`
+
+type ListPurgeableDocumentsParams struct {
+	Cutoff pgtype.Timestamptz
+	Limit  int32
+}
+
+// Documents trashed before the cutoff that no legal hold keeps, oldest
+// first
+func (q *Queries) ListPurgeableDocuments(ctx context.Context, arg ListPurgeableDocumentsParams) ([]Document, error) {
+	rows, err := q.db.Query(ctx, listPurgeableDocuments, arg.Cutoff, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Document
+	for rows.Next() {
+		var i Document
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.Filename,
+			&i.FilePath,
+			&i.EncryptedKey,
+			&i.FileSize,
+			&i.MimeType,
+			&i.Checksum,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.FolderID,
+			&i.WorkspaceID,
+			&i.DeletedAt,
+			&i.DeletedBy,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listRetentionDocuments = `-- name: ListRetentionDocuments :many
+SELECT d.id, d.user_id, d.filename, d.folder_id, d.created_at,
+       COALESCE(array_agg(t.tag) FILTER (WHERE t.tag IS NOT NULL), '{}')::text[] AS tags,
+       n.due_at AS notice_due_at, n.delete_at AS notice_delete_at,
+       document_held(d.id) AS held
+FROM documents d
+LEFT JOIN document_tags t ON t.document_id = d.id
+LEFT JOIN retention_notices n ON n.document_id = d.id
+WHERE d.workspace_id = $1 AND d.deleted_at IS NULL
+GROUP BY d.id, n.document_id
+`
+
+type ListRetentionDocumentsRow struct {
+	ID             pgtype.UUID
+	UserID         pgtype.UUID
+	Filename       string
+	FolderID       pgtype.UUID
+	CreatedAt      pgtype.Timestamptz
+	Tags           []string
+	NoticeDueAt    pgtype.Timestamptz
+	NoticeDeleteAt pgtype.Timestamptz
+	Held           bool
+}
+
+// Every document of a workspace with its tags, the expiry warning sent for
+// it, if any, and whether it is under legal hold
+func (q *Queries) ListRetentionDocuments(ctx context.Context, workspaceID pgtype.UUID) ([]ListRetentionDocumentsRow, error) {
+	rows, err := q.db.Query(ctx, listRetentionDocuments, workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListRetentionDocumentsRow
+	for rows.Next() {
+		var i ListRetentionDocumentsRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.Filename,
+			&i.FolderID,
+			&i.CreatedAt,
+			&i.Tags,
+			&i.NoticeDueAt,
+			&i.NoticeDeleteAt,
+			&i.Held,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listRetentionPolicies = `-- name: ListRetentionPolicies :many
+SELECT id, workspace_id, folder_id, tag, retain_months, retain_days, warn_days, created_by, created_at, updated_at FROM retention_policies WHERE workspace_id = $1 ORDER BY created_at
+`
+
+func (q *Queries) ListRetentionPolicies(ctx context.Context, workspaceID pgtype.UUID) ([]RetentionPolicy, error) {
+	rows, err := q.db.Query(ctx, listRetentionPolicies, workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []RetentionPolicy
+	for rows.Next() {
+		var i RetentionPolicy
+		if err := rows.Scan(
+			&i.ID,
+			&i.WorkspaceID,
+			&i.FolderID,
+			&i.Tag,
+			&i.RetainMonths,
+			&i.RetainDays,
+			&i.WarnDays,
+			&i.CreatedBy,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listRetentionWorkspaces = `-- name: ListRetentionWorkspaces :many
+SELECT workspace_id FROM retention_policies GROUP BY workspace_id
+`
+
+func (q *Queries) ListRetentionWorkspaces(ctx context.Context) ([]pgtype.UUID, error) {
+	rows, err := q.db.Query(ctx, listRetentionWorkspaces)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []pgtype.UUID
+	for rows.Next() {
+		var workspaceID pgtype.UUID
+		if err := rows.Scan(&workspaceID); err != nil {
+			return nil, err
+		}
+		items = append(items, workspaceID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listSecurityEvents = `-- name: ListSecurityEvents :many
+SELECT seq, occurred_at, actor_id, actor_email, action, resource_type, resource_id, ip_address, user_agent, details, prev_hash, hash FROM audit_events
+WHERE action LIKE ANY($1::text[])
+ORDER BY seq DESC
+LIMIT $2
+`
+
+type ListSecurityEventsParams struct {
+	Actions []string
+	Limit   int32
+}
+
+func (q *Queries) ListSecurityEvents(ctx context.Context, arg ListSecurityEventsParams) ([]AuditEvent, error) {
+	rows, err := q.db.Query(ctx, listSecurityEvents, arg.Actions, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []AuditEvent
+	for rows.Next() {
+		var i AuditEvent
+		if err := rows.Scan(
+			&i.Seq,
+			&i.OccurredAt,
+			&i.ActorID,
+			&i.ActorEmail,
+			&i.Action,
+			&i.ResourceType,
+			&i.ResourceID,
+			&i.IpAddress,
+			&i.UserAgent,
+			&i.Details,
+			&i.PrevHash,
+			&i.Hash,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listShareAccessLogs = `-- name: ListShareAccessLogs :many
+SELECT id, share_id, document_id, action, ip_address, user_agent, created_at FROM share_access_logs
+WHERE share_id = $1
+ORDER BY created_at DESC
+LIMIT $2
+`
+
+type ListShareAccessLogsParams struct {
+	ShareID pgtype.UUID
+	Limit   int32
+}
+
+func (q *Queries) ListShareAccessLogs(ctx context.Context, arg ListShareAccessLogsParams) ([]ShareAccessLog, error) {
+	rows, err := q.db.Query(ctx, listShareAccessLogs, arg.ShareID, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ShareAccessLog
+	for rows.Next() {
+		var i ShareAccessLog
+		if err := rows.Scan(
+			&i.ID,
+			&i.ShareID,
+			&i.DocumentID,
+			&i.Action,
+			&i.IpAddress,
+			&i.UserAgent,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listShareDocuments = `-- name: ListShareDocuments :many
+SELECT d.id, d.user_id, d.filename, d.file_path, d.encrypted_key, d.file_size, d.mime_type, d.checksum, d.created_at, d.updated_at, d.folder_id, d.workspace_id, d.deleted_at, d.deleted_by, sd.download_count, sd.last_download_at
+FROM share_documents sd
+JOIN documents d ON d.id = sd.document_id
+WHERE sd.share_id = $1 AND d.deleted_at IS NULL
+ORDER BY d.filename
+`
+
+type ListShareDocumentsRow struct {
+	ID             pgtype.UUID
+	UserID         pgtype.UUID
+	Filename       string
+	FilePath       string
+	EncryptedKey   string
+	FileSize       int64
+	MimeType       string
+	Checksum       string
+	CreatedAt      pgtype.Timestamptz
+	UpdatedAt      pgtype.Timestamptz
+	FolderID       pgtype.UUID
+	WorkspaceID    pgtype.UUID
+	DeletedAt      pgtype.Timestamptz
+	DeletedBy      pgtype.UUID
+	DownloadCount  int32
+	LastDownloadAt pgtype.Timestamptz
+}
+
+func (q *Queries) ListShareDocuments(ctx context.Context, shareID pgtype.UUID) ([]ListShareDocumentsRow, error) {
+	rows, err := q.db.Query(ctx, listShareDocuments, shareID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListShareDocumentsRow
+	for rows.Next() {
+		var i ListShareDocumentsRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.Filename,
+			&i.FilePath,
+			&i.EncryptedKey,
+			&i.FileSize,
+			&i.MimeType,
+			&i.Checksum,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.FolderID,
+			&i.WorkspaceID,
+			&i.DeletedAt,
+			&i.DeletedBy,
+			&i.DownloadCount,
+			&i.LastDownloadAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listSharedDocuments = `-- name: ListSharedDocuments :many
+SELECT d.id, d.filename, d.file_size, d.mime_type, u.email AS owner_email,
+    (CASE WHEN bool_or(g.permission = 'edit') THEN 'edit' ELSE 'read' END)::text AS permission,
+    MAX(g.created_at)::timestamptz AS shared_at
+FROM document_grants g
+JOIN documents d ON d.id = g.document_id
+JOIN users u ON u.id = d.user_id
+WHERE (g.user_id = $1 OR g.team_id IN (SELECT tm.team_id FROM team_members tm WHERE tm.user_id = $1))
+  AND d.deleted_at IS NULL
+GROUP BY d.id, u.email
+ORDER BY shared_at DESC
+`
+
+type ListSharedDocumentsRow struct {
+	ID         pgtype.UUID
+	Filename   string
+	FileSize   int64
+	MimeType   string
+	OwnerEmail string
+	Permission string
+	SharedAt   pgtype.Timestamptz
+}
+
+func (q *Queries) ListSharedDocuments(ctx context.Context, userID pgtype.UUID) ([]ListSharedDocumentsRow, error) {
+	rows, err := q.db.Query(ctx, listSharedDocuments, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListSharedDocumentsRow
+	for rows.Next() {
+		var i ListSharedDocumentsRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Filename,
+			&i.FileSize,
+			&i.MimeType,
+			&i.OwnerEmail,
+			&i.Permission,
+			&i.SharedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listSharesExpiringSoon = `-- name: ListSharesExpiringSoon :many
+SELECT id, share_token, expires_at, max_access, access_count, password_hash, created_at, created_by, folder_id, name, view_only, allowed_cidrs, notify_on_access, notify_on_limit, notify_password_failures, notify_expiring_hours, expiry_notified_at FROM shares
+WHERE notify_expiring_hours IS NOT NULL
+  AND expiry_notified_at IS NULL
+  AND expires_at > CURRENT_TIMESTAMP
+  AND expires_at <= CURRENT_TIMESTAMP + make_interval(hours => notify_expiring_hours)
+`
+
+func (q *Queries) ListSharesExpiringSoon(ctx context.Context) ([]Share, error) {
+	rows, err := q.db.Query(ctx, listSharesExpiringSoon)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Share
+	for rows.Next() {
+		var i Share
+		if err := rows.Scan(
+			&i.ID,
+			&i.ShareToken,
+			&i.ExpiresAt,
+			&i.MaxAccess,
+			&i.AccessCount,
+			&i.PasswordHash,
+			&i.CreatedAt,
+			&i.CreatedBy,
+			&i.FolderID,
+			&i.Name,
+			&i.ViewOnly,
+			&i.AllowedCidrs,
+			&i.NotifyOnAccess,
+			&i.NotifyOnLimit,
+			&i.NotifyPasswordFailures,
+			&i.NotifyExpiringHours,
+			&i.ExpiryNotifiedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listSoleOwnedOrganizations = `-- name: ListSoleOwnedOrganizations :many
+SELECT o.id, o.name, o.created_at, o.require_mfa FROM organizations o
+JOIN organization_members om ON om.organization_id = o.id
+WHERE om.user_id = $1 AND om.role = 'owner'
+  AND NOT EXISTS (
+    SELECT 1 FROM organization_members other
+    WHERE other.organization_id = o.id AND other.role = 'owner' AND other.user_id <> $1
+  )
+ORDER BY o.name
+`
+
+// Organizations the user is the only owner of, which would be left
+// without one
+func (q *Queries) ListSoleOwnedOrganizations(ctx context.Context, userID pgtype.UUID) ([]Organization, error) {
+	rows, err := q.db.Query(ctx, listSoleOwnedOrganizations, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Organization
+	for rows.Next() {
+		var i Organization
+		if err := rows.Scan(
+			&i.ID,
+			&i.Name,
+			&i.CreatedAt,
+			&i.RequireMfa,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listStorageUsage = `-- name: ListStorageUsage :many
+SELECT u.id, u.email, u.full_name, su.plan, su.quota_bytes, su.quota_documents,
+    su.document_count::bigint AS document_count,
+    su.used_bytes AS storage_bytes
+FROM storage_usage su
+JOIN users u ON u.id = su.user_id
+ORDER BY su.used_bytes DESC
+LIMIT $1
+`
+
+type ListStorageUsageRow struct {
+	ID             pgtype.UUID
+	Email          string
+	FullName       string
+	Plan           string
+	QuotaBytes     pgtype.Int8
+	QuotaDocuments pgtype.Int4
+	DocumentCount  int64
+	StorageBytes   int64
+}
+
+func (q *Queries) ListStorageUsage(ctx context.Context, limit int32) ([]ListStorageUsageRow, error) {
+	rows, err := q.db.Query(ctx, listStorageUsage, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListStorageUsageRow
+	for rows.Next() {
+		var i ListStorageUsageRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Email,
+			&i.FullName,
+			&i.Plan,
+			&i.QuotaBytes,
+			&i.QuotaDocuments,
+			&i.DocumentCount,
+			&i.StorageBytes,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listTeamMembers = `-- name: ListTeamMembers :many
+SELECT tm.team_id, tm.user_id, u.email, u.full_name
+FROM team_members tm
+JOIN teams t ON t.id = tm.team_id
+JOIN users u ON u.id = tm.user_id
+WHERE t.organization_id = $1
+ORDER BY u.email
+`
+
+type ListTeamMembersRow struct {
+	TeamID   pgtype.UUID
+	UserID   pgtype.UUID
+	Email    string
+	FullName string
+}
+
+func (q *Queries) ListTeamMembers(ctx context.Context, organizationID pgtype.UUID) ([]ListTeamMembersRow, error) {
+	rows, err := q.db.Query(ctx, listTeamMembers, organizationID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListTeamMembersRow
+	for rows.Next() {
+		var i ListTeamMembersRow
+		if err := rows.Scan(
+			&i.TeamID,
+			&i.UserID,
+			&i.Email,
+			&i.FullName,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listTrashedDocuments = `-- name: ListTrashedDocuments :many
+SELECT id, user_id, filename, file_path, encrypted_key, file_size, mime_type, checksum, created_at, updated_at, folder_id, workspace_id, deleted_at, deleted_by FROM documents
+WHERE workspace_id = $1 AND deleted_at IS NOT NULL
+ORDER BY deleted_at DESC
+`
+
+func (q *Queries) ListTrashedDocuments(ctx context.Context, workspaceID pgtype.UUID) ([]Document, error) {
+	rows, err := q.db.Query(ctx, listTrashedDocuments, workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Document
+	for rows.Next() {
+		var i Document
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.Filename,
+			&i.FilePath,
+			&i.EncryptedKey,
+			&i.FileSize,
+			&i.MimeType,
+			&i.Checksum,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.FolderID,
+			&i.WorkspaceID,
+			&i.DeletedAt,
+			&i.DeletedBy,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listUserAPIKeys = `-- name: ListUserAPIKeys :many
+SELECT id, user_id, name, key_prefix, key_hash, scopes, expires_at, last_used_at, last_used_ip, created_at FROM api_keys WHERE user_id = $1 ORDER BY created_at DESC
+`
+
+func (q *Queries) ListUserAPIKeys(ctx context.Context, userID pgtype.UUID) ([]ApiKey, error) {
+	rows, err := q.db.Query(ctx, listUserAPIKeys, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ApiKey
+	for rows.Next() {
+		var i ApiKey
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.Name,
+			&i.KeyPrefix,
+			&i.KeyHash,
+			&i.Scopes,
+			&i.ExpiresAt,
+			&i.LastUsedAt,
+			&i.LastUsedIp,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listUserAuditEvents = `-- name: ListUserAuditEvents :many
+SELECT seq, occurred_at, actor_id, actor_email, action, resource_type, resource_id, ip_address, user_agent, details, prev_hash, hash FROM audit_events
+WHERE actor_id = $1 OR (resource_type = 'user' AND resource_id = $1::text)
+ORDER BY seq
+`
+
+// Audit events the user took part in, as actor or as the user acted on
+func (q *Queries) ListUserAuditEvents(ctx context.Context, userID pgtype.UUID) ([]AuditEvent, error) {
+	rows, err := q.db.Query(ctx, listUserAuditEvents, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []AuditEvent
+	for rows.Next() {
+		var i AuditEvent
+		if err := rows.Scan(
+			&i.Seq,
+			&i.OccurredAt,
+			&i.ActorID,
+			&i.ActorEmail,
+			&i.Action,
+			&i.ResourceType,
+			&i.ResourceID,
+			&i.IpAddress,
+			&i.UserAgent,
+			&i.Details,
+			&i.PrevHash,
+			&i.Hash,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listUserExportFiles = `-- name: ListUserExportFiles :many
+SELECT file_path FROM data_exports
+WHERE user_id = $1 AND file_path IS NOT NULL
+`
+
+func (q *Queries) ListUserExportFiles(ctx context.Context, userID pgtype.UUID) ([]pgtype.Text, error) {
+	rows, err := q.db.Query(ctx, listUserExportFiles, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []pgtype.Text
+	for rows.Next() {
+		var filePath pgtype.Text
+		if err := rows.Scan(&filePath); err != nil {
+			return nil, err
+		}
+		items = append(items, filePath)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listUserIdentities = `-- name: ListUserIdentities :many
+SELECT id, user_id, provider, subject, email, created_at, last_login_at FROM user_identities
+WHERE user_id = $1
+ORDER BY created_at
+`
+
+func (q *Queries) ListUserIdentities(ctx context.Context, userID pgtype.UUID) ([]UserIdentity, error) {
+	rows, err := q.db.Query(ctx, listUserIdentities, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []UserIdentity
+	for rows.Next() {
+		var i UserIdentity
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.Provider,
+			&i.Subject,
+			&i.Email,
+			&i.CreatedAt,
+			&i.LastLoginAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listUserOrganizations = `-- name: ListUserOrganizations :many
+SELECT o.id, o.name, o.created_at, o.require_mfa, om.role
+FROM organizations o
+JOIN organization_members om ON om.organization_id = o.id
+WHERE om.user_id = $1
+ORDER BY o.name
+`
+
+type ListUserOrganizationsRow struct {
+	ID         pgtype.UUID
+	Name       string
+	CreatedAt  pgtype.Timestamptz
+	RequireMfa bool
+	Role       string
+}
+
+func (q *Queries) ListUserOrganizations(ctx context.Context, userID pgtype.UUID) ([]ListUserOrganizationsRow, error) {
+	rows, err := q.db.Query(ctx, listUserOrganizations, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListUserOrganizationsRow
+	for rows.Next() {
+		var i ListUserOrganizationsRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Name,
+			&i.CreatedAt,
+			&i.RequireMfa,
+			&i.Role,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listUserSessions = `-- name: ListUserSessions :many
+SELECT id, user_id, token, expires_at, created_at, ip_address, user_agent, last_seen_at FROM sessions
+WHERE user_id = $1 AND expires_at > CURRENT_TIMESTAMP
+ORDER BY COALESCE(last_seen_at, created_at) DESC
+`
+
+func (q *Queries) ListUserSessions(ctx context.Context, userID pgtype.UUID) ([]Session, error) {
+	rows, err := q.db.Query(ctx, listUserSessions, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Session
+	for rows.Next() {
+		var i Session
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.Token,
+			&i.ExpiresAt,
+			&i.CreatedAt,
+			&i.IpAddress,
+			&i.UserAgent,
+			&i.LastSeenAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listUserShareAccessLogs = `-- name: ListUserShareAccessLogs :many
+SELECT l.id, l.share_id, l.document_id, l.action, l.ip_address, l.user_agent, l.created_at FROM share_access_logs l
+JOIN shares s ON s.id = l.share_id
+WHERE s.created_by = $1
+ORDER BY l.created_at
+`
+
+func (q *Queries) ListUserShareAccessLogs(ctx context.Context, userID pgtype.UUID) ([]ShareAccessLog, error) {
+	rows, err := q.db.Query(ctx, listUserShareAccessLogs, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ShareAccessLog
+	for rows.Next() {
+		var i ShareAccessLog
+		if err := rows.Scan(
+			&i.ID,
+			&i.ShareID,
+			&i.DocumentID,
+			&i.Action,
+			&i.IpAddress,
+			&i.UserAgent,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listUserShareDocuments = `-- name: ListUserShareDocuments :many
+SELECT sd.share_id, sd.document_id, sd.download_count, sd.last_download_at FROM share_documents sd
+JOIN shares s ON s.id = sd.share_id
+WHERE s.created_by = $1
+`
+
+func (q *Queries) ListUserShareDocuments(ctx context.Context, userID pgtype.UUID) ([]ShareDocument, error) {
+	rows, err := q.db.Query(ctx, listUserShareDocuments, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ShareDocument
+	for rows.Next() {
+		var i ShareDocument
+		if err := rows.Scan(
+			&i.ShareID,
+			&i.DocumentID,
+			&i.DownloadCount,
+			&i.LastDownloadAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listUserShares = `-- name: ListUserShares :many
+SELECT id, share_token, expires_at, max_access, access_count, password_hash, created_at, created_by, folder_id, name, view_only, allowed_cidrs, notify_on_access, notify_on_limit, notify_password_failures, notify_expiring_hours, expiry_notified_at FROM shares
+WHERE created_by = $1
+ORDER BY created_at
+`
+
+func (q *Queries) ListUserShares(ctx context.Context, userID pgtype.UUID) ([]Share, error) {
+	rows, err := q.db.Query(ctx, listUserShares, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Share
+	for rows.Next() {
+		var i Share
+		if err := rows.Scan(
+			&i.ID,
+			&i.ShareToken,
+			&i.ExpiresAt,
+			&i.MaxAccess,
+			&i.AccessCount,
+			&i.PasswordHash,
+			&i.CreatedAt,
+			&i.CreatedBy,
+			&i.FolderID,
+			&i.Name,
+			&i.ViewOnly,
+			&i.AllowedCidrs,
+			&i.NotifyOnAccess,
+			&i.NotifyOnLimit,
+			&i.NotifyPasswordFailures,
+			&i.NotifyExpiringHours,
+			&i.ExpiryNotifiedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listUserWebAuthnCredentials = `-- name: ListUserWebAuthnCredentials :many
+SELECT id, user_id, credential_id, credential, name, created_at, last_used_at FROM webauthn_credentials
+WHERE user_id = $1
+ORDER BY created_at
+`
+
+func (q *Queries) ListUserWebAuthnCredentials(ctx context.Context, userID pgtype.UUID) ([]WebauthnCredential, error) {
+	rows, err := q.db.Query(ctx, listUserWebAuthnCredentials, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []WebauthnCredential
+	for rows.Next() {
+		var i WebauthnCredential
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.CredentialID,
+			&i.Credential,
+			&i.Name,
+			&i.CreatedAt,
+			&i.LastUsedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listUserWorkspaces = `-- name: ListUserWorkspaces :many
+SELECT id, organization_id, personal_user_id, name, created_at FROM workspaces
+WHERE id IN (
+    SELECT workspace_id FROM workspace_members
+    WHERE workspace_members.user_id = $1
+       OR team_id IN (SELECT team_id FROM team_members WHERE team_members.user_id = $1)
+)
+OR organization_id IN (
+    SELECT organization_id FROM organization_members
+    WHERE organization_members.user_id = $1 AND role IN ('owner', 'admin')
+)
+ORDER BY personal_user_id IS NULL, name
+`
+
+func (q *Queries) ListUserWorkspaces(ctx context.Context, userID pgtype.UUID) ([]Workspace, error) {
+	rows, err := q.db.Query(ctx, listUserWorkspaces, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Workspace
+	for rows.Next() {
+		var i Workspace
+		if err := rows.Scan(
+			&i.ID,
+			&i.OrganizationID,
+			&i.PersonalUserID,
+			&i.Name,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listUsersDueForDeletion = `-- name: ListUsersDueForDeletion :many
+SELECT id, email, password_hash, full_name, created_at, updated_at, is_active, default_allowed_cidrs, is_admin, totp_secret, totp_enabled, totp_last_step, email_verified_at, failed_login_count, last_failed_login_at, locked_until, is_legal, delete_after, last_login_attempt_at FROM users
+WHERE delete_after <= $1
+ORDER BY delete_after
+`
+
+func (q *Queries) ListUsersDueForDeletion(ctx context.Context, now pgtype.Timestamptz) ([]User, error) {
+	rows, err := q.db.Query(ctx, listUsersDueForDeletion, now)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []User
+	for rows.Next() {
+		var i User
+		if err := rows.Scan(
+			&i.ID,
+			&i.Email,
+			&i.PasswordHash,
+			&i.FullName,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.IsActive,
+			&i.DefaultAllowedCidrs,
+			&i.IsAdmin,
+			&i.TotpSecret,
+			&i.TotpEnabled,
+			&i.TotpLastStep,
+			&i.EmailVerifiedAt,
+			&i.FailedLoginCount,
+			&i.LastFailedLoginAt,
+			&i.LockedUntil,
+			&i.IsLegal,
+			&i.DeleteAfter,
+			&i.LastLoginAttemptAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listWorkspaceMembers = `-- name: ListWorkspaceMembers :many
+SELECT wm.id, wm.user_id, wm.team_id, wm.role, wm.created_at, u.email, t.name AS team_name
+FROM workspace_members wm
+LEFT JOIN users u ON u.id = wm.user_id
+LEFT JOIN teams t ON t.id = wm.team_id
+WHERE wm.workspace_id = $1
+ORDER BY wm.created_at
+`
+
+type ListWorkspaceMembersRow struct {
+	ID        pgtype.UUID
+	UserID    pgtype.UUID
+	TeamID    pgtype.UUID
+	Role      string
+	CreatedAt pgtype.Timestamptz
+	Email     pgtype.Text
+	TeamName  pgtype.Text
+}
+
+func (q *Queries) ListWorkspaceMembers(ctx context.Context, workspaceID pgtype.UUID) ([]ListWorkspaceMembersRow, error) {
+	rows, err := q.db.Query(ctx, listWorkspaceMembers, workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListWorkspaceMembersRow
+	for rows.Next() {
+		var i ListWorkspaceMembersRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.TeamID,
+			&i.Role,
+			&i.CreatedAt,
+			&i.Email,
+			&i.TeamName,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const lockAuditLog = `-- name: LockAuditLog :exec
+SELECT pg_advisory_xact_lock(hashtext('audit_events'))
+`
+
+// Audit events
+// Serializes writers, so each event is chained to the one before it
+func (q *Queries) LockAuditLog(ctx context.Context) error {
+	_, err := q.db.Exec(ctx, lockAuditLog)
+	return err
+}
+
+const lockUser = `-- name: LockUser :execrows
+UPDATE users
+SET locked_until = $2
+WHERE id = $1 AND (locked_until IS NULL OR locked_until < CURRENT_TIMESTAMP)
+`
+
+type LockUserParams struct {
+	ID          pgtype.UUID
+	LockedUntil pgtype.Timestamptz
+}
+
+func (q *Queries) LockUser(ctx context.Context, arg LockUserParams) (int64, error) {
+	result, err := q.db.Exec(ctx, lockUser, arg.ID, arg.LockedUntil)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const markShareExpiryNotified = `-- name: MarkShareExpiryNotified :execrows
+UPDATE shares
+SET expiry_notified_at = CURRENT_TIMESTAMP
+WHERE id = $1 AND expiry_notified_at IS NULL
+`
+
+func (q *Queries) MarkShareExpiryNotified(ctx context.Context, id pgtype.UUID) (int64, error) {
+	result, err := q.db.Exec(ctx, markShareExpiryNotified, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const markUserEmailVerified = `-- name: MarkUserEmailVerified :one
+UPDATE users
+SET email_verified_at = COALESCE(email_verified_at, CURRENT_TIMESTAMP), updated_at = CURRENT_TIMESTAMP
+WHERE id = $1
+RETURNING id, email, password_hash, full_name, created_at, updated_at, is_active, default_allowed_cidrs, is_admin, totp_secret, totp_enabled, totp_last_step, email_verified_at, failed_login_count, last_failed_login_at, locked_until, is_legal, delete_after, last_login_attempt_at
+`
+
+func (q *Queries) MarkUserEmailVerified(ctx context.Context, id pgtype.UUID) (User, error) {
+	row := q.db.QueryRow(ctx, markUserEmailVerified, id)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.Email,
+		&i.PasswordHash,
+		&i.FullName,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.IsActive,
+		&i.DefaultAllowedCidrs,
+		&i.IsAdmin,
+		&i.TotpSecret,
+		&i.TotpEnabled,
+		&i.TotpLastStep,
+		&i.EmailVerifiedAt,
+		&i.FailedLoginCount,
+		&i.LastFailedLoginAt,
+		&i.LockedUntil,
+		&i.IsLegal,
+		&i.DeleteAfter,
+		&i.LastLoginAttemptAt,
+	)
+	return i, err
+}
+
+const reassignOrganizationDocuments = `-- name: ReassignOrganizationDocuments :many
+UPDATE documents d
+SET user_id = (
+    SELECT om.user_id FROM organization_members om
+    WHERE om.organization_id = w.organization_id AND om.role = 'owner' AND om.user_id <> $1
+    ORDER BY om.created_at, om.user_id
+    LIMIT 1
+)
+FROM workspaces w
+WHERE w.id = d.workspace_id AND w.organization_id IS NOT NULL AND d.user_id = $1
+RETURNING d.id, d.user_id, d.file_size
+`
+
+type ReassignOrganizationDocumentsRow struct {
+	ID       pgtype.UUID
+	UserID   pgtype.UUID
+	FileSize int64
+}
+
+// Documents and folders a user created in organization workspaces pass to
+// the longest-standing other owner of the organization. The documents are
+// returned with their new uploader.
+func (q *Queries) ReassignOrganizationDocuments(ctx context.Context, userID pgtype.UUID) ([]ReassignOrganizationDocumentsRow, error) {
+	rows, err := q.db.Query(ctx, reassignOrganizationDocuments, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ReassignOrganizationDocumentsRow
+	for rows.Next() {
+		var i ReassignOrganizationDocumentsRow
+		if err := rows.Scan(&i.ID, &i.UserID, &i.FileSize); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const reassignOrganizationFolders = `-- name: ReassignOrganizationFolders :execrows
+UPDATE folders f
+SET user_id = (
+    SELECT om.user_id FROM organization_members om
+    WHERE om.organization_id = w.organization_id AND om.role = 'owner' AND om.user_id <> $1
+    ORDER BY om.created_at, om.user_id
+    LIMIT 1
+)
+FROM workspaces w
+WHERE w.id = f.workspace_id AND w.organization_id IS NOT NULL AND f.user_id = $1
+`
+
+func (q *Queries) ReassignOrganizationFolders(ctx context.Context, userID pgtype.UUID) (int64, error) {
+	result, err := q.db.Exec(ctx, reassignOrganizationFolders, userID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const recordFailedLogin = `-- name: RecordFailedLogin :one
+UPDATE users
+SET failed_login_count = CASE
+        WHEN last_failed_login_at IS NULL OR last_failed_login_at < $2 THEN 1
+        ELSE failed_login_count + 1
+    END,
+    last_failed_login_at = CURRENT_TIMESTAMP
+WHERE id = $1
+RETURNING failed_login_count
+`
+
+type RecordFailedLoginParams struct {
+	ID                pgtype.UUID
+	LastFailedLoginAt pgtype.Timestamptz
+}
+
+func (q *Queries) RecordFailedLogin(ctx context.Context, arg RecordFailedLoginParams) (int32, error) {
+	row := q.db.QueryRow(ctx, recordFailedLogin, arg.ID, arg.LastFailedLoginAt)
+	var failedLoginCount int32
+	err := row.Scan(&failedLoginCount)
+	return failedLoginCount, err
+}
+
+const recordShareDocumentDownload = `-- name: RecordShareDocumentDownload :execrows
+INSERT INTO share_documents (share_id, document_id, download_count, last_download_at)
+VALUES ($1, $2, 1, CURRENT_TIMESTAMP)
+ON CONFLICT (share_id, document_id) DO UPDATE
+SET download_count = share_documents.download_count + 1,
+    last_download_at = CURRENT_TIMESTAMP
+WHERE $3::int = -1 OR share_documents.download_count < $3::int
+`
+
+type RecordShareDocumentDownloadParams struct {
+	ShareID      pgtype.UUID
+	DocumentID   pgtype.UUID
+	MaxDownloads int32
+}
+
+func (q *Queries) RecordShareDocumentDownload(ctx context.Context, arg RecordShareDocumentDownloadParams) (int64, error) {
+	result, err := q.db.Exec(ctx, recordShareDocumentDownload, arg.ShareID, arg.DocumentID, arg.MaxDownloads)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const releaseFileRequestUpload = `-- name: ReleaseFileRequestUpload :exec
+UPDATE file_requests
+SET upload_count = upload_count - 1
+WHERE id = $1 AND upload_count > 0
+`
+
+func (q *Queries) ReleaseFileRequestUpload(ctx context.Context, id pgtype.UUID) error {
+	_, err := q.db.Exec(ctx, releaseFileRequestUpload, id)
+	return err
+}
+
+const releaseLegalHold = `-- name: ReleaseLegalHold :one
+UPDATE legal_holds
+SET released_by = $2, released_at = CURRENT_TIMESTAMP, release_reason = $3
+WHERE id = $1 AND released_at IS NULL
+RETURNING id, resource_type, resource_id, reason, custodian, placed_by, placed_at, released_by, released_at, release_reason
+`
+
+type ReleaseLegalHoldParams struct {
+	ID            pgtype.UUID
+	ReleasedBy    pgtype.UUID
+	ReleaseReason pgtype.Text
+}
+
+func (q *Queries) ReleaseLegalHold(ctx context.Context, arg ReleaseLegalHoldParams) (LegalHold, error) {
+	row := q.db.QueryRow(ctx, releaseLegalHold, arg.ID, arg.ReleasedBy, arg.ReleaseReason)
+	var i LegalHold
+	err := row.Scan(
+		&i.ID,
+		&i.ResourceType,
+		&i.ResourceID,
+		&i.Reason,
+		&i.Custodian,
+		&i.PlacedBy,
+		&i.PlacedAt,
+		&i.ReleasedBy,
+		&i.ReleasedAt,
+		&i.ReleaseReason,
+	)
+	return i, err
+}
+
+const removeOrganizationMember = `-- name: RemoveOrganizationMember :execrows
+WITH left_teams AS (
+    DELETE FROM team_members
+    WHERE team_members.user_id = $2 AND team_id IN (SELECT id FROM teams WHERE organization_id = $1)
+), left_workspaces AS (
+    DELETE FROM workspace_members
+    WHERE workspace_members.user_id = $2 AND workspace_id IN (SELECT id FROM workspaces WHERE organization_id = $1)
+)
+DELETE FROM organization_members WHERE organization_id = $1 AND user_id = $2
+`
+
+type RemoveOrganizationMemberParams struct {
+	OrganizationID pgtype.UUID
+	UserID         pgtype.UUID
+}
+
+func (q *Queries) RemoveOrganizationMember(ctx context.Context, arg RemoveOrganizationMemberParams) (int64, error) {
+	result, err := q.db.Exec(ctx, removeOrganizationMember, arg.OrganizationID, arg.UserID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const removeOrganizationStorage = `-- name: RemoveOrganizationStorage :exec
+UPDATE storage_usage
+SET used_bytes = GREATEST(used_bytes - $2, 0),
+    document_count = GREATEST(document_count - 1, 0),
+    updated_at = CURRENT_TIMESTAMP
+WHERE organization_id = $1
+`
+
+type RemoveOrganizationStorageParams struct {
+	OrganizationID pgtype.UUID
+	UsedBytes      int64
+}
+
+func (q *Queries) RemoveOrganizationStorage(ctx context.Context, arg RemoveOrganizationStorageParams) error {
+	_, err := q.db.Exec(ctx, removeOrganizationStorage, arg.OrganizationID, arg.UsedBytes)
+	return err
+}
+
+const removeTeamMember = `-- name: RemoveTeamMember :execrows
+DELETE FROM team_members WHERE team_id = $1 AND user_id = $2
+`
+
+type RemoveTeamMemberParams struct {
+	TeamID pgtype.UUID
+	UserID pgtype.UUID
+}
+
+func (q *Queries) RemoveTeamMember(ctx context.Context, arg RemoveTeamMemberParams) (int64, error) {
+	result, err := q.db.Exec(ctx, removeTeamMember, arg.TeamID, arg.UserID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const removeUserStorage = `-- name: RemoveUserStorage :exec
+UPDATE storage_usage
+SET used_bytes = GREATEST(used_bytes - $2, 0),
+    document_count = GREATEST(document_count - 1, 0),
+    updated_at = CURRENT_TIMESTAMP
+WHERE user_id = $1
+`
+
+type RemoveUserStorageParams struct {
+	UserID    pgtype.UUID
+	UsedBytes int64
+}
+
+func (q *Queries) RemoveUserStorage(ctx context.Context, arg RemoveUserStorageParams) error {
+	_, err := q.db.Exec(ctx, removeUserStorage, arg.UserID, arg.UsedBytes)
+	return err
+}
+
+const removeWorkspaceMember = `-- name: RemoveWorkspaceMember :one
+DELETE FROM workspace_members WHERE id = $1 AND workspace_id = $2
+RETURNING id, workspace_id, user_id, team_id, role, created_at
+`
+
+type RemoveWorkspaceMemberParams struct {
+	ID          pgtype.UUID
+	WorkspaceID pgtype.UUID
+}
+
+func (q *Queries) RemoveWorkspaceMember(ctx context.Context, arg RemoveWorkspaceMemberParams) (WorkspaceMember, error) {
+	row := q.db.QueryRow(ctx, removeWorkspaceMember, arg.ID, arg.WorkspaceID)
+	var i WorkspaceMember
+	err := row.Scan(
+		&i.ID,
+		&i.WorkspaceID,
+		&i.UserID,
+		&i.TeamID,
+		&i.Role,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const renameWebAuthnCredential = `-- name: RenameWebAuthnCredential :one
+UPDATE webauthn_credentials
+SET name = $3
+WHERE id = $1 AND user_id = $2
+RETURNING id, user_id, credential_id, credential, name, created_at, last_used_at
+`
+
+type RenameWebAuthnCredentialParams struct {
+	ID     pgtype.UUID
+	UserID pgtype.UUID
+	Name   string
+}
+
+func (q *Queries) RenameWebAuthnCredential(ctx context.Context, arg RenameWebAuthnCredentialParams) (WebauthnCredential, error) {
+	row := q.db.QueryRow(ctx, renameWebAuthnCredential, arg.ID, arg.UserID, arg.Name)
+	var i WebauthnCredential
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.CredentialID,
+		&i.Credential,
+		&i.Name,
+		&i.CreatedAt,
+		&i.LastUsedAt,
+	)
+	return i, err
+}
+
+const renewSession = `-- name: RenewSession :one
+UPDATE sessions
+SET token = $2, expires_at = $3
+WHERE id = $1 AND expires_at > CURRENT_TIMESTAMP
+RETURNING id, user_id, token, expires_at, created_at, ip_address, user_agent, last_seen_at
+`
+
+type RenewSessionParams struct {
+	ID        pgtype.UUID
+	Token     string
+	ExpiresAt pgtype.Timestamptz
+}
+
+func (q *Queries) RenewSession(ctx context.Context, arg RenewSessionParams) (Session, error) {
+	row := q.db.QueryRow(ctx, renewSession, arg.ID, arg.Token, arg.ExpiresAt)
+	var i Session
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Token,
+		&i.ExpiresAt,
+		&i.CreatedAt,
+		&i.IpAddress,
+		&i.UserAgent,
+		&i.LastSeenAt,
+	)
+	return i, err
+}
+
+const reserveFileRequestUpload = `-- name: ReserveFileRequestUpload :execrows
+UPDATE file_requests
+SET upload_count = upload_count + 1
+WHERE id = $1
+  AND expires_at > CURRENT_TIMESTAMP
+  AND (max_files = -1 OR upload_count < max_files)
+`
+
+func (q *Queries) ReserveFileRequestUpload(ctx context.Context, id pgtype.UUID) (int64, error) {
+	result, err := q.db.Exec(ctx, reserveFileRequestUpload, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const resetFailedLogins = `-- name: ResetFailedLogins :exec
+UPDATE users
+SET failed_login_count = 0, last_failed_login_at = NULL, locked_until = NULL
+WHERE id = $1 AND (failed_login_count > 0 OR locked_until IS NOT NULL)
+`
+
+func (q *Queries) ResetFailedLogins(ctx context.Context, id pgtype.UUID) error {
+	_, err := q.db.Exec(ctx, resetFailedLogins, id)
+	return err
+}
+
+const restoreDocument = `-- name: RestoreDocument :one
+UPDATE documents
+SET deleted_at = NULL, deleted_by = NULL, updated_at = CURRENT_TIMESTAMP
+WHERE id = $1 AND workspace_id = $2 AND deleted_at > $3
+RETURNING id, user_id, filename, file_path, encrypted_key, file_size, mime_type, checksum, created_at, updated_at, folder_id, workspace_id, deleted_at, deleted_by
+`
+
+type RestoreDocumentParams struct {
+	ID          pgtype.UUID
+	WorkspaceID pgtype.UUID
+	Cutoff      pgtype.Timestamptz
+}
+
+// Restores a document trashed after the cutoff, the start of the window
+// in which documents can be restored
+func (q *Queries) RestoreDocument(ctx context.Context, arg RestoreDocumentParams) (Document, error) {
+	row := q.db.QueryRow(ctx, restoreDocument, arg.ID, arg.WorkspaceID, arg.Cutoff)
+	var i Document
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Filename,
+		&i.FilePath,
+		&i.EncryptedKey,
+		&i.FileSize,
+		&i.MimeType,
+		&i.Checksum,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.FolderID,
+		&i.WorkspaceID,
+		&i.DeletedAt,
+		&i.DeletedBy,
+	)
+	return i, err
+}
+
+const revokeDocumentGrant = `-- name: RevokeDocumentGrant :one
+DELETE FROM document_grants WHERE id = $1 AND document_id = $2
+RETURNING id, document_id, user_id, team_id, permission, granted_by, created_at
+`
+
+type RevokeDocumentGrantParams struct {
+	ID         pgtype.UUID
+	DocumentID pgtype.UUID
+}
+
+func (q *Queries) RevokeDocumentGrant(ctx context.Context, arg RevokeDocumentGrantParams) (DocumentGrant, error) {
+	row := q.db.QueryRow(ctx, revokeDocumentGrant, arg.ID, arg.DocumentID)
+	var i DocumentGrant
+	err := row.Scan(
+		&i.ID,
+		&i.DocumentID,
+		&i.UserID,
+		&i.TeamID,
+		&i.Permission,
+		&i.GrantedBy,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const scheduleUserDeletion = `-- name: ScheduleUserDeletion :one
+UPDATE users
+SET delete_after = $2, updated_at = CURRENT_TIMESTAMP
+WHERE id = $1
+RETURNING id, email, password_hash, full_name, created_at, updated_at, is_active, default_allowed_cidrs, is_admin, totp_secret, totp_enabled, totp_last_step, email_verified_at, failed_login_count, last_failed_login_at, locked_until, is_legal, delete_after, last_login_attempt_at
+`
+
+type ScheduleUserDeletionParams struct {
+	ID          pgtype.UUID
+	DeleteAfter pgtype.Timestamptz
+}
+
+func (q *Queries) ScheduleUserDeletion(ctx context.Context, arg ScheduleUserDeletionParams) (User, error) {
+	row := q.db.QueryRow(ctx, scheduleUserDeletion, arg.ID, arg.DeleteAfter)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.Email,
+		&i.PasswordHash,
+		&i.FullName,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.IsActive,
+		&i.DefaultAllowedCidrs,
+		&i.IsAdmin,
+		&i.TotpSecret,
+		&i.TotpEnabled,
+		&i.TotpLastStep,
+		&i.EmailVerifiedAt,
+		&i.FailedLoginCount,
+		&i.LastFailedLoginAt,
+		&i.LockedUntil,
+		&i.IsLegal,
+		&i.DeleteAfter,
+		&i.LastLoginAttemptAt,
+	)
+	return i, err
+}
+
+const searchUsers = `-- name: SearchUsers :many
+SELECT u.id, u.email, u.full_name, u.is_active, u.is_admin, u.is_legal, u.totp_enabled, u.locked_until, u.created_at,
+    COALESCE(su.document_count, 0)::bigint AS document_count,
+    COALESCE(su.used_bytes, 0)::bigint AS storage_bytes
+FROM users u
+LEFT JOIN storage_usage su ON su.user_id = u.id
+WHERE u.email ILIKE '%' || $1::text || '%' OR u.full_name ILIKE '%' || $1::text || '%'
+ORDER BY u.email
+LIMIT $2 OFFSET $3
+`
+
+type SearchUsersParams struct {
+	Query  string
+	Limit  int32
+	Offset int32
+}
+
+type SearchUsersRow struct {
+	ID            pgtype.UUID
+	Email         string
+	FullName      string
+	IsActive      pgtype.Bool
+	IsAdmin       bool
+	IsLegal       bool
+	TotpEnabled   bool
+	LockedUntil   pgtype.Timestamptz
+	CreatedAt     pgtype.Timestamptz
+	DocumentCount int64
+	StorageBytes  int64
+}
+
+// Admin console
+func (q *Queries) SearchUsers(ctx context.Context, arg SearchUsersParams) ([]SearchUsersRow, error) {
+	rows, err := q.db.Query(ctx, searchUsers, arg.Query, arg.Limit, arg.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []SearchUsersRow
+	for rows.Next() {
+		var i SearchUsersRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Email,
+			&i.FullName,
+			&i.IsActive,
+			&i.IsAdmin,
+			&i.IsLegal,
+			&i.TotpEnabled,
+			&i.LockedUntil,
+			&i.CreatedAt,
+			&i.DocumentCount,
+			&i.StorageBytes,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const setDocumentTags = `-- name: SetDocumentTags :exec
+WITH removed AS (
+    DELETE FROM document_tags WHERE document_id = $1 AND tag <> ALL($2::text[])
+)
+INSERT INTO document_tags (document_id, tag)
+SELECT $1, unnest($2::text[])
+ON CONFLICT DO NOTHING
+`
+
+type SetDocumentTagsParams struct {
+	DocumentID pgtype.UUID
+	Tags       []string
+}
+
+// Replaces the tags of a document in one statement
+func (q *Queries) SetDocumentTags(ctx context.Context, arg SetDocumentTagsParams) error {
+	_, err := q.db.Exec(ctx, setDocumentTags, arg.DocumentID, arg.Tags)
+	return err
+}
+
+const setOrganizationQuota = `-- name: SetOrganizationQuota :one
+INSERT INTO storage_usage (organization_id, plan, quota_bytes, quota_documents)
+VALUES ($1, $2, $3, $4)
+ON CONFLICT (organization_id) DO UPDATE SET
+    plan = EXCLUDED.plan,
+    quota_bytes = EXCLUDED.quota_bytes,
+    quota_documents = EXCLUDED.quota_documents,
+    updated_at = CURRENT_TIMESTAMP
+RETURNING id, user_id, organization_id, plan, quota_bytes, quota_documents, used_bytes, document_count, updated_at
+`
+
+type SetOrganizationQuotaParams struct {
+	OrganizationID pgtype.UUID
+	Plan           string
+	QuotaBytes     pgtype.Int8
+	QuotaDocuments pgtype.Int4
+}
+
+func (q *Queries) SetOrganizationQuota(ctx context.Context, arg SetOrganizationQuotaParams) (StorageUsage, error) {
+	row := q.db.QueryRow(ctx, setOrganizationQuota,
+		arg.OrganizationID,
+		arg.Plan,
+		arg.QuotaBytes,
+		arg.QuotaDocuments,
+	)
+	var i StorageUsage
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.OrganizationID,
+		&i.Plan,
+		&i.QuotaBytes,
+		&i.QuotaDocuments,
+		&i.UsedBytes,
+		&i.DocumentCount,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
+
+const setOrganizationRequireMFA = `-- name: SetOrganizationRequireMFA :one
+UPDATE organizations SET require_mfa = $2
+WHERE id = $1
+RETURNING id, name, created_at, require_mfa
+`
+
+type SetOrganizationRequireMFAParams struct {
+	ID         pgtype.UUID
+	RequireMfa bool
+}
+
+func (q *Queries) SetOrganizationRequireMFA(ctx context.Context, arg SetOrganizationRequireMFAParams) (Organization, error) {
+	row := q.db.QueryRow(ctx, setOrganizationRequireMFA, arg.ID, arg.RequireMfa)
+	var i Organization
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.CreatedAt,
+		&i.RequireMfa,
+	)
+	return i, err
+}
+
+const setUserActive = `-- name: SetUserActive :one
+UPDATE users
+SET is_active = $2, failed_login_count = 0, last_failed_login_at = NULL, locked_until = NULL, updated_at = CURRENT_TIMESTAMP
+WHERE id = $1
+RETURNING id, email, password_hash, full_name, created_at, updated_at, is_active, default_allowed_cidrs, is_admin, totp_secret, totp_enabled, totp_last_step, email_verified_at, failed_login_count, last_failed_login_at, locked_until, is_legal, delete_after, last_login_attempt_at
+`
+
+type SetUserActiveParams struct {
+	ID       pgtype.UUID
+	IsActive pgtype.Bool
+}
+
+func (q *Queries) SetUserActive(ctx context.Context, arg SetUserActiveParams) (User, error) {
+	row := q.db.QueryRow(ctx, setUserActive, arg.ID, arg.IsActive)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.Email,
+		&i.PasswordHash,
+		&i.FullName,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.IsActive,
+		&i.DefaultAllowedCidrs,
+		&i.IsAdmin,
+		&i.TotpSecret,
+		&i.TotpEnabled,
+		&i.TotpLastStep,
+		&i.EmailVerifiedAt,
+		&i.FailedLoginCount,
+		&i.LastFailedLoginAt,
+		&i.LockedUntil,
+		&i.IsLegal,
+		&i.DeleteAfter,
+		&i.LastLoginAttemptAt,
+	)
+	return i, err
+}
+
+const setUserLegal = `-- name: SetUserLegal :one
+UPDATE users SET is_legal = $2, updated_at = CURRENT_TIMESTAMP
+WHERE id = $1
+RETURNING id, email, password_hash, full_name, created_at, updated_at, is_active, default_allowed_cidrs, is_admin, totp_secret, totp_enabled, totp_last_step, email_verified_at, failed_login_count, last_failed_login_at, locked_until, is_legal, delete_after, last_login_attempt_at
+`
+
+type SetUserLegalParams struct {
+	ID      pgtype.UUID
+	IsLegal bool
+}
+
+func (q *Queries) SetUserLegal(ctx context.Context, arg SetUserLegalParams) (User, error) {
+	row := q.db.QueryRow(ctx, setUserLegal, arg.ID, arg.IsLegal)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.Email,
+		&i.PasswordHash,
+		&i.FullName,
 		&i.CreatedAt,
-		&i.IpAddress,
-		&i.UserAgent,
+		&i.UpdatedAt,
+		&i.IsActive,
+		&i.DefaultAllowedCidrs,
+		&i.IsAdmin,
+		&i.TotpSecret,
+		&i.TotpEnabled,
+		&i.TotpLastStep,
+		&i.EmailVerifiedAt,
+		&i.FailedLoginCount,
+		&i.LastFailedLoginAt,
+		&i.LockedUntil,
+		&i.IsLegal,
+		&i.DeleteAfter,
+		&i.LastLoginAttemptAt,
 	)
 	return i, err
 }
 
-const createShare = `-- name: CreateShare :one
-INSERT INTO shares (document_id, share_token, expires_at, max_access, password_hash, created_by)
-VALUES ($1, $2, $3, $4, $5, $6)
-RETURNING id, document_id, share_token, expires_at, max_access, access_count, password_hash, created_at, created_by
+const setUserQuota = `-- name: SetUserQuota :one
+INSERT INTO storage_usage (user_id, plan, quota_bytes, quota_documents)
+VALUES ($1, $2, $3, $4)
+ON CONFLICT (user_id) DO UPDATE SET
+    plan = EXCLUDED.plan,
+    quota_bytes = EXCLUDED.quota_bytes,
+    quota_documents = EXCLUDED.quota_documents,
+    updated_at = CURRENT_TIMESTAMP
+RETURNING id, user_id, organization_id, plan, quota_bytes, quota_documents, used_bytes, document_count, updated_at
 `
 
-type CreateShareParams struct {
-	DocumentID   pgtype.UUID
-	ShareToken   string
-	ExpiresAt    pgtype.Timestamptz
-	MaxAccess    pgtype.Int4
-	PasswordHash pgtype.Text
-	CreatedBy    pgtype.UUID
+type SetUserQuotaParams struct {
+	UserID         pgtype.UUID
+	Plan           string
+	QuotaBytes     pgtype.Int8
+	QuotaDocuments pgtype.Int4
 }
 
-// Shares
-func (q *Queries) CreateShare(ctx context.Context, arg CreateShareParams) (Share, error) {
-	row := q.db.QueryRow(ctx, createShare,
-		arg.DocumentID,
-		arg.ShareToken,
-		arg.ExpiresAt,
-		arg.MaxAccess,
-		arg.PasswordHash,
-		arg.CreatedBy,
+func (q *Queries) SetUserQuota(ctx context.Context, arg SetUserQuotaParams) (StorageUsage, error) {
+	row := q.db.QueryRow(ctx, setUserQuota,
+		arg.UserID,
+		arg.Plan,
+		arg.QuotaBytes,
+		arg.QuotaDocuments,
 	)
-	var i Share
+	var i StorageUsage
 	err := row.Scan(
 		&i.ID,
-		&i.DocumentID,
-		&i.ShareToken,
-		&i.ExpiresAt,
-		&i.MaxAccess,
-		&i.AccessCount,
-		&i.PasswordHash,
-		&i.CreatedAt,
-		&i.CreatedBy,
+		&i.UserID,
+		&i.OrganizationID,
+		&i.Plan,
+		&i.QuotaBytes,
+		&i.QuotaDocuments,
+		&i.UsedBytes,
+		&i.DocumentCount,
+		&i.UpdatedAt,
 	)
 	return i, err
 }
 
-const createUser = `-- name: CreateUser :one
-INSERT INTO users (email, password_hash, full_name)
-VALUES ($1, $2, $3)
-RETURNING id, email, password_hash, full_name, created_at, updated_at, is_active
+const setUserTOTPSecret = `-- name: SetUserTOTPSecret :one
+UPDATE users
+SET totp_secret = $2, totp_enabled = FALSE, totp_last_step = 0, updated_at = CURRENT_TIMESTAMP
+WHERE id = $1
+RETURNING id, email, password_hash, full_name, created_at, updated_at, is_active, default_allowed_cidrs, is_admin, totp_secret, totp_enabled, totp_last_step, email_verified_at, failed_login_count, last_failed_login_at, locked_until, is_legal, delete_after, last_login_attempt_at
 `
 
-type CreateUserParams struct {
-	Email        string
-	PasswordHash string
-	FullName     string
+type SetUserTOTPSecretParams struct {
+	ID         pgtype.UUID
+	TotpSecret pgtype.Text
 }
 
-// Users
-func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (User, error) {
-	row := q.db.QueryRow(ctx, createUser, arg.Email, arg.PasswordHash, arg.FullName)
+func (q *Queries) SetUserTOTPSecret(ctx context.Context, arg SetUserTOTPSecretParams) (User, error) {
+	row := q.db.QueryRow(ctx, setUserTOTPSecret, arg.ID, arg.TotpSecret)
 	var i User
 	err := row.Scan(
 		&i.ID,
@@ -155,66 +5077,143 @@ func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (User, e
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.IsActive,
+		&i.DefaultAllowedCidrs,
+		&i.IsAdmin,
+		&i.TotpSecret,
+		&i.TotpEnabled,
+		&i.TotpLastStep,
+		&i.EmailVerifiedAt,
+		&i.FailedLoginCount,
+		&i.LastFailedLoginAt,
+		&i.LockedUntil,
+		&i.IsLegal,
+		&i.DeleteAfter,
+		&i.LastLoginAttemptAt,
 	)
 	return i, err
 }
 
-const deleteDocument = `-- name: DeleteDocument :exec
-DELETE FROM documents WHERE id = $1 AND user_id = $2
+const startDataExport = `-- name: StartDataExport :execrows
+UPDATE data_exports
+SET status = 'running'
+WHERE id = $1 AND status IN ('pending', 'running')
 `
 
-type DeleteDocumentParams struct {
-	ID     pgtype.UUID
-	UserID pgtype.UUID
+// Claims an export for the worker. A running export is claimed again so
+// that a retried job picks up where the failed one left off.
+func (q *Queries) StartDataExport(ctx context.Context, id pgtype.UUID) (int64, error) {
+	result, err := q.db.Exec(ctx, startDataExport, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
 }
 
-func (q *Queries) DeleteDocument(ctx context.Context, arg DeleteDocumentParams) error {
-	_, err := q.db.Exec(ctx, deleteDocument, arg.ID, arg.UserID)
-	return err
+const takeOIDCAuthRequest = `-- name: TakeOIDCAuthRequest :one
+DELETE FROM oidc_auth_requests
+WHERE state_hash = $1 AND expires_at > CURRENT_TIMESTAMP
+RETURNING id, state_hash, provider, code_verifier, nonce, expires_at, created_at
+`
+
+func (q *Queries) TakeOIDCAuthRequest(ctx context.Context, stateHash string) (OidcAuthRequest, error) {
+	row := q.db.QueryRow(ctx, takeOIDCAuthRequest, stateHash)
+	var i OidcAuthRequest
+	err := row.Scan(
+		&i.ID,
+		&i.StateHash,
+		&i.Provider,
+		&i.CodeVerifier,
+		&i.Nonce,
+		&i.ExpiresAt,
+		&i.CreatedAt,
+	)
+	return i, err
 }
 
-const deleteExpiredSessions = `-- name: DeleteExpiredSessions :exec
-DELETE FROM sessions WHERE expires_at < CURRENT_TIMESTAMP
+const takeWebAuthnChallenge = `-- name: TakeWebAuthnChallenge :one
+DELETE FROM webauthn_challenges
+WHERE id = $1 AND purpose = $2 AND expires_at > CURRENT_TIMESTAMP
+RETURNING id, user_id, purpose, session_data, expires_at, created_at
 `
 
-func (q *Queries) DeleteExpiredSessions(ctx context.Context) error {
-	_, err := q.db.Exec(ctx, deleteExpiredSessions)
-	return err
+type TakeWebAuthnChallengeParams struct {
+	ID      pgtype.UUID
+	Purpose string
 }
 
-const deleteExpiredShares = `-- name: DeleteExpiredShares :exec
-DELETE FROM shares WHERE expires_at < CURRENT_TIMESTAMP
+func (q *Queries) TakeWebAuthnChallenge(ctx context.Context, arg TakeWebAuthnChallengeParams) (WebauthnChallenge, error) {
+	row := q.db.QueryRow(ctx, takeWebAuthnChallenge, arg.ID, arg.Purpose)
+	var i WebauthnChallenge
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Purpose,
+		&i.SessionData,
+		&i.ExpiresAt,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const touchAPIKey = `-- name: TouchAPIKey :exec
+UPDATE api_keys
+SET last_used_at = CURRENT_TIMESTAMP, last_used_ip = $2
+WHERE id = $1
 `
 
-func (q *Queries) DeleteExpiredShares(ctx context.Context) error {
-	_, err := q.db.Exec(ctx, deleteExpiredShares)
+type TouchAPIKeyParams struct {
+	ID         pgtype.UUID
+	LastUsedIp *netip.Addr
+}
+
+func (q *Queries) TouchAPIKey(ctx context.Context, arg TouchAPIKeyParams) error {
+	_, err := q.db.Exec(ctx, touchAPIKey, arg.ID, arg.LastUsedIp)
 	return err
 }
 
-const deleteSession = `-- name: DeleteSession :exec
-DELETE FROM sessions WHERE id = $1
+const touchSession = `-- name: TouchSession :exec
+UPDATE sessions
+SET last_seen_at = CURRENT_TIMESTAMP
+WHERE id = $1
 `
 
-func (q *Queries) DeleteSession(ctx context.Context, id pgtype.UUID) error {
-	_, err := q.db.Exec(ctx, deleteSession, id)
+func (q *Queries) TouchSession(ctx context.Context, id pgtype.UUID) error {
+	_, err := q.db.Exec(ctx, touchSession, id)
 	return err
 }
 
-const deleteUser = `-- name: DeleteUser :exec
-DELETE FROM users WHERE id = $1
+const touchUserIdentity = `-- name: TouchUserIdentity :exec
+UPDATE user_identities
+SET email = $2, last_login_at = CURRENT_TIMESTAMP
+WHERE id = $1
 `
 
-func (q *Queries) DeleteUser(ctx context.Context, id pgtype.UUID) error {
-	_, err := q.db.Exec(ctx, deleteUser, id)
+type TouchUserIdentityParams struct {
+	ID    pgtype.UUID
+	Email string
+}
+
+func (q *Queries) TouchUserIdentity(ctx context.Context, arg TouchUserIdentityParams) error {
+	_, err := q.db.Exec(ctx, touchUserIdentity, arg.ID, arg.Email)
 	return err
 }
 
-const getDocumentByID = `-- name: GetDocumentByID :one
-SELECT id, user_id, filename, file_path, encrypted_key, file_size, mime_type, checksum, created_at, updated_at FROM documents WHERE id = $1
+const trashDocument = `-- name: TrashDocument :one
+UPDATE documents
+SET deleted_at = CURRENT_TIMESTAMP, deleted_by = $3
+WHERE id = $1 AND workspace_id = $2 AND deleted_at IS NULL
+RETURNING id, user_id, filename, file_path, encrypted_key, file_size, mime_type, checksum, created_at, updated_at, folder_id, workspace_id, deleted_at, deleted_by
 `
 
-func (q *Queries) GetDocumentByID(ctx context.Context, id pgtype.UUID) (Document, error) {
-	row := q.db.QueryRow(ctx, getDocumentByID, id)
+type TrashDocumentParams struct {
+	ID          pgtype.UUID
+	WorkspaceID pgtype.UUID
+	DeletedBy   pgtype.UUID
+}
+
+// Recycle bin
+func (q *Queries) TrashDocument(ctx context.Context, arg TrashDocumentParams) (Document, error) {
+	row := q.db.QueryRow(ctx, trashDocument, arg.ID, arg.WorkspaceID, arg.DeletedBy)
 	var i Document
 	err := row.Scan(
 		&i.ID,
@@ -227,79 +5226,137 @@ func (q *Queries) GetDocumentByID(ctx context.Context, id pgtype.UUID) (Document
 		&i.Checksum,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.FolderID,
+		&i.WorkspaceID,
+		&i.DeletedAt,
+		&i.DeletedBy,
 	)
 	return i, err
 }
 
-const getSessionByToken = `-- name: GetSessionByToken :one
-SELECT id, user_id, token, expires_at, created_at, ip_address, user_agent FROM sessions WHERE token = $1
+const updateDocumentFolder = `-- name: UpdateDocumentFolder :exec
+UPDATE documents
+SET folder_id = $2, updated_at = CURRENT_TIMESTAMP
+WHERE id = $1 AND workspace_id = $3
 `
 
-func (q *Queries) GetSessionByToken(ctx context.Context, token string) (Session, error) {
-	row := q.db.QueryRow(ctx, getSessionByToken, token)
-	var i Session
+type UpdateDocumentFolderParams struct {
+	ID          pgtype.UUID
+	FolderID    pgtype.UUID
+	WorkspaceID pgtype.UUID
+}
+
+func (q *Queries) UpdateDocumentFolder(ctx context.Context, arg UpdateDocumentFolderParams) error {
+	_, err := q.db.Exec(ctx, updateDocumentFolder, arg.ID, arg.FolderID, arg.WorkspaceID)
+	return err
+}
+
+const updateRetentionPolicy = `-- name: UpdateRetentionPolicy :one
+UPDATE retention_policies
+SET retain_months = $3, retain_days = $4, warn_days = $5, updated_at = CURRENT_TIMESTAMP
+WHERE id = $1 AND workspace_id = $2
+RETURNING id, workspace_id, folder_id, tag, retain_months, retain_days, warn_days, created_by, created_at, updated_at
+`
+
+type UpdateRetentionPolicyParams struct {
+	ID           pgtype.UUID
+	WorkspaceID  pgtype.UUID
+	RetainMonths int32
+	RetainDays   int32
+	WarnDays     int32
+}
+
+func (q *Queries) UpdateRetentionPolicy(ctx context.Context, arg UpdateRetentionPolicyParams) (RetentionPolicy, error) {
+	row := q.db.QueryRow(ctx, updateRetentionPolicy,
+		arg.ID,
+		arg.WorkspaceID,
+		arg.RetainMonths,
+		arg.RetainDays,
+		arg.WarnDays,
+	)
+	var i RetentionPolicy
 	err := row.Scan(
 		&i.ID,
-		&i.UserID,
-		&i.Token,
-		&i.ExpiresAt,
+		&i.WorkspaceID,
+		&i.FolderID,
+		&i.Tag,
+		&i.RetainMonths,
+		&i.RetainDays,
+		&i.WarnDays,
+		&i.CreatedBy,
 		&i.CreatedAt,
-		&i.IpAddress,
-		&i.UserAgent,
+		&i.UpdatedAt,
 	)
 	return i, err
 }
 
-const getShareByToken = `-- name: GetShareByToken :one
-SELECT s.id, s.document_id, s.share_token, s.expires_at, s.max_access, s.access_count, s.password_hash, s.created_at, s.created_by, d.filename, d.mime_type, d.file_size, d.file_path
-FROM shares s
-JOIN documents d ON s.document_id = d.id
-WHERE s.share_token = $1
+const updateShareAccess = `-- name: UpdateShareAccess :one
+UPDATE shares
+SET access_count = access_count + 1
+WHERE id = $1 AND (max_access = -1 OR access_count < max_access)
+RETURNING access_count
 `
 
-type GetShareByTokenRow struct {
-	ID           pgtype.UUID
-	DocumentID   pgtype.UUID
-	ShareToken   string
-	ExpiresAt    pgtype.Timestamptz
-	MaxAccess    pgtype.Int4
-	AccessCount  pgtype.Int4
-	PasswordHash pgtype.Text
-	CreatedAt    pgtype.Timestamptz
-	CreatedBy    pgtype.UUID
-	Filename     string
-	MimeType     string
-	FileSize     int64
-	FilePath     string
+func (q *Queries) UpdateShareAccess(ctx context.Context, id pgtype.UUID) (pgtype.Int4, error) {
+	row := q.db.QueryRow(ctx, updateShareAccess, id)
+	var accessCount pgtype.Int4
+	err := row.Scan(&accessCount)
+	return accessCount, err
 }
 
-func (q *Queries) GetShareByToken(ctx context.Context, shareToken string) (GetShareByTokenRow, error) {
-	row := q.db.QueryRow(ctx, getShareByToken, shareToken)
-	var i GetShareByTokenRow
+const updateUser = `-- name: UpdateUser :one
+UPDATE users
+SET full_name = $2, updated_at = CURRENT_TIMESTAMP
+WHERE id = $1
+RETURNING id, email, password_hash, full_name, created_at, updated_at, is_active, default_allowed_cidrs, is_admin, totp_secret, totp_enabled, totp_last_step, email_verified_at, failed_login_count, last_failed_login_at, locked_until, is_legal, delete_after, last_login_attempt_at
+`
+
+type UpdateUserParams struct {
+	ID       pgtype.UUID
+	FullName string
+}
+
+func (q *Queries) UpdateUser(ctx context.Context, arg UpdateUserParams) (User, error) {
+	row := q.db.QueryRow(ctx, updateUser, arg.ID, arg.FullName)
+	var i User
 	err := row.Scan(
 		&i.ID,
-		&i.DocumentID,
-		&i.ShareToken,
-		&i.ExpiresAt,
-		&i.MaxAccess,
-		&i.AccessCount,
+		&i.Email,
 		&i.PasswordHash,
+		&i.FullName,
 		&i.CreatedAt,
-		&i.CreatedBy,
-		&i.Filename,
-		&i.MimeType,
-		&i.FileSize,
-		&i.FilePath,
+		&i.UpdatedAt,
+		&i.IsActive,
+		&i.DefaultAllowedCidrs,
+		&i.IsAdmin,
+		&i.TotpSecret,
+		&i.TotpEnabled,
+		&i.TotpLastStep,
+		&i.EmailVerifiedAt,
+		&i.FailedLoginCount,
+		&i.LastFailedLoginAt,
+		&i.LockedUntil,
+		&i.IsLegal,
+		&i.DeleteAfter,
+		&i.LastLoginAttemptAt,
 	)
 	return i, err
 }
 
-const getUserByEmail = `-- name: GetUserByEmail :one
-SELECT id, email, password_hash, full_name, created_at, updated_at, is_active FROM users WHERE email = $1
+const updateUserDefaultAllowedCIDRs = `-- name: UpdateUserDefaultAllowedCIDRs :one
+UPDATE users
+SET default_allowed_cidrs = $2, updated_at = CURRENT_TIMESTAMP
+WHERE id = $1
+RETURNING id, email, password_hash, full_name, created_at, updated_at, is_active, default_allowed_cidrs, is_admin, totp_secret, totp_enabled, totp_last_step, email_verified_at, failed_login_count, last_failed_login_at, locked_until, is_legal, delete_after, last_login_attempt_at
 `
 
-func (q *Queries) GetUserByEmail(ctx context.Context, email string) (User, error) {
-	row := q.db.QueryRow(ctx, getUserByEmail, email)
+type UpdateUserDefaultAllowedCIDRsParams struct {
+	ID                  pgtype.UUID
+	DefaultAllowedCidrs []netip.Prefix
+}
+
+func (q *Queries) UpdateUserDefaultAllowedCIDRs(ctx context.Context, arg UpdateUserDefaultAllowedCIDRsParams) (User, error) {
+	row := q.db.QueryRow(ctx, updateUserDefaultAllowedCIDRs, arg.ID, arg.DefaultAllowedCidrs)
 	var i User
 	err := row.Scan(
 		&i.ID,
@@ -309,16 +5366,36 @@ func (q *Queries) GetUserByEmail(ctx context.Context, email string) (User, error
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.IsActive,
+		&i.DefaultAllowedCidrs,
+		&i.IsAdmin,
+		&i.TotpSecret,
+		&i.TotpEnabled,
+		&i.TotpLastStep,
+		&i.EmailVerifiedAt,
+		&i.FailedLoginCount,
+		&i.LastFailedLoginAt,
+		&i.LockedUntil,
+		&i.IsLegal,
+		&i.DeleteAfter,
+		&i.LastLoginAttemptAt,
 	)
 	return i, err
 }
 
-const getUserByID = `-- name: GetUserByID :one
-SELECT id, email, password_hash, full_name, created_at, updated_at, is_active FROM users WHERE id = $1
+const updateUserPassword = `-- name: UpdateUserPassword :one
+UPDATE users
+SET password_hash = $2, updated_at = CURRENT_TIMESTAMP
+WHERE id = $1
+RETURNING id, email, password_hash, full_name, created_at, updated_at, is_active, default_allowed_cidrs, is_admin, totp_secret, totp_enabled, totp_last_step, email_verified_at, failed_login_count, last_failed_login_at, locked_until, is_legal, delete_after, last_login_attempt_at
 `
 
-func (q *Queries) GetUserByID(ctx context.Context, id pgtype.UUID) (User, error) {
-	row := q.db.QueryRow(ctx, getUserByID, id)
+type UpdateUserPasswordParams struct {
+	ID           pgtype.UUID
+	PasswordHash string
+}
+
+func (q *Queries) UpdateUserPassword(ctx context.Context, arg UpdateUserPasswordParams) (User, error) {
+	row := q.db.QueryRow(ctx, updateUserPassword, arg.ID, arg.PasswordHash)
 	var i User
 	err := row.Scan(
 		&i.ID,
@@ -328,79 +5405,137 @@ func (q *Queries) GetUserByID(ctx context.Context, id pgtype.UUID) (User, error)
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.IsActive,
+		&i.DefaultAllowedCidrs,
+		&i.IsAdmin,
+		&i.TotpSecret,
+		&i.TotpEnabled,
+		&i.TotpLastStep,
+		&i.EmailVerifiedAt,
+		&i.FailedLoginCount,
+		&i.LastFailedLoginAt,
+		&i.LockedUntil,
+		&i.IsLegal,
+		&i.DeleteAfter,
+		&i.LastLoginAttemptAt,
 	)
 	return i, err
 }
 
-const listDocumentsByUser = `-- name: ListDocumentsByUser :many
-SELECT id, user_id, filename, file_path, encrypted_key, file_size, mime_type, checksum, created_at, updated_at FROM documents WHERE user_id = $1 ORDER BY created_at DESC
+const updateWebAuthnCredentialUsage = `-- name: UpdateWebAuthnCredentialUsage :exec
+UPDATE webauthn_credentials
+SET credential = $2, last_used_at = CURRENT_TIMESTAMP
+WHERE credential_id = $1
 `
 
-func (q *Queries) ListDocumentsByUser(ctx context.Context, userID pgtype.UUID) ([]Document, error) {
-	rows, err := q.db.Query(ctx, listDocumentsByUser, userID)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-	var items []Document
-	for rows.Next() {
-		var i Document
-		if err := rows.Scan(
-			&i.ID,
-			&i.UserID,
-			&i.Filename,
-			&i.FilePath,
-			&i.EncryptedKey,
-			&i.FileSize,
-			&i.MimeType,
-			&i.Checksum,
-			&i.CreatedAt,
-			&i.UpdatedAt,
-		); err != nil {
-			return nil, err
-		}
-		items = append(items, i)
-	}
-	if err := rows.Err(); err != nil {
-		return nil, err
-	}
-	return items, nil
+type UpdateWebAuthnCredentialUsageParams struct {
+	CredentialID []byte
+	Credential   []byte
 }
 
-const updateShareAccess = `-- name: UpdateShareAccess :exec
-UPDATE shares
-SET access_count = access_count + 1
-WHERE id = $1 AND (max_access = -1 OR access_count < max_access)
+func (q *Queries) UpdateWebAuthnCredentialUsage(ctx context.Context, arg UpdateWebAuthnCredentialUsageParams) error {
+	_, err := q.db.Exec(ctx, updateWebAuthnCredentialUsage, arg.CredentialID, arg.Credential)
+	return err
+}
+
+const useAccountToken = `-- name: UseAccountToken :one
+UPDATE account_tokens
+SET used_at = CURRENT_TIMESTAMP
+WHERE token_hash = $1 AND purpose = $2 AND used_at IS NULL AND expires_at > CURRENT_TIMESTAMP
+RETURNING id, user_id, purpose, token_hash, expires_at, used_at, created_at
 `
 
-func (q *Queries) UpdateShareAccess(ctx context.Context, id pgtype.UUID) error {
-	_, err := q.db.Exec(ctx, updateShareAccess, id)
-	return err
+type UseAccountTokenParams struct {
+	TokenHash string
+	Purpose   string
 }
 
-const updateUser = `-- name: UpdateUser :one
-UPDATE users
-SET full_name = $2, updated_at = CURRENT_TIMESTAMP
-WHERE id = $1
-RETURNING id, email, password_hash, full_name, created_at, updated_at, is_active
+func (q *Queries) UseAccountToken(ctx context.Context, arg UseAccountTokenParams) (AccountToken, error) {
+	row := q.db.QueryRow(ctx, useAccountToken, arg.TokenHash, arg.Purpose)
+	var i AccountToken
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Purpose,
+		&i.TokenHash,
+		&i.ExpiresAt,
+		&i.UsedAt,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const useRecoveryCode = `-- name: UseRecoveryCode :execrows
+UPDATE mfa_recovery_codes
+SET used_at = CURRENT_TIMESTAMP
+WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL
 `
 
-type UpdateUserParams struct {
-	ID       pgtype.UUID
-	FullName string
+type UseRecoveryCodeParams struct {
+	UserID   pgtype.UUID
+	CodeHash string
 }
 
-func (q *Queries) UpdateUser(ctx context.Context, arg UpdateUserParams) (User, error) {
-	row := q.db.QueryRow(ctx, updateUser, arg.ID, arg.FullName)
-	var i User
+func (q *Queries) UseRecoveryCode(ctx context.Context, arg UseRecoveryCodeParams) (int64, error) {
+	result, err := q.db.Exec(ctx, useRecoveryCode, arg.UserID, arg.CodeHash)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const useRefreshToken = `-- name: UseRefreshToken :one
+UPDATE refresh_tokens
+SET used_at = CURRENT_TIMESTAMP
+WHERE token_hash = $1 AND used_at IS NULL AND expires_at > CURRENT_TIMESTAMP
+RETURNING id, session_id, token_hash, expires_at, used_at, created_at
+`
+
+func (q *Queries) UseRefreshToken(ctx context.Context, tokenHash string) (RefreshToken, error) {
+	row := q.db.QueryRow(ctx, useRefreshToken, tokenHash)
+	var i RefreshToken
 	err := row.Scan(
 		&i.ID,
-		&i.Email,
-		&i.PasswordHash,
-		&i.FullName,
+		&i.SessionID,
+		&i.TokenHash,
+		&i.ExpiresAt,
+		&i.UsedAt,
 		&i.CreatedAt,
-		&i.UpdatedAt,
-		&i.IsActive,
 	)
 	return i, err
 }
+
+const useUserTOTPStep = `-- name: UseUserTOTPStep :execrows
+UPDATE users
+SET totp_last_step = $2
+WHERE id = $1 AND totp_last_step < $2
+`
+
+type UseUserTOTPStepParams struct {
+	ID           pgtype.UUID
+	TotpLastStep int64
+}
+
+func (q *Queries) UseUserTOTPStep(ctx context.Context, arg UseUserTOTPStepParams) (int64, error) {
+	result, err := q.db.Exec(ctx, useUserTOTPStep, arg.ID, arg.TotpLastStep)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const userRequiresMFA = `-- name: UserRequiresMFA :one
+SELECT EXISTS (
+    SELECT 1 FROM organization_members om
+    JOIN organizations o ON o.id = om.organization_id
+    WHERE om.user_id = $1 AND o.require_mfa
+) AS required
+`
+
+// UserRequiresMFA reports whether any organization the user belongs to
+// requires its members to use a second factor
+func (q *Queries) UserRequiresMFA(ctx context.Context, userID pgtype.UUID) (bool, error) {
+	row := q.db.QueryRow(ctx, userRequiresMFA, userID)
+	var required bool
+	err := row.Scan(&required)
+	return required, err
+}
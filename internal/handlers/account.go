@@ -0,0 +1,265 @@
+package handlers
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"Secure-Document-Exchange-Portal/internal/auth"
+	"Secure-Document-Exchange-Portal/internal/database"
+	"Secure-Document-Exchange-Portal/internal/services"
+	"Secure-Document-Exchange-Portal/internal/validation"
+	"Secure-Document-Exchange-Portal/templates"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+type AccountHandler struct {
+	db     *database.Queries
+	cache  *services.CachedRepository
+	quotas *services.QuotaService
+	audit  *services.AuditLog
+}
+
+func NewAccountHandler(db *database.Queries, cache *services.CachedRepository, quotas *services.QuotaService, audit *services.AuditLog) *AccountHandler {
+	return &AccountHandler{
+		db:     db,
+		cache:  cache,
+		quotas: quotas,
+		audit:  audit,
+	}
+}
+
+// Storage shows how much of their storage quota the current user uses
+func (h *AccountHandler) Storage(c *fiber.Ctx) error {
+	userID, err := auth.GetUserID(c)
+	if err != nil {
+		return err
+	}
+
+	usage, err := h.quotas.UserUsage(c.Context(), userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to load storage usage"})
+	}
+	return storageUsage(c, usage)
+}
+
+// GetAllowedNetworks returns the networks new shares are restricted to by default
+func (h *AccountHandler) GetAllowedNetworks(c *fiber.Ctx) error {
+	userID, err := auth.GetUserID(c)
+	if err != nil {
+		return err
+	}
+
+	user, err := h.db.GetUserByID(c.Context(), pgtype.UUID{Bytes: userID, Valid: true})
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
+	}
+
+	return c.JSON(fiber.Map{
+		"allowed_cidrs": formatCIDRList(user.DefaultAllowedCidrs),
+	})
+}
+
+// UpdateAllowedNetworks sets the account's default share network allowlist.
+// Existing shares keep the allowlist they were created with.
+func (h *AccountHandler) UpdateAllowedNetworks(c *fiber.Ctx) error {
+	userID, err := auth.GetUserID(c)
+	if err != nil {
+		return err
+	}
+
+	allowedCIDRs, err := validation.ParseCIDRList(c.FormValue("allowed_cidrs"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	user, err := h.db.UpdateUserDefaultAllowedCIDRs(c.Context(), database.UpdateUserDefaultAllowedCIDRsParams{
+		ID:                  pgtype.UUID{Bytes: userID, Valid: true},
+		DefaultAllowedCidrs: allowedCIDRs,
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update allowed networks"})
+	}
+	h.cache.InvalidateUser(c.Context(), userID, user.Email)
+	recordAudit(c, h.audit, services.AuditEvent{
+		Action:  services.AuditNetworksUpdated,
+		Details: map[string]string{"allowed_cidrs": strings.Join(formatCIDRList(user.DefaultAllowedCidrs), ",")},
+	})
+
+	return c.JSON(fiber.Map{
+		"allowed_cidrs": formatCIDRList(user.DefaultAllowedCidrs),
+	})
+}
+
+// Sessions lists the user's active login sessions
+func (h *AccountHandler) Sessions(c *fiber.Ctx) error {
+	userID, err := auth.GetUserID(c)
+	if err != nil {
+		return err
+	}
+
+	return h.renderSessions(c, userID)
+}
+
+// RevokeSession signs out one of the user's other sessions
+func (h *AccountHandler) RevokeSession(c *fiber.Ctx) error {
+	userID, err := auth.GetUserID(c)
+	if err != nil {
+		return err
+	}
+	currentID, err := auth.GetSessionID(c)
+	if err != nil {
+		return err
+	}
+
+	sessionID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid session ID"})
+	}
+	if sessionID == currentID {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Use logout to end the current session"})
+	}
+
+	deleted, err := h.db.DeleteUserSession(c.Context(), database.DeleteUserSessionParams{
+		ID:     pgtype.UUID{Bytes: sessionID, Valid: true},
+		UserID: pgtype.UUID{Bytes: userID, Valid: true},
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to revoke session"})
+	}
+	if deleted == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Session not found"})
+	}
+	h.cache.InvalidateSession(c.Context(), sessionID)
+	recordAudit(c, h.audit, services.AuditEvent{
+		Action:       services.AuditSessionRevoked,
+		ResourceType: "session",
+		ResourceID:   sessionID.String(),
+	})
+
+	if c.Get("HX-Request") == "true" {
+		return h.renderSessions(c, userID)
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// RevokeOtherSessions signs out every session except the current one
+func (h *AccountHandler) RevokeOtherSessions(c *fiber.Ctx) error {
+	userID, err := auth.GetUserID(c)
+	if err != nil {
+		return err
+	}
+	currentID, err := auth.GetSessionID(c)
+	if err != nil {
+		return err
+	}
+
+	revoked, err := h.db.DeleteOtherUserSessions(c.Context(), database.DeleteOtherUserSessionsParams{
+		UserID: pgtype.UUID{Bytes: userID, Valid: true},
+		ID:     pgtype.UUID{Bytes: currentID, Valid: true},
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to revoke sessions"})
+	}
+	h.cache.InvalidateSessions(c.Context(), revoked)
+	recordAudit(c, h.audit, services.AuditEvent{
+		Action:  services.AuditOtherSessionsRevoke,
+		Details: map[string]string{"revoked": strconv.Itoa(len(revoked))},
+	})
+
+	if c.Get("HX-Request") == "true" {
+		return h.renderSessions(c, userID)
+	}
+	return c.JSON(fiber.Map{"revoked": len(revoked)})
+}
+
+func (h *AccountHandler) renderSessions(c *fiber.Ctx, userID uuid.UUID) error {
+	currentID, _ := auth.GetSessionID(c)
+
+	sessions, err := h.db.ListUserSessions(c.Context(), pgtype.UUID{Bytes: userID, Valid: true})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to list sessions"})
+	}
+
+	if c.Get("Accept") == "text/html" || c.Get("HX-Request") == "true" {
+		var items []templates.SessionInfo
+		for _, session := range sessions {
+			lastSeen := session.CreatedAt.Time
+			if session.LastSeenAt.Valid {
+				lastSeen = session.LastSeenAt.Time
+			}
+			ipAddress := "Unknown IP"
+			if session.IpAddress != nil {
+				ipAddress = session.IpAddress.String()
+			}
+			items = append(items, templates.SessionInfo{
+				ID:         session.ID.String(),
+				Device:     describeUserAgent(session.UserAgent.String),
+				UserAgent:  session.UserAgent.String,
+				IPAddress:  ipAddress,
+				CreatedAt:  session.CreatedAt.Time.Format("2006-01-02 15:04"),
+				LastSeenAt: lastSeen.Format("2006-01-02 15:04"),
+				Current:    session.ID.Bytes == currentID,
+			})
+		}
+		c.Set("Content-Type", "text/html")
+		return templates.SessionList(items).Render(c.Context(), c.Response().BodyWriter())
+	}
+
+	result := make([]fiber.Map, 0, len(sessions))
+	for _, session := range sessions {
+		item := fiber.Map{
+			"id":         session.ID.String(),
+			"user_agent": session.UserAgent.String,
+			"ip_address": session.IpAddress,
+			"created_at": session.CreatedAt.Time.Format(time.RFC3339),
+			"expires_at": session.ExpiresAt.Time.Format(time.RFC3339),
+			"current":    session.ID.Bytes == currentID,
+		}
+		if session.LastSeenAt.Valid {
+			item["last_seen_at"] = session.LastSeenAt.Time.Format(time.RFC3339)
+		}
+		result = append(result, item)
+	}
+
+	return c.JSON(result)
+}
+
+// describeUserAgent turns a user agent into a short "Browser on OS" label
+func describeUserAgent(userAgent string) string {
+	if userAgent == "" {
+		return "Unknown device"
+	}
+
+	browser := "Unknown browser"
+	for _, candidate := range []struct{ token, name string }{
+		{"Edg/", "Edge"},
+		{"OPR/", "Opera"},
+		{"Firefox/", "Firefox"},
+		{"Chrome/", "Chrome"},
+		{"Safari/", "Safari"},
+		{"curl/", "curl"},
+	} {
+		if strings.Contains(userAgent, candidate.token) {
+			browser = candidate.name
+			break
+		}
+	}
+
+	for _, candidate := range []struct{ token, name string }{
+		{"iPhone", "iPhone"},
+		{"iPad", "iPad"},
+		{"Android", "Android"},
+		{"Windows", "Windows"},
+		{"Mac OS X", "macOS"},
+		{"Linux", "Linux"},
+	} {
+		if strings.Contains(userAgent, candidate.token) {
+			return browser + " on " + candidate.name
+		}
+	}
+	return browser
+}
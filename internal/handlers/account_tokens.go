@@ -0,0 +1,296 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+
+	"Secure-Document-Exchange-Portal/internal/auth"
+	"Secure-Document-Exchange-Portal/internal/database"
+	"Secure-Document-Exchange-Portal/internal/models"
+	"Secure-Document-Exchange-Portal/internal/services"
+	"Secure-Document-Exchange-Portal/internal/validation"
+	"Secure-Document-Exchange-Portal/templates"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jackc/pgx/v5/pgtype"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Account token purposes. A token issued for one purpose cannot be used
+// for another.
+const (
+	accountTokenVerifyEmail   = "verify_email"
+	accountTokenPasswordReset = "password_reset"
+)
+
+const (
+	emailVerificationTTL = 24 * time.Hour
+	passwordResetTTL     = 30 * time.Minute
+)
+
+// Responses to requests for emails are the same whether or not an email was
+// sent, so they do not reveal which addresses have accounts
+const (
+	passwordResetSentMessage      = "If an account exists for this email address, we sent a link to reset its password."
+	verificationResentMessage     = "If this account still needs to be confirmed, we sent a new link."
+	invalidVerificationMessage    = "This confirmation link is invalid or has expired. Sign in to request a new one."
+	invalidPasswordResetMessage   = "This reset link is invalid or has expired. Please request a new one."
+	passwordResetCompletedMessage = "Your password has been changed and you were signed out everywhere. You can now sign in."
+)
+
+// VerifyEmail confirms a user's email address from the link in their
+// verification email
+func (h *AuthHandler) VerifyEmail(c *fiber.Ctx) error {
+	token, err := h.db.UseAccountToken(c.Context(), database.UseAccountTokenParams{
+		TokenHash: auth.HashToken(c.Query("token")),
+		Purpose:   accountTokenVerifyEmail,
+	})
+	if err != nil {
+		return h.renderLoginPage(c, fiber.StatusBadRequest, []string{invalidVerificationMessage}, "")
+	}
+
+	user, err := h.db.MarkUserEmailVerified(c.Context(), token.UserID)
+	if err != nil {
+		return h.renderLoginPage(c, fiber.StatusInternalServerError, []string{"Failed to confirm your email address"}, "")
+	}
+	h.cache.InvalidateUser(c.Context(), user.ID.Bytes, user.Email)
+	recordAudit(c, h.audit, services.AuditEvent{
+		ActorID:    user.ID.Bytes,
+		ActorEmail: user.Email,
+		Action:     services.AuditEmailVerified,
+	})
+
+	return h.renderLoginPage(c, fiber.StatusOK, nil, "Your email address is confirmed. You can now sign in.")
+}
+
+// ResendVerification sends a new verification link to an unconfirmed
+// account
+func (h *AuthHandler) ResendVerification(c *fiber.Ctx) error {
+	var req models.EmailRequest
+	if err := c.BodyParser(&req); err != nil || req.Email == "" {
+		req.Email = c.FormValue("email")
+	}
+
+	user, err := h.db.GetUserByEmail(c.Context(), strings.TrimSpace(req.Email))
+	if err == nil && !user.EmailVerifiedAt.Valid {
+		if err := h.sendVerificationEmail(c.Context(), user); err != nil {
+			log.Printf("Failed to send verification email to user %s: %v", user.ID.String(), err)
+		}
+	}
+
+	return emailSentResponse(c, verificationResentMessage)
+}
+
+// ForgotPassword emails a password reset link
+func (h *AuthHandler) ForgotPassword(c *fiber.Ctx) error {
+	var req models.EmailRequest
+	if err := c.BodyParser(&req); err != nil || req.Email == "" {
+		req.Email = c.FormValue("email")
+	}
+	email := strings.TrimSpace(req.Email)
+	if email == "" {
+		return mfaError(c, fiber.StatusBadRequest, "Email is required")
+	}
+
+	// SSO-enforced accounts have no password to reset
+	if _, enforced := h.oidc.EnforcedProvider(email); !enforced {
+		user, err := h.db.GetUserByEmail(c.Context(), email)
+		if err == nil && user.IsActive.Bool {
+			if err := h.sendPasswordResetEmail(c.Context(), user); err != nil {
+				log.Printf("Failed to send password reset email to user %s: %v", user.ID.String(), err)
+			}
+			recordAudit(c, h.audit, services.AuditEvent{
+				ActorID:    user.ID.Bytes,
+				ActorEmail: user.Email,
+				Action:     services.AuditPasswordResetRequest,
+			})
+		}
+	}
+
+	return emailSentResponse(c, passwordResetSentMessage)
+}
+
+// ResetPasswordPage shows the form for choosing a new password, if the
+// link is still valid
+func (h *AuthHandler) ResetPasswordPage(c *fiber.Ctx) error {
+	token := c.Query("token")
+	_, err := h.db.GetValidAccountToken(c.Context(), database.GetValidAccountTokenParams{
+		TokenHash: auth.HashToken(token),
+		Purpose:   accountTokenPasswordReset,
+	})
+
+	c.Set("Content-Type", "text/html")
+	if err != nil {
+		c.Status(fiber.StatusBadRequest)
+		return templates.Base(false, "", templates.ForgotPasswordPage([]string{invalidPasswordResetMessage})).Render(c.Context(), c.Response().BodyWriter())
+	}
+	return templates.Base(false, "", templates.ResetPasswordPage(token)).Render(c.Context(), c.Response().BodyWriter())
+}
+
+// ResetPassword sets a new password with a reset token. The token works
+// once, and every session of the user is ended.
+func (h *AuthHandler) ResetPassword(c *fiber.Ctx) error {
+	var req models.ResetPasswordRequest
+	if err := c.BodyParser(&req); err != nil {
+		req = models.ResetPasswordRequest{
+			Token:    c.FormValue("token"),
+			Password: c.FormValue("password"),
+		}
+	}
+
+	// Check the password first so a weak one does not use up the token
+	if err := validation.ValidatePassword(req.Password); err != nil {
+		return mfaError(c, fiber.StatusBadRequest, err.Error())
+	}
+
+	token, err := h.db.UseAccountToken(c.Context(), database.UseAccountTokenParams{
+		TokenHash: auth.HashToken(req.Token),
+		Purpose:   accountTokenPasswordReset,
+	})
+	if err != nil {
+		return mfaError(c, fiber.StatusBadRequest, invalidPasswordResetMessage)
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	if err != nil {
+		return mfaError(c, fiber.StatusInternalServerError, "Failed to hash password")
+	}
+
+	user, err := h.db.UpdateUserPassword(c.Context(), database.UpdateUserPasswordParams{
+		ID:           token.UserID,
+		PasswordHash: string(hashedPassword),
+	})
+	if err != nil {
+		return mfaError(c, fiber.StatusInternalServerError, "Failed to update password")
+	}
+
+	// Receiving the reset link proves the user owns the address
+	if _, err := h.db.MarkUserEmailVerified(c.Context(), user.ID); err != nil {
+		log.Printf("Failed to mark email of user %s as verified: %v", user.ID.String(), err)
+	}
+	if err := h.db.DeleteUserAccountTokens(c.Context(), database.DeleteUserAccountTokensParams{
+		UserID:  user.ID,
+		Purpose: accountTokenPasswordReset,
+	}); err != nil {
+		log.Printf("Failed to delete reset tokens of user %s: %v", user.ID.String(), err)
+	}
+	// Whoever was guessing the old password has nothing left to guess
+	h.resetLoginFailures(c, user.ID)
+
+	revoked, err := h.db.DeleteAllUserSessions(c.Context(), user.ID)
+	if err != nil {
+		return mfaError(c, fiber.StatusInternalServerError, "Failed to sign out existing sessions")
+	}
+	h.cache.InvalidateSessions(c.Context(), revoked)
+	h.cache.InvalidateUser(c.Context(), user.ID.Bytes, user.Email)
+	recordAudit(c, h.audit, services.AuditEvent{
+		ActorID:    user.ID.Bytes,
+		ActorEmail: user.Email,
+		Action:     services.AuditPasswordReset,
+		Details:    map[string]string{"sessions_revoked": fmt.Sprint(len(revoked))},
+	})
+
+	if c.Get("HX-Request") == "true" {
+		return c.SendString(`<div class="mb-4 p-4 bg-green-100 border border-green-400 text-green-700 rounded">
+			<p>` + passwordResetCompletedMessage + ` <a href="/login" class="font-bold underline">Sign in</a></p>
+		</div>`)
+	}
+	return c.JSON(fiber.Map{"message": passwordResetCompletedMessage})
+}
+
+// emailVerificationRequired answers a login with a correct password for an
+// unconfirmed account
+func emailVerificationRequired(c *fiber.Ctx, email string) error {
+	if c.Get("HX-Request") == "true" {
+		c.Set("Content-Type", "text/html")
+		return templates.EmailVerificationRequired(email).Render(c.Context(), c.Response().BodyWriter())
+	}
+	return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+		"error":                       "Please confirm your email address first",
+		"email_verification_required": true,
+	})
+}
+
+func (h *AuthHandler) sendVerificationEmail(ctx context.Context, user database.User) error {
+	token, err := h.issueAccountToken(ctx, user.ID, accountTokenVerifyEmail, emailVerificationTTL)
+	if err != nil {
+		return err
+	}
+
+	return h.mailer.Send(ctx, services.Email{
+		To:      user.Email,
+		Subject: "Confirm your email address",
+		Body: fmt.Sprintf("Hello %s,\n\n"+
+			"Please confirm your email address for the Secure Document Exchange Portal by opening this link within 24 hours:\n\n"+
+			"%s\n\n"+
+			"If you did not create an account, you can ignore this email.",
+			user.FullName, h.accountLink("/verify-email", token)),
+	})
+}
+
+func (h *AuthHandler) sendPasswordResetEmail(ctx context.Context, user database.User) error {
+	token, err := h.issueAccountToken(ctx, user.ID, accountTokenPasswordReset, passwordResetTTL)
+	if err != nil {
+		return err
+	}
+
+	return h.mailer.Send(ctx, services.Email{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Hello %s,\n\n"+
+			"Someone asked to reset the password of your Secure Document Exchange Portal account. "+
+			"To choose a new password, open this link within 30 minutes:\n\n"+
+			"%s\n\n"+
+			"If you did not ask for this, you can ignore this email. Your password stays unchanged.",
+			user.FullName, h.accountLink("/reset-password", token)),
+	})
+}
+
+// issueAccountToken replaces the user's earlier tokens for purpose with a
+// new one. Only its hash is stored.
+func (h *AuthHandler) issueAccountToken(ctx context.Context, userID pgtype.UUID, purpose string, ttl time.Duration) (string, error) {
+	err := h.db.DeleteUserAccountTokens(ctx, database.DeleteUserAccountTokensParams{
+		UserID:  userID,
+		Purpose: purpose,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	token, err := randomURLToken()
+	if err != nil {
+		return "", err
+	}
+
+	_, err = h.db.CreateAccountToken(ctx, database.CreateAccountTokenParams{
+		UserID:    userID,
+		Purpose:   purpose,
+		TokenHash: auth.HashToken(token),
+		ExpiresAt: pgtype.Timestamptz{Time: time.Now().Add(ttl), Valid: true},
+	})
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+func (h *AuthHandler) accountLink(path, token string) string {
+	return h.baseURL + path + "?token=" + url.QueryEscape(token)
+}
+
+func (h *AuthHandler) renderLoginPage(c *fiber.Ctx, status int, errors []string, successMsg string) error {
+	c.Status(status)
+	c.Set("Content-Type", "text/html")
+	return templates.Base(false, "", templates.LoginPage(errors, successMsg, h.SSOProviders())).Render(c.Context(), c.Response().BodyWriter())
+}
+
+func emailSentResponse(c *fiber.Ctx, message string) error {
+	if c.Get("HX-Request") == "true" {
+		return c.SendString(`<div class="mb-4 p-4 bg-green-100 border border-green-400 text-green-700 rounded"><p>` + message + `</p></div>`)
+	}
+	return c.JSON(fiber.Map{"message": message})
+}
@@ -0,0 +1,177 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+
+	"Secure-Document-Exchange-Portal/internal/auth"
+	"Secure-Document-Exchange-Portal/internal/services"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const testBaseURL = "http://localhost:3000"
+
+var accountLinkToken = regexp.MustCompile(`\?token=(\S+)`)
+
+// authApp serves the account email routes with emails kept in mailer
+func (f *fixtures) authApp() (*fiber.App, *services.MemoryMailer) {
+	f.t.Helper()
+
+	oidc, err := auth.NewOIDCService(nil, testBaseURL)
+	if err != nil {
+		f.t.Fatal(err)
+	}
+	mailer := services.NewMemoryMailer()
+	h := NewAuthHandler(f.db, nil, f.cache, nil, oidc, mailer, f.notifier, f.audit, testBaseURL, false)
+
+	app := fiber.New()
+	app.Get("/verify-email", h.VerifyEmail)
+	app.Get("/reset-password", h.ResetPasswordPage)
+	app.Post("/auth/email/resend", h.ResendVerification)
+	app.Post("/auth/password/forgot", h.ForgotPassword)
+	app.Post("/auth/password/reset", h.ResetPassword)
+	return app, mailer
+}
+
+// request sends a request with a JSON body, if any, and returns the status
+func request(t *testing.T, app *fiber.App, method, target string, body any) int {
+	t.Helper()
+
+	req := httptest.NewRequest(method, target, nil)
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req = httptest.NewRequest(method, target, strings.NewReader(string(data)))
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+// lastToken returns the token in the link of the last email sent to to
+func lastToken(t *testing.T, mailer *services.MemoryMailer, to string) string {
+	t.Helper()
+
+	emails := mailer.Emails()
+	if len(emails) == 0 {
+		t.Fatal("no email was sent")
+	}
+	email := emails[len(emails)-1]
+	if email.To != to {
+		t.Fatalf("email sent to %s, want %s", email.To, to)
+	}
+	match := accountLinkToken.FindStringSubmatch(email.Body)
+	if match == nil {
+		t.Fatalf("email has no link with a token: %q", email.Body)
+	}
+	token, err := url.QueryUnescape(match[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+// A verification link works once, and only the latest one sent works
+func TestVerificationEmailTokenIsSingleUse(t *testing.T) {
+	f := newFixtures(t)
+	app, mailer := f.authApp()
+	user, _ := f.user("password")
+
+	resend := func() string {
+		if status := request(t, app, fiber.MethodPost, "/auth/email/resend", map[string]string{"email": user.Email}); status != fiber.StatusOK {
+			t.Fatalf("resend status = %d", status)
+		}
+		return lastToken(t, mailer, user.Email)
+	}
+	replaced := resend()
+	token := resend()
+	if token == replaced {
+		t.Fatal("the same token was sent twice")
+	}
+
+	verify := func(token string) int {
+		return request(t, app, fiber.MethodGet, "/verify-email?token="+url.QueryEscape(token), nil)
+	}
+	if status := verify(replaced); status != fiber.StatusBadRequest {
+		t.Errorf("replaced token: status = %d, want %d", status, fiber.StatusBadRequest)
+	}
+	if status := verify(token); status != fiber.StatusOK {
+		t.Fatalf("status = %d, want %d", status, fiber.StatusOK)
+	}
+	if status := verify(token); status != fiber.StatusBadRequest {
+		t.Errorf("used token: status = %d, want %d", status, fiber.StatusBadRequest)
+	}
+
+	verified, err := f.db.GetUserByID(f.ctx, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !verified.EmailVerifiedAt.Valid {
+		t.Error("the email address is not confirmed")
+	}
+
+	// Confirmed accounts are not sent new links
+	sent := len(mailer.Emails())
+	request(t, app, fiber.MethodPost, "/auth/email/resend", map[string]string{"email": user.Email})
+	if len(mailer.Emails()) != sent {
+		t.Error("a verification email was sent to a confirmed account")
+	}
+}
+
+// A password reset link works once, is not used up by a rejected password
+// and cannot stand in for a verification link or the other way round
+func TestPasswordResetTokenIsSingleUse(t *testing.T) {
+	f := newFixtures(t)
+	app, mailer := f.authApp()
+	user, _ := f.user("password")
+
+	if status := request(t, app, fiber.MethodPost, "/auth/email/resend", map[string]string{"email": user.Email}); status != fiber.StatusOK {
+		t.Fatalf("resend status = %d", status)
+	}
+	verifyToken := lastToken(t, mailer, user.Email)
+	if status := request(t, app, fiber.MethodPost, "/auth/password/forgot", map[string]string{"email": user.Email}); status != fiber.StatusOK {
+		t.Fatalf("forgot status = %d", status)
+	}
+	token := lastToken(t, mailer, user.Email)
+
+	const newPassword = "Correct.Horse.9!"
+	reset := func(token, password string) int {
+		return request(t, app, fiber.MethodPost, "/auth/password/reset", map[string]string{"token": token, "password": password})
+	}
+	page := func(token string) int {
+		return request(t, app, fiber.MethodGet, "/reset-password?token="+url.QueryEscape(token), nil)
+	}
+
+	if status := reset(verifyToken, newPassword); status != fiber.StatusBadRequest {
+		t.Errorf("verification token used for a reset: status = %d, want %d", status, fiber.StatusBadRequest)
+	}
+	if status := request(t, app, fiber.MethodGet, "/verify-email?token="+url.QueryEscape(token), nil); status != fiber.StatusBadRequest {
+		t.Errorf("reset token used for verification: status = %d, want %d", status, fiber.StatusBadRequest)
+	}
+	if status := reset(token, "weak"); status != fiber.StatusBadRequest {
+		t.Errorf("weak password: status = %d, want %d", status, fiber.StatusBadRequest)
+	}
+	if status := page(token); status != fiber.StatusOK {
+		t.Errorf("reset page after a rejected password: status = %d, want %d", status, fiber.StatusOK)
+	}
+	if status := reset(token, newPassword); status != fiber.StatusOK {
+		t.Fatalf("reset status = %d, want %d", status, fiber.StatusOK)
+	}
+	if status := reset(token, newPassword+"!"); status != fiber.StatusBadRequest {
+		t.Errorf("used token: status = %d, want %d", status, fiber.StatusBadRequest)
+	}
+	if status := page(token); status != fiber.StatusBadRequest {
+		t.Errorf("reset page for a used token: status = %d, want %d", status, fiber.StatusBadRequest)
+	}
+}
@@ -0,0 +1,688 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"Secure-Document-Exchange-Portal/internal/auth"
+	"Secure-Document-Exchange-Portal/internal/database"
+	"Secure-Document-Exchange-Portal/internal/models"
+	"Secure-Document-Exchange-Portal/internal/services"
+	"Secure-Document-Exchange-Portal/templates"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// adminPageSize is how many users or shares the admin console lists at once
+const adminPageSize = 50
+
+type AdminHandler struct {
+	db     *database.Queries
+	cache  *services.CachedRepository
+	jobs   *services.JobService
+	quotas *services.QuotaService
+	audit  *services.AuditLog
+}
+
+func NewAdminHandler(db *database.Queries, cache *services.CachedRepository, jobs *services.JobService, quotas *services.QuotaService, audit *services.AuditLog) *AdminHandler {
+	return &AdminHandler{
+		db:     db,
+		cache:  cache,
+		jobs:   jobs,
+		quotas: quotas,
+		audit:  audit,
+	}
+}
+
+// Users searches accounts by email or name. Each page holds adminPageSize
+// users, with their storage usage.
+func (h *AdminHandler) Users(c *fiber.Ctx) error {
+	users, err := h.db.SearchUsers(c.Context(), database.SearchUsersParams{
+		Query:  strings.TrimSpace(c.Query("q")),
+		Limit:  adminPageSize,
+		Offset: adminOffset(c),
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to search users"})
+	}
+
+	if c.Get("Accept") == "text/html" || c.Get("HX-Request") == "true" {
+		var items []templates.AdminUserInfo
+		for _, user := range users {
+			item := templates.AdminUserInfo{
+				ID:            user.ID.String(),
+				Email:         user.Email,
+				FullName:      user.FullName,
+				Active:        user.IsActive.Bool,
+				Admin:         user.IsAdmin,
+				Legal:         user.IsLegal,
+				MFAEnabled:    user.TotpEnabled,
+				DocumentCount: user.DocumentCount,
+				Storage:       services.FormatBytes(user.StorageBytes),
+				CreatedAt:     user.CreatedAt.Time.Format("2006-01-02"),
+			}
+			if user.LockedUntil.Valid && user.LockedUntil.Time.After(time.Now()) {
+				item.LockedUntil = user.LockedUntil.Time.Format("2006-01-02 15:04")
+			}
+			items = append(items, item)
+		}
+		c.Set("Content-Type", "text/html")
+		return templates.AdminUserList(items).Render(c.Context(), c.Response().BodyWriter())
+	}
+
+	result := make([]fiber.Map, 0, len(users))
+	for _, user := range users {
+		item := fiber.Map{
+			"id":             user.ID.String(),
+			"email":          user.Email,
+			"full_name":      user.FullName,
+			"is_active":      user.IsActive.Bool,
+			"is_admin":       user.IsAdmin,
+			"is_legal":       user.IsLegal,
+			"mfa_enabled":    user.TotpEnabled,
+			"locked_until":   nil,
+			"document_count": user.DocumentCount,
+			"storage_bytes":  user.StorageBytes,
+			"created_at":     user.CreatedAt.Time.Format(time.RFC3339),
+		}
+		if user.LockedUntil.Valid && user.LockedUntil.Time.After(time.Now()) {
+			item["locked_until"] = user.LockedUntil.Time.Format(time.RFC3339)
+		}
+		result = append(result, item)
+	}
+	return c.JSON(result)
+}
+
+// RevokeUserSessions signs a user out of every device
+func (h *AdminHandler) RevokeUserSessions(c *fiber.Ctx) error {
+	userID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid user ID"})
+	}
+
+	if _, err := h.db.GetUserByID(c.Context(), pgtype.UUID{Bytes: userID, Valid: true}); err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
+	}
+
+	revoked, err := h.db.DeleteAllUserSessions(c.Context(), pgtype.UUID{Bytes: userID, Valid: true})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to revoke sessions"})
+	}
+	h.cache.InvalidateSessions(c.Context(), revoked)
+
+	recordAudit(c, h.audit, services.AuditEvent{
+		Action:       services.AuditUserSessionsRevoke,
+		ResourceType: "user",
+		ResourceID:   userID.String(),
+		Details:      map[string]string{"revoked": fmt.Sprint(len(revoked))},
+	})
+
+	usersChanged(c)
+	return c.JSON(fiber.Map{"revoked": len(revoked)})
+}
+
+// DeactivateUser blocks a user from signing in. Their sessions end at once,
+// so tokens they already hold stop working.
+func (h *AdminHandler) DeactivateUser(c *fiber.Ctx) error {
+	userID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid user ID"})
+	}
+
+	adminID, err := auth.GetUserID(c)
+	if err != nil {
+		return err
+	}
+	if userID == adminID {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "You cannot deactivate your own account"})
+	}
+
+	user, err := h.db.SetUserActive(c.Context(), database.SetUserActiveParams{
+		ID:       pgtype.UUID{Bytes: userID, Valid: true},
+		IsActive: pgtype.Bool{Bool: false, Valid: true},
+	})
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
+	}
+	h.cache.InvalidateUser(c.Context(), userID, user.Email)
+
+	revoked, err := h.db.DeleteAllUserSessions(c.Context(), user.ID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to revoke sessions"})
+	}
+	h.cache.InvalidateSessions(c.Context(), revoked)
+
+	recordAudit(c, h.audit, services.AuditEvent{
+		ActorID:      adminID,
+		Action:       services.AuditUserDeactivated,
+		ResourceType: "user",
+		ResourceID:   userID.String(),
+		Details:      map[string]string{"email": user.Email},
+	})
+
+	usersChanged(c)
+	return c.JSON(fiber.Map{"id": userID.String(), "is_active": false, "revoked": len(revoked)})
+}
+
+// ActivateUser lets a deactivated user sign in again. Any lockout after
+// failed logins is lifted as well.
+func (h *AdminHandler) ActivateUser(c *fiber.Ctx) error {
+	userID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid user ID"})
+	}
+
+	user, err := h.db.SetUserActive(c.Context(), database.SetUserActiveParams{
+		ID:       pgtype.UUID{Bytes: userID, Valid: true},
+		IsActive: pgtype.Bool{Bool: true, Valid: true},
+	})
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
+	}
+	h.cache.InvalidateUser(c.Context(), userID, user.Email)
+
+	recordAudit(c, h.audit, services.AuditEvent{
+		Action:       services.AuditUserActivated,
+		ResourceType: "user",
+		ResourceID:   userID.String(),
+		Details:      map[string]string{"email": user.Email},
+	})
+
+	usersChanged(c)
+	return c.JSON(fiber.Map{"id": userID.String(), "is_active": true})
+}
+
+// UnlockUser lifts a lockout after failed logins before it runs out
+func (h *AdminHandler) UnlockUser(c *fiber.Ctx) error {
+	userID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid user ID"})
+	}
+
+	if _, err := h.db.GetUserByID(c.Context(), pgtype.UUID{Bytes: userID, Valid: true}); err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
+	}
+
+	if err := h.db.ResetFailedLogins(c.Context(), pgtype.UUID{Bytes: userID, Valid: true}); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to unlock user"})
+	}
+
+	recordAudit(c, h.audit, services.AuditEvent{
+		Action:       services.AuditUserUnlocked,
+		ResourceType: "user",
+		ResourceID:   userID.String(),
+	})
+
+	usersChanged(c)
+	return c.JSON(fiber.Map{"id": userID.String(), "locked": false})
+}
+
+// ResetMFA turns off two-factor authentication for a user who lost their
+// second factor: the authenticator app, recovery codes and security keys.
+// They can sign in with their password and set it up again.
+func (h *AdminHandler) ResetMFA(c *fiber.Ctx) error {
+	userID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid user ID"})
+	}
+
+	user, err := h.db.DisableUserTOTP(c.Context(), pgtype.UUID{Bytes: userID, Valid: true})
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
+	}
+	if err := h.db.DeleteUserRecoveryCodes(c.Context(), user.ID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to delete recovery codes"})
+	}
+	removed, err := h.db.DeleteUserWebAuthnCredentials(c.Context(), user.ID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to delete security keys"})
+	}
+	h.cache.InvalidateUser(c.Context(), userID, user.Email)
+
+	recordAudit(c, h.audit, services.AuditEvent{
+		Action:       services.AuditUserMFAReset,
+		ResourceType: "user",
+		ResourceID:   userID.String(),
+		Details: map[string]string{
+			"email":                 user.Email,
+			"security_keys_removed": fmt.Sprint(removed),
+		},
+	})
+
+	usersChanged(c)
+	return c.JSON(fiber.Map{"id": userID.String(), "mfa_enabled": false, "security_keys_removed": removed})
+}
+
+// SetLegalRole grants or revokes the legal role, which lets a user place
+// and release legal holds. It gives no access to documents.
+func (h *AdminHandler) SetLegalRole(c *fiber.Ctx) error {
+	userID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid user ID"})
+	}
+
+	var req models.LegalRoleRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	user, err := h.db.SetUserLegal(c.Context(), database.SetUserLegalParams{
+		ID:      pgtype.UUID{Bytes: userID, Valid: true},
+		IsLegal: req.Legal,
+	})
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
+	}
+	h.cache.InvalidateUser(c.Context(), userID, user.Email)
+
+	recordAudit(c, h.audit, services.AuditEvent{
+		Action:       services.AuditLegalRoleSet,
+		ResourceType: "user",
+		ResourceID:   userID.String(),
+		Details: map[string]string{
+			"email":    user.Email,
+			"is_legal": fmt.Sprint(user.IsLegal),
+		},
+	})
+
+	usersChanged(c)
+	return c.JSON(fiber.Map{"id": userID.String(), "is_legal": user.IsLegal})
+}
+
+// Storage lists the users storing the most data, against their quotas
+func (h *AdminHandler) Storage(c *fiber.Ctx) error {
+	totals, err := h.db.GetStorageTotals(c.Context())
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to load storage usage"})
+	}
+	users, err := h.db.ListStorageUsage(c.Context(), adminPageSize)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to load storage usage"})
+	}
+
+	if c.Get("Accept") == "text/html" || c.Get("HX-Request") == "true" {
+		var items []templates.AdminStorageInfo
+		for _, user := range users {
+			usage := storageRowUsage(user)
+			items = append(items, templates.AdminStorageInfo{
+				Email:         user.Email,
+				FullName:      user.FullName,
+				Plan:          user.Plan,
+				DocumentCount: user.DocumentCount,
+				Storage:       services.FormatBytes(user.StorageBytes),
+				Quota:         services.FormatBytes(usage.QuotaBytes),
+				PercentUsed:   int(usage.Fraction() * 100),
+			})
+		}
+		c.Set("Content-Type", "text/html")
+		return templates.AdminStorage(items, totals.DocumentCount, services.FormatBytes(totals.StorageBytes)).Render(c.Context(), c.Response().BodyWriter())
+	}
+
+	result := make([]fiber.Map, 0, len(users))
+	for _, user := range users {
+		usage := storageRowUsage(user)
+		result = append(result, fiber.Map{
+			"user_id":         user.ID.String(),
+			"email":           user.Email,
+			"full_name":       user.FullName,
+			"plan":            user.Plan,
+			"document_count":  user.DocumentCount,
+			"storage_bytes":   user.StorageBytes,
+			"quota_bytes":     usage.QuotaBytes,
+			"quota_documents": usage.QuotaDocuments,
+		})
+	}
+	return c.JSON(fiber.Map{
+		"document_count": totals.DocumentCount,
+		"storage_bytes":  totals.StorageBytes,
+		"users":          result,
+	})
+}
+
+// SetUserQuota puts a user on a storage plan, optionally overriding the
+// plan's quotas. Lowering a quota below the usage deletes nothing; it only
+// stops further uploads.
+func (h *AdminHandler) SetUserQuota(c *fiber.Ctx) error {
+	userID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid user ID"})
+	}
+	req, ok, err := quotaRequest(c)
+	if !ok {
+		return err
+	}
+
+	if _, err := h.db.GetUserByID(c.Context(), pgtype.UUID{Bytes: userID, Valid: true}); err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
+	}
+	row, err := h.db.SetUserQuota(c.Context(), database.SetUserQuotaParams{
+		UserID:         pgtype.UUID{Bytes: userID, Valid: true},
+		Plan:           req.Plan,
+		QuotaBytes:     optionalInt8(req.QuotaBytes),
+		QuotaDocuments: optionalInt4(req.QuotaDocuments),
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to set quota"})
+	}
+
+	recordAudit(c, h.audit, services.AuditEvent{
+		Action:       services.AuditQuotaSet,
+		ResourceType: "user",
+		ResourceID:   userID.String(),
+		Details:      quotaDetails(row),
+	})
+
+	usage, err := h.quotas.UserUsage(c.Context(), userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to load storage usage"})
+	}
+	return c.JSON(usageJSON(usage))
+}
+
+// SetOrganizationQuota puts an organization on a storage plan, like
+// SetUserQuota
+func (h *AdminHandler) SetOrganizationQuota(c *fiber.Ctx) error {
+	orgID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid organization ID"})
+	}
+	req, ok, err := quotaRequest(c)
+	if !ok {
+		return err
+	}
+
+	if _, err := h.db.GetOrganizationByID(c.Context(), pgtype.UUID{Bytes: orgID, Valid: true}); err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Organization not found"})
+	}
+	row, err := h.db.SetOrganizationQuota(c.Context(), database.SetOrganizationQuotaParams{
+		OrganizationID: pgtype.UUID{Bytes: orgID, Valid: true},
+		Plan:           req.Plan,
+		QuotaBytes:     optionalInt8(req.QuotaBytes),
+		QuotaDocuments: optionalInt4(req.QuotaDocuments),
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to set quota"})
+	}
+
+	recordAudit(c, h.audit, services.AuditEvent{
+		Action:       services.AuditQuotaSet,
+		ResourceType: "organization",
+		ResourceID:   orgID.String(),
+		Details:      quotaDetails(row),
+	})
+
+	usage, err := h.quotas.OrganizationUsage(c.Context(), orgID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to load storage usage"})
+	}
+	return c.JSON(usageJSON(usage))
+}
+
+// Shares lists the share links that can still be opened, newest first,
+// optionally only those of creators matching q. Admins revoke them through
+// the regular share endpoint.
+func (h *AdminHandler) Shares(c *fiber.Ctx) error {
+	shares, err := h.db.ListActiveShares(c.Context(), database.ListActiveSharesParams{
+		CreatedByEmail: strings.TrimSpace(c.Query("q")),
+		Limit:          adminPageSize,
+		Offset:         adminOffset(c),
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to list shares"})
+	}
+
+	if c.Get("Accept") == "text/html" || c.Get("HX-Request") == "true" {
+		var items []templates.AdminShareInfo
+		for _, share := range shares {
+			name := share.Name.String
+			if name == "" {
+				name = "Share " + share.ID.String()[:8]
+			}
+			documents := fmt.Sprintf("%d documents", share.DocumentCount)
+			if share.FolderID.Valid {
+				documents = "Folder"
+			}
+			access := fmt.Sprintf("%d opens", share.AccessCount.Int32)
+			if share.MaxAccess.Int32 > 0 {
+				access = fmt.Sprintf("%d of %d opens", share.AccessCount.Int32, share.MaxAccess.Int32)
+			}
+			items = append(items, templates.AdminShareInfo{
+				ID:        share.ID.String(),
+				Name:      name,
+				CreatedBy: share.CreatedByEmail,
+				Documents: documents,
+				Access:    access,
+				ExpiresAt: share.ExpiresAt.Time.Format("2006-01-02 15:04"),
+				ViewOnly:  share.ViewOnly,
+			})
+		}
+		c.Set("Content-Type", "text/html")
+		return templates.AdminShareList(items).Render(c.Context(), c.Response().BodyWriter())
+	}
+
+	result := make([]fiber.Map, 0, len(shares))
+	for _, share := range shares {
+		result = append(result, fiber.Map{
+			"id":               share.ID.String(),
+			"name":             share.Name.String,
+			"folder_id":        share.FolderID.String(),
+			"document_count":   share.DocumentCount,
+			"created_by_email": share.CreatedByEmail,
+			"access_count":     share.AccessCount.Int32,
+			"max_access":       share.MaxAccess.Int32,
+			"view_only":        share.ViewOnly,
+			"expires_at":       share.ExpiresAt.Time.Format(time.RFC3339),
+			"created_at":       share.CreatedAt.Time.Format(time.RFC3339),
+		})
+	}
+	return c.JSON(result)
+}
+
+// SecurityEvents lists the latest security events of the audit log:
+// sign-ins and failed logins, credential and session changes, refused
+// accesses and administrator actions
+func (h *AdminHandler) SecurityEvents(c *fiber.Ctx) error {
+	rows, err := h.db.ListSecurityEvents(c.Context(), database.ListSecurityEventsParams{
+		Actions: services.SecurityAuditActions,
+		Limit:   100,
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to load security events"})
+	}
+	events := make([]services.AuditEntry, 0, len(rows))
+	for _, row := range rows {
+		event, err := services.AuditEntryOf(row)
+		if err != nil {
+			log.Printf("Failed to read audit event: %v", err)
+			continue
+		}
+		events = append(events, event)
+	}
+
+	if c.Get("Accept") == "text/html" || c.Get("HX-Request") == "true" {
+		var items []templates.AdminEventInfo
+		for _, event := range events {
+			occurredAt, _ := time.Parse(time.RFC3339Nano, event.OccurredAt)
+			items = append(items, templates.AdminEventInfo{
+				Event:      event.Action,
+				Email:      event.ActorEmail,
+				IPAddress:  event.IPAddress,
+				Detail:     auditDetail(event),
+				OccurredAt: occurredAt.Format("2006-01-02 15:04"),
+			})
+		}
+		c.Set("Content-Type", "text/html")
+		return templates.AdminEventList(items).Render(c.Context(), c.Response().BodyWriter())
+	}
+
+	return c.JSON(events)
+}
+
+// auditDetail summarizes what an audit event was about for the console
+func auditDetail(event services.AuditEntry) string {
+	var parts []string
+	if event.ResourceType != "" {
+		parts = append(parts, event.ResourceType+" "+event.ResourceID)
+	}
+	keys := make([]string, 0, len(event.Details))
+	for key := range event.Details {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if event.Details[key] != "" {
+			parts = append(parts, key+"="+event.Details[key])
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Jobs shows the background job queues and the tasks that failed in them
+func (h *AdminHandler) Jobs(c *fiber.Ctx) error {
+	queues, err := h.jobs.Queues()
+	if err != nil {
+		log.Printf("Failed to inspect job queues: %v", err)
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{"error": "Failed to inspect job queues"})
+	}
+
+	var queueItems []templates.AdminQueueInfo
+	var taskItems []templates.AdminTaskInfo
+	for _, queue := range queues {
+		queueItems = append(queueItems, templates.AdminQueueInfo{
+			Name:      queue.Queue,
+			Paused:    queue.Paused,
+			Pending:   queue.Pending,
+			Active:    queue.Active,
+			Scheduled: queue.Scheduled,
+			Retry:     queue.Retry,
+			Archived:  queue.Archived,
+			Processed: queue.Processed,
+			Failed:    queue.Failed,
+		})
+
+		tasks, err := h.jobs.FailedTasks(queue.Queue, 20)
+		if err != nil {
+			log.Printf("Failed to list failed tasks of queue %s: %v", queue.Queue, err)
+			continue
+		}
+		for _, task := range tasks {
+			// Payloads can hold email addresses and links, so only the
+			// outcome is shown
+			taskItems = append(taskItems, templates.AdminTaskInfo{
+				Queue:        task.Queue,
+				Type:         task.Type,
+				State:        task.State.String(),
+				Retried:      task.Retried,
+				LastError:    task.LastErr,
+				LastFailedAt: task.LastFailedAt.Format("2006-01-02 15:04"),
+			})
+		}
+	}
+
+	if c.Get("Accept") == "text/html" || c.Get("HX-Request") == "true" {
+		c.Set("Content-Type", "text/html")
+		return templates.AdminJobs(queueItems, taskItems).Render(c.Context(), c.Response().BodyWriter())
+	}
+
+	queueResult := make([]fiber.Map, 0, len(queueItems))
+	for _, queue := range queueItems {
+		queueResult = append(queueResult, fiber.Map{
+			"name":      queue.Name,
+			"paused":    queue.Paused,
+			"pending":   queue.Pending,
+			"active":    queue.Active,
+			"scheduled": queue.Scheduled,
+			"retry":     queue.Retry,
+			"archived":  queue.Archived,
+			"processed": queue.Processed,
+			"failed":    queue.Failed,
+		})
+	}
+	taskResult := make([]fiber.Map, 0, len(taskItems))
+	for _, task := range taskItems {
+		taskResult = append(taskResult, fiber.Map{
+			"queue":          task.Queue,
+			"type":           task.Type,
+			"state":          task.State,
+			"retried":        task.Retried,
+			"last_error":     task.LastError,
+			"last_failed_at": task.LastFailedAt,
+		})
+	}
+	return c.JSON(fiber.Map{
+		"queues":       queueResult,
+		"failed_tasks": taskResult,
+	})
+}
+
+// usersChanged tells the admin console to reload its user list
+func usersChanged(c *fiber.Ctx) {
+	if c.Get("HX-Request") == "true" {
+		c.Set("HX-Trigger", "adminUsersChanged")
+	}
+}
+
+// adminOffset is the offset of the page given by the page query parameter,
+// counting from 1
+func adminOffset(c *fiber.Ctx) int32 {
+	page := c.QueryInt("page", 1)
+	if page < 1 {
+		page = 1
+	}
+	return int32((page - 1) * adminPageSize)
+}
+
+// quotaRequest parses and validates the body of a quota change
+func quotaRequest(c *fiber.Ctx) (models.QuotaRequest, bool, error) {
+	var req models.QuotaRequest
+	if err := c.BodyParser(&req); err != nil {
+		return req, false, c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	if _, ok := services.Plans[req.Plan]; !ok {
+		return req, false, c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Unknown plan"})
+	}
+	if (req.QuotaBytes != nil && *req.QuotaBytes < 0) || (req.QuotaDocuments != nil && *req.QuotaDocuments < 0) {
+		return req, false, c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Quotas cannot be negative"})
+	}
+	return req, true, nil
+}
+
+// storageRowUsage is the usage of a row of the storage list
+func storageRowUsage(row database.ListStorageUsageRow) services.Usage {
+	return services.UsageOf(database.StorageUsage{
+		Plan:           row.Plan,
+		QuotaBytes:     row.QuotaBytes,
+		QuotaDocuments: row.QuotaDocuments,
+		UsedBytes:      row.StorageBytes,
+		DocumentCount:  int32(row.DocumentCount),
+	})
+}
+
+// quotaDetails records a quota change in the audit log
+func quotaDetails(row database.StorageUsage) map[string]string {
+	usage := services.UsageOf(row)
+	return map[string]string{
+		"plan":            usage.Plan,
+		"quota_bytes":     fmt.Sprint(usage.QuotaBytes),
+		"quota_documents": fmt.Sprint(usage.QuotaDocuments),
+	}
+}
+
+func optionalInt8(n *int64) pgtype.Int8 {
+	if n == nil {
+		return pgtype.Int8{}
+	}
+	return pgtype.Int8{Int64: *n, Valid: true}
+}
+
+func optionalInt4(n *int32) pgtype.Int4 {
+	if n == nil {
+		return pgtype.Int4{}
+	}
+	return pgtype.Int4{Int32: *n, Valid: true}
+}
@@ -0,0 +1,217 @@
+package handlers
+
+import (
+	"html"
+	"slices"
+	"strings"
+	"time"
+
+	"Secure-Document-Exchange-Portal/internal/auth"
+	"Secure-Document-Exchange-Portal/internal/database"
+	"Secure-Document-Exchange-Portal/internal/models"
+	"Secure-Document-Exchange-Portal/internal/services"
+	"Secure-Document-Exchange-Portal/templates"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+const (
+	apiKeyMaxNameLength    = 100
+	apiKeyMaxExpiresInDays = 365
+)
+
+type APIKeyHandler struct {
+	db    *database.Queries
+	cache *services.CachedRepository
+	audit *services.AuditLog
+}
+
+func NewAPIKeyHandler(db *database.Queries, cache *services.CachedRepository, audit *services.AuditLog) *APIKeyHandler {
+	return &APIKeyHandler{
+		db:    db,
+		cache: cache,
+		audit: audit,
+	}
+}
+
+// List returns the user's API keys. The keys themselves are only shown
+// when they are created.
+func (h *APIKeyHandler) List(c *fiber.Ctx) error {
+	userID, err := auth.GetUserID(c)
+	if err != nil {
+		return err
+	}
+
+	return h.renderKeys(c, userID)
+}
+
+// Create issues a new API key with the requested scopes
+func (h *APIKeyHandler) Create(c *fiber.Ctx) error {
+	userID, err := auth.GetUserID(c)
+	if err != nil {
+		return err
+	}
+
+	var req models.CreateAPIKeyRequest
+	if err := c.BodyParser(&req); err != nil {
+		return mfaError(c, fiber.StatusBadRequest, "Invalid request body")
+	}
+
+	name := strings.TrimSpace(req.Name)
+	if name == "" || len(name) > apiKeyMaxNameLength {
+		return mfaError(c, fiber.StatusBadRequest, "Name must be between 1 and 100 characters")
+	}
+
+	var scopes []string
+	for _, scope := range req.Scopes {
+		if !auth.ValidAPIKeyScope(scope) {
+			return mfaError(c, fiber.StatusBadRequest, "Unknown scope: "+html.EscapeString(scope))
+		}
+		if !slices.Contains(scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+	if len(scopes) == 0 {
+		return mfaError(c, fiber.StatusBadRequest, "Select at least one scope")
+	}
+
+	if req.ExpiresInDays < 0 || req.ExpiresInDays > apiKeyMaxExpiresInDays {
+		return mfaError(c, fiber.StatusBadRequest, "Expiry must be between 1 and 365 days, or 0 for a key that does not expire")
+	}
+	var expiresAt pgtype.Timestamptz
+	if req.ExpiresInDays > 0 {
+		expiresAt = pgtype.Timestamptz{Time: time.Now().AddDate(0, 0, req.ExpiresInDays), Valid: true}
+	}
+
+	key, displayPrefix, err := auth.GenerateAPIKey()
+	if err != nil {
+		return mfaError(c, fiber.StatusInternalServerError, "Failed to generate API key")
+	}
+
+	saved, err := h.db.CreateAPIKey(c.Context(), database.CreateAPIKeyParams{
+		UserID:    pgtype.UUID{Bytes: userID, Valid: true},
+		Name:      name,
+		KeyPrefix: displayPrefix,
+		KeyHash:   auth.HashToken(key),
+		Scopes:    scopes,
+		ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		return mfaError(c, fiber.StatusInternalServerError, "Failed to save API key")
+	}
+	recordAudit(c, h.audit, services.AuditEvent{
+		Action:       services.AuditAPIKeyCreated,
+		ResourceType: "api_key",
+		ResourceID:   saved.ID.String(),
+		Details: map[string]string{
+			"name":   saved.Name,
+			"scopes": strings.Join(scopes, ","),
+		},
+	})
+
+	if c.Get("HX-Request") == "true" {
+		// Reload the list next to the new key
+		c.Set("HX-Trigger", "api-key-created")
+		c.Set("Content-Type", "text/html")
+		return templates.APIKeyCreated(key).Render(c.Context(), c.Response().BodyWriter())
+	}
+
+	response := apiKeyJSON(saved)
+	response["key"] = key
+	return c.Status(fiber.StatusCreated).JSON(response)
+}
+
+// Revoke deletes an API key. Requests using it fail from then on.
+func (h *APIKeyHandler) Revoke(c *fiber.Ctx) error {
+	userID, err := auth.GetUserID(c)
+	if err != nil {
+		return err
+	}
+
+	keyID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid API key ID"})
+	}
+
+	deleted, err := h.db.DeleteAPIKey(c.Context(), database.DeleteAPIKeyParams{
+		ID:     pgtype.UUID{Bytes: keyID, Valid: true},
+		UserID: pgtype.UUID{Bytes: userID, Valid: true},
+	})
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "API key not found"})
+	}
+	h.cache.InvalidateAPIKey(c.Context(), deleted.KeyHash)
+	recordAudit(c, h.audit, services.AuditEvent{
+		Action:       services.AuditAPIKeyRevoked,
+		ResourceType: "api_key",
+		ResourceID:   keyID.String(),
+	})
+
+	if c.Get("HX-Request") == "true" {
+		return h.renderKeys(c, userID)
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+func (h *APIKeyHandler) renderKeys(c *fiber.Ctx, userID uuid.UUID) error {
+	keys, err := h.db.ListUserAPIKeys(c.Context(), pgtype.UUID{Bytes: userID, Valid: true})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to list API keys"})
+	}
+
+	if c.Get("Accept") == "text/html" || c.Get("HX-Request") == "true" {
+		var items []templates.APIKeyInfo
+		for _, key := range keys {
+			item := templates.APIKeyInfo{
+				ID:        key.ID.String(),
+				Name:      key.Name,
+				Prefix:    key.KeyPrefix,
+				Scopes:    strings.Join(key.Scopes, ", "),
+				CreatedAt: key.CreatedAt.Time.Format("2006-01-02 15:04"),
+				Expires:   "Never expires",
+				LastUsed:  "Never used",
+			}
+			if key.ExpiresAt.Valid {
+				item.Expired = !key.ExpiresAt.Time.After(time.Now())
+				item.Expires = "Expires " + key.ExpiresAt.Time.Format("2006-01-02 15:04")
+			}
+			if key.LastUsedAt.Valid {
+				item.LastUsed = "Last used " + key.LastUsedAt.Time.Format("2006-01-02 15:04")
+				if key.LastUsedIp != nil {
+					item.LastUsed += " from " + key.LastUsedIp.String()
+				}
+			}
+			items = append(items, item)
+		}
+		c.Set("Content-Type", "text/html")
+		return templates.APIKeyList(items).Render(c.Context(), c.Response().BodyWriter())
+	}
+
+	result := make([]fiber.Map, 0, len(keys))
+	for _, key := range keys {
+		result = append(result, apiKeyJSON(key))
+	}
+	return c.JSON(result)
+}
+
+func apiKeyJSON(key database.ApiKey) fiber.Map {
+	item := fiber.Map{
+		"id":         key.ID.String(),
+		"name":       key.Name,
+		"prefix":     key.KeyPrefix,
+		"scopes":     key.Scopes,
+		"created_at": key.CreatedAt.Time.Format(time.RFC3339),
+	}
+	if key.ExpiresAt.Valid {
+		item["expires_at"] = key.ExpiresAt.Time.Format(time.RFC3339)
+	}
+	if key.LastUsedAt.Valid {
+		item["last_used_at"] = key.LastUsedAt.Time.Format(time.RFC3339)
+	}
+	if key.LastUsedIp != nil {
+		item["last_used_ip"] = key.LastUsedIp.String()
+	}
+	return item
+}
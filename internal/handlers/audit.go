@@ -0,0 +1,153 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"Secure-Document-Exchange-Portal/internal/auth"
+	"Secure-Document-Exchange-Portal/internal/middleware"
+	"Secure-Document-Exchange-Portal/internal/services"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// recordAudit appends an event to the audit log, made by the signed in user
+// unless the event names its actor. A failure is logged rather than
+// returned: the action it records has already happened.
+func recordAudit(c *fiber.Ctx, audit *services.AuditLog, event services.AuditEvent) {
+	if event.ActorID == uuid.Nil {
+		if userID, err := auth.GetUserID(c); err == nil {
+			event.ActorID = userID
+		}
+	}
+	event.IPAddress = middleware.ClientIP(c)
+	event.UserAgent = c.Get("User-Agent")
+
+	if err := audit.Record(c.Context(), event); err != nil {
+		log.Printf("Failed to record audit event %s: %v", event.Action, err)
+	}
+}
+
+// AuditDenied records every request of the group that is answered with 403
+func AuditDenied(audit *services.AuditLog) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		err := c.Next()
+		status := c.Response().StatusCode()
+		if e, ok := err.(*fiber.Error); ok {
+			status = e.Code
+		}
+		if status == fiber.StatusForbidden {
+			recordAudit(c, audit, services.AuditEvent{
+				Action: services.AuditAccessDenied,
+				Details: map[string]string{
+					"method": c.Method(),
+					"path":   c.Path(),
+				},
+			})
+		}
+		return err
+	}
+}
+
+// auditCSVHeader is the first row of CSV exports
+var auditCSVHeader = []string{
+	"seq", "occurred_at", "actor_id", "actor_email", "action", "resource_type",
+	"resource_id", "ip_address", "user_agent", "details", "prev_hash", "hash",
+}
+
+// ExportAudit streams the audit events matching the filters, oldest first,
+// as JSON Lines or CSV. Every event carries its hashes, so the export can
+// be checked against the chain.
+func (h *AdminHandler) ExportAudit(c *fiber.Ctx) error {
+	userID, err := auth.GetUserID(c)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
+	}
+
+	format := c.Query("format", "jsonl")
+	if format != "jsonl" && format != "csv" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "format must be jsonl or csv"})
+	}
+
+	filter := services.AuditFilter{
+		Action:       c.Query("action"),
+		ActorEmail:   c.Query("actor"),
+		ResourceType: c.Query("resource_type"),
+		ResourceID:   c.Query("resource_id"),
+	}
+	for name, at := range map[string]*time.Time{"from": &filter.From, "to": &filter.To} {
+		if value := c.Query(name); value != "" {
+			if *at, err = time.Parse(time.RFC3339, value); err != nil {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": name + " must be an RFC 3339 time"})
+			}
+		}
+	}
+
+	recordAudit(c, h.audit, services.AuditEvent{
+		ActorID: userID,
+		Action:  services.AuditLogExported,
+		Details: map[string]string{
+			"format":        format,
+			"action":        filter.Action,
+			"actor":         filter.ActorEmail,
+			"resource_type": filter.ResourceType,
+			"resource_id":   filter.ResourceID,
+			"from":          c.Query("from"),
+			"to":            c.Query("to"),
+		},
+	})
+
+	filename := fmt.Sprintf("audit-events-%s.%s", time.Now().UTC().Format("20060102-150405"), format)
+	if format == "csv" {
+		c.Set("Content-Type", "text/csv; charset=utf-8")
+	} else {
+		c.Set("Content-Type", "application/x-ndjson")
+	}
+	c.Set("Content-Disposition", contentDisposition("attachment", filename))
+
+	// Export pages through the log after the handler has returned, when the
+	// request context is no longer valid, so it reads with one of its own.
+	audit := h.audit
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		var write func(services.AuditEntry) error
+		if format == "csv" {
+			cw := csv.NewWriter(w)
+			if err := cw.Write(auditCSVHeader); err != nil {
+				return
+			}
+			write = func(entry services.AuditEntry) error {
+				details, err := json.Marshal(entry.Details)
+				if err != nil {
+					return err
+				}
+				cw.Write([]string{
+					strconv.FormatInt(entry.Seq, 10), entry.OccurredAt, entry.ActorID, entry.ActorEmail,
+					entry.Action, entry.ResourceType, entry.ResourceID, entry.IPAddress, entry.UserAgent,
+					string(details), entry.PrevHash, entry.Hash,
+				})
+				cw.Flush()
+				return cw.Error()
+			}
+		} else {
+			encoder := json.NewEncoder(w)
+			write = func(entry services.AuditEntry) error {
+				return encoder.Encode(entry)
+			}
+		}
+
+		// Writes fail once the client goes away, which stops the export
+		if err := audit.Export(context.Background(), filter, write); err != nil {
+			log.Printf("Failed to export audit events: %v", err)
+			return
+		}
+		w.Flush()
+	})
+	return nil
+}
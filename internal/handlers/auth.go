@@ -1,32 +1,80 @@
 package handlers
 
 import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"html"
+	"log"
+	"net/netip"
 	"os"
 	"strings"
 	"time"
 
 	"Secure-Document-Exchange-Portal/internal/auth"
 	"Secure-Document-Exchange-Portal/internal/database"
+	"Secure-Document-Exchange-Portal/internal/middleware"
 	"Secure-Document-Exchange-Portal/internal/models"
 	"Secure-Document-Exchange-Portal/internal/services"
 	"Secure-Document-Exchange-Portal/internal/validation"
+	"Secure-Document-Exchange-Portal/templates"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
 	"golang.org/x/crypto/bcrypt"
 )
 
+const (
+	// accessTokenTTL is how long an access token stays valid. Clients use
+	// their refresh token to get a new one.
+	accessTokenTTL = 15 * time.Minute
+	// sessionTTL is how long a login session and its current refresh token
+	// stay valid without being used
+	sessionTTL = 24 * time.Hour
+	// refreshReuseGrace is how long a rotated refresh token is rejected
+	// without ending the session, so parallel requests that race to refresh
+	// do not log the user out
+	refreshReuseGrace = 30 * time.Second
+	// mfaChallengeTTL is how long a user has to enter their second factor
+	// after entering their password
+	mfaChallengeTTL = 5 * time.Minute
+
+	refreshCookieName = "refresh_token"
+)
+
+var (
+	errRefreshTokenInvalid = errors.New("Invalid or expired refresh token")
+	errRefreshTokenReused  = errors.New("Refresh token was already used. Please log in again.")
+	errRefreshTokenRaced   = errors.New("Refresh token was just rotated")
+)
+
 type AuthHandler struct {
 	db         *database.Queries
 	jwtService *auth.JWTService
 	cache      *services.CachedRepository
+	webauthn   *auth.WebAuthnService
+	oidc       *auth.OIDCService
+	mailer     services.Mailer
+	notifier   services.Notifier
+	audit      *services.AuditLog
+	baseURL    string
+	requireMFA bool
 }
 
-func NewAuthHandler(db *database.Queries, jwtService *auth.JWTService, cache *services.CachedRepository) *AuthHandler {
+func NewAuthHandler(db *database.Queries, jwtService *auth.JWTService, cache *services.CachedRepository, webauthn *auth.WebAuthnService, oidc *auth.OIDCService, mailer services.Mailer, notifier services.Notifier, audit *services.AuditLog, baseURL string, requireMFA bool) *AuthHandler {
 	return &AuthHandler{
 		db:         db,
 		jwtService: jwtService,
 		cache:      cache,
+		webauthn:   webauthn,
+		oidc:       oidc,
+		mailer:     mailer,
+		notifier:   notifier,
+		audit:      audit,
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		requireMFA: requireMFA,
 	}
 }
 
@@ -51,6 +99,11 @@ func (h *AuthHandler) Register(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
 	}
 
+	// Accounts in SSO-enforced domains are created on their first SSO login
+	if enforced, err := h.ssoEnforced(c, req.Email); enforced {
+		return err
+	}
+
 	// Validate password
 	if err := validation.ValidatePassword(req.Password); err != nil {
 		if c.Get("HX-Request") == "true" {
@@ -89,10 +142,26 @@ func (h *AuthHandler) Register(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "User already exists"})
 	}
 
+	// Missing workspaces are created on first use, so a failure here is
+	// not fatal
+	if _, err := personalWorkspace(c.Context(), h.db, user.ID.Bytes); err != nil {
+		log.Printf("Failed to create personal workspace for user %s: %v", user.ID.String(), err)
+	}
+	recordAudit(c, h.audit, services.AuditEvent{
+		ActorID:    user.ID.Bytes,
+		ActorEmail: user.Email,
+		Action:     services.AuditRegister,
+	})
+
+	// The account can be used once the email address is confirmed
+	if err := h.sendVerificationEmail(c.Context(), user); err != nil {
+		log.Printf("Failed to send verification email to user %s: %v", user.ID.String(), err)
+	}
+
 	if c.Get("HX-Request") == "true" {
 		// For HTMX, show success message
 		return c.Status(fiber.StatusOK).SendString(`<div class="mb-4 p-4 bg-green-100 border border-green-400 text-green-700 rounded">
-			<p>Registration successful! Please <a href="/login" class="font-bold underline">login here</a> to continue.</p>
+			<p>Registration successful! We sent a confirmation link to ` + html.EscapeString(user.Email) + `. Please open it, then <a href="/login" class="font-bold underline">sign in here</a>.</p>
 		</div>`)
 	}
 
@@ -123,26 +192,344 @@ func (h *AuthHandler) Login(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Email and password are required"})
 	}
 
+	// Password login is disabled for SSO-enforced domains
+	if enforced, err := h.ssoEnforced(c, req.Email); enforced {
+		return err
+	}
+
 	// Get user by email - with caching
 	user, err := h.cache.GetUserByEmail(c.Context(), req.Email)
 	if err != nil {
+		recordAudit(c, h.audit, services.AuditEvent{
+			ActorEmail: req.Email,
+			Action:     services.AuditLoginFailed,
+			Details:    map[string]string{"reason": "unknown_account"},
+		})
 		if c.Get("HX-Request") == "true" {
 			return c.Status(fiber.StatusUnauthorized).SendString(`<div class="mb-4 p-4 bg-red-100 border border-red-400 text-red-700 rounded"><p>Invalid credentials</p></div>`)
 		}
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid credentials"})
 	}
 
+	// Repeated failures slow down and then lock further attempts
+	userID, err := uuid.Parse(user.ID)
+	if err != nil {
+		return mfaError(c, fiber.StatusInternalServerError, "Failed to load account")
+	}
+	dbUser, err := h.db.GetUserByID(c.Context(), pgtype.UUID{Bytes: userID, Valid: true})
+	if err != nil {
+		return mfaError(c, fiber.StatusInternalServerError, "Failed to load account")
+	}
+	if throttled, err := h.loginThrottled(c, dbUser); throttled {
+		return err
+	}
+
 	// Check password
 	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(req.Password)); err != nil {
+		h.recordLoginFailure(c, dbUser, services.AuditLoginFailed)
 		if c.Get("HX-Request") == "true" {
 			return c.Status(fiber.StatusUnauthorized).SendString(`<div class="mb-4 p-4 bg-red-100 border border-red-400 text-red-700 rounded"><p>Invalid credentials</p></div>`)
 		}
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid credentials"})
 	}
 
-	// Generate token
-	userUUID := uuid.MustParse(user.ID)
-	token, err := h.jwtService.GenerateToken(userUUID, 24*time.Hour)
+	if !dbUser.IsActive.Bool {
+		return mfaError(c, fiber.StatusForbidden, accountDeactivatedMessage)
+	}
+
+	// Accounts can only be used once their email address is confirmed
+	if !dbUser.EmailVerifiedAt.Valid {
+		return emailVerificationRequired(c, user.Email)
+	}
+
+	// A second factor is needed if the user has one, or must set one up
+	webAuthnCount, err := h.db.CountUserWebAuthnCredentials(c.Context(), dbUser.ID)
+	if err != nil {
+		return mfaError(c, fiber.StatusInternalServerError, "Failed to load security keys")
+	}
+	required, err := mfaRequired(c.Context(), h.db, h.requireMFA, dbUser.ID)
+	if err != nil {
+		return mfaError(c, fiber.StatusInternalServerError, "Failed to load organization settings")
+	}
+	if user.TOTPEnabled || webAuthnCount > 0 || required {
+		return h.startMFAChallenge(c, user, webAuthnCount > 0)
+	}
+
+	return h.completeLogin(c, user, nil)
+}
+
+// VerifyMFA completes a login that returned an MFA challenge. The code is
+// a TOTP code or, for users who already set up MFA, a recovery code. For
+// setup challenges it enables MFA and the response includes the user's
+// recovery codes.
+func (h *AuthHandler) VerifyMFA(c *fiber.Ctx) error {
+	var req models.MFAVerifyRequest
+	if err := c.BodyParser(&req); err != nil {
+		req = models.MFAVerifyRequest{
+			ChallengeToken: c.FormValue("challenge_token"),
+			Code:           c.FormValue("code"),
+		}
+	}
+
+	claims, err := h.jwtService.ValidateMFAChallengeToken(req.ChallengeToken)
+	if err != nil {
+		return mfaError(c, fiber.StatusUnauthorized, "Invalid or expired challenge. Please log in again.")
+	}
+
+	user, err := h.db.GetUserByID(c.Context(), pgtype.UUID{Bytes: claims.UserID, Valid: true})
+	if err != nil {
+		return mfaError(c, fiber.StatusUnauthorized, "Invalid or expired challenge. Please log in again.")
+	}
+
+	// Wrong codes count towards the lockout like wrong passwords
+	if throttled, err := h.loginThrottled(c, user); throttled {
+		return err
+	}
+
+	var recoveryCodes []string
+	if claims.Purpose == auth.MFAPurposeSetup && !user.TotpEnabled {
+		if !verifyTOTPCode(c.Context(), h.db, user, req.Code) {
+			h.recordLoginFailure(c, user, services.AuditMFAFailed)
+			return mfaError(c, fiber.StatusUnauthorized, "Invalid verification code")
+		}
+		recoveryCodes, err = enableTOTP(c.Context(), h.db, h.cache, user)
+		if err != nil {
+			return mfaError(c, fiber.StatusInternalServerError, "Failed to enable two-factor authentication")
+		}
+		recordAudit(c, h.audit, services.AuditEvent{
+			ActorID:    user.ID.Bytes,
+			ActorEmail: user.Email,
+			Action:     services.AuditTOTPEnabled,
+		})
+	} else if !verifyTOTPCode(c.Context(), h.db, user, req.Code) && !useRecoveryCode(c.Context(), h.db, user, req.Code) {
+		h.recordLoginFailure(c, user, services.AuditMFAFailed)
+		return mfaError(c, fiber.StatusUnauthorized, "Invalid verification code")
+	}
+
+	return h.completeLogin(c, models.FromDatabaseUser(&user), recoveryCodes)
+}
+
+// BeginWebAuthnMFA returns the options for navigator.credentials.get() to
+// answer an MFA challenge with a security key or passkey
+func (h *AuthHandler) BeginWebAuthnMFA(c *fiber.Ctx) error {
+	var req models.WebAuthnFinishRequest
+	if err := c.BodyParser(&req); err != nil {
+		req.ChallengeToken = c.FormValue("challenge_token")
+	}
+
+	claims, err := h.jwtService.ValidateMFAChallengeToken(req.ChallengeToken)
+	if err != nil || claims.Purpose != auth.MFAPurposeLogin {
+		return mfaError(c, fiber.StatusUnauthorized, "Invalid or expired challenge. Please log in again.")
+	}
+
+	user, err := h.db.GetUserByID(c.Context(), pgtype.UUID{Bytes: claims.UserID, Valid: true})
+	if err != nil {
+		return mfaError(c, fiber.StatusUnauthorized, "Invalid or expired challenge. Please log in again.")
+	}
+
+	webAuthnUser, err := loadWebAuthnUser(c.Context(), h.db, user)
+	if err != nil {
+		return mfaError(c, fiber.StatusInternalServerError, "Failed to load security keys")
+	}
+	if len(webAuthnUser.Credentials) == 0 {
+		return mfaError(c, fiber.StatusBadRequest, "No security keys are registered")
+	}
+
+	assertion, session, err := h.webauthn.BeginLogin(webAuthnUser)
+	if err != nil {
+		return mfaError(c, fiber.StatusInternalServerError, "Failed to start security key login")
+	}
+
+	ceremonyID, err := saveWebAuthnChallenge(c.Context(), h.db, user.ID, webAuthnPurposeMFA, session)
+	if err != nil {
+		return mfaError(c, fiber.StatusInternalServerError, "Failed to start security key login")
+	}
+
+	return c.JSON(fiber.Map{
+		"ceremony_id": ceremonyID.String(),
+		"options":     assertion,
+	})
+}
+
+// FinishWebAuthnMFA completes a login that returned an MFA challenge with
+// the authenticator's response
+func (h *AuthHandler) FinishWebAuthnMFA(c *fiber.Ctx) error {
+	var req models.WebAuthnFinishRequest
+	if err := c.BodyParser(&req); err != nil || len(req.Credential) == 0 {
+		return mfaError(c, fiber.StatusBadRequest, "Invalid request body")
+	}
+
+	claims, err := h.jwtService.ValidateMFAChallengeToken(req.ChallengeToken)
+	if err != nil || claims.Purpose != auth.MFAPurposeLogin {
+		return mfaError(c, fiber.StatusUnauthorized, "Invalid or expired challenge. Please log in again.")
+	}
+
+	session, owner, err := takeWebAuthnChallenge(c.Context(), h.db, req.CeremonyID, webAuthnPurposeMFA)
+	if err != nil || owner.Bytes != claims.UserID {
+		return mfaError(c, fiber.StatusUnauthorized, errWebAuthnChallenge.Error())
+	}
+
+	user, err := h.db.GetUserByID(c.Context(), pgtype.UUID{Bytes: claims.UserID, Valid: true})
+	if err != nil {
+		return mfaError(c, fiber.StatusUnauthorized, "Invalid or expired challenge. Please log in again.")
+	}
+
+	webAuthnUser, err := loadWebAuthnUser(c.Context(), h.db, user)
+	if err != nil {
+		return mfaError(c, fiber.StatusInternalServerError, "Failed to load security keys")
+	}
+
+	credential, err := h.webauthn.FinishLogin(webAuthnUser, *session, req.Credential)
+	if err != nil {
+		log.Printf("WebAuthn second factor failed for user %s: %v", claims.UserID, err)
+		recordAudit(c, h.audit, services.AuditEvent{
+			ActorID: claims.UserID,
+			Action:  services.AuditMFAFailed,
+			Details: map[string]string{"factor": "security_key"},
+		})
+		return mfaError(c, fiber.StatusUnauthorized, "Security key verification failed")
+	}
+	recordWebAuthnUse(c.Context(), h.db, credential)
+
+	return h.completeLogin(c, models.FromDatabaseUser(&user), nil)
+}
+
+// BeginPasskeyLogin returns the options for a passwordless login with a
+// passkey. No account is named; the authenticator picks the credential.
+func (h *AuthHandler) BeginPasskeyLogin(c *fiber.Ctx) error {
+	assertion, session, err := h.webauthn.BeginPasswordlessLogin()
+	if err != nil {
+		return mfaError(c, fiber.StatusInternalServerError, "Failed to start passkey login")
+	}
+
+	ceremonyID, err := saveWebAuthnChallenge(c.Context(), h.db, pgtype.UUID{}, webAuthnPurposePasswordless, session)
+	if err != nil {
+		return mfaError(c, fiber.StatusInternalServerError, "Failed to start passkey login")
+	}
+
+	return c.JSON(fiber.Map{
+		"ceremony_id": ceremonyID.String(),
+		"options":     assertion,
+	})
+}
+
+// FinishPasskeyLogin signs in the owner of the passkey. The authenticator
+// verified the user, so no further factor is asked for.
+func (h *AuthHandler) FinishPasskeyLogin(c *fiber.Ctx) error {
+	var req models.WebAuthnFinishRequest
+	if err := c.BodyParser(&req); err != nil || len(req.Credential) == 0 {
+		return mfaError(c, fiber.StatusBadRequest, "Invalid request body")
+	}
+
+	session, _, err := takeWebAuthnChallenge(c.Context(), h.db, req.CeremonyID, webAuthnPurposePasswordless)
+	if err != nil {
+		return mfaError(c, fiber.StatusUnauthorized, errWebAuthnChallenge.Error())
+	}
+
+	var user database.User
+	lookup := func(userID uuid.UUID) (*auth.WebAuthnUser, error) {
+		user, err = h.db.GetUserByID(c.Context(), pgtype.UUID{Bytes: userID, Valid: true})
+		if err != nil {
+			return nil, err
+		}
+		return loadWebAuthnUser(c.Context(), h.db, user)
+	}
+
+	_, credential, err := h.webauthn.FinishPasswordlessLogin(*session, req.Credential, lookup)
+	if err != nil {
+		log.Printf("Passkey login failed: %v", err)
+		return mfaError(c, fiber.StatusUnauthorized, "Passkey verification failed")
+	}
+	recordWebAuthnUse(c.Context(), h.db, credential)
+
+	return h.completeLogin(c, models.FromDatabaseUser(&user), nil)
+}
+
+// startMFAChallenge answers a login with a correct password with a challenge
+// for the second factor. Users who must set up MFA first get a new TOTP
+// secret with the challenge.
+func (h *AuthHandler) startMFAChallenge(c *fiber.Ctx, user *models.UserCache, hasWebAuthn bool) error {
+	challenge, err := h.mfaChallenge(c, user, hasWebAuthn)
+	if err != nil {
+		return mfaError(c, fiber.StatusInternalServerError, "Failed to start two-factor authentication")
+	}
+
+	if c.Get("HX-Request") == "true" {
+		c.Set("Content-Type", "text/html")
+		return templates.MFAChallengeForm(challenge).Render(c.Context(), c.Response().BodyWriter())
+	}
+
+	methods := []string{}
+	if challenge.TOTP {
+		methods = append(methods, "totp", "recovery_code")
+	}
+	if challenge.WebAuthn {
+		methods = append(methods, "webauthn")
+	}
+
+	response := fiber.Map{
+		"mfa_required":    true,
+		"challenge_token": challenge.Token,
+		"methods":         methods,
+		"expires_at":      time.Now().Add(mfaChallengeTTL).Format(time.RFC3339),
+	}
+	if challenge.Setup {
+		response["mfa_setup_required"] = true
+		response["secret"] = challenge.Secret
+		response["provisioning_uri"] = challenge.ProvisioningURI
+	}
+	return c.JSON(response)
+}
+
+// mfaChallenge issues the challenge token for a login's second step, and
+// starts TOTP enrollment for users who have no second factor yet
+func (h *AuthHandler) mfaChallenge(c *fiber.Ctx, user *models.UserCache, hasWebAuthn bool) (templates.MFAChallenge, error) {
+	userUUID, err := uuid.Parse(user.ID)
+	if err != nil {
+		return templates.MFAChallenge{}, err
+	}
+	challenge := templates.MFAChallenge{
+		Setup:    !user.TOTPEnabled && !hasWebAuthn,
+		TOTP:     user.TOTPEnabled,
+		WebAuthn: hasWebAuthn,
+	}
+
+	purpose := auth.MFAPurposeLogin
+	if challenge.Setup {
+		purpose = auth.MFAPurposeSetup
+
+		dbUser, err := h.db.GetUserByID(c.Context(), pgtype.UUID{Bytes: userUUID, Valid: true})
+		if err != nil {
+			return templates.MFAChallenge{}, err
+		}
+		challenge.Secret, challenge.ProvisioningURI, err = startTOTPEnrollment(c.Context(), h.db, dbUser)
+		if err != nil {
+			return templates.MFAChallenge{}, err
+		}
+	}
+
+	token, err := h.jwtService.GenerateMFAChallengeToken(userUUID, purpose, mfaChallengeTTL)
+	if err != nil {
+		return templates.MFAChallenge{}, err
+	}
+	challenge.Token = token
+	return challenge, nil
+}
+
+// completeLogin starts a session for a user who passed all login checks.
+// Recovery codes are included when MFA was just set up.
+func (h *AuthHandler) completeLogin(c *fiber.Ctx, user *models.UserCache, recoveryCodes []string) error {
+	if !user.IsActive {
+		return mfaError(c, fiber.StatusForbidden, accountDeactivatedMessage)
+	}
+
+	// Start a server-side session and issue tokens bound to it
+	userUUID, err := uuid.Parse(user.ID)
+	if err != nil {
+		return mfaError(c, fiber.StatusInternalServerError, "Failed to load account")
+	}
+	h.resetLoginFailures(c, pgtype.UUID{Bytes: userUUID, Valid: true})
+	token, refreshToken, err := h.startSession(c, userUUID)
 	if err != nil {
 		if c.Get("HX-Request") == "true" {
 			return c.Status(fiber.StatusInternalServerError).SendString(`<div class="mb-4 p-4 bg-red-100 border border-red-400 text-red-700 rounded"><p>Failed to generate token</p></div>`)
@@ -151,72 +538,301 @@ func (h *AuthHandler) Login(c *fiber.Ctx) error {
 	}
 
 	if c.Get("HX-Request") == "true" {
-		// Set auth cookie for web requests
-		isProduction := os.Getenv("APP_ENV") == "production"
-		c.Cookie(&fiber.Cookie{
-			Name:     "auth_token",
-			Value:    token,
-			HTTPOnly: true,
-			Secure:   isProduction, // Secure only in production with HTTPS
-			SameSite: "Lax",
-			MaxAge:   86400, // 24 hours
-		})
+		// Set auth cookies for web requests
+		setAuthCookies(c, token, refreshToken)
+		if len(recoveryCodes) > 0 {
+			// Show the recovery codes before moving on
+			c.Set("HX-Retarget", "#content")
+			c.Set("Content-Type", "text/html")
+			return templates.RecoveryCodes(recoveryCodes, "/documents").Render(c.Context(), c.Response().BodyWriter())
+		}
 		// For HTMX, redirect to documents page on success
 		c.Set("HX-Redirect", "/documents")
 		return c.SendString("")
 	}
 
 	return c.JSON(models.LoginResponse{
-		Token: token,
+		Token:        token,
+		RefreshToken: refreshToken,
 		User: models.UserResponse{
 			ID:        user.ID,
 			Email:     user.Email,
 			FullName:  user.FullName,
 			CreatedAt: user.CreatedAt.Format(time.RFC3339),
 		},
-		ExpiresAt: time.Now().Add(24 * time.Hour).Format(time.RFC3339),
+		ExpiresAt:        time.Now().Add(accessTokenTTL).Format(time.RFC3339),
+		RefreshExpiresAt: time.Now().Add(sessionTTL).Format(time.RFC3339),
+		RecoveryCodes:    recoveryCodes,
 	})
 }
 
+// Refresh exchanges a refresh token for a new access token and a new
+// refresh token. API clients send the refresh token in the request body,
+// web clients in the refresh cookie.
 func (h *AuthHandler) Refresh(c *fiber.Ctx) error {
-	authHeader := c.Get("Authorization")
-	if authHeader == "" {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Authorization header required"})
+	var req models.RefreshRequest
+	if err := c.BodyParser(&req); err != nil {
+		req.RefreshToken = c.FormValue("refresh_token")
 	}
 
-	tokenParts := strings.Split(authHeader, " ")
-	if len(tokenParts) != 2 || tokenParts[0] != "Bearer" {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid authorization header format"})
+	fromCookie := false
+	if req.RefreshToken == "" {
+		req.RefreshToken = c.Cookies(refreshCookieName)
+		fromCookie = true
 	}
-
-	tokenString := tokenParts[1]
-	claims, err := h.jwtService.ValidateToken(tokenString)
-	if err != nil {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid or expired token"})
+	if req.RefreshToken == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Refresh token required"})
 	}
 
-	// Check if user still exists - with caching
-	_, err = h.cache.GetUserByID(c.Context(), claims.UserID)
+	token, refreshToken, err := h.rotateRefreshToken(c, req.RefreshToken)
 	if err != nil {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "User not found"})
+		if fromCookie && !errors.Is(err, errRefreshTokenRaced) {
+			clearAuthCookies(c)
+		}
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": err.Error()})
 	}
 
-	// Generate new token
-	newToken, err := h.jwtService.GenerateToken(claims.UserID, 24*time.Hour)
-	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to generate token"})
+	if fromCookie {
+		// Keep the refresh token out of reach of scripts
+		setAuthCookies(c, token, refreshToken)
+		return c.JSON(fiber.Map{
+			"token":      token,
+			"expires_at": time.Now().Add(accessTokenTTL).Format(time.RFC3339),
+		})
 	}
 
 	return c.JSON(fiber.Map{
-		"token":      newToken,
-		"expires_at": time.Now().Add(24 * time.Hour).Format(time.RFC3339),
+		"token":              token,
+		"refresh_token":      refreshToken,
+		"expires_at":         time.Now().Add(accessTokenTTL).Format(time.RFC3339),
+		"refresh_expires_at": time.Now().Add(sessionTTL).Format(time.RFC3339),
 	})
 }
 
+// RefreshCookies renews the access token cookie of web clients whose access
+// token has expired, so pages and HTMX requests keep working for as long as
+// the refresh token is valid
+func (h *AuthHandler) RefreshCookies(c *fiber.Ctx) error {
+	refreshToken := c.Cookies(refreshCookieName)
+	if refreshToken == "" || c.Get("Authorization") != "" {
+		return c.Next()
+	}
+	if token := c.Cookies("auth_token"); token != "" {
+		if _, err := h.jwtService.ValidateToken(token); err == nil {
+			return c.Next()
+		}
+	}
+
+	token, newRefreshToken, err := h.rotateRefreshToken(c, refreshToken)
+	if err != nil {
+		// Leave the cookies alone when a parallel request rotated the token,
+		// its response carries the new ones
+		if !errors.Is(err, errRefreshTokenRaced) {
+			clearAuthCookies(c)
+		}
+		return c.Next()
+	}
+
+	setAuthCookies(c, token, newRefreshToken)
+	// Let the rest of this request see the new tokens as well
+	c.Request().Header.SetCookie("auth_token", token)
+	c.Request().Header.SetCookie(refreshCookieName, newRefreshToken)
+	return c.Next()
+}
+
 func (h *AuthHandler) Logout(c *fiber.Ctx) error {
-	// Clear the auth cookie
-	c.ClearCookie("auth_token")
+	// End the server-side session so the tokens stop working everywhere
+	if sessionID, ok := h.requestSession(c); ok {
+		event := services.AuditEvent{
+			Action:       services.AuditLogout,
+			ResourceType: "session",
+			ResourceID:   sessionID.String(),
+		}
+		if session, err := h.cache.GetSessionByID(c.Context(), sessionID); err == nil {
+			event.ActorID, _ = uuid.Parse(session.UserID)
+		}
+		if err := h.db.DeleteSession(c.Context(), pgtype.UUID{Bytes: sessionID, Valid: true}); err != nil {
+			log.Printf("Failed to delete session %s: %v", sessionID, err)
+		}
+		h.cache.InvalidateSession(c.Context(), sessionID)
+		recordAudit(c, h.audit, event)
+	}
+
+	// Clear the auth cookies
+	clearAuthCookies(c)
 
-	// Always redirect to home page for web requests
+	// API clients get a plain response, web requests go back to the home page
+	if c.Get("Authorization") != "" {
+		return c.SendStatus(fiber.StatusNoContent)
+	}
 	return c.Redirect("/")
 }
+
+// requestSession finds the session of the request from its access token,
+// or from its refresh token once the access token has expired
+func (h *AuthHandler) requestSession(c *fiber.Ctx) (uuid.UUID, bool) {
+	if token := auth.GetToken(c); token != "" {
+		if claims, err := h.jwtService.ValidateToken(token); err == nil {
+			return claims.SessionID, true
+		}
+	}
+
+	var req models.RefreshRequest
+	if err := c.BodyParser(&req); err != nil || req.RefreshToken == "" {
+		req.RefreshToken = c.Cookies(refreshCookieName)
+	}
+	if req.RefreshToken == "" {
+		return uuid.Nil, false
+	}
+
+	refreshToken, err := h.db.GetRefreshTokenByHash(c.Context(), auth.HashToken(req.RefreshToken))
+	if err != nil {
+		return uuid.Nil, false
+	}
+	return refreshToken.SessionID.Bytes, true
+}
+
+// startSession records a new login session and returns an access token and
+// a refresh token bound to it
+func (h *AuthHandler) startSession(c *fiber.Ctx, userID uuid.UUID) (string, string, error) {
+	sessionID := uuid.New()
+	token, err := h.jwtService.GenerateToken(userID, sessionID, accessTokenTTL)
+	if err != nil {
+		return "", "", err
+	}
+
+	params := database.CreateSessionParams{
+		ID:        pgtype.UUID{Bytes: sessionID, Valid: true},
+		UserID:    pgtype.UUID{Bytes: userID, Valid: true},
+		Token:     auth.HashToken(token),
+		ExpiresAt: pgtype.Timestamptz{Time: time.Now().Add(sessionTTL), Valid: true},
+		UserAgent: pgtype.Text{String: c.Get("User-Agent"), Valid: c.Get("User-Agent") != ""},
+	}
+	if ip, err := netip.ParseAddr(middleware.ClientIP(c)); err == nil {
+		params.IpAddress = &ip
+	}
+
+	if _, err := h.db.CreateSession(c.Context(), params); err != nil {
+		return "", "", err
+	}
+
+	refreshToken, err := h.issueRefreshToken(c.Context(), sessionID)
+	if err != nil {
+		return "", "", err
+	}
+
+	recordAudit(c, h.audit, services.AuditEvent{
+		ActorID:      userID,
+		Action:       services.AuditLogin,
+		ResourceType: "session",
+		ResourceID:   sessionID.String(),
+	})
+	return token, refreshToken, nil
+}
+
+// issueRefreshToken stores a new refresh token for the session. Only its
+// hash is kept in the database.
+func (h *AuthHandler) issueRefreshToken(ctx context.Context, sessionID uuid.UUID) (string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(raw)
+
+	_, err := h.db.CreateRefreshToken(ctx, database.CreateRefreshTokenParams{
+		SessionID: pgtype.UUID{Bytes: sessionID, Valid: true},
+		TokenHash: auth.HashToken(token),
+		ExpiresAt: pgtype.Timestamptz{Time: time.Now().Add(sessionTTL), Valid: true},
+	})
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// rotateRefreshToken marks a refresh token as used and issues a new access
+// token and refresh token for its session. Presenting a token that was
+// already used means it has leaked, so the whole session is ended.
+func (h *AuthHandler) rotateRefreshToken(c *fiber.Ctx, refreshToken string) (string, string, error) {
+	hash := auth.HashToken(refreshToken)
+
+	current, err := h.db.UseRefreshToken(c.Context(), hash)
+	if err != nil {
+		previous, lookupErr := h.db.GetRefreshTokenByHash(c.Context(), hash)
+		if lookupErr != nil || !previous.UsedAt.Valid {
+			return "", "", errRefreshTokenInvalid
+		}
+		if time.Since(previous.UsedAt.Time) < refreshReuseGrace {
+			return "", "", errRefreshTokenRaced
+		}
+
+		sessionID := uuid.UUID(previous.SessionID.Bytes)
+		log.Printf("Refresh token reuse detected, ending session %s", sessionID)
+		if err := h.db.DeleteSession(c.Context(), previous.SessionID); err != nil {
+			log.Printf("Failed to delete session %s: %v", sessionID, err)
+		}
+		h.cache.InvalidateSession(c.Context(), sessionID)
+		return "", "", errRefreshTokenReused
+	}
+
+	session, err := h.db.GetSessionByID(c.Context(), current.SessionID)
+	if err != nil {
+		return "", "", errRefreshTokenInvalid
+	}
+
+	// Check if user still exists and may sign in - with caching
+	userID := uuid.UUID(session.UserID.Bytes)
+	if user, err := h.cache.GetUserByID(c.Context(), userID); err != nil || !user.IsActive {
+		return "", "", errRefreshTokenInvalid
+	}
+
+	sessionID := uuid.UUID(session.ID.Bytes)
+	token, err := h.jwtService.GenerateToken(userID, sessionID, accessTokenTTL)
+	if err != nil {
+		return "", "", err
+	}
+
+	_, err = h.db.RenewSession(c.Context(), database.RenewSessionParams{
+		ID:        session.ID,
+		Token:     auth.HashToken(token),
+		ExpiresAt: pgtype.Timestamptz{Time: time.Now().Add(sessionTTL), Valid: true},
+	})
+	if err != nil {
+		// The session was logged out or has expired
+		return "", "", errRefreshTokenInvalid
+	}
+	h.cache.InvalidateSession(c.Context(), sessionID)
+
+	newRefreshToken, err := h.issueRefreshToken(c.Context(), sessionID)
+	if err != nil {
+		return "", "", err
+	}
+
+	return token, newRefreshToken, nil
+}
+
+// setAuthCookies stores the access and refresh tokens of web clients in
+// HttpOnly cookies
+func setAuthCookies(c *fiber.Ctx, token, refreshToken string) {
+	isProduction := os.Getenv("APP_ENV") == "production"
+	c.Cookie(&fiber.Cookie{
+		Name:     "auth_token",
+		Value:    token,
+		HTTPOnly: true,
+		Secure:   isProduction, // Secure only in production with HTTPS
+		SameSite: "Lax",
+		MaxAge:   int(accessTokenTTL.Seconds()),
+	})
+	c.Cookie(&fiber.Cookie{
+		Name:     refreshCookieName,
+		Value:    refreshToken,
+		HTTPOnly: true,
+		Secure:   isProduction,
+		SameSite: "Lax",
+		MaxAge:   int(sessionTTL.Seconds()),
+	})
+}
+
+func clearAuthCookies(c *fiber.Ctx) {
+	c.ClearCookie("auth_token", refreshCookieName)
+}
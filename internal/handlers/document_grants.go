@@ -0,0 +1,264 @@
+package handlers
+
+import (
+	"fmt"
+	"html"
+	"strings"
+	"time"
+
+	"Secure-Document-Exchange-Portal/internal/auth"
+	"Secure-Document-Exchange-Portal/internal/database"
+	"Secure-Document-Exchange-Portal/internal/models"
+	"Secure-Document-Exchange-Portal/internal/services"
+	"Secure-Document-Exchange-Portal/templates"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// Grant shares a document with another portal user, by email, or with a
+// team of an organization the current user belongs to. Granting again
+// changes the permission.
+func (h *DocumentHandler) Grant(c *fiber.Ctx) error {
+	doc, userID, ok, err := h.grantableDocument(c)
+	if !ok {
+		return err
+	}
+
+	var req models.DocumentGrantRequest
+	if err := c.BodyParser(&req); err != nil {
+		return grantError(c, fiber.StatusBadRequest, "Invalid request body")
+	}
+	if req.Permission == "" {
+		req.Permission = auth.GrantRead
+	}
+	if !auth.ValidGrant(req.Permission) {
+		return grantError(c, fiber.StatusBadRequest, "Permission must be read or edit")
+	}
+
+	var (
+		grant database.DocumentGrant
+		name  string
+	)
+	switch {
+	case req.TeamID != "" && req.Email == "":
+		teamID, err := uuid.Parse(req.TeamID)
+		if err != nil {
+			return grantError(c, fiber.StatusBadRequest, "Invalid team ID")
+		}
+		team, err := h.db.GetTeamByID(c.Context(), pgtype.UUID{Bytes: teamID, Valid: true})
+		if err != nil {
+			return grantError(c, fiber.StatusNotFound, "Team not found")
+		}
+		// Only teams of the user's own organizations can be found
+		role, err := h.cache.GetOrganizationRole(c.Context(), team.OrganizationID.Bytes, userID)
+		if err != nil {
+			return grantError(c, fiber.StatusInternalServerError, "Failed to share document")
+		}
+		if role == "" {
+			return grantError(c, fiber.StatusNotFound, "Team not found")
+		}
+		grant, err = h.db.GrantDocumentTeam(c.Context(), database.GrantDocumentTeamParams{
+			DocumentID: doc.ID,
+			TeamID:     team.ID,
+			Permission: req.Permission,
+			GrantedBy:  pgtype.UUID{Bytes: userID, Valid: true},
+		})
+		if err != nil {
+			return grantError(c, fiber.StatusInternalServerError, "Failed to share document")
+		}
+		name = team.Name
+
+	case req.Email != "" && req.TeamID == "":
+		user, err := h.db.GetUserByEmail(c.Context(), strings.TrimSpace(req.Email))
+		if err != nil || !user.IsActive.Bool {
+			return grantError(c, fiber.StatusNotFound, "No user with this email address")
+		}
+		if user.ID.Bytes == userID {
+			return grantError(c, fiber.StatusBadRequest, "You cannot share a document with yourself")
+		}
+		grant, err = h.db.GrantDocumentUser(c.Context(), database.GrantDocumentUserParams{
+			DocumentID: doc.ID,
+			UserID:     user.ID,
+			Permission: req.Permission,
+			GrantedBy:  pgtype.UUID{Bytes: userID, Valid: true},
+		})
+		if err != nil {
+			return grantError(c, fiber.StatusInternalServerError, "Failed to share document")
+		}
+		name = user.Email
+
+	default:
+		return grantError(c, fiber.StatusBadRequest, "Give either an email address or a team ID")
+	}
+	h.cache.InvalidateDocumentGrants(c.Context(), doc.ID.Bytes)
+	event := documentEvent(services.AuditDocumentGranted, doc)
+	event.Details["grantee"] = name
+	event.Details["permission"] = grant.Permission
+	recordAudit(c, h.audit, event)
+
+	if c.Get("HX-Request") == "true" {
+		c.Set("Content-Type", "text/html")
+		return c.Status(fiber.StatusCreated).SendString(fmt.Sprintf(
+			`<p class="text-sm text-green-700 dark:text-green-400">Shared with %s (%s)</p>`,
+			html.EscapeString(name), grant.Permission))
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(grantJSON(grant))
+}
+
+// Grants lists who a document was shared with
+func (h *DocumentHandler) Grants(c *fiber.Ctx) error {
+	doc, _, ok, err := h.grantableDocument(c)
+	if !ok {
+		return err
+	}
+
+	grants, err := h.db.ListDocumentGrants(c.Context(), doc.ID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to list grants"})
+	}
+
+	result := make([]fiber.Map, 0, len(grants))
+	for _, grant := range grants {
+		item := fiber.Map{
+			"id":         grant.ID.String(),
+			"permission": grant.Permission,
+			"created_at": grant.CreatedAt.Time.Format(time.RFC3339),
+		}
+		if grant.UserID.Valid {
+			item["user_id"] = grant.UserID.String()
+			item["email"] = grant.Email.String
+		} else {
+			item["team_id"] = grant.TeamID.String()
+			item["team_name"] = grant.TeamName.String
+		}
+		result = append(result, item)
+	}
+	return c.JSON(result)
+}
+
+// RevokeGrant stops sharing a document with a user or team
+func (h *DocumentHandler) RevokeGrant(c *fiber.Ctx) error {
+	doc, _, ok, err := h.grantableDocument(c)
+	if !ok {
+		return err
+	}
+
+	grantID, err := uuid.Parse(c.Params("grantId"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid grant ID"})
+	}
+
+	revoked, err := h.db.RevokeDocumentGrant(c.Context(), database.RevokeDocumentGrantParams{
+		ID:         pgtype.UUID{Bytes: grantID, Valid: true},
+		DocumentID: doc.ID,
+	})
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Grant not found"})
+	}
+	h.cache.InvalidateDocumentGrants(c.Context(), doc.ID.Bytes)
+	event := documentEvent(services.AuditDocumentUngranted, doc)
+	event.Details["grant_id"] = revoked.ID.String()
+	if revoked.UserID.Valid {
+		event.Details["user_id"] = revoked.UserID.String()
+	}
+	if revoked.TeamID.Valid {
+		event.Details["team_id"] = revoked.TeamID.String()
+	}
+	recordAudit(c, h.audit, event)
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// SharedWithMe lists the documents other users shared with the current
+// user, directly or through their teams
+func (h *DocumentHandler) SharedWithMe(c *fiber.Ctx) error {
+	userID, err := auth.GetUserID(c)
+	if err != nil {
+		return err
+	}
+
+	docs, err := h.db.ListSharedDocuments(c.Context(), pgtype.UUID{Bytes: userID, Valid: true})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to list shared documents"})
+	}
+
+	if c.Get("Accept") == "text/html" || c.Get("HX-Request") == "true" {
+		var templateDocs []templates.SharedDocument
+		for _, doc := range docs {
+			templateDocs = append(templateDocs, templates.SharedDocument{
+				ID:         doc.ID.String(),
+				Filename:   doc.Filename,
+				FileSize:   doc.FileSize,
+				MimeType:   doc.MimeType,
+				OwnerEmail: doc.OwnerEmail,
+				Permission: doc.Permission,
+				SharedAt:   doc.SharedAt.Time.Format(time.RFC3339),
+			})
+		}
+		c.Set("Content-Type", "text/html")
+		return templates.SharedDocumentList(templateDocs).Render(c.Context(), c.Response().BodyWriter())
+	}
+
+	result := make([]fiber.Map, 0, len(docs))
+	for _, doc := range docs {
+		result = append(result, fiber.Map{
+			"id":          doc.ID.String(),
+			"filename":    doc.Filename,
+			"file_size":   doc.FileSize,
+			"mime_type":   doc.MimeType,
+			"owner_email": doc.OwnerEmail,
+			"permission":  doc.Permission,
+			"shared_at":   doc.SharedAt.Time.Format(time.RFC3339),
+		})
+	}
+	return c.JSON(result)
+}
+
+// grantableDocument loads the document named in the URL and checks that the
+// current user may share it
+func (h *DocumentHandler) grantableDocument(c *fiber.Ctx) (database.Document, uuid.UUID, bool, error) {
+	userID, err := auth.GetUserID(c)
+	if err != nil {
+		return database.Document{}, uuid.Nil, false, err
+	}
+
+	docID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return database.Document{}, uuid.Nil, false, c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid document ID"})
+	}
+
+	doc, err := h.db.GetDocumentByID(c.Context(), pgtype.UUID{Bytes: docID, Valid: true})
+	if err != nil {
+		return database.Document{}, uuid.Nil, false, c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Document not found"})
+	}
+
+	if ok, err := authorize(c, h.policy, userID, auth.ActionShareCreate, documentResource(doc)); !ok {
+		return database.Document{}, uuid.Nil, false, err
+	}
+	return doc, userID, true, nil
+}
+
+// grantError answers a failed grant, as a message for the share form when
+// it came from HTMX
+func grantError(c *fiber.Ctx, status int, message string) error {
+	if c.Get("HX-Request") == "true" {
+		c.Set("Content-Type", "text/html")
+		return c.Status(status).SendString(fmt.Sprintf(
+			`<p class="text-sm text-red-600 dark:text-red-400">%s</p>`, html.EscapeString(message)))
+	}
+	return c.Status(status).JSON(fiber.Map{"error": message})
+}
+
+func grantJSON(grant database.DocumentGrant) fiber.Map {
+	return fiber.Map{
+		"id":          grant.ID.String(),
+		"document_id": grant.DocumentID.String(),
+		"user_id":     grant.UserID.String(),
+		"team_id":     grant.TeamID.String(),
+		"permission":  grant.Permission,
+		"created_at":  grant.CreatedAt.Time.Format(time.RFC3339),
+	}
+}
@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"slices"
+	"strings"
+
+	"Secure-Document-Exchange-Portal/internal/auth"
+	"Secure-Document-Exchange-Portal/internal/database"
+	"Secure-Document-Exchange-Portal/internal/models"
+	"Secure-Document-Exchange-Portal/internal/services"
+	"Secure-Document-Exchange-Portal/internal/validation"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// Tags returns the tags of a document
+func (h *DocumentHandler) Tags(c *fiber.Ctx) error {
+	doc, ok, err := h.taggedDocument(c, auth.ActionDocumentList)
+	if !ok {
+		return err
+	}
+
+	tags, err := h.db.ListDocumentTags(c.Context(), doc.ID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to list tags"})
+	}
+	if tags == nil {
+		tags = []string{}
+	}
+	return c.JSON(fiber.Map{
+		"id":   doc.ID.String(),
+		"tags": tags,
+	})
+}
+
+// SetTags replaces the tags of a document. Tags decide which retention
+// policy applies to it.
+func (h *DocumentHandler) SetTags(c *fiber.Ctx) error {
+	doc, ok, err := h.taggedDocument(c, auth.ActionDocumentUpdate)
+	if !ok {
+		return err
+	}
+
+	var req models.TagsRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	tags := make([]string, 0, len(req.Tags))
+	for _, tag := range req.Tags {
+		tag = strings.TrimSpace(tag)
+		if !slices.Contains(tags, tag) {
+			tags = append(tags, tag)
+		}
+	}
+	if err := validation.ValidateTags(tags); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	if err := h.db.SetDocumentTags(c.Context(), database.SetDocumentTagsParams{
+		DocumentID: doc.ID,
+		Tags:       tags,
+	}); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update tags"})
+	}
+	event := documentEvent(services.AuditDocumentTagged, doc)
+	event.Details["tags"] = strings.Join(tags, ",")
+	recordAudit(c, h.audit, event)
+
+	slices.Sort(tags)
+	return c.JSON(fiber.Map{
+		"id":   doc.ID.String(),
+		"tags": tags,
+	})
+}
+
+// taggedDocument loads the document named in the URL and checks that the
+// current user may take the action on it
+func (h *DocumentHandler) taggedDocument(c *fiber.Ctx, action auth.Action) (database.Document, bool, error) {
+	userID, err := auth.GetUserID(c)
+	if err != nil {
+		return database.Document{}, false, err
+	}
+
+	docID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return database.Document{}, false, c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid document ID"})
+	}
+
+	doc, err := h.db.GetDocumentByID(c.Context(), pgtype.UUID{Bytes: docID, Valid: true})
+	if err != nil {
+		return database.Document{}, false, c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Document not found"})
+	}
+
+	if ok, err := authorize(c, h.policy, userID, action, documentResource(doc)); !ok {
+		return database.Document{}, false, err
+	}
+	return doc, true, nil
+}
@@ -2,9 +2,15 @@ package handlers
 
 import (
 	"bytes"
+	"context"
 	"crypto/sha256"
+	"errors"
 	"fmt"
+	"html"
 	"io"
+	"log"
+	"mime"
+	"mime/multipart"
 	"path/filepath"
 	"strings"
 	"time"
@@ -19,21 +25,26 @@ import (
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/minio/minio-go/v7"
-	"golang.org/x/crypto/bcrypt"
 )
 
 type DocumentHandler struct {
 	db      *database.Queries
 	storage services.StorageService
 	cache   *services.CachedRepository
+	policy  *auth.Policy
+	quotas  *services.QuotaService
+	audit   *services.AuditLog
 	// encryption services.EncryptionService // TODO: add when implemented
 }
 
-func NewDocumentHandler(db *database.Queries, storage services.StorageService, cache *services.CachedRepository) *DocumentHandler {
+func NewDocumentHandler(db *database.Queries, storage services.StorageService, cache *services.CachedRepository, policy *auth.Policy, quotas *services.QuotaService, audit *services.AuditLog) *DocumentHandler {
 	return &DocumentHandler{
 		db:      db,
 		storage: storage,
 		cache:   cache,
+		policy:  policy,
+		quotas:  quotas,
+		audit:   audit,
 	}
 }
 
@@ -60,17 +71,80 @@ func (h *DocumentHandler) Upload(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
 	}
 
+	workspaceID, err := requestWorkspace(c, h.db, h.policy, userID, c.FormValue("workspace_id"), auth.ActionDocumentUpload)
+	if err != nil {
+		return err
+	}
+
+	doc, usage, err := storeDocument(c.Context(), h.quotas, h.storage, userID, workspaceID, pgtype.UUID{Valid: false}, file)
+	if err != nil {
+		var fiberErr *fiber.Error
+		if c.Get("HX-Request") == "true" && errors.As(err, &fiberErr) {
+			errorMsg := fmt.Sprintf(`<div class="mb-4 p-4 bg-red-100 border border-red-400 text-red-700 rounded">
+				<p class="font-semibold">✗ Upload failed</p>
+				<p class="text-sm mt-1">%s</p>
+			</div>`, html.EscapeString(fiberErr.Message))
+			return c.Status(fiberErr.Code).SendString(errorMsg)
+		}
+		return err
+	}
+
+	// Invalidate the workspace's document list cache
+	h.cache.InvalidateWorkspaceDocuments(c.Context(), workspaceID.Bytes)
+	recordAudit(c, h.audit, documentEvent(services.AuditDocumentUploaded, doc))
+
+	// Check if request is from HTMX
+	if c.Get("HX-Request") == "true" {
+		// Return user-friendly HTML message and trigger document list refresh
+		successMsg := fmt.Sprintf(`<div class="mb-4 p-4 bg-green-100 border border-green-400 text-green-700 rounded">
+			<p class="font-semibold">✓ File uploaded successfully!</p>
+			<p class="text-sm mt-1">%s (%.2f MB)</p>
+		</div>`, html.EscapeString(doc.Filename), float64(doc.FileSize)/1024/1024)
+		if warning := usage.Warning(); warning != "" {
+			successMsg += fmt.Sprintf(`<div class="mb-4 p-4 bg-yellow-100 border border-yellow-400 text-yellow-800 rounded">
+			<p class="text-sm">%s</p>
+		</div>`, warning)
+		}
+		c.Set("Content-Type", "text/html")
+		c.Set("HX-Trigger", "documentUploaded")
+		return c.Status(fiber.StatusCreated).SendString(successMsg)
+	}
+
+	result := fiber.Map{
+		"id":           doc.ID.String(),
+		"filename":     doc.Filename,
+		"file_size":    doc.FileSize,
+		"mime_type":    doc.MimeType,
+		"workspace_id": doc.WorkspaceID.String(),
+		"created_at":   doc.CreatedAt.Time.Format(time.RFC3339),
+	}
+	if warning := usage.Warning(); warning != "" {
+		result["quota_warning"] = warning
+	}
+	return c.Status(fiber.StatusCreated).JSON(result)
+}
+
+// storeDocument writes a validated upload to storage and records it as a
+// document in the workspace, uploaded by userID. It returns the storage
+// usage of the fuller account the document counted against. Errors are
+// *fiber.Error values ready to return.
+func storeDocument(ctx context.Context, quotas *services.QuotaService, storage services.StorageService, userID uuid.UUID, workspaceID, folderID pgtype.UUID, file *multipart.FileHeader) (database.Document, services.Usage, error) {
+	// Refuse uploads over quota before anything is written to storage
+	if err := quotas.Check(ctx, userID, workspaceID, file.Size); err != nil {
+		return database.Document{}, services.Usage{}, quotaError(err)
+	}
+
 	// Open file
 	src, err := file.Open()
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to open file"})
+		return database.Document{}, services.Usage{}, fiber.NewError(fiber.StatusInternalServerError, "Failed to open file")
 	}
 	defer src.Close()
 
 	// Read file content for checksum and encryption
 	fileData, err := io.ReadAll(src)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to read file"})
+		return database.Document{}, services.Usage{}, fiber.NewError(fiber.StatusInternalServerError, "Failed to read file")
 	}
 
 	// Calculate checksum
@@ -86,15 +160,15 @@ func (h *DocumentHandler) Upload(c *fiber.Ctx) error {
 
 	// Upload to storage
 	reader := bytes.NewReader(encryptedData)
-	_, err = h.storage.Upload(c.Context(), "documents", objectName, reader, int64(len(encryptedData)), minio.PutObjectOptions{
+	_, err = storage.Upload(ctx, "documents", objectName, reader, int64(len(encryptedData)), minio.PutObjectOptions{
 		ContentType: file.Header.Get("Content-Type"),
 	})
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to upload file to storage: " + err.Error()})
+		return database.Document{}, services.Usage{}, fiber.NewError(fiber.StatusInternalServerError, "Failed to upload file to storage: "+err.Error())
 	}
 
-	// Save to database
-	doc, err := h.db.CreateDocument(c.Context(), database.CreateDocumentParams{
+	// Save to database, counting the document against the quotas
+	doc, usage, err := quotas.CreateDocument(ctx, database.CreateDocumentParams{
 		UserID:       pgtype.UUID{Bytes: userID, Valid: true},
 		Filename:     file.Filename,
 		FilePath:     objectName,
@@ -102,34 +176,31 @@ func (h *DocumentHandler) Upload(c *fiber.Ctx) error {
 		FileSize:     file.Size,
 		MimeType:     file.Header.Get("Content-Type"),
 		Checksum:     checksum,
+		FolderID:     folderID,
+		WorkspaceID:  workspaceID,
 	})
 	if err != nil {
-		// TODO: delete from storage on error
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to save document to database: " + err.Error()})
+		if err := storage.Delete(ctx, "documents", objectName, minio.RemoveObjectOptions{}); err != nil {
+			log.Printf("Failed to delete unrecorded file %s from storage: %v", objectName, err)
+		}
+		var exceeded *services.QuotaError
+		if errors.As(err, &exceeded) {
+			return database.Document{}, services.Usage{}, quotaError(err)
+		}
+		return database.Document{}, services.Usage{}, fiber.NewError(fiber.StatusInternalServerError, "Failed to save document to database: "+err.Error())
 	}
 
-	// Invalidate user's document list cache
-	h.cache.InvalidateUserDocuments(c.Context(), userID)
+	return doc, usage, nil
+}
 
-	// Check if request is from HTMX
-	if c.Get("HX-Request") == "true" {
-		// Return user-friendly HTML message and trigger document list refresh
-		successMsg := fmt.Sprintf(`<div class="mb-4 p-4 bg-green-100 border border-green-400 text-green-700 rounded">
-			<p class="font-semibold">✓ File uploaded successfully!</p>
-			<p class="text-sm mt-1">%s (%.2f MB)</p>
-		</div>`, doc.Filename, float64(doc.FileSize)/1024/1024)
-		c.Set("Content-Type", "text/html")
-		c.Set("HX-Trigger", "documentUploaded")
-		return c.Status(fiber.StatusCreated).SendString(successMsg)
+// quotaError turns the error of a quota check into a *fiber.Error
+func quotaError(err error) error {
+	var exceeded *services.QuotaError
+	if errors.As(err, &exceeded) {
+		return fiber.NewError(fiber.StatusInsufficientStorage, exceeded.Error())
 	}
-
-	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
-		"id":         doc.ID.String(),
-		"filename":   doc.Filename,
-		"file_size":  doc.FileSize,
-		"mime_type":  doc.MimeType,
-		"created_at": doc.CreatedAt.Time.Format(time.RFC3339),
-	})
+	log.Printf("Failed to check storage quota: %v", err)
+	return fiber.NewError(fiber.StatusInternalServerError, "Failed to check storage quota")
 }
 
 func (h *DocumentHandler) List(c *fiber.Ctx) error {
@@ -138,8 +209,13 @@ func (h *DocumentHandler) List(c *fiber.Ctx) error {
 		return err
 	}
 
+	workspaceID, err := requestWorkspace(c, h.db, h.policy, userID, c.Query("workspace_id"), auth.ActionDocumentList)
+	if err != nil {
+		return err
+	}
+
 	// Use cached repository for document list
-	docs, err := h.cache.ListDocumentsByUser(c.Context(), userID)
+	docs, err := h.cache.ListDocumentsByWorkspace(c.Context(), workspaceID.Bytes)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to list documents"})
 	}
@@ -165,11 +241,13 @@ func (h *DocumentHandler) List(c *fiber.Ctx) error {
 	var result []fiber.Map
 	for _, doc := range docs {
 		result = append(result, fiber.Map{
-			"id":         doc.ID,
-			"filename":   doc.Filename,
-			"file_size":  doc.FileSize,
-			"mime_type":  doc.MimeType,
-			"created_at": doc.CreatedAt.Format(time.RFC3339),
+			"id":           doc.ID,
+			"filename":     doc.Filename,
+			"file_size":    doc.FileSize,
+			"mime_type":    doc.MimeType,
+			"folder_id":    doc.FolderID,
+			"workspace_id": doc.WorkspaceID,
+			"created_at":   doc.CreatedAt.Format(time.RFC3339),
 		})
 	}
 
@@ -193,9 +271,8 @@ func (h *DocumentHandler) Download(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Document not found"})
 	}
 
-	// Check ownership
-	if !bytes.Equal(doc.UserID.Bytes[:], userID[:]) {
-		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Access denied"})
+	if ok, err := authorize(c, h.policy, userID, auth.ActionDocumentRead, documentResource(doc)); !ok {
+		return err
 	}
 
 	// Download from storage
@@ -205,9 +282,11 @@ func (h *DocumentHandler) Download(c *fiber.Ctx) error {
 	}
 	defer obj.Close()
 
+	recordAudit(c, h.audit, documentEvent(services.AuditDocumentDownloaded, doc))
+
 	// Stream the file directly to response
 	c.Set("Content-Type", doc.MimeType)
-	c.Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", doc.Filename))
+	c.Set("Content-Disposition", contentDisposition("attachment", doc.Filename))
 
 	_, err = io.Copy(c.Response().BodyWriter(), obj)
 	if err != nil {
@@ -234,10 +313,10 @@ func (h *DocumentHandler) View(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Document not found"})
 	}
 
-	// Check ownership
-	if !bytes.Equal(doc.UserID.Bytes[:], userID[:]) {
-		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Access denied"})
+	if ok, err := authorize(c, h.policy, userID, auth.ActionDocumentRead, documentResource(doc)); !ok {
+		return err
 	}
+	recordAudit(c, h.audit, documentEvent(services.AuditDocumentViewed, doc))
 
 	// Check if it's an image type
 	mimeType := strings.ToLower(doc.MimeType)
@@ -285,6 +364,9 @@ func (h *DocumentHandler) View(c *fiber.Ctx) error {
 	}
 }
 
+// Delete moves a document to the trash. It can be restored until the
+// restore window passes and is deleted for good after that. Documents whose
+// retention period has not ended cannot be deleted.
 func (h *DocumentHandler) Delete(c *fiber.Ctx) error {
 	userID, err := auth.GetUserID(c)
 	if err != nil {
@@ -303,29 +385,30 @@ func (h *DocumentHandler) Delete(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Document not found"})
 	}
 
-	// Check ownership
-	if !bytes.Equal(doc.UserID.Bytes[:], userID[:]) {
-		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Access denied"})
+	if ok, err := authorize(c, h.policy, userID, auth.ActionDocumentDelete, documentResource(doc)); !ok {
+		return err
 	}
-
-	// Delete from storage first
-	err = h.storage.Delete(c.Context(), "documents", doc.FilePath, minio.RemoveObjectOptions{})
-	if err != nil {
-		// Log error but continue with DB deletion
-		fmt.Printf("Failed to delete file from storage: %v\n", err)
+	if ok, err := checkDocumentHold(c, h.db, h.audit, doc, "delete"); !ok {
+		return err
+	}
+	if ok, err := checkDocumentRetention(c, h.db, doc); !ok {
+		return err
 	}
 
-	// Delete from database (which checks ownership via user_id)
-	err = h.db.DeleteDocument(c.Context(), database.DeleteDocumentParams{
-		ID:     pgtype.UUID{Bytes: docID, Valid: true},
-		UserID: pgtype.UUID{Bytes: userID, Valid: true},
+	// Move to the trash (scoped to the document's workspace). The file
+	// stays in storage, and counts against the quotas, until it is purged.
+	_, err = h.db.TrashDocument(c.Context(), database.TrashDocumentParams{
+		ID:          pgtype.UUID{Bytes: docID, Valid: true},
+		WorkspaceID: doc.WorkspaceID,
+		DeletedBy:   pgtype.UUID{Bytes: userID, Valid: true},
 	})
 	if err != nil {
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Document not found or access denied"})
 	}
 
 	// Invalidate document cache
-	h.cache.InvalidateDocument(c.Context(), docID, userID)
+	h.cache.InvalidateDocument(c.Context(), docID, doc.WorkspaceID.Bytes)
+	recordAudit(c, h.audit, documentEvent(services.AuditDocumentTrashed, doc))
 
 	// Check if request expects HTML (HTMX)
 	if c.Get("Accept") == "text/html" || c.Get("HX-Request") == "true" {
@@ -349,132 +432,101 @@ func (h *DocumentHandler) CreateShare(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid document ID"})
 	}
 
-	// Check ownership
 	doc, err := h.db.GetDocumentByID(c.Context(), pgtype.UUID{Bytes: docID, Valid: true})
 	if err != nil {
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Document not found"})
 	}
 
-	if !bytes.Equal(doc.UserID.Bytes[:], userID[:]) {
-		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Access denied"})
+	if ok, err := authorize(c, h.policy, userID, auth.ActionShareCreate, documentResource(doc)); !ok {
+		return err
 	}
 
-	// Parse form fields for expiration, max_access, password
-	expireDaysStr := c.FormValue("expire_days")
-	expireHoursStr := c.FormValue("expire_hours")
-	maxAccessStr := c.FormValue("max_access")
-	password := c.FormValue("password")
-
-	// Calculate expiration time (default: 24 hours)
-	expiresAt := time.Now().Add(24 * time.Hour)
+	return issueShare(c, h.db, h.audit, userID, []uuid.UUID{docID}, uuid.Nil, "")
+}
 
-	var expireDays, expireHours int
-	if expireDaysStr != "" {
-		fmt.Sscanf(expireDaysStr, "%d", &expireDays)
-	}
-	if expireHoursStr != "" {
-		fmt.Sscanf(expireHoursStr, "%d", &expireHours)
+// MoveToFolder moves a document into a folder of its workspace. An empty
+// folder_id moves it back to the top level. Documents under legal hold stay
+// where they are.
+func (h *DocumentHandler) MoveToFolder(c *fiber.Ctx) error {
+	userID, err := auth.GetUserID(c)
+	if err != nil {
+		return err
 	}
 
-	// Validate expiration values
-	if expireDays > 0 || expireHours > 0 {
-		if err := validation.ValidateShareExpiration(expireDays, expireHours); err != nil {
-			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
-		}
-		totalHours := (expireDays * 24) + expireHours
-		expiresAt = time.Now().Add(time.Duration(totalHours) * time.Hour)
+	docID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid document ID"})
 	}
 
-	// Parse and validate max access count
-	maxAccess := -1
-	if maxAccessStr != "" {
-		fmt.Sscanf(maxAccessStr, "%d", &maxAccess)
-		if err := validation.ValidateShareMaxAccess(maxAccess); err != nil {
-			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
-		}
+	doc, err := h.db.GetDocumentByID(c.Context(), pgtype.UUID{Bytes: docID, Valid: true})
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Document not found"})
 	}
 
-	// Validate share password if provided
-	if err := validation.ValidateSharePassword(password); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	if ok, err := authorize(c, h.policy, userID, auth.ActionDocumentUpdate, inWorkspace(doc.WorkspaceID)); !ok {
+		return err
+	}
+	// Moving a held document out of a held folder would release it
+	if ok, err := checkDocumentHold(c, h.db, h.audit, doc, "move"); !ok {
+		return err
 	}
 
-	// Handle password - hash it using bcrypt
-	var passwordHash *string
-	if password != "" {
-		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	folderID := pgtype.UUID{Valid: false}
+	if folderIDStr := c.FormValue("folder_id"); folderIDStr != "" {
+		parsed, err := uuid.Parse(folderIDStr)
 		if err != nil {
-			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to process password"})
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid folder ID"})
 		}
-		hashStr := string(hashedPassword)
-		passwordHash = &hashStr
-	}
-
-	// Generate token
-	shareToken := uuid.New().String()
 
-	// Create share
-	var passwordText pgtype.Text
-	if passwordHash != nil {
-		passwordText = pgtype.Text{String: *passwordHash, Valid: true}
-	} else {
-		passwordText = pgtype.Text{Valid: false}
+		folder, err := h.db.GetFolderByID(c.Context(), pgtype.UUID{Bytes: parsed, Valid: true})
+		if err != nil {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Folder not found"})
+		}
+		if folder.WorkspaceID != doc.WorkspaceID {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Folder is in another workspace"})
+		}
+		folderID = pgtype.UUID{Bytes: parsed, Valid: true}
 	}
 
-	share, err := h.db.CreateShare(c.Context(), database.CreateShareParams{
-		DocumentID:   pgtype.UUID{Bytes: docID, Valid: true},
-		ShareToken:   shareToken,
-		ExpiresAt:    pgtype.Timestamptz{Time: expiresAt, Valid: true},
-		MaxAccess:    pgtype.Int4{Int32: int32(maxAccess), Valid: true},
-		PasswordHash: passwordText,
-		CreatedBy:    pgtype.UUID{Bytes: userID, Valid: true},
+	err = h.db.UpdateDocumentFolder(c.Context(), database.UpdateDocumentFolderParams{
+		ID:          pgtype.UUID{Bytes: docID, Valid: true},
+		FolderID:    folderID,
+		WorkspaceID: doc.WorkspaceID,
 	})
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to create share"})
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to move document"})
 	}
 
-	// Check if request expects HTML (HTMX)
-	if c.Get("Accept") == "text/html" || c.Get("HX-Request") == "true" {
-		c.Set("Content-Type", "text/html")
-		
-		// Format expiration info
-		duration := time.Until(share.ExpiresAt.Time)
-		days := int(duration.Hours() / 24)
-		hours := int(duration.Hours()) % 24
-		
-		var expiryText string
-		if days > 0 && hours > 0 {
-			expiryText = fmt.Sprintf("%d day(s) and %d hour(s)", days, hours)
-		} else if days > 0 {
-			expiryText = fmt.Sprintf("%d day(s)", days)
-		} else {
-			expiryText = fmt.Sprintf("%d hour(s)", hours)
-		}
-		
-		accessInfo := ""
-		if maxAccess > 0 {
-			accessInfo = fmt.Sprintf("<p class=\"text-sm\">Max accesses: %d</p>", maxAccess)
-		}
-		
-		return c.SendString(fmt.Sprintf(`<div class="p-4 bg-green-100 border border-green-400 text-green-700 rounded">
-		<p class="font-semibold">✓ Share link created successfully!</p>
-		<p class="text-sm mt-1">Expires in: %s</p>
-		%s
-		<div class="mt-3 p-2 bg-white rounded border border-green-300">
-			<p class="text-xs text-gray-600 mb-1">Share URL:</p>
-			<p class="text-sm font-mono break-all">/api/share/%s</p>
-		</div>
-		<button type="button" onclick="navigator.clipboard.writeText(window.location.origin + '/api/share/%s'); this.textContent='✓ Copied!'; setTimeout(() => this.textContent='Copy Link', 2000)" class="mt-3 bg-blue-600 text-white px-4 py-2 rounded text-sm hover:bg-blue-700">Copy Link</button>
-	</div>`, expiryText, accessInfo, share.ShareToken, share.ShareToken))
-	}
-
-	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
-		"share_token": share.ShareToken,
-		"expires_at":  share.ExpiresAt.Time.Format(time.RFC3339),
-		"max_access":  share.MaxAccess.Int32,
+	h.cache.InvalidateDocument(c.Context(), docID, doc.WorkspaceID.Bytes)
+	event := documentEvent(services.AuditDocumentMoved, doc)
+	event.Details["folder_id"] = folderID.String()
+	recordAudit(c, h.audit, event)
+
+	return c.JSON(fiber.Map{
+		"id":        docID.String(),
+		"folder_id": folderID.String(),
 	})
 }
 
+// documentEvent is an audit event about a document
+func documentEvent(action string, doc database.Document) services.AuditEvent {
+	return services.AuditEvent{
+		Action:       action,
+		ResourceType: "document",
+		ResourceID:   doc.ID.String(),
+		Details: map[string]string{
+			"filename":     doc.Filename,
+			"workspace_id": doc.WorkspaceID.String(),
+		},
+	}
+}
+
+// contentDisposition builds a Content-Disposition value for a download named
+// name, quoting or encoding the name so it cannot break out of the header
+func contentDisposition(disposition, name string) string {
+	return mime.FormatMediaType(disposition, map[string]string{"filename": name})
+}
+
 func (h *DocumentHandler) GetShareForm(c *fiber.Ctx) error {
 	docID := c.Params("id")
 	c.Set("Content-Type", "text/html")
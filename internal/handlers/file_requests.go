@@ -0,0 +1,519 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/netip"
+	"strings"
+	"time"
+
+	"Secure-Document-Exchange-Portal/internal/auth"
+	"Secure-Document-Exchange-Portal/internal/database"
+	"Secure-Document-Exchange-Portal/internal/middleware"
+	"Secure-Document-Exchange-Portal/internal/services"
+	"Secure-Document-Exchange-Portal/internal/validation"
+	"Secure-Document-Exchange-Portal/templates"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// Default limits for file requests created without explicit values
+const (
+	defaultFileRequestExpiry    = 7 * 24 * time.Hour
+	defaultFileRequestMaxSizeMB = 100
+)
+
+type FileRequestHandler struct {
+	db       *database.Queries
+	storage  services.StorageService
+	cache    *services.CachedRepository
+	policy   *auth.Policy
+	quotas   *services.QuotaService
+	notifier services.Notifier
+	audit    *services.AuditLog
+}
+
+func NewFileRequestHandler(db *database.Queries, storage services.StorageService, cache *services.CachedRepository, policy *auth.Policy, quotas *services.QuotaService, notifier services.Notifier, audit *services.AuditLog) *FileRequestHandler {
+	return &FileRequestHandler{
+		db:       db,
+		storage:  storage,
+		cache:    cache,
+		policy:   policy,
+		quotas:   quotas,
+		notifier: notifier,
+		audit:    audit,
+	}
+}
+
+// Create creates an upload-only link through which an external party can
+// send files into one of the creator's workspaces.
+func (h *FileRequestHandler) Create(c *fiber.Ctx) error {
+	userID, err := auth.GetUserID(c)
+	if err != nil {
+		return err
+	}
+
+	title := strings.TrimSpace(c.FormValue("title"))
+	message := strings.TrimSpace(c.FormValue("message"))
+
+	var expireDays, expireHours int
+	if v := c.FormValue("expire_days"); v != "" {
+		fmt.Sscanf(v, "%d", &expireDays)
+	}
+	if v := c.FormValue("expire_hours"); v != "" {
+		fmt.Sscanf(v, "%d", &expireHours)
+	}
+
+	expiresAt := time.Now().Add(defaultFileRequestExpiry)
+	if expireDays > 0 || expireHours > 0 {
+		if err := validation.ValidateShareExpiration(expireDays, expireHours); err != nil {
+			return fileRequestError(c, fiber.StatusBadRequest, err.Error())
+		}
+		totalHours := (expireDays * 24) + expireHours
+		expiresAt = time.Now().Add(time.Duration(totalHours) * time.Hour)
+	}
+
+	maxFiles := -1
+	if v := c.FormValue("max_files"); v != "" {
+		fmt.Sscanf(v, "%d", &maxFiles)
+	}
+
+	maxFileSizeMB := defaultFileRequestMaxSizeMB
+	if v := c.FormValue("max_file_size_mb"); v != "" {
+		fmt.Sscanf(v, "%d", &maxFileSizeMB)
+	}
+
+	if err := validation.ValidateFileRequest(title, maxFiles, maxFileSizeMB); err != nil {
+		return fileRequestError(c, fiber.StatusBadRequest, err.Error())
+	}
+
+	allowedTypes := parseAllowedTypes(c.FormValue("allowed_types"))
+	if err := validation.ValidateAllowedTypes(allowedTypes); err != nil {
+		return fileRequestError(c, fiber.StatusBadRequest, err.Error())
+	}
+
+	workspaceID, err := requestWorkspace(c, h.db, h.policy, userID, c.FormValue("workspace_id"), auth.ActionDocumentUpload)
+	if err != nil {
+		return err
+	}
+
+	folderID := pgtype.UUID{Valid: false}
+	if v := c.FormValue("folder_id"); v != "" {
+		parsed, err := uuid.Parse(v)
+		if err != nil {
+			return fileRequestError(c, fiber.StatusBadRequest, "Invalid folder ID")
+		}
+		folder, err := h.db.GetFolderByID(c.Context(), pgtype.UUID{Bytes: parsed, Valid: true})
+		if err != nil {
+			return fileRequestError(c, fiber.StatusNotFound, "Folder not found")
+		}
+		if folder.WorkspaceID != workspaceID {
+			return fileRequestError(c, fiber.StatusBadRequest, "Folder is in another workspace")
+		}
+		folderID = pgtype.UUID{Bytes: parsed, Valid: true}
+	}
+
+	req, err := h.db.CreateFileRequest(c.Context(), database.CreateFileRequestParams{
+		UserID:       pgtype.UUID{Bytes: userID, Valid: true},
+		RequestToken: uuid.New().String(),
+		Title:        title,
+		Message:      pgtype.Text{String: message, Valid: message != ""},
+		ExpiresAt:    pgtype.Timestamptz{Time: expiresAt, Valid: true},
+		MaxFiles:     int32(maxFiles),
+		MaxFileSize:  int64(maxFileSizeMB) * 1024 * 1024,
+		AllowedTypes: pgtype.Text{String: strings.Join(allowedTypes, ","), Valid: len(allowedTypes) > 0},
+		FolderID:     folderID,
+		WorkspaceID:  workspaceID,
+	})
+	if err != nil {
+		return fileRequestError(c, fiber.StatusInternalServerError, "Failed to create file request")
+	}
+	recordAudit(c, h.audit, services.AuditEvent{
+		Action:       services.AuditFileRequestCreated,
+		ResourceType: "file_request",
+		ResourceID:   req.ID.String(),
+		Details: map[string]string{
+			"title":        req.Title,
+			"workspace_id": req.WorkspaceID.String(),
+			"expires_at":   req.ExpiresAt.Time.Format(time.RFC3339),
+		},
+	})
+
+	if c.Get("Accept") == "text/html" || c.Get("HX-Request") == "true" {
+		c.Set("Content-Type", "text/html")
+		return c.SendString(fmt.Sprintf(`<div class="p-4 bg-green-100 border border-green-400 text-green-700 rounded">
+		<p class="font-semibold">✓ File request created successfully!</p>
+		<p class="text-sm mt-1">Open until: %s</p>
+		<div class="mt-3 p-2 bg-white rounded border border-green-300">
+			<p class="text-xs text-gray-600 mb-1">Upload URL:</p>
+			<p class="text-sm font-mono break-all">/api/request/%s</p>
+		</div>
+		<button type="button" onclick="navigator.clipboard.writeText(window.location.origin + '/api/request/%s'); this.textContent='✓ Copied!'; setTimeout(() => this.textContent='Copy Link', 2000)" class="mt-3 bg-blue-600 text-white px-4 py-2 rounded text-sm hover:bg-blue-700">Copy Link</button>
+	</div>`, req.ExpiresAt.Time.Format("2006-01-02 15:04 MST"), req.RequestToken, req.RequestToken))
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fileRequestResponse(req))
+}
+
+func (h *FileRequestHandler) List(c *fiber.Ctx) error {
+	userID, err := auth.GetUserID(c)
+	if err != nil {
+		return err
+	}
+
+	reqs, err := h.db.ListFileRequestsByUser(c.Context(), pgtype.UUID{Bytes: userID, Valid: true})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to list file requests"})
+	}
+
+	result := []fiber.Map{}
+	for _, req := range reqs {
+		result = append(result, fileRequestResponse(req))
+	}
+
+	return c.JSON(result)
+}
+
+// Uploads lists the files received through a file request
+func (h *FileRequestHandler) Uploads(c *fiber.Ctx) error {
+	req, err := h.ownedFileRequest(c)
+	if err != nil {
+		return err
+	}
+
+	uploads, err := h.db.ListFileRequestUploads(c.Context(), req.ID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to list uploads"})
+	}
+
+	result := []fiber.Map{}
+	for _, upload := range uploads {
+		ip := ""
+		if upload.IpAddress != nil {
+			ip = upload.IpAddress.String()
+		}
+		result = append(result, fiber.Map{
+			"document_id":    upload.DocumentID.String(),
+			"filename":       upload.Filename,
+			"file_size":      upload.FileSize,
+			"mime_type":      upload.MimeType,
+			"uploader_name":  upload.UploaderName.String,
+			"uploader_email": upload.UploaderEmail.String,
+			"ip_address":     ip,
+			"created_at":     upload.CreatedAt.Time.Format(time.RFC3339),
+		})
+	}
+
+	return c.JSON(result)
+}
+
+// Delete closes a file request. Documents already received are kept.
+func (h *FileRequestHandler) Delete(c *fiber.Ctx) error {
+	req, err := h.ownedFileRequest(c)
+	if err != nil {
+		return err
+	}
+
+	err = h.db.DeleteFileRequest(c.Context(), database.DeleteFileRequestParams{
+		ID:     req.ID,
+		UserID: req.UserID,
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to delete file request"})
+	}
+	recordAudit(c, h.audit, services.AuditEvent{
+		Action:       services.AuditFileRequestClosed,
+		ResourceType: "file_request",
+		ResourceID:   req.ID.String(),
+	})
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// Page renders the public upload page of a file request
+func (h *FileRequestHandler) Page(c *fiber.Ctx) error {
+	req, err := h.db.GetFileRequestByToken(c.Context(), c.Params("token"))
+	if err != nil {
+		return sendFileRequestNotFound(c)
+	}
+
+	return renderFileRequestPage(c, fiber.StatusOK, req, nil, nil)
+}
+
+// Upload accepts files from the public upload page. Each file goes through
+// ValidateFile and the request's own limits, is stored exactly like an
+// authenticated upload and becomes a document in the request's workspace,
+// uploaded by its creator.
+func (h *FileRequestHandler) Upload(c *fiber.Ctx) error {
+	req, err := h.db.GetFileRequestByToken(c.Context(), c.Params("token"))
+	if err != nil {
+		return sendFileRequestNotFound(c)
+	}
+
+	if fileRequestClosed(req) {
+		return renderFileRequestPage(c, fiber.StatusGone, req, nil, nil)
+	}
+
+	// Creators who may no longer upload to the workspace cannot bring files
+	// into it this way either
+	ownerID := uuid.UUID(req.UserID.Bytes)
+	err = h.policy.Authorize(c.Context(), auth.Subject{UserID: ownerID}, auth.ActionDocumentUpload, inWorkspace(req.WorkspaceID))
+	if err != nil {
+		if !errors.Is(err, auth.ErrForbidden) {
+			log.Printf("File request %s: %v", req.ID.String(), err)
+		}
+		return renderFileRequestPage(c, fiber.StatusGone, req, nil, []string{"This request is no longer accepting files"})
+	}
+
+	uploaderName := strings.TrimSpace(c.FormValue("uploader_name"))
+	uploaderEmail := strings.TrimSpace(c.FormValue("uploader_email"))
+	if len(uploaderName) > 255 {
+		return renderFileRequestPage(c, fiber.StatusBadRequest, req, nil, []string{"Name is too long (max 255 characters)"})
+	}
+	if uploaderEmail != "" {
+		if err := validation.ValidateEmail(uploaderEmail); err != nil {
+			return renderFileRequestPage(c, fiber.StatusBadRequest, req, nil, []string{err.Error()})
+		}
+	}
+
+	form, err := c.MultipartForm()
+	if err != nil || len(form.File["files"]) == 0 {
+		return renderFileRequestPage(c, fiber.StatusBadRequest, req, nil, []string{"Please choose at least one file"})
+	}
+
+	allowedTypes := parseAllowedTypes(req.AllowedTypes.String)
+
+	var ipAddress *netip.Addr
+	if ip, err := netip.ParseAddr(middleware.ClientIP(c)); err == nil {
+		ipAddress = &ip
+	}
+
+	var uploaded, errs []string
+	for _, file := range form.File["files"] {
+		if err := validation.ValidateFile(file); err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %s", file.Filename, err.Error()))
+			continue
+		}
+		if file.Size > req.MaxFileSize {
+			errs = append(errs, fmt.Sprintf("%s: file size exceeds maximum allowed (%.0f MB)", file.Filename, float64(req.MaxFileSize)/1024/1024))
+			continue
+		}
+		if len(allowedTypes) > 0 && !containsString(allowedTypes, file.Header.Get("Content-Type")) {
+			errs = append(errs, fmt.Sprintf("%s: file type not allowed: %s", file.Filename, file.Header.Get("Content-Type")))
+			continue
+		}
+
+		// Reserve a slot first so concurrent uploads cannot exceed max_files
+		reserved, err := h.db.ReserveFileRequestUpload(c.Context(), req.ID)
+		if err != nil || reserved == 0 {
+			errs = append(errs, fmt.Sprintf("%s: this request is no longer accepting files", file.Filename))
+			break
+		}
+
+		doc, _, err := storeDocument(c.Context(), h.quotas, h.storage, ownerID, req.WorkspaceID, req.FolderID, file)
+		if err != nil {
+			log.Printf("File request %s: %v", req.ID.String(), err)
+			_ = h.db.ReleaseFileRequestUpload(c.Context(), req.ID)
+			// Uploaders are not told how much the recipient stores
+			var fiberErr *fiber.Error
+			if errors.As(err, &fiberErr) && fiberErr.Code == fiber.StatusInsufficientStorage {
+				errs = append(errs, fmt.Sprintf("%s: the recipient has no storage left", file.Filename))
+				break
+			}
+			errs = append(errs, fmt.Sprintf("%s: upload failed", file.Filename))
+			continue
+		}
+
+		err = h.db.CreateFileRequestUpload(c.Context(), database.CreateFileRequestUploadParams{
+			FileRequestID: req.ID,
+			DocumentID:    doc.ID,
+			UploaderName:  pgtype.Text{String: uploaderName, Valid: uploaderName != ""},
+			UploaderEmail: pgtype.Text{String: uploaderEmail, Valid: uploaderEmail != ""},
+			IpAddress:     ipAddress,
+		})
+		if err != nil {
+			log.Printf("Failed to record file request upload: %v", err)
+		}
+		event := documentEvent(services.AuditFileRequestUploaded, doc)
+		event.ActorEmail = uploaderEmail
+		event.Details["file_request_id"] = req.ID.String()
+		event.Details["uploader_name"] = uploaderName
+		recordAudit(c, h.audit, event)
+
+		uploaded = append(uploaded, doc.Filename)
+	}
+
+	if len(uploaded) > 0 {
+		h.cache.InvalidateWorkspaceDocuments(c.Context(), req.WorkspaceID.Bytes)
+		h.notifyCreator(c.Context(), req, uploaded, uploaderName, uploaderEmail)
+	}
+
+	// Reload so the page reflects the remaining capacity
+	if fresh, err := h.db.GetFileRequestByID(c.Context(), req.ID); err == nil {
+		req = fresh
+	}
+
+	status := fiber.StatusCreated
+	if len(uploaded) == 0 {
+		status = fiber.StatusBadRequest
+	}
+	return renderFileRequestPage(c, status, req, uploaded, errs)
+}
+
+func (h *FileRequestHandler) notifyCreator(ctx context.Context, req database.FileRequest, filenames []string, uploaderName, uploaderEmail string) {
+	ownerID := uuid.UUID(req.UserID.Bytes)
+	owner, err := h.cache.GetUserByID(ctx, ownerID)
+	if err != nil {
+		log.Printf("Failed to load file request owner %s: %v", ownerID, err)
+		return
+	}
+
+	from := "Someone"
+	if uploaderName != "" && uploaderEmail != "" {
+		from = fmt.Sprintf("%s <%s>", uploaderName, uploaderEmail)
+	} else if uploaderName != "" {
+		from = uploaderName
+	} else if uploaderEmail != "" {
+		from = uploaderEmail
+	}
+
+	err = h.notifier.Notify(ctx, services.Notification{
+		UserID:  ownerID,
+		Email:   owner.Email,
+		Event:   services.EventFileRequestUpload,
+		Subject: fmt.Sprintf("New files for \"%s\"", req.Title),
+		Body: fmt.Sprintf("%s uploaded %d file(s) through your file request \"%s\":\n\n%s",
+			from, len(filenames), req.Title, strings.Join(filenames, "\n")),
+		Data: map[string]string{
+			"file_request_id": req.ID.String(),
+		},
+	})
+	if err != nil {
+		log.Printf("Failed to notify file request owner %s: %v", ownerID, err)
+	}
+}
+
+// ownedFileRequest loads the file request named by the :id parameter and
+// checks that the current user may manage it: its creator or an owner of
+// its workspace
+func (h *FileRequestHandler) ownedFileRequest(c *fiber.Ctx) (database.FileRequest, error) {
+	userID, err := auth.GetUserID(c)
+	if err != nil {
+		return database.FileRequest{}, err
+	}
+
+	reqID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return database.FileRequest{}, fiber.NewError(fiber.StatusBadRequest, "Invalid file request ID")
+	}
+
+	req, err := h.db.GetFileRequestByID(c.Context(), pgtype.UUID{Bytes: reqID, Valid: true})
+	if err != nil {
+		return database.FileRequest{}, fiber.NewError(fiber.StatusNotFound, "File request not found")
+	}
+
+	err = h.policy.Authorize(c.Context(), auth.Subject{UserID: userID}, auth.ActionFileRequestManage, auth.Resource{
+		OwnerID:     req.UserID.Bytes,
+		WorkspaceID: req.WorkspaceID.Bytes,
+	})
+	if errors.Is(err, auth.ErrForbidden) {
+		return database.FileRequest{}, fiber.NewError(fiber.StatusForbidden, "Access denied")
+	}
+	if err != nil {
+		log.Printf("Failed to authorize %s for user %s: %v", auth.ActionFileRequestManage, userID, err)
+		return database.FileRequest{}, fiber.NewError(fiber.StatusInternalServerError, "Failed to check permissions")
+	}
+
+	return req, nil
+}
+
+func fileRequestClosed(req database.FileRequest) bool {
+	if req.ExpiresAt.Time.Before(time.Now()) {
+		return true
+	}
+	return req.MaxFiles != -1 && req.UploadCount >= req.MaxFiles
+}
+
+func fileRequestResponse(req database.FileRequest) fiber.Map {
+	return fiber.Map{
+		"id":            req.ID.String(),
+		"request_token": req.RequestToken,
+		"title":         req.Title,
+		"message":       req.Message.String,
+		"expires_at":    req.ExpiresAt.Time.Format(time.RFC3339),
+		"max_files":     req.MaxFiles,
+		"max_file_size": req.MaxFileSize,
+		"allowed_types": parseAllowedTypes(req.AllowedTypes.String),
+		"upload_count":  req.UploadCount,
+		"folder_id":     req.FolderID.String(),
+		"workspace_id":  req.WorkspaceID.String(),
+		"created_at":    req.CreatedAt.Time.Format(time.RFC3339),
+	}
+}
+
+// parseAllowedTypes splits a comma-separated list of MIME types
+func parseAllowedTypes(value string) []string {
+	types := []string{}
+	for _, t := range strings.Split(value, ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			types = append(types, t)
+		}
+	}
+	return types
+}
+
+func containsString(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func fileRequestError(c *fiber.Ctx, status int, message string) error {
+	if c.Get("HX-Request") == "true" {
+		return c.Status(status).SendString(fmt.Sprintf(`<div class="p-4 bg-red-100 border border-red-400 text-red-700 rounded"><p>%s</p></div>`, message))
+	}
+	return c.Status(status).JSON(fiber.Map{"error": message})
+}
+
+func renderFileRequestPage(c *fiber.Ctx, status int, req database.FileRequest, uploaded, errs []string) error {
+	remaining := -1
+	if req.MaxFiles != -1 {
+		remaining = int(req.MaxFiles - req.UploadCount)
+	}
+
+	view := templates.FileRequestView{
+		Token:        req.RequestToken,
+		Title:        req.Title,
+		Message:      req.Message.String,
+		ExpiresAt:    req.ExpiresAt.Time.Format("2006-01-02 15:04 MST"),
+		MaxFileSize:  req.MaxFileSize,
+		AllowedTypes: parseAllowedTypes(req.AllowedTypes.String),
+		Remaining:    remaining,
+		Closed:       fileRequestClosed(req),
+		Uploaded:     uploaded,
+		Errors:       errs,
+	}
+
+	c.Set("Content-Type", "text/html")
+	c.Status(status)
+	return templates.FileRequestPage(view).Render(c.Context(), c.Response().BodyWriter())
+}
+
+func sendFileRequestNotFound(c *fiber.Ctx) error {
+	c.Set("Content-Type", "text/html")
+	return c.Status(fiber.StatusNotFound).SendString(`
+		<html><body style="font-family: sans-serif; max-width: 600px; margin: 50px auto; padding: 20px;">
+		<div style="background: #fee; border: 1px solid #fcc; padding: 20px; border-radius: 8px;">
+			<h2 style="color: #c00; margin: 0 0 10px 0;">❌ Request Not Found</h2>
+			<p>This upload link does not exist or has been closed.</p>
+		</div>
+		</body></html>
+	`)
+}
@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"Secure-Document-Exchange-Portal/internal/database"
+	"Secure-Document-Exchange-Portal/internal/database/dbtest"
+	"Secure-Document-Exchange-Portal/internal/services"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// fixtures builds what handler tests need in a database of their own.
+// Caching is disabled, so every lookup reaches the database.
+type fixtures struct {
+	t        *testing.T
+	ctx      context.Context
+	pool     *pgxpool.Pool
+	db       *database.Queries
+	cache    *services.CachedRepository
+	audit    *services.AuditLog
+	notifier *services.MemoryNotifier
+}
+
+func newFixtures(t *testing.T) *fixtures {
+	t.Helper()
+
+	pool, db := dbtest.New(t)
+	cache := services.NewCachedRepository(db, &services.RedisCache{})
+	audit := services.NewAuditLog(pool, db, cache, filepath.Join(t.TempDir(), "audit-spill.jsonl"))
+	t.Cleanup(audit.Close)
+	return &fixtures{
+		t:        t,
+		ctx:      context.Background(),
+		pool:     pool,
+		db:       db,
+		cache:    cache,
+		audit:    audit,
+		notifier: services.NewMemoryNotifier(),
+	}
+}
+
+// in returns fixtures sharing the database that report to the subtest t
+func (f *fixtures) in(t *testing.T) *fixtures {
+	sub := *f
+	sub.t = t
+	return &sub
+}
+
+func (f *fixtures) id(query string, args ...any) pgtype.UUID {
+	f.t.Helper()
+
+	var id pgtype.UUID
+	if err := f.pool.QueryRow(f.ctx, query, args...).Scan(&id); err != nil {
+		f.t.Fatal(err)
+	}
+	return id
+}
+
+// user creates an unconfirmed user with a personal workspace
+func (f *fixtures) user(password string) (user database.User, workspace pgtype.UUID) {
+	f.t.Helper()
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+	if err != nil {
+		f.t.Fatal(err)
+	}
+	id := f.id(`INSERT INTO users (email, password_hash, full_name) VALUES ($1, $2, 'Test') RETURNING id`,
+		uuid.NewString()+"@example.com", string(hash))
+	workspace = f.id(`INSERT INTO workspaces (personal_user_id, name) VALUES ($1, 'Personal') RETURNING id`, id)
+
+	user, err = f.db.GetUserByID(f.ctx, id)
+	if err != nil {
+		f.t.Fatal(err)
+	}
+	return user, workspace
+}
+
+// document records a document without storing a file
+func (f *fixtures) document(user, workspace pgtype.UUID) pgtype.UUID {
+	f.t.Helper()
+	return f.id(`INSERT INTO documents (user_id, filename, file_path, encrypted_key, file_size, mime_type, checksum, workspace_id)
+		VALUES ($1, 'a.pdf', $2, 'key', 100, 'application/pdf', 'sum', $3) RETURNING id`,
+		user, "files/"+uuid.NewString(), workspace)
+}
+
+// events counts the notifications delivered so far by event
+func (f *fixtures) events() map[string]int {
+	counts := make(map[string]int)
+	for _, n := range f.notifier.Notifications() {
+		counts[n.Event]++
+	}
+	return counts
+}
@@ -0,0 +1,190 @@
+package handlers
+
+import (
+	"strings"
+	"time"
+
+	"Secure-Document-Exchange-Portal/internal/auth"
+	"Secure-Document-Exchange-Portal/internal/database"
+	"Secure-Document-Exchange-Portal/internal/services"
+	"Secure-Document-Exchange-Portal/internal/validation"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+type FolderHandler struct {
+	db     *database.Queries
+	cache  *services.CachedRepository
+	policy *auth.Policy
+	audit  *services.AuditLog
+}
+
+func NewFolderHandler(db *database.Queries, cache *services.CachedRepository, policy *auth.Policy, audit *services.AuditLog) *FolderHandler {
+	return &FolderHandler{
+		db:     db,
+		cache:  cache,
+		policy: policy,
+		audit:  audit,
+	}
+}
+
+func (h *FolderHandler) Create(c *fiber.Ctx) error {
+	userID, err := auth.GetUserID(c)
+	if err != nil {
+		return err
+	}
+
+	name := strings.TrimSpace(c.FormValue("name"))
+	if err := validation.ValidateFolderName(name); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	workspaceID, err := requestWorkspace(c, h.db, h.policy, userID, c.FormValue("workspace_id"), auth.ActionDocumentUpload)
+	if err != nil {
+		return err
+	}
+
+	parentID := pgtype.UUID{Valid: false}
+	if parentIDStr := c.FormValue("parent_id"); parentIDStr != "" {
+		parsed, err := uuid.Parse(parentIDStr)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid parent folder ID"})
+		}
+
+		parent, err := h.db.GetFolderByID(c.Context(), pgtype.UUID{Bytes: parsed, Valid: true})
+		if err != nil {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Parent folder not found"})
+		}
+		if parent.WorkspaceID != workspaceID {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Parent folder is in another workspace"})
+		}
+		parentID = pgtype.UUID{Bytes: parsed, Valid: true}
+	}
+
+	folder, err := h.db.CreateFolder(c.Context(), database.CreateFolderParams{
+		UserID:      pgtype.UUID{Bytes: userID, Valid: true},
+		ParentID:    parentID,
+		Name:        name,
+		WorkspaceID: workspaceID,
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to create folder"})
+	}
+	recordAudit(c, h.audit, folderEvent(services.AuditFolderCreated, folder))
+
+	return c.Status(fiber.StatusCreated).JSON(folderResponse(folder))
+}
+
+func (h *FolderHandler) List(c *fiber.Ctx) error {
+	userID, err := auth.GetUserID(c)
+	if err != nil {
+		return err
+	}
+
+	workspaceID, err := requestWorkspace(c, h.db, h.policy, userID, c.Query("workspace_id"), auth.ActionDocumentList)
+	if err != nil {
+		return err
+	}
+
+	folders, err := h.db.ListFoldersByWorkspace(c.Context(), workspaceID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to list folders"})
+	}
+
+	result := []fiber.Map{}
+	for _, folder := range folders {
+		result = append(result, folderResponse(folder))
+	}
+
+	return c.JSON(result)
+}
+
+func (h *FolderHandler) Get(c *fiber.Ctx) error {
+	userID, err := auth.GetUserID(c)
+	if err != nil {
+		return err
+	}
+
+	folderID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid folder ID"})
+	}
+
+	folder, err := h.db.GetFolderByID(c.Context(), pgtype.UUID{Bytes: folderID, Valid: true})
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Folder not found"})
+	}
+
+	if ok, err := authorize(c, h.policy, userID, auth.ActionDocumentList, inWorkspace(folder.WorkspaceID)); !ok {
+		return err
+	}
+
+	return c.JSON(folderResponse(folder))
+}
+
+// Delete removes a folder and its subfolders. Documents inside are kept and
+// moved back to the top level; folder shares are removed with the folder.
+// Folders under legal hold, or inside one, are kept.
+func (h *FolderHandler) Delete(c *fiber.Ctx) error {
+	userID, err := auth.GetUserID(c)
+	if err != nil {
+		return err
+	}
+
+	folderID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid folder ID"})
+	}
+
+	folder, err := h.db.GetFolderByID(c.Context(), pgtype.UUID{Bytes: folderID, Valid: true})
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Folder not found"})
+	}
+
+	if ok, err := authorize(c, h.policy, userID, auth.ActionDocumentDelete, inWorkspace(folder.WorkspaceID)); !ok {
+		return err
+	}
+	if ok, err := checkFolderHold(c, h.db, h.audit, folder, "delete"); !ok {
+		return err
+	}
+
+	err = h.db.DeleteFolder(c.Context(), database.DeleteFolderParams{
+		ID:          pgtype.UUID{Bytes: folderID, Valid: true},
+		WorkspaceID: folder.WorkspaceID,
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to delete folder"})
+	}
+
+	// Documents changed folder and cached folder shares are gone
+	h.cache.InvalidateWorkspaceDocuments(c.Context(), folder.WorkspaceID.Bytes)
+	h.cache.InvalidateAllShares(c.Context())
+	recordAudit(c, h.audit, folderEvent(services.AuditFolderDeleted, folder))
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// folderEvent is an audit event about a folder
+func folderEvent(action string, folder database.Folder) services.AuditEvent {
+	return services.AuditEvent{
+		Action:       action,
+		ResourceType: "folder",
+		ResourceID:   folder.ID.String(),
+		Details: map[string]string{
+			"name":         folder.Name,
+			"workspace_id": folder.WorkspaceID.String(),
+		},
+	}
+}
+
+func folderResponse(folder database.Folder) fiber.Map {
+	return fiber.Map{
+		"id":           folder.ID.String(),
+		"parent_id":    folder.ParentID.String(),
+		"workspace_id": folder.WorkspaceID.String(),
+		"name":         folder.Name,
+		"created_at":   folder.CreatedAt.Time.Format(time.RFC3339),
+	}
+}
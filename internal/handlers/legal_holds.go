@@ -0,0 +1,292 @@
+package handlers
+
+import (
+	"strings"
+	"time"
+
+	"Secure-Document-Exchange-Portal/internal/auth"
+	"Secure-Document-Exchange-Portal/internal/database"
+	"Secure-Document-Exchange-Portal/internal/models"
+	"Secure-Document-Exchange-Portal/internal/services"
+	"Secure-Document-Exchange-Portal/internal/validation"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// LegalHoldHandler lets the legal team freeze documents, folders and
+// everything a user owns. Held data cannot be deleted, moved out of a held
+// folder or expired by a retention policy until the hold is released.
+type LegalHoldHandler struct {
+	db    *database.Queries
+	audit *services.AuditLog
+}
+
+func NewLegalHoldHandler(db *database.Queries, audit *services.AuditLog) *LegalHoldHandler {
+	return &LegalHoldHandler{
+		db:    db,
+		audit: audit,
+	}
+}
+
+// List returns the active legal holds, newest first, or every hold ever
+// placed with ?all=true
+func (h *LegalHoldHandler) List(c *fiber.Ctx) error {
+	holds, err := h.db.ListLegalHolds(c.Context(), c.QueryBool("all"))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to list legal holds"})
+	}
+
+	result := make([]fiber.Map, 0, len(holds))
+	for _, hold := range holds {
+		result = append(result, legalHoldJSON(database.LegalHold{
+			ID:            hold.ID,
+			ResourceType:  hold.ResourceType,
+			ResourceID:    hold.ResourceID,
+			Reason:        hold.Reason,
+			Custodian:     hold.Custodian,
+			PlacedBy:      hold.PlacedBy,
+			PlacedAt:      hold.PlacedAt,
+			ReleasedBy:    hold.ReleasedBy,
+			ReleasedAt:    hold.ReleasedAt,
+			ReleaseReason: hold.ReleaseReason,
+		}, hold.ResourceName))
+	}
+	return c.JSON(result)
+}
+
+// Get returns a legal hold, active or released
+func (h *LegalHoldHandler) Get(c *fiber.Ctx) error {
+	holdID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid legal hold ID"})
+	}
+
+	hold, err := h.db.GetLegalHold(c.Context(), pgtype.UUID{Bytes: holdID, Valid: true})
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Legal hold not found"})
+	}
+	return c.JSON(legalHoldJSON(hold, ""))
+}
+
+// Create places a legal hold on a document, a folder with everything in
+// it, or a user's documents and folders and their account
+func (h *LegalHoldHandler) Create(c *fiber.Ctx) error {
+	userID, err := auth.GetUserID(c)
+	if err != nil {
+		return err
+	}
+
+	var req models.LegalHoldRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	reason := strings.TrimSpace(req.Reason)
+	custodian := strings.TrimSpace(req.Custodian)
+	if err := validation.ValidateLegalHold(reason, custodian); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	given := 0
+	for _, id := range []string{req.DocumentID, req.FolderID, req.UserID + req.Email} {
+		if id != "" {
+			given++
+		}
+	}
+	if given != 1 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Give one of document_id, folder_id, or user_id or email"})
+	}
+
+	var resourceType, name string
+	var resourceID, ownerID pgtype.UUID
+	switch {
+	case req.DocumentID != "":
+		docID, err := uuid.Parse(req.DocumentID)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid document ID"})
+		}
+		// Documents in the trash can be held too, which keeps them from
+		// being purged
+		doc, err := h.db.GetDocumentByID(c.Context(), pgtype.UUID{Bytes: docID, Valid: true})
+		if err != nil {
+			doc, err = h.db.GetTrashedDocument(c.Context(), pgtype.UUID{Bytes: docID, Valid: true})
+		}
+		if err != nil {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Document not found"})
+		}
+		resourceType, resourceID, ownerID, name = services.HoldDocument, doc.ID, doc.UserID, doc.Filename
+
+	case req.FolderID != "":
+		folderID, err := uuid.Parse(req.FolderID)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid folder ID"})
+		}
+		folder, err := h.db.GetFolderByID(c.Context(), pgtype.UUID{Bytes: folderID, Valid: true})
+		if err != nil {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Folder not found"})
+		}
+		resourceType, resourceID, ownerID, name = services.HoldFolder, folder.ID, folder.UserID, folder.Name
+
+	default:
+		var user database.User
+		if req.UserID != "" {
+			heldID, err := uuid.Parse(req.UserID)
+			if err != nil {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid user ID"})
+			}
+			user, err = h.db.GetUserByID(c.Context(), pgtype.UUID{Bytes: heldID, Valid: true})
+			if err != nil {
+				return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
+			}
+		} else {
+			user, err = h.db.GetUserByEmail(c.Context(), strings.TrimSpace(req.Email))
+			if err != nil {
+				return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
+			}
+		}
+		resourceType, resourceID, ownerID, name = services.HoldUser, user.ID, user.ID, user.Email
+	}
+
+	if custodian == "" {
+		owner, err := h.db.GetUserByID(c.Context(), ownerID)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "custodian is required"})
+		}
+		custodian = owner.Email
+	}
+
+	hold, err := h.db.CreateLegalHold(c.Context(), database.CreateLegalHoldParams{
+		ResourceType: resourceType,
+		ResourceID:   resourceID,
+		Reason:       reason,
+		Custodian:    custodian,
+		PlacedBy:     pgtype.UUID{Bytes: userID, Valid: true},
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to place legal hold"})
+	}
+
+	event := legalHoldEvent(services.AuditLegalHoldPlaced, hold)
+	event.Details["name"] = name
+	event.Details["reason"] = reason
+	recordAudit(c, h.audit, event)
+
+	return c.Status(fiber.StatusCreated).JSON(legalHoldJSON(hold, name))
+}
+
+// Release lifts a legal hold. The hold is kept, with who released it, when
+// and why, so the audit trail stays complete.
+func (h *LegalHoldHandler) Release(c *fiber.Ctx) error {
+	userID, err := auth.GetUserID(c)
+	if err != nil {
+		return err
+	}
+
+	holdID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid legal hold ID"})
+	}
+
+	var req models.ReleaseLegalHoldRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	reason := strings.TrimSpace(req.Reason)
+	if err := validation.ValidateLegalHold(reason, ""); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	existing, err := h.db.GetLegalHold(c.Context(), pgtype.UUID{Bytes: holdID, Valid: true})
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Legal hold not found"})
+	}
+	if existing.ReleasedAt.Valid {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Legal hold is already released"})
+	}
+
+	hold, err := h.db.ReleaseLegalHold(c.Context(), database.ReleaseLegalHoldParams{
+		ID:            existing.ID,
+		ReleasedBy:    pgtype.UUID{Bytes: userID, Valid: true},
+		ReleaseReason: pgtype.Text{String: reason, Valid: true},
+	})
+	if err != nil {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Legal hold is already released"})
+	}
+
+	event := legalHoldEvent(services.AuditLegalHoldReleased, hold)
+	event.Details["reason"] = reason
+	recordAudit(c, h.audit, event)
+
+	return c.JSON(legalHoldJSON(hold, ""))
+}
+
+// checkDocumentHold answers 409 Conflict if a document is under legal
+// hold, recording the attempt to change it in the audit log
+func checkDocumentHold(c *fiber.Ctx, db *database.Queries, audit *services.AuditLog, doc database.Document, attempt string) (bool, error) {
+	held, err := db.IsDocumentHeld(c.Context(), doc.ID)
+	if err != nil {
+		return false, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to check legal holds"})
+	}
+	if !held {
+		return true, nil
+	}
+
+	event := documentEvent(services.AuditLegalHoldBlocked, doc)
+	event.Details["attempt"] = attempt
+	recordAudit(c, audit, event)
+	return false, c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Document is under legal hold"})
+}
+
+// checkFolderHold answers 409 Conflict if a folder is under legal hold,
+// recording the attempt to change it in the audit log
+func checkFolderHold(c *fiber.Ctx, db *database.Queries, audit *services.AuditLog, folder database.Folder, attempt string) (bool, error) {
+	held, err := db.IsFolderHeld(c.Context(), folder.ID)
+	if err != nil {
+		return false, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to check legal holds"})
+	}
+	if !held {
+		return true, nil
+	}
+
+	event := folderEvent(services.AuditLegalHoldBlocked, folder)
+	event.Details["attempt"] = attempt
+	recordAudit(c, audit, event)
+	return false, c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Folder is under legal hold"})
+}
+
+// legalHoldEvent is an audit event about a legal hold
+func legalHoldEvent(action string, hold database.LegalHold) services.AuditEvent {
+	return services.AuditEvent{
+		Action:       action,
+		ResourceType: "legal_hold",
+		ResourceID:   hold.ID.String(),
+		Details: map[string]string{
+			"resource_type": hold.ResourceType,
+			"resource_id":   hold.ResourceID.String(),
+			"custodian":     hold.Custodian,
+		},
+	}
+}
+
+func legalHoldJSON(hold database.LegalHold, name string) fiber.Map {
+	item := fiber.Map{
+		"id":            hold.ID.String(),
+		"resource_type": hold.ResourceType,
+		"resource_id":   hold.ResourceID.String(),
+		"reason":        hold.Reason,
+		"custodian":     hold.Custodian,
+		"placed_by":     hold.PlacedBy.String(),
+		"placed_at":     hold.PlacedAt.Time.Format(time.RFC3339),
+		"active":        !hold.ReleasedAt.Valid,
+	}
+	if name != "" {
+		item["resource_name"] = name
+	}
+	if hold.ReleasedAt.Valid {
+		item["released_by"] = hold.ReleasedBy.String()
+		item["released_at"] = hold.ReleasedAt.Time.Format(time.RFC3339)
+		item["release_reason"] = hold.ReleaseReason.String
+	}
+	return item
+}
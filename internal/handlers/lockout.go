@@ -0,0 +1,164 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+	"time"
+
+	"Secure-Document-Exchange-Portal/internal/database"
+	"Secure-Document-Exchange-Portal/internal/middleware"
+	"Secure-Document-Exchange-Portal/internal/services"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+const (
+	// loginFailureWindow is how long a failed login counts towards delays
+	// and the lockout
+	loginFailureWindow = 15 * time.Minute
+	// loginFreeFailures is how many failures are allowed before each further
+	// attempt has to wait. The wait doubles with every failure, up to
+	// loginMaxDelay.
+	loginFreeFailures = 3
+	loginMaxDelay     = 30 * time.Second
+	// loginLockoutThreshold failures within the window lock the account for
+	// loginLockoutDuration
+	loginLockoutThreshold = 10
+	loginLockoutDuration  = 15 * time.Minute
+)
+
+const accountDeactivatedMessage = "This account has been deactivated. Please contact your administrator."
+
+// loginDelay returns how long to wait after the last of failures failed
+// logins before the next attempt
+func loginDelay(failures int32) time.Duration {
+	if failures < loginFreeFailures {
+		return 0
+	}
+	shift := failures - loginFreeFailures
+	if shift >= 6 {
+		return loginMaxDelay
+	}
+	return min(time.Second<<shift, loginMaxDelay)
+}
+
+// loginThrottled refuses password and MFA attempts for locked accounts, and
+// attempts that come before the delay since the last attempt is over. The
+// password is not checked, so guesses made during a lockout are worthless.
+// Attempts are claimed in the database, so parallel requests cannot slip
+// through between the check and the failure being recorded.
+func (h *AuthHandler) loginThrottled(c *fiber.Ctx, user database.User) (bool, error) {
+	now := time.Now()
+
+	if user.LockedUntil.Valid && user.LockedUntil.Time.After(now) {
+		wait := user.LockedUntil.Time.Sub(now)
+		return true, loginThrottledResponse(c, wait, fmt.Sprintf(
+			"Too many failed sign-in attempts. This account is locked for %d more minute(s).",
+			int(math.Ceil(wait.Minutes()))))
+	}
+
+	delay := loginDelay(user.FailedLoginCount)
+	_, err := h.db.ClaimLoginAttempt(c.Context(), database.ClaimLoginAttemptParams{
+		ID:               user.ID,
+		FailedLoginCount: user.FailedLoginCount,
+		DelaySeconds:     delay.Seconds(),
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		// Another attempt came first, or the delay is not over yet
+		wait := time.Second
+		for _, last := range []pgtype.Timestamptz{user.LastLoginAttemptAt, user.LastFailedLoginAt} {
+			if last.Valid {
+				wait = max(wait, last.Time.Add(delay).Sub(now))
+			}
+		}
+		return true, loginThrottledResponse(c, wait, fmt.Sprintf(
+			"Too many failed sign-in attempts. Please wait %d second(s) before trying again.",
+			int(math.Ceil(wait.Seconds()))))
+	}
+	if err != nil {
+		return true, mfaError(c, fiber.StatusInternalServerError, "Failed to load account")
+	}
+
+	return false, nil
+}
+
+func loginThrottledResponse(c *fiber.Ctx, wait time.Duration, message string) error {
+	c.Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	return mfaError(c, fiber.StatusTooManyRequests, message)
+}
+
+// recordLoginFailure counts a wrong password or MFA code against the
+// account and locks it once the threshold is reached. The user is notified
+// once per lockout. The failure is audited as action.
+func (h *AuthHandler) recordLoginFailure(c *fiber.Ctx, user database.User, action string) {
+	recordAudit(c, h.audit, services.AuditEvent{
+		ActorID:    user.ID.Bytes,
+		ActorEmail: user.Email,
+		Action:     action,
+	})
+
+	failures, err := h.db.RecordFailedLogin(c.Context(), database.RecordFailedLoginParams{
+		ID:                user.ID,
+		LastFailedLoginAt: pgtype.Timestamptz{Time: time.Now().Add(-loginFailureWindow), Valid: true},
+	})
+	if err != nil {
+		log.Printf("Failed to record failed login for user %s: %v", user.ID.String(), err)
+		return
+	}
+	if failures < loginLockoutThreshold {
+		return
+	}
+
+	lockedUntil := time.Now().Add(loginLockoutDuration)
+	locked, err := h.db.LockUser(c.Context(), database.LockUserParams{
+		ID:          user.ID,
+		LockedUntil: pgtype.Timestamptz{Time: lockedUntil, Valid: true},
+	})
+	if err != nil {
+		log.Printf("Failed to lock user %s: %v", user.ID.String(), err)
+		return
+	}
+	if locked == 0 {
+		// A parallel request locked the account first
+		return
+	}
+	log.Printf("Locked user %s until %s after %d failed logins", user.ID.String(), lockedUntil.Format(time.RFC3339), failures)
+	recordAudit(c, h.audit, services.AuditEvent{
+		ActorID:    user.ID.Bytes,
+		ActorEmail: user.Email,
+		Action:     services.AuditAccountLocked,
+		Details: map[string]string{
+			"failures":     fmt.Sprint(failures),
+			"locked_until": lockedUntil.Format(time.RFC3339),
+		},
+	})
+
+	err = h.notifier.Notify(c.Context(), services.Notification{
+		UserID:  user.ID.Bytes,
+		Email:   user.Email,
+		Event:   services.EventAccountLocked,
+		Subject: "Your account was temporarily locked",
+		Body: fmt.Sprintf("Your account was locked for %d minutes after %d failed sign-in attempts. "+
+			"If this was not you, someone may be trying to guess your password; you can change it at %s.\n\nIP address: %s\nUser agent: %s",
+			int(loginLockoutDuration.Minutes()), failures, h.baseURL+"/forgot-password", middleware.ClientIP(c), c.Get("User-Agent")),
+		Data: map[string]string{
+			"locked_until": lockedUntil.Format(time.RFC3339),
+			"ip_address":   middleware.ClientIP(c),
+		},
+	})
+	if err != nil {
+		log.Printf("Failed to notify user %s of lockout: %v", user.ID.String(), err)
+	}
+}
+
+// resetLoginFailures clears the failure count after a successful login
+func (h *AuthHandler) resetLoginFailures(c *fiber.Ctx, userID pgtype.UUID) {
+	if err := h.db.ResetFailedLogins(c.Context(), userID); err != nil {
+		log.Printf("Failed to reset failed logins for user %s: %v", userID.String(), err)
+	}
+}
@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"Secure-Document-Exchange-Portal/internal/database"
+	"Secure-Document-Exchange-Portal/internal/database/dbtest"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+func TestLoginDelay(t *testing.T) {
+	cases := []struct {
+		failures int32
+		want     time.Duration
+	}{
+		{0, 0},
+		{loginFreeFailures - 1, 0},
+		{loginFreeFailures, time.Second},
+		{loginFreeFailures + 1, 2 * time.Second},
+		{loginFreeFailures + 4, 16 * time.Second},
+		{loginFreeFailures + 5, loginMaxDelay},
+		{loginLockoutThreshold, loginMaxDelay},
+		{1000, loginMaxDelay},
+	}
+	for _, tc := range cases {
+		if got := loginDelay(tc.failures); got != tc.want {
+			t.Errorf("loginDelay(%d) = %s, want %s", tc.failures, got, tc.want)
+		}
+	}
+}
+
+// ClaimLoginAttempt lets an attempt through only once the delay for the
+// failure count it was derived from is over, and never while locked
+func TestClaimLoginAttempt(t *testing.T) {
+	pool, db := dbtest.New(t)
+	ctx := context.Background()
+
+	ago := func(d time.Duration) pgtype.Timestamptz {
+		return pgtype.Timestamptz{Time: time.Now().Add(-d), Valid: true}
+	}
+	type account struct {
+		failures    int32
+		lastFailure pgtype.Timestamptz
+		lastAttempt pgtype.Timestamptz
+		lockedUntil pgtype.Timestamptz
+	}
+	cases := []struct {
+		name    string
+		account account
+		// failures is the count the caller read; it defaults to the stored one
+		failures *int32
+		want     bool
+	}{
+		{"first attempt", account{}, nil, true},
+		{"free failures", account{failures: loginFreeFailures - 1, lastFailure: ago(0)}, nil, true},
+		{"free failures right after an attempt", account{failures: loginFreeFailures - 1, lastAttempt: ago(0)}, nil, true},
+		{"delay not over", account{failures: loginFreeFailures + 1, lastFailure: ago(time.Second)}, nil, false},
+		{"delay over", account{failures: loginFreeFailures + 1, lastFailure: ago(3 * time.Second)}, nil, true},
+		{"parallel attempt claimed first", account{failures: loginFreeFailures, lastFailure: ago(5 * time.Second), lastAttempt: ago(0)}, nil, false},
+		{"failure recorded since the read", account{failures: loginFreeFailures}, ptr(int32(loginFreeFailures - 1)), false},
+		{"locked", account{failures: loginLockoutThreshold, lastFailure: ago(time.Hour), lockedUntil: ago(-time.Minute)}, nil, false},
+		{"lock expired", account{failures: loginLockoutThreshold, lastFailure: ago(time.Hour), lockedUntil: ago(time.Minute)}, nil, true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var id pgtype.UUID
+			if err := pool.QueryRow(ctx, `INSERT INTO users (email, password_hash, full_name, failed_login_count, last_failed_login_at, last_login_attempt_at, locked_until)
+				VALUES ($1, 'x', 'Test', $2, $3, $4, $5) RETURNING id`,
+				uuid.NewString()+"@example.com", tc.account.failures, tc.account.lastFailure, tc.account.lastAttempt, tc.account.lockedUntil,
+			).Scan(&id); err != nil {
+				t.Fatal(err)
+			}
+
+			failures := tc.account.failures
+			if tc.failures != nil {
+				failures = *tc.failures
+			}
+			_, err := db.ClaimLoginAttempt(ctx, database.ClaimLoginAttemptParams{
+				ID:               id,
+				FailedLoginCount: failures,
+				DelaySeconds:     loginDelay(failures).Seconds(),
+			})
+			if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+				t.Fatal(err)
+			}
+			if claimed := err == nil; claimed != tc.want {
+				t.Errorf("claimed = %v, want %v", claimed, tc.want)
+			}
+		})
+	}
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
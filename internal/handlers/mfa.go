@@ -0,0 +1,367 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"log"
+	"strings"
+	"time"
+
+	"Secure-Document-Exchange-Portal/internal/auth"
+	"Secure-Document-Exchange-Portal/internal/database"
+	"Secure-Document-Exchange-Portal/internal/services"
+	"Secure-Document-Exchange-Portal/templates"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+const (
+	// totpIssuer is the account name prefix shown in authenticator apps
+	totpIssuer = "Secure Document Exchange Portal"
+	// recoveryCodeCount is how many recovery codes are generated at a time
+	recoveryCodeCount = 10
+)
+
+// recoveryCodeAlphabet has 32 characters, leaving out ones that are easily
+// confused (i, l, o and 1)
+const recoveryCodeAlphabet = "abcdefghjkmnpqrstuvwxyz023456789"
+
+type MFAHandler struct {
+	db         *database.Queries
+	cache      *services.CachedRepository
+	audit      *services.AuditLog
+	requireMFA bool
+}
+
+func NewMFAHandler(db *database.Queries, cache *services.CachedRepository, audit *services.AuditLog, requireMFA bool) *MFAHandler {
+	return &MFAHandler{
+		db:         db,
+		cache:      cache,
+		audit:      audit,
+		requireMFA: requireMFA,
+	}
+}
+
+// Status reports whether two-factor authentication is enabled for the user
+func (h *MFAHandler) Status(c *fiber.Ctx) error {
+	userID, err := auth.GetUserID(c)
+	if err != nil {
+		return err
+	}
+
+	user, err := h.db.GetUserByID(c.Context(), pgtype.UUID{Bytes: userID, Valid: true})
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
+	}
+
+	return h.renderStatus(c, user)
+}
+
+// SetupTOTP generates a new TOTP secret for the user. It only takes effect
+// once EnableTOTP has verified a code generated from it.
+func (h *MFAHandler) SetupTOTP(c *fiber.Ctx) error {
+	userID, err := auth.GetUserID(c)
+	if err != nil {
+		return err
+	}
+
+	user, err := h.db.GetUserByID(c.Context(), pgtype.UUID{Bytes: userID, Valid: true})
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
+	}
+	if user.TotpEnabled {
+		return mfaError(c, fiber.StatusConflict, "Two-factor authentication is already enabled")
+	}
+
+	secret, uri, err := startTOTPEnrollment(c.Context(), h.db, user)
+	if err != nil {
+		return mfaError(c, fiber.StatusInternalServerError, "Failed to set up two-factor authentication")
+	}
+
+	if c.Get("HX-Request") == "true" {
+		c.Set("Content-Type", "text/html")
+		return templates.TOTPSetup(secret, uri).Render(c.Context(), c.Response().BodyWriter())
+	}
+
+	return c.JSON(fiber.Map{
+		"secret":           secret,
+		"provisioning_uri": uri,
+	})
+}
+
+// EnableTOTP turns on two-factor authentication after checking a code from
+// the pending secret, and returns the user's recovery codes
+func (h *MFAHandler) EnableTOTP(c *fiber.Ctx) error {
+	userID, err := auth.GetUserID(c)
+	if err != nil {
+		return err
+	}
+
+	user, err := h.db.GetUserByID(c.Context(), pgtype.UUID{Bytes: userID, Valid: true})
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
+	}
+	if user.TotpEnabled {
+		return mfaError(c, fiber.StatusConflict, "Two-factor authentication is already enabled")
+	}
+	if !user.TotpSecret.Valid {
+		return mfaError(c, fiber.StatusBadRequest, "Set up an authenticator app first")
+	}
+
+	if !verifyTOTPCode(c.Context(), h.db, user, c.FormValue("code")) {
+		return mfaError(c, fiber.StatusUnauthorized, "Invalid verification code")
+	}
+
+	codes, err := enableTOTP(c.Context(), h.db, h.cache, user)
+	if err != nil {
+		return mfaError(c, fiber.StatusInternalServerError, "Failed to enable two-factor authentication")
+	}
+	recordAudit(c, h.audit, services.AuditEvent{Action: services.AuditTOTPEnabled})
+
+	return h.renderRecoveryCodes(c, codes)
+}
+
+// DisableTOTP turns off TOTP. It needs a current TOTP code or a recovery
+// code, and is refused while MFA is required and the user has no security
+// key to fall back on.
+func (h *MFAHandler) DisableTOTP(c *fiber.Ctx) error {
+	userID, err := auth.GetUserID(c)
+	if err != nil {
+		return err
+	}
+
+	user, err := h.db.GetUserByID(c.Context(), pgtype.UUID{Bytes: userID, Valid: true})
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
+	}
+	if !user.TotpEnabled {
+		return mfaError(c, fiber.StatusBadRequest, "Two-factor authentication is not enabled")
+	}
+
+	required, err := mfaRequired(c.Context(), h.db, h.requireMFA, user.ID)
+	if err != nil {
+		return mfaError(c, fiber.StatusInternalServerError, "Failed to load organization settings")
+	}
+	if required {
+		count, err := h.db.CountUserWebAuthnCredentials(c.Context(), user.ID)
+		if err != nil {
+			return mfaError(c, fiber.StatusInternalServerError, "Failed to load security keys")
+		}
+		if count == 0 {
+			return mfaError(c, fiber.StatusForbidden, "Two-factor authentication is required by your organization")
+		}
+	}
+
+	code := c.FormValue("code")
+	if !verifyTOTPCode(c.Context(), h.db, user, code) && !useRecoveryCode(c.Context(), h.db, user, code) {
+		return mfaError(c, fiber.StatusUnauthorized, "Invalid verification code")
+	}
+
+	user, err = h.db.DisableUserTOTP(c.Context(), user.ID)
+	if err != nil {
+		return mfaError(c, fiber.StatusInternalServerError, "Failed to disable two-factor authentication")
+	}
+	if err := h.db.DeleteUserRecoveryCodes(c.Context(), user.ID); err != nil {
+		log.Printf("Failed to delete recovery codes of user %s: %v", user.ID.String(), err)
+	}
+	h.cache.InvalidateUser(c.Context(), user.ID.Bytes, user.Email)
+	recordAudit(c, h.audit, services.AuditEvent{Action: services.AuditTOTPDisabled})
+
+	if c.Get("HX-Request") == "true" {
+		c.Set("HX-Retarget", "#mfa-settings")
+	}
+	return h.renderStatus(c, user)
+}
+
+// RegenerateRecoveryCodes replaces all of the user's recovery codes. It
+// needs a current TOTP code.
+func (h *MFAHandler) RegenerateRecoveryCodes(c *fiber.Ctx) error {
+	userID, err := auth.GetUserID(c)
+	if err != nil {
+		return err
+	}
+
+	user, err := h.db.GetUserByID(c.Context(), pgtype.UUID{Bytes: userID, Valid: true})
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
+	}
+	if !user.TotpEnabled {
+		return mfaError(c, fiber.StatusBadRequest, "Two-factor authentication is not enabled")
+	}
+
+	if !verifyTOTPCode(c.Context(), h.db, user, c.FormValue("code")) {
+		return mfaError(c, fiber.StatusUnauthorized, "Invalid verification code")
+	}
+
+	codes, err := generateRecoveryCodes(c.Context(), h.db, user.ID)
+	if err != nil {
+		return mfaError(c, fiber.StatusInternalServerError, "Failed to generate recovery codes")
+	}
+	recordAudit(c, h.audit, services.AuditEvent{Action: services.AuditRecoveryCodesRenew})
+
+	return h.renderRecoveryCodes(c, codes)
+}
+
+func (h *MFAHandler) renderStatus(c *fiber.Ctx, user database.User) error {
+	remaining, err := h.db.CountUnusedRecoveryCodes(c.Context(), user.ID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to load recovery codes"})
+	}
+
+	webAuthnCount, err := h.db.CountUserWebAuthnCredentials(c.Context(), user.ID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to load security keys"})
+	}
+
+	required, err := mfaRequired(c.Context(), h.db, h.requireMFA, user.ID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to load organization settings"})
+	}
+
+	status := templates.MFAStatus{
+		Enabled:                user.TotpEnabled,
+		Required:               required,
+		CanDisable:             !required || webAuthnCount > 0,
+		RecoveryCodesRemaining: remaining,
+	}
+
+	if c.Get("HX-Request") == "true" {
+		c.Set("Content-Type", "text/html")
+		return templates.MFASettings(status).Render(c.Context(), c.Response().BodyWriter())
+	}
+
+	return c.JSON(fiber.Map{
+		"totp_enabled":             status.Enabled,
+		"required":                 status.Required,
+		"recovery_codes_remaining": status.RecoveryCodesRemaining,
+	})
+}
+
+func (h *MFAHandler) renderRecoveryCodes(c *fiber.Ctx, codes []string) error {
+	if c.Get("HX-Request") == "true" {
+		// The forms target their error box, the codes replace the settings
+		c.Set("HX-Retarget", "#mfa-settings")
+		c.Set("Content-Type", "text/html")
+		return templates.RecoveryCodes(codes, "/account/security").Render(c.Context(), c.Response().BodyWriter())
+	}
+
+	return c.JSON(fiber.Map{"recovery_codes": codes})
+}
+
+// mfaError sends an error as JSON, or as an error box for HTMX requests
+func mfaError(c *fiber.Ctx, status int, message string) error {
+	if c.Get("HX-Request") == "true" {
+		return c.Status(status).SendString(`<div class="mb-4 p-4 bg-red-100 border border-red-400 text-red-700 rounded"><p>` + message + `</p></div>`)
+	}
+	return c.Status(status).JSON(fiber.Map{"error": message})
+}
+
+// mfaRequired reports whether the user must have a second factor, because
+// the portal requires one of everybody or one of their organizations does
+func mfaRequired(ctx context.Context, db *database.Queries, requireAll bool, userID pgtype.UUID) (bool, error) {
+	if requireAll {
+		return true, nil
+	}
+	return db.UserRequiresMFA(ctx, userID)
+}
+
+// startTOTPEnrollment stores a new, not yet enabled TOTP secret for the user
+// and returns it with its provisioning URI
+func startTOTPEnrollment(ctx context.Context, db *database.Queries, user database.User) (string, string, error) {
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		return "", "", err
+	}
+
+	_, err = db.SetUserTOTPSecret(ctx, database.SetUserTOTPSecretParams{
+		ID:         user.ID,
+		TotpSecret: pgtype.Text{String: secret, Valid: true},
+	})
+	if err != nil {
+		return "", "", err
+	}
+
+	return secret, auth.TOTPProvisioningURI(totpIssuer, user.Email, secret), nil
+}
+
+// enableTOTP turns on two-factor authentication for the user and returns a
+// fresh set of recovery codes
+func enableTOTP(ctx context.Context, db *database.Queries, cache *services.CachedRepository, user database.User) ([]string, error) {
+	user, err := db.EnableUserTOTP(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	cache.InvalidateUser(ctx, user.ID.Bytes, user.Email)
+
+	return generateRecoveryCodes(ctx, db, user.ID)
+}
+
+// verifyTOTPCode checks a code against the user's TOTP secret. Each code is
+// accepted only once, even within its validity window.
+func verifyTOTPCode(ctx context.Context, db *database.Queries, user database.User, code string) bool {
+	if !user.TotpSecret.Valid {
+		return false
+	}
+
+	step, ok := auth.ValidateTOTP(user.TotpSecret.String, code, time.Now())
+	if !ok {
+		return false
+	}
+
+	updated, err := db.UseUserTOTPStep(ctx, database.UseUserTOTPStepParams{
+		ID:           user.ID,
+		TotpLastStep: step,
+	})
+	return err == nil && updated == 1
+}
+
+// useRecoveryCode marks one of the user's unused recovery codes as used
+func useRecoveryCode(ctx context.Context, db *database.Queries, user database.User, code string) bool {
+	code = normalizeRecoveryCode(code)
+	if code == "" {
+		return false
+	}
+
+	used, err := db.UseRecoveryCode(ctx, database.UseRecoveryCodeParams{
+		UserID:   user.ID,
+		CodeHash: auth.HashToken(code),
+	})
+	return err == nil && used == 1
+}
+
+// generateRecoveryCodes replaces the user's recovery codes with new ones.
+// Only their hashes are stored.
+func generateRecoveryCodes(ctx context.Context, db *database.Queries, userID pgtype.UUID) ([]string, error) {
+	if err := db.DeleteUserRecoveryCodes(ctx, userID); err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		raw := make([]byte, 10)
+		if _, err := rand.Read(raw); err != nil {
+			return nil, err
+		}
+		for j, b := range raw {
+			raw[j] = recoveryCodeAlphabet[b&31]
+		}
+		code := string(raw[:5]) + "-" + string(raw[5:])
+
+		err := db.CreateRecoveryCode(ctx, database.CreateRecoveryCodeParams{
+			UserID:   userID,
+			CodeHash: auth.HashToken(normalizeRecoveryCode(code)),
+		})
+		if err != nil {
+			return nil, err
+		}
+		codes = append(codes, code)
+	}
+
+	return codes, nil
+}
+
+// normalizeRecoveryCode ignores case, spaces and dashes
+func normalizeRecoveryCode(code string) string {
+	return strings.NewReplacer("-", "", " ", "").Replace(strings.ToLower(strings.TrimSpace(code)))
+}
@@ -0,0 +1,312 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"html"
+	"log"
+	"math"
+	"os"
+	"strings"
+	"time"
+
+	"Secure-Document-Exchange-Portal/internal/auth"
+	"Secure-Document-Exchange-Portal/internal/database"
+	"Secure-Document-Exchange-Portal/internal/models"
+	"Secure-Document-Exchange-Portal/internal/validation"
+	"Secure-Document-Exchange-Portal/templates"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"golang.org/x/oauth2"
+)
+
+const (
+	// oidcStateCookieName binds an SSO login to the browser that started it,
+	// so a callback URL cannot be replayed in another browser
+	oidcStateCookieName = "oidc_state"
+	oidcStateCookiePath = "/auth/oidc"
+	// oidcRequestTTL is how long a user has to sign in at the identity
+	// provider
+	oidcRequestTTL = 10 * time.Minute
+)
+
+// ssoStateInvalidMessage is shown when a callback does not belong to a login
+// this browser started, or came too late
+const ssoStateInvalidMessage = "Your sign-in attempt expired. Please try again."
+
+// SSOProviders returns the identity providers shown on the login page
+func (h *AuthHandler) SSOProviders() []templates.SSOProvider {
+	var providers []templates.SSOProvider
+	for _, provider := range h.oidc.Providers() {
+		providers = append(providers, templates.SSOProvider{Name: provider.Name, DisplayName: provider.DisplayName})
+	}
+	return providers
+}
+
+// SSOLogin starts an OpenID Connect login by redirecting to the identity
+// provider
+func (h *AuthHandler) SSOLogin(c *fiber.Ctx) error {
+	name := c.Params("provider")
+	if _, ok := h.oidc.Provider(name); !ok {
+		return h.ssoError(c, fiber.StatusNotFound, "Unknown single sign-on provider")
+	}
+
+	state, err := randomURLToken()
+	if err != nil {
+		return h.ssoError(c, fiber.StatusInternalServerError, "Failed to start single sign-on")
+	}
+	nonce, err := randomURLToken()
+	if err != nil {
+		return h.ssoError(c, fiber.StatusInternalServerError, "Failed to start single sign-on")
+	}
+	verifier := oauth2.GenerateVerifier()
+
+	redirectURL, err := h.oidc.AuthCodeURL(c.Context(), name, state, nonce, verifier)
+	if err != nil {
+		log.Printf("Failed to start SSO login with %s: %v", name, err)
+		return h.ssoError(c, fiber.StatusBadGateway, "Single sign-on is unavailable right now. Please try again later.")
+	}
+
+	err = h.db.CreateOIDCAuthRequest(c.Context(), database.CreateOIDCAuthRequestParams{
+		StateHash:    auth.HashToken(state),
+		Provider:     name,
+		CodeVerifier: verifier,
+		Nonce:        nonce,
+		ExpiresAt:    pgtype.Timestamptz{Time: time.Now().Add(oidcRequestTTL), Valid: true},
+	})
+	if err != nil {
+		return h.ssoError(c, fiber.StatusInternalServerError, "Failed to start single sign-on")
+	}
+
+	c.Cookie(&fiber.Cookie{
+		Name:     oidcStateCookieName,
+		Value:    state,
+		Path:     oidcStateCookiePath,
+		HTTPOnly: true,
+		Secure:   os.Getenv("APP_ENV") == "production",
+		// Lax, so the cookie comes along on the provider's redirect back
+		SameSite: "Lax",
+		MaxAge:   int(oidcRequestTTL.Seconds()),
+	})
+
+	return c.Redirect(redirectURL, fiber.StatusFound)
+}
+
+// SSOCallback completes an OpenID Connect login. The user is matched by
+// their identity at the provider, linked to an existing account by verified
+// email, or provisioned on their first login.
+func (h *AuthHandler) SSOCallback(c *fiber.Ctx) error {
+	name := c.Params("provider")
+	state := c.Query("state")
+	cookieState := c.Cookies(oidcStateCookieName)
+	c.Cookie(&fiber.Cookie{
+		Name:    oidcStateCookieName,
+		Path:    oidcStateCookiePath,
+		Expires: time.Unix(0, 0),
+		MaxAge:  -1,
+	})
+
+	if providerError := c.Query("error"); providerError != "" {
+		log.Printf("SSO login with %s failed at the provider: %s %s", name, providerError, c.Query("error_description"))
+		return h.ssoError(c, fiber.StatusUnauthorized, "Sign-in was cancelled or denied by your identity provider")
+	}
+
+	if state == "" || subtle.ConstantTimeCompare([]byte(state), []byte(cookieState)) != 1 {
+		return h.ssoError(c, fiber.StatusBadRequest, ssoStateInvalidMessage)
+	}
+
+	request, err := h.db.TakeOIDCAuthRequest(c.Context(), auth.HashToken(state))
+	if err != nil || request.Provider != name {
+		return h.ssoError(c, fiber.StatusBadRequest, ssoStateInvalidMessage)
+	}
+
+	identity, err := h.oidc.Exchange(c.Context(), name, c.Query("code"), request.Nonce, request.CodeVerifier)
+	if err != nil {
+		log.Printf("SSO login with %s failed: %v", name, err)
+		return h.ssoError(c, fiber.StatusUnauthorized, "Single sign-on failed. Please try again.")
+	}
+
+	user, linked, err := h.ssoUser(c.Context(), identity)
+	if err != nil {
+		var userErr ssoUserError
+		if errors.As(err, &userErr) {
+			return h.ssoError(c, fiber.StatusForbidden, err.Error())
+		}
+		log.Printf("Failed to sign in %s user %s: %v", name, identity.Subject, err)
+		return h.ssoError(c, fiber.StatusInternalServerError, "Single sign-on failed. Please try again.")
+	}
+
+	if !user.IsActive.Bool {
+		return h.ssoError(c, fiber.StatusForbidden, accountDeactivatedMessage)
+	}
+	if user.LockedUntil.Valid && user.LockedUntil.Time.After(time.Now()) {
+		wait := time.Until(user.LockedUntil.Time)
+		return h.ssoError(c, fiber.StatusTooManyRequests, fmt.Sprintf(
+			"Too many failed sign-in attempts. This account is locked for %d more minute(s).",
+			int(math.Ceil(wait.Minutes()))))
+	}
+
+	// Second factors set up in the portal still apply, and an account that
+	// was just linked by email has to prove it is the same person
+	webAuthnCount, err := h.db.CountUserWebAuthnCredentials(c.Context(), user.ID)
+	if err != nil {
+		return h.ssoError(c, fiber.StatusInternalServerError, "Failed to load security keys")
+	}
+	required, err := mfaRequired(c.Context(), h.db, h.requireMFA, user.ID)
+	if err != nil {
+		return h.ssoError(c, fiber.StatusInternalServerError, "Failed to load organization settings")
+	}
+	if user.TotpEnabled || webAuthnCount > 0 || required || linked {
+		challenge, err := h.mfaChallenge(c, models.FromDatabaseUser(&user), webAuthnCount > 0)
+		if err != nil {
+			return h.ssoError(c, fiber.StatusInternalServerError, "Failed to start two-factor authentication")
+		}
+		c.Set("Content-Type", "text/html")
+		return templates.Base(false, "", templates.MFAChallengeForm(challenge)).Render(c.Context(), c.Response().BodyWriter())
+	}
+	h.resetLoginFailures(c, user.ID)
+
+	token, refreshToken, err := h.startSession(c, user.ID.Bytes)
+	if err != nil {
+		return h.ssoError(c, fiber.StatusInternalServerError, "Failed to generate token")
+	}
+	setAuthCookies(c, token, refreshToken)
+
+	return c.Redirect("/documents", fiber.StatusFound)
+}
+
+// ssoUserError is a reason to refuse an SSO login that is shown to the user
+type ssoUserError string
+
+func (e ssoUserError) Error() string {
+	return string(e)
+}
+
+// ssoUser returns the account an identity signs in to, and whether an
+// existing account was linked to the identity by its email address
+func (h *AuthHandler) ssoUser(ctx context.Context, identity *auth.OIDCIdentity) (database.User, bool, error) {
+	linked, err := h.db.GetUserIdentity(ctx, database.GetUserIdentityParams{
+		Provider: identity.Provider,
+		Subject:  identity.Subject,
+	})
+	if err == nil {
+		if identity.Email != "" {
+			if err := h.db.TouchUserIdentity(ctx, database.TouchUserIdentityParams{ID: linked.ID, Email: identity.Email}); err != nil {
+				log.Printf("Failed to update SSO identity %s: %v", linked.ID.String(), err)
+			}
+		}
+		user, err := h.db.GetUserByID(ctx, linked.UserID)
+		return user, false, err
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return database.User{}, false, err
+	}
+
+	// Accounts are only linked or created for addresses the provider has
+	// verified; anyone can put any address in their profile otherwise
+	if identity.Email == "" || !identity.EmailVerified {
+		return database.User{}, false, ssoUserError("Your identity provider did not confirm your email address")
+	}
+	if enforced, ok := h.oidc.EnforcedProvider(identity.Email); ok && enforced.Name != identity.Provider {
+		return database.User{}, false, ssoUserError(fmt.Sprintf("Accounts at your organization sign in with %s", enforced.DisplayName))
+	}
+
+	linkedByEmail := false
+	user, err := h.db.GetUserByEmail(ctx, identity.Email)
+	switch {
+	case err == nil:
+		linkedByEmail = true
+		// Whoever registered the address before may not own it, so their
+		// sessions end when the verified owner links the account
+		revoked, err := h.db.DeleteAllUserSessions(ctx, user.ID)
+		if err != nil {
+			return database.User{}, false, err
+		}
+		h.cache.InvalidateSessions(ctx, revoked)
+		log.Printf("Linked %s identity %s to user %s", identity.Provider, identity.Subject, user.ID.String())
+	case errors.Is(err, pgx.ErrNoRows):
+		user, err = h.db.CreateUser(ctx, database.CreateUserParams{
+			Email: identity.Email,
+			// SSO accounts have no password; no hash ever matches this one
+			PasswordHash: "",
+			FullName:     ssoFullName(identity),
+		})
+		if err != nil {
+			return database.User{}, false, err
+		}
+		log.Printf("Provisioned user %s from %s identity %s", user.ID.String(), identity.Provider, identity.Subject)
+		if _, err := personalWorkspace(ctx, h.db, user.ID.Bytes); err != nil {
+			log.Printf("Failed to create personal workspace for user %s: %v", user.ID.String(), err)
+		}
+	default:
+		return database.User{}, false, err
+	}
+
+	_, err = h.db.CreateUserIdentity(ctx, database.CreateUserIdentityParams{
+		UserID:   user.ID,
+		Provider: identity.Provider,
+		Subject:  identity.Subject,
+		Email:    identity.Email,
+	})
+	if err != nil {
+		return database.User{}, false, err
+	}
+
+	// The provider verified the address
+	user, err = h.db.MarkUserEmailVerified(ctx, user.ID)
+	if err != nil {
+		return database.User{}, false, err
+	}
+	h.cache.InvalidateUser(ctx, user.ID.Bytes, user.Email)
+	return user, linkedByEmail, nil
+}
+
+// ssoFullName returns the name to provision an account with, falling back
+// to the email's local part when the provider sent no usable name
+func ssoFullName(identity *auth.OIDCIdentity) string {
+	name := strings.TrimSpace(identity.Name)
+	if validation.ValidateFullName(name) == nil {
+		return name
+	}
+	return identity.Email[:strings.LastIndex(identity.Email, "@")]
+}
+
+// ssoEnforced refuses password logins and registrations for email domains
+// that must sign in with an identity provider
+func (h *AuthHandler) ssoEnforced(c *fiber.Ctx, email string) (bool, error) {
+	provider, ok := h.oidc.EnforcedProvider(email)
+	if !ok {
+		return false, nil
+	}
+	if c.Get("HX-Request") == "true" {
+		return true, c.Status(fiber.StatusForbidden).SendString(fmt.Sprintf(
+			`<div class="mb-4 p-4 bg-red-100 border border-red-400 text-red-700 rounded"><p>Your organization requires single sign-on. <a href="/auth/oidc/%s/login" class="font-bold underline">Sign in with %s</a></p></div>`,
+			provider.Name, html.EscapeString(provider.DisplayName)))
+	}
+	return true, c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+		"error":        "Your organization requires single sign-on",
+		"sso_provider": provider.Name,
+		"sso_url":      "/auth/oidc/" + provider.Name + "/login",
+	})
+}
+
+// ssoError shows the login page with an error, since SSO callbacks are
+// full page loads
+func (h *AuthHandler) ssoError(c *fiber.Ctx, status int, message string) error {
+	return h.renderLoginPage(c, status, []string{message}, "")
+}
+
+// randomURLToken returns 32 random bytes, base64url encoded
+func randomURLToken() (string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
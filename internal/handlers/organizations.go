@@ -0,0 +1,573 @@
+package handlers
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"Secure-Document-Exchange-Portal/internal/auth"
+	"Secure-Document-Exchange-Portal/internal/database"
+	"Secure-Document-Exchange-Portal/internal/models"
+	"Secure-Document-Exchange-Portal/internal/services"
+	"Secure-Document-Exchange-Portal/internal/validation"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// Organization roles. The policy treats owners as owners, admins as
+// editors and members as viewers of the organization: owners and admins
+// manage members, teams and workspaces, and only owners change who owns it.
+// Both have owner access to every workspace of the organization.
+const (
+	orgRoleOwner  = "owner"
+	orgRoleAdmin  = "admin"
+	orgRoleMember = "member"
+)
+
+type OrganizationHandler struct {
+	db     *database.Queries
+	cache  *services.CachedRepository
+	policy *auth.Policy
+	quotas *services.QuotaService
+	audit  *services.AuditLog
+}
+
+func NewOrganizationHandler(db *database.Queries, cache *services.CachedRepository, policy *auth.Policy, quotas *services.QuotaService, audit *services.AuditLog) *OrganizationHandler {
+	return &OrganizationHandler{
+		db:     db,
+		cache:  cache,
+		policy: policy,
+		quotas: quotas,
+		audit:  audit,
+	}
+}
+
+// Create creates an organization with the current user as its owner
+func (h *OrganizationHandler) Create(c *fiber.Ctx) error {
+	userID, err := auth.GetUserID(c)
+	if err != nil {
+		return err
+	}
+
+	var req models.NameRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	name := strings.TrimSpace(req.Name)
+	if err := validation.ValidateGroupName("organization", name); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	org, err := h.db.CreateOrganization(c.Context(), name)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to create organization"})
+	}
+	_, err = h.db.AddOrganizationMember(c.Context(), database.AddOrganizationMemberParams{
+		OrganizationID: org.ID,
+		UserID:         pgtype.UUID{Bytes: userID, Valid: true},
+		Role:           orgRoleOwner,
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to create organization"})
+	}
+	h.cache.InvalidateOrganizationRole(c.Context(), org.ID.Bytes, userID)
+	recordAudit(c, h.audit, organizationEvent(services.AuditOrganizationCreated, org, map[string]string{"name": org.Name}))
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"id":         org.ID.String(),
+		"name":       org.Name,
+		"role":       orgRoleOwner,
+		"created_at": org.CreatedAt.Time.Format(time.RFC3339),
+	})
+}
+
+// List returns the organizations the user is a member of
+func (h *OrganizationHandler) List(c *fiber.Ctx) error {
+	userID, err := auth.GetUserID(c)
+	if err != nil {
+		return err
+	}
+
+	orgs, err := h.db.ListUserOrganizations(c.Context(), pgtype.UUID{Bytes: userID, Valid: true})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to list organizations"})
+	}
+
+	result := make([]fiber.Map, 0, len(orgs))
+	for _, org := range orgs {
+		result = append(result, fiber.Map{
+			"id":          org.ID.String(),
+			"name":        org.Name,
+			"role":        org.Role,
+			"require_mfa": org.RequireMfa,
+			"created_at":  org.CreatedAt.Time.Format(time.RFC3339),
+		})
+	}
+	return c.JSON(result)
+}
+
+// Get returns an organization with its members and teams
+func (h *OrganizationHandler) Get(c *fiber.Ctx) error {
+	org, role, ok, err := h.organization(c, auth.ActionOrganizationRead)
+	if !ok {
+		return err
+	}
+
+	members, err := h.db.ListOrganizationMembers(c.Context(), org.ID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to list members"})
+	}
+	teams, err := h.db.ListOrganizationTeams(c.Context(), org.ID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to list teams"})
+	}
+	teamMembers, err := h.db.ListTeamMembers(c.Context(), org.ID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to list teams"})
+	}
+
+	memberList := make([]fiber.Map, 0, len(members))
+	for _, member := range members {
+		memberList = append(memberList, fiber.Map{
+			"user_id":   member.UserID.String(),
+			"email":     member.Email,
+			"full_name": member.FullName,
+			"role":      member.Role,
+			"joined_at": member.CreatedAt.Time.Format(time.RFC3339),
+		})
+	}
+
+	teamList := make([]fiber.Map, 0, len(teams))
+	for _, team := range teams {
+		users := []fiber.Map{}
+		for _, member := range teamMembers {
+			if member.TeamID == team.ID {
+				users = append(users, fiber.Map{
+					"user_id":   member.UserID.String(),
+					"email":     member.Email,
+					"full_name": member.FullName,
+				})
+			}
+		}
+		teamList = append(teamList, fiber.Map{
+			"id":      team.ID.String(),
+			"name":    team.Name,
+			"members": users,
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"id":          org.ID.String(),
+		"name":        org.Name,
+		"role":        role,
+		"require_mfa": org.RequireMfa,
+		"created_at":  org.CreatedAt.Time.Format(time.RFC3339),
+		"members":     memberList,
+		"teams":       teamList,
+	})
+}
+
+// SetMFARequirement turns on or off the requirement for members to sign in
+// with a second factor. Members without one are asked to set it up at their
+// next login.
+func (h *OrganizationHandler) SetMFARequirement(c *fiber.Ctx) error {
+	org, _, ok, err := h.organization(c, auth.ActionOrganizationManage)
+	if !ok {
+		return err
+	}
+
+	var req models.OrganizationMFARequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	org, err = h.db.SetOrganizationRequireMFA(c.Context(), database.SetOrganizationRequireMFAParams{
+		ID:         org.ID,
+		RequireMfa: req.RequireMFA,
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update organization"})
+	}
+	recordAudit(c, h.audit, organizationEvent(services.AuditOrganizationMFASet, org, map[string]string{"require_mfa": strconv.FormatBool(org.RequireMfa)}))
+
+	return c.JSON(fiber.Map{
+		"id":          org.ID.String(),
+		"require_mfa": org.RequireMfa,
+	})
+}
+
+// Storage shows how much of its storage quota the organization uses, for
+// the documents in all of its workspaces
+func (h *OrganizationHandler) Storage(c *fiber.Ctx) error {
+	org, _, ok, err := h.organization(c, auth.ActionOrganizationRead)
+	if !ok {
+		return err
+	}
+
+	usage, err := h.quotas.OrganizationUsage(c.Context(), org.ID.Bytes)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to load storage usage"})
+	}
+	return storageUsage(c, usage)
+}
+
+// AddMember adds a registered user to the organization, or changes the
+// role of an existing member
+func (h *OrganizationHandler) AddMember(c *fiber.Ctx) error {
+	org, _, ok, err := h.organization(c, auth.ActionOrganizationManage)
+	if !ok {
+		return err
+	}
+
+	var req models.OrganizationMemberRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	if req.Role == "" {
+		req.Role = orgRoleMember
+	}
+	if req.Role != orgRoleOwner && req.Role != orgRoleAdmin && req.Role != orgRoleMember {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Role must be owner, admin or member"})
+	}
+
+	user, err := h.db.GetUserByEmail(c.Context(), strings.TrimSpace(req.Email))
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "No user with this email address"})
+	}
+
+	currentRole, err := h.memberRole(c, org.ID, user.ID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to load member"})
+	}
+	if req.Role == orgRoleOwner || currentRole == orgRoleOwner {
+		if ok, err := h.transfer(c, org); !ok {
+			return err
+		}
+	}
+	if currentRole == orgRoleOwner && req.Role != orgRoleOwner {
+		if ok, err := h.keepsOwner(c, org.ID); !ok {
+			return err
+		}
+	}
+
+	_, err = h.db.AddOrganizationMember(c.Context(), database.AddOrganizationMemberParams{
+		OrganizationID: org.ID,
+		UserID:         user.ID,
+		Role:           req.Role,
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to add member"})
+	}
+	// Admins have access to every workspace of the organization
+	h.cache.InvalidateOrganizationRole(c.Context(), org.ID.Bytes, user.ID.Bytes)
+	h.cache.InvalidateUserWorkspaceRoles(c.Context(), user.ID.Bytes)
+	recordAudit(c, h.audit, organizationEvent(services.AuditOrganizationMemberSet, org, map[string]string{
+		"user_id":       user.ID.String(),
+		"email":         user.Email,
+		"role":          req.Role,
+		"previous_role": currentRole,
+	}))
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"user_id":   user.ID.String(),
+		"email":     user.Email,
+		"full_name": user.FullName,
+		"role":      req.Role,
+	})
+}
+
+// RemoveMember removes a user from the organization, its teams and its
+// workspaces. Members can remove themselves.
+func (h *OrganizationHandler) RemoveMember(c *fiber.Ctx) error {
+	userID, err := auth.GetUserID(c)
+	if err != nil {
+		return err
+	}
+
+	memberID, err := uuid.Parse(c.Params("userId"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid user ID"})
+	}
+
+	// Members can always leave
+	action := auth.ActionOrganizationManage
+	if memberID == userID {
+		action = auth.ActionOrganizationRead
+	}
+	org, _, ok, err := h.organization(c, action)
+	if !ok {
+		return err
+	}
+
+	memberRole, err := h.memberRole(c, org.ID, pgtype.UUID{Bytes: memberID, Valid: true})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to load member"})
+	}
+	if memberRole == "" {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Member not found"})
+	}
+	if memberRole == orgRoleOwner {
+		if ok, err := h.transfer(c, org); !ok {
+			return err
+		}
+		if ok, err := h.keepsOwner(c, org.ID); !ok {
+			return err
+		}
+	}
+
+	_, err = h.db.RemoveOrganizationMember(c.Context(), database.RemoveOrganizationMemberParams{
+		OrganizationID: org.ID,
+		UserID:         pgtype.UUID{Bytes: memberID, Valid: true},
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to remove member"})
+	}
+	h.cache.InvalidateOrganizationRole(c.Context(), org.ID.Bytes, memberID)
+	h.cache.InvalidateUserWorkspaceRoles(c.Context(), memberID)
+	h.cache.InvalidateUserDocumentGrants(c.Context(), memberID)
+	recordAudit(c, h.audit, organizationEvent(services.AuditOrganizationMemberGone, org, map[string]string{
+		"user_id": memberID.String(),
+		"role":    memberRole,
+	}))
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// CreateTeam adds a team to the organization
+func (h *OrganizationHandler) CreateTeam(c *fiber.Ctx) error {
+	org, _, ok, err := h.organization(c, auth.ActionOrganizationManage)
+	if !ok {
+		return err
+	}
+
+	var req models.NameRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	name := strings.TrimSpace(req.Name)
+	if err := validation.ValidateGroupName("team", name); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	team, err := h.db.CreateTeam(c.Context(), database.CreateTeamParams{
+		OrganizationID: org.ID,
+		Name:           name,
+	})
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "A team with this name already exists"})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to create team"})
+	}
+	recordAudit(c, h.audit, organizationEvent(services.AuditTeamCreated, org, map[string]string{
+		"team_id": team.ID.String(),
+		"name":    team.Name,
+	}))
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"id":      team.ID.String(),
+		"name":    team.Name,
+		"members": []fiber.Map{},
+	})
+}
+
+// DeleteTeam deletes a team. Its members lose the workspace access they
+// had through it.
+func (h *OrganizationHandler) DeleteTeam(c *fiber.Ctx) error {
+	org, _, ok, err := h.organization(c, auth.ActionOrganizationManage)
+	if !ok {
+		return err
+	}
+
+	teamID, err := uuid.Parse(c.Params("teamId"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid team ID"})
+	}
+
+	deleted, err := h.db.DeleteTeam(c.Context(), database.DeleteTeamParams{
+		ID:             pgtype.UUID{Bytes: teamID, Valid: true},
+		OrganizationID: org.ID,
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to delete team"})
+	}
+	if deleted == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Team not found"})
+	}
+	h.cache.InvalidateAllWorkspaceRoles(c.Context())
+	h.cache.InvalidateAllDocumentGrants(c.Context())
+	recordAudit(c, h.audit, organizationEvent(services.AuditTeamDeleted, org, map[string]string{"team_id": teamID.String()}))
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// AddTeamMember adds a member of the organization to one of its teams
+func (h *OrganizationHandler) AddTeamMember(c *fiber.Ctx) error {
+	org, _, ok, err := h.organization(c, auth.ActionOrganizationManage)
+	if !ok {
+		return err
+	}
+	team, ok, err := h.team(c, org)
+	if !ok {
+		return err
+	}
+
+	var req models.EmailRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	user, err := h.db.GetUserByEmail(c.Context(), strings.TrimSpace(req.Email))
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "No user with this email address"})
+	}
+	if role, err := h.memberRole(c, org.ID, user.ID); err != nil || role == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Only members of the organization can join its teams"})
+	}
+
+	err = h.db.AddTeamMember(c.Context(), database.AddTeamMemberParams{
+		TeamID: team.ID,
+		UserID: user.ID,
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to add team member"})
+	}
+	h.cache.InvalidateUserWorkspaceRoles(c.Context(), user.ID.Bytes)
+	h.cache.InvalidateUserDocumentGrants(c.Context(), user.ID.Bytes)
+	recordAudit(c, h.audit, organizationEvent(services.AuditTeamMemberAdded, org, map[string]string{
+		"team_id": team.ID.String(),
+		"user_id": user.ID.String(),
+		"email":   user.Email,
+	}))
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"user_id":   user.ID.String(),
+		"email":     user.Email,
+		"full_name": user.FullName,
+	})
+}
+
+// RemoveTeamMember removes a user from a team
+func (h *OrganizationHandler) RemoveTeamMember(c *fiber.Ctx) error {
+	org, _, ok, err := h.organization(c, auth.ActionOrganizationManage)
+	if !ok {
+		return err
+	}
+	team, ok, err := h.team(c, org)
+	if !ok {
+		return err
+	}
+
+	memberID, err := uuid.Parse(c.Params("userId"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid user ID"})
+	}
+
+	removed, err := h.db.RemoveTeamMember(c.Context(), database.RemoveTeamMemberParams{
+		TeamID: team.ID,
+		UserID: pgtype.UUID{Bytes: memberID, Valid: true},
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to remove team member"})
+	}
+	if removed == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Team member not found"})
+	}
+	h.cache.InvalidateUserWorkspaceRoles(c.Context(), memberID)
+	h.cache.InvalidateUserDocumentGrants(c.Context(), memberID)
+	recordAudit(c, h.audit, organizationEvent(services.AuditTeamMemberRemoved, org, map[string]string{
+		"team_id": team.ID.String(),
+		"user_id": memberID.String(),
+	}))
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// organizationEvent is an audit event about an organization
+func organizationEvent(action string, org database.Organization, details map[string]string) services.AuditEvent {
+	return services.AuditEvent{
+		Action:       action,
+		ResourceType: "organization",
+		ResourceID:   org.ID.String(),
+		Details:      details,
+	}
+}
+
+// organization loads the organization named in the URL and the current
+// user's role in it, and checks that the policy allows them the action.
+// Non-members get 404.
+func (h *OrganizationHandler) organization(c *fiber.Ctx, action auth.Action) (database.Organization, string, bool, error) {
+	userID, err := auth.GetUserID(c)
+	if err != nil {
+		return database.Organization{}, "", false, err
+	}
+
+	orgID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return database.Organization{}, "", false, c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid organization ID"})
+	}
+
+	org, err := h.db.GetOrganizationByID(c.Context(), pgtype.UUID{Bytes: orgID, Valid: true})
+	if err != nil {
+		return database.Organization{}, "", false, c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Organization not found"})
+	}
+
+	role, err := h.memberRole(c, org.ID, pgtype.UUID{Bytes: userID, Valid: true})
+	if err != nil {
+		return database.Organization{}, "", false, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to load organization"})
+	}
+	if role == "" {
+		return database.Organization{}, "", false, c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Organization not found"})
+	}
+	if ok, err := authorize(c, h.policy, userID, action, auth.Resource{OrganizationID: orgID}); !ok {
+		return database.Organization{}, "", false, err
+	}
+
+	return org, role, true, nil
+}
+
+// transfer checks that the current user may add or remove owners
+func (h *OrganizationHandler) transfer(c *fiber.Ctx, org database.Organization) (bool, error) {
+	userID, err := auth.GetUserID(c)
+	if err != nil {
+		return false, err
+	}
+	return authorize(c, h.policy, userID, auth.ActionOrganizationTransfer, auth.Resource{OrganizationID: org.ID.Bytes})
+}
+
+// team loads the team named in the URL, which must belong to org
+func (h *OrganizationHandler) team(c *fiber.Ctx, org database.Organization) (database.Team, bool, error) {
+	teamID, err := uuid.Parse(c.Params("teamId"))
+	if err != nil {
+		return database.Team{}, false, c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid team ID"})
+	}
+
+	team, err := h.db.GetTeamByID(c.Context(), pgtype.UUID{Bytes: teamID, Valid: true})
+	if err != nil || team.OrganizationID != org.ID {
+		return database.Team{}, false, c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Team not found"})
+	}
+	return team, true, nil
+}
+
+// memberRole returns a user's role in an organization, or an empty string
+// if they are not a member
+func (h *OrganizationHandler) memberRole(c *fiber.Ctx, orgID, userID pgtype.UUID) (string, error) {
+	return h.cache.GetOrganizationRole(c.Context(), orgID.Bytes, userID.Bytes)
+}
+
+// keepsOwner refuses changes that would leave the organization without an
+// owner
+func (h *OrganizationHandler) keepsOwner(c *fiber.Ctx, orgID pgtype.UUID) (bool, error) {
+	owners, err := h.db.CountOrganizationOwners(c.Context(), orgID)
+	if err != nil {
+		return false, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to load members"})
+	}
+	if owners <= 1 {
+		return false, c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "An organization needs at least one owner"})
+	}
+	return true, nil
+}
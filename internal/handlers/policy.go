@@ -0,0 +1,39 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+
+	"Secure-Document-Exchange-Portal/internal/auth"
+	"Secure-Document-Exchange-Portal/internal/database"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// authorize asks the policy whether the user may take the action, answering
+// the request with 403 if not
+func authorize(c *fiber.Ctx, policy *auth.Policy, userID uuid.UUID, action auth.Action, resource auth.Resource) (bool, error) {
+	err := policy.Authorize(c.Context(), auth.Subject{UserID: userID}, action, resource)
+	if errors.Is(err, auth.ErrForbidden) {
+		return false, c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Access denied"})
+	}
+	if err != nil {
+		log.Printf("Failed to authorize %s for user %s: %v", action, userID, err)
+		return false, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to check permissions"})
+	}
+	return true, nil
+}
+
+// inWorkspace is the resource for documents, folders and other things
+// belonging to a workspace
+func inWorkspace(workspaceID pgtype.UUID) auth.Resource {
+	return auth.Resource{WorkspaceID: workspaceID.Bytes}
+}
+
+// documentResource is the resource for a document: its workspace members
+// and the users it was shared with have access
+func documentResource(doc database.Document) auth.Resource {
+	return auth.Resource{WorkspaceID: doc.WorkspaceID.Bytes, DocumentID: doc.ID.Bytes}
+}
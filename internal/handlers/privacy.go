@@ -0,0 +1,323 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"Secure-Document-Exchange-Portal/internal/auth"
+	"Secure-Document-Exchange-Portal/internal/database"
+	"Secure-Document-Exchange-Portal/internal/models"
+	"Secure-Document-Exchange-Portal/internal/services"
+	"Secure-Document-Exchange-Portal/templates"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/minio/minio-go/v7"
+)
+
+// PrivacyHandler serves data subject requests: exporting everything the
+// portal holds about the current user, and deleting their account after a
+// grace period in which they can change their mind
+type PrivacyHandler struct {
+	db       *database.Queries
+	cache    *services.CachedRepository
+	storage  services.StorageService
+	privacy  *services.PrivacyService
+	notifier services.Notifier
+	audit    *services.AuditLog
+}
+
+func NewPrivacyHandler(db *database.Queries, cache *services.CachedRepository, storage services.StorageService, privacy *services.PrivacyService, notifier services.Notifier, audit *services.AuditLog) *PrivacyHandler {
+	return &PrivacyHandler{
+		db:       db,
+		cache:    cache,
+		storage:  storage,
+		privacy:  privacy,
+		notifier: notifier,
+		audit:    audit,
+	}
+}
+
+// RequestExport starts building an archive of the current user's data in
+// the background. Only one export runs at a time.
+func (h *PrivacyHandler) RequestExport(c *fiber.Ctx) error {
+	userID, err := auth.GetUserID(c)
+	if err != nil {
+		return err
+	}
+
+	export, err := h.db.CreateDataExport(c.Context(), pgtype.UUID{Bytes: userID, Valid: true})
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			return mfaError(c, fiber.StatusConflict, "An export of your data is already being prepared")
+		}
+		return mfaError(c, fiber.StatusInternalServerError, "Failed to request the export")
+	}
+	if err := h.privacy.QueueExport(c.Context(), export); err != nil {
+		return mfaError(c, fiber.StatusInternalServerError, "Failed to request the export")
+	}
+
+	recordAudit(c, h.audit, dataExportEvent(services.AuditDataExportRequested, export))
+
+	if c.Get("HX-Request") == "true" {
+		c.Set("HX-Trigger", "data-export-requested")
+		return c.SendString("")
+	}
+	return c.Status(fiber.StatusAccepted).JSON(dataExportJSON(export))
+}
+
+// Exports lists the current user's data exports, newest first
+func (h *PrivacyHandler) Exports(c *fiber.Ctx) error {
+	userID, err := auth.GetUserID(c)
+	if err != nil {
+		return err
+	}
+
+	exports, err := h.db.ListDataExports(c.Context(), pgtype.UUID{Bytes: userID, Valid: true})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to list exports"})
+	}
+
+	if c.Get("Accept") == "text/html" || c.Get("HX-Request") == "true" {
+		var items []templates.DataExportInfo
+		preparing := false
+		for _, export := range exports {
+			item := templates.DataExportInfo{
+				ID:          export.ID.String(),
+				Status:      export.Status,
+				RequestedAt: export.RequestedAt.Time.Format("2006-01-02 15:04"),
+			}
+			if export.Status == services.ExportReady {
+				item.FileSize = services.FormatBytes(export.FileSize)
+				item.ExpiresAt = export.ExpiresAt.Time.Format("2006-01-02 15:04")
+			}
+			if export.Status == services.ExportPending || export.Status == services.ExportRunning {
+				preparing = true
+			}
+			items = append(items, item)
+		}
+		c.Set("Content-Type", "text/html")
+		return templates.DataExportList(items, preparing).Render(c.Context(), c.Response().BodyWriter())
+	}
+
+	result := make([]fiber.Map, 0, len(exports))
+	for _, export := range exports {
+		result = append(result, dataExportJSON(export))
+	}
+	return c.JSON(result)
+}
+
+// DownloadExport sends a finished data export
+func (h *PrivacyHandler) DownloadExport(c *fiber.Ctx) error {
+	userID, err := auth.GetUserID(c)
+	if err != nil {
+		return err
+	}
+
+	exportID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid export ID"})
+	}
+
+	export, err := h.db.GetDataExport(c.Context(), database.GetDataExportParams{
+		ID:     pgtype.UUID{Bytes: exportID, Valid: true},
+		UserID: pgtype.UUID{Bytes: userID, Valid: true},
+	})
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Export not found"})
+	}
+	if export.Status != services.ExportReady {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Export is not ready"})
+	}
+	if export.ExpiresAt.Time.Before(time.Now()) {
+		return c.Status(fiber.StatusGone).JSON(fiber.Map{"error": "Export has expired"})
+	}
+
+	obj, err := h.storage.Download(c.Context(), "documents", export.FilePath.String, minio.GetObjectOptions{})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to download export from storage"})
+	}
+
+	recordAudit(c, h.audit, dataExportEvent(services.AuditDataExportDownloaded, export))
+
+	name := fmt.Sprintf("data-export-%s.zip", export.RequestedAt.Time.UTC().Format("2006-01-02"))
+	c.Set("Content-Type", "application/zip")
+	c.Set("Content-Disposition", contentDisposition("attachment", name))
+
+	// The response closes obj once it has been sent
+	return c.SendStream(obj, int(export.FileSize))
+}
+
+// Deletion shows whether the current user's account is due to be deleted
+func (h *PrivacyHandler) Deletion(c *fiber.Ctx) error {
+	userID, err := auth.GetUserID(c)
+	if err != nil {
+		return err
+	}
+
+	user, err := h.db.GetUserByID(c.Context(), pgtype.UUID{Bytes: userID, Valid: true})
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
+	}
+
+	if c.Get("Accept") == "text/html" || c.Get("HX-Request") == "true" {
+		c.Set("Content-Type", "text/html")
+		return templates.AccountDeletion(
+			user.DeleteAfter.Valid,
+			user.DeleteAfter.Time.Format("2006-01-02 15:04"),
+			int(h.privacy.GracePeriod().Hours()/24),
+		).Render(c.Context(), c.Response().BodyWriter())
+	}
+	return c.JSON(accountDeletionJSON(user))
+}
+
+// RequestDeletion schedules the deletion of the current user's account at
+// the end of the grace period. The user confirms by typing their email
+// address. Accounts under legal hold, and the only owners of an
+// organization, cannot be deleted.
+func (h *PrivacyHandler) RequestDeletion(c *fiber.Ctx) error {
+	userID, err := auth.GetUserID(c)
+	if err != nil {
+		return err
+	}
+
+	var req models.DeleteAccountRequest
+	if err := c.BodyParser(&req); err != nil {
+		return mfaError(c, fiber.StatusBadRequest, "Invalid request body")
+	}
+
+	user, err := h.db.GetUserByID(c.Context(), pgtype.UUID{Bytes: userID, Valid: true})
+	if err != nil {
+		return mfaError(c, fiber.StatusNotFound, "User not found")
+	}
+	if !strings.EqualFold(strings.TrimSpace(req.ConfirmEmail), user.Email) {
+		return mfaError(c, fiber.StatusBadRequest, "Type your email address to confirm")
+	}
+	if user.DeleteAfter.Valid {
+		return mfaError(c, fiber.StatusConflict, "Your account is already due to be deleted")
+	}
+
+	var retained *services.RetentionError
+	switch err := h.privacy.CheckDeletable(c.Context(), user.ID); {
+	case errors.Is(err, services.ErrLegalHold):
+		recordAudit(c, h.audit, services.AuditEvent{
+			Action:       services.AuditLegalHoldBlocked,
+			ResourceType: "user",
+			ResourceID:   user.ID.String(),
+			Details:      map[string]string{"attempt": "delete account"},
+		})
+		return mfaError(c, fiber.StatusConflict, "Your account or some of your data is under legal hold and cannot be deleted")
+	case errors.As(err, &retained):
+		return mfaError(c, fiber.StatusConflict, "Some of your documents must be kept until "+retained.Until.UTC().Format("2006-01-02")+" under a retention policy and cannot be deleted yet")
+	case errors.Is(err, services.ErrSoleOwner):
+		return mfaError(c, fiber.StatusConflict, "You are the only owner of an organization. Make someone else an owner first.")
+	case err != nil:
+		return mfaError(c, fiber.StatusInternalServerError, "Failed to check whether the account can be deleted")
+	}
+
+	deleteAt := time.Now().Add(h.privacy.GracePeriod())
+	user, err = h.db.ScheduleUserDeletion(c.Context(), database.ScheduleUserDeletionParams{
+		ID:          user.ID,
+		DeleteAfter: pgtype.Timestamptz{Time: deleteAt, Valid: true},
+	})
+	if err != nil {
+		return mfaError(c, fiber.StatusInternalServerError, "Failed to schedule the deletion")
+	}
+	h.cache.InvalidateUser(c.Context(), userID, user.Email)
+
+	recordAudit(c, h.audit, services.AuditEvent{
+		Action:       services.AuditDeletionRequested,
+		ResourceType: "user",
+		ResourceID:   user.ID.String(),
+		Details:      map[string]string{"delete_after": deleteAt.Format(time.RFC3339)},
+	})
+	err = h.notifier.Notify(c.Context(), services.Notification{
+		UserID:  userID,
+		Email:   user.Email,
+		Event:   services.EventAccountDeletion,
+		Subject: "Your account will be deleted",
+		Body: fmt.Sprintf("As you asked, your account, documents and shares will be deleted on %s. Sign in and cancel the deletion before then if you change your mind.",
+			deleteAt.UTC().Format("2006-01-02 15:04 MST")),
+		Data: map[string]string{
+			"delete_after": deleteAt.Format(time.RFC3339),
+		},
+	})
+	if err != nil {
+		log.Printf("Failed to notify user %s about their account deletion: %v", user.ID.String(), err)
+	}
+
+	if c.Get("HX-Request") == "true" {
+		c.Set("HX-Trigger", "account-deletion-changed")
+		return c.SendString("")
+	}
+	return c.Status(fiber.StatusAccepted).JSON(accountDeletionJSON(user))
+}
+
+// CancelDeletion keeps the current user's account after all
+func (h *PrivacyHandler) CancelDeletion(c *fiber.Ctx) error {
+	userID, err := auth.GetUserID(c)
+	if err != nil {
+		return err
+	}
+
+	user, err := h.db.CancelUserDeletion(c.Context(), pgtype.UUID{Bytes: userID, Valid: true})
+	if err != nil {
+		return mfaError(c, fiber.StatusNotFound, "Your account is not due to be deleted")
+	}
+	h.cache.InvalidateUser(c.Context(), userID, user.Email)
+
+	recordAudit(c, h.audit, services.AuditEvent{
+		Action:       services.AuditDeletionCanceled,
+		ResourceType: "user",
+		ResourceID:   user.ID.String(),
+	})
+
+	if c.Get("HX-Request") == "true" {
+		c.Set("HX-Trigger", "account-deletion-changed")
+		return c.SendString("")
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// dataExportEvent is an audit event about a data export
+func dataExportEvent(action string, export database.DataExport) services.AuditEvent {
+	return services.AuditEvent{
+		Action:       action,
+		ResourceType: "data_export",
+		ResourceID:   export.ID.String(),
+	}
+}
+
+func dataExportJSON(export database.DataExport) fiber.Map {
+	item := fiber.Map{
+		"id":           export.ID.String(),
+		"status":       export.Status,
+		"requested_at": export.RequestedAt.Time.Format(time.RFC3339),
+	}
+	if export.CompletedAt.Valid {
+		item["completed_at"] = export.CompletedAt.Time.Format(time.RFC3339)
+	}
+	if export.Status == services.ExportReady {
+		item["file_size"] = export.FileSize
+		item["expires_at"] = export.ExpiresAt.Time.Format(time.RFC3339)
+		item["download_url"] = "/api/account/exports/" + export.ID.String() + "/download"
+	}
+	if export.Error.Valid {
+		item["error"] = export.Error.String
+	}
+	return item
+}
+
+func accountDeletionJSON(user database.User) fiber.Map {
+	item := fiber.Map{"scheduled": user.DeleteAfter.Valid}
+	if user.DeleteAfter.Valid {
+		item["delete_after"] = user.DeleteAfter.Time.Format(time.RFC3339)
+	}
+	return item
+}
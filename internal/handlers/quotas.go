@@ -0,0 +1,40 @@
+package handlers
+
+import (
+	"Secure-Document-Exchange-Portal/internal/services"
+	"Secure-Document-Exchange-Portal/templates"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// storageUsage answers with the storage usage of an account, as the usage
+// bar for HTMX requests
+func storageUsage(c *fiber.Ctx, usage services.Usage) error {
+	if c.Get("Accept") == "text/html" || c.Get("HX-Request") == "true" {
+		c.Set("Content-Type", "text/html")
+		return templates.StorageUsage(templates.StorageUsageInfo{
+			Plan:           usage.Plan,
+			Used:           services.FormatBytes(usage.UsedBytes),
+			Quota:          services.FormatBytes(usage.QuotaBytes),
+			DocumentCount:  usage.DocumentCount,
+			QuotaDocuments: usage.QuotaDocuments,
+			Percent:        int(min(usage.Fraction(), 1) * 100),
+			Warning:        usage.Warning(),
+			Critical:       usage.Critical(),
+		}).Render(c.Context(), c.Response().BodyWriter())
+	}
+
+	return c.JSON(usageJSON(usage))
+}
+
+func usageJSON(usage services.Usage) fiber.Map {
+	return fiber.Map{
+		"plan":            usage.Plan,
+		"used_bytes":      usage.UsedBytes,
+		"quota_bytes":     usage.QuotaBytes,
+		"document_count":  usage.DocumentCount,
+		"quota_documents": usage.QuotaDocuments,
+		"percent_used":    int(usage.Fraction() * 100),
+		"warning":         usage.Warning(),
+	}
+}
@@ -0,0 +1,309 @@
+package handlers
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"Secure-Document-Exchange-Portal/internal/auth"
+	"Secure-Document-Exchange-Portal/internal/database"
+	"Secure-Document-Exchange-Portal/internal/models"
+	"Secure-Document-Exchange-Portal/internal/services"
+	"Secure-Document-Exchange-Portal/internal/validation"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// defaultRetentionWarnDays is how many days before deletion uploaders are
+// warned unless a policy says otherwise
+const defaultRetentionWarnDays = 14
+
+type RetentionHandler struct {
+	db        *database.Queries
+	policy    *auth.Policy
+	retention *services.RetentionService
+	audit     *services.AuditLog
+}
+
+func NewRetentionHandler(db *database.Queries, policy *auth.Policy, retention *services.RetentionService, audit *services.AuditLog) *RetentionHandler {
+	return &RetentionHandler{
+		db:        db,
+		policy:    policy,
+		retention: retention,
+		audit:     audit,
+	}
+}
+
+// List returns the retention policies of a workspace
+func (h *RetentionHandler) List(c *fiber.Ctx) error {
+	workspace, ok, err := loadWorkspace(c, h.db, h.policy, auth.ActionWorkspaceRead)
+	if !ok {
+		return err
+	}
+
+	policies, err := h.db.ListRetentionPolicies(c.Context(), workspace.ID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to list retention policies"})
+	}
+
+	result := make([]fiber.Map, 0, len(policies))
+	for _, policy := range policies {
+		result = append(result, retentionPolicyJSON(policy))
+	}
+	return c.JSON(result)
+}
+
+// Create adds a retention policy for the whole workspace, one of its
+// folders with the folders inside it, or documents with a tag. There is
+// one policy per workspace, folder and tag.
+func (h *RetentionHandler) Create(c *fiber.Ctx) error {
+	userID, err := auth.GetUserID(c)
+	if err != nil {
+		return err
+	}
+	workspace, ok, err := loadWorkspace(c, h.db, h.policy, auth.ActionWorkspaceManage)
+	if !ok {
+		return err
+	}
+
+	var req models.RetentionPolicyRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	months, days, warnDays, err := retentionPeriod(req)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	arg := database.CreateRetentionPolicyParams{
+		WorkspaceID:  workspace.ID,
+		RetainMonths: months,
+		RetainDays:   days,
+		WarnDays:     warnDays,
+		CreatedBy:    pgtype.UUID{Bytes: userID, Valid: true},
+	}
+	tag := strings.TrimSpace(req.Tag)
+	switch {
+	case req.FolderID != "" && tag != "":
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Give either a folder ID or a tag, not both"})
+
+	case req.FolderID != "":
+		folderID, err := uuid.Parse(req.FolderID)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid folder ID"})
+		}
+		folder, err := h.db.GetFolderByID(c.Context(), pgtype.UUID{Bytes: folderID, Valid: true})
+		if err != nil || folder.WorkspaceID != workspace.ID {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Folder not found"})
+		}
+		arg.FolderID = folder.ID
+
+	case tag != "":
+		if err := validation.ValidateTags([]string{tag}); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		}
+		arg.Tag = pgtype.Text{String: tag, Valid: true}
+	}
+
+	policy, err := h.db.CreateRetentionPolicy(c.Context(), arg)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "A retention policy for this scope already exists"})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to create retention policy"})
+	}
+	recordAudit(c, h.audit, retentionPolicyEvent(services.AuditRetentionPolicyCreated, policy))
+
+	return c.Status(fiber.StatusCreated).JSON(retentionPolicyJSON(policy))
+}
+
+// Update changes the retention period and warning of a policy. Documents
+// already warned under the old period are warned again if their due date
+// moves.
+func (h *RetentionHandler) Update(c *fiber.Ctx) error {
+	workspace, ok, err := loadWorkspace(c, h.db, h.policy, auth.ActionWorkspaceManage)
+	if !ok {
+		return err
+	}
+
+	policyID, err := uuid.Parse(c.Params("policyId"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid policy ID"})
+	}
+
+	var req models.RetentionPolicyRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	months, days, warnDays, err := retentionPeriod(req)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	policy, err := h.db.UpdateRetentionPolicy(c.Context(), database.UpdateRetentionPolicyParams{
+		ID:           pgtype.UUID{Bytes: policyID, Valid: true},
+		WorkspaceID:  workspace.ID,
+		RetainMonths: months,
+		RetainDays:   days,
+		WarnDays:     warnDays,
+	})
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Retention policy not found"})
+	}
+	recordAudit(c, h.audit, retentionPolicyEvent(services.AuditRetentionPolicyUpdated, policy))
+
+	return c.JSON(retentionPolicyJSON(policy))
+}
+
+// Delete removes a retention policy. Its documents are kept, unless a less
+// specific policy covers them.
+func (h *RetentionHandler) Delete(c *fiber.Ctx) error {
+	workspace, ok, err := loadWorkspace(c, h.db, h.policy, auth.ActionWorkspaceManage)
+	if !ok {
+		return err
+	}
+
+	policyID, err := uuid.Parse(c.Params("policyId"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid policy ID"})
+	}
+
+	policy, err := h.db.DeleteRetentionPolicy(c.Context(), database.DeleteRetentionPolicyParams{
+		ID:          pgtype.UUID{Bytes: policyID, Valid: true},
+		WorkspaceID: workspace.ID,
+	})
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Retention policy not found"})
+	}
+	recordAudit(c, h.audit, retentionPolicyEvent(services.AuditRetentionPolicyDeleted, policy))
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// Report is the dry run of the retention job: the documents of a workspace
+// that will be deleted within the given number of days (30 by default),
+// including overdue ones, soonest first. Documents under legal hold are
+// listed as held and kept until the hold is released. Nothing is changed.
+func (h *RetentionHandler) Report(c *fiber.Ctx) error {
+	workspace, ok, err := loadWorkspace(c, h.db, h.policy, auth.ActionDocumentList)
+	if !ok {
+		return err
+	}
+
+	days := 30
+	if value := c.Query("days"); value != "" {
+		days, err = strconv.Atoi(value)
+		if err != nil || days < 0 || days > 36500 {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "days must be between 0 and 36500"})
+		}
+	}
+
+	now := time.Now()
+	until := now.AddDate(0, 0, days)
+	items, err := h.retention.Plan(c.Context(), workspace.ID, until)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to plan retention"})
+	}
+
+	documents := make([]fiber.Map, 0, len(items))
+	for _, item := range items {
+		documents = append(documents, fiber.Map{
+			"document_id": item.DocumentID.String(),
+			"filename":    item.Filename,
+			"uploaded_by": item.UserID.String(),
+			"policy_id":   item.PolicyID.String(),
+			"due_at":      item.DueAt.Format(time.RFC3339),
+			"delete_at":   item.DeleteAt.Format(time.RFC3339),
+			"warned":      item.Warned,
+			"held":        item.Held,
+			"overdue":     !now.Before(item.DeleteAt),
+		})
+	}
+	return c.JSON(fiber.Map{
+		"workspace_id": workspace.ID.String(),
+		"generated_at": now.UTC().Format(time.RFC3339),
+		"until":        until.UTC().Format(time.RFC3339),
+		"count":        len(documents),
+		"documents":    documents,
+	})
+}
+
+// retentionPeriod checks the period and warning of a policy request and
+// returns them as stored
+func retentionPeriod(req models.RetentionPolicyRequest) (int32, int32, int32, error) {
+	if req.Years < 0 || req.Years > 100 {
+		return 0, 0, 0, errors.New("retention period is too long (max 100 years)")
+	}
+	months := req.Years*12 + req.Months
+	warnDays := defaultRetentionWarnDays
+	if req.WarnDays != nil {
+		warnDays = *req.WarnDays
+	}
+	if err := validation.ValidateRetention(months, req.Days, warnDays); err != nil {
+		return 0, 0, 0, err
+	}
+	return int32(months), int32(req.Days), int32(warnDays), nil
+}
+
+// retentionPolicyEvent is an audit event about a retention policy
+func retentionPolicyEvent(action string, policy database.RetentionPolicy) services.AuditEvent {
+	details := map[string]string{
+		"workspace_id": policy.WorkspaceID.String(),
+		"retain_for":   services.RetentionPeriod(policy.RetainMonths, policy.RetainDays),
+		"warn_days":    strconv.Itoa(int(policy.WarnDays)),
+	}
+	if policy.FolderID.Valid {
+		details["folder_id"] = policy.FolderID.String()
+	}
+	if policy.Tag.Valid {
+		details["tag"] = policy.Tag.String
+	}
+	return services.AuditEvent{
+		Action:       action,
+		ResourceType: "retention_policy",
+		ResourceID:   policy.ID.String(),
+		Details:      details,
+	}
+}
+
+func retentionPolicyJSON(policy database.RetentionPolicy) fiber.Map {
+	item := fiber.Map{
+		"id":            policy.ID.String(),
+		"workspace_id":  policy.WorkspaceID.String(),
+		"retain_months": policy.RetainMonths,
+		"retain_days":   policy.RetainDays,
+		"retain_for":    services.RetentionPeriod(policy.RetainMonths, policy.RetainDays),
+		"warn_days":     policy.WarnDays,
+		"created_at":    policy.CreatedAt.Time.Format(time.RFC3339),
+		"updated_at":    policy.UpdatedAt.Time.Format(time.RFC3339),
+	}
+	if policy.FolderID.Valid {
+		item["folder_id"] = policy.FolderID.String()
+	}
+	if policy.Tag.Valid {
+		item["tag"] = policy.Tag.String
+	}
+	return item
+}
+
+// checkDocumentRetention answers 409 Conflict if the retention period of a
+// document has not ended. Retention periods are minimums, so the document
+// cannot be trashed or deleted before then.
+func checkDocumentRetention(c *fiber.Ctx, db *database.Queries, doc database.Document) (bool, error) {
+	until, err := services.RetainedUntil(c.Context(), db, doc.ID, doc.WorkspaceID, time.Now())
+	if err != nil {
+		return false, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to check retention policies"})
+	}
+	if until.IsZero() {
+		return true, nil
+	}
+	return false, c.Status(fiber.StatusConflict).JSON(fiber.Map{
+		"error":          "Document must be kept until " + until.UTC().Format("2006-01-02") + " under the workspace's retention policy",
+		"retained_until": until.Format(time.RFC3339),
+	})
+}
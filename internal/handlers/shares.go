@@ -0,0 +1,1344 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"image/png"
+	"io"
+	"log"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"Secure-Document-Exchange-Portal/internal/auth"
+	"Secure-Document-Exchange-Portal/internal/database"
+	"Secure-Document-Exchange-Portal/internal/middleware"
+	"Secure-Document-Exchange-Portal/internal/models"
+	"Secure-Document-Exchange-Portal/internal/services"
+	"Secure-Document-Exchange-Portal/internal/validation"
+	"Secure-Document-Exchange-Portal/templates"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/minio/minio-go/v7"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Share access log actions
+const (
+	ShareActionOpen             = "open"
+	ShareActionDownload         = "download"
+	ShareActionDownloadZip      = "download_zip"
+	ShareActionView             = "view"
+	ShareActionNetworkDenied    = "network_denied"
+	ShareActionInvalidPassword  = "invalid_password"
+	ShareActionExpired          = "expired"
+	ShareActionLimitReached     = "limit_reached"
+	ShareActionFileLimitReached = "file_limit_reached"
+)
+
+// shareAccessCookie carries the short-lived token that lets a browser fetch
+// the individual files of a bundle after passing the landing page checks.
+const (
+	shareAccessCookie    = "share_access"
+	shareAccessCookieTTL = 1 * time.Hour
+)
+
+// shareViewerWindow is how long after a counted view the pages of a file on a
+// limited share can still be loaded by the viewer
+const shareViewerWindow = 30 * time.Minute
+
+// Owner notification settings for share accesses
+const (
+	ShareNotifyNone  = "none"
+	ShareNotifyFirst = "first"
+	ShareNotifyEvery = "every"
+
+	// Wrong passwords are counted over this window for failure notifications
+	sharePasswordFailureWindow = 15 * time.Minute
+)
+
+type ShareHandler struct {
+	db         *database.Queries
+	storage    services.StorageService
+	cache      *services.CachedRepository
+	policy     *auth.Policy
+	jwtService *auth.JWTService
+	previewer  *services.PreviewRenderer
+	notifier   services.Notifier
+	audit      *services.AuditLog
+}
+
+func NewShareHandler(db *database.Queries, storage services.StorageService, cache *services.CachedRepository, policy *auth.Policy, jwtService *auth.JWTService, previewer *services.PreviewRenderer, notifier services.Notifier, audit *services.AuditLog) *ShareHandler {
+	return &ShareHandler{
+		db:         db,
+		storage:    storage,
+		cache:      cache,
+		policy:     policy,
+		jwtService: jwtService,
+		previewer:  previewer,
+		notifier:   notifier,
+		audit:      audit,
+	}
+}
+
+// sharedDocument is a document reachable through a share, together with the
+// number of times it has been downloaded through that share.
+type sharedDocument struct {
+	ID             uuid.UUID
+	Filename       string
+	FilePath       string
+	FileSize       int64
+	MimeType       string
+	CreatedAt      time.Time
+	DownloadCount  int32
+	LastDownloadAt time.Time
+}
+
+// AccessShare is the public entry point of a share link. Single-document
+// shares download the file directly; bundles and folder shares render a
+// landing page listing their files.
+func (h *ShareHandler) AccessShare(c *fiber.Ctx) error {
+	token := c.Params("token")
+
+	// Use cached repository for share lookup
+	share, err := h.cache.GetShareByToken(c.Context(), token)
+	if err != nil {
+		return sendShareNotFound(c)
+	}
+
+	// Check the network allowlist before revealing anything about the share
+	if !shareNetworkAllowed(c, share) {
+		h.logAccess(c, share, uuid.Nil, ShareActionNetworkDenied)
+		return sendShareNetworkDenied(c)
+	}
+
+	// Check expiration
+	if share.ExpiresAt.Before(time.Now()) {
+		h.logAccess(c, share, uuid.Nil, ShareActionExpired)
+		return sendShareExpired(c)
+	}
+
+	// Check access count
+	if share.MaxAccess != -1 && share.AccessCount >= share.MaxAccess {
+		h.logAccess(c, share, uuid.Nil, ShareActionLimitReached)
+		return sendShareLimitReached(c)
+	}
+
+	docs, err := h.shareDocuments(c.Context(), share)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to load shared files"})
+	}
+	// Documents in the trash are no longer shared; a link to nothing but
+	// trashed documents leads nowhere
+	if share.FolderID == "" && len(docs) == 0 {
+		return sendShareNotFound(c)
+	}
+
+	// Check password if set. View-only shares also ask the recipient for
+	// their email address, which is stamped on every preview.
+	email := ""
+	if share.PasswordHash != nil || share.ViewOnly {
+		subject := shareSubject(share, docs)
+		askPassword := share.PasswordHash != nil
+
+		password := c.FormValue("password")
+		if password == "" {
+			password = c.Query("password")
+		}
+		email = strings.TrimSpace(c.FormValue("email"))
+
+		if (askPassword && password == "") || (share.ViewOnly && email == "") {
+			// Show password form
+			errorMsg := ""
+			if c.Method() == "POST" {
+				if askPassword && password == "" {
+					errorMsg = `<p style="color: #c00; margin-bottom: 15px;">❌ Password is required</p>`
+				} else {
+					errorMsg = `<p style="color: #c00; margin-bottom: 15px;">❌ Email is required</p>`
+				}
+			}
+			return sendSharePasswordForm(c, subject, errorMsg, askPassword, share.ViewOnly)
+		}
+
+		if share.ViewOnly {
+			if err := validation.ValidateEmail(email); err != nil {
+				errorMsg := fmt.Sprintf(`<p style="color: #c00; margin-bottom: 15px;">❌ %s</p>`, html.EscapeString(err.Error()))
+				return sendSharePasswordForm(c, subject, errorMsg, askPassword, share.ViewOnly)
+			}
+		}
+
+		// Check password hash using bcrypt
+		if askPassword {
+			if err := bcrypt.CompareHashAndPassword([]byte(*share.PasswordHash), []byte(password)); err != nil {
+				h.logAccess(c, share, uuid.Nil, ShareActionInvalidPassword)
+				h.notifyPasswordFailures(c, share)
+				errorMsg := `<p style="color: #c00; margin-bottom: 15px;">❌ Invalid password. Please try again.</p>`
+				return sendSharePasswordForm(c, subject, errorMsg, askPassword, share.ViewOnly)
+			}
+		}
+	}
+
+	// Update access count (and invalidate cache after update). The update
+	// only counts accesses below the limit, so concurrent requests that got
+	// past the check against the cached count are refused here.
+	shareID, err := uuid.Parse(share.ID)
+	if err != nil {
+		return sendShareNotFound(c)
+	}
+	accessCount, err := h.db.UpdateShareAccess(c.Context(), pgtype.UUID{Bytes: shareID, Valid: true})
+	// Invalidate the share cache since access count changed
+	h.cache.InvalidateShare(c.Context(), token)
+	// The access that used up the limit has told the owner already
+	if errors.Is(err, pgx.ErrNoRows) {
+		h.logAccess(c, share, uuid.Nil, ShareActionLimitReached)
+		return sendShareLimitReached(c)
+	}
+	if err != nil {
+		log.Printf("Failed to update share access count: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to record access"})
+	}
+	h.notifyAccess(c, share, accessCount.Int32)
+
+	// Single-document shares keep their direct download behaviour
+	if share.FolderID == "" && len(docs) == 1 && !share.ViewOnly {
+		h.logAccess(c, share, docs[0].ID, ShareActionDownload)
+		return h.sendSharedFile(c, docs[0], "attachment")
+	}
+
+	h.logAccess(c, share, uuid.Nil, ShareActionOpen)
+
+	accessToken, err := h.jwtService.GenerateShareAccessToken(shareID, email, shareAccessCookieTTL)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to generate access token"})
+	}
+	isProduction := os.Getenv("APP_ENV") == "production"
+	c.Cookie(&fiber.Cookie{
+		Name:     shareAccessCookie,
+		Value:    accessToken,
+		Path:     "/api/share/" + token,
+		HTTPOnly: true,
+		Secure:   isProduction,
+		SameSite: "Strict",
+		MaxAge:   int(shareAccessCookieTTL.Seconds()),
+	})
+
+	landing := templates.ShareLanding{
+		Token:     share.ShareToken,
+		Name:      share.Name,
+		ExpiresAt: share.ExpiresAt.Format("2006-01-02 15:04 MST"),
+		ViewOnly:  share.ViewOnly,
+	}
+	for _, doc := range docs {
+		landing.Files = append(landing.Files, templates.SharedFile{
+			ID:          doc.ID.String(),
+			Filename:    doc.Filename,
+			FileSize:    doc.FileSize,
+			MimeType:    doc.MimeType,
+			Available:   share.MaxAccess == -1 || doc.DownloadCount < share.MaxAccess,
+			Previewable: services.IsPreviewable(doc.MimeType),
+		})
+	}
+
+	c.Set("Content-Type", "text/html")
+	return templates.ShareLandingPage(landing).Render(c.Context(), c.Response().BodyWriter())
+}
+
+// DownloadFile downloads a single file of a bundle. The per-file download
+// count is limited by the share's max_access.
+func (h *ShareHandler) DownloadFile(c *fiber.Ctx) error {
+	share, shareID, _, err := h.authorizeBundleAccess(c)
+	if err != nil {
+		return err
+	}
+
+	if share.ViewOnly {
+		return sendShareDownloadDisabled(c)
+	}
+
+	docID, err := uuid.Parse(c.Params("docId"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid document ID"})
+	}
+
+	docs, err := h.shareDocuments(c.Context(), share)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to load shared files"})
+	}
+
+	var doc *sharedDocument
+	for i := range docs {
+		if docs[i].ID == docID {
+			doc = &docs[i]
+			break
+		}
+	}
+	if doc == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "File not found in this share"})
+	}
+
+	recorded, err := h.db.RecordShareDocumentDownload(c.Context(), database.RecordShareDocumentDownloadParams{
+		ShareID:      pgtype.UUID{Bytes: shareID, Valid: true},
+		DocumentID:   pgtype.UUID{Bytes: docID, Valid: true},
+		MaxDownloads: share.MaxAccess,
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to record download"})
+	}
+	if recorded == 0 {
+		h.logAccess(c, share, docID, ShareActionFileLimitReached)
+		return sendShareLimitReached(c)
+	}
+
+	h.logAccess(c, share, docID, ShareActionDownload)
+	return h.sendSharedFile(c, *doc, "attachment")
+}
+
+// DownloadZip streams every file of a bundle that is still under its
+// download limit as a single ZIP archive, without buffering it in memory.
+func (h *ShareHandler) DownloadZip(c *fiber.Ctx) error {
+	share, shareID, _, err := h.authorizeBundleAccess(c)
+	if err != nil {
+		return err
+	}
+
+	if share.ViewOnly {
+		return sendShareDownloadDisabled(c)
+	}
+
+	docs, err := h.shareDocuments(c.Context(), share)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to load shared files"})
+	}
+
+	// Files are opened before their download is counted, so a file storage
+	// cannot read does not use up a download
+	var files []archiveFile
+	closeFiles := func() {
+		for _, file := range files {
+			file.obj.Close()
+		}
+	}
+	for _, doc := range docs {
+		file, err := openArchiveFile(h.storage, doc)
+		if err != nil {
+			log.Printf("Failed to read %s for share archive: %v", doc.FilePath, err)
+			continue
+		}
+
+		recorded, err := h.db.RecordShareDocumentDownload(c.Context(), database.RecordShareDocumentDownloadParams{
+			ShareID:      pgtype.UUID{Bytes: shareID, Valid: true},
+			DocumentID:   pgtype.UUID{Bytes: doc.ID, Valid: true},
+			MaxDownloads: share.MaxAccess,
+		})
+		if err != nil {
+			file.obj.Close()
+			closeFiles()
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to record download"})
+		}
+		if recorded == 0 {
+			file.obj.Close()
+			continue
+		}
+		files = append(files, file)
+	}
+
+	if len(files) == 0 {
+		h.logAccess(c, share, uuid.Nil, ShareActionFileLimitReached)
+		return sendShareLimitReached(c)
+	}
+
+	h.logAccess(c, share, uuid.Nil, ShareActionDownloadZip)
+	for _, file := range files {
+		h.logAccess(c, share, file.doc.ID, ShareActionDownload)
+	}
+
+	archiveName := "shared-documents.zip"
+	if share.Name != "" {
+		archiveName = share.Name + ".zip"
+	}
+
+	c.Set("Content-Type", "application/zip")
+	c.Set("Content-Disposition", contentDisposition("attachment", archiveName))
+
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		defer closeFiles()
+		zw := zip.NewWriter(w)
+		names := make(map[string]int)
+
+		for _, file := range files {
+			entry, err := zw.CreateHeader(&zip.FileHeader{
+				Name:     uniqueArchiveName(names, file.doc.Filename),
+				Method:   zip.Deflate,
+				Modified: file.doc.CreatedAt,
+			})
+			if err == nil {
+				_, err = io.Copy(entry, file.reader)
+			}
+			if err != nil {
+				log.Printf("Failed to stream %s into share archive: %v", file.doc.FilePath, err)
+				return
+			}
+
+			if err := w.Flush(); err != nil {
+				// Client went away
+				return
+			}
+		}
+
+		if err := zw.Close(); err != nil {
+			log.Printf("Failed to finish share archive: %v", err)
+			return
+		}
+		w.Flush()
+	})
+
+	return nil
+}
+
+// archiveFile is a shared file opened for the share archive
+type archiveFile struct {
+	doc    sharedDocument
+	obj    io.ReadCloser
+	reader *bufio.Reader
+}
+
+// openArchiveFile opens a shared file for the share archive, which is
+// written after the handler returns. The first byte is read ahead, since
+// storage may only report a missing object once it is read.
+func openArchiveFile(storage services.StorageService, doc sharedDocument) (archiveFile, error) {
+	obj, err := storage.Download(context.Background(), "documents", doc.FilePath, minio.GetObjectOptions{})
+	if err != nil {
+		return archiveFile{}, err
+	}
+	reader := bufio.NewReader(obj)
+	if _, err := reader.Peek(1); err != nil && !errors.Is(err, io.EOF) {
+		obj.Close()
+		return archiveFile{}, err
+	}
+	return archiveFile{doc: doc, obj: obj, reader: reader}, nil
+}
+
+// ViewFile opens the in-page viewer for a shared image or PDF. Opening the
+// viewer counts towards the file's download limit.
+func (h *ShareHandler) ViewFile(c *fiber.Ctx) error {
+	share, shareID, _, err := h.authorizeBundleAccess(c)
+	if err != nil {
+		return err
+	}
+
+	doc, err := h.findSharedDocument(c, share)
+	if err != nil {
+		return err
+	}
+
+	if !services.IsPreviewable(doc.MimeType) {
+		return c.Status(fiber.StatusUnsupportedMediaType).JSON(fiber.Map{"error": "Preview not available for this file type"})
+	}
+
+	data, err := h.readSharedFile(c.Context(), doc)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to load file"})
+	}
+
+	pages, err := h.previewer.PageCount(data, doc.MimeType)
+	if err != nil {
+		log.Printf("Failed to prepare preview of %s: %v", doc.FilePath, err)
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{"error": "Failed to render preview"})
+	}
+
+	recorded, err := h.db.RecordShareDocumentDownload(c.Context(), database.RecordShareDocumentDownloadParams{
+		ShareID:      pgtype.UUID{Bytes: shareID, Valid: true},
+		DocumentID:   pgtype.UUID{Bytes: doc.ID, Valid: true},
+		MaxDownloads: share.MaxAccess,
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to record access"})
+	}
+	if recorded == 0 {
+		h.logAccess(c, share, doc.ID, ShareActionFileLimitReached)
+		return sendShareLimitReached(c)
+	}
+
+	h.logAccess(c, share, doc.ID, ShareActionView)
+
+	c.Set("Content-Type", "text/html")
+	c.Set("Cache-Control", "no-store")
+	return templates.ShareViewerPage(templates.ShareViewer{
+		Token:    share.ShareToken,
+		DocID:    doc.ID.String(),
+		Filename: doc.Filename,
+		Pages:    pages,
+	}).Render(c.Context(), c.Response().BodyWriter())
+}
+
+// ViewPage renders one page of a shared document as a PNG watermarked with
+// the recipient's email, IP address and the current time.
+func (h *ShareHandler) ViewPage(c *fiber.Ctx) error {
+	share, _, claims, err := h.authorizeBundleAccess(c)
+	if err != nil {
+		return err
+	}
+
+	doc, err := h.findSharedDocument(c, share)
+	if err != nil {
+		return err
+	}
+
+	page, err := c.ParamsInt("page")
+	if err != nil || page < 1 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid page"})
+	}
+
+	// Pages are not counted on their own. Once the file's limit is used up,
+	// only the viewer opened by the last counted view may keep loading them,
+	// and only for a short while.
+	if share.MaxAccess != -1 && doc.DownloadCount >= share.MaxAccess &&
+		time.Since(doc.LastDownloadAt) > shareViewerWindow {
+		h.logAccess(c, share, doc.ID, ShareActionFileLimitReached)
+		return sendShareLimitReached(c)
+	}
+
+	data, err := h.readSharedFile(c.Context(), doc)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to load file"})
+	}
+
+	recipient := claims.Email
+	if recipient == "" {
+		recipient = "Anonymous recipient"
+	}
+	img, err := h.previewer.RenderPage(data, doc.MimeType, page, services.Watermark{
+		Lines: []string{
+			recipient,
+			fmt.Sprintf("%s · %s", middleware.ClientIP(c), time.Now().UTC().Format("2006-01-02 15:04 UTC")),
+		},
+	})
+	if err != nil {
+		log.Printf("Failed to render page %d of %s: %v", page, doc.FilePath, err)
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{"error": "Failed to render page"})
+	}
+
+	h.logAccess(c, share, doc.ID, ShareActionView)
+
+	c.Set("Content-Type", "image/png")
+	c.Set("Content-Disposition", "inline")
+	c.Set("Cache-Control", "no-store")
+	return png.Encode(c.Response().BodyWriter(), img)
+}
+
+// CreateBundle creates a share link for several documents at once
+func (h *ShareHandler) CreateBundle(c *fiber.Ctx) error {
+	userID, err := auth.GetUserID(c)
+	if err != nil {
+		return err
+	}
+
+	var req models.CreateBundleRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	if len(req.DocumentIDs) == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "At least one document is required"})
+	}
+	if err := validation.ValidateShareBundle(req.Name, len(req.DocumentIDs)); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	var docIDs []uuid.UUID
+	for _, idStr := range req.DocumentIDs {
+		docID, err := uuid.Parse(idStr)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid document ID"})
+		}
+
+		doc, err := h.db.GetDocumentByID(c.Context(), pgtype.UUID{Bytes: docID, Valid: true})
+		if err != nil {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Document not found"})
+		}
+		if ok, err := authorize(c, h.policy, userID, auth.ActionShareCreate, documentResource(doc)); !ok {
+			return err
+		}
+		docIDs = append(docIDs, docID)
+	}
+
+	return issueShare(c, h.db, h.audit, userID, docIDs, uuid.Nil, req.Name)
+}
+
+// CreateFolderShare creates a share link for a folder. The share follows the
+// folder, so documents added later are shared as well.
+func (h *ShareHandler) CreateFolderShare(c *fiber.Ctx) error {
+	userID, err := auth.GetUserID(c)
+	if err != nil {
+		return err
+	}
+
+	folderID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid folder ID"})
+	}
+
+	folder, err := h.db.GetFolderByID(c.Context(), pgtype.UUID{Bytes: folderID, Valid: true})
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Folder not found"})
+	}
+	if ok, err := authorize(c, h.policy, userID, auth.ActionShareCreate, inWorkspace(folder.WorkspaceID)); !ok {
+		return err
+	}
+
+	name := c.FormValue("name")
+	if name == "" {
+		name = folder.Name
+	}
+	if err := validation.ValidateShareBundle(name, 1); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return issueShare(c, h.db, h.audit, userID, nil, folderID, name)
+}
+
+// Revoke deletes a share. Its creator and administrators may revoke it.
+func (h *ShareHandler) Revoke(c *fiber.Ctx) error {
+	userID, err := auth.GetUserID(c)
+	if err != nil {
+		return err
+	}
+
+	shareID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid share ID"})
+	}
+
+	share, err := h.db.GetShareByID(c.Context(), pgtype.UUID{Bytes: shareID, Valid: true})
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Share not found"})
+	}
+	if ok, err := authorize(c, h.policy, userID, auth.ActionShareRevoke, auth.Resource{OwnerID: share.CreatedBy.Bytes}); !ok {
+		return err
+	}
+
+	err = h.db.DeleteShare(c.Context(), database.DeleteShareParams{
+		ID:        pgtype.UUID{Bytes: shareID, Valid: true},
+		CreatedBy: share.CreatedBy,
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to revoke share"})
+	}
+
+	h.cache.InvalidateShare(c.Context(), share.ShareToken)
+	recordAudit(c, h.audit, services.AuditEvent{
+		Action:       services.AuditShareRevoked,
+		ResourceType: "share",
+		ResourceID:   shareID.String(),
+	})
+
+	if c.Get("HX-Request") == "true" {
+		// Lists of shares reload themselves on this event
+		c.Set("HX-Trigger", "shareRevoked")
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// AccessLog lists recent accesses of a share for its creator
+func (h *ShareHandler) AccessLog(c *fiber.Ctx) error {
+	userID, err := auth.GetUserID(c)
+	if err != nil {
+		return err
+	}
+
+	shareID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid share ID"})
+	}
+
+	share, err := h.db.GetShareByID(c.Context(), pgtype.UUID{Bytes: shareID, Valid: true})
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Share not found"})
+	}
+	if ok, err := authorize(c, h.policy, userID, auth.ActionShareRead, auth.Resource{OwnerID: share.CreatedBy.Bytes}); !ok {
+		return err
+	}
+
+	entries, err := h.db.ListShareAccessLogs(c.Context(), database.ListShareAccessLogsParams{
+		ShareID: pgtype.UUID{Bytes: shareID, Valid: true},
+		Limit:   200,
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to load access log"})
+	}
+
+	result := []fiber.Map{}
+	for _, entry := range entries {
+		ip := ""
+		if entry.IpAddress != nil {
+			ip = entry.IpAddress.String()
+		}
+		result = append(result, fiber.Map{
+			"action":      entry.Action,
+			"document_id": entry.DocumentID.String(),
+			"ip_address":  ip,
+			"user_agent":  entry.UserAgent.String,
+			"created_at":  entry.CreatedAt.Time.Format(time.RFC3339),
+		})
+	}
+
+	return c.JSON(result)
+}
+
+// authorizeBundleAccess checks that the share is still valid and that the
+// browser holds an access cookie issued by AccessShare for it.
+func (h *ShareHandler) authorizeBundleAccess(c *fiber.Ctx) (*models.ShareCache, uuid.UUID, *auth.ShareAccessClaims, error) {
+	token := c.Params("token")
+
+	share, err := h.cache.GetShareByToken(c.Context(), token)
+	if err != nil {
+		return nil, uuid.Nil, nil, sendShareNotFound(c)
+	}
+
+	if !shareNetworkAllowed(c, share) {
+		h.logAccess(c, share, uuid.Nil, ShareActionNetworkDenied)
+		return nil, uuid.Nil, nil, sendShareNetworkDenied(c)
+	}
+
+	if share.ExpiresAt.Before(time.Now()) {
+		h.logAccess(c, share, uuid.Nil, ShareActionExpired)
+		return nil, uuid.Nil, nil, sendShareExpired(c)
+	}
+
+	shareID, err := uuid.Parse(share.ID)
+	if err != nil {
+		return nil, uuid.Nil, nil, sendShareNotFound(c)
+	}
+
+	claims, err := h.jwtService.ValidateShareAccessToken(c.Cookies(shareAccessCookie), shareID)
+	if err != nil {
+		// Send the visitor back through the landing page checks
+		return nil, uuid.Nil, nil, c.Redirect("/api/share/" + token)
+	}
+
+	return share, shareID, claims, nil
+}
+
+// shareDocuments resolves the documents a share currently grants access to
+func (h *ShareHandler) shareDocuments(ctx context.Context, share *models.ShareCache) ([]sharedDocument, error) {
+	shareID, err := uuid.Parse(share.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	var docs []sharedDocument
+	if share.FolderID != "" {
+		folderID, err := uuid.Parse(share.FolderID)
+		if err != nil {
+			return nil, err
+		}
+		rows, err := h.db.ListFolderShareDocuments(ctx, database.ListFolderShareDocumentsParams{
+			FolderID: pgtype.UUID{Bytes: folderID, Valid: true},
+			ShareID:  pgtype.UUID{Bytes: shareID, Valid: true},
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, row := range rows {
+			docs = append(docs, sharedDocument{
+				ID:             row.ID.Bytes,
+				Filename:       row.Filename,
+				FilePath:       row.FilePath,
+				FileSize:       row.FileSize,
+				MimeType:       row.MimeType,
+				CreatedAt:      row.CreatedAt.Time,
+				DownloadCount:  row.DownloadCount,
+				LastDownloadAt: row.LastDownloadAt.Time,
+			})
+		}
+		return docs, nil
+	}
+
+	rows, err := h.db.ListShareDocuments(ctx, pgtype.UUID{Bytes: shareID, Valid: true})
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		docs = append(docs, sharedDocument{
+			ID:             row.ID.Bytes,
+			Filename:       row.Filename,
+			FilePath:       row.FilePath,
+			FileSize:       row.FileSize,
+			MimeType:       row.MimeType,
+			CreatedAt:      row.CreatedAt.Time,
+			DownloadCount:  row.DownloadCount,
+			LastDownloadAt: row.LastDownloadAt.Time,
+		})
+	}
+	return docs, nil
+}
+
+// findSharedDocument resolves the :docId parameter to a document of the share
+func (h *ShareHandler) findSharedDocument(c *fiber.Ctx, share *models.ShareCache) (*sharedDocument, error) {
+	docID, err := uuid.Parse(c.Params("docId"))
+	if err != nil {
+		return nil, c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid document ID"})
+	}
+
+	docs, err := h.shareDocuments(c.Context(), share)
+	if err != nil {
+		return nil, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to load shared files"})
+	}
+
+	for i := range docs {
+		if docs[i].ID == docID {
+			return &docs[i], nil
+		}
+	}
+
+	return nil, c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "File not found in this share"})
+}
+
+// readSharedFile loads a shared document into memory for preview rendering
+func (h *ShareHandler) readSharedFile(ctx context.Context, doc *sharedDocument) ([]byte, error) {
+	obj, err := h.storage.Download(ctx, "documents", doc.FilePath, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, err
+	}
+	defer obj.Close()
+
+	// TODO: Decrypt
+	return io.ReadAll(obj)
+}
+
+// sendSharedFile streams a shared document to the client
+func (h *ShareHandler) sendSharedFile(c *fiber.Ctx, doc sharedDocument, disposition string) error {
+	obj, err := h.storage.Download(c.Context(), "documents", doc.FilePath, minio.GetObjectOptions{})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to download file"})
+	}
+	defer obj.Close()
+
+	// TODO: Decrypt
+	c.Set("Content-Type", doc.MimeType)
+	c.Set("Content-Disposition", contentDisposition(disposition, doc.Filename))
+
+	if _, err := io.Copy(c.Response().BodyWriter(), obj); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to read file"})
+	}
+
+	return nil
+}
+
+// logAccess records a share access event in the share's access log and in
+// the audit log. Failures are logged and never block the visitor.
+func (h *ShareHandler) logAccess(c *fiber.Ctx, share *models.ShareCache, docID uuid.UUID, action string) {
+	shareID, err := uuid.Parse(share.ID)
+	if err != nil {
+		return
+	}
+
+	params := database.CreateShareAccessLogParams{
+		ShareID:   pgtype.UUID{Bytes: shareID, Valid: true},
+		Action:    action,
+		UserAgent: pgtype.Text{String: c.Get("User-Agent"), Valid: c.Get("User-Agent") != ""},
+	}
+	if docID != uuid.Nil {
+		params.DocumentID = pgtype.UUID{Bytes: docID, Valid: true}
+	}
+	if ip, err := netip.ParseAddr(middleware.ClientIP(c)); err == nil {
+		params.IpAddress = &ip
+	}
+
+	if err := h.db.CreateShareAccessLog(c.Context(), params); err != nil {
+		log.Printf("Failed to record share access: %v", err)
+	}
+
+	event := services.AuditEvent{
+		Action:       "share." + action,
+		ResourceType: "share",
+		ResourceID:   share.ID,
+	}
+	if docID != uuid.Nil {
+		event.Details = map[string]string{"document_id": docID.String()}
+	}
+	recordAudit(c, h.audit, event)
+}
+
+// notifyAccess tells the owner about a successful access according to the
+// share's notification settings. accessCount includes this access.
+func (h *ShareHandler) notifyAccess(c *fiber.Ctx, share *models.ShareCache, accessCount int32) {
+	name := shareDisplayName(share)
+
+	switch {
+	case share.NotifyOnAccess == ShareNotifyEvery:
+		h.notifyOwner(c, share, services.EventShareAccess,
+			fmt.Sprintf("Your share \"%s\" was opened", name),
+			fmt.Sprintf("Your share \"%s\" was opened (access %d).", name, accessCount))
+	case share.NotifyOnAccess == ShareNotifyFirst && accessCount == 1:
+		h.notifyOwner(c, share, services.EventShareFirstAccess,
+			fmt.Sprintf("Your share \"%s\" was opened for the first time", name),
+			fmt.Sprintf("Your share \"%s\" was opened for the first time.", name))
+	}
+
+	if share.MaxAccess != -1 && accessCount == share.MaxAccess {
+		h.notifyLimitReached(c, share, accessCount)
+	}
+}
+
+// notifyLimitReached tells the owner, if they asked to be told, that the
+// share can no longer be accessed
+func (h *ShareHandler) notifyLimitReached(c *fiber.Ctx, share *models.ShareCache, accessCount int32) {
+	if !share.NotifyOnLimit {
+		return
+	}
+
+	name := shareDisplayName(share)
+	h.notifyOwner(c, share, services.EventShareLimitReached,
+		fmt.Sprintf("Your share \"%s\" reached its access limit", name),
+		fmt.Sprintf("Your share \"%s\" has been opened %d time(s) and can no longer be accessed.", name, accessCount))
+}
+
+// notifyPasswordFailures warns the owner once the number of wrong passwords
+// within the failure window reaches the share's threshold
+func (h *ShareHandler) notifyPasswordFailures(c *fiber.Ctx, share *models.ShareCache) {
+	if share.NotifyPasswordFailures <= 0 {
+		return
+	}
+
+	shareID, err := uuid.Parse(share.ID)
+	if err != nil {
+		return
+	}
+
+	failures, err := h.db.CountRecentShareAccessLogs(c.Context(), database.CountRecentShareAccessLogsParams{
+		ShareID:   pgtype.UUID{Bytes: shareID, Valid: true},
+		Action:    ShareActionInvalidPassword,
+		CreatedAt: pgtype.Timestamptz{Time: time.Now().Add(-sharePasswordFailureWindow), Valid: true},
+	})
+	if err != nil {
+		log.Printf("Failed to count password failures for share %s: %v", share.ID, err)
+		return
+	}
+	if failures != int64(share.NotifyPasswordFailures) {
+		return
+	}
+
+	name := shareDisplayName(share)
+	h.notifyOwner(c, share, services.EventSharePasswordFailures,
+		fmt.Sprintf("Repeated wrong passwords on your share \"%s\"", name),
+		fmt.Sprintf("Someone entered a wrong password for your share \"%s\" %d times in the last %d minutes.",
+			name, failures, int(sharePasswordFailureWindow.Minutes())))
+}
+
+// notifyOwner queues a notification to the share's owner. The recipient's
+// email is resolved by the notification worker, keeping this off the
+// request path.
+func (h *ShareHandler) notifyOwner(c *fiber.Ctx, share *models.ShareCache, event, subject, body string) {
+	ownerID, err := uuid.Parse(share.CreatedBy)
+	if err != nil {
+		return
+	}
+
+	err = h.notifier.Notify(c.Context(), services.Notification{
+		UserID:  ownerID,
+		Event:   event,
+		Subject: subject,
+		Body:    fmt.Sprintf("%s\n\nIP address: %s\nUser agent: %s", body, middleware.ClientIP(c), c.Get("User-Agent")),
+		Data: map[string]string{
+			"share_id":   share.ID,
+			"ip_address": middleware.ClientIP(c),
+		},
+	})
+	if err != nil {
+		log.Printf("Failed to notify owner of share %s: %v", share.ID, err)
+	}
+}
+
+// issueShare validates the share options posted with the request, creates
+// the share for the given documents or folder and renders the result.
+func issueShare(c *fiber.Ctx, db *database.Queries, audit *services.AuditLog, userID uuid.UUID, docIDs []uuid.UUID, folderID uuid.UUID, name string) error {
+	// Parse form fields for expiration, max_access, password
+	expireDaysStr := c.FormValue("expire_days")
+	expireHoursStr := c.FormValue("expire_hours")
+	maxAccessStr := c.FormValue("max_access")
+	password := c.FormValue("password")
+	viewOnly := isChecked(c.FormValue("view_only"))
+
+	// Calculate expiration time (default: 24 hours)
+	expiresAt := time.Now().Add(24 * time.Hour)
+
+	var expireDays, expireHours int
+	if expireDaysStr != "" {
+		fmt.Sscanf(expireDaysStr, "%d", &expireDays)
+	}
+	if expireHoursStr != "" {
+		fmt.Sscanf(expireHoursStr, "%d", &expireHours)
+	}
+
+	// Validate expiration values
+	if expireDays > 0 || expireHours > 0 {
+		if err := validation.ValidateShareExpiration(expireDays, expireHours); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		}
+		totalHours := (expireDays * 24) + expireHours
+		expiresAt = time.Now().Add(time.Duration(totalHours) * time.Hour)
+	}
+
+	// Parse and validate max access count
+	maxAccess := -1
+	if maxAccessStr != "" {
+		fmt.Sscanf(maxAccessStr, "%d", &maxAccess)
+		if err := validation.ValidateShareMaxAccess(maxAccess); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		}
+	}
+
+	// Validate share password if provided
+	if err := validation.ValidateSharePassword(password); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	// View-only shares are rendered in the browser, so every file must have a preview
+	if viewOnly {
+		for _, docID := range docIDs {
+			doc, err := db.GetDocumentByID(c.Context(), pgtype.UUID{Bytes: docID, Valid: true})
+			if err != nil {
+				return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Document not found"})
+			}
+			if !services.IsPreviewable(doc.MimeType) {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": fmt.Sprintf("%s cannot be shared view-only; only images and PDFs can be previewed", doc.Filename)})
+			}
+		}
+	}
+
+	// Restrict the networks the share can be opened from. Without an explicit
+	// list the owner's account default applies.
+	allowedCIDRs, err := validation.ParseCIDRList(c.FormValue("allowed_cidrs"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	if len(allowedCIDRs) == 0 {
+		owner, err := db.GetUserByID(c.Context(), pgtype.UUID{Bytes: userID, Valid: true})
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to load account settings"})
+		}
+		allowedCIDRs = owner.DefaultAllowedCidrs
+	}
+
+	// Owner notification settings
+	notifyOnAccess := c.FormValue("notify_access", ShareNotifyNone)
+	var notifyPasswordFailures, notifyExpiringHours int
+	if v := c.FormValue("notify_password_failures"); v != "" {
+		fmt.Sscanf(v, "%d", &notifyPasswordFailures)
+	}
+	if v := c.FormValue("notify_expiring_hours"); v != "" {
+		fmt.Sscanf(v, "%d", &notifyExpiringHours)
+	}
+	if err := validation.ValidateShareNotifications(notifyOnAccess, notifyPasswordFailures, notifyExpiringHours); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	// Handle password - hash it using bcrypt
+	passwordText := pgtype.Text{Valid: false}
+	if password != "" {
+		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to process password"})
+		}
+		passwordText = pgtype.Text{String: string(hashedPassword), Valid: true}
+	}
+
+	// Generate token
+	shareToken := uuid.New().String()
+
+	share, err := db.CreateShare(c.Context(), database.CreateShareParams{
+		ShareToken:             shareToken,
+		ExpiresAt:              pgtype.Timestamptz{Time: expiresAt, Valid: true},
+		MaxAccess:              pgtype.Int4{Int32: int32(maxAccess), Valid: true},
+		PasswordHash:           passwordText,
+		CreatedBy:              pgtype.UUID{Bytes: userID, Valid: true},
+		FolderID:               pgtype.UUID{Bytes: folderID, Valid: folderID != uuid.Nil},
+		Name:                   pgtype.Text{String: name, Valid: name != ""},
+		ViewOnly:               viewOnly,
+		AllowedCidrs:           allowedCIDRs,
+		NotifyOnAccess:         notifyOnAccess,
+		NotifyOnLimit:          isChecked(c.FormValue("notify_limit")),
+		NotifyPasswordFailures: pgtype.Int4{Int32: int32(notifyPasswordFailures), Valid: notifyPasswordFailures > 0},
+		NotifyExpiringHours:    pgtype.Int4{Int32: int32(notifyExpiringHours), Valid: notifyExpiringHours > 0},
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to create share"})
+	}
+
+	for _, docID := range docIDs {
+		err := db.AddShareDocument(c.Context(), database.AddShareDocumentParams{
+			ShareID:    share.ID,
+			DocumentID: pgtype.UUID{Bytes: docID, Valid: true},
+		})
+		if err != nil {
+			// Don't leave a partially populated share behind
+			_ = db.DeleteShare(c.Context(), database.DeleteShareParams{ID: share.ID, CreatedBy: share.CreatedBy})
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to create share"})
+		}
+	}
+
+	documentIDs := make([]string, 0, len(docIDs))
+	for _, docID := range docIDs {
+		documentIDs = append(documentIDs, docID.String())
+	}
+	recordAudit(c, audit, services.AuditEvent{
+		ActorID:      userID,
+		Action:       services.AuditShareCreated,
+		ResourceType: "share",
+		ResourceID:   share.ID.String(),
+		Details: map[string]string{
+			"document_ids":  strings.Join(documentIDs, ","),
+			"folder_id":     share.FolderID.String(),
+			"expires_at":    share.ExpiresAt.Time.Format(time.RFC3339),
+			"password":      strconv.FormatBool(share.PasswordHash.Valid),
+			"view_only":     strconv.FormatBool(share.ViewOnly),
+			"allowed_cidrs": strings.Join(formatCIDRList(share.AllowedCidrs), ","),
+		},
+	})
+
+	// Check if request expects HTML (HTMX)
+	if c.Get("Accept") == "text/html" || c.Get("HX-Request") == "true" {
+		c.Set("Content-Type", "text/html")
+
+		// Format expiration info
+		duration := time.Until(share.ExpiresAt.Time)
+		days := int(duration.Hours() / 24)
+		hours := int(duration.Hours()) % 24
+
+		var expiryText string
+		if days > 0 && hours > 0 {
+			expiryText = fmt.Sprintf("%d day(s) and %d hour(s)", days, hours)
+		} else if days > 0 {
+			expiryText = fmt.Sprintf("%d day(s)", days)
+		} else {
+			expiryText = fmt.Sprintf("%d hour(s)", hours)
+		}
+
+		accessInfo := ""
+		if maxAccess > 0 {
+			accessInfo = fmt.Sprintf("<p class=\"text-sm\">Max accesses: %d</p>", maxAccess)
+		}
+		if viewOnly {
+			accessInfo += "<p class=\"text-sm\">View only: downloads disabled, previews are watermarked</p>"
+		}
+		if len(allowedCIDRs) > 0 {
+			accessInfo += fmt.Sprintf("<p class=\"text-sm\">Allowed networks: %s</p>", html.EscapeString(formatCIDRs(allowedCIDRs)))
+		}
+
+		return c.SendString(fmt.Sprintf(`<div class="p-4 bg-green-100 border border-green-400 text-green-700 rounded">
+		<p class="font-semibold">✓ Share link created successfully!</p>
+		<p class="text-sm mt-1">Expires in: %s</p>
+		%s
+		<div class="mt-3 p-2 bg-white rounded border border-green-300">
+			<p class="text-xs text-gray-600 mb-1">Share URL:</p>
+			<p class="text-sm font-mono break-all">/api/share/%s</p>
+		</div>
+		<button type="button" onclick="navigator.clipboard.writeText(window.location.origin + '/api/share/%s'); this.textContent='✓ Copied!'; setTimeout(() => this.textContent='Copy Link', 2000)" class="mt-3 bg-blue-600 text-white px-4 py-2 rounded text-sm hover:bg-blue-700">Copy Link</button>
+	</div>`, expiryText, accessInfo, share.ShareToken, share.ShareToken))
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"id":            share.ID.String(),
+		"share_token":   share.ShareToken,
+		"expires_at":    share.ExpiresAt.Time.Format(time.RFC3339),
+		"max_access":    share.MaxAccess.Int32,
+		"view_only":     share.ViewOnly,
+		"allowed_cidrs": formatCIDRList(share.AllowedCidrs),
+	})
+}
+
+// formatCIDRs renders network ranges as a comma-separated list
+func formatCIDRs(prefixes []netip.Prefix) string {
+	return strings.Join(formatCIDRList(prefixes), ", ")
+}
+
+// formatCIDRList renders network ranges for JSON responses
+func formatCIDRList(prefixes []netip.Prefix) []string {
+	list := make([]string, 0, len(prefixes))
+	for _, prefix := range prefixes {
+		list = append(list, prefix.String())
+	}
+	return list
+}
+
+// isChecked reports whether a checkbox form value is set
+func isChecked(value string) bool {
+	switch strings.ToLower(value) {
+	case "true", "on", "1":
+		return true
+	}
+	return false
+}
+
+// shareSubject describes what a share contains for the password form
+func shareSubject(share *models.ShareCache, docs []sharedDocument) string {
+	if share.FolderID == "" && len(docs) == 1 {
+		return fmt.Sprintf(`<strong>File:</strong> %s<br>
+							<strong>Size:</strong> %.2f MB`, html.EscapeString(docs[0].Filename), float64(docs[0].FileSize)/1024/1024)
+	}
+
+	name := share.Name
+	if name == "" {
+		name = "Shared documents"
+	}
+	return fmt.Sprintf(`<strong>Bundle:</strong> %s<br>
+							<strong>Files:</strong> %d`, html.EscapeString(name), len(docs))
+}
+
+// shareNetworkAllowed reports whether the client address is inside the
+// share's allowed networks. Shares without an allowlist can be opened from
+// anywhere.
+func shareNetworkAllowed(c *fiber.Ctx, share *models.ShareCache) bool {
+	if len(share.AllowedCIDRs) == 0 {
+		return true
+	}
+
+	ip, err := netip.ParseAddr(middleware.ClientIP(c))
+	if err != nil {
+		return false
+	}
+	return middleware.ContainsAddr(share.AllowedCIDRs, ip)
+}
+
+// shareDisplayName names a share in notifications
+func shareDisplayName(share *models.ShareCache) string {
+	if share.Name != "" {
+		return share.Name
+	}
+	return "share " + share.ShareToken[:8]
+}
+
+// uniqueArchiveName returns a ZIP entry name for filename that does not
+// collide with names already used in the archive.
+func uniqueArchiveName(used map[string]int, filename string) string {
+	name := filepath.Base(strings.ReplaceAll(filename, "\\", "/"))
+	used[name]++
+	if used[name] == 1 {
+		return name
+	}
+
+	ext := filepath.Ext(name)
+	return fmt.Sprintf("%s (%d)%s", strings.TrimSuffix(name, ext), used[name], ext)
+}
+
+func sendShareNotFound(c *fiber.Ctx) error {
+	c.Set("Content-Type", "text/html")
+	return c.Status(fiber.StatusNotFound).SendString(`
+		<html><body style="font-family: sans-serif; max-width: 600px; margin: 50px auto; padding: 20px;">
+		<div style="background: #fee; border: 1px solid #fcc; padding: 20px; border-radius: 8px;">
+			<h2 style="color: #c00; margin: 0 0 10px 0;">❌ Share Not Found</h2>
+			<p>This share link does not exist or has been deleted.</p>
+		</div>
+		</body></html>
+	`)
+}
+
+func sendShareExpired(c *fiber.Ctx) error {
+	c.Set("Content-Type", "text/html")
+	return c.Status(fiber.StatusGone).SendString(`
+		<html><body style="font-family: sans-serif; max-width: 600px; margin: 50px auto; padding: 20px;">
+		<div style="background: #ffe; border: 1px solid #ffa; padding: 20px; border-radius: 8px;">
+			<h2 style="color: #a80; margin: 0 0 10px 0;">⏱️ Share Expired</h2>
+			<p>This share link has expired and is no longer available.</p>
+		</div>
+		</body></html>
+	`)
+}
+
+func sendShareLimitReached(c *fiber.Ctx) error {
+	c.Set("Content-Type", "text/html")
+	return c.Status(fiber.StatusGone).SendString(`
+		<html><body style="font-family: sans-serif; max-width: 600px; margin: 50px auto; padding: 20px;">
+		<div style="background: #ffe; border: 1px solid #ffa; padding: 20px; border-radius: 8px;">
+			<h2 style="color: #a80; margin: 0 0 10px 0;">🔒 Access Limit Reached</h2>
+			<p>This share link has reached its maximum number of accesses.</p>
+		</div>
+		</body></html>
+	`)
+}
+
+func sendSharePasswordForm(c *fiber.Ctx, subject, errorMsg string, askPassword, askEmail bool) error {
+	title := "🔒 Password Protected"
+	subtitle := "This share is password protected"
+	if askEmail {
+		title = "🔒 Confidential Document"
+		subtitle = "This share can only be viewed online. Your email address will be shown on every page."
+	}
+
+	fields := ""
+	if askEmail {
+		fields += `<input type="email" name="email" placeholder="Enter your email" required autofocus>`
+	}
+	if askPassword {
+		fields += `<input type="password" name="password" placeholder="Enter password" required>`
+	}
+
+	c.Set("Content-Type", "text/html")
+	return c.SendString(fmt.Sprintf(`
+		<html>
+		<head>
+			<title>Protected Share</title>
+			<style>
+				body { font-family: sans-serif; max-width: 500px; margin: 50px auto; padding: 20px; background: #f5f5f5; }
+				.container { background: white; padding: 30px; border-radius: 8px; box-shadow: 0 2px 10px rgba(0,0,0,0.1); }
+				h2 { color: #333; margin: 0 0 10px 0; }
+				.subtitle { color: #666; margin-bottom: 20px; font-size: 14px; }
+				.file-info { background: #f9f9f9; padding: 15px; border-radius: 5px; margin-bottom: 20px; }
+				.file-info strong { color: #555; }
+				input[type="password"], input[type="email"] { width: 100%%; padding: 10px; border: 1px solid #ddd; border-radius: 4px; font-size: 14px; box-sizing: border-box; margin-bottom: 10px; }
+				button { width: 100%%; padding: 12px; background: #4CAF50; color: white; border: none; border-radius: 4px; font-size: 16px; cursor: pointer; margin-top: 5px; }
+				button:hover { background: #45a049; }
+			</style>
+		</head>
+		<body>
+			<div class="container">
+				<h2>%s</h2>
+				<p class="subtitle">%s</p>
+				<div class="file-info">
+					%s
+				</div>
+				%s
+				<form method="POST">
+					%s
+					<button type="submit">Access File</button>
+				</form>
+			</div>
+		</body>
+		</html>
+	`, title, subtitle, subject, errorMsg, fields))
+}
+
+func sendShareNetworkDenied(c *fiber.Ctx) error {
+	c.Set("Content-Type", "text/html")
+	return c.Status(fiber.StatusForbidden).SendString(`
+		<html><body style="font-family: sans-serif; max-width: 600px; margin: 50px auto; padding: 20px;">
+		<div style="background: #fee; border: 1px solid #fcc; padding: 20px; border-radius: 8px;">
+			<h2 style="color: #c00; margin: 0 0 10px 0;">🚫 Access Restricted</h2>
+			<p>This share can only be opened from approved networks. Please contact the person who shared it with you.</p>
+		</div>
+		</body></html>
+	`)
+}
+
+func sendShareDownloadDisabled(c *fiber.Ctx) error {
+	c.Set("Content-Type", "text/html")
+	return c.Status(fiber.StatusForbidden).SendString(`
+		<html><body style="font-family: sans-serif; max-width: 600px; margin: 50px auto; padding: 20px;">
+		<div style="background: #ffe; border: 1px solid #ffa; padding: 20px; border-radius: 8px;">
+			<h2 style="color: #a80; margin: 0 0 10px 0;">👁️ View Only</h2>
+			<p>Downloads are disabled for this share. The documents can only be viewed online.</p>
+		</div>
+		</body></html>
+	`)
+}
@@ -0,0 +1,154 @@
+package handlers
+
+import (
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"Secure-Document-Exchange-Portal/internal/auth"
+	"Secure-Document-Exchange-Portal/internal/services"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// testShare are the settings of a share created by fixtures.share
+type testShare struct {
+	maxAccess              int32
+	password               string
+	notifyOnAccess         string
+	notifyOnLimit          bool
+	notifyPasswordFailures int32
+}
+
+// share creates a share of two documents of owner and returns its token
+func (f *fixtures) share(owner, workspace pgtype.UUID, settings testShare) string {
+	f.t.Helper()
+
+	var passwordHash pgtype.Text
+	if settings.password != "" {
+		hash, err := bcrypt.GenerateFromPassword([]byte(settings.password), bcrypt.MinCost)
+		if err != nil {
+			f.t.Fatal(err)
+		}
+		passwordHash = pgtype.Text{String: string(hash), Valid: true}
+	}
+	token := uuid.NewString()
+	share := f.id(`INSERT INTO shares (share_token, expires_at, max_access, password_hash, created_by, notify_on_access, notify_on_limit, notify_password_failures)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id`,
+		token, time.Now().Add(time.Hour), settings.maxAccess, passwordHash, owner, settings.notifyOnAccess, settings.notifyOnLimit,
+		pgtype.Int4{Int32: settings.notifyPasswordFailures, Valid: settings.notifyPasswordFailures > 0})
+	for range 2 {
+		if _, err := f.pool.Exec(f.ctx, `INSERT INTO share_documents (share_id, document_id) VALUES ($1, $2)`,
+			share, f.document(owner, workspace)); err != nil {
+			f.t.Fatal(err)
+		}
+	}
+	return token
+}
+
+func (f *fixtures) shareApp() *fiber.App {
+	f.t.Helper()
+
+	jwtService, err := auth.NewJWTService(auth.JWTConfig{Secret: "secret", Issuer: "http://localhost", Audience: "sdx-api"})
+	if err != nil {
+		f.t.Fatal(err)
+	}
+	h := NewShareHandler(f.db, nil, f.cache, nil, jwtService, nil, f.notifier, f.audit)
+
+	app := fiber.New()
+	app.Get("/api/share/:token", h.AccessShare)
+	app.Post("/api/share/:token", h.AccessShare)
+	return app
+}
+
+// The owner hears about accesses as they asked, and exactly once about the
+// first access, the access limit being reached and repeated wrong passwords
+func TestShareNotificationsFireOnce(t *testing.T) {
+	f := newFixtures(t)
+	app := f.shareApp()
+
+	cases := []struct {
+		name           string
+		share          testShare
+		wrongPasswords int
+		accesses       int
+		concurrent     bool
+		want           map[string]int
+	}{
+		{"no notifications", testShare{maxAccess: -1, notifyOnAccess: ShareNotifyNone}, 0, 3, false,
+			map[string]int{}},
+		{"every access", testShare{maxAccess: -1, notifyOnAccess: ShareNotifyEvery}, 0, 3, false,
+			map[string]int{services.EventShareAccess: 3}},
+		{"first access", testShare{maxAccess: -1, notifyOnAccess: ShareNotifyFirst}, 0, 3, false,
+			map[string]int{services.EventShareFirstAccess: 1}},
+		{"limit reached", testShare{maxAccess: 2, notifyOnAccess: ShareNotifyNone, notifyOnLimit: true}, 0, 4, false,
+			map[string]int{services.EventShareLimitReached: 1}},
+		{"limit reached by concurrent accesses", testShare{maxAccess: 1, notifyOnAccess: ShareNotifyNone, notifyOnLimit: true}, 0, 8, true,
+			map[string]int{services.EventShareLimitReached: 1}},
+		{"limit reached without notification", testShare{maxAccess: 2, notifyOnAccess: ShareNotifyNone}, 0, 4, false,
+			map[string]int{}},
+		{"password failures", testShare{maxAccess: -1, password: "secret", notifyOnAccess: ShareNotifyNone, notifyPasswordFailures: 3}, 6, 1, false,
+			map[string]int{services.EventSharePasswordFailures: 1}},
+		{"password failures below the threshold", testShare{maxAccess: -1, password: "secret", notifyOnAccess: ShareNotifyNone, notifyPasswordFailures: 3}, 2, 1, false,
+			map[string]int{}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			f := f.in(t)
+			f.notifier.Reset()
+			owner, workspace := f.user("password")
+			token := f.share(owner.ID, workspace, tc.share)
+
+			access := func(password string) {
+				req := httptest.NewRequest(fiber.MethodGet, "/api/share/"+token, nil)
+				if password != "" {
+					form := url.Values{"password": {password}}
+					req = httptest.NewRequest(fiber.MethodPost, "/api/share/"+token, strings.NewReader(form.Encode()))
+					req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+				}
+				resp, err := app.Test(req, -1)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				resp.Body.Close()
+			}
+
+			for range tc.wrongPasswords {
+				access("wrong")
+			}
+			var wg sync.WaitGroup
+			for range tc.accesses {
+				if tc.concurrent {
+					wg.Go(func() { access(tc.share.password) })
+				} else {
+					access(tc.share.password)
+				}
+			}
+			wg.Wait()
+
+			got := f.events()
+			for event, want := range tc.want {
+				if got[event] != want {
+					t.Errorf("%s notifications = %d, want %d", event, got[event], want)
+				}
+			}
+			for event, n := range got {
+				if _, ok := tc.want[event]; !ok {
+					t.Errorf("unexpected %s notifications: %d", event, n)
+				}
+			}
+			for _, n := range f.notifier.Notifications() {
+				if n.UserID != owner.ID.Bytes {
+					t.Errorf("%s notification sent to %s, want the owner %s", n.Event, n.UserID, uuid.UUID(owner.ID.Bytes))
+				}
+			}
+		})
+	}
+}
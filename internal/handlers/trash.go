@@ -0,0 +1,166 @@
+package handlers
+
+import (
+	"time"
+
+	"Secure-Document-Exchange-Portal/internal/auth"
+	"Secure-Document-Exchange-Portal/internal/database"
+	"Secure-Document-Exchange-Portal/internal/services"
+	"Secure-Document-Exchange-Portal/templates"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// TrashHandler is the recycle bin. Deleting a document moves it here, from
+// where it can be restored until the restore window passes.
+type TrashHandler struct {
+	db     *database.Queries
+	cache  *services.CachedRepository
+	policy *auth.Policy
+	trash  *services.TrashService
+	audit  *services.AuditLog
+}
+
+func NewTrashHandler(db *database.Queries, cache *services.CachedRepository, policy *auth.Policy, trash *services.TrashService, audit *services.AuditLog) *TrashHandler {
+	return &TrashHandler{
+		db:     db,
+		cache:  cache,
+		policy: policy,
+		trash:  trash,
+		audit:  audit,
+	}
+}
+
+// List returns the documents in the trash of a workspace, the personal one
+// unless workspace_id is given, most recently deleted first
+func (h *TrashHandler) List(c *fiber.Ctx) error {
+	userID, err := auth.GetUserID(c)
+	if err != nil {
+		return err
+	}
+
+	workspaceID, err := requestWorkspace(c, h.db, h.policy, userID, c.Query("workspace_id"), auth.ActionDocumentList)
+	if err != nil {
+		return err
+	}
+
+	docs, err := h.db.ListTrashedDocuments(c.Context(), workspaceID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to list the trash"})
+	}
+	cutoff := h.trash.Cutoff(time.Now())
+
+	if c.Get("Accept") == "text/html" || c.Get("HX-Request") == "true" {
+		var items []templates.TrashedDocument
+		for _, doc := range docs {
+			items = append(items, templates.TrashedDocument{
+				ID:         doc.ID.String(),
+				Filename:   doc.Filename,
+				FileSize:   doc.FileSize,
+				DeletedAt:  doc.DeletedAt.Time.Format("2006-01-02 15:04"),
+				PurgeAt:    h.trash.PurgeAt(doc.DeletedAt.Time).Format("2006-01-02 15:04"),
+				Restorable: doc.DeletedAt.Time.After(cutoff),
+			})
+		}
+		c.Set("Content-Type", "text/html")
+		return templates.TrashList(items).Render(c.Context(), c.Response().BodyWriter())
+	}
+
+	result := make([]fiber.Map, 0, len(docs))
+	for _, doc := range docs {
+		result = append(result, fiber.Map{
+			"id":           doc.ID.String(),
+			"filename":     doc.Filename,
+			"file_size":    doc.FileSize,
+			"mime_type":    doc.MimeType,
+			"folder_id":    doc.FolderID.String(),
+			"workspace_id": doc.WorkspaceID.String(),
+			"deleted_at":   doc.DeletedAt.Time.Format(time.RFC3339),
+			"deleted_by":   doc.DeletedBy.String(),
+			"purge_at":     h.trash.PurgeAt(doc.DeletedAt.Time).Format(time.RFC3339),
+			"restorable":   doc.DeletedAt.Time.After(cutoff),
+		})
+	}
+	return c.JSON(result)
+}
+
+// Restore takes a document out of the trash, back into its folder if that
+// still exists. Documents whose restore window has passed are gone (410).
+func (h *TrashHandler) Restore(c *fiber.Ctx) error {
+	doc, ok, err := h.trashedDocument(c)
+	if !ok {
+		return err
+	}
+
+	restored, err := h.db.RestoreDocument(c.Context(), database.RestoreDocumentParams{
+		ID:          doc.ID,
+		WorkspaceID: doc.WorkspaceID,
+		Cutoff:      pgtype.Timestamptz{Time: h.trash.Cutoff(time.Now()), Valid: true},
+	})
+	if err != nil {
+		return c.Status(fiber.StatusGone).JSON(fiber.Map{"error": "The document can no longer be restored"})
+	}
+	h.cache.InvalidateDocument(c.Context(), doc.ID.Bytes, doc.WorkspaceID.Bytes)
+	recordAudit(c, h.audit, documentEvent(services.AuditDocumentRestored, restored))
+
+	if c.Get("HX-Request") == "true" {
+		c.Set("HX-Trigger", "documentUploaded")
+	}
+	return c.JSON(fiber.Map{
+		"id":        restored.ID.String(),
+		"filename":  restored.Filename,
+		"folder_id": restored.FolderID.String(),
+	})
+}
+
+// Delete deletes a document in the trash for good, without waiting for the
+// restore window to pass. Documents under legal hold or whose retention
+// period has not ended are kept.
+func (h *TrashHandler) Delete(c *fiber.Ctx) error {
+	doc, ok, err := h.trashedDocument(c)
+	if !ok {
+		return err
+	}
+	if ok, err := checkDocumentHold(c, h.db, h.audit, doc, "delete permanently"); !ok {
+		return err
+	}
+	if ok, err := checkDocumentRetention(c, h.db, doc); !ok {
+		return err
+	}
+
+	if err := h.trash.Delete(c.Context(), doc); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to delete document"})
+	}
+	recordAudit(c, h.audit, documentEvent(services.AuditDocumentDeleted, doc))
+
+	if c.Get("HX-Request") == "true" {
+		c.Set("HX-Trigger", "documentUploaded")
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// trashedDocument loads the trashed document named in the URL and checks
+// that the current user may delete it, which restoring needs as well
+func (h *TrashHandler) trashedDocument(c *fiber.Ctx) (database.Document, bool, error) {
+	userID, err := auth.GetUserID(c)
+	if err != nil {
+		return database.Document{}, false, err
+	}
+
+	docID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return database.Document{}, false, c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid document ID"})
+	}
+
+	doc, err := h.db.GetTrashedDocument(c.Context(), pgtype.UUID{Bytes: docID, Valid: true})
+	if err != nil {
+		return database.Document{}, false, c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Document not found in the trash"})
+	}
+
+	if ok, err := authorize(c, h.policy, userID, auth.ActionDocumentDelete, documentResource(doc)); !ok {
+		return database.Document{}, false, err
+	}
+	return doc, true, nil
+}
@@ -0,0 +1,392 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"Secure-Document-Exchange-Portal/internal/auth"
+	"Secure-Document-Exchange-Portal/internal/database"
+	"Secure-Document-Exchange-Portal/internal/models"
+	"Secure-Document-Exchange-Portal/internal/services"
+	"Secure-Document-Exchange-Portal/templates"
+
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// WebAuthn ceremony purposes. A challenge started for one purpose cannot be
+// finished for another.
+const (
+	webAuthnPurposeRegister     = "register"
+	webAuthnPurposeMFA          = "mfa"
+	webAuthnPurposePasswordless = "passwordless"
+)
+
+// webAuthnMaxNameLength limits credential names
+const webAuthnMaxNameLength = 100
+
+var errWebAuthnChallenge = errors.New("WebAuthn challenge not found or expired")
+
+type WebAuthnHandler struct {
+	db         *database.Queries
+	cache      *services.CachedRepository
+	webauthn   *auth.WebAuthnService
+	audit      *services.AuditLog
+	requireMFA bool
+}
+
+func NewWebAuthnHandler(db *database.Queries, cache *services.CachedRepository, webauthn *auth.WebAuthnService, audit *services.AuditLog, requireMFA bool) *WebAuthnHandler {
+	return &WebAuthnHandler{
+		db:         db,
+		cache:      cache,
+		webauthn:   webauthn,
+		audit:      audit,
+		requireMFA: requireMFA,
+	}
+}
+
+// Credentials lists the user's security keys and passkeys
+func (h *WebAuthnHandler) Credentials(c *fiber.Ctx) error {
+	userID, err := auth.GetUserID(c)
+	if err != nil {
+		return err
+	}
+
+	return h.renderCredentials(c, userID)
+}
+
+// BeginRegistration returns the options for navigator.credentials.create()
+func (h *WebAuthnHandler) BeginRegistration(c *fiber.Ctx) error {
+	userID, err := auth.GetUserID(c)
+	if err != nil {
+		return err
+	}
+
+	user, err := h.db.GetUserByID(c.Context(), pgtype.UUID{Bytes: userID, Valid: true})
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
+	}
+
+	webAuthnUser, err := loadWebAuthnUser(c.Context(), h.db, user)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to load credentials"})
+	}
+
+	creation, session, err := h.webauthn.BeginRegistration(webAuthnUser)
+	if err != nil {
+		log.Printf("Failed to begin WebAuthn registration: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to start registration"})
+	}
+
+	ceremonyID, err := saveWebAuthnChallenge(c.Context(), h.db, user.ID, webAuthnPurposeRegister, session)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to start registration"})
+	}
+
+	return c.JSON(fiber.Map{
+		"ceremony_id": ceremonyID.String(),
+		"options":     creation,
+	})
+}
+
+// FinishRegistration verifies the authenticator's response and stores the
+// new credential
+func (h *WebAuthnHandler) FinishRegistration(c *fiber.Ctx) error {
+	userID, err := auth.GetUserID(c)
+	if err != nil {
+		return err
+	}
+
+	var req models.WebAuthnFinishRequest
+	if err := c.BodyParser(&req); err != nil || len(req.Credential) == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		name = "Security key"
+	}
+	if len(name) > webAuthnMaxNameLength {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Name is too long"})
+	}
+
+	session, owner, err := takeWebAuthnChallenge(c.Context(), h.db, req.CeremonyID, webAuthnPurposeRegister)
+	if err != nil || owner.Bytes != userID {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": errWebAuthnChallenge.Error()})
+	}
+
+	user, err := h.db.GetUserByID(c.Context(), pgtype.UUID{Bytes: userID, Valid: true})
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
+	}
+
+	webAuthnUser, err := loadWebAuthnUser(c.Context(), h.db, user)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to load credentials"})
+	}
+
+	credential, err := h.webauthn.FinishRegistration(webAuthnUser, *session, req.Credential)
+	if err != nil {
+		log.Printf("WebAuthn registration failed for user %s: %v", userID, err)
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Security key registration failed"})
+	}
+
+	data, err := json.Marshal(credential)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to save security key"})
+	}
+
+	saved, err := h.db.CreateWebAuthnCredential(c.Context(), database.CreateWebAuthnCredentialParams{
+		UserID:       user.ID,
+		CredentialID: credential.ID,
+		Credential:   data,
+		Name:         name,
+	})
+	if err != nil {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Security key is already registered"})
+	}
+	recordAudit(c, h.audit, services.AuditEvent{
+		Action:       services.AuditSecurityKeyAdded,
+		ResourceType: "security_key",
+		ResourceID:   saved.ID.String(),
+		Details:      map[string]string{"name": saved.Name},
+	})
+
+	return c.Status(fiber.StatusCreated).JSON(webAuthnCredentialJSON(saved))
+}
+
+// RenameCredential changes the display name of a credential
+func (h *WebAuthnHandler) RenameCredential(c *fiber.Ctx) error {
+	userID, err := auth.GetUserID(c)
+	if err != nil {
+		return err
+	}
+
+	credentialID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid credential ID"})
+	}
+
+	// The web UI asks for the name with hx-prompt
+	name := strings.TrimSpace(c.FormValue("name"))
+	if name == "" {
+		name = strings.TrimSpace(c.Get("HX-Prompt"))
+	}
+	if name == "" || len(name) > webAuthnMaxNameLength {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Name must be between 1 and 100 characters"})
+	}
+
+	saved, err := h.db.RenameWebAuthnCredential(c.Context(), database.RenameWebAuthnCredentialParams{
+		ID:     pgtype.UUID{Bytes: credentialID, Valid: true},
+		UserID: pgtype.UUID{Bytes: userID, Valid: true},
+		Name:   name,
+	})
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Credential not found"})
+	}
+	recordAudit(c, h.audit, services.AuditEvent{
+		Action:       services.AuditSecurityKeyRenamed,
+		ResourceType: "security_key",
+		ResourceID:   saved.ID.String(),
+		Details:      map[string]string{"name": saved.Name},
+	})
+
+	if c.Get("HX-Request") == "true" {
+		return h.renderCredentials(c, userID)
+	}
+	return c.JSON(webAuthnCredentialJSON(saved))
+}
+
+// DeleteCredential removes a credential. The last second factor cannot be
+// removed while MFA is required.
+func (h *WebAuthnHandler) DeleteCredential(c *fiber.Ctx) error {
+	userID, err := auth.GetUserID(c)
+	if err != nil {
+		return err
+	}
+
+	credentialID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid credential ID"})
+	}
+
+	required, err := mfaRequired(c.Context(), h.db, h.requireMFA, pgtype.UUID{Bytes: userID, Valid: true})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to load organization settings"})
+	}
+	if required {
+		user, err := h.db.GetUserByID(c.Context(), pgtype.UUID{Bytes: userID, Valid: true})
+		if err != nil {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
+		}
+		count, err := h.db.CountUserWebAuthnCredentials(c.Context(), user.ID)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to load credentials"})
+		}
+		if !user.TotpEnabled && count <= 1 {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Two-factor authentication is required by your organization. Add another second factor first."})
+		}
+	}
+
+	deleted, err := h.db.DeleteWebAuthnCredential(c.Context(), database.DeleteWebAuthnCredentialParams{
+		ID:     pgtype.UUID{Bytes: credentialID, Valid: true},
+		UserID: pgtype.UUID{Bytes: userID, Valid: true},
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to delete credential"})
+	}
+	if deleted == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Credential not found"})
+	}
+	recordAudit(c, h.audit, services.AuditEvent{
+		Action:       services.AuditSecurityKeyRemoved,
+		ResourceType: "security_key",
+		ResourceID:   credentialID.String(),
+	})
+
+	if c.Get("HX-Request") == "true" {
+		return h.renderCredentials(c, userID)
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+func (h *WebAuthnHandler) renderCredentials(c *fiber.Ctx, userID uuid.UUID) error {
+	credentials, err := h.db.ListUserWebAuthnCredentials(c.Context(), pgtype.UUID{Bytes: userID, Valid: true})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to list credentials"})
+	}
+
+	if c.Get("Accept") == "text/html" || c.Get("HX-Request") == "true" {
+		var items []templates.WebAuthnCredentialInfo
+		for _, credential := range credentials {
+			lastUsed := "Never used"
+			if credential.LastUsedAt.Valid {
+				lastUsed = "Last used " + credential.LastUsedAt.Time.Format("2006-01-02 15:04")
+			}
+			items = append(items, templates.WebAuthnCredentialInfo{
+				ID:        credential.ID.String(),
+				Name:      credential.Name,
+				CreatedAt: credential.CreatedAt.Time.Format("2006-01-02 15:04"),
+				LastUsed:  lastUsed,
+			})
+		}
+		c.Set("Content-Type", "text/html")
+		return templates.WebAuthnCredentialList(items).Render(c.Context(), c.Response().BodyWriter())
+	}
+
+	result := make([]fiber.Map, 0, len(credentials))
+	for _, credential := range credentials {
+		result = append(result, webAuthnCredentialJSON(credential))
+	}
+	return c.JSON(result)
+}
+
+func webAuthnCredentialJSON(credential database.WebauthnCredential) fiber.Map {
+	item := fiber.Map{
+		"id":         credential.ID.String(),
+		"name":       credential.Name,
+		"created_at": credential.CreatedAt.Time.Format(time.RFC3339),
+	}
+	if credential.LastUsedAt.Valid {
+		item["last_used_at"] = credential.LastUsedAt.Time.Format(time.RFC3339)
+	}
+
+	var stored webauthn.Credential
+	if err := json.Unmarshal(credential.Credential, &stored); err == nil {
+		// Backup eligible credentials are synced passkeys rather than
+		// device-bound security keys
+		item["synced"] = stored.Flags.BackupEligible
+	}
+	return item
+}
+
+// loadWebAuthnUser returns the user with their registered credentials
+func loadWebAuthnUser(ctx context.Context, db *database.Queries, user database.User) (*auth.WebAuthnUser, error) {
+	rows, err := db.ListUserWebAuthnCredentials(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	webAuthnUser := &auth.WebAuthnUser{
+		ID:       user.ID.Bytes,
+		Email:    user.Email,
+		FullName: user.FullName,
+	}
+	for _, row := range rows {
+		var credential webauthn.Credential
+		if err := json.Unmarshal(row.Credential, &credential); err != nil {
+			log.Printf("Skipping unreadable WebAuthn credential %s: %v", row.ID.String(), err)
+			continue
+		}
+		webAuthnUser.Credentials = append(webAuthnUser.Credentials, credential)
+	}
+
+	return webAuthnUser, nil
+}
+
+// saveWebAuthnChallenge stores the state of a ceremony until its finish
+// request. The returned ID is handed to the client as ceremony_id.
+func saveWebAuthnChallenge(ctx context.Context, db *database.Queries, userID pgtype.UUID, purpose string, session *webauthn.SessionData) (uuid.UUID, error) {
+	data, err := json.Marshal(session)
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	challenge, err := db.CreateWebAuthnChallenge(ctx, database.CreateWebAuthnChallengeParams{
+		UserID:      userID,
+		Purpose:     purpose,
+		SessionData: data,
+		ExpiresAt:   pgtype.Timestamptz{Time: session.Expires, Valid: true},
+	})
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	return challenge.ID.Bytes, nil
+}
+
+// takeWebAuthnChallenge removes a ceremony's state and returns it, so each
+// challenge can only be answered once. The user ID is not valid for
+// passwordless logins.
+func takeWebAuthnChallenge(ctx context.Context, db *database.Queries, ceremonyID, purpose string) (*webauthn.SessionData, pgtype.UUID, error) {
+	id, err := uuid.Parse(ceremonyID)
+	if err != nil {
+		return nil, pgtype.UUID{}, errWebAuthnChallenge
+	}
+
+	challenge, err := db.TakeWebAuthnChallenge(ctx, database.TakeWebAuthnChallengeParams{
+		ID:      pgtype.UUID{Bytes: id, Valid: true},
+		Purpose: purpose,
+	})
+	if err != nil {
+		return nil, pgtype.UUID{}, errWebAuthnChallenge
+	}
+
+	var session webauthn.SessionData
+	if err := json.Unmarshal(challenge.SessionData, &session); err != nil {
+		return nil, pgtype.UUID{}, err
+	}
+
+	return &session, challenge.UserID, nil
+}
+
+// recordWebAuthnUse stores a credential's new sign count and flags after a
+// successful login
+func recordWebAuthnUse(ctx context.Context, db *database.Queries, credential *webauthn.Credential) {
+	data, err := json.Marshal(credential)
+	if err == nil {
+		err = db.UpdateWebAuthnCredentialUsage(ctx, database.UpdateWebAuthnCredentialUsageParams{
+			CredentialID: credential.ID,
+			Credential:   data,
+		})
+	}
+	if err != nil {
+		log.Printf("Failed to update WebAuthn credential usage: %v", err)
+	}
+}
@@ -0,0 +1,406 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"Secure-Document-Exchange-Portal/internal/auth"
+	"Secure-Document-Exchange-Portal/internal/database"
+	"Secure-Document-Exchange-Portal/internal/models"
+	"Secure-Document-Exchange-Portal/internal/services"
+	"Secure-Document-Exchange-Portal/internal/validation"
+	"Secure-Document-Exchange-Portal/templates"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// personalWorkspace returns the user's personal workspace, creating it for
+// accounts that do not have one yet
+func personalWorkspace(ctx context.Context, db *database.Queries, userID uuid.UUID) (database.Workspace, error) {
+	owner := pgtype.UUID{Bytes: userID, Valid: true}
+	workspace, err := db.GetPersonalWorkspace(ctx, owner)
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return workspace, err
+	}
+
+	workspace, err = db.CreatePersonalWorkspace(ctx, owner)
+	if err != nil {
+		return workspace, err
+	}
+	_, err = db.AddWorkspaceUser(ctx, database.AddWorkspaceUserParams{
+		WorkspaceID: workspace.ID,
+		UserID:      owner,
+		Role:        string(auth.RoleOwner),
+	})
+	return workspace, err
+}
+
+// requestWorkspace returns the workspace a request works in: the one given
+// as workspaceID, in which the user must be allowed the action, or their
+// personal workspace when it is empty. Errors are *fiber.Error values ready
+// to return.
+func requestWorkspace(c *fiber.Ctx, db *database.Queries, policy *auth.Policy, userID uuid.UUID, workspaceID string, action auth.Action) (pgtype.UUID, error) {
+	if workspaceID == "" {
+		workspace, err := personalWorkspace(c.Context(), db, userID)
+		if err != nil {
+			return pgtype.UUID{}, fiber.NewError(fiber.StatusInternalServerError, "Failed to load personal workspace")
+		}
+		return workspace.ID, nil
+	}
+
+	parsed, err := uuid.Parse(workspaceID)
+	if err != nil {
+		return pgtype.UUID{}, fiber.NewError(fiber.StatusBadRequest, "Invalid workspace ID")
+	}
+	id := pgtype.UUID{Bytes: parsed, Valid: true}
+	err = policy.Authorize(c.Context(), auth.Subject{UserID: userID}, action, inWorkspace(id))
+	if errors.Is(err, auth.ErrForbidden) {
+		return pgtype.UUID{}, fiber.NewError(fiber.StatusForbidden, "Access denied")
+	}
+	if err != nil {
+		log.Printf("Failed to authorize %s for user %s: %v", action, userID, err)
+		return pgtype.UUID{}, fiber.NewError(fiber.StatusInternalServerError, "Failed to check permissions")
+	}
+	return id, nil
+}
+
+type WorkspaceHandler struct {
+	db     *database.Queries
+	cache  *services.CachedRepository
+	policy *auth.Policy
+	audit  *services.AuditLog
+}
+
+func NewWorkspaceHandler(db *database.Queries, cache *services.CachedRepository, policy *auth.Policy, audit *services.AuditLog) *WorkspaceHandler {
+	return &WorkspaceHandler{
+		db:     db,
+		cache:  cache,
+		policy: policy,
+		audit:  audit,
+	}
+}
+
+// List returns the workspaces the user can work in, the personal one first.
+// HTMX requests get the options of the workspace picker.
+func (h *WorkspaceHandler) List(c *fiber.Ctx) error {
+	userID, err := auth.GetUserID(c)
+	if err != nil {
+		return err
+	}
+
+	// Accounts from before workspaces existed get theirs on first use
+	if _, err := personalWorkspace(c.Context(), h.db, userID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to load personal workspace"})
+	}
+
+	workspaces, err := h.db.ListUserWorkspaces(c.Context(), pgtype.UUID{Bytes: userID, Valid: true})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to list workspaces"})
+	}
+
+	if c.Get("HX-Request") == "true" {
+		var options []templates.WorkspaceOption
+		for _, workspace := range workspaces {
+			options = append(options, templates.WorkspaceOption{
+				ID:   workspace.ID.String(),
+				Name: workspace.Name,
+			})
+		}
+		c.Set("Content-Type", "text/html")
+		return templates.WorkspaceOptions(options).Render(c.Context(), c.Response().BodyWriter())
+	}
+
+	result := make([]fiber.Map, 0, len(workspaces))
+	for _, workspace := range workspaces {
+		result = append(result, workspaceJSON(workspace))
+	}
+	return c.JSON(result)
+}
+
+// Create adds a workspace to an organization. Only those who may manage
+// the organization can create workspaces; the creator becomes the
+// workspace's owner.
+func (h *WorkspaceHandler) Create(c *fiber.Ctx) error {
+	userID, err := auth.GetUserID(c)
+	if err != nil {
+		return err
+	}
+
+	orgID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid organization ID"})
+	}
+	if ok, err := authorize(c, h.policy, userID, auth.ActionOrganizationManage, auth.Resource{OrganizationID: orgID}); !ok {
+		return err
+	}
+
+	var req models.NameRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	name := strings.TrimSpace(req.Name)
+	if err := validation.ValidateGroupName("workspace", name); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	workspace, err := h.db.CreateWorkspace(c.Context(), database.CreateWorkspaceParams{
+		OrganizationID: pgtype.UUID{Bytes: orgID, Valid: true},
+		Name:           name,
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to create workspace"})
+	}
+	_, err = h.db.AddWorkspaceUser(c.Context(), database.AddWorkspaceUserParams{
+		WorkspaceID: workspace.ID,
+		UserID:      pgtype.UUID{Bytes: userID, Valid: true},
+		Role:        string(auth.RoleOwner),
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to create workspace"})
+	}
+	recordAudit(c, h.audit, workspaceEvent(services.AuditWorkspaceCreated, workspace, map[string]string{"name": workspace.Name}))
+
+	return c.Status(fiber.StatusCreated).JSON(workspaceJSON(workspace))
+}
+
+// Members lists the users and teams with access to a workspace
+func (h *WorkspaceHandler) Members(c *fiber.Ctx) error {
+	workspace, ok, err := loadWorkspace(c, h.db, h.policy, auth.ActionWorkspaceRead)
+	if !ok {
+		return err
+	}
+
+	members, err := h.db.ListWorkspaceMembers(c.Context(), workspace.ID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to list members"})
+	}
+
+	result := make([]fiber.Map, 0, len(members))
+	for _, member := range members {
+		item := fiber.Map{
+			"id":         member.ID.String(),
+			"role":       member.Role,
+			"created_at": member.CreatedAt.Time.Format(time.RFC3339),
+		}
+		if member.UserID.Valid {
+			item["user_id"] = member.UserID.String()
+			item["email"] = member.Email.String
+		} else {
+			item["team_id"] = member.TeamID.String()
+			item["team_name"] = member.TeamName.String
+		}
+		result = append(result, item)
+	}
+	return c.JSON(result)
+}
+
+// AddMember gives a member of the organization, or one of its teams, access
+// to a workspace. Adding an existing member again changes their role.
+func (h *WorkspaceHandler) AddMember(c *fiber.Ctx) error {
+	workspace, ok, err := loadWorkspace(c, h.db, h.policy, auth.ActionWorkspaceManage)
+	if !ok {
+		return err
+	}
+	if !workspace.OrganizationID.Valid {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Personal workspaces cannot be shared"})
+	}
+
+	var req models.WorkspaceMemberRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	if req.Role == "" {
+		req.Role = string(auth.RoleEditor)
+	}
+	if !auth.ValidWorkspaceRole(req.Role) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Role must be owner, editor, viewer or auditor"})
+	}
+
+	var member database.WorkspaceMember
+	switch {
+	case req.TeamID != "" && req.Email == "":
+		teamID, err := uuid.Parse(req.TeamID)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid team ID"})
+		}
+		team, err := h.db.GetTeamByID(c.Context(), pgtype.UUID{Bytes: teamID, Valid: true})
+		if err != nil || team.OrganizationID != workspace.OrganizationID {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Team not found"})
+		}
+		member, err = h.db.AddWorkspaceTeam(c.Context(), database.AddWorkspaceTeamParams{
+			WorkspaceID: workspace.ID,
+			TeamID:      team.ID,
+			Role:        req.Role,
+		})
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to add member"})
+		}
+
+	case req.Email != "" && req.TeamID == "":
+		user, err := h.db.GetUserByEmail(c.Context(), strings.TrimSpace(req.Email))
+		if err != nil {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "No user with this email address"})
+		}
+		_, err = h.db.GetOrganizationRole(c.Context(), database.GetOrganizationRoleParams{
+			OrganizationID: workspace.OrganizationID,
+			UserID:         user.ID,
+		})
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Only members of the organization can join its workspaces"})
+		}
+		member, err = h.db.AddWorkspaceUser(c.Context(), database.AddWorkspaceUserParams{
+			WorkspaceID: workspace.ID,
+			UserID:      user.ID,
+			Role:        req.Role,
+		})
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to add member"})
+		}
+
+	default:
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Give either an email address or a team ID"})
+	}
+	h.cache.InvalidateWorkspaceRoles(c.Context(), workspace.ID.Bytes)
+	recordAudit(c, h.audit, workspaceEvent(services.AuditWorkspaceMemberSet, workspace, workspaceMemberDetails(member)))
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"id":      member.ID.String(),
+		"user_id": member.UserID.String(),
+		"team_id": member.TeamID.String(),
+		"role":    member.Role,
+	})
+}
+
+// RemoveMember takes away a user's or team's access to a workspace
+func (h *WorkspaceHandler) RemoveMember(c *fiber.Ctx) error {
+	workspace, ok, err := loadWorkspace(c, h.db, h.policy, auth.ActionWorkspaceManage)
+	if !ok {
+		return err
+	}
+	if !workspace.OrganizationID.Valid {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Personal workspaces cannot be shared"})
+	}
+
+	memberID, err := uuid.Parse(c.Params("memberId"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid member ID"})
+	}
+
+	removed, err := h.db.RemoveWorkspaceMember(c.Context(), database.RemoveWorkspaceMemberParams{
+		ID:          pgtype.UUID{Bytes: memberID, Valid: true},
+		WorkspaceID: workspace.ID,
+	})
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Member not found"})
+	}
+	h.cache.InvalidateWorkspaceRoles(c.Context(), workspace.ID.Bytes)
+	recordAudit(c, h.audit, workspaceEvent(services.AuditWorkspaceMemberGone, workspace, workspaceMemberDetails(removed)))
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// Delete deletes an empty organization workspace and its folders
+func (h *WorkspaceHandler) Delete(c *fiber.Ctx) error {
+	workspace, ok, err := loadWorkspace(c, h.db, h.policy, auth.ActionWorkspaceManage)
+	if !ok {
+		return err
+	}
+	if !workspace.OrganizationID.Valid {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Personal workspaces cannot be deleted"})
+	}
+
+	count, err := h.db.CountWorkspaceDocuments(c.Context(), workspace.ID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to delete workspace"})
+	}
+	if count > 0 {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Move or delete the documents in this workspace, including those in the trash, first"})
+	}
+
+	if _, err := h.db.DeleteWorkspace(c.Context(), workspace.ID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to delete workspace"})
+	}
+	h.cache.InvalidateWorkspaceRoles(c.Context(), workspace.ID.Bytes)
+	recordAudit(c, h.audit, workspaceEvent(services.AuditWorkspaceDeleted, workspace, map[string]string{"name": workspace.Name}))
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// workspaceEvent is an audit event about a workspace
+func workspaceEvent(action string, workspace database.Workspace, details map[string]string) services.AuditEvent {
+	details["organization_id"] = workspace.OrganizationID.String()
+	return services.AuditEvent{
+		Action:       action,
+		ResourceType: "workspace",
+		ResourceID:   workspace.ID.String(),
+		Details:      details,
+	}
+}
+
+// workspaceMemberDetails describes a workspace member in the audit log
+func workspaceMemberDetails(member database.WorkspaceMember) map[string]string {
+	details := map[string]string{
+		"member_id": member.ID.String(),
+		"role":      member.Role,
+	}
+	if member.UserID.Valid {
+		details["user_id"] = member.UserID.String()
+	}
+	if member.TeamID.Valid {
+		details["team_id"] = member.TeamID.String()
+	}
+	return details
+}
+
+// loadWorkspace loads the workspace named in the URL and checks that the
+// current user may take the action in it. Users who cannot even see the
+// workspace get 404.
+func loadWorkspace(c *fiber.Ctx, db *database.Queries, policy *auth.Policy, action auth.Action) (database.Workspace, bool, error) {
+	userID, err := auth.GetUserID(c)
+	if err != nil {
+		return database.Workspace{}, false, err
+	}
+
+	workspaceID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return database.Workspace{}, false, c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid workspace ID"})
+	}
+
+	workspace, err := db.GetWorkspaceByID(c.Context(), pgtype.UUID{Bytes: workspaceID, Valid: true})
+	if err != nil {
+		return database.Workspace{}, false, c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Workspace not found"})
+	}
+
+	err = policy.Authorize(c.Context(), auth.Subject{UserID: userID}, auth.ActionWorkspaceRead, inWorkspace(workspace.ID))
+	if errors.Is(err, auth.ErrForbidden) {
+		return database.Workspace{}, false, c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Workspace not found"})
+	}
+	if err != nil {
+		log.Printf("Failed to authorize %s for user %s: %v", auth.ActionWorkspaceRead, userID, err)
+		return database.Workspace{}, false, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to check permissions"})
+	}
+	if ok, err := authorize(c, policy, userID, action, inWorkspace(workspace.ID)); !ok {
+		return database.Workspace{}, false, err
+	}
+
+	return workspace, true, nil
+}
+
+func workspaceJSON(workspace database.Workspace) fiber.Map {
+	item := fiber.Map{
+		"id":         workspace.ID.String(),
+		"name":       workspace.Name,
+		"personal":   workspace.PersonalUserID.Valid,
+		"created_at": workspace.CreatedAt.Time.Format(time.RFC3339),
+	}
+	if workspace.OrganizationID.Valid {
+		item["organization_id"] = workspace.OrganizationID.String()
+	}
+	return item
+}
@@ -0,0 +1,66 @@
+package middleware
+
+import (
+	"net/netip"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// ClientIPKey is the context key holding the address derived by RealIP
+const ClientIPKey = "client_ip"
+
+// RealIP derives the client address for each request. X-Forwarded-For is
+// only honoured when the connection comes from one of the trusted proxies,
+// and is read from the right so that entries a client prepends itself are
+// ignored. Without trusted proxies the connection's remote address is used.
+func RealIP(trustedProxies []netip.Prefix) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		remote, ok := netip.AddrFromSlice(c.Context().RemoteIP())
+		if !ok {
+			return c.Next()
+		}
+		client := remote.Unmap()
+
+		if ContainsAddr(trustedProxies, client) {
+			var hops []string
+			for _, header := range c.GetReqHeaders()[fiber.HeaderXForwardedFor] {
+				hops = append(hops, strings.Split(header, ",")...)
+			}
+
+			for i := len(hops) - 1; i >= 0; i-- {
+				addr, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+				if err != nil {
+					break
+				}
+				client = addr.Unmap()
+				if !ContainsAddr(trustedProxies, client) {
+					break
+				}
+			}
+		}
+
+		c.Locals(ClientIPKey, client.String())
+		return c.Next()
+	}
+}
+
+// ClientIP returns the client address derived by RealIP, falling back to
+// the address of the connection
+func ClientIP(c *fiber.Ctx) string {
+	if ip, ok := c.Locals(ClientIPKey).(string); ok {
+		return ip
+	}
+	return c.Context().RemoteIP().String()
+}
+
+// ContainsAddr reports whether addr is inside any of the prefixes
+func ContainsAddr(prefixes []netip.Prefix, addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, prefix := range prefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
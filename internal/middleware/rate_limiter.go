@@ -13,7 +13,7 @@ func GlobalRateLimiter() fiber.Handler {
 		Max:        100,               // Max 100 requests
 		Expiration: 1 * time.Minute,  // Per minute
 		KeyGenerator: func(c *fiber.Ctx) string {
-			return c.IP() // Rate limit by IP address
+			return ClientIP(c) // Rate limit by IP address
 		},
 		LimitReached: func(c *fiber.Ctx) error {
 			return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
@@ -29,7 +29,7 @@ func AuthRateLimiter() fiber.Handler {
 		Max:        5,                 // Max 5 login attempts
 		Expiration: 15 * time.Minute,  // Per 15 minutes
 		KeyGenerator: func(c *fiber.Ctx) string {
-			return c.IP()
+			return ClientIP(c)
 		},
 		LimitReached: func(c *fiber.Ctx) error {
 			return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
@@ -46,7 +46,7 @@ func SharePasswordRateLimiter() fiber.Handler {
 		Expiration: 5 * time.Minute,   // Per 5 minutes
 		KeyGenerator: func(c *fiber.Ctx) string {
 			// Rate limit by IP + share token
-			return c.IP() + ":" + c.Params("token")
+			return ClientIP(c) + ":" + c.Params("token")
 		},
 		LimitReached: func(c *fiber.Ctx) error {
 			c.Set("Content-Type", "text/html")
@@ -61,3 +61,44 @@ func SharePasswordRateLimiter() fiber.Handler {
 		},
 	})
 }
+
+// SharePageRateLimiter limits how fast watermarked preview pages of a share
+// can be rendered
+func SharePageRateLimiter() fiber.Handler {
+	return limiter.New(limiter.Config{
+		Max:        60,              // Max 60 rendered pages
+		Expiration: 1 * time.Minute, // Per minute
+		KeyGenerator: func(c *fiber.Ctx) string {
+			// Rate limit by IP + share token
+			return ClientIP(c) + ":" + c.Params("token")
+		},
+		LimitReached: func(c *fiber.Ctx) error {
+			return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
+				"error": "Too many page requests. Please try again later.",
+			})
+		},
+	})
+}
+
+// FileRequestUploadRateLimiter limits anonymous uploads through file request links
+func FileRequestUploadRateLimiter() fiber.Handler {
+	return limiter.New(limiter.Config{
+		Max:        10,                // Max 10 upload submissions
+		Expiration: 10 * time.Minute, // Per 10 minutes
+		KeyGenerator: func(c *fiber.Ctx) string {
+			// Rate limit by IP + request token
+			return ClientIP(c) + ":" + c.Params("token")
+		},
+		LimitReached: func(c *fiber.Ctx) error {
+			c.Set("Content-Type", "text/html")
+			return c.Status(fiber.StatusTooManyRequests).SendString(`
+				<html><body style="font-family: sans-serif; max-width: 600px; margin: 50px auto; padding: 20px;">
+				<div style="background: #fee; border: 1px solid #fcc; padding: 20px; border-radius: 8px;">
+					<h2 style="color: #c00; margin: 0 0 10px 0;">🚫 Too Many Uploads</h2>
+					<p>Too many uploads from your address. Please wait 10 minutes before trying again.</p>
+				</div>
+				</body></html>
+			`)
+		},
+	})
+}
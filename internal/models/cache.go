@@ -1,6 +1,7 @@
 package models
 
 import (
+	"net/netip"
 	"time"
 
 	"Secure-Document-Exchange-Portal/internal/database"
@@ -10,13 +11,17 @@ import (
 
 // UserCache represents a cached user object
 type UserCache struct {
-	ID           string    `json:"id"`
-	Email        string    `json:"email"`
-	PasswordHash string    `json:"password_hash"`
-	FullName     string    `json:"full_name"`
-	CreatedAt    time.Time `json:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at"`
-	IsActive     bool      `json:"is_active"`
+	ID            string    `json:"id"`
+	Email         string    `json:"email"`
+	PasswordHash  string    `json:"password_hash"`
+	FullName      string    `json:"full_name"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+	IsActive      bool      `json:"is_active"`
+	IsAdmin       bool      `json:"is_admin"`
+	IsLegal       bool      `json:"is_legal"`
+	TOTPEnabled   bool      `json:"totp_enabled"`
+	EmailVerified bool      `json:"email_verified"`
 }
 
 // FromDatabaseUser converts database.User to UserCache
@@ -25,13 +30,17 @@ func FromDatabaseUser(user *database.User) *UserCache {
 		return nil
 	}
 	return &UserCache{
-		ID:           user.ID.String(),
-		Email:        user.Email,
-		PasswordHash: user.PasswordHash,
-		FullName:     user.FullName,
-		CreatedAt:    user.CreatedAt.Time,
-		UpdatedAt:    user.UpdatedAt.Time,
-		IsActive:     user.IsActive.Bool,
+		ID:            user.ID.String(),
+		Email:         user.Email,
+		PasswordHash:  user.PasswordHash,
+		FullName:      user.FullName,
+		CreatedAt:     user.CreatedAt.Time,
+		UpdatedAt:     user.UpdatedAt.Time,
+		IsActive:      user.IsActive.Bool,
+		IsAdmin:       user.IsAdmin,
+		IsLegal:       user.IsLegal,
+		TOTPEnabled:   user.TotpEnabled,
+		EmailVerified: user.EmailVerifiedAt.Valid,
 	}
 }
 
@@ -47,6 +56,8 @@ type DocumentCache struct {
 	Checksum     string    `json:"checksum"`
 	CreatedAt    time.Time `json:"created_at"`
 	UpdatedAt    time.Time `json:"updated_at"`
+	FolderID     string    `json:"folder_id,omitempty"`
+	WorkspaceID  string    `json:"workspace_id"`
 }
 
 // FromDatabaseDocument converts database.Document to DocumentCache
@@ -65,29 +76,32 @@ func FromDatabaseDocument(doc *database.Document) *DocumentCache {
 		Checksum:     doc.Checksum,
 		CreatedAt:    doc.CreatedAt.Time,
 		UpdatedAt:    doc.UpdatedAt.Time,
+		FolderID:     doc.FolderID.String(),
+		WorkspaceID:  doc.WorkspaceID.String(),
 	}
 }
 
-// ShareCache represents a cached share object with joined document info
+// ShareCache represents a cached share object
 type ShareCache struct {
-	ID           string    `json:"id"`
-	DocumentID   string    `json:"document_id"`
-	ShareToken   string    `json:"share_token"`
-	ExpiresAt    time.Time `json:"expires_at"`
-	MaxAccess    int32     `json:"max_access"`
-	AccessCount  int32     `json:"access_count"`
-	PasswordHash *string   `json:"password_hash,omitempty"`
-	CreatedAt    time.Time `json:"created_at"`
-	CreatedBy    string    `json:"created_by"`
+	ID           string         `json:"id"`
+	ShareToken   string         `json:"share_token"`
+	ExpiresAt    time.Time      `json:"expires_at"`
+	MaxAccess    int32          `json:"max_access"`
+	AccessCount  int32          `json:"access_count"`
+	PasswordHash *string        `json:"password_hash,omitempty"`
+	CreatedAt    time.Time      `json:"created_at"`
+	CreatedBy    string         `json:"created_by"`
+	FolderID     string         `json:"folder_id,omitempty"`
+	Name         string         `json:"name,omitempty"`
+	ViewOnly     bool           `json:"view_only"`
+	AllowedCIDRs []netip.Prefix `json:"allowed_cidrs,omitempty"`
 
-	// Joined document information for share access
-	Filename     string `json:"filename"`
-	FilePath     string `json:"file_path"`
-	FileSize     int64  `json:"file_size"`
-	MimeType     string `json:"mime_type"`
+	NotifyOnAccess         string `json:"notify_on_access,omitempty"`
+	NotifyOnLimit          bool   `json:"notify_on_limit,omitempty"`
+	NotifyPasswordFailures int32  `json:"notify_password_failures,omitempty"`
 }
 
-// FromDatabaseShare converts database.Share to ShareCache (without document info)
+// FromDatabaseShare converts database.Share to ShareCache
 func FromDatabaseShare(share *database.Share) *ShareCache {
 	if share == nil {
 		return nil
@@ -100,7 +114,6 @@ func FromDatabaseShare(share *database.Share) *ShareCache {
 
 	return &ShareCache{
 		ID:           share.ID.String(),
-		DocumentID:   share.DocumentID.String(),
 		ShareToken:   share.ShareToken,
 		ExpiresAt:    share.ExpiresAt.Time,
 		MaxAccess:    share.MaxAccess.Int32,
@@ -108,11 +121,74 @@ func FromDatabaseShare(share *database.Share) *ShareCache {
 		PasswordHash: passwordHash,
 		CreatedAt:    share.CreatedAt.Time,
 		CreatedBy:    share.CreatedBy.String(),
+		FolderID:     share.FolderID.String(),
+		Name:         share.Name.String,
+		ViewOnly:     share.ViewOnly,
+		AllowedCIDRs: share.AllowedCidrs,
+
+		NotifyOnAccess:         share.NotifyOnAccess,
+		NotifyOnLimit:          share.NotifyOnLimit,
+		NotifyPasswordFailures: share.NotifyPasswordFailures.Int32,
 	}
 }
 
-// DocumentListCache represents a cached list of documents for a user
+// SessionCache represents a cached server-side login session
+type SessionCache struct {
+	ID         string    `json:"id"`
+	UserID     string    `json:"user_id"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+}
+
+// FromDatabaseSession converts database.Session to SessionCache
+func FromDatabaseSession(session *database.Session) *SessionCache {
+	if session == nil {
+		return nil
+	}
+	lastSeen := session.LastSeenAt.Time
+	if !session.LastSeenAt.Valid {
+		lastSeen = session.CreatedAt.Time
+	}
+	return &SessionCache{
+		ID:         session.ID.String(),
+		UserID:     session.UserID.String(),
+		ExpiresAt:  session.ExpiresAt.Time,
+		LastSeenAt: lastSeen,
+	}
+}
+
+// APIKeyCache represents a cached personal API key
+type APIKeyCache struct {
+	ID         string    `json:"id"`
+	UserID     string    `json:"user_id"`
+	Scopes     []string  `json:"scopes"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+}
+
+// FromDatabaseAPIKey converts database.ApiKey to APIKeyCache. Keys that
+// never expire have a zero ExpiresAt.
+func FromDatabaseAPIKey(key *database.ApiKey) *APIKeyCache {
+	if key == nil {
+		return nil
+	}
+	return &APIKeyCache{
+		ID:         key.ID.String(),
+		UserID:     key.UserID.String(),
+		Scopes:     key.Scopes,
+		ExpiresAt:  key.ExpiresAt.Time,
+		LastUsedAt: key.LastUsedAt.Time,
+	}
+}
+
+// DocumentListCache represents a cached list of documents in a workspace
 type DocumentListCache struct {
 	Documents []DocumentCache `json:"documents"`
 	CachedAt  time.Time       `json:"cached_at"`
 }
+
+// RoleCache represents a user's cached role in a workspace or organization.
+// Role is empty when the user has no access.
+type RoleCache struct {
+	Role string `json:"role"`
+}
@@ -1,5 +1,7 @@
 package models
 
+import "encoding/json"
+
 type RegisterRequest struct {
 	Email    string `json:"email" form:"email" validate:"required,email"`
 	Password string `json:"password" form:"password" validate:"required,min=6"`
@@ -19,7 +21,137 @@ type UserResponse struct {
 }
 
 type LoginResponse struct {
-	Token     string       `json:"token"`
-	User      UserResponse `json:"user"`
-	ExpiresAt string       `json:"expires_at"`
-}
\ No newline at end of file
+	Token            string       `json:"token"`
+	RefreshToken     string       `json:"refresh_token"`
+	User             UserResponse `json:"user"`
+	ExpiresAt        string       `json:"expires_at"`
+	RefreshExpiresAt string       `json:"refresh_expires_at"`
+	RecoveryCodes    []string     `json:"recovery_codes,omitempty"`
+}
+
+// EmailRequest asks for an email to be sent to an address, such as a
+// password reset link
+type EmailRequest struct {
+	Email string `json:"email"`
+}
+
+type ResetPasswordRequest struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+// WebAuthnFinishRequest completes a WebAuthn ceremony. Credential is the
+// PublicKeyCredential returned by the browser, encoded as JSON.
+type WebAuthnFinishRequest struct {
+	CeremonyID     string          `json:"ceremony_id"`
+	ChallengeToken string          `json:"challenge_token"`
+	Name           string          `json:"name"`
+	Credential     json.RawMessage `json:"credential"`
+}
+
+type MFAVerifyRequest struct {
+	ChallengeToken string `json:"challenge_token" form:"challenge_token"`
+	Code           string `json:"code" form:"code"`
+}
+
+// CreateAPIKeyRequest creates a personal API key. Keys without
+// ExpiresInDays never expire.
+type CreateAPIKeyRequest struct {
+	Name          string   `json:"name" form:"name"`
+	Scopes        []string `json:"scopes" form:"scopes"`
+	ExpiresInDays int      `json:"expires_in_days" form:"expires_in_days"`
+}
+
+// NameRequest names a new organization, team or workspace
+type NameRequest struct {
+	Name string `json:"name" form:"name"`
+}
+
+// OrganizationMemberRequest adds a user to an organization or changes
+// their role
+type OrganizationMemberRequest struct {
+	Email string `json:"email" form:"email"`
+	Role  string `json:"role" form:"role"`
+}
+
+// OrganizationMFARequest turns the organization's second factor requirement
+// on or off
+type OrganizationMFARequest struct {
+	RequireMFA bool `json:"require_mfa" form:"require_mfa"`
+}
+
+// WorkspaceMemberRequest gives a user, by email, or a team access to a
+// workspace
+type WorkspaceMemberRequest struct {
+	Email  string `json:"email" form:"email"`
+	TeamID string `json:"team_id" form:"team_id"`
+	Role   string `json:"role" form:"role"`
+}
+
+// DocumentGrantRequest shares a document with a user, by email, or a team
+type DocumentGrantRequest struct {
+	Email      string `json:"email" form:"email"`
+	TeamID     string `json:"team_id" form:"team_id"`
+	Permission string `json:"permission" form:"permission"`
+}
+
+// QuotaRequest puts an account on a storage plan. The quotas override the
+// plan's; omitted ones follow the plan.
+type QuotaRequest struct {
+	Plan           string `json:"plan" form:"plan"`
+	QuotaBytes     *int64 `json:"quota_bytes" form:"quota_bytes"`
+	QuotaDocuments *int32 `json:"quota_documents" form:"quota_documents"`
+}
+
+// TagsRequest replaces the tags of a document
+type TagsRequest struct {
+	Tags []string `json:"tags" form:"tags"`
+}
+
+// RetentionPolicyRequest creates a retention policy for a workspace, or
+// for one of its folders or a tag, or changes the period of one. The
+// period is the sum of the years, months and days; WarnDays defaults to 14.
+type RetentionPolicyRequest struct {
+	FolderID string `json:"folder_id" form:"folder_id"`
+	Tag      string `json:"tag" form:"tag"`
+	Years    int    `json:"years" form:"years"`
+	Months   int    `json:"months" form:"months"`
+	Days     int    `json:"days" form:"days"`
+	WarnDays *int   `json:"warn_days" form:"warn_days"`
+}
+
+// LegalHoldRequest places a legal hold on one document, folder or user,
+// given by ID or, for users, by email. The custodian defaults to the email
+// of the owner of the held data.
+type LegalHoldRequest struct {
+	DocumentID string `json:"document_id" form:"document_id"`
+	FolderID   string `json:"folder_id" form:"folder_id"`
+	UserID     string `json:"user_id" form:"user_id"`
+	Email      string `json:"email" form:"email"`
+	Reason     string `json:"reason" form:"reason"`
+	Custodian  string `json:"custodian" form:"custodian"`
+}
+
+// ReleaseLegalHoldRequest releases a legal hold
+type ReleaseLegalHoldRequest struct {
+	Reason string `json:"reason" form:"reason"`
+}
+
+// LegalRoleRequest grants or revokes the legal role of a user
+type LegalRoleRequest struct {
+	Legal bool `json:"legal" form:"legal"`
+}
+
+// DeleteAccountRequest asks for the current account to be deleted. The
+// user confirms by typing their email address.
+type DeleteAccountRequest struct {
+	ConfirmEmail string `json:"confirm_email" form:"confirm_email"`
+}
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token" form:"refresh_token"`
+}
+type CreateBundleRequest struct {
+	Name        string   `json:"name" form:"name"`
+	DocumentIDs []string `json:"document_ids" form:"document_ids"`
+}
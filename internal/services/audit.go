@@ -0,0 +1,674 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/netip"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"Secure-Document-Exchange-Portal/internal/database"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Audit actions. The part before the dot is the category the export can be
+// filtered by.
+const (
+	AuditRegister             = "auth.register"
+	AuditEmailVerified        = "auth.email_verified"
+	AuditLogin                = "auth.login"
+	AuditLoginFailed          = "auth.login_failed"
+	AuditAccountLocked        = "auth.account_locked"
+	AuditMFAFailed            = "auth.mfa_failed"
+	AuditLogout               = "auth.logout"
+	AuditPasswordResetRequest = "auth.password_reset_requested"
+	AuditPasswordReset        = "auth.password_reset"
+
+	AuditTOTPEnabled         = "mfa.totp_enabled"
+	AuditTOTPDisabled        = "mfa.totp_disabled"
+	AuditRecoveryCodesRenew  = "mfa.recovery_codes_regenerated"
+	AuditSecurityKeyAdded    = "mfa.security_key_added"
+	AuditSecurityKeyRemoved  = "mfa.security_key_removed"
+	AuditSecurityKeyRenamed  = "mfa.security_key_renamed"
+	AuditAPIKeyCreated       = "api_key.created"
+	AuditAPIKeyRevoked       = "api_key.revoked"
+	AuditSessionRevoked      = "session.revoked"
+	AuditOtherSessionsRevoke = "session.others_revoked"
+	AuditNetworksUpdated     = "settings.allowed_networks_updated"
+
+	AuditDataExportRequested  = "account.export_requested"
+	AuditDataExportDownloaded = "account.export_downloaded"
+	AuditDeletionRequested    = "account.deletion_requested"
+	AuditDeletionCanceled     = "account.deletion_canceled"
+	// AuditAccountDeleted is recorded without an actor when an account is
+	// deleted at the end of its grace period
+	AuditAccountDeleted = "account.deleted"
+
+	AuditDocumentUploaded   = "document.uploaded"
+	AuditDocumentDownloaded = "document.downloaded"
+	AuditDocumentViewed     = "document.viewed"
+	AuditDocumentTrashed    = "document.trashed"
+	AuditDocumentRestored   = "document.restored"
+	AuditDocumentDeleted    = "document.deleted"
+	AuditDocumentMoved      = "document.moved"
+	AuditDocumentGranted    = "document.granted"
+	AuditDocumentUngranted  = "document.grant_revoked"
+	AuditDocumentTagged     = "document.tagged"
+	AuditFolderCreated      = "folder.created"
+	AuditFolderDeleted      = "folder.deleted"
+	// AuditDocumentExpired is recorded without an actor when a retention
+	// policy deletes a document
+	AuditDocumentExpired = "document.expired"
+	// AuditDocumentPurged is recorded without an actor when a document is
+	// deleted for good after its time in the trash
+	AuditDocumentPurged = "document.purged"
+
+	AuditRetentionPolicyCreated = "retention_policy.created"
+	AuditRetentionPolicyUpdated = "retention_policy.updated"
+	AuditRetentionPolicyDeleted = "retention_policy.deleted"
+
+	AuditLegalHoldPlaced   = "legal_hold.placed"
+	AuditLegalHoldReleased = "legal_hold.released"
+	// AuditLegalHoldBlocked is recorded when a hold stops a user from
+	// deleting or moving something
+	AuditLegalHoldBlocked = "legal_hold.blocked"
+
+	AuditShareCreated = "share.created"
+	AuditShareRevoked = "share.revoked"
+	// Accesses through share links are recorded as "share." followed by the
+	// share access log action, such as share.download
+
+	AuditFileRequestCreated  = "file_request.created"
+	AuditFileRequestClosed   = "file_request.closed"
+	AuditFileRequestUploaded = "file_request.uploaded"
+
+	AuditOrganizationCreated    = "organization.created"
+	AuditOrganizationMemberSet  = "organization.member_set"
+	AuditOrganizationMemberGone = "organization.member_removed"
+	AuditOrganizationMFASet     = "organization.mfa_set"
+	AuditTeamCreated            = "organization.team_created"
+	AuditTeamDeleted            = "organization.team_deleted"
+	AuditTeamMemberAdded        = "organization.team_member_added"
+	AuditTeamMemberRemoved      = "organization.team_member_removed"
+	AuditWorkspaceCreated       = "workspace.created"
+	AuditWorkspaceMemberSet     = "workspace.member_set"
+	AuditWorkspaceMemberGone    = "workspace.member_removed"
+	AuditWorkspaceDeleted       = "workspace.deleted"
+
+	AuditUserDeactivated    = "admin.user_deactivated"
+	AuditUserActivated      = "admin.user_activated"
+	AuditUserUnlocked       = "admin.user_unlocked"
+	AuditUserMFAReset       = "admin.mfa_reset"
+	AuditUserSessionsRevoke = "admin.sessions_revoked"
+	AuditQuotaSet           = "admin.quota_set"
+	AuditLegalRoleSet       = "admin.legal_role_set"
+	AuditLogExported        = "admin.audit_exported"
+
+	// AuditAccessDenied is recorded for every request answered with 403
+	AuditAccessDenied = "access.denied"
+)
+
+// SecurityAuditActions are the LIKE patterns of the actions the admin
+// console shows as security events
+var SecurityAuditActions = []string{
+	"auth.%", "mfa.%", "api_key.%", "session.%", "account.%", "admin.%", AuditAccessDenied,
+	"share.invalid_password", "share.network_denied",
+}
+
+// auditGenesisHash is the previous hash of the first event
+var auditGenesisHash = strings.Repeat("0", sha256.Size*2)
+
+// AuditEvent is an action to record. The audit log numbers and timestamps
+// it.
+type AuditEvent struct {
+	ActorID uuid.UUID
+	// ActorEmail is looked up from ActorID if empty
+	ActorEmail   string
+	Action       string
+	ResourceType string
+	ResourceID   string
+	IPAddress    string
+	UserAgent    string
+	Details      map[string]string
+}
+
+// AuditEntry is a recorded event in the form its hash covers. Exports use
+// it too, so auditors can check the chain themselves: Hash is the SHA-256
+// of PrevHash, a newline and the JSON encoding of the entry without its
+// hashes.
+type AuditEntry struct {
+	Seq          int64             `json:"seq"`
+	OccurredAt   string            `json:"occurred_at"`
+	ActorID      string            `json:"actor_id"`
+	ActorEmail   string            `json:"actor_email"`
+	Action       string            `json:"action"`
+	ResourceType string            `json:"resource_type"`
+	ResourceID   string            `json:"resource_id"`
+	IPAddress    string            `json:"ip_address"`
+	UserAgent    string            `json:"user_agent"`
+	Details      map[string]string `json:"details"`
+	PrevHash     string            `json:"prev_hash,omitempty"`
+	Hash         string            `json:"hash,omitempty"`
+}
+
+// ComputeHash returns the hash the entry should have
+func (e AuditEntry) ComputeHash() string {
+	prevHash := e.PrevHash
+	e.PrevHash, e.Hash = "", ""
+	if e.Details == nil {
+		e.Details = map[string]string{}
+	}
+	// Encoding a struct of strings and a string map cannot fail, and map
+	// keys are sorted
+	encoded, _ := json.Marshal(e)
+	sum := sha256.New()
+	sum.Write([]byte(prevHash + "\n"))
+	sum.Write(encoded)
+	return hex.EncodeToString(sum.Sum(nil))
+}
+
+// AuditEntryOf converts a stored event
+func AuditEntryOf(row database.AuditEvent) (AuditEntry, error) {
+	entry := AuditEntry{
+		Seq:          row.Seq,
+		OccurredAt:   auditTime(row.OccurredAt.Time),
+		ActorEmail:   row.ActorEmail,
+		Action:       row.Action,
+		ResourceType: row.ResourceType,
+		ResourceID:   row.ResourceID,
+		UserAgent:    row.UserAgent,
+		PrevHash:     row.PrevHash,
+		Hash:         row.Hash,
+	}
+	if row.ActorID.Valid {
+		entry.ActorID = row.ActorID.String()
+	}
+	if row.IpAddress != nil {
+		entry.IPAddress = row.IpAddress.String()
+	}
+	if err := json.Unmarshal(row.Details, &entry.Details); err != nil {
+		return entry, fmt.Errorf("event %d: details: %w", row.Seq, err)
+	}
+	return entry, nil
+}
+
+func auditTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+const (
+	// auditQueueSize is how many events can wait for the writer before
+	// Record blocks
+	auditQueueSize = 1024
+	// auditMaxBatch is how many queued events are appended in one
+	// transaction
+	auditMaxBatch = 100
+	// auditWriteAttempts is how often a batch is tried before its events
+	// are spilled to the spill file
+	auditWriteAttempts = 3
+	// auditMaxBackoff caps the wait between attempts to spill events
+	auditMaxBackoff = 30 * time.Second
+)
+
+// AuditLog appends events to the audit_events table. Every event is chained
+// to the one before it by its hash. Events are queued and appended by a
+// single writer goroutine, in batches, so requests do not wait for the
+// log's lock.
+type AuditLog struct {
+	pool  *pgxpool.Pool
+	db    *database.Queries
+	cache *CachedRepository
+
+	// mu guards closed; Record holds it for reading while it queues, so
+	// Close cannot close the queue under it
+	mu     sync.RWMutex
+	closed bool
+	queue  chan queuedAuditEvent
+	done   chan struct{}
+
+	// Events that cannot be appended are kept in the spill file and
+	// appended before anything newer once the database is back
+	spillPath string
+	spilled   atomic.Int64
+	failures  atomic.Int64
+}
+
+// AuditHealth is the state of the audit log's writer
+type AuditHealth struct {
+	Queued int `json:"queued"`
+	// Spilled is how many events wait in the spill file
+	Spilled int64 `json:"spilled"`
+	// Failures is how many batches in a row could not be appended
+	Failures int64 `json:"failures"`
+}
+
+// Degraded reports whether events are not reaching the database
+func (h AuditHealth) Degraded() bool {
+	return h.Spilled > 0 || h.Failures > 0
+}
+
+// queuedAuditEvent is an event waiting for the writer, with the time it
+// happened
+type queuedAuditEvent struct {
+	event      AuditEvent
+	occurredAt time.Time
+}
+
+// NewAuditLog creates the audit log and starts its writer, which first
+// appends what an earlier run left in the spill file. Close stops it.
+func NewAuditLog(pool *pgxpool.Pool, db *database.Queries, cache *CachedRepository, spillPath string) *AuditLog {
+	a := &AuditLog{
+		pool:      pool,
+		db:        db,
+		cache:     cache,
+		queue:     make(chan queuedAuditEvent, auditQueueSize),
+		done:      make(chan struct{}),
+		spillPath: spillPath,
+	}
+	go a.run()
+	return a
+}
+
+// ErrAuditLogClosed is returned for events recorded after Close
+var ErrAuditLogClosed = errors.New("audit log is closed")
+
+// Record queues an event for the writer. It only blocks while the queue is
+// full, until ctx is done.
+func (a *AuditLog) Record(ctx context.Context, event AuditEvent) error {
+	if event.ActorEmail == "" && event.ActorID != uuid.Nil {
+		if user, err := a.cache.GetUserByID(ctx, event.ActorID); err == nil {
+			event.ActorEmail = user.Email
+		}
+	}
+
+	// The database keeps microseconds
+	queued := queuedAuditEvent{event: event, occurredAt: time.Now().UTC().Truncate(time.Microsecond)}
+
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	if a.closed {
+		return ErrAuditLogClosed
+	}
+	select {
+	case a.queue <- queued:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close appends the events still queued and stops the writer. Events
+// recorded afterwards are refused with ErrAuditLogClosed.
+func (a *AuditLog) Close() {
+	a.mu.Lock()
+	if !a.closed {
+		a.closed = true
+		close(a.queue)
+	}
+	a.mu.Unlock()
+	<-a.done
+}
+
+// Health returns the state of the writer
+func (a *AuditLog) Health() AuditHealth {
+	return AuditHealth{
+		Queued:   len(a.queue),
+		Spilled:  a.spilled.Load(),
+		Failures: a.failures.Load(),
+	}
+}
+
+// run appends queued events until the queue is closed. Whatever has queued
+// up while a batch was written goes into the next one.
+func (a *AuditLog) run() {
+	defer close(a.done)
+
+	if err := a.replay(); err != nil {
+		log.Printf("ALERT: failed to append %d spilled audit events: %v", a.spilled.Load(), err)
+	}
+
+	for first := range a.queue {
+		batch := []queuedAuditEvent{first}
+	fill:
+		for len(batch) < auditMaxBatch {
+			select {
+			case queued, ok := <-a.queue:
+				if !ok {
+					break fill
+				}
+				batch = append(batch, queued)
+			default:
+				break fill
+			}
+		}
+
+		a.write(batch)
+	}
+}
+
+// write appends a batch after the spilled events, so the chain keeps the
+// order events happened in. A batch that cannot be appended is spilled.
+// Events are never dropped: while they cannot be spilled either, the writer
+// keeps trying and Record blocks once the queue is full.
+func (a *AuditLog) write(batch []queuedAuditEvent) {
+	err := a.replay()
+	if err == nil {
+		for attempt := 1; attempt <= auditWriteAttempts; attempt++ {
+			if err = a.append(context.Background(), batch); err == nil {
+				a.failures.Store(0)
+				return
+			}
+			if attempt < auditWriteAttempts {
+				time.Sleep(time.Duration(attempt) * time.Second)
+			}
+		}
+	}
+
+	failures := a.failures.Add(1)
+	log.Printf("ALERT: audit log cannot be written (%d failures in a row), spilling %d events to %s: %v",
+		failures, len(batch), a.spillPath, err)
+	for attempt := 1; ; attempt++ {
+		err := a.spill(batch)
+		if err == nil {
+			return
+		}
+		log.Printf("ALERT: failed to spill %d audit events: %v", len(batch), err)
+		time.Sleep(min(time.Duration(attempt)*time.Second, auditMaxBackoff))
+	}
+}
+
+// spilledAuditEvent is a line of the spill file
+type spilledAuditEvent struct {
+	Event      AuditEvent `json:"event"`
+	OccurredAt time.Time  `json:"occurred_at"`
+}
+
+// spill appends events to the spill file
+func (a *AuditLog) spill(batch []queuedAuditEvent) error {
+	if err := writeSpill(a.spillPath, os.O_APPEND, batch); err != nil {
+		return err
+	}
+	a.spilled.Add(int64(len(batch)))
+	return nil
+}
+
+// writeSpill writes events to a spill file, opened with flag, and syncs it
+func writeSpill(path string, flag int, events []queuedAuditEvent) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|flag, 0o600)
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(f)
+	for _, queued := range events {
+		if err := encoder.Encode(spilledAuditEvent{Event: queued.event, OccurredAt: queued.occurredAt}); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// readSpill returns the events in the spill file
+func (a *AuditLog) readSpill() ([]queuedAuditEvent, error) {
+	f, err := os.Open(a.spillPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var events []queuedAuditEvent
+	decoder := json.NewDecoder(f)
+	for {
+		var spilled spilledAuditEvent
+		err := decoder.Decode(&spilled)
+		if errors.Is(err, io.EOF) {
+			return events, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", a.spillPath, err)
+		}
+		events = append(events, queuedAuditEvent{event: spilled.Event, occurredAt: spilled.OccurredAt})
+	}
+}
+
+// replay appends the events in the spill file and removes it. If that
+// fails partway, the file keeps the events not yet appended.
+func (a *AuditLog) replay() error {
+	if a.spillPath == "" {
+		return nil
+	}
+	events, err := a.readSpill()
+	if err != nil {
+		return err
+	}
+	a.spilled.Store(int64(len(events)))
+	if len(events) == 0 {
+		return nil
+	}
+
+	for len(events) > 0 {
+		batch := events[:min(len(events), auditMaxBatch)]
+		if err := a.append(context.Background(), batch); err != nil {
+			if rewriteErr := a.rewriteSpill(events); rewriteErr != nil {
+				return errors.Join(err, rewriteErr)
+			}
+			return err
+		}
+		events = events[len(batch):]
+		a.spilled.Add(-int64(len(batch)))
+	}
+	log.Printf("Appended spilled audit events from %s", a.spillPath)
+	return os.Remove(a.spillPath)
+}
+
+// rewriteSpill replaces the spill file with events
+func (a *AuditLog) rewriteSpill(events []queuedAuditEvent) error {
+	tmp := a.spillPath + ".tmp"
+	if err := writeSpill(tmp, os.O_TRUNC, events); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, a.spillPath); err != nil {
+		return err
+	}
+	a.spilled.Store(int64(len(events)))
+	return nil
+}
+
+// append adds a batch of events to the chain in one transaction. The lock
+// keeps writers of other instances from chaining to the same event.
+func (a *AuditLog) append(ctx context.Context, batch []queuedAuditEvent) error {
+	tx, err := a.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+	qtx := a.db.WithTx(tx)
+
+	if err := qtx.LockAuditLog(ctx); err != nil {
+		return err
+	}
+	last, err := qtx.GetLastAuditEvent(ctx)
+	if errors.Is(err, pgx.ErrNoRows) {
+		last.Hash = auditGenesisHash
+	} else if err != nil {
+		return err
+	}
+
+	seq, prevHash := last.Seq, last.Hash
+	for _, queued := range batch {
+		event := queued.event
+
+		var ipAddress *netip.Addr
+		if ip, err := netip.ParseAddr(event.IPAddress); err == nil {
+			ipAddress = &ip
+		}
+		details := event.Details
+		if details == nil {
+			details = map[string]string{}
+		}
+		encodedDetails, err := json.Marshal(details)
+		if err != nil {
+			return err
+		}
+
+		seq++
+		entry := AuditEntry{
+			Seq:          seq,
+			OccurredAt:   auditTime(queued.occurredAt),
+			ActorEmail:   event.ActorEmail,
+			Action:       event.Action,
+			ResourceType: event.ResourceType,
+			ResourceID:   event.ResourceID,
+			UserAgent:    event.UserAgent,
+			Details:      details,
+			PrevHash:     prevHash,
+		}
+		if event.ActorID != uuid.Nil {
+			entry.ActorID = event.ActorID.String()
+		}
+		if ipAddress != nil {
+			entry.IPAddress = ipAddress.String()
+		}
+		entry.Hash = entry.ComputeHash()
+
+		if err := qtx.CreateAuditEvent(ctx, database.CreateAuditEventParams{
+			Seq:          entry.Seq,
+			OccurredAt:   pgtype.Timestamptz{Time: queued.occurredAt, Valid: true},
+			ActorID:      pgtype.UUID{Bytes: event.ActorID, Valid: event.ActorID != uuid.Nil},
+			ActorEmail:   entry.ActorEmail,
+			Action:       entry.Action,
+			ResourceType: entry.ResourceType,
+			ResourceID:   entry.ResourceID,
+			IpAddress:    ipAddress,
+			UserAgent:    entry.UserAgent,
+			Details:      encodedDetails,
+			PrevHash:     entry.PrevHash,
+			Hash:         entry.Hash,
+		}); err != nil {
+			return err
+		}
+		prevHash = entry.Hash
+	}
+	return tx.Commit(ctx)
+}
+
+// auditBatchSize is how many events are read at a time
+const auditBatchSize = 500
+
+// AuditFilter selects events to export. Zero fields match everything;
+// Action matches the action or its category, such as "auth".
+type AuditFilter struct {
+	From         time.Time
+	To           time.Time
+	Action       string
+	ActorEmail   string
+	ResourceType string
+	ResourceID   string
+}
+
+// Export calls fn with every event matching the filter, oldest first
+func (a *AuditLog) Export(ctx context.Context, filter AuditFilter, fn func(AuditEntry) error) error {
+	from, to := filter.From, filter.To
+	if to.IsZero() {
+		to = time.Date(9999, 1, 1, 0, 0, 0, 0, time.UTC)
+	}
+
+	var after int64
+	for {
+		rows, err := a.db.ExportAuditEvents(ctx, database.ExportAuditEventsParams{
+			Seq:          after,
+			From:         pgtype.Timestamptz{Time: from, Valid: true},
+			To:           pgtype.Timestamptz{Time: to, Valid: true},
+			Action:       filter.Action,
+			ActorEmail:   filter.ActorEmail,
+			ResourceType: filter.ResourceType,
+			ResourceID:   filter.ResourceID,
+			Limit:        auditBatchSize,
+		})
+		if err != nil {
+			return err
+		}
+		for _, row := range rows {
+			entry, err := AuditEntryOf(row)
+			if err != nil {
+				return err
+			}
+			if err := fn(entry); err != nil {
+				return err
+			}
+			after = row.Seq
+		}
+		if len(rows) < auditBatchSize {
+			return nil
+		}
+	}
+}
+
+// AuditBreak is the first event at which the chain does not hold
+type AuditBreak struct {
+	Seq    int64
+	Reason string
+}
+
+func (b *AuditBreak) Error() string {
+	return fmt.Sprintf("audit log broken at event %d: %s", b.Seq, b.Reason)
+}
+
+// VerifyAuditChain reads the whole audit log in order and checks that the
+// events are numbered without gaps, that each names the hash of the one
+// before it and that each hash matches the event's content. It returns the
+// number of events and the last one, or an *AuditBreak.
+func VerifyAuditChain(ctx context.Context, db *database.Queries) (int64, AuditEntry, error) {
+	var (
+		count int64
+		last  = AuditEntry{Hash: auditGenesisHash}
+	)
+	for {
+		rows, err := db.ListAuditEventsAfter(ctx, database.ListAuditEventsAfterParams{
+			Seq:   last.Seq,
+			Limit: auditBatchSize,
+		})
+		if err != nil {
+			return count, last, err
+		}
+		for _, row := range rows {
+			entry, err := AuditEntryOf(row)
+			if err != nil {
+				return count, last, &AuditBreak{Seq: row.Seq, Reason: err.Error()}
+			}
+			switch {
+			case entry.Seq != last.Seq+1:
+				return count, last, &AuditBreak{Seq: entry.Seq, Reason: fmt.Sprintf("events %d to %d are missing", last.Seq+1, entry.Seq-1)}
+			case entry.PrevHash != last.Hash:
+				return count, last, &AuditBreak{Seq: entry.Seq, Reason: "previous hash does not match the event before"}
+			case entry.Hash != entry.ComputeHash():
+				return count, last, &AuditBreak{Seq: entry.Seq, Reason: "content does not match its hash"}
+			}
+			count++
+			last = entry
+		}
+		if len(rows) < auditBatchSize {
+			return count, last, nil
+		}
+	}
+}
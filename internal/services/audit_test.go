@@ -0,0 +1,181 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"Secure-Document-Exchange-Portal/internal/database"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// A stored event must hash to what Record computed before inserting it, or
+// every event would look tampered with
+func TestAuditEntryHashRoundTrip(t *testing.T) {
+	actorID := uuid.New()
+	occurredAt := time.Date(2026, 10, 18, 9, 30, 0, 123456000, time.UTC)
+	ip := netip.MustParseAddr("203.0.113.7")
+
+	written := AuditEntry{
+		Seq:          7,
+		OccurredAt:   auditTime(occurredAt),
+		ActorID:      actorID.String(),
+		ActorEmail:   "alice@example.com",
+		Action:       AuditDocumentDeleted,
+		ResourceType: "document",
+		ResourceID:   "d0c",
+		IPAddress:    ip.String(),
+		UserAgent:    "curl/8.0",
+		Details:      map[string]string{"filename": "a.pdf", "workspace_id": "w"},
+		PrevHash:     auditGenesisHash,
+	}
+	written.Hash = written.ComputeHash()
+
+	read, err := AuditEntryOf(database.AuditEvent{
+		Seq:          7,
+		OccurredAt:   pgtype.Timestamptz{Time: occurredAt.In(time.FixedZone("CEST", 2*60*60)), Valid: true},
+		ActorID:      pgtype.UUID{Bytes: actorID, Valid: true},
+		ActorEmail:   "alice@example.com",
+		Action:       AuditDocumentDeleted,
+		ResourceType: "document",
+		ResourceID:   "d0c",
+		IpAddress:    &ip,
+		UserAgent:    "curl/8.0",
+		Details:      []byte(`{"workspace_id": "w", "filename": "a.pdf"}`),
+		PrevHash:     auditGenesisHash,
+		Hash:         written.Hash,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := read.ComputeHash(); got != written.Hash {
+		t.Errorf("stored event hashes to %s, written as %s", got, written.Hash)
+	}
+}
+
+func TestAuditEntryHashCoversContent(t *testing.T) {
+	entry := AuditEntry{
+		Seq:        1,
+		OccurredAt: auditTime(time.Now()),
+		Action:     AuditLogin,
+		Details:    map[string]string{"session": "s"},
+		PrevHash:   auditGenesisHash,
+	}
+	hash := entry.ComputeHash()
+
+	changes := map[string]func(*AuditEntry){
+		"seq":       func(e *AuditEntry) { e.Seq = 2 },
+		"action":    func(e *AuditEntry) { e.Action = AuditLogout },
+		"details":   func(e *AuditEntry) { e.Details = map[string]string{"session": "t"} },
+		"prev hash": func(e *AuditEntry) { e.PrevHash = "1" + auditGenesisHash[1:] },
+	}
+	for name, change := range changes {
+		changed := entry
+		change(&changed)
+		if changed.ComputeHash() == hash {
+			t.Errorf("changing the %s keeps the hash", name)
+		}
+	}
+
+	withHash := entry
+	withHash.Hash = hash
+	if withHash.ComputeHash() != hash {
+		t.Error("the hash depends on the stored hash")
+	}
+}
+
+func TestAuditSpillRoundTrip(t *testing.T) {
+	a := &AuditLog{spillPath: filepath.Join(t.TempDir(), "audit-spill.jsonl")}
+	occurredAt := time.Date(2026, 10, 18, 9, 30, 0, 123456000, time.UTC)
+	first := []queuedAuditEvent{
+		{event: AuditEvent{ActorID: uuid.New(), Action: AuditLogin, Details: map[string]string{"session": "s"}}, occurredAt: occurredAt},
+		{event: AuditEvent{Action: AuditLogout, IPAddress: "203.0.113.7"}, occurredAt: occurredAt.Add(time.Second)},
+	}
+	second := []queuedAuditEvent{
+		{event: AuditEvent{Action: AuditDocumentDeleted, ResourceID: "d0c"}, occurredAt: occurredAt.Add(2 * time.Second)},
+	}
+	for _, batch := range [][]queuedAuditEvent{first, second} {
+		if err := a.spill(batch); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := a.Health().Spilled; got != 3 {
+		t.Errorf("Health().Spilled = %d, want 3", got)
+	}
+
+	read, err := a.readSpill()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := append(first, second...)
+	if !reflect.DeepEqual(read, want) {
+		t.Errorf("read back %+v, want %+v", read, want)
+	}
+
+	// Rewriting keeps only the events not yet appended
+	if err := a.rewriteSpill(read[1:]); err != nil {
+		t.Fatal(err)
+	}
+	read, err = a.readSpill()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(read, want[1:]) {
+		t.Errorf("after rewriting read back %+v, want %+v", read, want[1:])
+	}
+}
+
+// Spilled events are appended before newer ones, and the file is removed
+func TestAuditLogReplaysSpill(t *testing.T) {
+	f := newFixtures(t)
+	spillPath := filepath.Join(t.TempDir(), "audit-spill.jsonl")
+	spilledAt := time.Now().UTC().Add(-time.Hour).Truncate(time.Microsecond)
+	if err := writeSpill(spillPath, os.O_APPEND, []queuedAuditEvent{
+		{event: AuditEvent{Action: AuditLoginFailed}, occurredAt: spilledAt},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	audit := NewAuditLog(f.pool, f.db, f.cache, spillPath)
+	if err := audit.Record(f.ctx, AuditEvent{Action: AuditLogin}); err != nil {
+		t.Fatal(err)
+	}
+	audit.Close()
+
+	var actions []string
+	if err := audit.Export(f.ctx, AuditFilter{}, func(entry AuditEntry) error {
+		actions = append(actions, entry.Action)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{AuditLoginFailed, AuditLogin}; !reflect.DeepEqual(actions, want) {
+		t.Errorf("appended %v, want %v", actions, want)
+	}
+	if _, _, err := VerifyAuditChain(f.ctx, f.db); err != nil {
+		t.Errorf("VerifyAuditChain: %v", err)
+	}
+	if _, err := os.Stat(spillPath); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("spill file after replay: %v, want it removed", err)
+	}
+	if health := audit.Health(); health.Degraded() {
+		t.Errorf("Health() = %+v after replay", health)
+	}
+}
+
+func TestAuditLogRecordAfterClose(t *testing.T) {
+	audit := NewAuditLog(nil, nil, nil, filepath.Join(t.TempDir(), "audit-spill.jsonl"))
+	audit.Close()
+	audit.Close()
+
+	if err := audit.Record(context.Background(), AuditEvent{Action: AuditLogin}); !errors.Is(err, ErrAuditLogClosed) {
+		t.Errorf("Record after Close = %v, want ErrAuditLogClosed", err)
+	}
+}
@@ -4,24 +4,31 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"net/netip"
 	"time"
 
 	"Secure-Document-Exchange-Portal/internal/database"
 	"Secure-Document-Exchange-Portal/internal/models"
 
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/redis/go-redis/v9"
 )
 
 // Cache key patterns
 const (
-	CacheKeyUserByID       = "user:id:%s"           // user:id:{uuid}
-	CacheKeyUserByEmail    = "user:email:%s"        // user:email:{email}
-	CacheKeyDocument       = "document:id:%s"       // document:id:{uuid}
-	CacheKeyDocumentsList  = "documents:user:%s"    // documents:user:{userID}
-	CacheKeyShare          = "share:token:%s"       // share:token:{token}
-	CacheKeyShareByID      = "share:id:%s"          // share:id:{uuid}
+	CacheKeyUserByID       = "user:id:%s"                 // user:id:{uuid}
+	CacheKeyUserByEmail    = "user:email:%s"              // user:email:{email}
+	CacheKeyDocument       = "document:id:%s"             // document:id:{uuid}
+	CacheKeyDocumentsList  = "documents:workspace:%s"     // documents:workspace:{workspaceID}
+	CacheKeyShare          = "share:token:%s"             // share:token:{token}
+	CacheKeyShareByID      = "share:id:%s"                // share:id:{uuid}
+	CacheKeySession        = "session:id:%s"              // session:id:{uuid}
+	CacheKeyAPIKey         = "apikey:hash:%s"             // apikey:hash:{sha256}
+	CacheKeyWorkspaceRole  = "workspace:%s:user:%s"       // workspace:{workspaceID}:user:{userID}
+	CacheKeyOrgRole        = "org:%s:user:%s"             // org:{organizationID}:user:{userID}
+	CacheKeyDocumentGrant  = "grant:document:%s:user:%s"  // grant:document:{documentID}:user:{userID}
 
 	// Cache TTLs
 	CacheTTLUser          = 30 * time.Minute
@@ -29,6 +36,11 @@ const (
 	CacheTTLDocument      = 1 * time.Hour
 	CacheTTLDocumentsList = 5 * time.Minute
 	CacheTTLShare         = 1 * time.Hour
+	CacheTTLSession       = 5 * time.Minute
+	CacheTTLAPIKey        = 5 * time.Minute
+	CacheTTLWorkspaceRole = 5 * time.Minute
+	CacheTTLOrgRole       = 5 * time.Minute
+	CacheTTLDocumentGrant = 5 * time.Minute
 )
 
 // CachedRepository provides caching layer for database operations
@@ -144,9 +156,9 @@ func (r *CachedRepository) GetDocumentByID(ctx context.Context, docID uuid.UUID)
 	return docCache, nil
 }
 
-// ListDocumentsByUser retrieves documents for a user with caching
-func (r *CachedRepository) ListDocumentsByUser(ctx context.Context, userID uuid.UUID) ([]models.DocumentCache, error) {
-	cacheKey := fmt.Sprintf(CacheKeyDocumentsList, userID.String())
+// ListDocumentsByWorkspace retrieves the documents of a workspace with caching
+func (r *CachedRepository) ListDocumentsByWorkspace(ctx context.Context, workspaceID uuid.UUID) ([]models.DocumentCache, error) {
+	cacheKey := fmt.Sprintf(CacheKeyDocumentsList, workspaceID.String())
 
 	// Try cache first
 	var cachedList models.DocumentListCache
@@ -159,11 +171,11 @@ func (r *CachedRepository) ListDocumentsByUser(ctx context.Context, userID uuid.
 	}
 
 	if err != nil && !errors.Is(err, redis.Nil) {
-		fmt.Printf("Cache error for user documents %s: %v\n", userID, err)
+		fmt.Printf("Cache error for workspace documents %s: %v\n", workspaceID, err)
 	}
 
 	// Cache miss - query database
-	docs, err := r.db.ListDocumentsByUser(ctx, pgtype.UUID{Bytes: userID, Valid: true})
+	docs, err := r.db.ListDocumentsByWorkspace(ctx, pgtype.UUID{Bytes: workspaceID, Valid: true})
 	if err != nil {
 		return nil, err
 	}
@@ -184,20 +196,155 @@ func (r *CachedRepository) ListDocumentsByUser(ctx context.Context, userID uuid.
 	return docCaches, nil
 }
 
-// InvalidateUserDocuments removes document list cache for a user
-func (r *CachedRepository) InvalidateUserDocuments(ctx context.Context, userID uuid.UUID) {
-	cacheKey := fmt.Sprintf(CacheKeyDocumentsList, userID.String())
+// InvalidateWorkspaceDocuments removes the document list cache of a workspace
+func (r *CachedRepository) InvalidateWorkspaceDocuments(ctx context.Context, workspaceID uuid.UUID) {
+	cacheKey := fmt.Sprintf(CacheKeyDocumentsList, workspaceID.String())
 	_ = r.cache.Delete(ctx, cacheKey)
 }
 
 // InvalidateDocument removes document cache
-func (r *CachedRepository) InvalidateDocument(ctx context.Context, docID uuid.UUID, userID uuid.UUID) {
+func (r *CachedRepository) InvalidateDocument(ctx context.Context, docID uuid.UUID, workspaceID uuid.UUID) {
 	_ = r.cache.Delete(ctx, fmt.Sprintf(CacheKeyDocument, docID.String()))
-	// Also invalidate the user's document list
-	r.InvalidateUserDocuments(ctx, userID)
+	// Also invalidate the workspace's document list
+	r.InvalidateWorkspaceDocuments(ctx, workspaceID)
 }
 
-// GetShareByToken retrieves a share by token with document info (for AccessShare)
+// GetWorkspaceRole returns a user's role in a workspace with caching, or an
+// empty string when the user has no access. Every document request checks
+// it.
+func (r *CachedRepository) GetWorkspaceRole(ctx context.Context, workspaceID, userID uuid.UUID) (string, error) {
+	cacheKey := fmt.Sprintf(CacheKeyWorkspaceRole, workspaceID.String(), userID.String())
+
+	var cachedRole models.RoleCache
+	err := r.cache.Get(ctx, cacheKey, &cachedRole)
+	if err == nil {
+		return cachedRole.Role, nil
+	}
+
+	if err != nil && !errors.Is(err, redis.Nil) {
+		fmt.Printf("Cache error for workspace role %s/%s: %v\n", workspaceID, userID, err)
+	}
+
+	role, err := r.db.GetWorkspaceRole(ctx, database.GetWorkspaceRoleParams{
+		WorkspaceID: pgtype.UUID{Bytes: workspaceID, Valid: true},
+		UserID:      pgtype.UUID{Bytes: userID, Valid: true},
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		role = ""
+	} else if err != nil {
+		return "", err
+	}
+
+	// Short TTL bounds how long removed access survives a failed invalidation
+	_ = r.cache.Set(ctx, cacheKey, models.RoleCache{Role: role}, CacheTTLWorkspaceRole)
+
+	return role, nil
+}
+
+// InvalidateWorkspaceRoles removes the cached roles of everyone in a
+// workspace, after its members changed
+func (r *CachedRepository) InvalidateWorkspaceRoles(ctx context.Context, workspaceID uuid.UUID) {
+	_ = r.cache.DeletePattern(ctx, fmt.Sprintf(CacheKeyWorkspaceRole, workspaceID.String(), "*"))
+}
+
+// InvalidateUserWorkspaceRoles removes a user's cached roles in every
+// workspace, after their team or organization memberships changed
+func (r *CachedRepository) InvalidateUserWorkspaceRoles(ctx context.Context, userID uuid.UUID) {
+	_ = r.cache.DeletePattern(ctx, fmt.Sprintf(CacheKeyWorkspaceRole, "*", userID.String()))
+}
+
+// InvalidateAllWorkspaceRoles removes every cached workspace role, after a
+// team with access to workspaces was deleted
+func (r *CachedRepository) InvalidateAllWorkspaceRoles(ctx context.Context) {
+	_ = r.cache.DeletePattern(ctx, fmt.Sprintf(CacheKeyWorkspaceRole, "*", "*"))
+}
+
+// GetOrganizationRole returns a user's role in an organization with
+// caching, or an empty string when the user is not a member
+func (r *CachedRepository) GetOrganizationRole(ctx context.Context, organizationID, userID uuid.UUID) (string, error) {
+	cacheKey := fmt.Sprintf(CacheKeyOrgRole, organizationID.String(), userID.String())
+
+	var cachedRole models.RoleCache
+	err := r.cache.Get(ctx, cacheKey, &cachedRole)
+	if err == nil {
+		return cachedRole.Role, nil
+	}
+
+	if err != nil && !errors.Is(err, redis.Nil) {
+		fmt.Printf("Cache error for organization role %s/%s: %v\n", organizationID, userID, err)
+	}
+
+	role, err := r.db.GetOrganizationRole(ctx, database.GetOrganizationRoleParams{
+		OrganizationID: pgtype.UUID{Bytes: organizationID, Valid: true},
+		UserID:         pgtype.UUID{Bytes: userID, Valid: true},
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		role = ""
+	} else if err != nil {
+		return "", err
+	}
+
+	_ = r.cache.Set(ctx, cacheKey, models.RoleCache{Role: role}, CacheTTLOrgRole)
+
+	return role, nil
+}
+
+// InvalidateOrganizationRole removes a user's cached organization role,
+// after they joined, left or got another role
+func (r *CachedRepository) InvalidateOrganizationRole(ctx context.Context, organizationID, userID uuid.UUID) {
+	_ = r.cache.Delete(ctx, fmt.Sprintf(CacheKeyOrgRole, organizationID.String(), userID.String()))
+}
+
+// GetDocumentGrant returns the permission a document was shared with a
+// user with, directly or through a team, with caching. It is an empty
+// string when the document was not shared with them.
+func (r *CachedRepository) GetDocumentGrant(ctx context.Context, documentID, userID uuid.UUID) (string, error) {
+	cacheKey := fmt.Sprintf(CacheKeyDocumentGrant, documentID.String(), userID.String())
+
+	var cachedGrant models.RoleCache
+	err := r.cache.Get(ctx, cacheKey, &cachedGrant)
+	if err == nil {
+		return cachedGrant.Role, nil
+	}
+
+	if err != nil && !errors.Is(err, redis.Nil) {
+		fmt.Printf("Cache error for document grant %s/%s: %v\n", documentID, userID, err)
+	}
+
+	permission, err := r.db.GetDocumentGrant(ctx, database.GetDocumentGrantParams{
+		DocumentID: pgtype.UUID{Bytes: documentID, Valid: true},
+		UserID:     pgtype.UUID{Bytes: userID, Valid: true},
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		permission = ""
+	} else if err != nil {
+		return "", err
+	}
+
+	_ = r.cache.Set(ctx, cacheKey, models.RoleCache{Role: permission}, CacheTTLDocumentGrant)
+
+	return permission, nil
+}
+
+// InvalidateDocumentGrants removes the cached grants of a document, after
+// it was shared or a grant was revoked
+func (r *CachedRepository) InvalidateDocumentGrants(ctx context.Context, documentID uuid.UUID) {
+	_ = r.cache.DeletePattern(ctx, fmt.Sprintf(CacheKeyDocumentGrant, documentID.String(), "*"))
+}
+
+// InvalidateUserDocumentGrants removes a user's cached grants, after their
+// team memberships changed
+func (r *CachedRepository) InvalidateUserDocumentGrants(ctx context.Context, userID uuid.UUID) {
+	_ = r.cache.DeletePattern(ctx, fmt.Sprintf(CacheKeyDocumentGrant, "*", userID.String()))
+}
+
+// InvalidateAllDocumentGrants removes every cached grant, after a team that
+// documents may have been shared with was deleted
+func (r *CachedRepository) InvalidateAllDocumentGrants(ctx context.Context) {
+	_ = r.cache.DeletePattern(ctx, fmt.Sprintf(CacheKeyDocumentGrant, "*", "*"))
+}
+
+// GetShareByToken retrieves a share by token (for AccessShare)
 // This is the most frequently accessed query and benefits most from caching
 func (r *CachedRepository) GetShareByToken(ctx context.Context, token string) (*models.ShareCache, error) {
 	cacheKey := fmt.Sprintf(CacheKeyShare, token)
@@ -214,31 +361,13 @@ func (r *CachedRepository) GetShareByToken(ctx context.Context, token string) (*
 	}
 
 	// Cache miss - query database
-	// Note: The database query returns joined data with document info
 	shareData, err := r.db.GetShareByToken(ctx, token)
 	if err != nil {
 		return nil, err
 	}
 
-	// Convert to cache-friendly format with document info
-	shareCache := &models.ShareCache{
-		ID:           shareData.ID.String(),
-		DocumentID:   shareData.DocumentID.String(),
-		ShareToken:   shareData.ShareToken,
-		ExpiresAt:    shareData.ExpiresAt.Time,
-		MaxAccess:    shareData.MaxAccess.Int32,
-		AccessCount:  shareData.AccessCount.Int32,
-		CreatedAt:    shareData.CreatedAt.Time,
-		CreatedBy:    shareData.CreatedBy.String(),
-		Filename:     shareData.Filename,
-		FilePath:     shareData.FilePath,
-		FileSize:     shareData.FileSize,
-		MimeType:     shareData.MimeType,
-	}
-
-	if shareData.PasswordHash.Valid {
-		shareCache.PasswordHash = &shareData.PasswordHash.String
-	}
+	// Convert to cache-friendly format
+	shareCache := models.FromDatabaseShare(&shareData)
 
 	// Store in cache with shorter TTL (to ensure freshness for access counts)
 	_ = r.cache.Set(ctx, cacheKey, shareCache, CacheTTLShare)
@@ -256,3 +385,98 @@ func (r *CachedRepository) InvalidateShare(ctx context.Context, token string) {
 func (r *CachedRepository) InvalidateAllShares(ctx context.Context) {
 	_ = r.cache.DeletePattern(ctx, "share:*")
 }
+
+// GetSessionByID retrieves a login session with caching. Every
+// authenticated request checks its session, so this sits on the hot path.
+func (r *CachedRepository) GetSessionByID(ctx context.Context, sessionID uuid.UUID) (*models.SessionCache, error) {
+	cacheKey := fmt.Sprintf(CacheKeySession, sessionID.String())
+
+	var cachedSession models.SessionCache
+	err := r.cache.Get(ctx, cacheKey, &cachedSession)
+	if err == nil {
+		return &cachedSession, nil
+	}
+
+	if err != nil && !errors.Is(err, redis.Nil) {
+		fmt.Printf("Cache error for session %s: %v\n", sessionID, err)
+	}
+
+	session, err := r.db.GetSessionByID(ctx, pgtype.UUID{Bytes: sessionID, Valid: true})
+	if err != nil {
+		return nil, err
+	}
+
+	sessionCache := models.FromDatabaseSession(&session)
+
+	// Short TTL bounds how long a revoked session survives a failed invalidation
+	_ = r.cache.Set(ctx, cacheKey, sessionCache, CacheTTLSession)
+
+	return sessionCache, nil
+}
+
+// InvalidateSession removes a session from the cache
+func (r *CachedRepository) InvalidateSession(ctx context.Context, sessionID uuid.UUID) {
+	_ = r.cache.Delete(ctx, fmt.Sprintf(CacheKeySession, sessionID.String()))
+}
+
+// TouchSession records that a session was just used
+func (r *CachedRepository) TouchSession(ctx context.Context, sessionID uuid.UUID) error {
+	if err := r.db.TouchSession(ctx, pgtype.UUID{Bytes: sessionID, Valid: true}); err != nil {
+		return err
+	}
+	r.InvalidateSession(ctx, sessionID)
+	return nil
+}
+
+// InvalidateSessions removes several sessions from the cache
+func (r *CachedRepository) InvalidateSessions(ctx context.Context, sessionIDs []pgtype.UUID) {
+	for _, id := range sessionIDs {
+		r.InvalidateSession(ctx, id.Bytes)
+	}
+}
+
+// GetAPIKeyByHash retrieves an API key by the hash of its secret with
+// caching. Like sessions, keys are checked on every request they make.
+func (r *CachedRepository) GetAPIKeyByHash(ctx context.Context, keyHash string) (*models.APIKeyCache, error) {
+	cacheKey := fmt.Sprintf(CacheKeyAPIKey, keyHash)
+
+	var cachedKey models.APIKeyCache
+	err := r.cache.Get(ctx, cacheKey, &cachedKey)
+	if err == nil {
+		return &cachedKey, nil
+	}
+
+	if err != nil && !errors.Is(err, redis.Nil) {
+		fmt.Printf("Cache error for API key: %v\n", err)
+	}
+
+	key, err := r.db.GetAPIKeyByHash(ctx, keyHash)
+	if err != nil {
+		return nil, err
+	}
+
+	keyCache := models.FromDatabaseAPIKey(&key)
+
+	// Short TTL bounds how long a revoked key survives a failed invalidation
+	_ = r.cache.Set(ctx, cacheKey, keyCache, CacheTTLAPIKey)
+
+	return keyCache, nil
+}
+
+// InvalidateAPIKey removes an API key from the cache
+func (r *CachedRepository) InvalidateAPIKey(ctx context.Context, keyHash string) {
+	_ = r.cache.Delete(ctx, fmt.Sprintf(CacheKeyAPIKey, keyHash))
+}
+
+// TouchAPIKey records that an API key was just used from ip
+func (r *CachedRepository) TouchAPIKey(ctx context.Context, keyID uuid.UUID, keyHash string, ip *netip.Addr) error {
+	err := r.db.TouchAPIKey(ctx, database.TouchAPIKeyParams{
+		ID:         pgtype.UUID{Bytes: keyID, Valid: true},
+		LastUsedIp: ip,
+	})
+	if err != nil {
+		return err
+	}
+	r.InvalidateAPIKey(ctx, keyHash)
+	return nil
+}
@@ -0,0 +1,185 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"Secure-Document-Exchange-Portal/internal/database"
+	"Secure-Document-Exchange-Portal/internal/database/dbtest"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/minio/minio-go/v7"
+)
+
+// fixtures builds the rows tests need in a database of their own
+type fixtures struct {
+	t      *testing.T
+	ctx    context.Context
+	pool   *pgxpool.Pool
+	db     *database.Queries
+	cache  *CachedRepository
+	quotas *QuotaService
+}
+
+func newFixtures(t *testing.T) *fixtures {
+	t.Helper()
+
+	pool, db := dbtest.New(t)
+	return &fixtures{
+		t:      t,
+		ctx:    context.Background(),
+		pool:   pool,
+		db:     db,
+		cache:  NewCachedRepository(db, &RedisCache{}),
+		quotas: NewQuotaService(pool, db),
+	}
+}
+
+// in returns fixtures sharing the database that report to the subtest t
+func (f *fixtures) in(t *testing.T) *fixtures {
+	sub := *f
+	sub.t = t
+	return &sub
+}
+
+// auditLog returns an audit log that is closed when the test ends
+func (f *fixtures) auditLog() *AuditLog {
+	audit := NewAuditLog(f.pool, f.db, f.cache, filepath.Join(f.t.TempDir(), "audit-spill.jsonl"))
+	f.t.Cleanup(audit.Close)
+	return audit
+}
+
+func (f *fixtures) id(query string, args ...any) pgtype.UUID {
+	f.t.Helper()
+
+	var id pgtype.UUID
+	if err := f.pool.QueryRow(f.ctx, query, args...).Scan(&id); err != nil {
+		f.t.Fatal(err)
+	}
+	return id
+}
+
+// user creates a user with a personal workspace
+func (f *fixtures) user() (user, workspace pgtype.UUID) {
+	f.t.Helper()
+
+	user = f.id(`INSERT INTO users (email, password_hash, full_name) VALUES ($1, 'x', 'Test') RETURNING id`,
+		uuid.NewString()+"@example.com")
+	workspace = f.id(`INSERT INTO workspaces (personal_user_id, name) VALUES ($1, 'Personal') RETURNING id`, user)
+	return user, workspace
+}
+
+// organization creates an organization with a workspace and members with
+// the given roles
+func (f *fixtures) organization(members map[pgtype.UUID]string) (organization, workspace pgtype.UUID) {
+	f.t.Helper()
+
+	organization = f.id(`INSERT INTO organizations (name) VALUES ('Org') RETURNING id`)
+	workspace = f.id(`INSERT INTO workspaces (organization_id, name) VALUES ($1, 'Shared') RETURNING id`, organization)
+	for user, role := range members {
+		if _, err := f.pool.Exec(f.ctx, `INSERT INTO organization_members (organization_id, user_id, role) VALUES ($1, $2, $3)`,
+			organization, user, role); err != nil {
+			f.t.Fatal(err)
+		}
+	}
+	return organization, workspace
+}
+
+func (f *fixtures) folder(user, workspace pgtype.UUID) pgtype.UUID {
+	f.t.Helper()
+	return f.id(`INSERT INTO folders (user_id, name, workspace_id) VALUES ($1, 'Folder', $2) RETURNING id`, user, workspace)
+}
+
+// document uploads a document of size bytes through the quotas
+func (f *fixtures) document(user, workspace pgtype.UUID, size int64) database.Document {
+	f.t.Helper()
+
+	doc, _, err := f.quotas.CreateDocument(f.ctx, database.CreateDocumentParams{
+		UserID:       user,
+		Filename:     "a.pdf",
+		FilePath:     "files/" + uuid.NewString(),
+		EncryptedKey: "key",
+		FileSize:     size,
+		MimeType:     "application/pdf",
+		Checksum:     "sum",
+		WorkspaceID:  workspace,
+	})
+	if err != nil {
+		f.t.Fatal(err)
+	}
+	return doc
+}
+
+func (f *fixtures) hold(resourceType string, resourceID pgtype.UUID) pgtype.UUID {
+	f.t.Helper()
+	return f.id(`INSERT INTO legal_holds (resource_type, resource_id, reason, custodian) VALUES ($1, $2, 'test', 'legal') RETURNING id`,
+		resourceType, resourceID)
+}
+
+func (f *fixtures) release(hold pgtype.UUID) {
+	f.t.Helper()
+	if _, err := f.pool.Exec(f.ctx, `UPDATE legal_holds SET released_at = CURRENT_TIMESTAMP WHERE id = $1`, hold); err != nil {
+		f.t.Fatal(err)
+	}
+}
+
+// usage returns a user's storage usage
+func (f *fixtures) usage(user pgtype.UUID) Usage {
+	f.t.Helper()
+
+	usage, err := f.quotas.UserUsage(f.ctx, user.Bytes)
+	if err != nil {
+		f.t.Fatal(err)
+	}
+	return usage
+}
+
+// memoryStorage keeps objects in memory. Objects named in fail cannot be
+// deleted.
+type memoryStorage struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+	fail    map[string]bool
+}
+
+func newMemoryStorage() *memoryStorage {
+	return &memoryStorage{objects: make(map[string][]byte), fail: make(map[string]bool)}
+}
+
+func (s *memoryStorage) Upload(ctx context.Context, bucketName, objectName string, reader io.Reader, objectSize int64, opts minio.PutObjectOptions) (minio.UploadInfo, error) {
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return minio.UploadInfo{}, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.objects[objectName] = data
+	return minio.UploadInfo{Key: objectName, Size: int64(len(data))}, nil
+}
+
+func (s *memoryStorage) Download(ctx context.Context, bucketName, objectName string, opts minio.GetObjectOptions) (io.ReadCloser, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, ok := s.objects[objectName]
+	if !ok {
+		return nil, errors.New("object not found")
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+func (s *memoryStorage) Delete(ctx context.Context, bucketName, objectName string, opts minio.RemoveObjectOptions) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.fail[objectName] {
+		return errors.New("storage unavailable")
+	}
+	delete(s.objects, objectName)
+	return nil
+}
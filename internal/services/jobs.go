@@ -1,14 +1,45 @@
 package services
 
-import "github.com/hibiken/asynq"
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"Secure-Document-Exchange-Portal/internal/database"
+
+	"github.com/hibiken/asynq"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// Background task types
+const (
+	TypeSendNotification = "notification:send"
+	TypeSendEmail        = "email:send"
+	TypeShareExpiryScan  = "share:expiry_scan"
+	TypeSessionCleanup   = "session:cleanup"
+	TypeRetentionEnforce = "retention:enforce"
+	TypeTrashPurge       = "trash:purge"
+	TypeDataExport       = "account:data_export"
+	TypeAccountCleanup   = "account:cleanup"
+)
 
 type JobService struct {
-	client *asynq.Client
+	client    *asynq.Client
+	inspector *asynq.Inspector
 }
 
-func NewJobService(redisAddr string) *JobService {
-	client := asynq.NewClient(asynq.RedisClientOpt{Addr: redisAddr})
-	return &JobService{client: client}
+func NewJobService(redisAddr, redisPassword string, redisDB int) *JobService {
+	opt := asynq.RedisClientOpt{
+		Addr:     redisAddr,
+		Password: redisPassword,
+		DB:       redisDB,
+	}
+	return &JobService{
+		client:    asynq.NewClient(opt),
+		inspector: asynq.NewInspector(opt),
+	}
 }
 
 func (j *JobService) Enqueue(task *asynq.Task) error {
@@ -16,6 +47,224 @@ func (j *JobService) Enqueue(task *asynq.Task) error {
 	return err
 }
 
+// Queues returns the state of every job queue, for the admin console
+func (j *JobService) Queues() ([]*asynq.QueueInfo, error) {
+	names, err := j.inspector.Queues()
+	if err != nil {
+		return nil, err
+	}
+
+	queues := make([]*asynq.QueueInfo, 0, len(names))
+	for _, name := range names {
+		info, err := j.inspector.GetQueueInfo(name)
+		if err != nil {
+			return nil, fmt.Errorf("queue %s: %w", name, err)
+		}
+		queues = append(queues, info)
+	}
+	return queues, nil
+}
+
+// FailedTasks returns up to limit tasks of a queue that are waiting to be
+// retried or gave up, the ones that need attention
+func (j *JobService) FailedTasks(queue string, limit int) ([]*asynq.TaskInfo, error) {
+	retry, err := j.inspector.ListRetryTasks(queue, asynq.PageSize(limit))
+	if err != nil {
+		return nil, err
+	}
+	archived, err := j.inspector.ListArchivedTasks(queue, asynq.PageSize(limit))
+	if err != nil {
+		return nil, err
+	}
+
+	tasks := append(retry, archived...)
+	if len(tasks) > limit {
+		tasks = tasks[:limit]
+	}
+	return tasks, nil
+}
+
 func (j *JobService) Close() error {
+	j.inspector.Close()
 	return j.client.Close()
 }
+
+// QueuedNotifier hands notifications to the job queue so that request
+// handlers never wait for SMTP servers or webhooks
+type QueuedNotifier struct {
+	jobs *JobService
+}
+
+func NewQueuedNotifier(jobs *JobService) *QueuedNotifier {
+	return &QueuedNotifier{jobs: jobs}
+}
+
+func (n *QueuedNotifier) Notify(ctx context.Context, notification Notification) error {
+	payload, err := json.Marshal(notification)
+	if err != nil {
+		return err
+	}
+
+	return n.jobs.Enqueue(asynq.NewTask(TypeSendNotification, payload, asynq.MaxRetry(5), asynq.Timeout(time.Minute)))
+}
+
+// QueuedMailer hands account emails to the job queue, so responses do not
+// reveal whether an email was sent or wait for the SMTP server
+type QueuedMailer struct {
+	jobs *JobService
+}
+
+func NewQueuedMailer(jobs *JobService) *QueuedMailer {
+	return &QueuedMailer{jobs: jobs}
+}
+
+func (m *QueuedMailer) Send(ctx context.Context, email Email) error {
+	payload, err := json.Marshal(email)
+	if err != nil {
+		return err
+	}
+
+	return m.jobs.Enqueue(asynq.NewTask(TypeSendEmail, payload, asynq.MaxRetry(5), asynq.Timeout(time.Minute)))
+}
+
+// MailWorker sends queued account emails
+type MailWorker struct {
+	mailer Mailer
+}
+
+func NewMailWorker(mailer Mailer) *MailWorker {
+	return &MailWorker{mailer: mailer}
+}
+
+// Register adds the worker's task handlers to mux
+func (w *MailWorker) Register(mux *asynq.ServeMux) {
+	mux.HandleFunc(TypeSendEmail, w.HandleSendEmail)
+}
+
+func (w *MailWorker) HandleSendEmail(ctx context.Context, task *asynq.Task) error {
+	var email Email
+	if err := json.Unmarshal(task.Payload(), &email); err != nil {
+		return fmt.Errorf("invalid email payload: %v: %w", err, asynq.SkipRetry)
+	}
+
+	return w.mailer.Send(ctx, email)
+}
+
+// NotificationWorker processes queued notifications and the periodic scan
+// for shares that are about to expire
+type NotificationWorker struct {
+	db       *database.Queries
+	notifier Notifier
+}
+
+func NewNotificationWorker(db *database.Queries, notifier Notifier) *NotificationWorker {
+	return &NotificationWorker{
+		db:       db,
+		notifier: notifier,
+	}
+}
+
+// Register adds the worker's task handlers to mux
+func (w *NotificationWorker) Register(mux *asynq.ServeMux) {
+	mux.HandleFunc(TypeSendNotification, w.HandleSendNotification)
+	mux.HandleFunc(TypeShareExpiryScan, w.HandleShareExpiryScan)
+}
+
+func (w *NotificationWorker) HandleSendNotification(ctx context.Context, task *asynq.Task) error {
+	var notification Notification
+	if err := json.Unmarshal(task.Payload(), &notification); err != nil {
+		return fmt.Errorf("invalid notification payload: %v: %w", err, asynq.SkipRetry)
+	}
+
+	return w.deliver(ctx, notification)
+}
+
+// HandleShareExpiryScan notifies owners once about each share that expires
+// within the number of hours they asked to be warned
+func (w *NotificationWorker) HandleShareExpiryScan(ctx context.Context, task *asynq.Task) error {
+	shares, err := w.db.ListSharesExpiringSoon(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list expiring shares: %w", err)
+	}
+
+	for _, share := range shares {
+		// Claim the share first so overlapping scans do not notify twice
+		claimed, err := w.db.MarkShareExpiryNotified(ctx, share.ID)
+		if err != nil {
+			log.Printf("Failed to mark share %s as notified: %v", share.ID.String(), err)
+			continue
+		}
+		if claimed == 0 {
+			continue
+		}
+
+		name := share.Name.String
+		if name == "" {
+			name = "share " + share.ShareToken[:8]
+		}
+		remaining := time.Until(share.ExpiresAt.Time).Round(time.Minute)
+
+		err = w.deliver(ctx, Notification{
+			UserID:  share.CreatedBy.Bytes,
+			Event:   EventShareExpiring,
+			Subject: fmt.Sprintf("Share \"%s\" expires soon", name),
+			Body: fmt.Sprintf("Your share \"%s\" expires in %s, at %s.",
+				name, remaining, share.ExpiresAt.Time.UTC().Format("2006-01-02 15:04 MST")),
+			Data: map[string]string{
+				"share_id":   share.ID.String(),
+				"expires_at": share.ExpiresAt.Time.Format(time.RFC3339),
+			},
+		})
+		if err != nil {
+			log.Printf("Failed to send expiry notification for share %s: %v", share.ID.String(), err)
+		}
+	}
+
+	return nil
+}
+
+// deliver fills in the recipient's email address if needed and sends the
+// notification
+func (w *NotificationWorker) deliver(ctx context.Context, notification Notification) error {
+	if notification.Email == "" {
+		user, err := w.db.GetUserByID(ctx, pgtype.UUID{Bytes: notification.UserID, Valid: true})
+		if err != nil {
+			return fmt.Errorf("failed to load notification recipient: %w", err)
+		}
+		notification.Email = user.Email
+	}
+
+	return w.notifier.Notify(ctx, notification)
+}
+
+// MaintenanceWorker removes data that is no longer needed
+type MaintenanceWorker struct {
+	db *database.Queries
+}
+
+func NewMaintenanceWorker(db *database.Queries) *MaintenanceWorker {
+	return &MaintenanceWorker{db: db}
+}
+
+// Register adds the worker's task handlers to mux
+func (w *MaintenanceWorker) Register(mux *asynq.ServeMux) {
+	mux.HandleFunc(TypeSessionCleanup, w.HandleSessionCleanup)
+}
+
+// HandleSessionCleanup deletes expired login sessions, abandoned WebAuthn
+// ceremonies and SSO logins, and expired account tokens
+func (w *MaintenanceWorker) HandleSessionCleanup(ctx context.Context, task *asynq.Task) error {
+	if err := w.db.DeleteExpiredSessions(ctx); err != nil {
+		return fmt.Errorf("failed to delete expired sessions: %w", err)
+	}
+	if err := w.db.DeleteExpiredWebAuthnChallenges(ctx); err != nil {
+		return fmt.Errorf("failed to delete expired WebAuthn challenges: %w", err)
+	}
+	if err := w.db.DeleteExpiredOIDCAuthRequests(ctx); err != nil {
+		return fmt.Errorf("failed to delete expired SSO login requests: %w", err)
+	}
+	if err := w.db.DeleteExpiredAccountTokens(ctx); err != nil {
+		return fmt.Errorf("failed to delete expired account tokens: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// Owners are warned once about each share entering its warning period,
+// however often the scan runs
+func TestShareExpiryScanNotifiesOnce(t *testing.T) {
+	f := newFixtures(t)
+	notifier := NewMemoryNotifier()
+	worker := NewNotificationWorker(f.db, notifier)
+
+	owner, _ := f.user()
+	share := func(expiresIn time.Duration, warnHours int32) pgtype.UUID {
+		return f.id(`INSERT INTO shares (share_token, expires_at, created_by, notify_expiring_hours) VALUES ($1, $2, $3, $4) RETURNING id`,
+			uuid.NewString(), time.Now().Add(expiresIn), owner, pgtype.Int4{Int32: warnHours, Valid: warnHours > 0})
+	}
+	expiring := share(time.Hour, 2)
+	share(5*time.Hour, 2)  // not in its warning period yet
+	share(time.Hour, 0)    // no warning asked for
+	share(-time.Minute, 2) // expired already
+
+	for range 3 {
+		if err := worker.HandleShareExpiryScan(f.ctx, nil); err != nil {
+			t.Fatalf("HandleShareExpiryScan: %v", err)
+		}
+	}
+
+	notifications := notifier.Notifications()
+	if len(notifications) != 1 {
+		t.Fatalf("%d notifications, want 1: %+v", len(notifications), notifications)
+	}
+	n := notifications[0]
+	if n.Event != EventShareExpiring || n.Data["share_id"] != expiring.String() {
+		t.Errorf("notification = %s for share %s, want %s for %s", n.Event, n.Data["share_id"], EventShareExpiring, expiring.String())
+	}
+	if n.UserID != owner.Bytes || n.Email == "" {
+		t.Errorf("notification sent to %s <%s>, want the owner with their address", n.UserID, n.Email)
+	}
+}
@@ -0,0 +1,15 @@
+package services
+
+import "errors"
+
+// A legal hold freezes a document, a folder with everything in it, or
+// everything a user uploaded or created, until it is released
+const (
+	HoldDocument = "document"
+	HoldFolder   = "folder"
+	HoldUser     = "user"
+)
+
+// ErrLegalHold is returned for deleting something under legal hold. The
+// database refuses it as well.
+var ErrLegalHold = errors.New("under legal hold")
@@ -0,0 +1,131 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// smtpServer accepts SMTP connections on a local port. Unless silent, it
+// answers like a server without extensions and hands every message it
+// receives to messages.
+type smtpServer struct {
+	listener net.Listener
+	silent   bool
+	messages chan string
+}
+
+func newSMTPServer(t *testing.T, silent bool) *smtpServer {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &smtpServer{listener: listener, silent: silent, messages: make(chan string, 1)}
+	t.Cleanup(func() { listener.Close() })
+	go s.serve()
+	return s
+}
+
+func (s *smtpServer) mailer(t *testing.T) *SMTPMailer {
+	t.Helper()
+
+	host, port, err := net.SplitHostPort(s.listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, err := strconv.Atoi(port)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewSMTPMailer(host, n, "", "", "portal@example.com")
+}
+
+func (s *smtpServer) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *smtpServer) handle(conn net.Conn) {
+	defer conn.Close()
+	if s.silent {
+		// Hold the connection open without ever greeting
+		conn.Read(make([]byte, 1))
+		return
+	}
+
+	text := textproto.NewConn(conn)
+	text.PrintfLine("220 localhost ready")
+	for {
+		line, err := text.ReadLine()
+		if err != nil {
+			return
+		}
+		switch verb, _, _ := strings.Cut(line, " "); strings.ToUpper(verb) {
+		case "EHLO", "HELO", "MAIL", "RCPT":
+			text.PrintfLine("250 OK")
+		case "DATA":
+			text.PrintfLine("354 Go ahead")
+			data, err := text.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			s.messages <- string(data)
+			text.PrintfLine("250 Queued")
+		case "QUIT":
+			text.PrintfLine("221 Bye")
+			return
+		default:
+			text.PrintfLine("502 Not implemented")
+		}
+	}
+}
+
+func TestSMTPMailerSend(t *testing.T) {
+	server := newSMTPServer(t, false)
+
+	err := server.mailer(t).Send(context.Background(), Email{To: "user@example.com", Subject: "Hello\r\nBcc: x@example.com", Body: "Line 1\nLine 2"})
+	if err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	msg := <-server.messages
+	for _, want := range []string{"To: user@example.com\n", "Subject: Hello  Bcc: x@example.com\n", "Line 1\nLine 2"} {
+		if !strings.Contains(msg, want) {
+			t.Errorf("message %q does not contain %q", msg, want)
+		}
+	}
+}
+
+// A server that does not answer holds a delivery up only until its context
+// ends
+func TestSMTPMailerSendHonoursContext(t *testing.T) {
+	server := newSMTPServer(t, true)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err := server.mailer(t).Send(ctx, Email{To: "user@example.com", Subject: "Hello", Body: "Hello"})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Send error = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Send returned after %s", elapsed)
+	}
+
+	ctx, cancel = context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+	if err := server.mailer(t).Send(ctx, Email{To: "user@example.com", Subject: "Hello", Body: "Hello"}); !errors.Is(err, context.Canceled) {
+		t.Errorf("Send error after cancellation = %v, want %v", err, context.Canceled)
+	}
+}
@@ -0,0 +1,181 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Notification events
+const (
+	EventFileRequestUpload     = "file_request.upload"
+	EventShareFirstAccess      = "share.first_access"
+	EventShareAccess           = "share.access"
+	EventShareLimitReached     = "share.limit_reached"
+	EventSharePasswordFailures = "share.password_failures"
+	EventShareExpiring         = "share.expiring"
+	EventAccountLocked         = "account.locked"
+	EventDocumentExpiring      = "document.expiring"
+	EventDataExportReady       = "account.export_ready"
+	EventAccountDeletion       = "account.deletion_scheduled"
+	EventAccountDeleted        = "account.deleted"
+)
+
+// Notification is a message to a user about activity on their account,
+// documents, shares or file requests. Email may be left empty, in which
+// case the notification worker looks it up from UserID before delivery.
+type Notification struct {
+	UserID  uuid.UUID         `json:"user_id"`
+	Email   string            `json:"email"`
+	Event   string            `json:"event"`
+	Subject string            `json:"subject"`
+	Body    string            `json:"body"`
+	Data    map[string]string `json:"data,omitempty"`
+}
+
+type Notifier interface {
+	Notify(ctx context.Context, n Notification) error
+}
+
+// LogNotifier writes notifications to the application log
+type LogNotifier struct{}
+
+func NewLogNotifier() *LogNotifier {
+	return &LogNotifier{}
+}
+
+func (n *LogNotifier) Notify(ctx context.Context, notification Notification) error {
+	log.Printf("Notification [%s] for %s: %s", notification.Event, notification.Email, notification.Subject)
+	return nil
+}
+
+// MemoryNotifier keeps delivered notifications in memory. Useful in tests
+// and local development.
+type MemoryNotifier struct {
+	mu            sync.Mutex
+	notifications []Notification
+}
+
+func NewMemoryNotifier() *MemoryNotifier {
+	return &MemoryNotifier{}
+}
+
+func (n *MemoryNotifier) Notify(ctx context.Context, notification Notification) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.notifications = append(n.notifications, notification)
+	return nil
+}
+
+// Notifications returns a copy of everything delivered so far
+func (n *MemoryNotifier) Notifications() []Notification {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return append([]Notification(nil), n.notifications...)
+}
+
+// Reset discards all delivered notifications
+func (n *MemoryNotifier) Reset() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.notifications = nil
+}
+
+// SMTPNotifier emails notifications to the user
+type SMTPNotifier struct {
+	mailer *SMTPMailer
+}
+
+// NewSMTPNotifier creates an SMTP notifier. Authentication is skipped when
+// username is empty.
+func NewSMTPNotifier(host string, port int, username, password, from string) *SMTPNotifier {
+	return &SMTPNotifier{mailer: NewSMTPMailer(host, port, username, password, from)}
+}
+
+func (n *SMTPNotifier) Notify(ctx context.Context, notification Notification) error {
+	if notification.Email == "" {
+		return errors.New("notification has no recipient")
+	}
+
+	return n.mailer.Send(ctx, Email{
+		To:      notification.Email,
+		Subject: notification.Subject,
+		Body:    notification.Body,
+	})
+}
+
+// WebhookNotifier posts notifications as JSON. When a secret is configured
+// the body is signed with HMAC-SHA256 in the X-Signature header.
+type WebhookNotifier struct {
+	url    string
+	secret string
+	client *http.Client
+}
+
+func NewWebhookNotifier(url, secret string) *WebhookNotifier {
+	return &WebhookNotifier{
+		url:    url,
+		secret: secret,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (n *WebhookNotifier) Notify(ctx context.Context, notification Notification) error {
+	body, err := json.Marshal(notification)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Event", notification.Event)
+	if n.secret != "" {
+		mac := hmac.New(sha256.New, []byte(n.secret))
+		mac.Write(body)
+		req.Header.Set("X-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to call webhook: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// MultiNotifier delivers each notification through several notifiers
+type MultiNotifier struct {
+	notifiers []Notifier
+}
+
+func NewMultiNotifier(notifiers ...Notifier) *MultiNotifier {
+	return &MultiNotifier{notifiers: notifiers}
+}
+
+func (n *MultiNotifier) Notify(ctx context.Context, notification Notification) error {
+	var errs []error
+	for _, notifier := range n.notifiers {
+		if err := notifier.Notify(ctx, notification); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
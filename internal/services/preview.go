@@ -0,0 +1,307 @@
+package services
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"math"
+	"strings"
+
+	"github.com/ledongthuc/pdf"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/f64"
+	"golang.org/x/image/math/fixed"
+	_ "golang.org/x/image/webp"
+
+	xdraw "golang.org/x/image/draw"
+)
+
+// Preview rendering limits
+const (
+	previewScale        = 1.5  // 108 DPI for PDF pages
+	previewMaxPages     = 200  // Pages rendered per PDF
+	previewMaxDimension = 2400 // Images are scaled down to fit
+)
+
+// Watermark is stamped across every rendered preview page. Each line is
+// drawn on its own row of a repeated diagonal tile.
+type Watermark struct {
+	Lines []string
+}
+
+// PreviewRenderer turns images and PDFs into page images for the view-only
+// share viewer, so recipients never receive the original file.
+//
+// PDF pages are rasterised from their text and rectangle drawing operations
+// using the Go fonts; embedded raster images and vector paths other than
+// rectangles are not drawn.
+type PreviewRenderer struct {
+	font *opentype.Font
+}
+
+func NewPreviewRenderer() (*PreviewRenderer, error) {
+	f, err := opentype.Parse(goregular.TTF)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load preview font: %w", err)
+	}
+
+	return &PreviewRenderer{font: f}, nil
+}
+
+// IsPreviewable reports whether documents of this MIME type can be shown in
+// the view-only viewer
+func IsPreviewable(mimeType string) bool {
+	switch strings.ToLower(mimeType) {
+	case "application/pdf", "image/jpeg", "image/png", "image/gif", "image/webp":
+		return true
+	}
+	return false
+}
+
+// PageCount returns the number of preview pages of a document
+func (r *PreviewRenderer) PageCount(data []byte, mimeType string) (int, error) {
+	if strings.ToLower(mimeType) != "application/pdf" {
+		if !IsPreviewable(mimeType) {
+			return 0, fmt.Errorf("preview not available for %s", mimeType)
+		}
+		return 1, nil
+	}
+
+	reader, err := pdf.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return 0, fmt.Errorf("failed to read PDF: %w", err)
+	}
+
+	count := reader.NumPage()
+	if count > previewMaxPages {
+		count = previewMaxPages
+	}
+	return count, nil
+}
+
+// RenderPage renders one page (1-based) of a document and stamps the
+// watermark over it
+func (r *PreviewRenderer) RenderPage(data []byte, mimeType string, page int, wm Watermark) (img *image.RGBA, err error) {
+	// Font faces are not safe for concurrent use, so each render gets its own
+	faces := &faceCache{font: r.font, faces: make(map[int]font.Face)}
+
+	if strings.ToLower(mimeType) == "application/pdf" {
+		img, err = renderPDFPage(data, page, faces)
+	} else if IsPreviewable(mimeType) {
+		if page != 1 {
+			return nil, fmt.Errorf("page %d out of range", page)
+		}
+		img, err = renderImage(data)
+	} else {
+		return nil, fmt.Errorf("preview not available for %s", mimeType)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	stampWatermark(img, wm, faces)
+	return img, nil
+}
+
+func renderImage(data []byte) (*image.RGBA, error) {
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode image: %w", err)
+	}
+
+	bounds := src.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width > previewMaxDimension || height > previewMaxDimension {
+		scale := float64(previewMaxDimension) / math.Max(float64(width), float64(height))
+		width = int(float64(width) * scale)
+		height = int(float64(height) * scale)
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(dst, dst.Bounds(), image.White, image.Point{}, draw.Src)
+	xdraw.ApproxBiLinear.Scale(dst, dst.Bounds(), src, bounds, draw.Over, nil)
+	return dst, nil
+}
+
+func renderPDFPage(data []byte, pageNum int, faces *faceCache) (img *image.RGBA, err error) {
+	// The PDF reader panics on malformed content streams
+	defer func() {
+		if rec := recover(); rec != nil {
+			img, err = nil, fmt.Errorf("failed to render PDF page: %v", rec)
+		}
+	}()
+
+	reader, err := pdf.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read PDF: %w", err)
+	}
+
+	if pageNum < 1 || pageNum > reader.NumPage() || pageNum > previewMaxPages {
+		return nil, fmt.Errorf("page %d out of range", pageNum)
+	}
+
+	page := reader.Page(pageNum)
+	if page.V.IsNull() {
+		return nil, fmt.Errorf("page %d not found", pageNum)
+	}
+
+	minX, minY, maxX, maxY := pdfMediaBox(page)
+	width := int((maxX - minX) * previewScale)
+	height := int((maxY - minY) * previewScale)
+	if width <= 0 || height <= 0 || width > 10000 || height > 10000 {
+		return nil, fmt.Errorf("invalid page size")
+	}
+
+	img = image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(img, img.Bounds(), image.White, image.Point{}, draw.Src)
+
+	toImage := func(x, y float64) (int, int) {
+		return int((x - minX) * previewScale), height - int((y-minY)*previewScale)
+	}
+
+	content := page.Content()
+
+	outline := image.NewUniform(color.RGBA{R: 180, G: 180, B: 180, A: 255})
+	for _, rect := range content.Rect {
+		x0, y1 := toImage(rect.Min.X, rect.Min.Y)
+		x1, y0 := toImage(rect.Max.X, rect.Max.Y)
+		strokeRect(img, image.Rect(x0, y0, x1, y1), outline)
+	}
+
+	ink := image.NewUniform(color.Black)
+	var lastX, lastY, lastSize int
+	var cursor fixed.Int26_6
+	for _, text := range content.Text {
+		size := int(math.Round(text.FontSize * previewScale))
+		if size < 4 || text.S == "" {
+			continue
+		}
+		x, y := toImage(text.X, text.Y)
+		dot := fixed.P(x, y)
+
+		// Fonts without a Widths array (such as the standard 14) report no
+		// advance, so continue the run from where the last glyph ended
+		if y == lastY && size == lastSize && x >= lastX && dot.X < cursor {
+			dot.X = cursor
+		}
+
+		d := &font.Drawer{
+			Dst:  img,
+			Src:  ink,
+			Face: faces.face(size),
+			Dot:  dot,
+		}
+		d.DrawString(text.S)
+		lastX, lastY, lastSize, cursor = x, y, size, d.Dot.X
+	}
+
+	return img, nil
+}
+
+// stampWatermark tiles the watermark text diagonally across the image
+func stampWatermark(img *image.RGBA, wm Watermark, faces *faceCache) {
+	if len(wm.Lines) == 0 {
+		return
+	}
+
+	bounds := img.Bounds()
+	size := bounds.Dx() / 40
+	if size < 12 {
+		size = 12
+	}
+	face := faces.face(size)
+
+	// Render the text once onto a transparent tile
+	lineHeight := face.Metrics().Height.Ceil()
+	tileWidth := 0
+	for _, line := range wm.Lines {
+		if w := font.MeasureString(face, line).Ceil(); w > tileWidth {
+			tileWidth = w
+		}
+	}
+	tile := image.NewRGBA(image.Rect(0, 0, tileWidth, lineHeight*len(wm.Lines)))
+	ink := image.NewUniform(color.NRGBA{R: 200, G: 30, B: 30, A: 70})
+	for i, line := range wm.Lines {
+		d := &font.Drawer{
+			Dst:  tile,
+			Src:  ink,
+			Face: face,
+			Dot:  fixed.P(0, lineHeight*i+face.Metrics().Ascent.Ceil()),
+		}
+		d.DrawString(line)
+	}
+
+	// Repeat the rotated tile over the whole page
+	angle := -math.Pi / 6
+	sin, cos := math.Sin(angle), math.Cos(angle)
+	tileCenterX, tileCenterY := float64(tileWidth)/2, float64(tile.Bounds().Dy())/2
+	stepX := tileWidth + size*4
+	stepY := tile.Bounds().Dy() + size*6
+
+	for row, cy := 0, 0; cy < bounds.Dy()+stepY; row, cy = row+1, cy+stepY {
+		offset := (row % 2) * stepX / 2
+		for cx := -offset; cx < bounds.Dx()+stepX; cx += stepX {
+			tx := float64(cx) - (cos*tileCenterX - sin*tileCenterY)
+			ty := float64(cy) - (sin*tileCenterX + cos*tileCenterY)
+			m := f64.Aff3{cos, -sin, tx, sin, cos, ty}
+			xdraw.ApproxBiLinear.Transform(img, m, tile, tile.Bounds(), draw.Over, nil)
+		}
+	}
+}
+
+// faceCache holds the font faces used while rendering a single page
+type faceCache struct {
+	font  *opentype.Font
+	faces map[int]font.Face
+}
+
+// face returns a font face of the given pixel size
+func (c *faceCache) face(size int) font.Face {
+	if face, ok := c.faces[size]; ok {
+		return face
+	}
+
+	face, err := opentype.NewFace(c.font, &opentype.FaceOptions{
+		Size:    float64(size),
+		DPI:     72,
+		Hinting: font.HintingFull,
+	})
+	if err != nil {
+		// Only fails for invalid sizes; fall back to a fixed-size face
+		face = basicfont.Face7x13
+	}
+	c.faces[size] = face
+	return face
+}
+
+// pdfMediaBox returns the page's media box, which may be inherited from
+// its parent page tree nodes. Defaults to US Letter.
+func pdfMediaBox(page pdf.Page) (minX, minY, maxX, maxY float64) {
+	for v := page.V; !v.IsNull(); v = v.Key("Parent") {
+		box := v.Key("MediaBox")
+		if box.Kind() == pdf.Array && box.Len() == 4 {
+			return box.Index(0).Float64(), box.Index(1).Float64(), box.Index(2).Float64(), box.Index(3).Float64()
+		}
+	}
+	return 0, 0, 612, 792
+}
+
+func strokeRect(img *image.RGBA, rect image.Rectangle, src image.Image) {
+	rect = rect.Canon()
+	for _, edge := range []image.Rectangle{
+		image.Rect(rect.Min.X, rect.Min.Y, rect.Max.X, rect.Min.Y+1),
+		image.Rect(rect.Min.X, rect.Max.Y-1, rect.Max.X, rect.Max.Y),
+		image.Rect(rect.Min.X, rect.Min.Y, rect.Min.X+1, rect.Max.Y),
+		image.Rect(rect.Max.X-1, rect.Min.Y, rect.Max.X, rect.Max.Y),
+	} {
+		draw.Draw(img, edge.Intersect(img.Bounds()), src, image.Point{}, draw.Over)
+	}
+}
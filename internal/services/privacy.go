@@ -0,0 +1,555 @@
+package services
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"time"
+
+	"Secure-Document-Exchange-Portal/internal/database"
+
+	"github.com/google/uuid"
+	"github.com/hibiken/asynq"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/minio/minio-go/v7"
+)
+
+// DataExportLifetime is how long a finished data export can be downloaded
+const DataExportLifetime = 7 * 24 * time.Hour
+
+// Data export states
+const (
+	ExportPending = "pending"
+	ExportRunning = "running"
+	ExportReady   = "ready"
+	ExportFailed  = "failed"
+)
+
+// ErrSoleOwner is returned when deleting an account would leave an
+// organization without an owner
+var ErrSoleOwner = errors.New("sole owner of an organization")
+
+// dataExportPayload names the export a data export task builds
+type dataExportPayload struct {
+	ExportID uuid.UUID `json:"export_id"`
+	UserID   uuid.UUID `json:"user_id"`
+}
+
+// PrivacyService answers data subject requests. It builds archives of
+// everything the portal holds about a user, and deletes accounts once the
+// grace period after their owner asked for it has passed.
+type PrivacyService struct {
+	db       *database.Queries
+	storage  StorageService
+	trash    *TrashService
+	quotas   *QuotaService
+	cache    *CachedRepository
+	jobs     *JobService
+	notifier Notifier
+	audit    *AuditLog
+	grace    time.Duration
+}
+
+func NewPrivacyService(db *database.Queries, storage StorageService, trash *TrashService, quotas *QuotaService, cache *CachedRepository, jobs *JobService, notifier Notifier, audit *AuditLog, grace time.Duration) *PrivacyService {
+	return &PrivacyService{
+		db:       db,
+		storage:  storage,
+		trash:    trash,
+		quotas:   quotas,
+		cache:    cache,
+		jobs:     jobs,
+		notifier: notifier,
+		audit:    audit,
+		grace:    grace,
+	}
+}
+
+// Register adds the service's task handlers to mux
+func (s *PrivacyService) Register(mux *asynq.ServeMux) {
+	mux.HandleFunc(TypeDataExport, s.HandleExport)
+	mux.HandleFunc(TypeAccountCleanup, s.HandleCleanup)
+}
+
+// GracePeriod is how long after a user asks for their account to be
+// deleted it is deleted
+func (s *PrivacyService) GracePeriod() time.Duration {
+	return s.grace
+}
+
+// QueueExport hands a new export to the background worker
+func (s *PrivacyService) QueueExport(ctx context.Context, export database.DataExport) error {
+	payload, err := json.Marshal(dataExportPayload{
+		ExportID: export.ID.Bytes,
+		UserID:   export.UserID.Bytes,
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := s.jobs.Enqueue(asynq.NewTask(TypeDataExport, payload, asynq.MaxRetry(3), asynq.Timeout(time.Hour))); err != nil {
+		s.fail(ctx, export.ID, "could not be queued")
+		return err
+	}
+	return nil
+}
+
+// HandleExport builds a data export and tells its owner it is ready. An
+// export that cannot be built is marked failed, and the user can ask again.
+func (s *PrivacyService) HandleExport(ctx context.Context, task *asynq.Task) error {
+	var payload dataExportPayload
+	if err := json.Unmarshal(task.Payload(), &payload); err != nil {
+		return fmt.Errorf("invalid data export payload: %v: %w", err, asynq.SkipRetry)
+	}
+	exportID := pgtype.UUID{Bytes: payload.ExportID, Valid: true}
+	userID := pgtype.UUID{Bytes: payload.UserID, Valid: true}
+
+	claimed, err := s.db.StartDataExport(ctx, exportID)
+	if err != nil {
+		return fmt.Errorf("failed to start data export: %w", err)
+	}
+	if claimed == 0 {
+		return nil
+	}
+
+	user, err := s.db.GetUserByID(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("failed to load user of data export: %w", err)
+	}
+
+	objectName := fmt.Sprintf("exports/%s/%s.zip", user.ID.String(), exportID.String())
+	size, err := s.buildExport(ctx, user, objectName)
+	if err != nil {
+		retried, _ := asynq.GetRetryCount(ctx)
+		maxRetry, _ := asynq.GetMaxRetry(ctx)
+		if retried < maxRetry {
+			return fmt.Errorf("failed to build data export %s: %w", exportID.String(), err)
+		}
+		s.fail(ctx, exportID, "could not be built")
+		return fmt.Errorf("failed to build data export %s: %v: %w", exportID.String(), err, asynq.SkipRetry)
+	}
+
+	export, err := s.db.CompleteDataExport(ctx, database.CompleteDataExportParams{
+		ID:        exportID,
+		FilePath:  pgtype.Text{String: objectName, Valid: true},
+		FileSize:  size,
+		ExpiresAt: pgtype.Timestamptz{Time: time.Now().Add(DataExportLifetime), Valid: true},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to complete data export: %w", err)
+	}
+
+	return s.notifier.Notify(ctx, Notification{
+		UserID:  user.ID.Bytes,
+		Email:   user.Email,
+		Event:   EventDataExportReady,
+		Subject: "Your data export is ready",
+		Body: fmt.Sprintf("The export of your data is ready. Download it before %s, when it is deleted.",
+			export.ExpiresAt.Time.UTC().Format("2006-01-02 15:04 MST")),
+		Data: map[string]string{
+			"export_id":  export.ID.String(),
+			"expires_at": export.ExpiresAt.Time.Format(time.RFC3339),
+		},
+	})
+}
+
+func (s *PrivacyService) fail(ctx context.Context, exportID pgtype.UUID, reason string) {
+	if err := s.db.FailDataExport(ctx, database.FailDataExportParams{
+		ID:    exportID,
+		Error: pgtype.Text{String: reason, Valid: true},
+	}); err != nil {
+		log.Printf("Failed to mark data export %s as failed: %v", exportID.String(), err)
+	}
+}
+
+// buildExport writes the archive of a user's data to a temporary file and
+// stores it under objectName, returning its size. Documents are exported
+// as stored.
+func (s *PrivacyService) buildExport(ctx context.Context, user database.User, objectName string) (int64, error) {
+	tmp, err := os.CreateTemp("", "data-export-*.zip")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	zw := zip.NewWriter(tmp)
+	if err := s.writeExport(ctx, zw, user); err != nil {
+		return 0, err
+	}
+	if err := zw.Close(); err != nil {
+		return 0, err
+	}
+
+	size, err := tmp.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return 0, err
+	}
+	if _, err := s.storage.Upload(ctx, "documents", objectName, tmp, size, minio.PutObjectOptions{
+		ContentType: "application/zip",
+	}); err != nil {
+		return 0, fmt.Errorf("upload: %w", err)
+	}
+	return size, nil
+}
+
+// writeExport writes the profile, documents, shares, share access logs and
+// audit events of a user into an archive
+func (s *PrivacyService) writeExport(ctx context.Context, zw *zip.Writer, user database.User) error {
+	organizations, err := s.db.ListUserOrganizations(ctx, user.ID)
+	if err != nil {
+		return fmt.Errorf("organizations: %w", err)
+	}
+	memberships := make([]map[string]string, 0, len(organizations))
+	for _, org := range organizations {
+		memberships = append(memberships, map[string]string{
+			"id":   org.ID.String(),
+			"name": org.Name,
+			"role": org.Role,
+		})
+	}
+	cidrs := make([]string, 0, len(user.DefaultAllowedCidrs))
+	for _, cidr := range user.DefaultAllowedCidrs {
+		cidrs = append(cidrs, cidr.String())
+	}
+	if err := writeExportJSON(zw, "profile.json", map[string]any{
+		"id":                    user.ID.String(),
+		"email":                 user.Email,
+		"full_name":             user.FullName,
+		"created_at":            exportTime(user.CreatedAt),
+		"updated_at":            exportTime(user.UpdatedAt),
+		"email_verified_at":     exportTime(user.EmailVerifiedAt),
+		"is_active":             user.IsActive.Bool,
+		"is_admin":              user.IsAdmin,
+		"is_legal":              user.IsLegal,
+		"totp_enabled":          user.TotpEnabled,
+		"default_allowed_cidrs": cidrs,
+		"delete_after":          exportTime(user.DeleteAfter),
+		"organizations":         memberships,
+	}); err != nil {
+		return err
+	}
+
+	docs, err := s.db.ListAccountDocuments(ctx, user.ID)
+	if err != nil {
+		return fmt.Errorf("documents: %w", err)
+	}
+	documents := make([]map[string]any, 0, len(docs))
+	for _, doc := range docs {
+		name := path.Join("documents", doc.ID.String(), path.Base("/"+doc.Filename))
+		if err := s.writeExportDocument(ctx, zw, doc, name); err != nil {
+			return fmt.Errorf("document %s: %w", doc.ID.String(), err)
+		}
+		documents = append(documents, map[string]any{
+			"id":           doc.ID.String(),
+			"filename":     doc.Filename,
+			"file":         name,
+			"file_size":    doc.FileSize,
+			"mime_type":    doc.MimeType,
+			"checksum":     doc.Checksum,
+			"uploaded_by":  doc.UserID.String(),
+			"workspace_id": doc.WorkspaceID.String(),
+			"folder_id":    doc.FolderID.String(),
+			"created_at":   exportTime(doc.CreatedAt),
+			"updated_at":   exportTime(doc.UpdatedAt),
+			"deleted_at":   exportTime(doc.DeletedAt),
+		})
+	}
+	if err := writeExportJSON(zw, "documents.json", documents); err != nil {
+		return err
+	}
+
+	shares, err := s.db.ListUserShares(ctx, user.ID)
+	if err != nil {
+		return fmt.Errorf("shares: %w", err)
+	}
+	shareDocs, err := s.db.ListUserShareDocuments(ctx, user.ID)
+	if err != nil {
+		return fmt.Errorf("share documents: %w", err)
+	}
+	sharedIDs := make(map[pgtype.UUID][]string)
+	for _, sd := range shareDocs {
+		sharedIDs[sd.ShareID] = append(sharedIDs[sd.ShareID], sd.DocumentID.String())
+	}
+	shareItems := make([]map[string]any, 0, len(shares))
+	for _, share := range shares {
+		allowed := make([]string, 0, len(share.AllowedCidrs))
+		for _, cidr := range share.AllowedCidrs {
+			allowed = append(allowed, cidr.String())
+		}
+		shareItems = append(shareItems, map[string]any{
+			"id":                 share.ID.String(),
+			"name":               share.Name.String,
+			"created_at":         exportTime(share.CreatedAt),
+			"expires_at":         exportTime(share.ExpiresAt),
+			"max_access":         share.MaxAccess.Int32,
+			"access_count":       share.AccessCount.Int32,
+			"password_protected": share.PasswordHash.Valid,
+			"view_only":          share.ViewOnly,
+			"allowed_cidrs":      allowed,
+			"folder_id":          share.FolderID.String(),
+			"document_ids":       sharedIDs[share.ID],
+		})
+	}
+	if err := writeExportJSON(zw, "shares.json", shareItems); err != nil {
+		return err
+	}
+
+	logs, err := s.db.ListUserShareAccessLogs(ctx, user.ID)
+	if err != nil {
+		return fmt.Errorf("share access logs: %w", err)
+	}
+	accesses := make([]map[string]string, 0, len(logs))
+	for _, entry := range logs {
+		access := map[string]string{
+			"share_id":    entry.ShareID.String(),
+			"document_id": entry.DocumentID.String(),
+			"action":      entry.Action,
+			"user_agent":  entry.UserAgent.String,
+			"created_at":  exportTime(entry.CreatedAt),
+		}
+		if entry.IpAddress != nil {
+			access["ip_address"] = entry.IpAddress.String()
+		}
+		accesses = append(accesses, access)
+	}
+	if err := writeExportJSON(zw, "share_access_logs.json", accesses); err != nil {
+		return err
+	}
+
+	events, err := s.db.ListUserAuditEvents(ctx, user.ID)
+	if err != nil {
+		return fmt.Errorf("audit events: %w", err)
+	}
+	entries := make([]AuditEntry, 0, len(events))
+	for _, event := range events {
+		entry, err := AuditEntryOf(event)
+		if err != nil {
+			return err
+		}
+		entries = append(entries, entry)
+	}
+	return writeExportJSON(zw, "audit_events.json", entries)
+}
+
+func (s *PrivacyService) writeExportDocument(ctx context.Context, zw *zip.Writer, doc database.Document, name string) error {
+	obj, err := s.storage.Download(ctx, "documents", doc.FilePath, minio.GetObjectOptions{})
+	if err != nil {
+		return err
+	}
+	defer obj.Close()
+
+	entry, err := zw.CreateHeader(&zip.FileHeader{
+		Name:     name,
+		Method:   zip.Deflate,
+		Modified: doc.CreatedAt.Time,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(entry, obj)
+	return err
+}
+
+func writeExportJSON(zw *zip.Writer, name string, v any) error {
+	entry, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(entry)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
+
+func exportTime(t pgtype.Timestamptz) string {
+	if !t.Valid {
+		return ""
+	}
+	return t.Time.UTC().Format(time.RFC3339)
+}
+
+// HandleCleanup removes expired data exports and deletes the accounts
+// whose grace period has passed
+func (s *PrivacyService) HandleCleanup(ctx context.Context, task *asynq.Task) error {
+	now := pgtype.Timestamptz{Time: time.Now(), Valid: true}
+
+	exports, err := s.db.ListExpiredDataExports(ctx, now)
+	if err != nil {
+		return fmt.Errorf("failed to list expired data exports: %w", err)
+	}
+	for _, export := range exports {
+		if err := s.storage.Delete(ctx, "documents", export.FilePath.String, minio.RemoveObjectOptions{}); err != nil {
+			log.Printf("Failed to delete data export %s from storage: %v", export.ID.String(), err)
+			continue
+		}
+		if err := s.db.DeleteDataExport(ctx, export.ID); err != nil {
+			log.Printf("Failed to delete data export %s: %v", export.ID.String(), err)
+		}
+	}
+
+	users, err := s.db.ListUsersDueForDeletion(ctx, now)
+	if err != nil {
+		return fmt.Errorf("failed to list accounts due for deletion: %w", err)
+	}
+	failed := 0
+	for _, user := range users {
+		// Accounts that cannot be deleted yet are tried again on the next
+		// run, so deletion goes ahead once a legal hold is released or a
+		// retention period ends
+		err := s.DeleteAccount(ctx, user)
+		var retained *RetentionError
+		if errors.Is(err, ErrLegalHold) || errors.Is(err, ErrSoleOwner) || errors.As(err, &retained) {
+			continue
+		}
+		if err != nil {
+			log.Printf("Failed to delete account %s: %v", user.ID.String(), err)
+			failed++
+		}
+	}
+
+	// The task is retried for accounts that failed halfway, which carries
+	// on where their deletion stopped
+	if failed > 0 {
+		return fmt.Errorf("failed to delete %d of %d accounts", failed, len(users))
+	}
+	return nil
+}
+
+// CheckDeletable returns ErrLegalHold if a legal hold keeps the account or
+// data deleting it would delete, a *RetentionError if the retention period
+// of a personal document has not ended, and ErrSoleOwner if it is the only
+// owner of an organization
+func (s *PrivacyService) CheckDeletable(ctx context.Context, userID pgtype.UUID) error {
+	held, err := s.db.IsAccountHeld(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("legal holds: %w", err)
+	}
+	if held {
+		return ErrLegalHold
+	}
+
+	workspace, err := s.db.GetPersonalWorkspace(ctx, userID)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return fmt.Errorf("personal workspace: %w", err)
+	}
+	if err == nil {
+		until, err := WorkspaceRetainedUntil(ctx, s.db, workspace.ID, time.Now())
+		if err != nil {
+			return fmt.Errorf("retention: %w", err)
+		}
+		if !until.IsZero() {
+			return &RetentionError{Until: until}
+		}
+	}
+
+	orgs, err := s.db.ListSoleOwnedOrganizations(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("organizations: %w", err)
+	}
+	if len(orgs) > 0 {
+		return ErrSoleOwner
+	}
+	return nil
+}
+
+// DeleteAccount deletes a user's account for good: their shares, sessions,
+// personal documents with their files, data exports and finally the user
+// with everything that belongs to it. Documents and folders in organization
+// workspaces are handed to an owner of the organization.
+//
+// Every step only deals with what the steps before left, so when one fails
+// the account is kept and calling DeleteAccount again carries on from there.
+// Handing over organization content and deleting the user happen in one
+// transaction.
+func (s *PrivacyService) DeleteAccount(ctx context.Context, user database.User) error {
+	if err := s.CheckDeletable(ctx, user.ID); err != nil {
+		return err
+	}
+
+	tokens, err := s.db.DeleteUserShares(ctx, user.ID)
+	if err != nil {
+		return fmt.Errorf("shares: %w", err)
+	}
+	for _, token := range tokens {
+		s.cache.InvalidateShare(ctx, token)
+	}
+
+	revoked, err := s.db.DeleteAllUserSessions(ctx, user.ID)
+	if err != nil {
+		return fmt.Errorf("sessions: %w", err)
+	}
+	s.cache.InvalidateSessions(ctx, revoked)
+
+	keys, err := s.db.ListUserAPIKeys(ctx, user.ID)
+	if err != nil {
+		return fmt.Errorf("API keys: %w", err)
+	}
+
+	docs, err := s.db.ListPersonalWorkspaceDocuments(ctx, user.ID)
+	if err != nil {
+		return fmt.Errorf("documents: %w", err)
+	}
+	for _, doc := range docs {
+		if err := s.trash.Delete(ctx, doc); err != nil {
+			return fmt.Errorf("document %s: %w", doc.ID.String(), err)
+		}
+	}
+
+	// The rows of data exports go with the user, so their files go first
+	files, err := s.db.ListUserExportFiles(ctx, user.ID)
+	if err != nil {
+		return fmt.Errorf("data exports: %w", err)
+	}
+	for _, file := range files {
+		if err := s.storage.Delete(ctx, "documents", file.String, minio.RemoveObjectOptions{}); err != nil {
+			return fmt.Errorf("data export %s: %w", file.String, err)
+		}
+	}
+
+	// What the user added to organization workspaces stays with the
+	// organization
+	reassigned, err := s.quotas.DeleteUser(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+	s.cache.InvalidateUser(ctx, user.ID.Bytes, user.Email)
+	s.cache.InvalidateUserWorkspaceRoles(ctx, user.ID.Bytes)
+	s.cache.InvalidateUserDocumentGrants(ctx, user.ID.Bytes)
+	for _, key := range keys {
+		s.cache.InvalidateAPIKey(ctx, key.KeyHash)
+	}
+
+	// The record of the deletion does not keep the email address
+	if err := s.audit.Record(ctx, AuditEvent{
+		Action:       AuditAccountDeleted,
+		ResourceType: "user",
+		ResourceID:   user.ID.String(),
+		Details: map[string]string{
+			"documents":  fmt.Sprintf("%d", len(docs)),
+			"reassigned": fmt.Sprintf("%d", reassigned),
+			"shares":     fmt.Sprintf("%d", len(tokens)),
+		},
+	}); err != nil {
+		log.Printf("Failed to record deletion of account %s: %v", user.ID.String(), err)
+	}
+
+	if err := s.notifier.Notify(ctx, Notification{
+		UserID:  user.ID.Bytes,
+		Email:   user.Email,
+		Event:   EventAccountDeleted,
+		Subject: "Your account has been deleted",
+		Body:    "As you asked, your account, documents and shares have been deleted.",
+	}); err != nil {
+		log.Printf("Failed to notify about deletion of account %s: %v", user.ID.String(), err)
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+func newTestPrivacyService(f *fixtures, storage StorageService) *PrivacyService {
+	audit := f.auditLog()
+	trash := NewTrashService(f.db, storage, f.quotas, f.cache, audit, time.Hour)
+	return NewPrivacyService(f.db, storage, trash, f.quotas, f.cache, nil, NewMemoryNotifier(), audit, time.Hour)
+}
+
+func (f *fixtures) uploader(doc pgtype.UUID, table string) pgtype.UUID {
+	f.t.Helper()
+	return f.id(`SELECT user_id FROM `+table+` WHERE id = $1`, doc)
+}
+
+// A deletion that fails halfway keeps the account, and deleting it again
+// carries on from there
+func TestDeleteAccountResumesAfterFailure(t *testing.T) {
+	f := newFixtures(t)
+	storage := newMemoryStorage()
+	privacy := newTestPrivacyService(f, storage)
+
+	owner, _ := f.user()
+	userID, personal := f.user()
+	_, shared := f.organization(map[pgtype.UUID]string{owner: "owner", userID: "member"})
+	personalDoc := f.document(userID, personal, 100)
+	orgDoc := f.document(userID, shared, 200)
+	folder := f.folder(userID, shared)
+
+	const exportFile = "exports/archive.zip"
+	storage.objects[exportFile] = []byte("zip")
+	storage.fail[exportFile] = true
+	if _, err := f.pool.Exec(f.ctx, `INSERT INTO data_exports (user_id, status, file_path) VALUES ($1, 'ready', $2)`, userID, exportFile); err != nil {
+		t.Fatal(err)
+	}
+
+	user, err := f.db.GetUserByID(f.ctx, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := privacy.DeleteAccount(f.ctx, user); err == nil {
+		t.Fatal("DeleteAccount succeeded although the data export could not be deleted")
+	}
+
+	if _, err := f.db.GetUserByID(f.ctx, userID); err != nil {
+		t.Fatalf("the account is gone after a failed deletion: %v", err)
+	}
+	if uploader := f.uploader(orgDoc.ID, "documents"); uploader != userID {
+		t.Error("organization documents were handed over although the account was kept")
+	}
+	if usage := f.usage(owner); usage.DocumentCount != 0 {
+		t.Errorf("the owner is charged for %d documents before the handover", usage.DocumentCount)
+	}
+	if _, err := f.db.GetDocumentByID(f.ctx, personalDoc.ID); !errors.Is(err, pgx.ErrNoRows) {
+		t.Errorf("personal document after the first attempt: %v, want it deleted", err)
+	}
+
+	delete(storage.fail, exportFile)
+	if err := privacy.DeleteAccount(f.ctx, user); err != nil {
+		t.Fatalf("DeleteAccount: %v", err)
+	}
+
+	if _, err := f.db.GetUserByID(f.ctx, userID); !errors.Is(err, pgx.ErrNoRows) {
+		t.Errorf("account after deletion: %v, want it deleted", err)
+	}
+	if _, ok := storage.objects[exportFile]; ok {
+		t.Error("the data export file was kept")
+	}
+	if uploader := f.uploader(orgDoc.ID, "documents"); uploader != owner {
+		t.Error("the organization document was not handed to the owner")
+	}
+	if uploader := f.uploader(folder, "folders"); uploader != owner {
+		t.Error("the organization folder was not handed to the owner")
+	}
+	if usage := f.usage(owner); usage.DocumentCount != 1 || usage.UsedBytes != orgDoc.FileSize {
+		t.Errorf("the owner is charged for %d documents of %d bytes, want 1 of %d", usage.DocumentCount, usage.UsedBytes, orgDoc.FileSize)
+	}
+}
+
+// If organization content cannot be handed over, the user is not deleted
+// either
+func TestDeleteAccountHandOverIsAtomic(t *testing.T) {
+	f := newFixtures(t)
+	privacy := newTestPrivacyService(f, newMemoryStorage())
+
+	userID, _ := f.user()
+	_, shared := f.organization(map[pgtype.UUID]string{userID: "member"})
+	orgDoc := f.document(userID, shared, 200)
+
+	user, err := f.db.GetUserByID(f.ctx, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// An organization without owners has no one to hand the document to
+	if err := privacy.DeleteAccount(f.ctx, user); err == nil {
+		t.Fatal("DeleteAccount succeeded without an owner to hand over to")
+	}
+	if _, err := f.db.GetUserByID(f.ctx, userID); err != nil {
+		t.Fatalf("the account is gone after a failed handover: %v", err)
+	}
+	if uploader := f.uploader(orgDoc.ID, "documents"); uploader != userID {
+		t.Error("the organization document changed hands in a failed handover")
+	}
+}
@@ -0,0 +1,365 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"Secure-Document-Exchange-Portal/internal/database"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Plan is the storage a plan includes. Accounts get their plan's quota
+// unless an administrator overrides it.
+type Plan struct {
+	Bytes     int64
+	Documents int32
+}
+
+const (
+	PlanFree = "free"
+	PlanPro  = "pro"
+	PlanTeam = "team"
+)
+
+// Plans are the storage plans. Users start on PlanFree, organizations on
+// PlanTeam.
+var Plans = map[string]Plan{
+	PlanFree: {Bytes: 10 << 30, Documents: 10_000},
+	PlanPro:  {Bytes: 100 << 30, Documents: 100_000},
+	PlanTeam: {Bytes: 1 << 40, Documents: 1_000_000},
+}
+
+// Accounts are warned when they fill this much of their quota, and warned
+// more urgently from the critical threshold
+const (
+	QuotaWarningThreshold  = 0.80
+	QuotaCriticalThreshold = 0.95
+)
+
+// Usage is the storage an account uses and the quota it may use
+type Usage struct {
+	Plan           string
+	UsedBytes      int64
+	QuotaBytes     int64
+	DocumentCount  int32
+	QuotaDocuments int32
+}
+
+// UsageOf applies the plan and overrides of a storage usage row
+func UsageOf(row database.StorageUsage) Usage {
+	plan := Plans[row.Plan]
+	usage := Usage{
+		Plan:           row.Plan,
+		UsedBytes:      row.UsedBytes,
+		QuotaBytes:     plan.Bytes,
+		DocumentCount:  row.DocumentCount,
+		QuotaDocuments: plan.Documents,
+	}
+	if row.QuotaBytes.Valid {
+		usage.QuotaBytes = row.QuotaBytes.Int64
+	}
+	if row.QuotaDocuments.Valid {
+		usage.QuotaDocuments = row.QuotaDocuments.Int32
+	}
+	return usage
+}
+
+// without is the usage before a document of size bytes was counted
+func (u Usage) without(size int64) Usage {
+	u.UsedBytes -= size
+	u.DocumentCount--
+	return u
+}
+
+// Fits reports whether one more document of size bytes stays within the
+// quota
+func (u Usage) Fits(size int64) bool {
+	return u.UsedBytes+size <= u.QuotaBytes && u.DocumentCount < u.QuotaDocuments
+}
+
+// Fraction is how full the account is, by bytes or by documents, whichever
+// is fuller. Accounts with a zero quota are full.
+func (u Usage) Fraction() float64 {
+	if u.QuotaBytes <= 0 || u.QuotaDocuments <= 0 {
+		return 1
+	}
+	return max(float64(u.UsedBytes)/float64(u.QuotaBytes), float64(u.DocumentCount)/float64(u.QuotaDocuments))
+}
+
+// Warning returns a message for accounts past the warning threshold, or an
+// empty string
+func (u Usage) Warning() string {
+	switch fraction := u.Fraction(); {
+	case fraction >= 1:
+		return "Storage is full. Delete documents to upload new ones."
+	case fraction >= QuotaCriticalThreshold:
+		return fmt.Sprintf("Storage is %.0f%% full. Uploads will fail once it is full.", fraction*100)
+	case fraction >= QuotaWarningThreshold:
+		return fmt.Sprintf("Storage is %.0f%% full.", fraction*100)
+	}
+	return ""
+}
+
+// Critical reports whether the account is past the critical threshold
+func (u Usage) Critical() bool {
+	return u.Fraction() >= QuotaCriticalThreshold
+}
+
+// QuotaError is returned for a document that does not fit into the quota
+// of its uploader or of the organization owning its workspace
+type QuotaError struct {
+	Organization bool
+	Usage        Usage
+}
+
+func (e *QuotaError) Error() string {
+	owner := "Your"
+	if e.Organization {
+		owner = "The organization's"
+	}
+	return fmt.Sprintf("%s storage quota is exceeded: %s of %s and %d of %d documents used",
+		owner, FormatBytes(e.Usage.UsedBytes), FormatBytes(e.Usage.QuotaBytes), e.Usage.DocumentCount, e.Usage.QuotaDocuments)
+}
+
+// QuotaService keeps the storage usage of users and organizations in step
+// with their documents. Documents must be created and deleted through it.
+type QuotaService struct {
+	pool *pgxpool.Pool
+	db   *database.Queries
+}
+
+func NewQuotaService(pool *pgxpool.Pool, db *database.Queries) *QuotaService {
+	return &QuotaService{pool: pool, db: db}
+}
+
+// UserUsage returns the storage used by the documents a user uploaded
+func (s *QuotaService) UserUsage(ctx context.Context, userID uuid.UUID) (Usage, error) {
+	row, err := s.db.GetUserStorage(ctx, pgtype.UUID{Bytes: userID, Valid: true})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return UsageOf(database.StorageUsage{Plan: PlanFree}), nil
+	}
+	if err != nil {
+		return Usage{}, err
+	}
+	return UsageOf(row), nil
+}
+
+// OrganizationUsage returns the storage used by the documents in an
+// organization's workspaces
+func (s *QuotaService) OrganizationUsage(ctx context.Context, organizationID uuid.UUID) (Usage, error) {
+	row, err := s.db.GetOrganizationStorage(ctx, pgtype.UUID{Bytes: organizationID, Valid: true})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return UsageOf(database.StorageUsage{Plan: PlanTeam}), nil
+	}
+	if err != nil {
+		return Usage{}, err
+	}
+	return UsageOf(row), nil
+}
+
+// Check returns a *QuotaError if a document of size bytes, uploaded by
+// userID into the workspace, would not fit. It lets uploads fail before
+// anything is written to storage; CreateDocument checks again.
+func (s *QuotaService) Check(ctx context.Context, userID uuid.UUID, workspaceID pgtype.UUID, size int64) error {
+	usage, err := s.UserUsage(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("user storage: %w", err)
+	}
+	if !usage.Fits(size) {
+		return &QuotaError{Usage: usage}
+	}
+
+	workspace, err := s.db.GetWorkspaceByID(ctx, workspaceID)
+	if err != nil {
+		return fmt.Errorf("workspace: %w", err)
+	}
+	if workspace.OrganizationID.Valid {
+		usage, err := s.OrganizationUsage(ctx, workspace.OrganizationID.Bytes)
+		if err != nil {
+			return fmt.Errorf("organization storage: %w", err)
+		}
+		if !usage.Fits(size) {
+			return &QuotaError{Organization: true, Usage: usage}
+		}
+	}
+	return nil
+}
+
+// CreateDocument records a document and counts it against the quotas of
+// its uploader and of the organization owning its workspace, all in one
+// transaction. If the document does not fit, nothing is recorded and a
+// *QuotaError is returned. The returned usage is that of the fuller
+// account.
+func (s *QuotaService) CreateDocument(ctx context.Context, arg database.CreateDocumentParams) (database.Document, Usage, error) {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return database.Document{}, Usage{}, err
+	}
+	defer tx.Rollback(ctx)
+	qtx := s.db.WithTx(tx)
+
+	doc, err := qtx.CreateDocument(ctx, arg)
+	if err != nil {
+		return database.Document{}, Usage{}, err
+	}
+
+	// The usage row stays locked until commit, so concurrent uploads of the
+	// same account are counted one after the other
+	row, err := qtx.AddUserStorage(ctx, database.AddUserStorageParams{
+		UserID:    doc.UserID,
+		Plan:      PlanFree,
+		UsedBytes: doc.FileSize,
+	})
+	if err != nil {
+		return database.Document{}, Usage{}, fmt.Errorf("user storage: %w", err)
+	}
+	usage := UsageOf(row)
+	if usage.UsedBytes > usage.QuotaBytes || usage.DocumentCount > usage.QuotaDocuments {
+		return database.Document{}, Usage{}, &QuotaError{Usage: usage.without(doc.FileSize)}
+	}
+
+	workspace, err := qtx.GetWorkspaceByID(ctx, doc.WorkspaceID)
+	if err != nil {
+		return database.Document{}, Usage{}, fmt.Errorf("workspace: %w", err)
+	}
+	if workspace.OrganizationID.Valid {
+		row, err := qtx.AddOrganizationStorage(ctx, database.AddOrganizationStorageParams{
+			OrganizationID: workspace.OrganizationID,
+			Plan:           PlanTeam,
+			UsedBytes:      doc.FileSize,
+		})
+		if err != nil {
+			return database.Document{}, Usage{}, fmt.Errorf("organization storage: %w", err)
+		}
+		orgUsage := UsageOf(row)
+		if orgUsage.UsedBytes > orgUsage.QuotaBytes || orgUsage.DocumentCount > orgUsage.QuotaDocuments {
+			return database.Document{}, Usage{}, &QuotaError{Organization: true, Usage: orgUsage.without(doc.FileSize)}
+		}
+		if orgUsage.Fraction() > usage.Fraction() {
+			usage = orgUsage
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return database.Document{}, Usage{}, err
+	}
+	return doc, usage, nil
+}
+
+// DeleteDocument deletes a document and gives its storage back to the
+// accounts it counted against, in one transaction. Documents under legal
+// hold are kept and ErrLegalHold is returned; documents whose retention
+// period has not ended are kept and a *RetentionError is returned.
+func (s *QuotaService) DeleteDocument(ctx context.Context, arg database.DeleteDocumentParams) (database.Document, error) {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return database.Document{}, err
+	}
+	defer tx.Rollback(ctx)
+	qtx := s.db.WithTx(tx)
+
+	held, err := qtx.IsDocumentHeld(ctx, arg.ID)
+	if err != nil {
+		return database.Document{}, fmt.Errorf("legal holds: %w", err)
+	}
+	if held {
+		return database.Document{}, ErrLegalHold
+	}
+	until, err := RetainedUntil(ctx, qtx, arg.ID, arg.WorkspaceID, time.Now())
+	if err != nil {
+		return database.Document{}, fmt.Errorf("retention: %w", err)
+	}
+	if !until.IsZero() {
+		return database.Document{}, &RetentionError{Until: until}
+	}
+
+	doc, err := qtx.DeleteDocument(ctx, arg)
+	if err != nil {
+		return database.Document{}, err
+	}
+
+	if err := qtx.RemoveUserStorage(ctx, database.RemoveUserStorageParams{
+		UserID:    doc.UserID,
+		UsedBytes: doc.FileSize,
+	}); err != nil {
+		return database.Document{}, fmt.Errorf("user storage: %w", err)
+	}
+
+	workspace, err := qtx.GetWorkspaceByID(ctx, doc.WorkspaceID)
+	if err != nil {
+		return database.Document{}, fmt.Errorf("workspace: %w", err)
+	}
+	if workspace.OrganizationID.Valid {
+		if err := qtx.RemoveOrganizationStorage(ctx, database.RemoveOrganizationStorageParams{
+			OrganizationID: workspace.OrganizationID,
+			UsedBytes:      doc.FileSize,
+		}); err != nil {
+			return database.Document{}, fmt.Errorf("organization storage: %w", err)
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return database.Document{}, err
+	}
+	return doc, nil
+}
+
+// DeleteUser deletes a user whose personal documents are gone, in one
+// transaction with handing their documents and folders in organization
+// workspaces to an owner of each organization. The handed over documents
+// count against their new owners, who may end up over quota. It returns
+// how many documents were handed over.
+func (s *QuotaService) DeleteUser(ctx context.Context, userID pgtype.UUID) (int, error) {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+	qtx := s.db.WithTx(tx)
+
+	docs, err := qtx.ReassignOrganizationDocuments(ctx, userID)
+	if err != nil {
+		return 0, fmt.Errorf("organization documents: %w", err)
+	}
+	for _, doc := range docs {
+		if _, err := qtx.AddUserStorage(ctx, database.AddUserStorageParams{
+			UserID:    doc.UserID,
+			Plan:      PlanFree,
+			UsedBytes: doc.FileSize,
+		}); err != nil {
+			return 0, fmt.Errorf("user storage: %w", err)
+		}
+	}
+
+	if _, err := qtx.ReassignOrganizationFolders(ctx, userID); err != nil {
+		return 0, fmt.Errorf("organization folders: %w", err)
+	}
+	if err := qtx.DeleteUser(ctx, userID); err != nil {
+		return 0, fmt.Errorf("user: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, err
+	}
+	return len(docs), nil
+}
+
+// FormatBytes renders a size for people, such as 1.5 GB
+func FormatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,142 @@
+package services
+
+import (
+	"errors"
+	"testing"
+
+	"Secure-Document-Exchange-Portal/internal/database"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+func TestUsageFits(t *testing.T) {
+	usage := Usage{UsedBytes: 600, QuotaBytes: 1000, DocumentCount: 2, QuotaDocuments: 3}
+	cases := []struct {
+		name  string
+		usage Usage
+		size  int64
+		want  bool
+	}{
+		{"room left", usage, 100, true},
+		{"exactly full", usage, 400, true},
+		{"one byte over", usage, 401, false},
+		{"no documents left", Usage{UsedBytes: 0, QuotaBytes: 1000, DocumentCount: 3, QuotaDocuments: 3}, 1, false},
+		{"zero quota", Usage{}, 0, false},
+	}
+	for _, tc := range cases {
+		if got := tc.usage.Fits(tc.size); got != tc.want {
+			t.Errorf("%s: Fits(%d) = %v, want %v", tc.name, tc.size, got, tc.want)
+		}
+	}
+}
+
+// setQuota overrides the quota of a user or organization
+func (f *fixtures) setQuota(column string, id pgtype.UUID, plan string, bytes int64, documents int32) {
+	f.t.Helper()
+	if _, err := f.pool.Exec(f.ctx, `INSERT INTO storage_usage (`+column+`, plan, quota_bytes, quota_documents) VALUES ($1, $2, $3, $4)`,
+		id, plan, bytes, documents); err != nil {
+		f.t.Fatal(err)
+	}
+}
+
+// Check and CreateDocument refuse documents that do not fit into the quota
+// of the uploader or of the organization, the uploader's first, and report
+// the fuller account's usage otherwise
+func TestQuotaLimits(t *testing.T) {
+	f := newFixtures(t)
+
+	type quota struct {
+		bytes     int64
+		documents int32
+	}
+	cases := []struct {
+		name         string
+		user         quota
+		organization *quota // nil uploads into the personal workspace
+		existing     []int64
+		size         int64
+		// wantErr is "", "user" or "organization"; wantQuota is the byte
+		// quota of the usage reported
+		wantErr   string
+		wantQuota int64
+	}{
+		{"personal fits exactly", quota{1000, 10}, nil, []int64{600}, 400, "", 1000},
+		{"personal over bytes", quota{1000, 10}, nil, []int64{600}, 401, "user", 1000},
+		{"personal over documents", quota{1000, 1}, nil, []int64{1}, 1, "user", 1000},
+		{"organization fits", quota{10_000, 10}, &quota{5000, 10}, nil, 1000, "", 5000},
+		{"organization over bytes", quota{10_000, 10}, &quota{1000, 10}, []int64{500}, 501, "organization", 1000},
+		{"organization over documents", quota{10_000, 10}, &quota{10_000, 2}, []int64{1, 1}, 1, "organization", 10_000},
+		{"uploader over quota in an organization", quota{1000, 10}, &quota{10_000, 10}, nil, 1001, "user", 1000},
+		{"both over quota", quota{1000, 10}, &quota{500, 10}, nil, 1001, "user", 1000},
+		{"uploader fuller than the organization", quota{1000, 10}, &quota{10_000, 10}, nil, 900, "", 1000},
+		{"organization fuller than the uploader", quota{10_000, 10}, &quota{2000, 10}, nil, 900, "", 2000},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			f := f.in(t)
+			user, workspace := f.user()
+			f.setQuota("user_id", user, PlanFree, tc.user.bytes, tc.user.documents)
+			if tc.organization != nil {
+				var organization pgtype.UUID
+				organization, workspace = f.organization(map[pgtype.UUID]string{user: "member"})
+				f.setQuota("organization_id", organization, PlanTeam, tc.organization.bytes, tc.organization.documents)
+			}
+			for _, size := range tc.existing {
+				f.document(user, workspace, size)
+			}
+			before := f.usage(user)
+
+			checkErr := f.quotas.Check(f.ctx, user.Bytes, workspace, tc.size)
+			_, usage, createErr := f.quotas.CreateDocument(f.ctx, database.CreateDocumentParams{
+				UserID:       user,
+				Filename:     "b.pdf",
+				FilePath:     "files/" + uuid.NewString(),
+				EncryptedKey: "key",
+				FileSize:     tc.size,
+				MimeType:     "application/pdf",
+				Checksum:     "sum",
+				WorkspaceID:  workspace,
+			})
+
+			for name, err := range map[string]error{"Check": checkErr, "CreateDocument": createErr} {
+				if tc.wantErr == "" {
+					if err != nil {
+						t.Errorf("%s: %v", name, err)
+					}
+					continue
+				}
+				var quotaErr *QuotaError
+				if !errors.As(err, &quotaErr) {
+					t.Errorf("%s error = %v, want a quota error", name, err)
+					continue
+				}
+				got := "user"
+				if quotaErr.Organization {
+					got = "organization"
+				}
+				if got != tc.wantErr {
+					t.Errorf("%s: the %s quota is reported, want the %s one", name, got, tc.wantErr)
+				}
+				if quotaErr.Usage.QuotaBytes != tc.wantQuota {
+					t.Errorf("%s: quota = %d bytes, want %d", name, quotaErr.Usage.QuotaBytes, tc.wantQuota)
+				}
+			}
+
+			after := f.usage(user)
+			if tc.wantErr != "" {
+				if after != before {
+					t.Errorf("usage after a refused upload = %+v, want %+v", after, before)
+				}
+				return
+			}
+			if usage.QuotaBytes != tc.wantQuota {
+				t.Errorf("CreateDocument usage quota = %d bytes, want %d", usage.QuotaBytes, tc.wantQuota)
+			}
+			if after.UsedBytes != before.UsedBytes+tc.size || after.DocumentCount != before.DocumentCount+1 {
+				t.Errorf("usage after the upload = %d bytes in %d documents, want %d in %d",
+					after.UsedBytes, after.DocumentCount, before.UsedBytes+tc.size, before.DocumentCount+1)
+			}
+		})
+	}
+}
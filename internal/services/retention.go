@@ -0,0 +1,395 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"Secure-Document-Exchange-Portal/internal/database"
+
+	"github.com/google/uuid"
+	"github.com/hibiken/asynq"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/minio/minio-go/v7"
+)
+
+// RetentionItem is a document that a retention policy deletes
+type RetentionItem struct {
+	DocumentID  uuid.UUID
+	UserID      uuid.UUID
+	Filename    string
+	WorkspaceID uuid.UUID
+	PolicyID    uuid.UUID
+	// DueAt is when the policy's retention period ends
+	DueAt time.Time
+	// WarnAt is when the uploader is warned; the zero time for policies
+	// that do not warn
+	WarnAt time.Time
+	// DeleteAt is when the document is deleted: when it is due, but never
+	// sooner than the policy's warning period after the warning went out
+	DeleteAt time.Time
+	Warned   bool
+	// Held documents are under legal hold and are kept, without a warning,
+	// until the hold is released
+	Held bool
+}
+
+// RetentionError is returned for deleting a document before the retention
+// period of its policy ends. Retention periods are minimums: a document is
+// kept at least that long, and only the retention job deletes it after.
+type RetentionError struct {
+	Until time.Time
+}
+
+func (e *RetentionError) Error() string {
+	return fmt.Sprintf("retained until %s", e.Until.UTC().Format("2006-01-02"))
+}
+
+// RetentionService deletes documents once the retention policies of their
+// workspaces say they are no longer needed, warning their uploaders first
+type RetentionService struct {
+	db       *database.Queries
+	storage  StorageService
+	quotas   *QuotaService
+	cache    *CachedRepository
+	notifier Notifier
+	audit    *AuditLog
+}
+
+func NewRetentionService(db *database.Queries, storage StorageService, quotas *QuotaService, cache *CachedRepository, notifier Notifier, audit *AuditLog) *RetentionService {
+	return &RetentionService{
+		db:       db,
+		storage:  storage,
+		quotas:   quotas,
+		cache:    cache,
+		notifier: notifier,
+		audit:    audit,
+	}
+}
+
+// Register adds the service's task handlers to mux
+func (s *RetentionService) Register(mux *asynq.ServeMux) {
+	mux.HandleFunc(TypeRetentionEnforce, s.HandleEnforce)
+}
+
+// HandleEnforce runs Enforce for the scheduler
+func (s *RetentionService) HandleEnforce(ctx context.Context, task *asynq.Task) error {
+	return s.Enforce(ctx)
+}
+
+// Plan returns the documents of a workspace that its retention policies
+// delete by until, soonest first. Nothing is changed, so this is the dry
+// run of Enforce.
+func (s *RetentionService) Plan(ctx context.Context, workspaceID pgtype.UUID, until time.Time) ([]RetentionItem, error) {
+	items, err := planWorkspace(ctx, s.db, workspaceID, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	planned := make([]RetentionItem, 0, len(items))
+	for _, item := range items {
+		if !item.DeleteAt.After(until) {
+			planned = append(planned, item)
+		}
+	}
+	sort.Slice(planned, func(i, j int) bool {
+		return planned[i].DeleteAt.Before(planned[j].DeleteAt)
+	})
+	return planned, nil
+}
+
+// Enforce warns the uploaders of documents that will soon be deleted and
+// deletes those that are due, in every workspace with a retention policy.
+// A document is never deleted before its uploader was warned, if its
+// policy warns, nor while it is under legal hold.
+func (s *RetentionService) Enforce(ctx context.Context) error {
+	workspaces, err := s.db.ListRetentionWorkspaces(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list workspaces with retention policies: %w", err)
+	}
+
+	for _, workspaceID := range workspaces {
+		now := time.Now()
+		items, err := planWorkspace(ctx, s.db, workspaceID, now)
+		if err != nil {
+			log.Printf("Failed to plan retention for workspace %s: %v", workspaceID.String(), err)
+			continue
+		}
+
+		for _, item := range items {
+			switch {
+			case item.Held:
+			case !now.Before(item.DeleteAt):
+				if err := s.expire(ctx, item); err != nil {
+					log.Printf("Failed to delete expired document %s: %v", item.DocumentID, err)
+				}
+			case !item.Warned && !item.WarnAt.IsZero() && !now.Before(item.WarnAt):
+				if err := s.warn(ctx, item); err != nil {
+					log.Printf("Failed to warn about expiring document %s: %v", item.DocumentID, err)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// planWorkspace plans the deletion of every document of a workspace that a
+// retention policy covers
+func planWorkspace(ctx context.Context, db *database.Queries, workspaceID pgtype.UUID, now time.Time) ([]RetentionItem, error) {
+	policies, err := db.ListRetentionPolicies(ctx, workspaceID)
+	if err != nil {
+		return nil, fmt.Errorf("policies: %w", err)
+	}
+	if len(policies) == 0 {
+		return nil, nil
+	}
+	folders, err := db.ListFoldersByWorkspace(ctx, workspaceID)
+	if err != nil {
+		return nil, fmt.Errorf("folders: %w", err)
+	}
+	docs, err := db.ListRetentionDocuments(ctx, workspaceID)
+	if err != nil {
+		return nil, fmt.Errorf("documents: %w", err)
+	}
+	return PlanRetention(policies, folders, docs, now), nil
+}
+
+// RetainedUntil returns when the retention period of a document in the
+// workspace ends, or the zero time if no policy covers the document or its
+// period has ended. Documents in the trash are covered as well.
+func RetainedUntil(ctx context.Context, db *database.Queries, documentID, workspaceID pgtype.UUID, now time.Time) (time.Time, error) {
+	policies, err := db.ListRetentionPolicies(ctx, workspaceID)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("policies: %w", err)
+	}
+	if len(policies) == 0 {
+		return time.Time{}, nil
+	}
+	doc, err := db.GetRetentionDocument(ctx, documentID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, fmt.Errorf("document: %w", err)
+	}
+	folders, err := db.ListFoldersByWorkspace(ctx, workspaceID)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("folders: %w", err)
+	}
+
+	items := PlanRetention(policies, folders, []database.ListRetentionDocumentsRow{database.ListRetentionDocumentsRow(doc)}, now)
+	if len(items) == 0 || !items[0].DueAt.After(now) {
+		return time.Time{}, nil
+	}
+	return items[0].DueAt, nil
+}
+
+// WorkspaceRetainedUntil returns when the last retention period of the
+// documents in a workspace ends, or the zero time if none is running
+func WorkspaceRetainedUntil(ctx context.Context, db *database.Queries, workspaceID pgtype.UUID, now time.Time) (time.Time, error) {
+	items, err := planWorkspace(ctx, db, workspaceID, now)
+	if err != nil {
+		return time.Time{}, err
+	}
+	var until time.Time
+	for _, item := range items {
+		if item.DueAt.After(now) && item.DueAt.After(until) {
+			until = item.DueAt
+		}
+	}
+	return until, nil
+}
+
+// warn records the warning for a document and notifies its uploader
+func (s *RetentionService) warn(ctx context.Context, item RetentionItem) error {
+	claimed, err := s.db.ClaimRetentionNotice(ctx, database.ClaimRetentionNoticeParams{
+		DocumentID: pgtype.UUID{Bytes: item.DocumentID, Valid: true},
+		DueAt:      pgtype.Timestamptz{Time: item.DueAt, Valid: true},
+		DeleteAt:   pgtype.Timestamptz{Time: item.DeleteAt, Valid: true},
+	})
+	if err != nil {
+		return err
+	}
+	if claimed == 0 {
+		return nil
+	}
+
+	return s.notifier.Notify(ctx, Notification{
+		UserID:  item.UserID,
+		Event:   EventDocumentExpiring,
+		Subject: fmt.Sprintf("Document \"%s\" will be deleted", item.Filename),
+		Body: fmt.Sprintf("Your document \"%s\" will be deleted on %s under the retention policy of its workspace. Download it before then if you still need it.",
+			item.Filename, item.DeleteAt.UTC().Format("2006-01-02 15:04 MST")),
+		Data: map[string]string{
+			"document_id": item.DocumentID.String(),
+			"policy_id":   item.PolicyID.String(),
+			"delete_at":   item.DeleteAt.Format(time.RFC3339),
+		},
+	})
+}
+
+// expire deletes a document the way users do, from the database and then
+// from storage, giving its storage back to the quotas. The deletion checks
+// the legal hold again, since a hold placed after planning must keep the
+// file.
+func (s *RetentionService) expire(ctx context.Context, item RetentionItem) error {
+	doc, err := s.quotas.DeleteDocument(ctx, database.DeleteDocumentParams{
+		ID:          pgtype.UUID{Bytes: item.DocumentID, Valid: true},
+		WorkspaceID: pgtype.UUID{Bytes: item.WorkspaceID, Valid: true},
+	})
+	if errors.Is(err, ErrLegalHold) || errors.Is(err, pgx.ErrNoRows) {
+		// Held since planning, or already deleted or moved to another
+		// workspace
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := s.storage.Delete(ctx, "documents", doc.FilePath, minio.RemoveObjectOptions{}); err != nil {
+		log.Printf("Failed to delete file of expired document %s from storage: %v", item.DocumentID, err)
+	}
+	s.cache.InvalidateDocument(ctx, item.DocumentID, doc.WorkspaceID.Bytes)
+
+	return s.audit.Record(ctx, AuditEvent{
+		Action:       AuditDocumentExpired,
+		ResourceType: "document",
+		ResourceID:   item.DocumentID.String(),
+		Details: map[string]string{
+			"filename":     doc.Filename,
+			"workspace_id": doc.WorkspaceID.String(),
+			"uploaded_by":  doc.UserID.String(),
+			"policy_id":    item.PolicyID.String(),
+			"due_at":       item.DueAt.Format(time.RFC3339),
+		},
+	})
+}
+
+// PlanRetention works out when the documents of a workspace are deleted.
+// The most specific policy applies to a document: that of one of its tags,
+// the longest if several match, otherwise that of its folder or the nearest
+// folder above it, otherwise the workspace's. Documents no policy covers
+// are left out.
+func PlanRetention(policies []database.RetentionPolicy, folders []database.Folder, docs []database.ListRetentionDocumentsRow, now time.Time) []RetentionItem {
+	var workspacePolicy *database.RetentionPolicy
+	folderPolicies := make(map[uuid.UUID]*database.RetentionPolicy)
+	tagPolicies := make(map[string]*database.RetentionPolicy)
+	for i := range policies {
+		policy := &policies[i]
+		switch {
+		case policy.Tag.Valid:
+			tagPolicies[policy.Tag.String] = policy
+		case policy.FolderID.Valid:
+			folderPolicies[policy.FolderID.Bytes] = policy
+		default:
+			workspacePolicy = policy
+		}
+	}
+
+	parents := make(map[uuid.UUID]pgtype.UUID, len(folders))
+	for _, folder := range folders {
+		parents[folder.ID.Bytes] = folder.ParentID
+	}
+
+	items := make([]RetentionItem, 0, len(docs))
+	for _, doc := range docs {
+		uploaded := doc.CreatedAt.Time.UTC()
+
+		var policy *database.RetentionPolicy
+		var dueAt time.Time
+		for _, tag := range doc.Tags {
+			if p, ok := tagPolicies[tag]; ok {
+				if due := retentionDue(p, uploaded); policy == nil || due.After(dueAt) {
+					policy, dueAt = p, due
+				}
+			}
+		}
+		// Folders cannot nest deeper than there are folders, which stops the
+		// walk should the parents ever form a loop
+		for folder, depth := doc.FolderID, 0; policy == nil && folder.Valid && depth <= len(folders); depth++ {
+			policy = folderPolicies[folder.Bytes]
+			folder = parents[folder.Bytes]
+		}
+		if policy == nil {
+			policy = workspacePolicy
+		}
+		if policy == nil {
+			continue
+		}
+		if dueAt.IsZero() {
+			dueAt = retentionDue(policy, uploaded)
+		}
+
+		item := RetentionItem{
+			DocumentID:  doc.ID.Bytes,
+			UserID:      doc.UserID.Bytes,
+			Filename:    doc.Filename,
+			WorkspaceID: policy.WorkspaceID.Bytes,
+			PolicyID:    policy.ID.Bytes,
+			DueAt:       dueAt,
+			DeleteAt:    dueAt,
+			Held:        doc.Held,
+		}
+		if policy.WarnDays > 0 {
+			item.WarnAt = dueAt.AddDate(0, 0, -int(policy.WarnDays))
+			switch {
+			case doc.NoticeDueAt.Valid && doc.NoticeDueAt.Time.Equal(dueAt):
+				item.Warned = true
+				item.DeleteAt = doc.NoticeDeleteAt.Time.UTC()
+			case now.After(item.WarnAt):
+				// Warned late, such as by a new policy: the uploader still
+				// gets the whole warning period
+				if warned := now.UTC().Truncate(time.Microsecond).AddDate(0, 0, int(policy.WarnDays)); warned.After(dueAt) {
+					item.DeleteAt = warned
+				}
+			}
+		}
+		items = append(items, item)
+	}
+	return items
+}
+
+// retentionDue is when a policy's retention period for a document uploaded
+// at uploaded ends. Periods are calendar months and days, so "keep for 7
+// years" ends on the same date 7 years later. Until then the document
+// cannot be deleted.
+func retentionDue(policy *database.RetentionPolicy, uploaded time.Time) time.Time {
+	return uploaded.AddDate(0, int(policy.RetainMonths), int(policy.RetainDays))
+}
+
+// RetentionPeriod describes a retention period for people, such as
+// "7 years" or "1 month and 15 days"
+func RetentionPeriod(months, days int32) string {
+	var parts []string
+	plural := func(n int32, unit string) string {
+		if n == 1 {
+			return fmt.Sprintf("1 %s", unit)
+		}
+		return fmt.Sprintf("%d %ss", n, unit)
+	}
+	if months >= 12 {
+		parts = append(parts, plural(months/12, "year"))
+		months %= 12
+	}
+	if months > 0 {
+		parts = append(parts, plural(months, "month"))
+	}
+	if days > 0 {
+		parts = append(parts, plural(days, "day"))
+	}
+	switch len(parts) {
+	case 0:
+		return ""
+	case 1:
+		return parts[0]
+	}
+	result := parts[0]
+	for _, part := range parts[1 : len(parts)-1] {
+		result += ", " + part
+	}
+	return result + " and " + parts[len(parts)-1]
+}
@@ -0,0 +1,190 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"Secure-Document-Exchange-Portal/internal/database"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+func retentionTestID() pgtype.UUID {
+	return pgtype.UUID{Bytes: uuid.New(), Valid: true}
+}
+
+// The most specific policy applies: a tag's over a folder's, a folder's over
+// its parent's and the workspace's
+func TestPlanRetentionMostSpecificPolicy(t *testing.T) {
+	workspaceID := retentionTestID()
+	parent := database.Folder{ID: retentionTestID(), WorkspaceID: workspaceID}
+	child := database.Folder{ID: retentionTestID(), ParentID: parent.ID, WorkspaceID: workspaceID}
+
+	workspacePolicy := database.RetentionPolicy{ID: retentionTestID(), WorkspaceID: workspaceID, RetainDays: 90}
+	folderPolicy := database.RetentionPolicy{ID: retentionTestID(), WorkspaceID: workspaceID, FolderID: parent.ID, RetainMonths: 12}
+	taxPolicy := database.RetentionPolicy{ID: retentionTestID(), WorkspaceID: workspaceID, Tag: pgtype.Text{String: "tax", Valid: true}, RetainMonths: 84}
+	shortPolicy := database.RetentionPolicy{ID: retentionTestID(), WorkspaceID: workspaceID, Tag: pgtype.Text{String: "scratch", Valid: true}, RetainDays: 7}
+
+	uploaded := time.Date(2024, 2, 29, 12, 0, 0, 0, time.UTC)
+	doc := func(folder pgtype.UUID, tags ...string) database.ListRetentionDocumentsRow {
+		return database.ListRetentionDocumentsRow{
+			ID:        retentionTestID(),
+			FolderID:  folder,
+			CreatedAt: pgtype.Timestamptz{Time: uploaded, Valid: true},
+			Tags:      tags,
+		}
+	}
+	docs := []database.ListRetentionDocumentsRow{
+		doc(pgtype.UUID{}),
+		doc(child.ID),
+		doc(child.ID, "tax", "scratch"),
+		doc(pgtype.UUID{}, "other"),
+	}
+
+	items := PlanRetention(
+		[]database.RetentionPolicy{workspacePolicy, folderPolicy, taxPolicy, shortPolicy},
+		[]database.Folder{parent, child},
+		docs,
+		uploaded,
+	)
+	if len(items) != len(docs) {
+		t.Fatalf("planned %d documents, want %d", len(items), len(docs))
+	}
+
+	want := []struct {
+		policy database.RetentionPolicy
+		due    time.Time
+	}{
+		{workspacePolicy, uploaded.AddDate(0, 0, 90)},
+		{folderPolicy, uploaded.AddDate(1, 0, 0)},
+		{taxPolicy, uploaded.AddDate(7, 0, 0)},
+		{workspacePolicy, uploaded.AddDate(0, 0, 90)},
+	}
+	for i, item := range items {
+		if item.PolicyID != want[i].policy.ID.Bytes {
+			t.Errorf("document %d falls under policy %s, want %s", i, item.PolicyID, uuid.UUID(want[i].policy.ID.Bytes))
+		}
+		if !item.DueAt.Equal(want[i].due) {
+			t.Errorf("document %d is due %s, want %s", i, item.DueAt, want[i].due)
+		}
+	}
+}
+
+// Documents are never deleted sooner than the warning period after their
+// uploader was warned
+func TestPlanRetentionWarningPeriod(t *testing.T) {
+	workspaceID := retentionTestID()
+	policy := database.RetentionPolicy{ID: retentionTestID(), WorkspaceID: workspaceID, RetainDays: 30, WarnDays: 14}
+	uploaded := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	due := uploaded.AddDate(0, 0, 30)
+	row := database.ListRetentionDocumentsRow{
+		ID:        retentionTestID(),
+		CreatedAt: pgtype.Timestamptz{Time: uploaded, Valid: true},
+	}
+	plan := func(row database.ListRetentionDocumentsRow, now time.Time) RetentionItem {
+		items := PlanRetention([]database.RetentionPolicy{policy}, nil, []database.ListRetentionDocumentsRow{row}, now)
+		if len(items) != 1 {
+			t.Fatalf("planned %d documents, want 1", len(items))
+		}
+		return items[0]
+	}
+
+	// In time: the warning goes out 14 days ahead and the document is
+	// deleted when due
+	item := plan(row, uploaded)
+	if !item.WarnAt.Equal(due.AddDate(0, 0, -14)) || !item.DeleteAt.Equal(due) || item.Warned {
+		t.Errorf("planned warning at %s and deletion at %s, want %s and %s", item.WarnAt, item.DeleteAt, due.AddDate(0, 0, -14), due)
+	}
+
+	// Already overdue and not warned: deletion waits 14 days from now
+	now := due.AddDate(0, 0, 5)
+	if item := plan(row, now); !item.DeleteAt.Equal(now.AddDate(0, 0, 14)) {
+		t.Errorf("unwarned overdue document is deleted at %s, want %s", item.DeleteAt, now.AddDate(0, 0, 14))
+	}
+
+	// Warned about this due date: the recorded deletion time holds
+	warned := row
+	warned.NoticeDueAt = pgtype.Timestamptz{Time: due, Valid: true}
+	warned.NoticeDeleteAt = pgtype.Timestamptz{Time: due.AddDate(0, 0, 3), Valid: true}
+	if item := plan(warned, now); !item.Warned || !item.DeleteAt.Equal(due.AddDate(0, 0, 3)) {
+		t.Errorf("warned document is deleted at %s (warned %v), want %s", item.DeleteAt, item.Warned, due.AddDate(0, 0, 3))
+	}
+
+	// Warned about another due date, as after the policy changed: warned again
+	warned.NoticeDueAt = pgtype.Timestamptz{Time: due.AddDate(0, 0, -10), Valid: true}
+	if item := plan(warned, uploaded); item.Warned {
+		t.Error("a warning for another due date counts")
+	}
+}
+
+func TestRetentionPeriod(t *testing.T) {
+	cases := map[[2]int32]string{
+		{84, 0}:  "7 years",
+		{0, 90}:  "90 days",
+		{1, 1}:   "1 month and 1 day",
+		{13, 15}: "1 year, 1 month and 15 days",
+	}
+	for period, want := range cases {
+		if got := RetentionPeriod(period[0], period[1]); got != want {
+			t.Errorf("RetentionPeriod(%d, %d) = %q, want %q", period[0], period[1], got, want)
+		}
+	}
+}
+
+// Retention periods are minimums: documents cannot be deleted, purged from
+// the trash or deleted with their uploader's account before theirs ends
+func TestRetentionPeriodIsMinimum(t *testing.T) {
+	f := newFixtures(t)
+	storage := newMemoryStorage()
+	trash := NewTrashService(f.db, storage, f.quotas, f.cache, f.auditLog(), time.Hour)
+	privacy := newTestPrivacyService(f, storage)
+
+	user, workspace := f.user()
+	if _, err := f.pool.Exec(f.ctx, `INSERT INTO retention_policies (workspace_id, retain_days, created_by) VALUES ($1, 30, $2)`,
+		workspace, user); err != nil {
+		t.Fatal(err)
+	}
+	// document creates a document uploaded the given number of days ago and
+	// trashed two hours ago, past the restore window
+	document := func(age int) database.Document {
+		doc := f.document(user, workspace, 100)
+		if _, err := f.pool.Exec(f.ctx, `UPDATE documents SET created_at = $2, deleted_at = $3 WHERE id = $1`,
+			doc.ID, time.Now().AddDate(0, 0, -age), time.Now().Add(-2*time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+		return doc
+	}
+	retained, expired := document(10), document(31)
+
+	until, err := RetainedUntil(f.ctx, f.db, retained.ID, workspace, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := time.Now().AddDate(0, 0, 20); until.Sub(want).Abs() > time.Minute {
+		t.Errorf("RetainedUntil = %s, want %s", until, want)
+	}
+	if until, err := RetainedUntil(f.ctx, f.db, expired.ID, workspace, time.Now()); err != nil || !until.IsZero() {
+		t.Errorf("RetainedUntil of an expired document = %s, %v, want the zero time", until, err)
+	}
+
+	var retentionErr *RetentionError
+	if err := trash.Delete(f.ctx, retained); !errors.As(err, &retentionErr) || !retentionErr.Until.Equal(until) {
+		t.Errorf("Delete error = %v, want a retention error until %s", err, until)
+	}
+	if err := privacy.CheckDeletable(f.ctx, user); !errors.As(err, &retentionErr) {
+		t.Errorf("CheckDeletable error = %v, want a retention error", err)
+	}
+
+	if err := trash.Purge(f.ctx); err != nil {
+		t.Fatalf("Purge: %v", err)
+	}
+	if _, err := f.db.GetTrashedDocument(f.ctx, retained.ID); err != nil {
+		t.Errorf("retained document after the purge: %v, want it kept", err)
+	}
+	if _, err := f.db.GetTrashedDocument(f.ctx, expired.ID); !errors.Is(err, pgx.ErrNoRows) {
+		t.Errorf("expired document after the purge: %v, want it purged", err)
+	}
+}
@@ -0,0 +1,132 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"Secure-Document-Exchange-Portal/internal/database"
+
+	"github.com/hibiken/asynq"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/minio/minio-go/v7"
+)
+
+// trashPurgeBatch is how many documents Purge deletes per query
+const trashPurgeBatch = 100
+
+// TrashService empties the recycle bin. Deleted documents stay in the
+// trash, where they can be restored, for the restore window and are then
+// deleted for good, unless a legal hold or their retention period keeps
+// them.
+type TrashService struct {
+	db      *database.Queries
+	storage StorageService
+	quotas  *QuotaService
+	cache   *CachedRepository
+	audit   *AuditLog
+	window  time.Duration
+}
+
+func NewTrashService(db *database.Queries, storage StorageService, quotas *QuotaService, cache *CachedRepository, audit *AuditLog, window time.Duration) *TrashService {
+	return &TrashService{
+		db:      db,
+		storage: storage,
+		quotas:  quotas,
+		cache:   cache,
+		audit:   audit,
+		window:  window,
+	}
+}
+
+// Register adds the service's task handlers to mux
+func (s *TrashService) Register(mux *asynq.ServeMux) {
+	mux.HandleFunc(TypeTrashPurge, s.HandlePurge)
+}
+
+// HandlePurge runs Purge for the scheduler
+func (s *TrashService) HandlePurge(ctx context.Context, task *asynq.Task) error {
+	return s.Purge(ctx)
+}
+
+// Cutoff is the start of the restore window: documents trashed before it
+// can no longer be restored and are purged
+func (s *TrashService) Cutoff(now time.Time) time.Time {
+	return now.Add(-s.window)
+}
+
+// PurgeAt is when a document trashed at deletedAt is deleted for good
+func (s *TrashService) PurgeAt(deletedAt time.Time) time.Time {
+	return deletedAt.Add(s.window)
+}
+
+// Delete deletes a trashed document for good and gives its storage back to
+// the quotas. The row goes first, since the database refuses to delete
+// documents under legal hold, and the file after it.
+func (s *TrashService) Delete(ctx context.Context, doc database.Document) error {
+	if _, err := s.quotas.DeleteDocument(ctx, database.DeleteDocumentParams{
+		ID:          doc.ID,
+		WorkspaceID: doc.WorkspaceID,
+	}); err != nil {
+		return err
+	}
+
+	if err := s.storage.Delete(ctx, "documents", doc.FilePath, minio.RemoveObjectOptions{}); err != nil {
+		log.Printf("Failed to delete file of document %s from storage: %v", doc.ID.String(), err)
+	}
+	s.cache.InvalidateDocument(ctx, doc.ID.Bytes, doc.WorkspaceID.Bytes)
+	return nil
+}
+
+// Purge deletes the documents whose restore window has passed. Documents
+// under legal hold stay in the trash until the hold is released, and
+// documents whose retention period has not ended until it ends.
+func (s *TrashService) Purge(ctx context.Context) error {
+	cutoff := pgtype.Timestamptz{Time: s.Cutoff(time.Now()), Valid: true}
+	for {
+		docs, err := s.db.ListPurgeableDocuments(ctx, database.ListPurgeableDocumentsParams{
+			Cutoff: cutoff,
+			Limit:  trashPurgeBatch,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to list documents to purge: %w", err)
+		}
+
+		purged := 0
+		for _, doc := range docs {
+			err := s.Delete(ctx, doc)
+			var retained *RetentionError
+			if errors.As(err, &retained) {
+				// Stays in the trash until its retention period ends
+				continue
+			}
+			if err != nil {
+				log.Printf("Failed to purge document %s: %v", doc.ID.String(), err)
+				continue
+			}
+			purged++
+
+			if err := s.audit.Record(ctx, AuditEvent{
+				Action:       AuditDocumentPurged,
+				ResourceType: "document",
+				ResourceID:   doc.ID.String(),
+				Details: map[string]string{
+					"filename":     doc.Filename,
+					"workspace_id": doc.WorkspaceID.String(),
+					"uploaded_by":  doc.UserID.String(),
+					"deleted_at":   doc.DeletedAt.Time.Format(time.RFC3339),
+				},
+			}); err != nil {
+				log.Printf("Failed to record purge of document %s: %v", doc.ID.String(), err)
+			}
+		}
+
+		// Documents that failed are listed again, so stop once a batch
+		// makes no progress
+		if len(docs) < trashPurgeBatch || purged == 0 {
+			return nil
+		}
+	}
+}
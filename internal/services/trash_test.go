@@ -0,0 +1,128 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"Secure-Document-Exchange-Portal/internal/database"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// Purge deletes documents once their restore window has passed unless a
+// hold on the document, a folder above it or its uploader keeps them, and
+// deleting a held document for good is refused. Restoring is up to the
+// window alone.
+func TestTrashHonoursLegalHolds(t *testing.T) {
+	f := newFixtures(t)
+	storage := newMemoryStorage()
+	const window = 24 * time.Hour
+	trash := NewTrashService(f.db, storage, f.quotas, f.cache, f.auditLog(), window)
+
+	type trashed struct {
+		doc, hold pgtype.UUID
+		file      string
+	}
+	cases := []struct {
+		name    string
+		expired bool
+		// hold is "", "document", "folder", "user" or "released"
+		hold        string
+		wantPurged  bool
+		wantRestore bool
+	}{
+		{"expired", true, "", true, false},
+		{"expired under a document hold", true, "document", false, false},
+		{"expired in a held folder", true, "folder", false, false},
+		{"expired from a held user", true, "user", false, false},
+		{"expired after the hold was released", true, "released", true, false},
+		{"in the restore window", false, "", false, true},
+		{"held in the restore window", false, "document", false, true},
+	}
+	docs := make([]trashed, len(cases))
+	for i, tc := range cases {
+		user, workspace := f.user()
+		parent := f.folder(user, workspace)
+		folder := f.id(`INSERT INTO folders (user_id, name, workspace_id, parent_id) VALUES ($1, 'Child', $2, $3) RETURNING id`,
+			user, workspace, parent)
+		doc := f.document(user, workspace, 100)
+		storage.objects[doc.FilePath] = []byte("file")
+
+		trashedAt := time.Now().Add(-time.Hour)
+		if tc.expired {
+			trashedAt = time.Now().Add(-window - time.Hour)
+		}
+		if _, err := f.pool.Exec(f.ctx, `UPDATE documents SET folder_id = $2, deleted_at = $3 WHERE id = $1`,
+			doc.ID, folder, trashedAt); err != nil {
+			t.Fatal(err)
+		}
+
+		var hold pgtype.UUID
+		switch tc.hold {
+		case "document":
+			hold = f.hold("document", doc.ID)
+		case "folder":
+			hold = f.hold("folder", parent)
+		case "user":
+			hold = f.hold("user", user)
+		case "released":
+			f.release(f.hold("document", doc.ID))
+		}
+		docs[i] = trashed{doc: doc.ID, hold: hold, file: doc.FilePath}
+	}
+
+	if err := trash.Purge(f.ctx); err != nil {
+		t.Fatalf("Purge: %v", err)
+	}
+
+	for i, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			f := f.in(t)
+			doc, err := f.db.GetTrashedDocument(f.ctx, docs[i].doc)
+			if purged := errors.Is(err, pgx.ErrNoRows); purged != tc.wantPurged {
+				t.Fatalf("purged = %v (%v), want %v", purged, err, tc.wantPurged)
+			}
+			if _, kept := storage.objects[docs[i].file]; kept == tc.wantPurged {
+				t.Errorf("file kept = %v, want %v", kept, !tc.wantPurged)
+			}
+			if tc.wantPurged {
+				return
+			}
+
+			if docs[i].hold.Valid {
+				if err := trash.Delete(f.ctx, doc); !errors.Is(err, ErrLegalHold) {
+					t.Errorf("Delete error = %v, want %v", err, ErrLegalHold)
+				}
+				if _, ok := storage.objects[doc.FilePath]; !ok {
+					t.Error("the file of a held document was deleted")
+				}
+			}
+
+			_, err = f.db.RestoreDocument(f.ctx, database.RestoreDocumentParams{
+				ID:          doc.ID,
+				WorkspaceID: doc.WorkspaceID,
+				Cutoff:      pgtype.Timestamptz{Time: trash.Cutoff(time.Now()), Valid: true},
+			})
+			if restored := err == nil; restored != tc.wantRestore {
+				t.Errorf("restored = %v (%v), want %v", restored, err, tc.wantRestore)
+			}
+			if tc.wantRestore {
+				return
+			}
+
+			// Once the hold is released, the next purge deletes the document
+			f.release(docs[i].hold)
+			if err := trash.Purge(f.ctx); err != nil {
+				t.Fatalf("Purge: %v", err)
+			}
+			if _, err := f.db.GetTrashedDocument(f.ctx, doc.ID); !errors.Is(err, pgx.ErrNoRows) {
+				t.Errorf("document after the hold was released: %v, want it purged", err)
+			}
+			if _, ok := storage.objects[doc.FilePath]; ok {
+				t.Error("the file was kept after the hold was released")
+			}
+		})
+	}
+}
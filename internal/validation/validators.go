@@ -3,6 +3,7 @@ package validation
 import (
 	"fmt"
 	"mime/multipart"
+	"net/netip"
 	"path/filepath"
 	"regexp"
 	"strings"
@@ -228,3 +229,193 @@ func ValidateSharePassword(password string) error {
 
 	return nil
 }
+
+// ValidateShareBundle validates the name and size of a multi-document share
+func ValidateShareBundle(name string, documentCount int) error {
+	if len(name) > 255 {
+		return fmt.Errorf("share name is too long (max 255 characters)")
+	}
+
+	if documentCount > 100 {
+		return fmt.Errorf("a share cannot contain more than 100 documents")
+	}
+
+	return nil
+}
+
+// ValidateGroupName validates the name of an organization, team or workspace
+func ValidateGroupName(kind, name string) error {
+	if name == "" {
+		return fmt.Errorf("%s name is required", kind)
+	}
+
+	if len(name) > 255 {
+		return fmt.Errorf("%s name is too long (max 255 characters)", kind)
+	}
+
+	return nil
+}
+
+// ValidateFolderName validates a folder name
+func ValidateFolderName(name string) error {
+	if name == "" {
+		return fmt.Errorf("folder name is required")
+	}
+
+	if len(name) > 255 {
+		return fmt.Errorf("folder name is too long (max 255 characters)")
+	}
+
+	if strings.ContainsAny(name, "/\\") {
+		return fmt.Errorf("folder name cannot contain slashes")
+	}
+
+	return nil
+}
+
+// ValidateFileRequest validates the limits of an inbound file request
+func ValidateFileRequest(title string, maxFiles int, maxFileSizeMB int) error {
+	if strings.TrimSpace(title) == "" {
+		return fmt.Errorf("title is required")
+	}
+
+	if len(title) > 255 {
+		return fmt.Errorf("title is too long (max 255 characters)")
+	}
+
+	if maxFiles < -1 || maxFiles == 0 {
+		return fmt.Errorf("max files must be -1 (unlimited) or a positive number")
+	}
+
+	if maxFiles > 1000 {
+		return fmt.Errorf("max files cannot exceed 1,000")
+	}
+
+	// Uploads are still subject to ValidateFile's 100 MB limit
+	if maxFileSizeMB < 1 || maxFileSizeMB > 100 {
+		return fmt.Errorf("max file size must be between 1 and 100 MB")
+	}
+
+	return nil
+}
+
+// ValidateAllowedTypes checks that every requested MIME type is one the
+// portal accepts at all
+func ValidateAllowedTypes(mimeTypes []string) error {
+	for _, mimeType := range mimeTypes {
+		if !allowedMimeTypes[mimeType] {
+			return fmt.Errorf("file type not allowed: %s", mimeType)
+		}
+	}
+
+	return nil
+}
+
+// ParseCIDRList parses a comma or whitespace separated list of CIDR ranges.
+// Bare IP addresses are treated as single-host ranges.
+func ParseCIDRList(value string) ([]netip.Prefix, error) {
+	fields := strings.FieldsFunc(value, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\n' || r == '\r' || r == '\t'
+	})
+
+	if len(fields) > 50 {
+		return nil, fmt.Errorf("too many network ranges (max 50)")
+	}
+
+	prefixes := make([]netip.Prefix, 0, len(fields))
+	for _, field := range fields {
+		if strings.Contains(field, "/") {
+			prefix, err := netip.ParsePrefix(field)
+			if err != nil {
+				return nil, fmt.Errorf("invalid network range: %s", field)
+			}
+			prefixes = append(prefixes, prefix.Masked())
+			continue
+		}
+
+		addr, err := netip.ParseAddr(field)
+		if err != nil {
+			return nil, fmt.Errorf("invalid IP address: %s", field)
+		}
+		addr = addr.Unmap()
+		prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+	}
+
+	return prefixes, nil
+}
+
+// ValidateShareNotifications validates a share's owner notification settings
+func ValidateShareNotifications(onAccess string, passwordFailures, expiringHours int) error {
+	switch onAccess {
+	case "none", "first", "every":
+	default:
+		return fmt.Errorf("access notifications must be one of none, first or every")
+	}
+
+	if passwordFailures < 0 || passwordFailures > 100 {
+		return fmt.Errorf("password failure threshold must be between 1 and 100")
+	}
+
+	if expiringHours < 0 || expiringHours > 720 {
+		return fmt.Errorf("expiry warning must be between 1 and 720 hours before expiry")
+	}
+
+	return nil
+}
+
+// ValidateTags validates the tags of a document
+func ValidateTags(tags []string) error {
+	if len(tags) > 20 {
+		return fmt.Errorf("a document cannot have more than 20 tags")
+	}
+
+	for _, tag := range tags {
+		if tag == "" {
+			return fmt.Errorf("tags cannot be empty")
+		}
+		if len(tag) > 64 {
+			return fmt.Errorf("tag %q is too long (max 64 characters)", tag)
+		}
+		if strings.ContainsAny(tag, ",\n\r\t") {
+			return fmt.Errorf("tag %q cannot contain commas or line breaks", tag)
+		}
+	}
+
+	return nil
+}
+
+// ValidateRetention validates a retention period of whole months and days
+// and the number of days before its end that uploaders are warned
+func ValidateRetention(months, days, warnDays int) error {
+	if months < 0 || days < 0 || months+days == 0 {
+		return fmt.Errorf("retention period is required")
+	}
+
+	if months > 1200 || days > 36500 {
+		return fmt.Errorf("retention period is too long (max 100 years)")
+	}
+
+	if warnDays < 0 || warnDays > 365 {
+		return fmt.Errorf("warning must be between 0 and 365 days before deletion")
+	}
+
+	return nil
+}
+
+// ValidateLegalHold validates the reason for placing or releasing a legal
+// hold and the custodian responsible for the held data
+func ValidateLegalHold(reason, custodian string) error {
+	if reason == "" {
+		return fmt.Errorf("reason is required")
+	}
+
+	if len(reason) > 2000 {
+		return fmt.Errorf("reason is too long (max 2000 characters)")
+	}
+
+	if len(custodian) > 255 {
+		return fmt.Errorf("custodian is too long (max 255 characters)")
+	}
+
+	return nil
+}
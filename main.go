@@ -3,10 +3,12 @@ package main
 import (
 	"context"
 	"fmt"
-	"io"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 	"time"
 
 	"Secure-Document-Exchange-Portal/internal/auth"
@@ -14,186 +16,17 @@ import (
 	"Secure-Document-Exchange-Portal/internal/handlers"
 	"Secure-Document-Exchange-Portal/internal/middleware"
 	"Secure-Document-Exchange-Portal/internal/services"
+	"Secure-Document-Exchange-Portal/internal/validation"
 	"Secure-Document-Exchange-Portal/templates"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/cors"
 	"github.com/gofiber/fiber/v2/middleware/filesystem"
 	"github.com/gofiber/fiber/v2/middleware/logger"
-	"github.com/google/uuid"
-	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/hibiken/asynq"
 	"github.com/joho/godotenv"
-	"github.com/minio/minio-go/v7"
-	"golang.org/x/crypto/bcrypt"
 )
 
-func AccessShare(c *fiber.Ctx, db *database.Queries, storage services.StorageService, cachedRepo *services.CachedRepository) error {
-	token := c.Params("token")
-
-	// Use cached repository for share lookup
-	share, err := cachedRepo.GetShareByToken(c.Context(), token)
-	if err != nil {
-		c.Set("Content-Type", "text/html")
-		return c.Status(fiber.StatusNotFound).SendString(`
-			<html><body style="font-family: sans-serif; max-width: 600px; margin: 50px auto; padding: 20px;">
-			<div style="background: #fee; border: 1px solid #fcc; padding: 20px; border-radius: 8px;">
-				<h2 style="color: #c00; margin: 0 0 10px 0;">❌ Share Not Found</h2>
-				<p>This share link does not exist or has been deleted.</p>
-			</div>
-			</body></html>
-		`)
-	}
-
-	// Check expiration
-	if share.ExpiresAt.Before(time.Now()) {
-		c.Set("Content-Type", "text/html")
-		return c.Status(fiber.StatusGone).SendString(`
-			<html><body style="font-family: sans-serif; max-width: 600px; margin: 50px auto; padding: 20px;">
-			<div style="background: #ffe; border: 1px solid #ffa; padding: 20px; border-radius: 8px;">
-				<h2 style="color: #a80; margin: 0 0 10px 0;">⏱️ Share Expired</h2>
-				<p>This share link has expired and is no longer available.</p>
-			</div>
-			</body></html>
-		`)
-	}
-
-	// Check access count
-	if share.MaxAccess != -1 && share.AccessCount >= share.MaxAccess {
-		c.Set("Content-Type", "text/html")
-		return c.Status(fiber.StatusGone).SendString(`
-			<html><body style="font-family: sans-serif; max-width: 600px; margin: 50px auto; padding: 20px;">
-			<div style="background: #ffe; border: 1px solid #ffa; padding: 20px; border-radius: 8px;">
-				<h2 style="color: #a80; margin: 0 0 10px 0;">🔒 Access Limit Reached</h2>
-				<p>This share link has reached its maximum number of accesses.</p>
-			</div>
-			</body></html>
-		`)
-	}
-
-	// Check password if set
-	if share.PasswordHash != nil {
-		password := c.FormValue("password")
-		if password == "" {
-			password = c.Query("password")
-		}
-
-		if password == "" {
-			// Show password form
-			errorMsg := ""
-			if c.Method() == "POST" {
-				errorMsg = `<p style="color: #c00; margin-bottom: 15px;">❌ Password is required</p>`
-			}
-
-			c.Set("Content-Type", "text/html")
-			return c.SendString(fmt.Sprintf(`
-				<html>
-				<head>
-					<title>Password Protected Share</title>
-					<style>
-						body { font-family: sans-serif; max-width: 500px; margin: 50px auto; padding: 20px; background: #f5f5f5; }
-						.container { background: white; padding: 30px; border-radius: 8px; box-shadow: 0 2px 10px rgba(0,0,0,0.1); }
-						h2 { color: #333; margin: 0 0 10px 0; }
-						.subtitle { color: #666; margin-bottom: 20px; font-size: 14px; }
-						.file-info { background: #f9f9f9; padding: 15px; border-radius: 5px; margin-bottom: 20px; }
-						.file-info strong { color: #555; }
-						input[type="password"] { width: 100%%; padding: 10px; border: 1px solid #ddd; border-radius: 4px; font-size: 14px; box-sizing: border-box; }
-						button { width: 100%%; padding: 12px; background: #4CAF50; color: white; border: none; border-radius: 4px; font-size: 16px; cursor: pointer; margin-top: 15px; }
-						button:hover { background: #45a049; }
-					</style>
-				</head>
-				<body>
-					<div class="container">
-						<h2>🔒 Password Protected</h2>
-						<p class="subtitle">This file is password protected</p>
-						<div class="file-info">
-							<strong>File:</strong> %s<br>
-							<strong>Size:</strong> %.2f MB
-						</div>
-						%s
-						<form method="POST">
-							<input type="password" name="password" placeholder="Enter password" required autofocus>
-							<button type="submit">Access File</button>
-						</form>
-					</div>
-				</body>
-				</html>
-			`, share.Filename, float64(share.FileSize)/1024/1024, errorMsg))
-		}
-
-		// Check password hash using bcrypt
-		if err := bcrypt.CompareHashAndPassword([]byte(*share.PasswordHash), []byte(password)); err != nil {
-			errorMsg := `<p style="color: #c00; margin-bottom: 15px;">❌ Invalid password. Please try again.</p>`
-			c.Set("Content-Type", "text/html")
-			return c.SendString(fmt.Sprintf(`
-				<html>
-				<head>
-					<title>Password Protected Share</title>
-					<style>
-						body { font-family: sans-serif; max-width: 500px; margin: 50px auto; padding: 20px; background: #f5f5f5; }
-						.container { background: white; padding: 30px; border-radius: 8px; box-shadow: 0 2px 10px rgba(0,0,0,0.1); }
-						h2 { color: #333; margin: 0 0 10px 0; }
-						.subtitle { color: #666; margin-bottom: 20px; font-size: 14px; }
-						.file-info { background: #f9f9f9; padding: 15px; border-radius: 5px; margin-bottom: 20px; }
-						.file-info strong { color: #555; }
-						input[type="password"] { width: 100%%; padding: 10px; border: 1px solid #ddd; border-radius: 4px; font-size: 14px; box-sizing: border-box; }
-						button { width: 100%%; padding: 12px; background: #4CAF50; color: white; border: none; border-radius: 4px; font-size: 16px; cursor: pointer; margin-top: 15px; }
-						button:hover { background: #45a049; }
-					</style>
-				</head>
-				<body>
-					<div class="container">
-						<h2>🔒 Password Protected</h2>
-						<p class="subtitle">This file is password protected</p>
-						<div class="file-info">
-							<strong>File:</strong> %s<br>
-							<strong>Size:</strong> %.2f MB
-						</div>
-						%s
-						<form method="POST">
-							<input type="password" name="password" placeholder="Enter password" required autofocus>
-							<button type="submit">Access File</button>
-						</form>
-					</div>
-				</body>
-				</html>
-			`, share.Filename, float64(share.FileSize)/1024/1024, errorMsg))
-		}
-	}
-
-	// Update access count (and invalidate cache after update)
-	shareID, err := uuid.Parse(share.ID)
-	if err != nil {
-		// log error but continue
-	} else {
-		err = db.UpdateShareAccess(c.Context(), pgtype.UUID{Bytes: shareID, Valid: true})
-		if err != nil {
-			// log error, but continue
-		}
-		// Invalidate the share cache since access count changed
-		cachedRepo.InvalidateShare(c.Context(), token)
-	}
-
-	// Download document
-	obj, err := storage.Download(c.Context(), "documents", share.FilePath, minio.GetObjectOptions{})
-	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to download file"})
-	}
-	defer obj.Close()
-
-	// TODO: Decrypt
-	data, err := io.ReadAll(obj)
-	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to read file"})
-	}
-
-	decryptedData := data // placeholder
-
-	// Send file
-	c.Set("Content-Type", share.MimeType)
-	c.Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", share.Filename))
-	return c.Send(decryptedData)
-}
-
 func main() {
 	if err := godotenv.Load(); err != nil {
 		log.Fatal("No .env file found")
@@ -207,11 +40,16 @@ func main() {
 
 	queries := database.New(db)
 
-	jwtSecret := os.Getenv("JWT_SECRET")
-	if jwtSecret == "" {
-		log.Fatal("jwt_secret not set")
+	appBaseURL := os.Getenv("APP_BASE_URL")
+	if appBaseURL == "" {
+		appBaseURL = "http://localhost:8080"
+	}
+
+	// Tokens are signed with JWT_SIGNING_KEY_FILE if set, JWT_SECRET otherwise
+	jwtService, err := auth.NewJWTService(auth.JWTConfigFromEnv(appBaseURL))
+	if err != nil {
+		log.Fatal("Failed to configure JWT signing:", err)
 	}
-	jwtService := auth.NewJWTService(jwtSecret)
 
 	// Initialize storage
 	var storage services.StorageService
@@ -277,6 +115,126 @@ func main() {
 	// Create cached repository
 	cachedRepo := services.NewCachedRepository(queries, cache)
 
+	// Every handler asks the policy what users may do, with the roles the
+	// cached repository looks up
+	policy := auth.NewPolicy(cachedRepo)
+
+	// Documents are created and deleted through the quota service, which
+	// keeps storage usage in step
+	quotas := services.NewQuotaService(db, queries)
+
+	// Security-relevant actions are appended to the hash-chained audit log.
+	// Events the database does not take are kept in AUDIT_SPILL_FILE and
+	// appended once it is back.
+	auditSpillFile := os.Getenv("AUDIT_SPILL_FILE")
+	if auditSpillFile == "" {
+		auditSpillFile = "audit-spill.jsonl"
+	}
+	auditLog := services.NewAuditLog(db, queries, cachedRepo, auditSpillFile)
+
+	// Owner notifications are delivered by email and/or webhook when
+	// configured, otherwise written to the log
+	var deliveryNotifiers []services.Notifier
+	smtpHost := os.Getenv("SMTP_HOST")
+	smtpPort := 587
+	if portStr := os.Getenv("SMTP_PORT"); portStr != "" {
+		fmt.Sscanf(portStr, "%d", &smtpPort)
+	}
+	if smtpHost != "" {
+		deliveryNotifiers = append(deliveryNotifiers, services.NewSMTPNotifier(
+			smtpHost, smtpPort, os.Getenv("SMTP_USERNAME"), os.Getenv("SMTP_PASSWORD"), os.Getenv("SMTP_FROM"),
+		))
+	}
+	if webhookURL := os.Getenv("NOTIFY_WEBHOOK_URL"); webhookURL != "" {
+		deliveryNotifiers = append(deliveryNotifiers, services.NewWebhookNotifier(webhookURL, os.Getenv("NOTIFY_WEBHOOK_SECRET")))
+	}
+	var deliveryNotifier services.Notifier = services.NewLogNotifier()
+	if len(deliveryNotifiers) > 0 {
+		deliveryNotifier = services.NewMultiNotifier(deliveryNotifiers...)
+	}
+
+	// Account emails (verification and password reset links) go out over
+	// SMTP when configured, otherwise they are written to the log so the
+	// links can be followed in local development
+	var deliveryMailer services.Mailer = services.NewLogMailer()
+	if smtpHost != "" {
+		deliveryMailer = services.NewSMTPMailer(
+			smtpHost, smtpPort, os.Getenv("SMTP_USERNAME"), os.Getenv("SMTP_PASSWORD"), os.Getenv("SMTP_FROM"),
+		)
+	}
+
+	// Notifications and emails are queued and delivered by the background
+	// worker so request handlers never wait on SMTP servers or webhooks
+	jobs := services.NewJobService(redisAddr, redisPassword, redisDB)
+	defer jobs.Close()
+	notifier := services.NewQueuedNotifier(jobs)
+	mailer := services.NewQueuedMailer(jobs)
+
+	// Retention policies delete documents through the quota service once
+	// they are no longer needed, after warning their uploaders
+	retention := services.NewRetentionService(queries, storage, quotas, cachedRepo, notifier, auditLog)
+
+	// Deleted documents can be restored from the trash for
+	// TRASH_RETENTION_DAYS (30 by default) and are purged after that
+	trashDays := 30
+	if daysStr := os.Getenv("TRASH_RETENTION_DAYS"); daysStr != "" {
+		fmt.Sscanf(daysStr, "%d", &trashDays)
+	}
+	if trashDays < 1 {
+		log.Fatal("TRASH_RETENTION_DAYS must be at least 1")
+	}
+	trash := services.NewTrashService(queries, storage, quotas, cachedRepo, auditLog, time.Duration(trashDays)*24*time.Hour)
+
+	// Users can export their data, and delete their account, which happens
+	// ACCOUNT_DELETION_GRACE_DAYS (14 by default) after they ask
+	graceDays := 14
+	if daysStr := os.Getenv("ACCOUNT_DELETION_GRACE_DAYS"); daysStr != "" {
+		fmt.Sscanf(daysStr, "%d", &graceDays)
+	}
+	if graceDays < 1 {
+		log.Fatal("ACCOUNT_DELETION_GRACE_DAYS must be at least 1")
+	}
+	privacy := services.NewPrivacyService(queries, storage, trash, quotas, cachedRepo, jobs, notifier, auditLog, time.Duration(graceDays)*24*time.Hour)
+
+	redisOpt := asynq.RedisClientOpt{Addr: redisAddr, Password: redisPassword, DB: redisDB}
+	worker := asynq.NewServer(redisOpt, asynq.Config{Concurrency: 5})
+	mux := asynq.NewServeMux()
+	services.NewNotificationWorker(queries, deliveryNotifier).Register(mux)
+	services.NewMailWorker(deliveryMailer).Register(mux)
+	services.NewMaintenanceWorker(queries).Register(mux)
+	retention.Register(mux)
+	trash.Register(mux)
+	privacy.Register(mux)
+	if err := worker.Start(mux); err != nil {
+		log.Printf("Warning: background worker not started: %v", err)
+	}
+
+	scheduler := asynq.NewScheduler(redisOpt, nil)
+	if _, err := scheduler.Register("*/15 * * * *", asynq.NewTask(services.TypeShareExpiryScan, nil)); err != nil {
+		log.Fatal("Failed to schedule share expiry scan:", err)
+	}
+	if _, err := scheduler.Register("@hourly", asynq.NewTask(services.TypeSessionCleanup, nil)); err != nil {
+		log.Fatal("Failed to schedule session cleanup:", err)
+	}
+	if _, err := scheduler.Register("0 2 * * *", asynq.NewTask(services.TypeRetentionEnforce, nil)); err != nil {
+		log.Fatal("Failed to schedule retention enforcement:", err)
+	}
+	if _, err := scheduler.Register("@hourly", asynq.NewTask(services.TypeTrashPurge, nil)); err != nil {
+		log.Fatal("Failed to schedule trash purge:", err)
+	}
+	if _, err := scheduler.Register("@hourly", asynq.NewTask(services.TypeAccountCleanup, nil)); err != nil {
+		log.Fatal("Failed to schedule account cleanup:", err)
+	}
+	if err := scheduler.Start(); err != nil {
+		log.Printf("Warning: job scheduler not started: %v", err)
+	}
+
+	// Watermarked page renderer for view-only shares
+	previewer, err := services.NewPreviewRenderer()
+	if err != nil {
+		log.Fatal("Failed to initialize preview renderer:", err)
+	}
+
 	app := fiber.New(fiber.Config{
 		ErrorHandler: func(c *fiber.Ctx, err error) error {
 			code := fiber.StatusInternalServerError
@@ -289,6 +247,13 @@ func main() {
 		},
 	})
 
+	// Derive client IPs, trusting X-Forwarded-For only from configured proxies
+	trustedProxies, err := validation.ParseCIDRList(os.Getenv("TRUSTED_PROXIES"))
+	if err != nil {
+		log.Fatal("Invalid TRUSTED_PROXIES:", err)
+	}
+	app.Use(middleware.RealIP(trustedProxies))
+
 	app.Use(logger.New())
 
 	// Security headers middleware
@@ -315,34 +280,80 @@ func main() {
 		Root: http.Dir("./static"),
 	}))
 
-	// Auth handler instance (declared later, but needed here)
-	var authHandler *handlers.AuthHandler
+	// Organization policy: every account must use two-factor authentication
+	requireMFA := os.Getenv("REQUIRE_MFA") == "true"
+
+	// WebAuthn relying party for security keys and passkeys. The origins must
+	// match the URLs users open the portal at exactly.
+	webAuthnRPID := os.Getenv("WEBAUTHN_RP_ID")
+	if webAuthnRPID == "" {
+		webAuthnRPID = "localhost"
+	}
+	webAuthnRPName := os.Getenv("WEBAUTHN_RP_NAME")
+	if webAuthnRPName == "" {
+		webAuthnRPName = "Secure Document Exchange Portal"
+	}
+	webAuthnOrigins := strings.Split(os.Getenv("WEBAUTHN_RP_ORIGINS"), ",")
+	if os.Getenv("WEBAUTHN_RP_ORIGINS") == "" {
+		webAuthnOrigins = []string{"http://localhost:8080"}
+	}
+	webAuthnService, err := auth.NewWebAuthnService(webAuthnRPID, webAuthnRPName, webAuthnOrigins)
+	if err != nil {
+		log.Fatal("Failed to configure WebAuthn:", err)
+	}
+
+	// OpenID Connect single sign-on providers, see OIDC_PROVIDERS
+	oidcProviders, err := auth.OIDCProviderConfigsFromEnv()
+	if err != nil {
+		log.Fatal("Failed to configure single sign-on:", err)
+	}
+	oidcService, err := auth.NewOIDCService(oidcProviders, appBaseURL)
+	if err != nil {
+		log.Fatal("Failed to configure single sign-on:", err)
+	}
+
+	// Auth handler instance, also renews the access token cookie of web
+	// clients before any route runs
+	authHandler := handlers.NewAuthHandler(queries, jwtService, cachedRepo, webAuthnService, oidcService, mailer, notifier, auditLog, appBaseURL, requireMFA)
+	app.Use(authHandler.RefreshCookies)
 
 	// Web routes (HTML responses)
 	app.Get("/", func(c *fiber.Ctx) error {
-		isAuth := auth.IsAuthenticated(c, jwtService)
-		userName := auth.GetUserName(c, jwtService, queries)
+		isAuth := auth.IsAuthenticated(c, jwtService, cachedRepo)
+		userName := auth.GetUserName(c, jwtService, cachedRepo, queries)
 		c.Set("Content-Type", "text/html")
 		return templates.Base(isAuth, userName, templates.DocumentListPage([]templates.Document{})).Render(c.Context(), c.Response().BodyWriter())
 	})
 
 	app.Get("/login", func(c *fiber.Ctx) error {
-		isAuth := auth.IsAuthenticated(c, jwtService)
-		userName := auth.GetUserName(c, jwtService, queries)
+		isAuth := auth.IsAuthenticated(c, jwtService, cachedRepo)
+		userName := auth.GetUserName(c, jwtService, cachedRepo, queries)
 		c.Set("Content-Type", "text/html")
-		return templates.Base(isAuth, userName, templates.LoginPage([]string{}, "")).Render(c.Context(), c.Response().BodyWriter())
+		return templates.Base(isAuth, userName, templates.LoginPage([]string{}, "", authHandler.SSOProviders())).Render(c.Context(), c.Response().BodyWriter())
+	})
+
+	// Single sign-on redirects to the identity provider and back
+	app.Get("/auth/oidc/:provider/login", authHandler.SSOLogin)
+	app.Get("/auth/oidc/:provider/callback", authHandler.SSOCallback)
+
+	// Email verification and password reset links
+	app.Get("/verify-email", authHandler.VerifyEmail)
+	app.Get("/reset-password", authHandler.ResetPasswordPage)
+	app.Get("/forgot-password", func(c *fiber.Ctx) error {
+		c.Set("Content-Type", "text/html")
+		return templates.Base(false, "", templates.ForgotPasswordPage(nil)).Render(c.Context(), c.Response().BodyWriter())
 	})
 
 	app.Get("/register", func(c *fiber.Ctx) error {
-		isAuth := auth.IsAuthenticated(c, jwtService)
-		userName := auth.GetUserName(c, jwtService, queries)
+		isAuth := auth.IsAuthenticated(c, jwtService, cachedRepo)
+		userName := auth.GetUserName(c, jwtService, cachedRepo, queries)
 		c.Set("Content-Type", "text/html")
 		return templates.Base(isAuth, userName, templates.RegisterPage([]string{})).Render(c.Context(), c.Response().BodyWriter())
 	})
 
 	app.Get("/documents", func(c *fiber.Ctx) error {
-		isAuth := auth.IsAuthenticated(c, jwtService)
-		userName := auth.GetUserName(c, jwtService, queries)
+		isAuth := auth.IsAuthenticated(c, jwtService, cachedRepo)
+		userName := auth.GetUserName(c, jwtService, cachedRepo, queries)
 		c.Set("Content-Type", "text/html")
 		return templates.Base(isAuth, userName, templates.DocumentListPage([]templates.Document{})).Render(c.Context(), c.Response().BodyWriter())
 	})
@@ -354,14 +365,27 @@ func main() {
 
 	api := app.Group("/api")
 
+	// Token refresh is registered before the auth group so clients renewing
+	// their short-lived access tokens are not held to the login rate limit
+	api.Post("/auth/refresh", authHandler.Refresh)
+
+	// Starting a WebAuthn ceremony only hands out a challenge, so it is not
+	// held to the login rate limit either; finishing one is
+	api.Post("/auth/webauthn/login/begin", authHandler.BeginPasskeyLogin)
+	api.Post("/auth/mfa/webauthn/begin", authHandler.BeginWebAuthnMFA)
+
 	// Auth routes (public) with strict rate limiting
 	authGroup := api.Group("/auth")
 	authGroup.Use(middleware.AuthRateLimiter()) // Apply auth rate limiter
-	authHandler = handlers.NewAuthHandler(queries, jwtService, cachedRepo)
 	authGroup.Post("/register", authHandler.Register)
 	authGroup.Post("/login", authHandler.Login)
-	authGroup.Post("/refresh", authHandler.Refresh)
+	authGroup.Post("/mfa/verify", authHandler.VerifyMFA)
+	authGroup.Post("/mfa/webauthn/finish", authHandler.FinishWebAuthnMFA)
+	authGroup.Post("/webauthn/login/finish", authHandler.FinishPasskeyLogin)
 	authGroup.Post("/logout", authHandler.Logout)
+	authGroup.Post("/email/resend", authHandler.ResendVerification)
+	authGroup.Post("/password/forgot", authHandler.ForgotPassword)
+	authGroup.Post("/password/reset", authHandler.ResetPassword)
 
 	app.Get("/logout", func(c *fiber.Ctx) error {
 		return authHandler.Logout(c)
@@ -369,35 +393,256 @@ func main() {
 
 
 
-	// Protected routes
-	protected := api.Group("", auth.AuthMiddleware(jwtService))
-	docHandler := handlers.NewDocumentHandler(queries, storage, cachedRepo)
-	documents := protected.Group("/documents")
+	// Public share access (GET and POST for password submission) with rate limiting.
+	// Registered before the protected group so recipients do not need an account.
+	shareHandler := handlers.NewShareHandler(queries, storage, cachedRepo, policy, jwtService, previewer, notifier, auditLog)
+	shareGroup := app.Group("/api/share")
+	sharePasswordLimiter := middleware.SharePasswordRateLimiter() // Only the password-checking entry point is rate limited
+	shareGroup.Get("/:token", sharePasswordLimiter, shareHandler.AccessShare)
+	shareGroup.Post("/:token", sharePasswordLimiter, shareHandler.AccessShare)
+	shareGroup.Get("/:token/files/:docId", shareHandler.DownloadFile)
+	shareGroup.Get("/:token/zip", shareHandler.DownloadZip)
+	shareGroup.Get("/:token/view/:docId", shareHandler.ViewFile)
+	shareGroup.Get("/:token/view/:docId/pages/:page", middleware.SharePageRateLimiter(), shareHandler.ViewPage)
+
+	// Public file request upload pages
+	fileRequestHandler := handlers.NewFileRequestHandler(queries, storage, cachedRepo, policy, quotas, notifier, auditLog)
+	requestGroup := app.Group("/api/request")
+	requestGroup.Get("/:token", fileRequestHandler.Page)
+	requestGroup.Post("/:token", middleware.FileRequestUploadRateLimiter(), fileRequestHandler.Upload)
+
+	// Protected routes. Each group lists the scopes API keys need for it;
+	// requests with a login session are not restricted. Requests refused
+	// with 403 are audited.
+	protected := api.Group("", auth.AuthMiddleware(jwtService, cachedRepo, cachedRepo, cachedRepo), handlers.AuditDenied(auditLog))
+	docHandler := handlers.NewDocumentHandler(queries, storage, cachedRepo, policy, quotas, auditLog)
+
+	// Sharing needs the shares scopes rather than access to the document or
+	// folder. Registered before those groups so their scope checks do not run.
+	shareScopes := auth.RequireScope(auth.MethodScopes{
+		fiber.MethodGet:    auth.ScopeSharesRead,
+		fiber.MethodPost:   auth.ScopeSharesCreate,
+		fiber.MethodDelete: auth.ScopeSharesRevoke,
+	})
+	protected.Post("/documents/:id/share", shareScopes, docHandler.CreateShare)
+	protected.Post("/folders/:id/share", shareScopes, shareHandler.CreateFolderShare)
+	protected.Post("/documents/:id/grants", shareScopes, docHandler.Grant)
+	protected.Get("/documents/:id/grants", shareScopes, docHandler.Grants)
+	protected.Delete("/documents/:id/grants/:grantId", shareScopes, docHandler.RevokeGrant)
+
+	documentScopes := auth.RequireScope(auth.MethodScopes{
+		fiber.MethodGet:    auth.ScopeDocumentsRead,
+		fiber.MethodPost:   auth.ScopeDocumentsWrite,
+		fiber.MethodPut:    auth.ScopeDocumentsWrite,
+		fiber.MethodDelete: auth.ScopeDocumentsWrite,
+	})
+	documents := protected.Group("/documents", documentScopes)
 	documents.Post("", docHandler.Upload)
 	documents.Get("", docHandler.List)
+	documents.Get("/shared", docHandler.SharedWithMe)
 	documents.Get("/:id/view", docHandler.View)
 	documents.Get("/:id/download", docHandler.Download)
-	documents.Post("/:id/share", docHandler.CreateShare)
 	documents.Delete("/:id", docHandler.Delete)
 	documents.Get("/:id", docHandler.Download)
+	documents.Put("/:id/folder", docHandler.MoveToFolder)
+	documents.Get("/:id/tags", docHandler.Tags)
+	documents.Put("/:id/tags", docHandler.SetTags)
+
+	trashHandler := handlers.NewTrashHandler(queries, cachedRepo, policy, trash, auditLog)
+	trashBin := protected.Group("/trash", documentScopes)
+	trashBin.Get("", trashHandler.List)
+	trashBin.Post("/:id/restore", trashHandler.Restore)
+	trashBin.Delete("/:id", trashHandler.Delete)
+
+	folderHandler := handlers.NewFolderHandler(queries, cachedRepo, policy, auditLog)
+	folders := protected.Group("/folders", documentScopes)
+	folders.Post("", folderHandler.Create)
+	folders.Get("", folderHandler.List)
+	folders.Get("/:id", folderHandler.Get)
+	folders.Delete("/:id", folderHandler.Delete)
+
+	shares := protected.Group("/shares", shareScopes)
+	shares.Post("", shareHandler.CreateBundle)
+	shares.Get("/:id/access-log", shareHandler.AccessLog)
+	shares.Delete("/:id", shareHandler.Revoke)
+
+	fileRequests := protected.Group("/file-requests", auth.RequireScope(auth.MethodScopes{
+		fiber.MethodGet:    auth.ScopeFileRequestsRead,
+		fiber.MethodPost:   auth.ScopeFileRequestsWrite,
+		fiber.MethodDelete: auth.ScopeFileRequestsWrite,
+	}))
+	fileRequests.Post("", fileRequestHandler.Create)
+	fileRequests.Get("", fileRequestHandler.List)
+	fileRequests.Get("/:id/uploads", fileRequestHandler.Uploads)
+	fileRequests.Delete("/:id", fileRequestHandler.Delete)
+
+	// Listing workspaces lets API keys find where to upload; managing them
+	// needs a signed-in user
+	workspaceHandler := handlers.NewWorkspaceHandler(queries, cachedRepo, policy, auditLog)
+	workspaces := protected.Group("/workspaces", auth.RequireScope(auth.MethodScopes{
+		fiber.MethodGet: auth.ScopeDocumentsRead,
+	}))
+	workspaces.Get("", workspaceHandler.List)
+	workspaces.Get("/:id/members", workspaceHandler.Members)
+	workspaces.Post("/:id/members", workspaceHandler.AddMember)
+	workspaces.Delete("/:id/members/:memberId", workspaceHandler.RemoveMember)
+	workspaces.Delete("/:id", workspaceHandler.Delete)
+
+	retentionHandler := handlers.NewRetentionHandler(queries, policy, retention, auditLog)
+	workspaces.Get("/:id/retention-policies", retentionHandler.List)
+	workspaces.Post("/:id/retention-policies", retentionHandler.Create)
+	workspaces.Put("/:id/retention-policies/:policyId", retentionHandler.Update)
+	workspaces.Delete("/:id/retention-policies/:policyId", retentionHandler.Delete)
+	workspaces.Get("/:id/retention-report", retentionHandler.Report)
+
+	orgHandler := handlers.NewOrganizationHandler(queries, cachedRepo, policy, quotas, auditLog)
+	orgs := protected.Group("/organizations", auth.RequireSession())
+	orgs.Post("", orgHandler.Create)
+	orgs.Get("", orgHandler.List)
+	orgs.Get("/:id", orgHandler.Get)
+	orgs.Get("/:id/storage", orgHandler.Storage)
+	orgs.Put("/:id/mfa", orgHandler.SetMFARequirement)
+	orgs.Post("/:id/members", orgHandler.AddMember)
+	orgs.Delete("/:id/members/:userId", orgHandler.RemoveMember)
+	orgs.Post("/:id/teams", orgHandler.CreateTeam)
+	orgs.Delete("/:id/teams/:teamId", orgHandler.DeleteTeam)
+	orgs.Post("/:id/teams/:teamId/members", orgHandler.AddTeamMember)
+	orgs.Delete("/:id/teams/:teamId/members/:userId", orgHandler.RemoveTeamMember)
+	orgs.Post("/:id/workspaces", workspaceHandler.Create)
+
+	// Account settings and API keys themselves need a signed-in user
+	accountHandler := handlers.NewAccountHandler(queries, cachedRepo, quotas, auditLog)
+	account := protected.Group("/account", auth.RequireSession())
+	account.Get("/storage", accountHandler.Storage)
+	account.Get("/allowed-networks", accountHandler.GetAllowedNetworks)
+	account.Put("/allowed-networks", accountHandler.UpdateAllowedNetworks)
+	account.Get("/sessions", accountHandler.Sessions)
+	account.Post("/sessions/revoke-others", accountHandler.RevokeOtherSessions)
+	account.Delete("/sessions/:id", accountHandler.RevokeSession)
+
+	privacyHandler := handlers.NewPrivacyHandler(queries, cachedRepo, storage, privacy, notifier, auditLog)
+	account.Post("/export", privacyHandler.RequestExport)
+	account.Get("/exports", privacyHandler.Exports)
+	account.Get("/exports/:id/download", privacyHandler.DownloadExport)
+	account.Get("/deletion", privacyHandler.Deletion)
+	account.Post("/deletion", privacyHandler.RequestDeletion)
+	account.Delete("/deletion", privacyHandler.CancelDeletion)
+
+	mfaHandler := handlers.NewMFAHandler(queries, cachedRepo, auditLog, requireMFA)
+	account.Get("/mfa", mfaHandler.Status)
+	account.Post("/mfa/totp/setup", mfaHandler.SetupTOTP)
+	account.Post("/mfa/totp/enable", mfaHandler.EnableTOTP)
+	account.Post("/mfa/totp/disable", mfaHandler.DisableTOTP)
+	account.Post("/mfa/recovery-codes", mfaHandler.RegenerateRecoveryCodes)
+
+	webAuthnHandler := handlers.NewWebAuthnHandler(queries, cachedRepo, webAuthnService, auditLog, requireMFA)
+	account.Get("/webauthn", webAuthnHandler.Credentials)
+	account.Post("/webauthn/register/begin", webAuthnHandler.BeginRegistration)
+	account.Post("/webauthn/register/finish", webAuthnHandler.FinishRegistration)
+	account.Put("/webauthn/:id", webAuthnHandler.RenameCredential)
+	account.Delete("/webauthn/:id", webAuthnHandler.DeleteCredential)
+
+	apiKeyHandler := handlers.NewAPIKeyHandler(queries, cachedRepo, auditLog)
+	account.Get("/api-keys", apiKeyHandler.List)
+	account.Post("/api-keys", apiKeyHandler.Create)
+	account.Delete("/api-keys/:id", apiKeyHandler.Revoke)
+
+	adminHandler := handlers.NewAdminHandler(queries, cachedRepo, jobs, quotas, auditLog)
+	admin := protected.Group("/admin", auth.RequireSession(), auth.RequirePermission(policy, auth.ActionUserManage))
+	admin.Get("/users", adminHandler.Users)
+	admin.Post("/users/:id/revoke-sessions", adminHandler.RevokeUserSessions)
+	admin.Post("/users/:id/deactivate", adminHandler.DeactivateUser)
+	admin.Post("/users/:id/activate", adminHandler.ActivateUser)
+	admin.Post("/users/:id/unlock", adminHandler.UnlockUser)
+	admin.Post("/users/:id/reset-mfa", adminHandler.ResetMFA)
+	admin.Put("/users/:id/legal-role", adminHandler.SetLegalRole)
+	admin.Get("/storage", adminHandler.Storage)
+	admin.Put("/users/:id/quota", adminHandler.SetUserQuota)
+	admin.Put("/organizations/:id/quota", adminHandler.SetOrganizationQuota)
+	admin.Get("/shares", adminHandler.Shares)
+	admin.Get("/security-events", adminHandler.SecurityEvents)
+	admin.Get("/audit-events/export", adminHandler.ExportAudit)
+	admin.Get("/jobs", adminHandler.Jobs)
+
+	// Legal holds are placed by the legal team, not by administrators
+	legalHoldHandler := handlers.NewLegalHoldHandler(queries, auditLog)
+	legalHolds := protected.Group("/legal-holds", auth.RequireSession(), auth.RequirePermission(policy, auth.ActionLegalHoldManage))
+	legalHolds.Get("", legalHoldHandler.List)
+	legalHolds.Post("", legalHoldHandler.Create)
+	legalHolds.Get("/:id", legalHoldHandler.Get)
+	legalHolds.Post("/:id/release", legalHoldHandler.Release)
 
 	// Web document routes
 	app.Get("/documents", func(c *fiber.Ctx) error {
-		isAuth := auth.IsAuthenticated(c, jwtService)
-		userName := auth.GetUserName(c, jwtService, queries)
+		isAuth := auth.IsAuthenticated(c, jwtService, cachedRepo)
+		userName := auth.GetUserName(c, jwtService, cachedRepo, queries)
 		c.Set("Content-Type", "text/html")
 		return templates.Base(isAuth, userName, templates.DocumentListPage([]templates.Document{})).Render(c.Context(), c.Response().BodyWriter())
 	})
 
 	app.Get("/documents/upload", func(c *fiber.Ctx) error {
-		isAuth := auth.IsAuthenticated(c, jwtService)
-		userName := auth.GetUserName(c, jwtService, queries)
+		isAuth := auth.IsAuthenticated(c, jwtService, cachedRepo)
+		userName := auth.GetUserName(c, jwtService, cachedRepo, queries)
 		c.Set("Content-Type", "text/html")
 		return templates.Base(isAuth, userName, templates.UploadForm()).Render(c.Context(), c.Response().BodyWriter())
 	})
 
 	app.Get("/documents/:id/share", docHandler.GetShareForm)
 
+	app.Get("/account/sessions", func(c *fiber.Ctx) error {
+		isAuth := auth.IsAuthenticated(c, jwtService, cachedRepo)
+		if !isAuth {
+			return c.Redirect("/login")
+		}
+		userName := auth.GetUserName(c, jwtService, cachedRepo, queries)
+		c.Set("Content-Type", "text/html")
+		return templates.Base(isAuth, userName, templates.SessionsPage()).Render(c.Context(), c.Response().BodyWriter())
+	})
+
+	app.Get("/account/api-keys", func(c *fiber.Ctx) error {
+		isAuth := auth.IsAuthenticated(c, jwtService, cachedRepo)
+		if !isAuth {
+			return c.Redirect("/login")
+		}
+		userName := auth.GetUserName(c, jwtService, cachedRepo, queries)
+		c.Set("Content-Type", "text/html")
+		return templates.Base(isAuth, userName, templates.APIKeysPage(auth.APIKeyScopes)).Render(c.Context(), c.Response().BodyWriter())
+	})
+
+	app.Get("/account/security", func(c *fiber.Ctx) error {
+		isAuth := auth.IsAuthenticated(c, jwtService, cachedRepo)
+		if !isAuth {
+			return c.Redirect("/login")
+		}
+		userName := auth.GetUserName(c, jwtService, cachedRepo, queries)
+		c.Set("Content-Type", "text/html")
+		return templates.Base(isAuth, userName, templates.SecurityPage()).Render(c.Context(), c.Response().BodyWriter())
+	})
+
+	// The admin console is only shown to administrators; others get the
+	// same answer as for any unknown page
+	app.Get("/admin", func(c *fiber.Ctx) error {
+		isAuth := auth.IsAuthenticated(c, jwtService, cachedRepo)
+		if !isAuth {
+			return c.Redirect("/login")
+		}
+		claims, err := jwtService.ValidateToken(auth.GetToken(c))
+		if err != nil {
+			return c.Redirect("/login")
+		}
+		if err := policy.Authorize(c.Context(), auth.Subject{UserID: claims.UserID}, auth.ActionUserManage, auth.Resource{}); err != nil {
+			return c.SendStatus(fiber.StatusNotFound)
+		}
+		userName := auth.GetUserName(c, jwtService, cachedRepo, queries)
+		c.Set("Content-Type", "text/html")
+		return templates.Base(isAuth, userName, templates.AdminPage()).Render(c.Context(), c.Response().BodyWriter())
+	})
+
+	app.Get("/documents/request-files", func(c *fiber.Ctx) error {
+		c.Set("Content-Type", "text/html")
+		return templates.FileRequestForm().Render(c.Context(), c.Response().BodyWriter())
+	})
+
 	// Close modal endpoint
 	app.Get("/api/close-modal", func(c *fiber.Ctx) error {
 		c.Set("Content-Type", "text/html")
@@ -407,24 +652,51 @@ func main() {
 	_ = authGroup
 	_ = protected
 
-	// Public share access (GET and POST for password submission) with rate limiting
-	shareGroup := app.Group("/api/share")
-	shareGroup.Use(middleware.SharePasswordRateLimiter()) // Apply share password rate limiter
-	shareGroup.Get("/:token", func(c *fiber.Ctx) error {
-		return AccessShare(c, queries, storage, cachedRepo)
-	})
-	shareGroup.Post("/:token", func(c *fiber.Ctx) error {
-		return AccessShare(c, queries, storage, cachedRepo)
-	})
 
-	// Health check
+	// Health check. Audit events not reaching the database make the
+	// instance unhealthy, so monitoring raises the alarm.
 	app.Get("/health", func(c *fiber.Ctx) error {
+		audit := auditLog.Health()
+		if audit.Degraded() {
+			return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+				"status": "degraded",
+				"audit":  audit,
+			})
+		}
 		return c.JSON(fiber.Map{
 			"status": "ok",
+			"audit":  audit,
 		})
 	})
 
+	// Public keys for services that verify access tokens themselves
+	app.Get("/.well-known/jwks.json", func(c *fiber.Ctx) error {
+		c.Set("Cache-Control", "public, max-age=300")
+		return c.JSON(jwtService.JWKS())
+	})
+
 
-	log.Fatal(app.Listen(":8080"))
+	listenErr := make(chan error, 1)
+	go func() {
+		listenErr <- app.Listen(":8080")
+	}()
+
+	// On SIGINT or SIGTERM, requests in flight are finished first, then the
+	// background jobs stop and the audit log appends what is still queued
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	select {
+	case sig := <-stop:
+		log.Printf("Received %s, shutting down", sig)
+	case err := <-listenErr:
+		log.Printf("Server stopped: %v", err)
+	}
+
+	if err := app.ShutdownWithTimeout(30 * time.Second); err != nil {
+		log.Printf("Failed to shut down the server: %v", err)
+	}
+	worker.Shutdown()
+	scheduler.Shutdown()
+	auditLog.Close()
 }
 
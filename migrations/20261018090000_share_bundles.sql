@@ -0,0 +1,68 @@
+-- +goose Up
+-- Folders table
+CREATE TABLE folders (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    parent_id UUID REFERENCES folders(id) ON DELETE CASCADE,
+    name VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+ALTER TABLE documents ADD COLUMN folder_id UUID REFERENCES folders(id) ON DELETE SET NULL;
+
+-- Share documents table (bundle membership and per-file download counts)
+CREATE TABLE share_documents (
+    share_id UUID NOT NULL REFERENCES shares(id) ON DELETE CASCADE,
+    document_id UUID NOT NULL REFERENCES documents(id) ON DELETE CASCADE,
+    download_count INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (share_id, document_id)
+);
+
+-- Existing single-document shares become one-element bundles
+INSERT INTO share_documents (share_id, document_id)
+SELECT id, document_id FROM shares;
+
+DROP INDEX IF EXISTS idx_shares_document_id;
+ALTER TABLE shares DROP COLUMN document_id;
+ALTER TABLE shares ADD COLUMN folder_id UUID REFERENCES folders(id) ON DELETE CASCADE;
+ALTER TABLE shares ADD COLUMN name VARCHAR(255);
+
+-- Share access log table
+CREATE TABLE share_access_logs (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    share_id UUID NOT NULL REFERENCES shares(id) ON DELETE CASCADE,
+    document_id UUID REFERENCES documents(id) ON DELETE SET NULL,
+    action VARCHAR(32) NOT NULL,
+    ip_address INET,
+    user_agent TEXT,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_documents_folder_id ON documents(folder_id);
+CREATE INDEX idx_folders_user_id ON folders(user_id);
+CREATE INDEX idx_folders_parent_id ON folders(parent_id);
+CREATE INDEX idx_share_documents_document_id ON share_documents(document_id);
+CREATE INDEX idx_share_access_logs_share_id ON share_access_logs(share_id);
+CREATE INDEX idx_shares_folder_id ON shares(folder_id);
+
+-- +goose Down
+-- Folder shares and multi-document bundles cannot be represented by the old
+-- schema and are dropped.
+DELETE FROM shares
+WHERE folder_id IS NOT NULL
+   OR id NOT IN (SELECT share_id FROM share_documents GROUP BY share_id HAVING COUNT(*) = 1);
+
+ALTER TABLE shares ADD COLUMN document_id UUID REFERENCES documents(id) ON DELETE CASCADE;
+UPDATE shares s SET document_id = sd.document_id
+FROM share_documents sd WHERE sd.share_id = s.id;
+ALTER TABLE shares ALTER COLUMN document_id SET NOT NULL;
+CREATE INDEX idx_shares_document_id ON shares(document_id);
+
+ALTER TABLE shares DROP COLUMN name;
+ALTER TABLE shares DROP COLUMN folder_id;
+
+DROP TABLE IF EXISTS share_access_logs;
+DROP TABLE IF EXISTS share_documents;
+ALTER TABLE documents DROP COLUMN folder_id;
+DROP TABLE IF EXISTS folders;
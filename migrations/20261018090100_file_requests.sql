@@ -0,0 +1,35 @@
+-- +goose Up
+-- File requests table (inbound upload-only links)
+CREATE TABLE file_requests (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    request_token VARCHAR(255) UNIQUE NOT NULL,
+    title VARCHAR(255) NOT NULL,
+    message TEXT,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    max_files INTEGER NOT NULL DEFAULT -1,
+    max_file_size BIGINT NOT NULL,
+    allowed_types TEXT,
+    upload_count INTEGER NOT NULL DEFAULT 0,
+    folder_id UUID REFERENCES folders(id) ON DELETE SET NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- File request uploads table (who sent which document through a request)
+CREATE TABLE file_request_uploads (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    file_request_id UUID NOT NULL REFERENCES file_requests(id) ON DELETE CASCADE,
+    document_id UUID NOT NULL REFERENCES documents(id) ON DELETE CASCADE,
+    uploader_name VARCHAR(255),
+    uploader_email VARCHAR(255),
+    ip_address INET,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_file_requests_user_id ON file_requests(user_id);
+CREATE INDEX idx_file_requests_request_token ON file_requests(request_token);
+CREATE INDEX idx_file_request_uploads_file_request_id ON file_request_uploads(file_request_id);
+
+-- +goose Down
+DROP TABLE IF EXISTS file_request_uploads;
+DROP TABLE IF EXISTS file_requests;
@@ -0,0 +1,5 @@
+-- +goose Up
+ALTER TABLE shares ADD COLUMN view_only BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- +goose Down
+ALTER TABLE shares DROP COLUMN view_only;
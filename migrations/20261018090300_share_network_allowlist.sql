@@ -0,0 +1,7 @@
+-- +goose Up
+ALTER TABLE users ADD COLUMN default_allowed_cidrs CIDR[] NOT NULL DEFAULT '{}';
+ALTER TABLE shares ADD COLUMN allowed_cidrs CIDR[] NOT NULL DEFAULT '{}';
+
+-- +goose Down
+ALTER TABLE shares DROP COLUMN allowed_cidrs;
+ALTER TABLE users DROP COLUMN default_allowed_cidrs;
@@ -0,0 +1,15 @@
+-- +goose Up
+ALTER TABLE shares ADD COLUMN notify_on_access VARCHAR(16) NOT NULL DEFAULT 'none';
+ALTER TABLE shares ADD COLUMN notify_on_limit BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE shares ADD COLUMN notify_password_failures INTEGER;
+ALTER TABLE shares ADD COLUMN notify_expiring_hours INTEGER;
+ALTER TABLE shares ADD COLUMN expiry_notified_at TIMESTAMP WITH TIME ZONE;
+CREATE INDEX idx_share_access_logs_share_id_action ON share_access_logs(share_id, action, created_at);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_share_access_logs_share_id_action;
+ALTER TABLE shares DROP COLUMN expiry_notified_at;
+ALTER TABLE shares DROP COLUMN notify_expiring_hours;
+ALTER TABLE shares DROP COLUMN notify_password_failures;
+ALTER TABLE shares DROP COLUMN notify_on_limit;
+ALTER TABLE shares DROP COLUMN notify_on_access;
@@ -0,0 +1,7 @@
+-- +goose Up
+ALTER TABLE users ADD COLUMN is_admin BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE sessions ADD COLUMN last_seen_at TIMESTAMP WITH TIME ZONE;
+
+-- +goose Down
+ALTER TABLE sessions DROP COLUMN last_seen_at;
+ALTER TABLE users DROP COLUMN is_admin;
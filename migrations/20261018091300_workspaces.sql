@@ -0,0 +1,86 @@
+-- +goose Up
+CREATE TABLE organizations (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    name VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE organization_members (
+    organization_id UUID NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    role VARCHAR(16) NOT NULL DEFAULT 'member',
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (organization_id, user_id)
+);
+
+CREATE TABLE teams (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    organization_id UUID NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    name VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (organization_id, name)
+);
+
+CREATE TABLE team_members (
+    team_id UUID NOT NULL REFERENCES teams(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (team_id, user_id)
+);
+
+CREATE TABLE workspaces (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    organization_id UUID REFERENCES organizations(id) ON DELETE CASCADE,
+    personal_user_id UUID UNIQUE REFERENCES users(id) ON DELETE CASCADE,
+    name VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    CHECK ((organization_id IS NULL) <> (personal_user_id IS NULL))
+);
+
+CREATE TABLE workspace_members (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    workspace_id UUID NOT NULL REFERENCES workspaces(id) ON DELETE CASCADE,
+    user_id UUID REFERENCES users(id) ON DELETE CASCADE,
+    team_id UUID REFERENCES teams(id) ON DELETE CASCADE,
+    role VARCHAR(16) NOT NULL DEFAULT 'member',
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    CHECK ((user_id IS NULL) <> (team_id IS NULL)),
+    UNIQUE (workspace_id, user_id),
+    UNIQUE (workspace_id, team_id)
+);
+
+-- Every user gets a personal workspace that takes over their documents
+INSERT INTO workspaces (personal_user_id, name) SELECT id, 'Personal' FROM users;
+INSERT INTO workspace_members (workspace_id, user_id, role)
+SELECT id, personal_user_id, 'owner' FROM workspaces;
+
+ALTER TABLE folders ADD COLUMN workspace_id UUID REFERENCES workspaces(id) ON DELETE CASCADE;
+ALTER TABLE documents ADD COLUMN workspace_id UUID REFERENCES workspaces(id) ON DELETE CASCADE;
+ALTER TABLE file_requests ADD COLUMN workspace_id UUID REFERENCES workspaces(id) ON DELETE CASCADE;
+
+UPDATE folders SET workspace_id = w.id FROM workspaces w WHERE w.personal_user_id = folders.user_id;
+UPDATE documents SET workspace_id = w.id FROM workspaces w WHERE w.personal_user_id = documents.user_id;
+UPDATE file_requests SET workspace_id = w.id FROM workspaces w WHERE w.personal_user_id = file_requests.user_id;
+
+ALTER TABLE folders ALTER COLUMN workspace_id SET NOT NULL;
+ALTER TABLE documents ALTER COLUMN workspace_id SET NOT NULL;
+ALTER TABLE file_requests ALTER COLUMN workspace_id SET NOT NULL;
+
+CREATE INDEX idx_organization_members_user_id ON organization_members(user_id);
+CREATE INDEX idx_team_members_user_id ON team_members(user_id);
+CREATE INDEX idx_workspaces_organization_id ON workspaces(organization_id);
+CREATE INDEX idx_workspace_members_user_id ON workspace_members(user_id);
+CREATE INDEX idx_workspace_members_team_id ON workspace_members(team_id);
+CREATE INDEX idx_documents_workspace_id ON documents(workspace_id);
+CREATE INDEX idx_folders_workspace_id ON folders(workspace_id);
+
+-- +goose Down
+ALTER TABLE file_requests DROP COLUMN workspace_id;
+ALTER TABLE documents DROP COLUMN workspace_id;
+ALTER TABLE folders DROP COLUMN workspace_id;
+DROP TABLE workspace_members;
+DROP TABLE workspaces;
+DROP TABLE team_members;
+DROP TABLE teams;
+DROP TABLE organization_members;
+DROP TABLE organizations;
@@ -0,0 +1,12 @@
+-- +goose Up
+-- Workspace members were either owners or members with full access to the
+-- documents; members become editors
+UPDATE workspace_members SET role = 'editor' WHERE role = 'member';
+ALTER TABLE workspace_members ALTER COLUMN role SET DEFAULT 'editor';
+ALTER TABLE workspace_members ADD CONSTRAINT workspace_members_role_check
+    CHECK (role IN ('owner', 'editor', 'viewer', 'auditor'));
+
+-- +goose Down
+ALTER TABLE workspace_members DROP CONSTRAINT workspace_members_role_check;
+UPDATE workspace_members SET role = 'member' WHERE role <> 'owner';
+ALTER TABLE workspace_members ALTER COLUMN role SET DEFAULT 'member';
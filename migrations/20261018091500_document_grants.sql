@@ -0,0 +1,19 @@
+-- +goose Up
+CREATE TABLE document_grants (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    document_id UUID NOT NULL REFERENCES documents(id) ON DELETE CASCADE,
+    user_id UUID REFERENCES users(id) ON DELETE CASCADE,
+    team_id UUID REFERENCES teams(id) ON DELETE CASCADE,
+    permission VARCHAR(16) NOT NULL CHECK (permission IN ('read', 'edit')),
+    granted_by UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    CHECK ((user_id IS NULL) <> (team_id IS NULL)),
+    UNIQUE (document_id, user_id),
+    UNIQUE (document_id, team_id)
+);
+
+CREATE INDEX idx_document_grants_user_id ON document_grants(user_id);
+CREATE INDEX idx_document_grants_team_id ON document_grants(team_id);
+
+-- +goose Down
+DROP TABLE document_grants;
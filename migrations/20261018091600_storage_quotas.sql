@@ -0,0 +1,30 @@
+-- +goose Up
+CREATE TABLE storage_usage (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    user_id UUID UNIQUE REFERENCES users(id) ON DELETE CASCADE,
+    organization_id UUID UNIQUE REFERENCES organizations(id) ON DELETE CASCADE,
+    plan VARCHAR(32) NOT NULL,
+    quota_bytes BIGINT CHECK (quota_bytes >= 0),
+    quota_documents INTEGER CHECK (quota_documents >= 0),
+    used_bytes BIGINT NOT NULL DEFAULT 0 CHECK (used_bytes >= 0),
+    document_count INTEGER NOT NULL DEFAULT 0 CHECK (document_count >= 0),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    CHECK ((user_id IS NULL) <> (organization_id IS NULL))
+);
+
+-- Existing documents count against their uploader and, in organization
+-- workspaces, the organization
+INSERT INTO storage_usage (user_id, plan, used_bytes, document_count)
+SELECT user_id, 'free', SUM(file_size), COUNT(*)
+FROM documents
+GROUP BY user_id;
+
+INSERT INTO storage_usage (organization_id, plan, used_bytes, document_count)
+SELECT w.organization_id, 'team', SUM(d.file_size), COUNT(*)
+FROM documents d
+JOIN workspaces w ON w.id = d.workspace_id
+WHERE w.organization_id IS NOT NULL
+GROUP BY w.organization_id;
+
+-- +goose Down
+DROP TABLE storage_usage;
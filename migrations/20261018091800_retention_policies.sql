@@ -0,0 +1,39 @@
+-- +goose Up
+CREATE TABLE document_tags (
+    document_id UUID NOT NULL REFERENCES documents(id) ON DELETE CASCADE,
+    tag VARCHAR(64) NOT NULL,
+    PRIMARY KEY (document_id, tag)
+);
+
+CREATE INDEX idx_document_tags_tag ON document_tags(tag);
+
+CREATE TABLE retention_policies (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    workspace_id UUID NOT NULL REFERENCES workspaces(id) ON DELETE CASCADE,
+    folder_id UUID REFERENCES folders(id) ON DELETE CASCADE,
+    tag VARCHAR(64),
+    retain_months INTEGER NOT NULL DEFAULT 0 CHECK (retain_months >= 0),
+    retain_days INTEGER NOT NULL DEFAULT 0 CHECK (retain_days >= 0),
+    warn_days INTEGER NOT NULL DEFAULT 14 CHECK (warn_days >= 0),
+    created_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    CHECK (retain_months > 0 OR retain_days > 0),
+    CHECK (folder_id IS NULL OR tag IS NULL)
+);
+
+-- One policy per workspace, folder or tag
+CREATE UNIQUE INDEX idx_retention_policies_scope
+ON retention_policies(workspace_id, COALESCE(folder_id::text, ''), COALESCE(tag, ''));
+
+CREATE TABLE retention_notices (
+    document_id UUID PRIMARY KEY REFERENCES documents(id) ON DELETE CASCADE,
+    due_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    delete_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    notified_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- +goose Down
+DROP TABLE retention_notices;
+DROP TABLE retention_policies;
+DROP TABLE document_tags;
@@ -0,0 +1,97 @@
+-- +goose Up
+ALTER TABLE users ADD COLUMN is_legal BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE TABLE legal_holds (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    resource_type VARCHAR(16) NOT NULL CHECK (resource_type IN ('document', 'folder', 'user')),
+    resource_id UUID NOT NULL,
+    reason TEXT NOT NULL,
+    custodian VARCHAR(255) NOT NULL,
+    placed_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    placed_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    released_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    released_at TIMESTAMP WITH TIME ZONE,
+    release_reason TEXT
+);
+
+CREATE INDEX idx_legal_holds_active ON legal_holds(resource_type, resource_id) WHERE released_at IS NULL;
+
+-- A document is held by a hold on itself, on its uploader, or on its
+-- folder or any folder above it
+-- +goose StatementBegin
+CREATE FUNCTION document_held(doc UUID) RETURNS BOOLEAN AS $$
+    WITH RECURSIVE folder_path AS (
+        SELECT f.id, f.parent_id FROM folders f JOIN documents d ON d.folder_id = f.id WHERE d.id = doc
+        UNION
+        SELECT f.id, f.parent_id FROM folders f JOIN folder_path p ON f.id = p.parent_id
+    )
+    SELECT EXISTS (
+        SELECT 1 FROM legal_holds h
+        WHERE h.released_at IS NULL AND (
+            (h.resource_type = 'document' AND h.resource_id = doc)
+            OR (h.resource_type = 'user' AND h.resource_id = (SELECT user_id FROM documents WHERE id = doc))
+            OR (h.resource_type = 'folder' AND h.resource_id IN (SELECT id FROM folder_path))
+        )
+    );
+$$ LANGUAGE sql STABLE;
+-- +goose StatementEnd
+
+-- A folder is held by a hold on itself, on a folder above it, or on its
+-- creator
+-- +goose StatementBegin
+CREATE FUNCTION folder_held(folder UUID) RETURNS BOOLEAN AS $$
+    WITH RECURSIVE folder_path AS (
+        SELECT id, parent_id, user_id FROM folders WHERE id = folder
+        UNION
+        SELECT f.id, f.parent_id, f.user_id FROM folders f JOIN folder_path p ON f.id = p.parent_id
+    )
+    SELECT EXISTS (
+        SELECT 1 FROM legal_holds h
+        WHERE h.released_at IS NULL AND (
+            (h.resource_type = 'folder' AND h.resource_id IN (SELECT id FROM folder_path))
+            OR (h.resource_type = 'user' AND h.resource_id = (SELECT user_id FROM folders WHERE id = folder))
+        )
+    );
+$$ LANGUAGE sql STABLE;
+-- +goose StatementEnd
+
+-- Whatever the application does, held documents, folders and users cannot
+-- be deleted, including through cascades such as from deleting an account
+-- +goose StatementBegin
+CREATE FUNCTION legal_hold_no_delete() RETURNS trigger AS $$
+BEGIN
+    IF (TG_TABLE_NAME = 'documents' AND document_held(OLD.id))
+        OR (TG_TABLE_NAME = 'folders' AND folder_held(OLD.id))
+        OR (TG_TABLE_NAME = 'users' AND EXISTS (
+            SELECT 1 FROM legal_holds
+            WHERE resource_type = 'user' AND resource_id = OLD.id AND released_at IS NULL
+        ))
+    THEN
+        RAISE EXCEPTION '% % is under legal hold', TG_TABLE_NAME, OLD.id;
+    END IF;
+    RETURN OLD;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+CREATE TRIGGER documents_legal_hold
+BEFORE DELETE ON documents
+FOR EACH ROW EXECUTE FUNCTION legal_hold_no_delete();
+
+CREATE TRIGGER folders_legal_hold
+BEFORE DELETE ON folders
+FOR EACH ROW EXECUTE FUNCTION legal_hold_no_delete();
+
+CREATE TRIGGER users_legal_hold
+BEFORE DELETE ON users
+FOR EACH ROW EXECUTE FUNCTION legal_hold_no_delete();
+
+-- +goose Down
+DROP TRIGGER users_legal_hold ON users;
+DROP TRIGGER folders_legal_hold ON folders;
+DROP TRIGGER documents_legal_hold ON documents;
+DROP FUNCTION legal_hold_no_delete();
+DROP FUNCTION folder_held(UUID);
+DROP FUNCTION document_held(UUID);
+DROP TABLE legal_holds;
+ALTER TABLE users DROP COLUMN is_legal;
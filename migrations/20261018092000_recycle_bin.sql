@@ -0,0 +1,10 @@
+-- +goose Up
+ALTER TABLE documents ADD COLUMN deleted_at TIMESTAMP WITH TIME ZONE;
+ALTER TABLE documents ADD COLUMN deleted_by UUID REFERENCES users(id) ON DELETE SET NULL;
+
+CREATE INDEX idx_documents_deleted_at ON documents(deleted_at) WHERE deleted_at IS NOT NULL;
+
+-- +goose Down
+DROP INDEX idx_documents_deleted_at;
+ALTER TABLE documents DROP COLUMN deleted_by;
+ALTER TABLE documents DROP COLUMN deleted_at;
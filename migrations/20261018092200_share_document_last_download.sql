@@ -0,0 +1,5 @@
+-- +goose Up
+ALTER TABLE share_documents ADD COLUMN last_download_at TIMESTAMP WITH TIME ZONE;
+
+-- +goose Down
+ALTER TABLE share_documents DROP COLUMN last_download_at;
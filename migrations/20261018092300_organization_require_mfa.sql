@@ -0,0 +1,5 @@
+-- +goose Up
+ALTER TABLE organizations ADD COLUMN require_mfa BOOLEAN NOT NULL DEFAULT false;
+
+-- +goose Down
+ALTER TABLE organizations DROP COLUMN require_mfa;
@@ -0,0 +1,11 @@
+-- +goose Up
+ALTER TABLE documents DROP CONSTRAINT documents_user_id_fkey,
+    ADD CONSTRAINT documents_user_id_fkey FOREIGN KEY (user_id) REFERENCES users(id);
+ALTER TABLE folders DROP CONSTRAINT folders_user_id_fkey,
+    ADD CONSTRAINT folders_user_id_fkey FOREIGN KEY (user_id) REFERENCES users(id);
+
+-- +goose Down
+ALTER TABLE documents DROP CONSTRAINT documents_user_id_fkey,
+    ADD CONSTRAINT documents_user_id_fkey FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE;
+ALTER TABLE folders DROP CONSTRAINT folders_user_id_fkey,
+    ADD CONSTRAINT folders_user_id_fkey FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE;
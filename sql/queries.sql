@@ -16,48 +16,275 @@ SET full_name = $2, updated_at = CURRENT_TIMESTAMP
 WHERE id = $1
 RETURNING *;
 
+-- name: UpdateUserDefaultAllowedCIDRs :one
+UPDATE users
+SET default_allowed_cidrs = $2, updated_at = CURRENT_TIMESTAMP
+WHERE id = $1
+RETURNING *;
+
+-- name: MarkUserEmailVerified :one
+UPDATE users
+SET email_verified_at = COALESCE(email_verified_at, CURRENT_TIMESTAMP), updated_at = CURRENT_TIMESTAMP
+WHERE id = $1
+RETURNING *;
+
+-- name: UpdateUserPassword :one
+UPDATE users
+SET password_hash = $2, updated_at = CURRENT_TIMESTAMP
+WHERE id = $1
+RETURNING *;
+
+-- name: SetUserActive :one
+UPDATE users
+SET is_active = $2, failed_login_count = 0, last_failed_login_at = NULL, locked_until = NULL, updated_at = CURRENT_TIMESTAMP
+WHERE id = $1
+RETURNING *;
+
+-- name: SetUserLegal :one
+UPDATE users SET is_legal = $2, updated_at = CURRENT_TIMESTAMP
+WHERE id = $1
+RETURNING *;
+
+-- name: RecordFailedLogin :one
+UPDATE users
+SET failed_login_count = CASE
+        WHEN last_failed_login_at IS NULL OR last_failed_login_at < $2 THEN 1
+        ELSE failed_login_count + 1
+    END,
+    last_failed_login_at = CURRENT_TIMESTAMP
+WHERE id = $1
+RETURNING failed_login_count;
+
+-- ClaimLoginAttempt lets one password or MFA attempt through for an account
+-- that is not locked, once delay_seconds have passed since the last attempt
+-- or failure. The failure count the delay was derived from must still be
+-- current, so parallel requests cannot all claim the same slot.
+-- name: ClaimLoginAttempt :one
+UPDATE users
+SET last_login_attempt_at = CURRENT_TIMESTAMP
+WHERE id = $1
+  AND failed_login_count = $2
+  AND (locked_until IS NULL OR locked_until < CURRENT_TIMESTAMP)
+  AND COALESCE(GREATEST(last_login_attempt_at, last_failed_login_at), '-infinity')
+      <= CURRENT_TIMESTAMP - make_interval(secs => $3::float8)
+RETURNING id;
+
+-- name: LockUser :execrows
+UPDATE users
+SET locked_until = $2
+WHERE id = $1 AND (locked_until IS NULL OR locked_until < CURRENT_TIMESTAMP);
+
+-- name: ResetFailedLogins :exec
+UPDATE users
+SET failed_login_count = 0, last_failed_login_at = NULL, locked_until = NULL
+WHERE id = $1 AND (failed_login_count > 0 OR locked_until IS NOT NULL);
+
+-- name: SetUserTOTPSecret :one
+UPDATE users
+SET totp_secret = $2, totp_enabled = FALSE, totp_last_step = 0, updated_at = CURRENT_TIMESTAMP
+WHERE id = $1
+RETURNING *;
+
+-- name: EnableUserTOTP :one
+UPDATE users
+SET totp_enabled = TRUE, updated_at = CURRENT_TIMESTAMP
+WHERE id = $1 AND totp_secret IS NOT NULL
+RETURNING *;
+
+-- name: DisableUserTOTP :one
+UPDATE users
+SET totp_secret = NULL, totp_enabled = FALSE, totp_last_step = 0, updated_at = CURRENT_TIMESTAMP
+WHERE id = $1
+RETURNING *;
+
+-- name: UseUserTOTPStep :execrows
+UPDATE users
+SET totp_last_step = $2
+WHERE id = $1 AND totp_last_step < $2;
+
 -- name: DeleteUser :exec
 DELETE FROM users WHERE id = $1;
 
 -- Documents
 -- name: CreateDocument :one
-INSERT INTO documents (user_id, filename, file_path, encrypted_key, file_size, mime_type, checksum)
-VALUES ($1, $2, $3, $4, $5, $6, $7)
+INSERT INTO documents (user_id, filename, file_path, encrypted_key, file_size, mime_type, checksum, folder_id, workspace_id)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
 RETURNING *;
 
+-- Documents in the trash are left out of every query but the trash's own
 -- name: GetDocumentByID :one
-SELECT * FROM documents WHERE id = $1;
+SELECT * FROM documents WHERE id = $1 AND deleted_at IS NULL;
 
--- name: ListDocumentsByUser :many
-SELECT * FROM documents WHERE user_id = $1 ORDER BY created_at DESC;
+-- name: ListDocumentsByWorkspace :many
+SELECT * FROM documents WHERE workspace_id = $1 AND deleted_at IS NULL ORDER BY created_at DESC;
 
--- name: DeleteDocument :exec
-DELETE FROM documents WHERE id = $1 AND user_id = $2;
+-- Counts the documents in the trash as well, which still take up storage
+-- name: CountWorkspaceDocuments :one
+SELECT COUNT(*) FROM documents WHERE workspace_id = $1;
+
+-- name: DeleteDocument :one
+DELETE FROM documents WHERE id = $1 AND workspace_id = $2
+RETURNING *;
 
 -- Shares
 -- name: CreateShare :one
-INSERT INTO shares (document_id, share_token, expires_at, max_access, password_hash, created_by)
-VALUES ($1, $2, $3, $4, $5, $6)
+INSERT INTO shares (
+    share_token, expires_at, max_access, password_hash, created_by, folder_id, name, view_only, allowed_cidrs,
+    notify_on_access, notify_on_limit, notify_password_failures, notify_expiring_hours
+)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
 RETURNING *;
 
+-- name: AddShareDocument :exec
+INSERT INTO share_documents (share_id, document_id)
+VALUES ($1, $2)
+ON CONFLICT DO NOTHING;
+
 -- name: GetShareByToken :one
-SELECT s.*, d.filename, d.mime_type, d.file_size, d.file_path
-FROM shares s
-JOIN documents d ON s.document_id = d.id
-WHERE s.share_token = $1;
+SELECT * FROM shares WHERE share_token = $1;
+
+-- name: GetShareByID :one
+SELECT * FROM shares WHERE id = $1;
+
+-- name: ListShareDocuments :many
+SELECT d.*, sd.download_count, sd.last_download_at
+FROM share_documents sd
+JOIN documents d ON d.id = sd.document_id
+WHERE sd.share_id = $1 AND d.deleted_at IS NULL
+ORDER BY d.filename;
+
+-- name: ListFolderShareDocuments :many
+WITH RECURSIVE tree AS (
+    SELECT id FROM folders WHERE id = $1
+    UNION ALL
+    SELECT f.id FROM folders f JOIN tree t ON f.parent_id = t.id
+)
+SELECT d.*, COALESCE(sd.download_count, 0)::int AS download_count, sd.last_download_at
+FROM documents d
+LEFT JOIN share_documents sd ON sd.document_id = d.id AND sd.share_id = $2
+WHERE d.folder_id IN (SELECT id FROM tree) AND d.deleted_at IS NULL
+ORDER BY d.filename;
 
--- name: UpdateShareAccess :exec
+-- name: UpdateShareAccess :one
 UPDATE shares
 SET access_count = access_count + 1
-WHERE id = $1 AND (max_access = -1 OR access_count < max_access);
+WHERE id = $1 AND (max_access = -1 OR access_count < max_access)
+RETURNING access_count;
+
+-- name: ListSharesExpiringSoon :many
+SELECT * FROM shares
+WHERE notify_expiring_hours IS NOT NULL
+  AND expiry_notified_at IS NULL
+  AND expires_at > CURRENT_TIMESTAMP
+  AND expires_at <= CURRENT_TIMESTAMP + make_interval(hours => notify_expiring_hours);
+
+-- name: MarkShareExpiryNotified :execrows
+UPDATE shares
+SET expiry_notified_at = CURRENT_TIMESTAMP
+WHERE id = $1 AND expiry_notified_at IS NULL;
+
+-- name: RecordShareDocumentDownload :execrows
+INSERT INTO share_documents (share_id, document_id, download_count, last_download_at)
+VALUES ($1, $2, 1, CURRENT_TIMESTAMP)
+ON CONFLICT (share_id, document_id) DO UPDATE
+SET download_count = share_documents.download_count + 1,
+    last_download_at = CURRENT_TIMESTAMP
+WHERE $3::int = -1 OR share_documents.download_count < $3::int;
+
+-- name: DeleteShare :exec
+DELETE FROM shares WHERE id = $1 AND created_by = $2;
 
 -- name: DeleteExpiredShares :exec
 DELETE FROM shares WHERE expires_at < CURRENT_TIMESTAMP;
 
+-- name: CreateShareAccessLog :exec
+INSERT INTO share_access_logs (share_id, document_id, action, ip_address, user_agent)
+VALUES ($1, $2, $3, $4, $5);
+
+-- name: CountRecentShareAccessLogs :one
+SELECT COUNT(*) FROM share_access_logs
+WHERE share_id = $1 AND action = $2 AND created_at > $3;
+
+-- name: ListShareAccessLogs :many
+SELECT * FROM share_access_logs
+WHERE share_id = $1
+ORDER BY created_at DESC
+LIMIT $2;
+
+-- Folders
+-- name: CreateFolder :one
+INSERT INTO folders (user_id, parent_id, name, workspace_id)
+VALUES ($1, $2, $3, $4)
+RETURNING *;
+
+-- name: GetFolderByID :one
+SELECT * FROM folders WHERE id = $1;
+
+-- name: ListFoldersByWorkspace :many
+SELECT * FROM folders WHERE workspace_id = $1 ORDER BY name;
+
+-- name: DeleteFolder :exec
+DELETE FROM folders WHERE id = $1 AND workspace_id = $2;
+
+-- name: UpdateDocumentFolder :exec
+UPDATE documents
+SET folder_id = $2, updated_at = CURRENT_TIMESTAMP
+WHERE id = $1 AND workspace_id = $3;
+
+-- File requests
+-- name: CreateFileRequest :one
+INSERT INTO file_requests (user_id, request_token, title, message, expires_at, max_files, max_file_size, allowed_types, folder_id, workspace_id)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+RETURNING *;
+
+-- name: GetFileRequestByToken :one
+SELECT * FROM file_requests WHERE request_token = $1;
+
+-- name: GetFileRequestByID :one
+SELECT * FROM file_requests WHERE id = $1;
+
+-- name: ListFileRequestsByUser :many
+SELECT * FROM file_requests WHERE user_id = $1 ORDER BY created_at DESC;
+
+-- name: ReserveFileRequestUpload :execrows
+UPDATE file_requests
+SET upload_count = upload_count + 1
+WHERE id = $1
+  AND expires_at > CURRENT_TIMESTAMP
+  AND (max_files = -1 OR upload_count < max_files);
+
+-- name: ReleaseFileRequestUpload :exec
+UPDATE file_requests
+SET upload_count = upload_count - 1
+WHERE id = $1 AND upload_count > 0;
+
+-- name: DeleteFileRequest :exec
+DELETE FROM file_requests WHERE id = $1 AND user_id = $2;
+
+-- name: CreateFileRequestUpload :exec
+INSERT INTO file_request_uploads (file_request_id, document_id, uploader_name, uploader_email, ip_address)
+VALUES ($1, $2, $3, $4, $5);
+
+-- name: ListFileRequestUploads :many
+SELECT u.*, d.filename, d.file_size, d.mime_type
+FROM file_request_uploads u
+JOIN documents d ON d.id = u.document_id
+WHERE u.file_request_id = $1 AND d.deleted_at IS NULL
+ORDER BY u.created_at DESC;
+
 -- Sessions
 -- name: CreateSession :one
-INSERT INTO sessions (user_id, token, expires_at, ip_address, user_agent)
-VALUES ($1, $2, $3, $4, $5)
+INSERT INTO sessions (id, user_id, token, expires_at, ip_address, user_agent)
+VALUES ($1, $2, $3, $4, $5, $6)
+RETURNING *;
+
+-- name: GetSessionByID :one
+SELECT * FROM sessions WHERE id = $1;
+
+-- name: RenewSession :one
+UPDATE sessions
+SET token = $2, expires_at = $3
+WHERE id = $1 AND expires_at > CURRENT_TIMESTAMP
 RETURNING *;
 
 -- name: GetSessionByToken :one
@@ -66,5 +293,809 @@ SELECT * FROM sessions WHERE token = $1;
 -- name: DeleteSession :exec
 DELETE FROM sessions WHERE id = $1;
 
+-- name: ListUserSessions :many
+SELECT * FROM sessions
+WHERE user_id = $1 AND expires_at > CURRENT_TIMESTAMP
+ORDER BY COALESCE(last_seen_at, created_at) DESC;
+
+-- name: TouchSession :exec
+UPDATE sessions
+SET last_seen_at = CURRENT_TIMESTAMP
+WHERE id = $1;
+
+-- name: DeleteUserSession :execrows
+DELETE FROM sessions WHERE id = $1 AND user_id = $2;
+
+-- name: DeleteOtherUserSessions :many
+DELETE FROM sessions
+WHERE user_id = $1 AND id <> $2
+RETURNING id;
+
+-- name: DeleteAllUserSessions :many
+DELETE FROM sessions
+WHERE user_id = $1
+RETURNING id;
+
 -- name: DeleteExpiredSessions :exec
 DELETE FROM sessions WHERE expires_at < CURRENT_TIMESTAMP;
+
+-- Refresh tokens
+-- name: CreateRefreshToken :one
+INSERT INTO refresh_tokens (session_id, token_hash, expires_at)
+VALUES ($1, $2, $3)
+RETURNING *;
+
+-- name: GetRefreshTokenByHash :one
+SELECT * FROM refresh_tokens WHERE token_hash = $1;
+
+-- name: UseRefreshToken :one
+UPDATE refresh_tokens
+SET used_at = CURRENT_TIMESTAMP
+WHERE token_hash = $1 AND used_at IS NULL AND expires_at > CURRENT_TIMESTAMP
+RETURNING *;
+
+-- MFA recovery codes
+-- name: CreateRecoveryCode :exec
+INSERT INTO mfa_recovery_codes (user_id, code_hash)
+VALUES ($1, $2);
+
+-- name: UseRecoveryCode :execrows
+UPDATE mfa_recovery_codes
+SET used_at = CURRENT_TIMESTAMP
+WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL;
+
+-- name: CountUnusedRecoveryCodes :one
+SELECT COUNT(*) FROM mfa_recovery_codes
+WHERE user_id = $1 AND used_at IS NULL;
+
+-- name: DeleteUserRecoveryCodes :exec
+DELETE FROM mfa_recovery_codes WHERE user_id = $1;
+
+-- WebAuthn credentials
+-- name: CreateWebAuthnCredential :one
+INSERT INTO webauthn_credentials (user_id, credential_id, credential, name)
+VALUES ($1, $2, $3, $4)
+RETURNING *;
+
+-- name: ListUserWebAuthnCredentials :many
+SELECT * FROM webauthn_credentials
+WHERE user_id = $1
+ORDER BY created_at;
+
+-- name: CountUserWebAuthnCredentials :one
+SELECT COUNT(*) FROM webauthn_credentials WHERE user_id = $1;
+
+-- name: UpdateWebAuthnCredentialUsage :exec
+UPDATE webauthn_credentials
+SET credential = $2, last_used_at = CURRENT_TIMESTAMP
+WHERE credential_id = $1;
+
+-- name: RenameWebAuthnCredential :one
+UPDATE webauthn_credentials
+SET name = $3
+WHERE id = $1 AND user_id = $2
+RETURNING *;
+
+-- name: DeleteWebAuthnCredential :execrows
+DELETE FROM webauthn_credentials WHERE id = $1 AND user_id = $2;
+
+-- WebAuthn challenges
+-- name: CreateWebAuthnChallenge :one
+INSERT INTO webauthn_challenges (user_id, purpose, session_data, expires_at)
+VALUES ($1, $2, $3, $4)
+RETURNING *;
+
+-- name: TakeWebAuthnChallenge :one
+DELETE FROM webauthn_challenges
+WHERE id = $1 AND purpose = $2 AND expires_at > CURRENT_TIMESTAMP
+RETURNING *;
+
+-- name: DeleteExpiredWebAuthnChallenges :exec
+DELETE FROM webauthn_challenges WHERE expires_at < CURRENT_TIMESTAMP;
+
+-- SSO identities
+-- name: GetUserIdentity :one
+SELECT * FROM user_identities
+WHERE provider = $1 AND subject = $2;
+
+-- name: CreateUserIdentity :one
+INSERT INTO user_identities (user_id, provider, subject, email, last_login_at)
+VALUES ($1, $2, $3, $4, CURRENT_TIMESTAMP)
+RETURNING *;
+
+-- name: TouchUserIdentity :exec
+UPDATE user_identities
+SET email = $2, last_login_at = CURRENT_TIMESTAMP
+WHERE id = $1;
+
+-- name: ListUserIdentities :many
+SELECT * FROM user_identities
+WHERE user_id = $1
+ORDER BY created_at;
+
+-- OIDC authorization requests
+-- name: CreateOIDCAuthRequest :exec
+INSERT INTO oidc_auth_requests (state_hash, provider, code_verifier, nonce, expires_at)
+VALUES ($1, $2, $3, $4, $5);
+
+-- name: TakeOIDCAuthRequest :one
+DELETE FROM oidc_auth_requests
+WHERE state_hash = $1 AND expires_at > CURRENT_TIMESTAMP
+RETURNING *;
+
+-- name: DeleteExpiredOIDCAuthRequests :exec
+DELETE FROM oidc_auth_requests WHERE expires_at < CURRENT_TIMESTAMP;
+
+-- Email verification and password reset tokens
+-- name: CreateAccountToken :one
+INSERT INTO account_tokens (user_id, purpose, token_hash, expires_at)
+VALUES ($1, $2, $3, $4)
+RETURNING *;
+
+-- name: GetValidAccountToken :one
+SELECT * FROM account_tokens
+WHERE token_hash = $1 AND purpose = $2 AND used_at IS NULL AND expires_at > CURRENT_TIMESTAMP;
+
+-- name: UseAccountToken :one
+UPDATE account_tokens
+SET used_at = CURRENT_TIMESTAMP
+WHERE token_hash = $1 AND purpose = $2 AND used_at IS NULL AND expires_at > CURRENT_TIMESTAMP
+RETURNING *;
+
+-- name: DeleteUserAccountTokens :exec
+DELETE FROM account_tokens
+WHERE user_id = $1 AND purpose = $2;
+
+-- name: DeleteExpiredAccountTokens :exec
+DELETE FROM account_tokens WHERE expires_at < CURRENT_TIMESTAMP;
+
+-- API keys
+-- name: CreateAPIKey :one
+INSERT INTO api_keys (user_id, name, key_prefix, key_hash, scopes, expires_at)
+VALUES ($1, $2, $3, $4, $5, $6)
+RETURNING *;
+
+-- name: GetAPIKeyByHash :one
+SELECT * FROM api_keys WHERE key_hash = $1;
+
+-- name: ListUserAPIKeys :many
+SELECT * FROM api_keys WHERE user_id = $1 ORDER BY created_at DESC;
+
+-- name: TouchAPIKey :exec
+UPDATE api_keys
+SET last_used_at = CURRENT_TIMESTAMP, last_used_ip = $2
+WHERE id = $1;
+
+-- name: DeleteAPIKey :one
+DELETE FROM api_keys
+WHERE id = $1 AND user_id = $2
+RETURNING *;
+
+-- Organizations
+-- name: CreateOrganization :one
+INSERT INTO organizations (name)
+VALUES ($1)
+RETURNING *;
+
+-- name: GetOrganizationByID :one
+SELECT * FROM organizations WHERE id = $1;
+
+-- name: ListUserOrganizations :many
+SELECT o.*, om.role
+FROM organizations o
+JOIN organization_members om ON om.organization_id = o.id
+WHERE om.user_id = $1
+ORDER BY o.name;
+
+-- name: SetOrganizationRequireMFA :one
+UPDATE organizations SET require_mfa = $2
+WHERE id = $1
+RETURNING *;
+
+-- UserRequiresMFA reports whether any organization the user belongs to
+-- requires its members to use a second factor
+-- name: UserRequiresMFA :one
+SELECT EXISTS (
+    SELECT 1 FROM organization_members om
+    JOIN organizations o ON o.id = om.organization_id
+    WHERE om.user_id = $1 AND o.require_mfa
+) AS required;
+
+-- name: GetOrganizationRole :one
+SELECT role FROM organization_members WHERE organization_id = $1 AND user_id = $2;
+
+-- name: AddOrganizationMember :one
+INSERT INTO organization_members (organization_id, user_id, role)
+VALUES ($1, $2, $3)
+ON CONFLICT (organization_id, user_id) DO UPDATE SET role = EXCLUDED.role
+RETURNING *;
+
+-- name: ListOrganizationMembers :many
+SELECT om.user_id, om.role, om.created_at, u.email, u.full_name
+FROM organization_members om
+JOIN users u ON u.id = om.user_id
+WHERE om.organization_id = $1
+ORDER BY u.email;
+
+-- name: CountOrganizationOwners :one
+SELECT COUNT(*) FROM organization_members WHERE organization_id = $1 AND role = 'owner';
+
+-- name: RemoveOrganizationMember :execrows
+WITH left_teams AS (
+    DELETE FROM team_members
+    WHERE team_members.user_id = $2 AND team_id IN (SELECT id FROM teams WHERE organization_id = $1)
+), left_workspaces AS (
+    DELETE FROM workspace_members
+    WHERE workspace_members.user_id = $2 AND workspace_id IN (SELECT id FROM workspaces WHERE organization_id = $1)
+)
+DELETE FROM organization_members WHERE organization_id = $1 AND user_id = $2;
+
+-- Teams
+-- name: CreateTeam :one
+INSERT INTO teams (organization_id, name)
+VALUES ($1, $2)
+RETURNING *;
+
+-- name: GetTeamByID :one
+SELECT * FROM teams WHERE id = $1;
+
+-- name: ListOrganizationTeams :many
+SELECT * FROM teams WHERE organization_id = $1 ORDER BY name;
+
+-- name: DeleteTeam :execrows
+DELETE FROM teams WHERE id = $1 AND organization_id = $2;
+
+-- name: AddTeamMember :exec
+INSERT INTO team_members (team_id, user_id)
+VALUES ($1, $2)
+ON CONFLICT DO NOTHING;
+
+-- name: ListTeamMembers :many
+SELECT tm.team_id, tm.user_id, u.email, u.full_name
+FROM team_members tm
+JOIN teams t ON t.id = tm.team_id
+JOIN users u ON u.id = tm.user_id
+WHERE t.organization_id = $1
+ORDER BY u.email;
+
+-- name: RemoveTeamMember :execrows
+DELETE FROM team_members WHERE team_id = $1 AND user_id = $2;
+
+-- Workspaces
+-- name: CreateWorkspace :one
+INSERT INTO workspaces (organization_id, name)
+VALUES ($1, $2)
+RETURNING *;
+
+-- name: GetPersonalWorkspace :one
+SELECT * FROM workspaces WHERE personal_user_id = $1;
+
+-- name: CreatePersonalWorkspace :one
+INSERT INTO workspaces (personal_user_id, name)
+VALUES ($1, 'Personal')
+ON CONFLICT (personal_user_id) DO UPDATE SET name = workspaces.name
+RETURNING *;
+
+-- name: GetWorkspaceByID :one
+SELECT * FROM workspaces WHERE id = $1;
+
+-- name: ListUserWorkspaces :many
+SELECT * FROM workspaces
+WHERE id IN (
+    SELECT workspace_id FROM workspace_members
+    WHERE workspace_members.user_id = $1
+       OR team_id IN (SELECT team_id FROM team_members WHERE team_members.user_id = $1)
+)
+OR organization_id IN (
+    SELECT organization_id FROM organization_members
+    WHERE organization_members.user_id = $1 AND role IN ('owner', 'admin')
+)
+ORDER BY personal_user_id IS NULL, name;
+
+-- name: GetWorkspaceRole :one
+SELECT roles.role AS role FROM (
+    SELECT wm.role FROM workspace_members wm
+    WHERE wm.workspace_id = $1
+      AND (wm.user_id = $2 OR wm.team_id IN (SELECT tm.team_id FROM team_members tm WHERE tm.user_id = $2))
+    UNION ALL
+    SELECT 'owner' FROM workspaces w
+    JOIN organization_members om ON om.organization_id = w.organization_id
+    WHERE w.id = $1 AND om.user_id = $2 AND om.role IN ('owner', 'admin')
+) roles
+ORDER BY CASE roles.role WHEN 'owner' THEN 0 WHEN 'editor' THEN 1 WHEN 'viewer' THEN 2 ELSE 3 END
+LIMIT 1;
+
+-- name: AddWorkspaceUser :one
+INSERT INTO workspace_members (workspace_id, user_id, role)
+VALUES ($1, $2, $3)
+ON CONFLICT (workspace_id, user_id) DO UPDATE SET role = EXCLUDED.role
+RETURNING *;
+
+-- name: AddWorkspaceTeam :one
+INSERT INTO workspace_members (workspace_id, team_id, role)
+VALUES ($1, $2, $3)
+ON CONFLICT (workspace_id, team_id) DO UPDATE SET role = EXCLUDED.role
+RETURNING *;
+
+-- name: ListWorkspaceMembers :many
+SELECT wm.id, wm.user_id, wm.team_id, wm.role, wm.created_at, u.email, t.name AS team_name
+FROM workspace_members wm
+LEFT JOIN users u ON u.id = wm.user_id
+LEFT JOIN teams t ON t.id = wm.team_id
+WHERE wm.workspace_id = $1
+ORDER BY wm.created_at;
+
+-- name: RemoveWorkspaceMember :one
+DELETE FROM workspace_members WHERE id = $1 AND workspace_id = $2
+RETURNING *;
+
+-- name: DeleteWorkspace :execrows
+DELETE FROM workspaces WHERE id = $1 AND organization_id IS NOT NULL;
+
+-- Document Grants
+-- name: GrantDocumentUser :one
+INSERT INTO document_grants (document_id, user_id, permission, granted_by)
+VALUES ($1, $2, $3, $4)
+ON CONFLICT (document_id, user_id) DO UPDATE SET permission = EXCLUDED.permission, granted_by = EXCLUDED.granted_by
+RETURNING *;
+
+-- name: GrantDocumentTeam :one
+INSERT INTO document_grants (document_id, team_id, permission, granted_by)
+VALUES ($1, $2, $3, $4)
+ON CONFLICT (document_id, team_id) DO UPDATE SET permission = EXCLUDED.permission, granted_by = EXCLUDED.granted_by
+RETURNING *;
+
+-- name: ListDocumentGrants :many
+SELECT g.id, g.user_id, g.team_id, g.permission, g.created_at, u.email, t.name AS team_name
+FROM document_grants g
+LEFT JOIN users u ON u.id = g.user_id
+LEFT JOIN teams t ON t.id = g.team_id
+WHERE g.document_id = $1
+ORDER BY g.created_at;
+
+-- name: RevokeDocumentGrant :one
+DELETE FROM document_grants WHERE id = $1 AND document_id = $2
+RETURNING *;
+
+-- name: GetDocumentGrant :one
+SELECT g.permission FROM document_grants g
+WHERE g.document_id = $1
+  AND (g.user_id = $2 OR g.team_id IN (SELECT tm.team_id FROM team_members tm WHERE tm.user_id = $2))
+ORDER BY g.permission = 'edit' DESC
+LIMIT 1;
+
+-- name: ListSharedDocuments :many
+SELECT d.id, d.filename, d.file_size, d.mime_type, u.email AS owner_email,
+    (CASE WHEN bool_or(g.permission = 'edit') THEN 'edit' ELSE 'read' END)::text AS permission,
+    MAX(g.created_at)::timestamptz AS shared_at
+FROM document_grants g
+JOIN documents d ON d.id = g.document_id
+JOIN users u ON u.id = d.user_id
+WHERE (g.user_id = $1 OR g.team_id IN (SELECT tm.team_id FROM team_members tm WHERE tm.user_id = $1))
+  AND d.deleted_at IS NULL
+GROUP BY d.id, u.email
+ORDER BY shared_at DESC;
+
+-- Admin console
+-- name: SearchUsers :many
+SELECT u.id, u.email, u.full_name, u.is_active, u.is_admin, u.is_legal, u.totp_enabled, u.locked_until, u.created_at,
+    COALESCE(su.document_count, 0)::bigint AS document_count,
+    COALESCE(su.used_bytes, 0)::bigint AS storage_bytes
+FROM users u
+LEFT JOIN storage_usage su ON su.user_id = u.id
+WHERE u.email ILIKE '%' || $1::text || '%' OR u.full_name ILIKE '%' || $1::text || '%'
+ORDER BY u.email
+LIMIT $2 OFFSET $3;
+
+-- name: ListStorageUsage :many
+SELECT u.id, u.email, u.full_name, su.plan, su.quota_bytes, su.quota_documents,
+    su.document_count::bigint AS document_count,
+    su.used_bytes AS storage_bytes
+FROM storage_usage su
+JOIN users u ON u.id = su.user_id
+ORDER BY su.used_bytes DESC
+LIMIT $1;
+
+-- name: GetStorageTotals :one
+SELECT COUNT(*) AS document_count, COALESCE(SUM(file_size), 0)::bigint AS storage_bytes
+FROM documents;
+
+-- name: ListActiveShares :many
+SELECT s.id, s.name, s.folder_id, s.expires_at, s.max_access, s.access_count, s.view_only, s.created_at,
+    u.email AS created_by_email,
+    (SELECT COUNT(*) FROM share_documents sd WHERE sd.share_id = s.id) AS document_count
+FROM shares s
+JOIN users u ON u.id = s.created_by
+WHERE s.expires_at > CURRENT_TIMESTAMP
+  AND (COALESCE(s.max_access, -1) < 0 OR s.access_count < s.max_access)
+  AND u.email ILIKE '%' || $1::text || '%'
+ORDER BY s.created_at DESC
+LIMIT $2 OFFSET $3;
+
+-- name: DeleteUserWebAuthnCredentials :execrows
+DELETE FROM webauthn_credentials WHERE user_id = $1;
+
+-- name: ListSecurityEvents :many
+SELECT * FROM audit_events
+WHERE action LIKE ANY($1::text[])
+ORDER BY seq DESC
+LIMIT $2;
+
+-- Storage quotas
+-- name: GetUserStorage :one
+SELECT * FROM storage_usage WHERE user_id = $1;
+
+-- name: GetOrganizationStorage :one
+SELECT * FROM storage_usage WHERE organization_id = $1;
+
+-- name: AddUserStorage :one
+INSERT INTO storage_usage (user_id, plan, used_bytes, document_count)
+VALUES ($1, $2, $3, 1)
+ON CONFLICT (user_id) DO UPDATE SET
+    used_bytes = storage_usage.used_bytes + EXCLUDED.used_bytes,
+    document_count = storage_usage.document_count + 1,
+    updated_at = CURRENT_TIMESTAMP
+RETURNING *;
+
+-- name: AddOrganizationStorage :one
+INSERT INTO storage_usage (organization_id, plan, used_bytes, document_count)
+VALUES ($1, $2, $3, 1)
+ON CONFLICT (organization_id) DO UPDATE SET
+    used_bytes = storage_usage.used_bytes + EXCLUDED.used_bytes,
+    document_count = storage_usage.document_count + 1,
+    updated_at = CURRENT_TIMESTAMP
+RETURNING *;
+
+-- name: RemoveUserStorage :exec
+UPDATE storage_usage
+SET used_bytes = GREATEST(used_bytes - $2, 0),
+    document_count = GREATEST(document_count - 1, 0),
+    updated_at = CURRENT_TIMESTAMP
+WHERE user_id = $1;
+
+-- name: RemoveOrganizationStorage :exec
+UPDATE storage_usage
+SET used_bytes = GREATEST(used_bytes - $2, 0),
+    document_count = GREATEST(document_count - 1, 0),
+    updated_at = CURRENT_TIMESTAMP
+WHERE organization_id = $1;
+
+-- name: SetUserQuota :one
+INSERT INTO storage_usage (user_id, plan, quota_bytes, quota_documents)
+VALUES ($1, $2, $3, $4)
+ON CONFLICT (user_id) DO UPDATE SET
+    plan = EXCLUDED.plan,
+    quota_bytes = EXCLUDED.quota_bytes,
+    quota_documents = EXCLUDED.quota_documents,
+    updated_at = CURRENT_TIMESTAMP
+RETURNING *;
+
+-- name: SetOrganizationQuota :one
+INSERT INTO storage_usage (organization_id, plan, quota_bytes, quota_documents)
+VALUES ($1, $2, $3, $4)
+ON CONFLICT (organization_id) DO UPDATE SET
+    plan = EXCLUDED.plan,
+    quota_bytes = EXCLUDED.quota_bytes,
+    quota_documents = EXCLUDED.quota_documents,
+    updated_at = CURRENT_TIMESTAMP
+RETURNING *;
+
+-- Audit events
+-- Serializes writers, so each event is chained to the one before it
+-- name: LockAuditLog :exec
+SELECT pg_advisory_xact_lock(hashtext('audit_events'));
+
+-- name: GetLastAuditEvent :one
+SELECT seq, hash FROM audit_events ORDER BY seq DESC LIMIT 1;
+
+-- name: CreateAuditEvent :exec
+INSERT INTO audit_events (
+    seq, occurred_at, actor_id, actor_email, action, resource_type, resource_id,
+    ip_address, user_agent, details, prev_hash, hash
+)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12);
+
+-- name: ListAuditEventsAfter :many
+SELECT * FROM audit_events WHERE seq > $1 ORDER BY seq LIMIT $2;
+
+-- name: ExportAuditEvents :many
+SELECT * FROM audit_events
+WHERE seq > $1
+  AND occurred_at >= $2 AND occurred_at < $3
+  AND ($4::text = '' OR action = $4::text OR action LIKE $4::text || '.%')
+  AND ($5::text = '' OR actor_email = $5::text)
+  AND ($6::text = '' OR resource_type = $6::text)
+  AND ($7::text = '' OR resource_id = $7::text)
+ORDER BY seq
+LIMIT $8;
+
+-- Document tags
+-- name: ListDocumentTags :many
+SELECT tag FROM document_tags WHERE document_id = $1 ORDER BY tag;
+
+-- Replaces the tags of a document in one statement
+-- name: SetDocumentTags :exec
+WITH removed AS (
+    DELETE FROM document_tags WHERE document_id = $1 AND tag <> ALL($2::text[])
+)
+INSERT INTO document_tags (document_id, tag)
+SELECT $1, unnest($2::text[])
+ON CONFLICT DO NOTHING;
+
+-- Retention policies
+-- name: CreateRetentionPolicy :one
+INSERT INTO retention_policies (workspace_id, folder_id, tag, retain_months, retain_days, warn_days, created_by)
+VALUES ($1, $2, $3, $4, $5, $6, $7)
+RETURNING *;
+
+-- name: ListRetentionPolicies :many
+SELECT * FROM retention_policies WHERE workspace_id = $1 ORDER BY created_at;
+
+-- name: UpdateRetentionPolicy :one
+UPDATE retention_policies
+SET retain_months = $3, retain_days = $4, warn_days = $5, updated_at = CURRENT_TIMESTAMP
+WHERE id = $1 AND workspace_id = $2
+RETURNING *;
+
+-- name: DeleteRetentionPolicy :one
+DELETE FROM retention_policies WHERE id = $1 AND workspace_id = $2
+RETURNING *;
+
+-- name: ListRetentionWorkspaces :many
+SELECT workspace_id FROM retention_policies GROUP BY workspace_id;
+
+-- Every document of a workspace with its tags, the expiry warning sent for
+-- it, if any, and whether it is under legal hold
+-- name: ListRetentionDocuments :many
+SELECT d.id, d.user_id, d.filename, d.folder_id, d.created_at,
+       COALESCE(array_agg(t.tag) FILTER (WHERE t.tag IS NOT NULL), '{}')::text[] AS tags,
+       n.due_at AS notice_due_at, n.delete_at AS notice_delete_at,
+       document_held(d.id) AS held
+FROM documents d
+LEFT JOIN document_tags t ON t.document_id = d.id
+LEFT JOIN retention_notices n ON n.document_id = d.id
+WHERE d.workspace_id = $1 AND d.deleted_at IS NULL
+GROUP BY d.id, n.document_id;
+
+-- A document like ListRetentionDocuments returns them, also if it is in
+-- the trash
+-- name: GetRetentionDocument :one
+SELECT d.id, d.user_id, d.filename, d.folder_id, d.created_at,
+       COALESCE(array_agg(t.tag) FILTER (WHERE t.tag IS NOT NULL), '{}')::text[] AS tags,
+       n.due_at AS notice_due_at, n.delete_at AS notice_delete_at,
+       document_held(d.id) AS held
+FROM documents d
+LEFT JOIN document_tags t ON t.document_id = d.id
+LEFT JOIN retention_notices n ON n.document_id = d.id
+WHERE d.id = $1
+GROUP BY d.id, n.document_id;
+
+-- Records the warning for a document. Returns 0 rows if it was already
+-- warned about the same due date, so overlapping runs warn once.
+-- name: ClaimRetentionNotice :execrows
+INSERT INTO retention_notices (document_id, due_at, delete_at)
+VALUES ($1, $2, $3)
+ON CONFLICT (document_id) DO UPDATE
+SET due_at = EXCLUDED.due_at, delete_at = EXCLUDED.delete_at, notified_at = CURRENT_TIMESTAMP
+WHERE retention_notices.due_at <> EXCLUDED.due_at;
+
+-- Legal holds
+-- name: CreateLegalHold :one
+INSERT INTO legal_holds (resource_type, resource_id, reason, custodian, placed_by)
+VALUES ($1, $2, $3, $4, $5)
+RETURNING *;
+
+-- name: GetLegalHold :one
+SELECT * FROM legal_holds WHERE id = $1;
+
+-- Active holds, or all holds if $1 is true, with the name of what they hold
+-- name: ListLegalHolds :many
+SELECT h.*, COALESCE(d.filename, f.name, u.email, '')::text AS resource_name
+FROM legal_holds h
+LEFT JOIN documents d ON h.resource_type = 'document' AND d.id = h.resource_id
+LEFT JOIN folders f ON h.resource_type = 'folder' AND f.id = h.resource_id
+LEFT JOIN users u ON h.resource_type = 'user' AND u.id = h.resource_id
+WHERE $1::bool OR h.released_at IS NULL
+ORDER BY h.placed_at DESC;
+
+-- name: ReleaseLegalHold :one
+UPDATE legal_holds
+SET released_by = $2, released_at = CURRENT_TIMESTAMP, release_reason = $3
+WHERE id = $1 AND released_at IS NULL
+RETURNING *;
+
+-- name: IsDocumentHeld :one
+SELECT document_held($1) AS held;
+
+-- name: IsFolderHeld :one
+SELECT folder_held($1) AS held;
+
+-- name: IsUserHeld :one
+SELECT EXISTS (
+    SELECT 1 FROM legal_holds
+    WHERE resource_type = 'user' AND resource_id = $1 AND released_at IS NULL
+);
+
+-- Recycle bin
+-- name: TrashDocument :one
+UPDATE documents
+SET deleted_at = CURRENT_TIMESTAMP, deleted_by = $3
+WHERE id = $1 AND workspace_id = $2 AND deleted_at IS NULL
+RETURNING *;
+
+-- name: GetTrashedDocument :one
+SELECT * FROM documents WHERE id = $1 AND deleted_at IS NOT NULL;
+
+-- name: ListTrashedDocuments :many
+SELECT * FROM documents
+WHERE workspace_id = $1 AND deleted_at IS NOT NULL
+ORDER BY deleted_at DESC;
+
+-- Restores a document trashed after the cutoff, the start of the window
+-- in which documents can be restored
+-- name: RestoreDocument :one
+UPDATE documents
+SET deleted_at = NULL, deleted_by = NULL, updated_at = CURRENT_TIMESTAMP
+WHERE id = $1 AND workspace_id = $2 AND deleted_at > $3
+RETURNING *;
+
+-- Documents trashed before the cutoff that no legal hold keeps, oldest
+-- first
+-- name: ListPurgeableDocuments :many
+SELECT * FROM documents
+WHERE deleted_at < $1 AND NOT document_held(id)
+ORDER BY deleted_at
+LIMIT $2;
+
+-- Data subject requests
+-- name: CreateDataExport :one
+INSERT INTO data_exports (user_id)
+VALUES ($1)
+RETURNING *;
+
+-- name: GetDataExport :one
+SELECT * FROM data_exports WHERE id = $1 AND user_id = $2;
+
+-- name: ListDataExports :many
+SELECT * FROM data_exports
+WHERE user_id = $1
+ORDER BY requested_at DESC;
+
+-- Claims an export for the worker. A running export is claimed again so
+-- that a retried job picks up where the failed one left off.
+-- name: StartDataExport :execrows
+UPDATE data_exports
+SET status = 'running'
+WHERE id = $1 AND status IN ('pending', 'running');
+
+-- name: CompleteDataExport :one
+UPDATE data_exports
+SET status = 'ready', file_path = $2, file_size = $3, completed_at = CURRENT_TIMESTAMP, expires_at = $4
+WHERE id = $1
+RETURNING *;
+
+-- name: FailDataExport :exec
+UPDATE data_exports
+SET status = 'failed', error = $2, completed_at = CURRENT_TIMESTAMP
+WHERE id = $1;
+
+-- name: ListExpiredDataExports :many
+SELECT * FROM data_exports
+WHERE status = 'ready' AND expires_at < $1;
+
+-- name: ListUserExportFiles :many
+SELECT file_path FROM data_exports
+WHERE user_id = $1 AND file_path IS NOT NULL;
+
+-- name: DeleteDataExport :exec
+DELETE FROM data_exports WHERE id = $1;
+
+-- Every document a user uploaded or that is in their personal workspace,
+-- including those in the trash
+-- name: ListAccountDocuments :many
+SELECT * FROM documents
+WHERE user_id = $1 OR workspace_id IN (SELECT id FROM workspaces WHERE personal_user_id = $1)
+ORDER BY created_at;
+
+-- name: ListPersonalWorkspaceDocuments :many
+SELECT * FROM documents
+WHERE workspace_id IN (SELECT id FROM workspaces WHERE personal_user_id = $1)
+ORDER BY created_at;
+
+-- Documents and folders a user created in organization workspaces pass to
+-- the longest-standing other owner of the organization. The documents are
+-- returned with their new uploader.
+-- name: ReassignOrganizationDocuments :many
+UPDATE documents d
+SET user_id = (
+    SELECT om.user_id FROM organization_members om
+    WHERE om.organization_id = w.organization_id AND om.role = 'owner' AND om.user_id <> $1
+    ORDER BY om.created_at, om.user_id
+    LIMIT 1
+)
+FROM workspaces w
+WHERE w.id = d.workspace_id AND w.organization_id IS NOT NULL AND d.user_id = $1
+RETURNING d.id, d.user_id, d.file_size;
+
+-- name: ReassignOrganizationFolders :execrows
+UPDATE folders f
+SET user_id = (
+    SELECT om.user_id FROM organization_members om
+    WHERE om.organization_id = w.organization_id AND om.role = 'owner' AND om.user_id <> $1
+    ORDER BY om.created_at, om.user_id
+    LIMIT 1
+)
+FROM workspaces w
+WHERE w.id = f.workspace_id AND w.organization_id IS NOT NULL AND f.user_id = $1;
+
+-- name: ListUserShares :many
+SELECT * FROM shares
+WHERE created_by = $1
+ORDER BY created_at;
+
+-- name: ListUserShareDocuments :many
+SELECT sd.* FROM share_documents sd
+JOIN shares s ON s.id = sd.share_id
+WHERE s.created_by = $1;
+
+-- name: ListUserShareAccessLogs :many
+SELECT l.* FROM share_access_logs l
+JOIN shares s ON s.id = l.share_id
+WHERE s.created_by = $1
+ORDER BY l.created_at;
+
+-- Audit events the user took part in, as actor or as the user acted on
+-- name: ListUserAuditEvents :many
+SELECT * FROM audit_events
+WHERE actor_id = $1 OR (resource_type = 'user' AND resource_id = $1::text)
+ORDER BY seq;
+
+-- name: DeleteUserShares :many
+DELETE FROM shares
+WHERE created_by = $1
+RETURNING share_token;
+
+-- Whether a legal hold keeps the account or any of the documents and
+-- folders that deleting it would delete
+-- name: IsAccountHeld :one
+SELECT EXISTS (
+    SELECT 1 FROM legal_holds
+    WHERE resource_type = 'user' AND resource_id = $1 AND released_at IS NULL
+) OR EXISTS (
+    SELECT 1 FROM documents
+    WHERE workspace_id IN (SELECT id FROM workspaces WHERE personal_user_id = $1)
+      AND document_held(id)
+) OR EXISTS (
+    SELECT 1 FROM folders
+    WHERE workspace_id IN (SELECT id FROM workspaces WHERE personal_user_id = $1)
+      AND folder_held(id)
+) AS held;
+
+-- Organizations the user is the only owner of, which would be left
+-- without one
+-- name: ListSoleOwnedOrganizations :many
+SELECT o.* FROM organizations o
+JOIN organization_members om ON om.organization_id = o.id
+WHERE om.user_id = $1 AND om.role = 'owner'
+  AND NOT EXISTS (
+    SELECT 1 FROM organization_members other
+    WHERE other.organization_id = o.id AND other.role = 'owner' AND other.user_id <> $1
+  )
+ORDER BY o.name;
+
+-- name: ScheduleUserDeletion :one
+UPDATE users
+SET delete_after = $2, updated_at = CURRENT_TIMESTAMP
+WHERE id = $1
+RETURNING *;
+
+-- name: CancelUserDeletion :one
+UPDATE users
+SET delete_after = NULL, updated_at = CURRENT_TIMESTAMP
+WHERE id = $1 AND delete_after IS NOT NULL
+RETURNING *;
+
+-- name: ListUsersDueForDeletion :many
+SELECT * FROM users
+WHERE delete_after <= $1
+ORDER BY delete_after;
@@ -9,13 +9,96 @@ CREATE TABLE users (
     full_name VARCHAR(255) NOT NULL,
     created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
     updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
-    is_active BOOLEAN DEFAULT TRUE
+    is_active BOOLEAN DEFAULT TRUE,
+    default_allowed_cidrs CIDR[] NOT NULL DEFAULT '{}',
+    is_admin BOOLEAN NOT NULL DEFAULT FALSE,
+    totp_secret VARCHAR(64),
+    totp_enabled BOOLEAN NOT NULL DEFAULT FALSE,
+    totp_last_step BIGINT NOT NULL DEFAULT 0,
+    email_verified_at TIMESTAMP WITH TIME ZONE,
+    failed_login_count INTEGER NOT NULL DEFAULT 0,
+    last_failed_login_at TIMESTAMP WITH TIME ZONE,
+    locked_until TIMESTAMP WITH TIME ZONE,
+    is_legal BOOLEAN NOT NULL DEFAULT FALSE,
+    delete_after TIMESTAMP WITH TIME ZONE,
+    last_login_attempt_at TIMESTAMP WITH TIME ZONE
+);
+
+-- Organizations table
+CREATE TABLE organizations (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    name VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    require_mfa BOOLEAN NOT NULL DEFAULT false
+);
+
+-- Organization members table. Owners and admins manage members, teams and
+-- workspaces of the organization.
+CREATE TABLE organization_members (
+    organization_id UUID NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    role VARCHAR(16) NOT NULL DEFAULT 'member',
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (organization_id, user_id)
+);
+
+-- Teams table (groups of organization members)
+CREATE TABLE teams (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    organization_id UUID NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    name VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (organization_id, name)
+);
+
+CREATE TABLE team_members (
+    team_id UUID NOT NULL REFERENCES teams(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (team_id, user_id)
+);
+
+-- Workspaces table. Workspaces own folders and documents; each belongs to
+-- an organization or is the personal workspace of one user.
+CREATE TABLE workspaces (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    organization_id UUID REFERENCES organizations(id) ON DELETE CASCADE,
+    personal_user_id UUID UNIQUE REFERENCES users(id) ON DELETE CASCADE,
+    name VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    CHECK ((organization_id IS NULL) <> (personal_user_id IS NULL))
+);
+
+-- Workspace members table. A member is a user or a whole team with the
+-- role owner, editor, viewer or auditor.
+CREATE TABLE workspace_members (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    workspace_id UUID NOT NULL REFERENCES workspaces(id) ON DELETE CASCADE,
+    user_id UUID REFERENCES users(id) ON DELETE CASCADE,
+    team_id UUID REFERENCES teams(id) ON DELETE CASCADE,
+    role VARCHAR(16) NOT NULL DEFAULT 'editor'
+        CONSTRAINT workspace_members_role_check CHECK (role IN ('owner', 'editor', 'viewer', 'auditor')),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    CHECK ((user_id IS NULL) <> (team_id IS NULL)),
+    UNIQUE (workspace_id, user_id),
+    UNIQUE (workspace_id, team_id)
+);
+
+-- Folders table
+CREATE TABLE folders (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    user_id UUID NOT NULL REFERENCES users(id),
+    parent_id UUID REFERENCES folders(id) ON DELETE CASCADE,
+    name VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    workspace_id UUID NOT NULL REFERENCES workspaces(id) ON DELETE CASCADE
 );
 
 -- Documents table
 CREATE TABLE documents (
     id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
-    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id),
     filename VARCHAR(255) NOT NULL,
     file_path VARCHAR(500) NOT NULL,
     encrypted_key TEXT NOT NULL,
@@ -23,20 +106,113 @@ CREATE TABLE documents (
     mime_type VARCHAR(100) NOT NULL,
     checksum VARCHAR(128) NOT NULL,
     created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
-    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    folder_id UUID REFERENCES folders(id) ON DELETE SET NULL,
+    workspace_id UUID NOT NULL REFERENCES workspaces(id) ON DELETE CASCADE,
+    deleted_at TIMESTAMP WITH TIME ZONE,
+    deleted_by UUID REFERENCES users(id) ON DELETE SET NULL
+);
+
+-- Document grants table. Shares a document with a portal user or a whole
+-- team, with read or edit permission.
+CREATE TABLE document_grants (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    document_id UUID NOT NULL REFERENCES documents(id) ON DELETE CASCADE,
+    user_id UUID REFERENCES users(id) ON DELETE CASCADE,
+    team_id UUID REFERENCES teams(id) ON DELETE CASCADE,
+    permission VARCHAR(16) NOT NULL CHECK (permission IN ('read', 'edit')),
+    granted_by UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    CHECK ((user_id IS NULL) <> (team_id IS NULL)),
+    UNIQUE (document_id, user_id),
+    UNIQUE (document_id, team_id)
+);
+
+-- Storage usage table. Counts the bytes and documents of a user (every
+-- document they uploaded) or an organization (every document in its
+-- workspaces). Quotas come from the plan unless overridden here.
+CREATE TABLE storage_usage (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    user_id UUID UNIQUE REFERENCES users(id) ON DELETE CASCADE,
+    organization_id UUID UNIQUE REFERENCES organizations(id) ON DELETE CASCADE,
+    plan VARCHAR(32) NOT NULL,
+    quota_bytes BIGINT CHECK (quota_bytes >= 0),
+    quota_documents INTEGER CHECK (quota_documents >= 0),
+    used_bytes BIGINT NOT NULL DEFAULT 0 CHECK (used_bytes >= 0),
+    document_count INTEGER NOT NULL DEFAULT 0 CHECK (document_count >= 0),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    CHECK ((user_id IS NULL) <> (organization_id IS NULL))
 );
 
 -- Shares table
+-- A share covers the documents listed in share_documents, or every document
+-- below folder_id when it is set.
 CREATE TABLE shares (
     id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
-    document_id UUID NOT NULL REFERENCES documents(id) ON DELETE CASCADE,
     share_token VARCHAR(255) UNIQUE NOT NULL,
     expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
     max_access INTEGER DEFAULT -1,
     access_count INTEGER DEFAULT 0,
     password_hash VARCHAR(255),
     created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
-    created_by UUID NOT NULL REFERENCES users(id)
+    created_by UUID NOT NULL REFERENCES users(id),
+    folder_id UUID REFERENCES folders(id) ON DELETE CASCADE,
+    name VARCHAR(255),
+    view_only BOOLEAN NOT NULL DEFAULT FALSE,
+    allowed_cidrs CIDR[] NOT NULL DEFAULT '{}',
+    notify_on_access VARCHAR(16) NOT NULL DEFAULT 'none',
+    notify_on_limit BOOLEAN NOT NULL DEFAULT FALSE,
+    notify_password_failures INTEGER,
+    notify_expiring_hours INTEGER,
+    expiry_notified_at TIMESTAMP WITH TIME ZONE
+);
+
+-- Share documents table (bundle membership and per-file download counts)
+CREATE TABLE share_documents (
+    share_id UUID NOT NULL REFERENCES shares(id) ON DELETE CASCADE,
+    document_id UUID NOT NULL REFERENCES documents(id) ON DELETE CASCADE,
+    download_count INTEGER NOT NULL DEFAULT 0,
+    last_download_at TIMESTAMP WITH TIME ZONE,
+    PRIMARY KEY (share_id, document_id)
+);
+
+-- Share access log table
+CREATE TABLE share_access_logs (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    share_id UUID NOT NULL REFERENCES shares(id) ON DELETE CASCADE,
+    document_id UUID REFERENCES documents(id) ON DELETE SET NULL,
+    action VARCHAR(32) NOT NULL,
+    ip_address INET,
+    user_agent TEXT,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- File requests table (inbound upload-only links)
+CREATE TABLE file_requests (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    request_token VARCHAR(255) UNIQUE NOT NULL,
+    title VARCHAR(255) NOT NULL,
+    message TEXT,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    max_files INTEGER NOT NULL DEFAULT -1,
+    max_file_size BIGINT NOT NULL,
+    allowed_types TEXT,
+    upload_count INTEGER NOT NULL DEFAULT 0,
+    folder_id UUID REFERENCES folders(id) ON DELETE SET NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    workspace_id UUID NOT NULL REFERENCES workspaces(id) ON DELETE CASCADE
+);
+
+-- File request uploads table (who sent which document through a request)
+CREATE TABLE file_request_uploads (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    file_request_id UUID NOT NULL REFERENCES file_requests(id) ON DELETE CASCADE,
+    document_id UUID NOT NULL REFERENCES documents(id) ON DELETE CASCADE,
+    uploader_name VARCHAR(255),
+    uploader_email VARCHAR(255),
+    ip_address INET,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
 );
 
 -- Sessions table
@@ -47,7 +223,251 @@ CREATE TABLE sessions (
     expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
     created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
     ip_address INET,
-    user_agent TEXT
+    user_agent TEXT,
+    last_seen_at TIMESTAMP WITH TIME ZONE
+);
+
+-- Refresh tokens table. Every token of a session belongs to the same
+-- family, so reusing a rotated token ends the whole session.
+CREATE TABLE refresh_tokens (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    session_id UUID NOT NULL REFERENCES sessions(id) ON DELETE CASCADE,
+    token_hash VARCHAR(64) UNIQUE NOT NULL,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    used_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- MFA recovery codes table. Each code can be used once instead of a TOTP code.
+CREATE TABLE mfa_recovery_codes (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    code_hash VARCHAR(64) NOT NULL,
+    used_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- WebAuthn credentials table. The credential column holds the library's
+-- credential record (public key, sign count, flags) as JSON.
+CREATE TABLE webauthn_credentials (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    credential_id BYTEA UNIQUE NOT NULL,
+    credential JSONB NOT NULL,
+    name VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    last_used_at TIMESTAMP WITH TIME ZONE
+);
+
+-- WebAuthn challenges table. Holds the state of registration and login
+-- ceremonies between their begin and finish requests; each is used once.
+CREATE TABLE webauthn_challenges (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    user_id UUID REFERENCES users(id) ON DELETE CASCADE,
+    purpose VARCHAR(16) NOT NULL,
+    session_data JSONB NOT NULL,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE user_identities (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    provider VARCHAR(64) NOT NULL,
+    subject VARCHAR(255) NOT NULL,
+    email VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    last_login_at TIMESTAMP WITH TIME ZONE,
+    UNIQUE (provider, subject)
+);
+
+CREATE TABLE oidc_auth_requests (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    state_hash VARCHAR(64) UNIQUE NOT NULL,
+    provider VARCHAR(64) NOT NULL,
+    code_verifier VARCHAR(128) NOT NULL,
+    nonce VARCHAR(64) NOT NULL,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE account_tokens (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    purpose VARCHAR(32) NOT NULL,
+    token_hash VARCHAR(64) UNIQUE NOT NULL,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    used_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- API keys table. Personal keys let scripts call the API with a subset of
+-- their owner's permissions; only a hash of each key is stored.
+CREATE TABLE api_keys (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name VARCHAR(100) NOT NULL,
+    key_prefix VARCHAR(16) NOT NULL,
+    key_hash VARCHAR(64) UNIQUE NOT NULL,
+    scopes TEXT[] NOT NULL DEFAULT '{}',
+    expires_at TIMESTAMP WITH TIME ZONE,
+    last_used_at TIMESTAMP WITH TIME ZONE,
+    last_used_ip INET,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Audit events table. Append-only record of security-relevant actions; each
+-- event's hash covers the previous event's hash, so changing, removing or
+-- reordering events breaks the chain.
+CREATE TABLE audit_events (
+    seq BIGINT PRIMARY KEY,
+    occurred_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    actor_id UUID,
+    actor_email VARCHAR(255) NOT NULL DEFAULT '',
+    action VARCHAR(64) NOT NULL,
+    resource_type VARCHAR(32) NOT NULL DEFAULT '',
+    resource_id VARCHAR(64) NOT NULL DEFAULT '',
+    ip_address INET,
+    user_agent TEXT NOT NULL DEFAULT '',
+    details JSONB NOT NULL DEFAULT '{}',
+    prev_hash VARCHAR(64) NOT NULL,
+    hash VARCHAR(64) UNIQUE NOT NULL
+);
+
+CREATE FUNCTION audit_events_append_only() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'audit_events is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER audit_events_no_update
+BEFORE UPDATE OR DELETE ON audit_events
+FOR EACH ROW EXECUTE FUNCTION audit_events_append_only();
+
+CREATE TRIGGER audit_events_no_truncate
+BEFORE TRUNCATE ON audit_events
+FOR EACH STATEMENT EXECUTE FUNCTION audit_events_append_only();
+
+-- Document tags table. Free-form labels that retention policies can target.
+CREATE TABLE document_tags (
+    document_id UUID NOT NULL REFERENCES documents(id) ON DELETE CASCADE,
+    tag VARCHAR(64) NOT NULL,
+    PRIMARY KEY (document_id, tag)
+);
+
+-- Retention policies table. Documents of a workspace, of a folder and its
+-- subfolders, or with a tag are kept for the retention period and deleted
+-- once they are older; their uploaders are warned warn_days before.
+CREATE TABLE retention_policies (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    workspace_id UUID NOT NULL REFERENCES workspaces(id) ON DELETE CASCADE,
+    folder_id UUID REFERENCES folders(id) ON DELETE CASCADE,
+    tag VARCHAR(64),
+    retain_months INTEGER NOT NULL DEFAULT 0 CHECK (retain_months >= 0),
+    retain_days INTEGER NOT NULL DEFAULT 0 CHECK (retain_days >= 0),
+    warn_days INTEGER NOT NULL DEFAULT 14 CHECK (warn_days >= 0),
+    created_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    CHECK (retain_months > 0 OR retain_days > 0),
+    CHECK (folder_id IS NULL OR tag IS NULL)
+);
+
+-- Retention notices table. The expiry warning sent for a document, and when
+-- it will be deleted: never sooner than warn_days after the warning.
+CREATE TABLE retention_notices (
+    document_id UUID PRIMARY KEY REFERENCES documents(id) ON DELETE CASCADE,
+    due_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    delete_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    notified_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Legal holds table. Freezes a document, a folder with everything in it,
+-- or everything a user uploaded: held items cannot be deleted, moved or
+-- expired until the hold is released. Released holds are kept as a record.
+CREATE TABLE legal_holds (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    resource_type VARCHAR(16) NOT NULL CHECK (resource_type IN ('document', 'folder', 'user')),
+    resource_id UUID NOT NULL,
+    reason TEXT NOT NULL,
+    custodian VARCHAR(255) NOT NULL,
+    placed_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    placed_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    released_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    released_at TIMESTAMP WITH TIME ZONE,
+    release_reason TEXT
+);
+
+CREATE FUNCTION document_held(doc UUID) RETURNS BOOLEAN AS $$
+    WITH RECURSIVE folder_path AS (
+        SELECT f.id, f.parent_id FROM folders f JOIN documents d ON d.folder_id = f.id WHERE d.id = doc
+        UNION
+        SELECT f.id, f.parent_id FROM folders f JOIN folder_path p ON f.id = p.parent_id
+    )
+    SELECT EXISTS (
+        SELECT 1 FROM legal_holds h
+        WHERE h.released_at IS NULL AND (
+            (h.resource_type = 'document' AND h.resource_id = doc)
+            OR (h.resource_type = 'user' AND h.resource_id = (SELECT user_id FROM documents WHERE id = doc))
+            OR (h.resource_type = 'folder' AND h.resource_id IN (SELECT id FROM folder_path))
+        )
+    );
+$$ LANGUAGE sql STABLE;
+
+CREATE FUNCTION folder_held(folder UUID) RETURNS BOOLEAN AS $$
+    WITH RECURSIVE folder_path AS (
+        SELECT id, parent_id, user_id FROM folders WHERE id = folder
+        UNION
+        SELECT f.id, f.parent_id, f.user_id FROM folders f JOIN folder_path p ON f.id = p.parent_id
+    )
+    SELECT EXISTS (
+        SELECT 1 FROM legal_holds h
+        WHERE h.released_at IS NULL AND (
+            (h.resource_type = 'folder' AND h.resource_id IN (SELECT id FROM folder_path))
+            OR (h.resource_type = 'user' AND h.resource_id = (SELECT user_id FROM folders WHERE id = folder))
+        )
+    );
+$$ LANGUAGE sql STABLE;
+
+CREATE FUNCTION legal_hold_no_delete() RETURNS trigger AS $$
+BEGIN
+    IF (TG_TABLE_NAME = 'documents' AND document_held(OLD.id))
+        OR (TG_TABLE_NAME = 'folders' AND folder_held(OLD.id))
+        OR (TG_TABLE_NAME = 'users' AND EXISTS (
+            SELECT 1 FROM legal_holds
+            WHERE resource_type = 'user' AND resource_id = OLD.id AND released_at IS NULL
+        ))
+    THEN
+        RAISE EXCEPTION '% % is under legal hold', TG_TABLE_NAME, OLD.id;
+    END IF;
+    RETURN OLD;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER documents_legal_hold
+BEFORE DELETE ON documents
+FOR EACH ROW EXECUTE FUNCTION legal_hold_no_delete();
+
+CREATE TRIGGER folders_legal_hold
+BEFORE DELETE ON folders
+FOR EACH ROW EXECUTE FUNCTION legal_hold_no_delete();
+
+CREATE TRIGGER users_legal_hold
+BEFORE DELETE ON users
+FOR EACH ROW EXECUTE FUNCTION legal_hold_no_delete();
+
+-- Data exports table. Archives of everything the portal holds about a
+-- user, built in the background and downloadable until they expire.
+CREATE TABLE data_exports (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    status VARCHAR(16) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'running', 'ready', 'failed')),
+    file_path VARCHAR(500),
+    file_size BIGINT NOT NULL DEFAULT 0,
+    error TEXT,
+    requested_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    completed_at TIMESTAMP WITH TIME ZONE,
+    expires_at TIMESTAMP WITH TIME ZONE
 );
 
 -- Indexes
@@ -55,10 +475,48 @@ CREATE INDEX idx_users_email ON users(email);
 CREATE INDEX idx_users_created_at ON users(created_at);
 CREATE INDEX idx_documents_user_id ON documents(user_id);
 CREATE INDEX idx_documents_created_at ON documents(created_at);
-CREATE INDEX idx_shares_document_id ON shares(document_id);
+CREATE INDEX idx_documents_folder_id ON documents(folder_id);
+CREATE INDEX idx_folders_user_id ON folders(user_id);
+CREATE INDEX idx_folders_parent_id ON folders(parent_id);
+CREATE INDEX idx_share_documents_document_id ON share_documents(document_id);
+CREATE INDEX idx_share_access_logs_share_id ON share_access_logs(share_id);
+CREATE INDEX idx_share_access_logs_share_id_action ON share_access_logs(share_id, action, created_at);
+CREATE INDEX idx_shares_folder_id ON shares(folder_id);
 CREATE INDEX idx_shares_share_token ON shares(share_token);
 CREATE INDEX idx_shares_expires_at ON shares(expires_at);
 CREATE INDEX idx_shares_created_by ON shares(created_by);
+CREATE INDEX idx_file_requests_user_id ON file_requests(user_id);
+CREATE INDEX idx_file_requests_request_token ON file_requests(request_token);
+CREATE INDEX idx_file_request_uploads_file_request_id ON file_request_uploads(file_request_id);
 CREATE INDEX idx_sessions_user_id ON sessions(user_id);
 CREATE INDEX idx_sessions_token ON sessions(token);
-CREATE INDEX idx_sessions_expires_at ON sessions(expires_at);
\ No newline at end of file
+CREATE INDEX idx_sessions_expires_at ON sessions(expires_at);
+CREATE INDEX idx_refresh_tokens_session_id ON refresh_tokens(session_id);
+CREATE INDEX idx_mfa_recovery_codes_user_id ON mfa_recovery_codes(user_id);
+CREATE INDEX idx_webauthn_credentials_user_id ON webauthn_credentials(user_id);
+CREATE INDEX idx_webauthn_challenges_expires_at ON webauthn_challenges(expires_at);
+CREATE INDEX idx_user_identities_user_id ON user_identities(user_id);
+CREATE INDEX idx_oidc_auth_requests_expires_at ON oidc_auth_requests(expires_at);
+CREATE INDEX idx_account_tokens_user_id ON account_tokens(user_id);
+CREATE INDEX idx_account_tokens_expires_at ON account_tokens(expires_at);
+CREATE INDEX idx_api_keys_user_id ON api_keys(user_id);
+CREATE INDEX idx_organization_members_user_id ON organization_members(user_id);
+CREATE INDEX idx_team_members_user_id ON team_members(user_id);
+CREATE INDEX idx_workspaces_organization_id ON workspaces(organization_id);
+CREATE INDEX idx_workspace_members_user_id ON workspace_members(user_id);
+CREATE INDEX idx_workspace_members_team_id ON workspace_members(team_id);
+CREATE INDEX idx_documents_workspace_id ON documents(workspace_id);
+CREATE INDEX idx_folders_workspace_id ON folders(workspace_id);
+CREATE INDEX idx_document_grants_user_id ON document_grants(user_id);
+CREATE INDEX idx_document_grants_team_id ON document_grants(team_id);
+CREATE INDEX idx_audit_events_occurred_at ON audit_events(occurred_at);
+CREATE INDEX idx_audit_events_actor_id ON audit_events(actor_id);
+CREATE INDEX idx_audit_events_action ON audit_events(action);
+CREATE INDEX idx_audit_events_resource ON audit_events(resource_type, resource_id);
+CREATE INDEX idx_document_tags_tag ON document_tags(tag);
+CREATE UNIQUE INDEX idx_retention_policies_scope ON retention_policies(workspace_id, COALESCE(folder_id::text, ''), COALESCE(tag, ''));
+CREATE INDEX idx_legal_holds_active ON legal_holds(resource_type, resource_id) WHERE released_at IS NULL;
+CREATE INDEX idx_documents_deleted_at ON documents(deleted_at) WHERE deleted_at IS NOT NULL;
+CREATE INDEX idx_data_exports_user_id ON data_exports(user_id);
+CREATE UNIQUE INDEX idx_data_exports_in_progress ON data_exports(user_id) WHERE status IN ('pending', 'running');
+CREATE INDEX idx_users_delete_after ON users(delete_after) WHERE delete_after IS NOT NULL;
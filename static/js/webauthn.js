@@ -0,0 +1,191 @@
+// WebAuthn ceremonies for security keys and passkeys. The server sends
+// options as JSON with binary fields base64url encoded; the browser API
+// needs them as ArrayBuffers, and the responses go back the same way.
+
+function base64urlToBuffer(value) {
+	const base64 = value.replace(/-/g, '+').replace(/_/g, '/');
+	const padded = base64 + '='.repeat((4 - base64.length % 4) % 4);
+	const binary = atob(padded);
+	const bytes = new Uint8Array(binary.length);
+	for (let i = 0; i < binary.length; i++) {
+		bytes[i] = binary.charCodeAt(i);
+	}
+	return bytes.buffer;
+}
+
+function bufferToBase64url(buffer) {
+	const bytes = new Uint8Array(buffer);
+	let binary = '';
+	for (let i = 0; i < bytes.length; i++) {
+		binary += String.fromCharCode(bytes[i]);
+	}
+	return btoa(binary).replace(/\+/g, '-').replace(/\//g, '_').replace(/=+$/, '');
+}
+
+function credentialToJSON(credential) {
+	const response = {
+		clientDataJSON: bufferToBase64url(credential.response.clientDataJSON),
+	};
+	if (credential.response.attestationObject) {
+		response.attestationObject = bufferToBase64url(credential.response.attestationObject);
+		if (credential.response.getTransports) {
+			response.transports = credential.response.getTransports();
+		}
+	}
+	if (credential.response.authenticatorData) {
+		response.authenticatorData = bufferToBase64url(credential.response.authenticatorData);
+		response.signature = bufferToBase64url(credential.response.signature);
+		if (credential.response.userHandle) {
+			response.userHandle = bufferToBase64url(credential.response.userHandle);
+		}
+	}
+	return {
+		id: credential.id,
+		rawId: bufferToBase64url(credential.rawId),
+		type: credential.type,
+		authenticatorAttachment: credential.authenticatorAttachment || undefined,
+		clientExtensionResults: credential.getClientExtensionResults(),
+		response: response,
+	};
+}
+
+function webauthnSupported() {
+	if (window.PublicKeyCredential && navigator.credentials) {
+		return true;
+	}
+	showToast('This browser does not support security keys or passkeys.', 'error');
+	return false;
+}
+
+async function webauthnBegin(url, body) {
+	const res = await fetch(url, {
+		method: 'POST',
+		headers: { 'Content-Type': 'application/json', 'Accept': 'application/json' },
+		body: JSON.stringify(body || {}),
+	});
+	const data = await res.json().catch(() => ({}));
+	if (!res.ok) {
+		throw new Error(data.error || 'Failed to start the security key request');
+	}
+	return data;
+}
+
+// webauthnLoginFinish sends the assertion as an HTMX-style request, so the
+// server sets the session cookies and answers with a redirect, or with an
+// error message to show in errorTarget
+async function webauthnLoginFinish(url, body, errorTarget) {
+	const res = await fetch(url, {
+		method: 'POST',
+		headers: { 'Content-Type': 'application/json', 'HX-Request': 'true' },
+		body: JSON.stringify(body),
+	});
+	const redirect = res.headers.get('HX-Redirect');
+	if (res.ok && redirect) {
+		window.location.href = redirect;
+		return;
+	}
+	const html = await res.text();
+	if (res.ok && res.headers.get('HX-Retarget')) {
+		// Recovery codes or other content replacing the page
+		const target = document.querySelector(res.headers.get('HX-Retarget'));
+		target.innerHTML = html;
+		htmx.process(target);
+		return;
+	}
+	document.getElementById(errorTarget).innerHTML = html;
+}
+
+function webauthnFailed(err, errorTarget) {
+	// The user dismissing the browser prompt is not an error worth showing
+	if (err.name === 'NotAllowedError' || err.name === 'AbortError') {
+		return;
+	}
+	const box = document.getElementById(errorTarget);
+	if (box) {
+		box.innerHTML = '<div class="mb-4 p-4 bg-red-100 border border-red-400 text-red-700 rounded"><p></p></div>';
+		box.querySelector('p').textContent = err.message;
+	} else {
+		showToast(err.message, 'error');
+	}
+}
+
+async function webauthnRegister(name) {
+	if (!webauthnSupported()) {
+		return;
+	}
+	try {
+		const begin = await webauthnBegin('/api/account/webauthn/register/begin');
+		const options = begin.options.publicKey;
+		options.challenge = base64urlToBuffer(options.challenge);
+		options.user.id = base64urlToBuffer(options.user.id);
+		(options.excludeCredentials || []).forEach((c) => { c.id = base64urlToBuffer(c.id); });
+
+		const credential = await navigator.credentials.create({ publicKey: options });
+
+		const res = await fetch('/api/account/webauthn/register/finish', {
+			method: 'POST',
+			headers: { 'Content-Type': 'application/json', 'Accept': 'application/json' },
+			body: JSON.stringify({
+				ceremony_id: begin.ceremony_id,
+				name: name || '',
+				credential: credentialToJSON(credential),
+			}),
+		});
+		const data = await res.json().catch(() => ({}));
+		if (!res.ok) {
+			throw new Error(data.error || 'Security key registration failed');
+		}
+
+		showToast('Security key added.', 'success');
+		const input = document.getElementById('webauthn-name');
+		if (input) {
+			input.value = '';
+		}
+		htmx.trigger(document.body, 'webauthn-registered');
+	} catch (err) {
+		webauthnFailed(err);
+	}
+}
+
+async function webauthnGet(options) {
+	const publicKey = options.publicKey;
+	publicKey.challenge = base64urlToBuffer(publicKey.challenge);
+	(publicKey.allowCredentials || []).forEach((c) => { c.id = base64urlToBuffer(c.id); });
+	const credential = await navigator.credentials.get({ publicKey: publicKey });
+	return credentialToJSON(credential);
+}
+
+// webauthnPasskeyLogin signs in with a passkey alone
+async function webauthnPasskeyLogin(errorTarget) {
+	if (!webauthnSupported()) {
+		return;
+	}
+	try {
+		const begin = await webauthnBegin('/api/auth/webauthn/login/begin');
+		const credential = await webauthnGet(begin.options);
+		await webauthnLoginFinish('/api/auth/webauthn/login/finish', {
+			ceremony_id: begin.ceremony_id,
+			credential: credential,
+		}, errorTarget);
+	} catch (err) {
+		webauthnFailed(err, errorTarget);
+	}
+}
+
+// webauthnSecondFactor answers an MFA challenge with a security key
+async function webauthnSecondFactor(challengeToken, errorTarget) {
+	if (!webauthnSupported()) {
+		return;
+	}
+	try {
+		const begin = await webauthnBegin('/api/auth/mfa/webauthn/begin', { challenge_token: challengeToken });
+		const credential = await webauthnGet(begin.options);
+		await webauthnLoginFinish('/api/auth/mfa/webauthn/finish', {
+			ceremony_id: begin.ceremony_id,
+			challenge_token: challengeToken,
+			credential: credential,
+		}, errorTarget);
+	} catch (err) {
+		webauthnFailed(err, errorTarget);
+	}
+}